@@ -4,16 +4,66 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/detect"
 	"gopkg.in/yaml.v3"
 )
 
+// uniqueKeysFlag collects repeated --uniqueKey flags, each of which may hold
+// a comma-separated list of fields
+type uniqueKeysFlag []string
+
+func (u *uniqueKeysFlag) String() string { return strings.Join(*u, ",") }
+
+func (u *uniqueKeysFlag) Set(s string) error {
+	for _, k := range strings.Split(s, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			*u = append(*u, k)
+		}
+	}
+	return nil
+}
+
 func runAddRule(opts AddRuleOptions) error {
-	if opts.Path == "" || opts.UniqueKey == "" {
-		return fmt.Errorf("--path and --uniqueKey are required")
+	if opts.Path == "" {
+		return fmt.Errorf("--path is required")
+	}
+	if opts.Ignore {
+		if len(opts.UniqueKeys) > 0 || opts.Set || opts.KeyStrategy != "" || opts.PromoteScalar != "" || opts.Note != "" {
+			return fmt.Errorf("--ignore can't be combined with rule flags")
+		}
+		if err := validatePathPattern(opts.Path, false); err != nil {
+			return err
+		}
+	} else {
+		if len(opts.UniqueKeys) == 0 && !opts.Set {
+			return fmt.Errorf("--path and --uniqueKey are required")
+		}
+		if err := validatePathPattern(opts.Path, true); err != nil {
+			return err
+		}
+	}
+
+	rule := Rule{
+		PathPattern:   opts.Path,
+		UniqueKeys:    opts.UniqueKeys,
+		PromoteScalar: opts.PromoteScalar,
+		Set:           opts.Set,
+		KeyStrategy:   opts.KeyStrategy,
+		Note:          opts.Note,
+	}
+	// Several keys identify items together, joined unless told to nest
+	if len(rule.UniqueKeys) > 1 && rule.KeyStrategy == "" && !rule.Set {
+		rule.KeyStrategy = detect.KeyStrategyComposite
+	}
+	if len(rule.UniqueKeys) > 1 && rule.Set {
+		return fmt.Errorf("--set takes a single --uniqueKey, the field of single-field items")
+	}
+	if err := validateRule(rule); err != nil {
+		return err
 	}
 
-	r := Rule{PathPattern: opts.Path, UniqueKeys: []string{opts.UniqueKey}}
 	user := opts.ConfigPath
 	if user == "" {
 		user = defaultUserConfigPath()
@@ -21,15 +71,56 @@ func runAddRule(opts AddRuleOptions) error {
 	if err := os.MkdirAll(filepath.Dir(user), 0755); err != nil {
 		return err
 	}
+	// Other runs may add rules at the same time, so the config is read and
+	// written under its lock
+	unlock, err := lockPath(user)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	var current Config
 	if b, err := os.ReadFile(user); err == nil {
-		_ = yaml.Unmarshal(b, &current)
+		if err := yaml.Unmarshal(b, &current); err != nil {
+			return fmt.Errorf("cannot parse %s, so adding to it would lose its contents: %w", user, err)
+		}
+	}
+	if opts.Ignore {
+		current.IgnorePaths = append(current.IgnorePaths, opts.Path)
+	} else {
+		current.Rules = append(current.Rules, rule)
 	}
-	current.Rules = append(current.Rules, r)
 	out, _ := yaml.Marshal(current)
-	if err := os.WriteFile(user, out, 0644); err != nil {
+	if err := writeFileAtomic(user, out, 0644); err != nil {
 		return err
 	}
-	fmt.Printf("Added rule to %s: %s (key=%s)\n", user, opts.Path, opts.UniqueKey)
+	if opts.Ignore {
+		fmt.Printf("Added ignore path to %s: %s\n", user, opts.Path)
+		return nil
+	}
+	fmt.Printf("Added rule to %s: %s (%s)\n", user, opts.Path, ruleDescription(&rule))
+	return nil
+}
+
+// validatePathPattern checks that a rule or ignore path pattern is a dot
+// path of field names and * wildcards. Rule patterns name a list, so they
+// end with [] (e.g., database.primary.extraEnv[]).
+func validatePathPattern(pattern string, list bool) error {
+	path := pattern
+	if list {
+		if !strings.HasSuffix(pattern, "[]") {
+			return fmt.Errorf("invalid path %q: a rule's path names a list, so it ends with [] (%s[])", pattern, pattern)
+		}
+		path = strings.TrimSuffix(pattern, "[]")
+	}
+	for _, seg := range strings.Split(path, ".") {
+		switch {
+		case seg == "":
+			return fmt.Errorf("invalid path %q: empty segment (check for leading, trailing, or doubled dots)", pattern)
+		case seg != "*" && strings.Contains(seg, "*"):
+			return fmt.Errorf("invalid path %q: * matches a whole segment, not part of %q", pattern, seg)
+		case strings.ContainsAny(seg, "[] \t"):
+			return fmt.Errorf("invalid path %q: segment %q can't contain brackets or spaces (only the list itself ends with [])", pattern, seg)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+	"gopkg.in/yaml.v3"
+)
+
+func TestAddRule(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+
+	// Repeated --uniqueKey flags, each possibly comma-separated
+	fs := flag.NewFlagSet("add-rule", flag.ContinueOnError)
+	opts := AddRuleOptions{ConfigPath: configPath}
+	fs.Var((*uniqueKeysFlag)(&opts.UniqueKeys), "uniqueKey", "")
+	if err := fs.Parse([]string{"--uniqueKey=namespace", "--uniqueKey=name, port"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"namespace", "name", "port"}; !reflect.DeepEqual(opts.UniqueKeys, want) {
+		t.Fatalf("UniqueKeys = %v, want %v", opts.UniqueKeys, want)
+	}
+
+	for _, o := range []AddRuleOptions{
+		{Path: "mesh.services[]", UniqueKeys: []string{"namespace", "name"}, ConfigPath: configPath},
+		{Path: "myapp.plugins[]", UniqueKeys: []string{"name"}, PromoteScalar: "name", Note: "plugins may be listed by name only", ConfigPath: configPath},
+		{Path: "legacy.*", Ignore: true, ConfigPath: configPath},
+	} {
+		if _, err := captureOutput(t, func() error { return runAddRule(o) }); err != nil {
+			t.Fatalf("runAddRule(%+v) error = %v", o, err)
+		}
+	}
+
+	data, _ := os.ReadFile(configPath)
+	var got Config
+	if err := yaml.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []Rule{
+		{PathPattern: "mesh.services[]", UniqueKeys: []string{"namespace", "name"}, KeyStrategy: "composite"},
+		{PathPattern: "myapp.plugins[]", UniqueKeys: []string{"name"}, PromoteScalar: "name", Note: "plugins may be listed by name only"},
+	}
+	if !reflect.DeepEqual(got.Rules, want) {
+		t.Errorf("rules = %+v, want %+v", got.Rules, want)
+	}
+	if !reflect.DeepEqual(got.IgnorePaths, []string{"legacy.*"}) {
+		t.Errorf("ignorePaths = %v", got.IgnorePaths)
+	}
+
+	conf = got
+	output, err := captureOutput(t, func() error { return runListRules(ListRulesOptions{}) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"- mesh.services[] (keys=namespace,name (composite))", "scalar items promoted into name", "note: plugins may be listed by name only"} {
+		if !strings.Contains(output, s) {
+			t.Errorf("rules output missing %q\nGot:\n%s", s, output)
+		}
+	}
+}
+
+func TestAddRuleErrors(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+
+	tests := []struct {
+		name    string
+		opts    AddRuleOptions
+		wantErr string
+	}{
+		{"missing key", AddRuleOptions{Path: "env[]"}, "--uniqueKey are required"},
+		{"missing []", AddRuleOptions{Path: "env", UniqueKeys: []string{"name"}}, "ends with []"},
+		{"ignore with rule flags", AddRuleOptions{Path: "env", Ignore: true, Note: "why"}, "can't be combined"},
+		{"set with several keys", AddRuleOptions{Path: "env[]", UniqueKeys: []string{"a", "b"}, Set: true}, "single --uniqueKey"},
+		{"bad key strategy", AddRuleOptions{Path: "env[]", UniqueKeys: []string{"a", "b"}, KeyStrategy: "flat"}, "invalid keyStrategy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.ConfigPath = configPath
+			err := runAddRule(tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("runAddRule() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+	if _, err := os.Stat(configPath); !os.IsNotExist(err) {
+		t.Errorf("config written for an invalid rule: %v", err)
+	}
+}
+
+func TestValidatePathPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		list    bool
+		wantErr bool
+	}{
+		{"database.primary.extraEnv[]", true, false},
+		{"*.extraEnv[]", true, false},
+		{"env[]", true, false},
+		{"legacy.*", false, false},
+		{"env", true, true},
+		{".env[]", true, true},
+		{"a..b[]", true, true},
+		{"env[][]", true, true},
+		{"items[0].env[]", true, true},
+		{"extra*.env[]", true, true},
+		{"my env[]", true, true},
+		{"", false, true},
+	}
+	for _, tt := range tests {
+		err := validatePathPattern(tt.pattern, tt.list)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validatePathPattern(%q, %v) error = %v, wantErr %v", tt.pattern, tt.list, err, tt.wantErr)
+		}
+	}
+}
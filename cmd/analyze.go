@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"gopkg.in/yaml.v3"
+)
+
+// analysisKind identifies the analyze document, under migrationAPIVersion
+const analysisKind = "Analysis"
+
+// Severities of analysis findings, named as editors name diagnostics
+const (
+	severityInfo    = "info"    // convert would change the path
+	severityWarning = "warning" // the path stays a list until something is fixed
+	severityHint    = "hint"    // the path is kept as a list on purpose
+)
+
+// Events of an analyze --stream run
+const (
+	eventStart   = "start"   // a chart's analysis began
+	eventFinding = "finding" // a finding in one of the chart's files
+	eventEnd     = "end"     // a chart's analysis finished
+	eventError   = "error"   // a chart couldn't be analyzed
+)
+
+// lineRange is the 1-based, inclusive lines of a chart file a finding covers
+type lineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// analysisFix is a suggested fix for a finding
+type analysisFix struct {
+	Description string `json:"description"`
+	Command     string `json:"command,omitempty"`
+}
+
+// analysisFinding is a conversion decision located in a chart file, for
+// editors to show where the file is open
+type analysisFinding struct {
+	File     string       `json:"file"` // relative to the chart root
+	Lines    lineRange    `json:"lines"`
+	Path     string       `json:"path"`
+	Decision string       `json:"decision"` // convert or skip
+	Category string       `json:"category"` // the decision's reason
+	Severity string       `json:"severity"`
+	Message  string       `json:"message"`
+	Fix      *analysisFix `json:"fix,omitempty"`
+}
+
+// chartAnalysis is the findings in one chart
+type chartAnalysis struct {
+	Chart    string            `json:"chart"`
+	Version  string            `json:"version,omitempty"`
+	Path     string            `json:"path"`
+	Findings []analysisFinding `json:"findings"`
+}
+
+// analysisEvent is one line of analyze --stream output. Findings are written
+// flat, next to the event and chart root.
+type analysisEvent struct {
+	Event string `json:"event"`
+	Root  string `json:"root"` // chart root the finding's file is relative to
+	*analysisFinding
+	Chart    string `json:"chart,omitempty"`    // chart name, on start events
+	Version  string `json:"version,omitempty"`  // chart version, on start events
+	Findings *int   `json:"findings,omitempty"` // number of findings, on end events
+	Error    string `json:"error,omitempty"`
+}
+
+func runAnalyze(opts AnalyzeOptions) error {
+	charts := opts.Charts
+	if len(charts) == 0 {
+		charts = []string{"."}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	var emit func(analysisEvent) error
+	var writeErr error
+	if opts.Stream {
+		emit = func(e analysisEvent) error {
+			writeErr = enc.Encode(e)
+			return writeErr
+		}
+	}
+	var all []chartAnalysis
+	failed := 0
+	for _, dir := range charts {
+		a, err := analyzeChart(dir, emit)
+		if writeErr != nil {
+			return writeErr
+		}
+		if !opts.Stream {
+			if err != nil {
+				return fmt.Errorf("%s: %w", dir, err)
+			}
+			all = append(all, a)
+			continue
+		}
+		if err != nil {
+			// Keep going, so one broken chart doesn't hide the others' findings
+			failed++
+			if err := emit(analysisEvent{Event: eventError, Root: dir, Error: err.Error()}); err != nil {
+				return err
+			}
+		}
+	}
+	if !opts.Stream {
+		return writeAnalysisJSON(os.Stdout, all)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d chart(s) couldn't be analyzed", failed)
+	}
+	return nil
+}
+
+// analyzeChart locates the decisions about the chart at dir in its values.yaml
+// and templates. Converted paths need nothing done and aren't reported. When
+// emit isn't nil, it gets the start event once the chart is loaded, each
+// path's findings as soon as they're located, and the end event.
+func analyzeChart(dir string, emit func(analysisEvent) error) (chartAnalysis, error) {
+	root, err := findChartRoot(dir)
+	if err != nil {
+		return chartAnalysis{}, err
+	}
+	d, err := collectChartDecisions(root)
+	if err != nil {
+		return chartAnalysis{}, err
+	}
+	doc, _, err := loadValuesNode(filepath.Join(root, "values.yaml"))
+	if err != nil && !os.IsNotExist(err) {
+		return chartAnalysis{}, err
+	}
+
+	a := chartAnalysis{Chart: d.Chart, Version: d.Version, Path: root, Findings: []analysisFinding{}}
+	if emit != nil {
+		if err := emit(analysisEvent{Event: eventStart, Root: root, Chart: d.Chart, Version: d.Version}); err != nil {
+			return a, err
+		}
+	}
+	for _, dec := range d.Decisions {
+		if dec.Decision == decisionConverted {
+			continue
+		}
+		found := len(a.Findings)
+		f := analysisFinding{
+			Path:     dec.Path,
+			Decision: dec.Decision,
+			Category: dec.Reason,
+			Severity: findingSeverity(dec),
+			Message:  findingMessage(dec),
+			Fix:      findingFix(root, dec),
+		}
+		if lines, ok := valuesLines(doc, dec.Path); ok {
+			f.File, f.Lines = "values.yaml", lines
+			a.Findings = append(a.Findings, f)
+		}
+		// explainSkippedPath finds the template lines rendering any path
+		for _, u := range explainSkippedPath(root, dec.Path) {
+			tf := f
+			tf.File, tf.Lines = u.TemplateFile, lineRange{u.LineNumber, u.LineNumber}
+			if dec.Reason == skipTemplate {
+				tf.Message += ": " + u.Reason
+			}
+			a.Findings = append(a.Findings, tf)
+		}
+		if emit == nil {
+			continue
+		}
+		for i := found; i < len(a.Findings); i++ {
+			if err := emit(analysisEvent{Event: eventFinding, Root: root, analysisFinding: &a.Findings[i]}); err != nil {
+				return a, err
+			}
+		}
+	}
+	if emit != nil {
+		n := len(a.Findings)
+		if err := emit(analysisEvent{Event: eventEnd, Root: root, Findings: &n}); err != nil {
+			return a, err
+		}
+	}
+
+	// The document lists values.yaml first, then templates, each from the top
+	sort.SliceStable(a.Findings, func(i, j int) bool {
+		fi, fj := a.Findings[i], a.Findings[j]
+		if (fi.File == "values.yaml") != (fj.File == "values.yaml") {
+			return fi.File == "values.yaml"
+		}
+		if fi.File != fj.File {
+			return fi.File < fj.File
+		}
+		return fi.Lines.Start < fj.Lines.Start
+	})
+	return a, nil
+}
+
+// valuesLines returns the lines of the key at path in values.yaml and its
+// value, or false if values.yaml doesn't set it
+func valuesLines(doc *yaml.Node, path string) (lineRange, bool) {
+	if doc == nil || len(doc.Content) == 0 {
+		return lineRange{}, false
+	}
+	keys := strings.Split(path, ".")
+	parent := nodeAt(doc.Content[0], keys[:len(keys)-1]...)
+	if parent == nil || parent.Kind != yaml.MappingNode {
+		return lineRange{}, false
+	}
+	k, v := mappingEntry(parent, keys[len(keys)-1])
+	if k == nil {
+		return lineRange{}, false
+	}
+	return lineRange{k.Line, max(k.Line, lastLine(v))}, true
+}
+
+// lastLine returns the last line a node or any node below it starts on
+func lastLine(n *yaml.Node) int {
+	last := n.Line
+	for _, c := range n.Content {
+		last = max(last, lastLine(c))
+	}
+	return last
+}
+
+// findingSeverity grades a decision: conversions are information, lists kept
+// on purpose are hints, and lists kept for want of a key or schema are warnings
+func findingSeverity(dec conversionDecision) string {
+	switch {
+	case dec.Decision == decisionConvert:
+		return severityInfo
+	case dec.Reason == skipIgnored || dec.Reason == skipMinItems || dec.Reason == string(k8s.CategoryNotInRelease):
+		return severityHint
+	}
+	return severityWarning
+}
+
+// findingMessage describes a decision in a sentence
+func findingMessage(dec conversionDecision) string {
+	if dec.Decision != decisionConvert {
+		return fmt.Sprintf("%s stays a list (%s): %s", dec.Path, dec.Reason, dec.Detail)
+	}
+	if dec.Shape == "set" {
+		return fmt.Sprintf("%s can be a set: %s", dec.Path, dec.Detail)
+	}
+	return fmt.Sprintf("%s can be a map keyed by %s: %s", dec.Path, dec.Key, dec.Detail)
+}
+
+// findingFix suggests how to act on a decision, or returns nil when the list
+// is kept as intended or only the templates can be changed
+func findingFix(root string, dec conversionDecision) *analysisFix {
+	addRule := fmt.Sprintf("helm list-to-map add-rule --path='%s[]' --uniqueKey=name", dec.Path)
+	switch {
+	case dec.Decision == decisionConvert:
+		return &analysisFix{Description: "convert the chart", Command: "helm list-to-map convert --chart " + root}
+	case dec.Reason == skipAsk:
+		return &analysisFix{Description: "choose whether to convert it", Command: "helm list-to-map convert --tui --chart " + root}
+	case dec.Reason == string(k8s.CategoryK8sNoKeys) || dec.Reason == string(k8s.CategoryCRDNoKeys) || dec.Reason == string(k8s.CategoryUnknownType):
+		return &analysisFix{Description: "add a rule with the field that identifies its items", Command: addRule}
+	case dec.Reason == skipConflict:
+		return &analysisFix{Description: "add a rule choosing the key", Command: addRule}
+	case dec.Reason == string(k8s.CategoryMissingCRD):
+		kind := "the Custom Resource"
+		if len(dec.Resources) > 0 && dec.Resources[0].Kind != "" {
+			kind = dec.Resources[0].Kind
+		}
+		return &analysisFix{Description: "load the CRD for " + kind, Command: "helm list-to-map load-crd <url-or-file>"}
+	}
+	return nil
+}
+
+// writeAnalysisJSON writes the findings in every chart as one JSON document
+func writeAnalysisJSON(w io.Writer, all []chartAnalysis) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		APIVersion string          `json:"apiVersion"`
+		Kind       string          `json:"kind"`
+		Charts     []chartAnalysis `json:"charts"`
+	}{migrationAPIVersion, analysisKind, all})
+}
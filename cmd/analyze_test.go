@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+func TestAnalyze(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	originalConf := conf
+	defer func() { conf = originalConf }()
+	conf = Config{IgnoreTypes: []string{"VolumeMount"}}
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	values, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	values = append(values, []byte("\ntolerations:\n  - key: dedicated\n    operator: Exists\n")...)
+	if err := os.WriteFile(filepath.Join(chartPath, "values.yaml"), values, 0644); err != nil {
+		t.Fatal(err)
+	}
+	deployment, _ := os.ReadFile(filepath.Join(chartPath, "templates", "deployment.yaml"))
+	deployment = append(deployment, []byte("      tolerations:\n        {{- toYaml .Values.tolerations | nindent 8 }}\n")...)
+	if err := os.WriteFile(filepath.Join(chartPath, "templates", "deployment.yaml"), deployment, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		out, err := captureOutput(t, func() error {
+			return runAnalyze(AnalyzeOptions{Charts: []string{chartPath}, Stream: true})
+		})
+		if err != nil {
+			t.Fatalf("runAnalyze() error = %v\n%s", err, out)
+		}
+
+		var events []analysisEvent
+		var findings []analysisFinding
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+			e := analysisEvent{analysisFinding: &analysisFinding{}}
+			if err := json.Unmarshal([]byte(line), &e); err != nil {
+				t.Fatalf("line %q isn't a JSON event: %v", line, err)
+			}
+			events = append(events, e)
+			if e.Event == eventFinding {
+				if e.Root != chartPath || e.File == "" {
+					t.Errorf("finding event = %s", line)
+					continue
+				}
+				findings = append(findings, *e.analysisFinding)
+			}
+		}
+		if len(events) < 2 || events[0].Event != eventStart || events[0].Chart != "basic" || events[0].Version != "0.1.0" {
+			t.Fatalf("the stream should start with the chart, got:\n%s", out)
+		}
+		last := events[len(events)-1]
+		if last.Event != eventEnd || last.Findings == nil || *last.Findings != len(findings) {
+			t.Fatalf("the stream should end with the number of findings, got:\n%s", out)
+		}
+
+		// Each path's findings are written together, as it's decided
+		want := []string{
+			"values.yaml:7-11 env convert/schema info",
+			"templates/deployment.yaml:19-19 env convert/schema info",
+			"values.yaml:26-28 tolerations skip/k8s_no_keys warning",
+			"templates/deployment.yaml:25-25 tolerations skip/k8s_no_keys warning",
+			"values.yaml:20-24 volumeMounts skip/ignored hint",
+			"templates/deployment.yaml:21-21 volumeMounts skip/ignored hint",
+			"values.yaml:13-18 volumes convert/schema info",
+			"templates/deployment.yaml:23-23 volumes convert/schema info",
+		}
+		var got []string
+		for _, f := range findings {
+			got = append(got, fmt.Sprintf("%s:%d-%d %s %s/%s %s", f.File, f.Lines.Start, f.Lines.End, f.Path, f.Decision, f.Category, f.Severity))
+		}
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("findings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+
+		for _, f := range findings {
+			switch f.Path {
+			case "env":
+				if f.Fix == nil || f.Fix.Command != "helm list-to-map convert --chart "+chartPath || !strings.Contains(f.Message, "keyed by name") {
+					t.Errorf("env finding = %+v, want a convert fix", f)
+				}
+			case "tolerations":
+				if f.Fix == nil || f.Fix.Command != "helm list-to-map add-rule --path='tolerations[]' --uniqueKey=name" {
+					t.Errorf("tolerations finding = %+v, want an add-rule fix", f)
+				}
+			case "volumeMounts":
+				if f.Fix != nil {
+					t.Errorf("ignored paths shouldn't have a fix, got %+v", f.Fix)
+				}
+			}
+		}
+	})
+
+	t.Run("stream goes on after a broken chart", func(t *testing.T) {
+		missing := filepath.Join(t.TempDir(), "missing")
+		out, err := captureOutput(t, func() error {
+			return runAnalyze(AnalyzeOptions{Charts: []string{missing, chartPath}, Stream: true})
+		})
+		if err == nil {
+			t.Fatal("runAnalyze() should fail when a chart can't be analyzed")
+		}
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		if !strings.HasPrefix(lines[0], `{"event":"error","root":"`+missing+`"`) {
+			t.Errorf("the broken chart should get an error event, got %s", lines[0])
+		}
+		if !strings.HasPrefix(lines[len(lines)-1], `{"event":"end","root":"`+chartPath+`","findings":8}`) {
+			t.Errorf("the next chart should still be analyzed, got:\n%s", out)
+		}
+	})
+
+	t.Run("document", func(t *testing.T) {
+		out, err := captureOutput(t, func() error {
+			return runAnalyze(AnalyzeOptions{Charts: []string{chartPath}})
+		})
+		if err != nil {
+			t.Fatalf("runAnalyze() error = %v", err)
+		}
+		var doc struct {
+			APIVersion string          `json:"apiVersion"`
+			Kind       string          `json:"kind"`
+			Charts     []chartAnalysis `json:"charts"`
+		}
+		if err := json.Unmarshal([]byte(out), &doc); err != nil {
+			t.Fatalf("output isn't a JSON document: %v\n%s", err, out)
+		}
+		if doc.APIVersion != migrationAPIVersion || doc.Kind != analysisKind || len(doc.Charts) != 1 || len(doc.Charts[0].Findings) != 8 {
+			t.Fatalf("document = %+v", doc)
+		}
+		// The document lists values.yaml first, then templates
+		want := []string{"values.yaml:7", "values.yaml:13", "values.yaml:20", "values.yaml:26",
+			"templates/deployment.yaml:19", "templates/deployment.yaml:21", "templates/deployment.yaml:23", "templates/deployment.yaml:25"}
+		var got []string
+		for _, f := range doc.Charts[0].Findings {
+			got = append(got, fmt.Sprintf("%s:%d", f.File, f.Lines.Start))
+		}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("document findings = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("converted paths have no findings", func(t *testing.T) {
+		if _, err := captureOutput(t, func() error {
+			return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+		}); err != nil {
+			t.Fatalf("runConvert failed: %v", err)
+		}
+		a, err := analyzeChart(chartPath, nil)
+		if err != nil {
+			t.Fatalf("analyzeChart() error = %v", err)
+		}
+		for _, f := range a.Findings {
+			if f.Decision == decisionConvert {
+				t.Errorf("converted path %s should have no findings, got %+v", f.Path, f)
+			}
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupTimeFormat is the UTC timestamp embedded in backup file names. It sorts
+// lexically in chronological order.
+const backupTimeFormat = "20060102T150405Z"
+
+// reSnapshotID matches a backup snapshot ID, with an optional counter for
+// runs started within the same second
+var reSnapshotID = regexp.MustCompile(`^\d{8}T\d{6}Z(-\d+)?$`)
+
+// backupSnapshot is the set of backups written by a single convert run
+type backupSnapshot struct {
+	ID    string
+	Files []backupEntry
+}
+
+// backupEntry pairs a backup file with the file it was taken from
+type backupEntry struct {
+	Original string
+	Backup   string
+}
+
+// snapshotBackupExt returns the backup extension for a new snapshot, e.g.
+// ".20261015T120000Z.bak". Backups from repeated runs no longer overwrite each
+// other, and the extension still ends in ext so Helm ignores backed-up templates.
+func snapshotBackupExt(root, ext string) string {
+	id := time.Now().UTC().Format(backupTimeFormat)
+	taken := make(map[string]bool)
+	if snapshots, err := listBackupSnapshots(root, ext); err == nil {
+		for _, s := range snapshots {
+			taken[s.ID] = true
+		}
+	}
+	for n, base := 2, id; taken[id]; n++ {
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+	return "." + id + ext
+}
+
+// listBackupSnapshots finds backup files under root and groups them by snapshot,
+// oldest first
+func listBackupSnapshots(root, ext string) ([]backupSnapshot, error) {
+	byID := make(map[string]*backupSnapshot)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := strings.TrimSuffix(d.Name(), ext)
+		if ext != "" && name == d.Name() {
+			return nil
+		}
+		dot := strings.LastIndex(name, ".")
+		if dot <= 0 || !reSnapshotID.MatchString(name[dot+1:]) {
+			return nil
+		}
+		id := name[dot+1:]
+		s, ok := byID[id]
+		if !ok {
+			s = &backupSnapshot{ID: id}
+			byID[id] = s
+		}
+		s.Files = append(s.Files, backupEntry{
+			Original: filepath.Join(filepath.Dir(path), name[:dot]),
+			Backup:   path,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]backupSnapshot, 0, len(byID))
+	for _, s := range byID {
+		snapshots = append(snapshots, *s)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].ID < snapshots[j].ID })
+	return snapshots, nil
+}
+
+// rotateBackups deletes the oldest snapshots under root beyond keep (0 keeps all)
+func rotateBackups(root, ext string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	snapshots, err := listBackupSnapshots(root, ext)
+	if err != nil {
+		return fmt.Errorf("listing backups: %w", err)
+	}
+	if len(snapshots) <= keep {
+		return nil
+	}
+
+	expired := snapshots[:len(snapshots)-keep]
+	for _, s := range expired {
+		for _, f := range s.Files {
+			if err := os.Remove(f.Backup); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("removing old backup: %w", err)
+			}
+		}
+	}
+	fmt.Printf("\nRemoved %d old backup snapshot(s) (--max-backups=%d)\n", len(expired), keep)
+	return nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+func TestListBackupSnapshots(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	files := []string{
+		"values.yaml.20260101T000000Z.bak",
+		"templates/deployment.yaml.20260101T000000Z.bak",
+		"values.yaml.20260102T000000Z.bak",
+		"values.yaml.20260102T000000Z-2.bak",
+		"values.yaml.bak",           // untimestamped, ignored
+		"values.yaml.notastamp.bak", // not a snapshot ID, ignored
+	}
+	for _, f := range files {
+		path := filepath.Join(root, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapshots, err := listBackupSnapshots(root, ".bak")
+	if err != nil {
+		t.Fatalf("listBackupSnapshots() error = %v", err)
+	}
+
+	var ids []string
+	for _, s := range snapshots {
+		ids = append(ids, s.ID)
+	}
+	if got := strings.Join(ids, ","); got != "20260101T000000Z,20260102T000000Z,20260102T000000Z-2" {
+		t.Fatalf("snapshot IDs = %s", got)
+	}
+	if len(snapshots[0].Files) != 2 {
+		t.Errorf("first snapshot files = %+v, want values.yaml and deployment.yaml", snapshots[0].Files)
+	}
+	if want := filepath.Join(root, "values.yaml"); snapshots[1].Files[0].Original != want {
+		t.Errorf("Original = %s, want %s", snapshots[1].Files[0].Original, want)
+	}
+}
+
+func TestRotateBackups(t *testing.T) {
+	root := t.TempDir()
+	for _, id := range []string{"20260101T000000Z", "20260102T000000Z", "20260103T000000Z"} {
+		if err := os.WriteFile(filepath.Join(root, "values.yaml."+id+".bak"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := captureOutput(t, func() error { return rotateBackups(root, ".bak", 2) }); err != nil {
+		t.Fatalf("rotateBackups() error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "values.yaml.20260101T000000Z.bak")); !os.IsNotExist(err) {
+		t.Error("oldest snapshot should be removed")
+	}
+	if _, err := os.Stat(filepath.Join(root, "values.yaml.20260103T000000Z.bak")); err != nil {
+		t.Error("newest snapshot should be kept")
+	}
+}
+
+// TestConvertTwiceKeepsOriginal verifies repeated runs don't overwrite the first
+// backup, and revert can restore the original from the oldest snapshot
+func TestConvertTwiceKeepsOriginal(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	valuesPath := filepath.Join(chartPath, "values.yaml")
+	original, _ := os.ReadFile(valuesPath)
+
+	for i := 0; i < 2; i++ {
+		if _, err := captureOutput(t, func() error {
+			return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+		}); err != nil {
+			t.Fatalf("runConvert #%d failed: %v", i+1, err)
+		}
+	}
+
+	snapshots, err := listBackupSnapshots(chartPath, ".bak")
+	if err != nil || len(snapshots) != 1 {
+		// The second run has nothing to convert, so it writes no backups
+		t.Fatalf("snapshots = %+v, err = %v, want 1", snapshots, err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runRevert(RevertOptions{ChartDir: chartPath, BackupExt: ".bak", Snapshot: snapshots[0].ID})
+	})
+	if err != nil {
+		t.Fatalf("runRevert failed: %v\nOutput: %s", err, output)
+	}
+	restored, _ := os.ReadFile(valuesPath)
+	if string(restored) != string(original) {
+		t.Errorf("values.yaml not restored to original:\n%s", restored)
+	}
+
+	if _, err := captureOutput(t, func() error {
+		return runRevert(RevertOptions{ChartDir: chartPath, BackupExt: ".bak", Snapshot: "20000101T000000Z"})
+	}); err == nil {
+		t.Error("runRevert should fail for an unknown snapshot")
+	}
+}
+
+// TestRevertSelectedFiles verifies --file restores only the named files and
+// warns when the values and templates left no longer agree
+func TestRevertSelectedFiles(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	valuesPath := filepath.Join(chartPath, "values.yaml")
+	deploymentPath := filepath.Join(chartPath, "templates", "deployment.yaml")
+	original, _ := os.ReadFile(valuesPath)
+
+	if _, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	converted, _ := os.ReadFile(deploymentPath)
+
+	if _, err := captureOutput(t, func() error {
+		return runRevert(RevertOptions{ChartDir: chartPath, BackupExt: ".bak", Files: []string{"templates/missing.yaml"}})
+	}); err == nil || !strings.Contains(err.Error(), "templates/missing.yaml has no backup in snapshot") {
+		t.Errorf("expected an error for a file without a backup, got %v", err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runRevert(RevertOptions{ChartDir: chartPath, BackupExt: ".bak", Files: []string{"values.yaml"}})
+	})
+	if err != nil {
+		t.Fatalf("runRevert failed: %v\nOutput: %s", err, output)
+	}
+	restored, _ := os.ReadFile(valuesPath)
+	if string(restored) != string(original) {
+		t.Errorf("values.yaml not restored to original:\n%s", restored)
+	}
+	if kept, _ := os.ReadFile(deploymentPath); string(kept) != string(converted) {
+		t.Error("templates not named with --file should keep their changes")
+	}
+	if !strings.Contains(output, "Restored 1 of 2 file(s) from snapshot") {
+		t.Errorf("output should count the files restored, got:\n%s", output)
+	}
+	if !strings.Contains(output, "values.yaml and templates now disagree") ||
+		!strings.Contains(output, "env is a list in values.yaml, but templates render it as a map") {
+		t.Errorf("output should warn about the converted templates, got:\n%s", output)
+	}
+
+	// Restoring the template too makes them agree again
+	output, err = captureOutput(t, func() error {
+		return runRevert(RevertOptions{ChartDir: chartPath, BackupExt: ".bak", Files: []string{"templates/deployment.yaml"}})
+	})
+	if err != nil {
+		t.Fatalf("runRevert failed: %v\nOutput: %s", err, output)
+	}
+	if strings.Contains(output, "disagree") {
+		t.Errorf("no warning expected once values and templates agree, got:\n%s", output)
+	}
+
+	// Restoring only the template leaves converted values it renders as a list
+	if _, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	output, err = captureOutput(t, func() error {
+		return runRevert(RevertOptions{ChartDir: chartPath, BackupExt: ".bak", Files: []string{"templates/deployment.yaml"}})
+	})
+	if err != nil {
+		t.Fatalf("runRevert failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "env is a map in values.yaml, but templates render it as a list") {
+		t.Errorf("output should warn about the converted values, got:\n%s", output)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/crd"
+)
+
+// defaultCRDBundle is where bundle-crds writes its archive
+const defaultCRDBundle = "crds-bundle.tgz"
+
+// runBundleCRDs downloads CRDs on a connected machine and writes them to an
+// archive that load-crd --bundle loads where downloads aren't allowed
+func runBundleCRDs(opts BundleCRDsOptions) error {
+	if opts.Timeout < 0 || opts.Retries < 0 {
+		return fmt.Errorf("--timeout and --retries can't be negative")
+	}
+	if !opts.Common && len(opts.Sources) == 0 {
+		return fmt.Errorf("at least one CRD source is required (or use --common)")
+	}
+	if opts.Output == "" {
+		opts.Output = defaultCRDBundle
+	}
+	fetch := crd.FetchOptions{Timeout: opts.Timeout, Retries: opts.Retries}
+	if fetch.Timeout == 0 {
+		fetch.Timeout = crd.DefaultFetchOptions.Timeout
+	}
+	defer crd.SetFetchOptions(crd.SetFetchOptions(fetch))
+	defer crd.SetAuthRules(crd.SetAuthRules(conf.CRDAuth))
+
+	var entries []crd.ArchiveEntry
+	failed := 0
+	add := func(source, filename string, data []byte) {
+		for _, e := range entries {
+			if e.File == filename {
+				fmt.Printf("  Skipped: %s (%s is already included from %s)\n", source, filename, e.Source)
+				return
+			}
+		}
+		entries = append(entries, crd.ArchiveEntry{File: filename, Source: source, Data: data})
+		fmt.Printf("  Added: %s -> %s\n", source, filename)
+	}
+
+	if opts.Common {
+		sources, err := crd.LoadCRDSources(commonCRDsFile())
+		if err != nil {
+			return fmt.Errorf("loading common-crds.yaml: %w", err)
+		}
+		groups := make([]string, 0, len(sources))
+		for g := range sources {
+			groups = append(groups, g)
+		}
+		sort.Strings(groups)
+		for _, g := range groups {
+			url, _, skip := commonCRDURL(sources[g])
+			if url == "" {
+				fmt.Printf("  %s: skipped (%s)\n", g, skip)
+				continue
+			}
+			filename, data, err := downloadCRD(url, sources[g].SHA256)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", url, err)
+				failed++
+				continue
+			}
+			add(url, filename, data)
+		}
+	}
+	for _, source := range opts.Sources {
+		var filename string
+		var data []byte
+		var err error
+		if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+			filename, data, err = downloadCRD(source, "")
+		} else if data, err = os.ReadFile(source); err == nil {
+			filename, err = crd.ExtractCanonicalFilename(data)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", source, err)
+			failed++
+			continue
+		}
+		add(source, filename, data)
+	}
+
+	if len(entries) == 0 {
+		return fmt.Errorf("no CRDs to bundle")
+	}
+	var buf bytes.Buffer
+	if err := crd.WriteArchive(&buf, entries); err != nil {
+		return err
+	}
+	if dir := filepath.Dir(opts.Output); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("creating %s: %w", dir, err)
+		}
+	}
+	if err := writeFileAtomic(opts.Output, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", opts.Output, err)
+	}
+	fmt.Printf("\nBundled %d CRD file(s) into %s\n", len(entries), opts.Output)
+	if failed > 0 {
+		return fmt.Errorf("%d source(s) couldn't be bundled", failed)
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	filesystem "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"gopkg.in/yaml.v3"
+)
+
+// artifactHubChangesKey is the Chart.yaml annotation Artifact Hub reads the
+// changes of a release from
+const artifactHubChangesKey = "artifacthub.io/changes"
+
+// reChartVersion matches a SemVer 2 chart version, with an optional v prefix
+var reChartVersion = regexp.MustCompile(`^(v?)(\d+)\.(\d+)\.(\d+)(?:-[0-9A-Za-z.-]+)?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// artifactHubChange is one entry of the artifacthub.io/changes annotation
+type artifactHubChange struct {
+	Kind        string `yaml:"kind"`
+	Description string `yaml:"description"`
+}
+
+// validateBumpLevel checks the --bump-version level
+func validateBumpLevel(level string) error {
+	switch level {
+	case "", "major", "minor", "patch":
+		return nil
+	}
+	return fmt.Errorf("invalid --bump-version %q: want major, minor, or patch", level)
+}
+
+// bumpVersion increments the major, minor, or patch number of a SemVer chart
+// version, dropping any pre-release and build metadata
+func bumpVersion(version, level string) (string, error) {
+	m := reChartVersion.FindStringSubmatch(version)
+	if m == nil {
+		return "", fmt.Errorf("chart version %q is not a semantic version", version)
+	}
+	major, _ := strconv.Atoi(m[2])
+	minor, _ := strconv.Atoi(m[3])
+	patch, _ := strconv.Atoi(m[4])
+	switch level {
+	case "major":
+		major, minor, patch = major+1, 0, 0
+	case "minor":
+		minor, patch = minor+1, 0
+	default:
+		patch++
+	}
+	return fmt.Sprintf("%s%d.%d.%d", m[1], major, minor, patch), nil
+}
+
+// changesDescription summarizes the converted fields for the changes annotation
+func changesDescription(fields []migrationField) string {
+	parts := make([]string, 0, len(fields))
+	for _, f := range fields {
+		path := f.Old.Path
+		if f.New.Path != f.Old.Path {
+			path += " -> " + f.New.Path
+		}
+		switch {
+		case f.New.Shape == "set":
+			parts = append(parts, path+" (set)")
+		case len(f.New.Keys) > 0:
+			parts = append(parts, fmt.Sprintf("%s (keys: %s, %s)", path, strings.Join(f.New.Keys, ", "), f.New.KeyStrategy))
+		case f.New.Synthetic:
+			parts = append(parts, fmt.Sprintf("%s (synthetic key: %s)", path, f.New.Key))
+		case f.New.Key != "" && (len(f.New.Rename) > 0 || f.New.Scalar != ""):
+			shaped := k8s.DetectedCandidate{Rename: f.New.Rename, Scalar: f.New.Scalar}
+			parts = append(parts, fmt.Sprintf("%s (key: %s; %s)", path, f.New.Key, shaped.ShapeDescription()))
+		case f.New.Key != "":
+			parts = append(parts, fmt.Sprintf("%s (key: %s)", path, f.New.Key))
+		default:
+			parts = append(parts, path)
+		}
+	}
+	return "Breaking: list values converted to maps, so overrides must use the map format: " + strings.Join(parts, ", ")
+}
+
+// reportVersionBump bumps the chart version for the converted fields and
+// reports it, or with --dry-run reports the version it would bump to
+func reportVersionBump(root string, opts ConvertOptions, fields []migrationField, backupFiles *[]string) error {
+	if opts.DryRun {
+		data, err := os.ReadFile(filepath.Join(root, "Chart.yaml"))
+		if err != nil {
+			return fmt.Errorf("reading Chart.yaml: %w", err)
+		}
+		var chart ChartYAML
+		if err := yaml.Unmarshal(data, &chart); err != nil {
+			return fmt.Errorf("parsing Chart.yaml: %w", err)
+		}
+		to, err := bumpVersion(chart.Version, opts.BumpVersion)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\nWould bump chart version: %s -> %s\n", chart.Version, to)
+		return nil
+	}
+	from, to, files, err := bumpChartVersion(root, opts.BumpVersion, fields, opts.BackupExt, *backupFiles)
+	*backupFiles = files
+	if err != nil {
+		return fmt.Errorf("bumping chart version: %w", err)
+	}
+	fmt.Println("\n" + green("Bumped chart version:"))
+	fmt.Printf("  %s -> %s (%s annotation updated)\n", from, to, artifactHubChangesKey)
+	return nil
+}
+
+// bumpChartVersion bumps the version in root's Chart.yaml by level and adds
+// an artifacthub.io/changes entry describing the converted fields. Chart.yaml
+// is backed up with backupExt first, and the backup appended to backupFiles.
+// Returns the versions before and after, and the updated backupFiles.
+func bumpChartVersion(root, level string, fields []migrationField, backupExt string, backupFiles []string) (string, string, []string, error) {
+	chartPath := filepath.Join(root, "Chart.yaml")
+	raw, err := os.ReadFile(chartPath)
+	if err != nil {
+		return "", "", backupFiles, fmt.Errorf("reading Chart.yaml: %w", err)
+	}
+	entry := artifactHubChange{Kind: "changed", Description: changesDescription(fields)}
+	out, from, to, err := bumpChartYAML(raw, level, entry)
+	if err != nil {
+		return "", "", backupFiles, err
+	}
+	if backupExt != "" {
+		if err := backupFile(chartPath, backupExt, raw); err != nil {
+			return "", "", backupFiles, fmt.Errorf("backing up Chart.yaml: %w", err)
+		}
+		backupFiles = append(backupFiles, chartPath+backupExt)
+	}
+	if err := rewriteFile(chartPath, out); err != nil {
+		return "", "", backupFiles, err
+	}
+	return from, to, backupFiles, nil
+}
+
+// bumpChartYAML edits Chart.yaml content line by line, so its comments and
+// formatting are kept: the version is bumped, and entry is appended to the
+// artifacthub.io/changes annotation, which is added if missing.
+// Returns the updated content and the versions before and after.
+func bumpChartYAML(raw []byte, level string, entry artifactHubChange) ([]byte, string, string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, "", "", fmt.Errorf("parsing Chart.yaml: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, "", "", fmt.Errorf("Chart.yaml is not a mapping")
+	}
+	chart := doc.Content[0]
+
+	_, version := mappingEntry(chart, "version")
+	if version == nil || version.Kind != yaml.ScalarNode {
+		return nil, "", "", fmt.Errorf("Chart.yaml has no version")
+	}
+	to, err := bumpVersion(version.Value, level)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	item, err := yaml.Marshal([]artifactHubChange{entry})
+	if err != nil {
+		return nil, "", "", err
+	}
+	entryLines := strings.Split(strings.TrimRight(string(item), "\n"), "\n")
+
+	lines := strings.Split(string(filesystem.Normalize(raw)), "\n")
+
+	// The version is replaced within its line, so node line numbers stay
+	// valid for the annotation insert that follows
+	i := version.Line - 1
+	col := version.Column - 1
+	width := len(version.Value)
+	quoted := to
+	switch version.Style {
+	case yaml.DoubleQuotedStyle:
+		width, quoted = width+2, `"`+to+`"`
+	case yaml.SingleQuotedStyle:
+		width, quoted = width+2, "'"+to+"'"
+	}
+	if i < 0 || i >= len(lines) || col+width > len(lines[i]) {
+		return nil, "", "", fmt.Errorf("Chart.yaml version is not on a single line")
+	}
+	lines[i] = lines[i][:col] + quoted + lines[i][col+width:]
+
+	lines, err = addChangesEntry(lines, chart, entryLines)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return filesystem.MatchFormat(raw, []byte(strings.Join(lines, "\n"))), version.Value, to, nil
+}
+
+// addChangesEntry appends entryLines (a one-item YAML list) to the
+// artifacthub.io/changes block string, adding the annotation, and the
+// annotations map, where missing
+func addChangesEntry(lines []string, chart *yaml.Node, entryLines []string) ([]string, error) {
+	indented := func(indent int, block []string) []string {
+		out := make([]string, len(block))
+		for i, l := range block {
+			out[i] = strings.Repeat(" ", indent) + l
+		}
+		return out
+	}
+	insert := func(at int, block []string) []string {
+		out := append([]string{}, lines[:at]...)
+		out = append(out, block...)
+		return append(out, lines[at:]...)
+	}
+
+	annotationsKey, annotations := mappingEntry(chart, "annotations")
+	if annotationsKey == nil {
+		// Add the annotations map at the end, before the final newline
+		end := len(lines)
+		for end > 0 && strings.TrimSpace(lines[end-1]) == "" {
+			end--
+		}
+		block := []string{"annotations:", "  " + artifactHubChangesKey + ": |"}
+		return insert(end, append(block, indented(4, entryLines)...)), nil
+	}
+
+	keyIndent := annotationsKey.Column - 1
+	switch {
+	case annotations.Kind == yaml.ScalarNode && annotations.Tag == "!!null":
+		block := append([]string{strings.Repeat(" ", keyIndent+2) + artifactHubChangesKey + ": |"}, indented(keyIndent+4, entryLines)...)
+		return insert(annotationsKey.Line, block), nil
+	case annotations.Kind != yaml.MappingNode || annotations.Style&yaml.FlowStyle != 0 || len(annotations.Content) == 0:
+		return nil, fmt.Errorf("Chart.yaml annotations must be a block mapping to add %s", artifactHubChangesKey)
+	}
+
+	changesKey, changes := mappingEntry(annotations, artifactHubChangesKey)
+	childIndent := annotations.Content[0].Column - 1
+	if changesKey == nil {
+		block := append([]string{strings.Repeat(" ", childIndent) + artifactHubChangesKey + ": |"}, indented(childIndent+2, entryLines)...)
+		return insert(annotations.Content[0].Line-1, block), nil
+	}
+	if changes.Kind != yaml.ScalarNode || changes.Style&yaml.LiteralStyle == 0 {
+		return nil, fmt.Errorf("Chart.yaml %s must be a literal block string (|) to add an entry", artifactHubChangesKey)
+	}
+
+	// The block runs from the line after the key to its last indented line
+	changesIndent := changesKey.Column - 1
+	last := changesKey.Line - 1
+	contentIndent := -1
+	for i := changesKey.Line; i < len(lines); i++ {
+		trimmed := strings.TrimLeft(lines[i], " ")
+		if trimmed == "" {
+			continue
+		}
+		indent := len(lines[i]) - len(trimmed)
+		if indent <= changesIndent {
+			break
+		}
+		if contentIndent < 0 {
+			contentIndent = indent
+		}
+		last = i
+	}
+	if contentIndent < 0 {
+		contentIndent = changesIndent + 2
+	}
+	return insert(last+1, indented(contentIndent, entryLines)), nil
+}
+
+// mappingEntry returns the key and value nodes for key in a mapping node
+func mappingEntry(m *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i], m.Content[i+1]
+		}
+	}
+	return nil, nil
+}
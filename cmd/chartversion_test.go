@@ -0,0 +1,153 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+func TestBumpVersion(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		version, level, want string
+	}{
+		{"1.2.3", "major", "2.0.0"},
+		{"1.2.3", "minor", "1.3.0"},
+		{"1.2.3", "patch", "1.2.4"},
+		{"v0.9.1", "minor", "v0.10.0"},
+		{"1.2.3-rc.1+build.5", "minor", "1.3.0"},
+	}
+	for _, tt := range tests {
+		got, err := bumpVersion(tt.version, tt.level)
+		if err != nil || got != tt.want {
+			t.Errorf("bumpVersion(%q, %q) = %q, %v; want %q", tt.version, tt.level, got, err, tt.want)
+		}
+	}
+	if _, err := bumpVersion("latest", "minor"); err == nil {
+		t.Error("bumpVersion() should reject a non-SemVer version")
+	}
+}
+
+func TestBumpChartYAML(t *testing.T) {
+	t.Parallel()
+
+	entry := artifactHubChange{Kind: "changed", Description: "Breaking: env (key: name)"}
+	tests := []struct {
+		name    string
+		chart   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "no annotations",
+			chart: "apiVersion: v2\nname: app\n# Bump on every release\nversion: 1.2.3 # chart version\n",
+			want: `apiVersion: v2
+name: app
+# Bump on every release
+version: 1.3.0 # chart version
+annotations:
+  artifacthub.io/changes: |
+    - kind: changed
+      description: 'Breaking: env (key: name)'
+`,
+		},
+		{
+			name: "existing changes",
+			chart: `apiVersion: v2
+annotations:
+    artifacthub.io/changes: |
+        - kind: added
+          description: Something new
+    artifacthub.io/license: Apache-2.0
+name: app
+version: "1.2.3"
+`,
+			want: `apiVersion: v2
+annotations:
+    artifacthub.io/changes: |
+        - kind: added
+          description: Something new
+        - kind: changed
+          description: 'Breaking: env (key: name)'
+    artifacthub.io/license: Apache-2.0
+name: app
+version: "1.3.0"
+`,
+		},
+		{
+			name:  "annotations without changes",
+			chart: "name: app\nversion: 0.1.0\nannotations:\n  category: Database\n",
+			want: `name: app
+version: 0.2.0
+annotations:
+  artifacthub.io/changes: |
+    - kind: changed
+      description: 'Breaking: env (key: name)'
+  category: Database
+`,
+		},
+		{
+			name:    "flow changes",
+			chart:   "name: app\nversion: 0.1.0\nannotations:\n  artifacthub.io/changes: \"- kind: added\"\n",
+			wantErr: true,
+		},
+		{
+			name:    "no version",
+			chart:   "name: app\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, _, err := bumpChartYAML([]byte(tt.chart), "minor", entry)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("bumpChartYAML() should fail, got:\n%s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("bumpChartYAML() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("bumpChartYAML() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertBumpVersion(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak", BumpVersion: "minor", MigrationFile: "values-migration.yaml"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "0.1.0 -> 0.2.0") {
+		t.Errorf("output should report the version bump, got:\n%s", output)
+	}
+
+	chart, _ := os.ReadFile(filepath.Join(chartPath, "Chart.yaml"))
+	for _, want := range []string{"version: 0.2.0", "artifacthub.io/changes: |", "env (key: name)", "volumes (key: name)"} {
+		if !strings.Contains(string(chart), want) {
+			t.Errorf("Chart.yaml should contain %q, got:\n%s", want, chart)
+		}
+	}
+	// The migration map records the version the new format ships in
+	migration, _ := os.ReadFile(filepath.Join(chartPath, "values-migration.yaml"))
+	if !strings.Contains(string(migration), "version: 0.2.0") {
+		t.Errorf("migration map should record the bumped version, got:\n%s", migration)
+	}
+
+	if err := runConvert(ConvertOptions{ChartDir: chartPath, BumpVersion: "huge"}); err == nil {
+		t.Error("runConvert() should reject an unknown --bump-version level")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	pkgfs "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+)
+
+// checkScope restricts a check to the changed files of one chart
+type checkScope struct {
+	All       bool            // values.yaml or chart config changed: check every path
+	Templates map[string]bool // changed template files, relative to their template directory
+}
+
+// runDetectCheck is the read-only detect --check mode used by pre-commit hooks
+// and merge gates. It reports paths that convert would change and returns an
+// error when there are any, so the exit code is 0 only for clean charts.
+// Only CRDs already loaded into the plugin config are used; nothing is downloaded.
+func runDetectCheck(opts DetectOptions) error {
+	scopes, err := checkScopes(opts.ChartDir, opts.Files)
+	if err != nil {
+		return err
+	}
+
+	roots := make([]string, 0, len(scopes))
+	for root := range scopes {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+
+	total := 0
+	for _, root := range roots {
+		findings, err := checkChart(root, scopes[root], opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", root, err)
+		}
+		if len(findings) == 0 {
+			continue
+		}
+		total += len(findings)
+
+		if opts.Quiet {
+			for _, c := range findings {
+				fmt.Printf("%s: %s (key=%s)\n", root, c.ValuesPath, c.MergeKey)
+			}
+			continue
+		}
+		fmt.Println(red(fmt.Sprintf("%s: %d convertible path(s):", root, len(findings))))
+		for _, c := range findings {
+			fmt.Printf("  %s (key=%s)\n", c.ValuesPath, c.MergeKey)
+		}
+		fmt.Printf("  Run: helm list-to-map convert --chart %s\n", root)
+	}
+
+	if total > 0 {
+		return fmt.Errorf("check found %d convertible path(s)", total)
+	}
+	if !opts.Quiet {
+		fmt.Println(green("No convertible lists found."))
+	}
+	return nil
+}
+
+// checkChart returns the candidates convert would change in root, limited to
+// scope, reading schemas from the source opts selects
+func checkChart(root string, scope checkScope, opts DetectOptions) ([]k8s.DetectedCandidate, error) {
+	// Apply the chart's own config over the user config
+	restore, err := useChartConfig(root)
+	defer restore()
+	if err != nil {
+		return nil, err
+	}
+	restoreSchema, err := useSchemas(opts.SchemaSource, opts.Quiet)
+	defer restoreSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	collected, err := collectConvertCandidates(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []k8s.DetectedCandidate
+	for _, c := range collected.Matched {
+		if scope.All || scope.Templates[c.TemplatePath] {
+			findings = append(findings, c)
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		return findings[i].ValuesPath < findings[j].ValuesPath
+	})
+	return findings, nil
+}
+
+// checkScopes maps chart roots to the parts of each chart that need checking.
+// With no files, the chart at chartDir is checked in full. Otherwise each file
+// is attributed to its nearest chart, and files that cannot affect conversion
+// (or are outside any chart) are ignored.
+func checkScopes(chartDir string, files []string) (map[string]checkScope, error) {
+	scopes := make(map[string]checkScope)
+	if len(files) == 0 {
+		root, err := findChartRoot(chartDir)
+		if err != nil {
+			return nil, err
+		}
+		scopes[root] = checkScope{All: true}
+		return scopes, nil
+	}
+
+	for _, f := range files {
+		root, err := findChartRoot(filepath.Dir(f))
+		if err != nil {
+			continue // Not part of a chart
+		}
+		rel, err := filepath.Rel(root, f)
+		if err != nil {
+			continue
+		}
+
+		scope := scopes[root]
+		switch {
+		case rel == "values.yaml" || rel == "Chart.yaml" || rel == chartConfigFile:
+			scope.All = true
+		case pkgfs.InTemplateDir(rel):
+			if scope.Templates == nil {
+				scope.Templates = make(map[string]bool)
+			}
+			scope.Templates[pkgfs.TemplateRel(root, filepath.Join(root, rel))] = true
+		default:
+			continue
+		}
+		scopes[root] = scope
+	}
+	return scopes, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+)
+
+func TestDetectCheck(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+
+	output, err := captureOutput(t, func() error {
+		return runDetectCheck(DetectOptions{ChartDir: chartPath, Check: true, Quiet: true})
+	})
+	if err == nil || !strings.Contains(err.Error(), "convertible path(s)") {
+		t.Fatalf("runDetectCheck() error = %v, want convertible paths error", err)
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	want := []string{
+		chartPath + ": env (key=name)",
+		chartPath + ": volumeMounts (key=mountPath)",
+		chartPath + ": volumes (key=name)",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("quiet output =\n%s\nwant\n%s", output, strings.Join(want, "\n"))
+	}
+
+	// After converting, the check passes
+	if _, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	}); err != nil {
+		t.Fatalf("runConvert failed: %v", err)
+	}
+	output, err = captureOutput(t, func() error {
+		return runDetectCheck(DetectOptions{ChartDir: chartPath, Check: true, Quiet: true})
+	})
+	if err != nil || output != "" {
+		t.Errorf("check after convert: err = %v, output = %q; want clean", err, output)
+	}
+}
+
+// TestDetectCheckSchemaSource tests that check reads schemas from the source
+// the schemaSource setting selects
+func TestDetectCheckSchemaSource(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	defer k8s.SetClusterSchema(k8s.SetClusterSchema(false))
+
+	originalConf := conf
+	defer func() { conf = originalConf }()
+	conf.SchemaSource = schemaSourceCluster
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	opts := DetectOptions{ChartDir: chartPath, Check: true, Quiet: true}
+	if _, err := captureOutput(t, func() error { return runDetectCheck(opts) }); err == nil || !strings.Contains(err.Error(), "load-openapi --cluster") {
+		t.Fatalf("runDetectCheck() error = %v, want no cluster schema saved", err)
+	}
+
+	// The fixture's cluster publishes volumeMounts as an atomic list
+	saveClusterSchemaFixture(t)
+	output, err := captureOutput(t, func() error { return runDetectCheck(opts) })
+	if err == nil {
+		t.Fatal("runDetectCheck() should report convertible paths")
+	}
+	want := chartPath + ": env (key=name)\n" + chartPath + ": volumes (key=name)"
+	if strings.TrimSpace(output) != want {
+		t.Errorf("quiet output =\n%s\nwant\n%s", output, want)
+	}
+	if k8s.ClusterSchema() {
+		t.Error("the schema source should be restored after check")
+	}
+
+	// --schema types overrides the setting
+	opts.SchemaSource = schemaSourceTypes
+	output, _ = captureOutput(t, func() error { return runDetectCheck(opts) })
+	if !strings.Contains(output, "volumeMounts") {
+		t.Errorf("--schema types should read the Go types, got:\n%s", output)
+	}
+}
+
+// TestDetectCheckNestedTemplates tests that a changed template is told apart
+// from one with the same name in another directory
+func TestDetectCheckNestedTemplates(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml":                       "apiVersion: v2\nname: nested\nversion: 0.1.0\n",
+		"values.yaml":                      "web:\n  env:\n    - name: A\n      value: a\nworker:\n  env:\n    - name: B\n      value: b\n",
+		"templates/web/deployment.yaml":    nestedDeployment("web"),
+		"templates/worker/deployment.yaml": nestedDeployment("worker"),
+	}
+	writeChartFiles(t, chartPath, files)
+
+	changed := []string{filepath.Join(chartPath, "templates", "worker", "deployment.yaml")}
+	output, err := captureOutput(t, func() error {
+		return runDetectCheck(DetectOptions{Files: changed, Check: true, Quiet: true})
+	})
+	if err == nil {
+		t.Fatal("runDetectCheck() should report the changed template's paths")
+	}
+	if want := chartPath + ": worker.env (key=name)"; strings.TrimSpace(output) != want {
+		t.Errorf("quiet output =\n%s\nwant\n%s", output, want)
+	}
+}
+
+// nestedDeployment is a Deployment rendering the env list under component
+func nestedDeployment(component string) string {
+	return `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: ` + component + `
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          env:
+            {{- toYaml .Values.` + component + `.env | nindent 12 }}
+`
+}
+
+func TestCheckScopes(t *testing.T) {
+	testutil.SetupTestEnv(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+
+	tests := []struct {
+		name      string
+		files     []string
+		wantAll   bool
+		wantTpl   string
+		wantChart bool
+	}{
+		{"values changed", []string{filepath.Join(chartPath, "values.yaml")}, true, "", true},
+		{"template changed", []string{filepath.Join(chartPath, "templates", "deployment.yaml")}, false, "deployment.yaml", true},
+		{"nested template changed", []string{filepath.Join(chartPath, "templates", "web", "deployment.yaml")}, false, "web/deployment.yaml", true},
+		{"unrelated file", []string{filepath.Join(chartPath, "README.md")}, false, "", false},
+		{"outside any chart", []string{filepath.Join(t.TempDir(), "main.go")}, false, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scopes, err := checkScopes(".", tt.files)
+			if err != nil {
+				t.Fatalf("checkScopes() error = %v", err)
+			}
+			scope, ok := scopes[chartPath]
+			if ok != tt.wantChart {
+				t.Fatalf("chart scoped = %v, want %v (scopes: %v)", ok, tt.wantChart, scopes)
+			}
+			if scope.All != tt.wantAll {
+				t.Errorf("scope.All = %v, want %v", scope.All, tt.wantAll)
+			}
+			if tt.wantTpl != "" && !scope.Templates[tt.wantTpl] {
+				t.Errorf("scope.Templates = %v, want %s", scope.Templates, tt.wantTpl)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func runClean(opts CleanOptions) error {
+	root, err := findChartRoot(opts.ChartDir)
+	if err != nil {
+		return err
+	}
+	if err := checkCleanExt(opts.BackupExt); err != nil {
+		return err
+	}
+
+	backups, err := findBackups(root, opts.BackupExt)
+	if err != nil {
+		return fmt.Errorf("finding backups: %w", err)
+	}
+	if len(backups) == 0 {
+		fmt.Printf("No backups with extension %q found under %s\n", opts.BackupExt, root)
+		return nil
+	}
+
+	if opts.DryRun {
+		fmt.Printf("Would remove %d backup(s):\n", len(backups))
+		for _, b := range backups {
+			fmt.Printf("  %s\n", rel(root, b))
+		}
+		return nil
+	}
+
+	for _, b := range backups {
+		if err := os.Remove(b); err != nil {
+			return fmt.Errorf("removing %s: %w", rel(root, b), err)
+		}
+	}
+	fmt.Printf("Removed %d backup(s):\n", len(backups))
+	for _, b := range backups {
+		fmt.Printf("  %s\n", rel(root, b))
+	}
+	return nil
+}
+
+// chartFileExts are extensions of files a chart keeps, which clean refuses as
+// a backup extension
+var chartFileExts = []string{".yaml", ".yml", ".tpl", ".txt", ".json", ".tgz"}
+
+// checkCleanExt rejects backup extensions clean can't safely remove files by:
+// one without a leading dot, which would match any name ending in it, and the
+// extensions of the chart's own files
+func checkCleanExt(ext string) error {
+	if !strings.HasPrefix(ext, ".") || len(ext) < 2 {
+		return fmt.Errorf("--backup-ext must start with a dot, e.g. .bak (got %q)", ext)
+	}
+	for _, e := range chartFileExts {
+		if strings.EqualFold(ext, e) {
+			return fmt.Errorf("--backup-ext %s is the extension of chart files; refusing to remove them", ext)
+		}
+	}
+	return nil
+}
+
+// findBackups returns the backups under root, in walk order: the files named
+// as the plugin names its backups, convert snapshots
+// (values.yaml.20261015T120000Z.bak) and expanded tarballs (chart.tgz.bak).
+// Other files ending in ext are left alone.
+func findBackups(root, ext string) ([]string, error) {
+	var backups []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isBackupName(d.Name(), ext) {
+			backups = append(backups, path)
+		}
+		return nil
+	})
+	return backups, err
+}
+
+// isBackupName reports whether name is a backup the plugin writes with ext:
+// <file>.<snapshot ID><ext> or <tarball>.tgz<ext>
+func isBackupName(name, ext string) bool {
+	base := strings.TrimSuffix(name, ext)
+	if base == name {
+		return false
+	}
+	if strings.HasSuffix(base, ".tgz") && base != ".tgz" {
+		return true
+	}
+	dot := strings.LastIndex(base, ".")
+	return dot > 0 && reSnapshotID.MatchString(base[dot+1:])
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]bool{ // path -> is a backup
+		"Chart.yaml":                                     false,
+		"values.yaml":                                    false,
+		"values.yaml.20260101T000000Z.bak":               true,
+		"templates/deployment.yaml":                      false,
+		"templates/deployment.yaml.20260101T000000Z.bak": true,
+		"charts/redis-17.0.0.tgz.bak":                    true,
+		"charts/redis-17.0.0/values.yaml":                false,
+		"charts/sub/values.yaml.20260101T000000Z-2.bak":  true,
+		"charts/sub/values.yaml.bak":                     false,
+		"notes.bak":                                      false,
+		"old.bak/values.yaml":                            false,
+		".git/objects/pack.20260101T000000Z.bak":         false,
+	}
+	for f := range files {
+		path := filepath.Join(root, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("name: test\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := CleanOptions{ChartDir: root, BackupExt: ".bak", DryRun: true}
+	output, err := captureOutput(t, func() error { return runClean(opts) })
+	if err != nil {
+		t.Fatalf("runClean --dry-run error = %v", err)
+	}
+	if !strings.Contains(output, "Would remove 4 backup(s)") || !strings.Contains(output, "redis-17.0.0.tgz.bak\n") {
+		t.Errorf("dry run output = %s", output)
+	}
+	for f := range files {
+		if _, err := os.Stat(filepath.Join(root, f)); err != nil {
+			t.Errorf("dry run removed %s", f)
+		}
+	}
+
+	opts.DryRun = false
+	if _, err := captureOutput(t, func() error { return runClean(opts) }); err != nil {
+		t.Fatalf("runClean error = %v", err)
+	}
+	for f, backup := range files {
+		_, err := os.Stat(filepath.Join(root, f))
+		if backup && !os.IsNotExist(err) {
+			t.Errorf("%s should be removed", f)
+		}
+		if !backup && err != nil {
+			t.Errorf("%s should be kept: %v", f, err)
+		}
+	}
+
+	output, err = captureOutput(t, func() error { return runClean(opts) })
+	if err != nil || !strings.Contains(output, "No backups") {
+		t.Errorf("second run = %q, %v", output, err)
+	}
+}
+
+func TestCleanRejectsChartExtensions(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "Chart.yaml"), []byte("name: test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, ext := range []string{"", "bak", ".", ".yaml", ".YML", ".tpl", ".txt", ".json", ".tgz"} {
+		err := runClean(CleanOptions{ChartDir: root, BackupExt: ext})
+		if err == nil {
+			t.Errorf("runClean(--backup-ext %q) should fail", ext)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "Chart.yaml")); err != nil {
+		t.Errorf("Chart.yaml should be kept: %v", err)
+	}
+}
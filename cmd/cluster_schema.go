@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Values of the schemaSource setting
+const (
+	schemaSourceTypes   = "types"   // client-go structs and the CRDs saved by load-crd
+	schemaSourceCluster = "cluster" // the schemas saved from a cluster by load-openapi --cluster
+)
+
+// useSchemaSource selects where detection reads Kubernetes schemas from, given
+// by flag or else by the schemaSource setting. The returned function restores
+// the previous source.
+func useSchemaSource(flag string) (func(), error) {
+	source := flag
+	if source == "" {
+		source = conf.SchemaSource
+	}
+	switch source {
+	case "", schemaSourceTypes:
+		return func() {}, nil
+	case schemaSourceCluster:
+	default:
+		return func() {}, fmt.Errorf("invalid schema source %q: want %s or %s", source, schemaSourceTypes, schemaSourceCluster)
+	}
+
+	if _, err := os.Stat(clusterSchemaDir()); err != nil {
+		return func() {}, fmt.Errorf("no cluster schema saved: run 'helm list-to-map load-openapi --cluster' first")
+	}
+	prev := k8s.SetClusterSchema(true)
+	return func() { k8s.SetClusterSchema(prev) }, nil
+}
+
+// useSchemas selects the schema source as useSchemaSource does, and loads the
+// schemas saved for it in the plugin config: the CRDs from load-crd, or the
+// cluster's from load-openapi --cluster. Commands that detect candidates call
+// it after applying the chart's config, so the schemaSource setting applies to
+// every one of them. Schemas that fail to load are warned about, unless quiet,
+// and detection goes on without them.
+func useSchemas(flag string, quiet bool) (func(), error) {
+	restore, err := useSchemaSource(flag)
+	if err != nil {
+		return restore, err
+	}
+	if err := loadCRDsFromConfig(); err != nil && !quiet {
+		warnf("loading CRDs: %v", err)
+	}
+	return restore, nil
+}
+
+// clusterSchemaDir returns where load-openapi --cluster saves the cluster's
+// OpenAPI v3 documents, one per group-version
+func clusterSchemaDir() string {
+	return filepath.Join(openAPIConfigDir(), "cluster")
+}
+
+// runLoadClusterOpenAPI saves the OpenAPI v3 documents the current cluster
+// publishes, including those of installed CRDs
+func runLoadClusterOpenAPI(opts LoadOpenAPIOptions) error {
+	if opts.KubeVersion != "" || opts.Source != "" {
+		return fmt.Errorf("--cluster cannot be combined with --kube-version or a source")
+	}
+	if err := requireNetwork("load-openapi --cluster"); err != nil {
+		return err
+	}
+	dest := clusterSchemaDir()
+	if _, err := os.Stat(dest); err == nil && !opts.Force {
+		fmt.Printf("Skipped: %s already exists (use --force to replace it)\n", dest)
+		return nil
+	}
+
+	host, docs, err := fetchClusterOpenAPI()
+	if err != nil {
+		return fmt.Errorf("fetching /openapi/v3: %w", err)
+	}
+
+	// Write the snapshot beside the previous one, then replace it whole, so
+	// removed APIs don't linger and other runs never read half a snapshot
+	if err := os.MkdirAll(openAPIConfigDir(), 0755); err != nil {
+		return fmt.Errorf("creating OpenAPI directory: %w", err)
+	}
+	tmp, err := os.MkdirTemp(openAPIConfigDir(), ".cluster-")
+	if err != nil {
+		return fmt.Errorf("creating OpenAPI directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+	paths := make([]string, 0, len(docs))
+	for path := range docs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		// e.g., apis/apps/v1 -> apis__apps__v1.json
+		name := strings.ReplaceAll(path, "/", "__") + ".json"
+		if err := os.WriteFile(filepath.Join(tmp, name), docs[path], 0644); err != nil {
+			return fmt.Errorf("writing to config: %w", err)
+		}
+	}
+	if err := replaceDir(tmp, dest); err != nil {
+		return fmt.Errorf("replacing %s: %w", dest, err)
+	}
+	fmt.Printf("Loaded: %s/openapi/v3 (%d group versions) -> %s\n", host, len(paths), dest)
+	return nil
+}
+
+// fetchClusterOpenAPI returns the OpenAPI v3 document of each group-version
+// served by the cluster of the current kubeconfig context, keyed by path
+// (e.g., apis/apps/v1). Helm's --kube-context is honored through
+// HELM_KUBECONTEXT.
+func fetchClusterOpenAPI() (string, map[string][]byte, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: os.Getenv("HELM_KUBECONTEXT")}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return "", nil, err
+	}
+	client, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return "", nil, err
+	}
+	groupVersions, err := client.OpenAPIV3().Paths()
+	if err != nil {
+		return "", nil, err
+	}
+
+	docs := make(map[string][]byte, len(groupVersions))
+	for path, gv := range groupVersions {
+		data, err := gv.Schema("application/json")
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", path, err)
+		}
+		docs[path] = data
+	}
+	return config.Host, docs, nil
+}
+
+// replaceDir replaces dest with the directory src, under dest's lock. dest is
+// moved aside before src takes its place, so it's only briefly missing.
+func replaceDir(src, dest string) error {
+	unlock, err := lockPath(dest)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	old := src + ".old"
+	if err := os.Rename(dest, old); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(src, dest); err != nil {
+		_ = os.Rename(old, dest)
+		return err
+	}
+	return os.RemoveAll(old)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+)
+
+// saveClusterSchemaFixture saves the apps/v1 fixture as the cluster's schema
+func saveClusterSchemaFixture(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "openapi", "apis__apps__v1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(clusterSchemaDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(clusterSchemaDir(), "apis__apps__v1.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestLoadClusterOpenAPI(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	doc, err := os.ReadFile(filepath.Join("testdata", "openapi", "apis__apps__v1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/openapi/v3":
+			_, _ = w.Write([]byte(`{"paths": {"apis/apps/v1": {"serverRelativeURL": "/openapi/v3/apis/apps/v1?hash=ABC"}}}`))
+		case "/openapi/v3/apis/apps/v1":
+			_, _ = w.Write(doc)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	config := `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: ` + server.URL + `
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user: {}
+`
+	if err := os.WriteFile(kubeconfig, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBECONFIG", kubeconfig)
+	t.Setenv("HELM_KUBECONTEXT", "")
+
+	output, err := captureOutput(t, func() error {
+		return runLoadClusterOpenAPI(LoadOpenAPIOptions{Cluster: true})
+	})
+	if err != nil {
+		t.Fatalf("runLoadClusterOpenAPI failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "(1 group versions) -> "+clusterSchemaDir()) {
+		t.Errorf("output should report the saved group versions, got:\n%s", output)
+	}
+	saved, err := os.ReadFile(filepath.Join(clusterSchemaDir(), "apis__apps__v1.json"))
+	if err != nil {
+		t.Fatalf("expected the apps/v1 document to be saved: %v", err)
+	}
+	if string(saved) != string(doc) {
+		t.Error("saved document should be the one the cluster served")
+	}
+
+	// A saved schema is kept without --force
+	output, err = captureOutput(t, func() error {
+		return runLoadClusterOpenAPI(LoadOpenAPIOptions{Cluster: true})
+	})
+	if err != nil || !strings.Contains(output, "Skipped:") {
+		t.Errorf("expected the saved schema to be kept, got err=%v output:\n%s", err, output)
+	}
+
+	if err := runLoadClusterOpenAPI(LoadOpenAPIOptions{Cluster: true, KubeVersion: "1.27"}); err == nil {
+		t.Error("expected --cluster with --kube-version to fail")
+	}
+}
+
+func TestDetectClusterSchema(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	defer k8s.SetClusterSchema(k8s.SetClusterSchema(false))
+	saveClusterSchemaFixture(t)
+
+	// The fixture's cluster publishes volumeMounts as an atomic list, unlike
+	// the Go types, so detection follows the cluster
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	output, err := captureOutput(t, func() error {
+		return runDetect(DetectOptions{ChartDir: chartPath, SchemaSource: schemaSourceCluster})
+	})
+	if err != nil {
+		t.Fatalf("runDetect failed: %v\nOutput: %s", err, output)
+	}
+	for _, want := range []string{
+		"env (key=name, type=corev1.EnvVar)",
+		"volumes (key=name, type=corev1.Volume)",
+		"Arrays without auto-detected unique keys:",
+		"volumeMounts (in deployment.yaml:21)",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q, got:\n%s", want, output)
+		}
+	}
+	if k8s.ClusterSchema() {
+		t.Error("the schema source should be restored after detect")
+	}
+
+	// Kinds the cluster doesn't serve
+	files := map[string]string{
+		"Chart.yaml":             "apiVersion: v2\nname: cron\nversion: 0.1.0\n",
+		"values.yaml":            "volumes:\n  - name: data\n    emptyDir: {}\n",
+		"templates/cronjob.yaml": "apiVersion: batch/v1\nkind: CronJob\nmetadata:\n  name: cron\nspec:\n  jobTemplate:\n    spec:\n      template:\n        spec:\n          volumes:\n            {{- toYaml .Values.volumes | nindent 12 }}\n",
+	}
+	cronChart := t.TempDir()
+	writeChartFiles(t, cronChart, files)
+	testutil.ResetGlobalState(t)
+	output, err = captureOutput(t, func() error {
+		return runDetect(DetectOptions{ChartDir: cronChart, SchemaSource: schemaSourceCluster, Verbose: true})
+	})
+	if err != nil {
+		t.Fatalf("runDetect failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "Fields in resources the cluster doesn't serve:") || !strings.Contains(output, "volumes (in cronjob.yaml") {
+		t.Errorf("CronJob should be reported as not served by the cluster, got:\n%s", output)
+	}
+}
+
+func TestUseSchemaSource(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	defer k8s.SetClusterSchema(k8s.SetClusterSchema(false))
+
+	if _, err := useSchemaSource("live"); err == nil || !strings.Contains(err.Error(), "invalid schema source") {
+		t.Errorf("expected an invalid schema source error, got %v", err)
+	}
+	if _, err := useSchemaSource(schemaSourceCluster); err == nil || !strings.Contains(err.Error(), "load-openapi --cluster") {
+		t.Errorf("expected an error pointing at load-openapi --cluster, got %v", err)
+	}
+
+	saveClusterSchemaFixture(t)
+	prevConf := conf
+	defer func() { conf = prevConf }()
+	conf.SchemaSource = schemaSourceCluster
+	restore, err := useSchemaSource("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !k8s.ClusterSchema() {
+		t.Error("schemaSource in config should select the cluster schema")
+	}
+	restore()
+	if k8s.ClusterSchema() {
+		t.Error("restore should return to the previous schema source")
+	}
+	restore, _ = useSchemaSource(schemaSourceTypes)
+	defer restore()
+	if k8s.ClusterSchema() {
+		t.Error("--schema types should override schemaSource in config")
+	}
+}
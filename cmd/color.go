@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+)
+
+// ANSI escape codes used for terminal output
+const (
+	ansiReset  = "\033[0m"
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+	ansiCyan   = "\033[36m"
+)
+
+// colorEnabled controls whether output is colorized. Off by default so output
+// piped to files or other tools stays plain; see initColor.
+var colorEnabled bool
+
+// initColor enables color when stdout is a terminal, unless --no-color was
+// passed or NO_COLOR is set (https://no-color.org)
+func initColor(noColor bool) {
+	colorEnabled = !noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+}
+
+// isTerminal reports whether f is a character device such as a TTY
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func colorize(code, s string) string {
+	if !colorEnabled || s == "" {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// green marks convertible paths and additions
+func green(s string) string { return colorize(ansiGreen, s) }
+
+// yellow marks warnings and paths needing attention
+func yellow(s string) string { return colorize(ansiYellow, s) }
+
+// red marks skipped paths, conflicts, and removals
+func red(s string) string { return colorize(ansiRed, s) }
+
+// cyan marks diff hunk headers
+func cyan(s string) string { return colorize(ansiCyan, s) }
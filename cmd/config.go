@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	pkgfs "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/template"
+	"gopkg.in/yaml.v3"
+)
+
+// chartConfigFile is the per-chart config file, checked into the chart repo
+// so conversion policy travels with the chart
+const chartConfigFile = ".helm-list-to-map.yaml"
+
+// configReadRetries is how many more times a user config that doesn't parse
+// is read, configReadDelay apart, before it's given up on
+var (
+	configReadRetries = 3
+	configReadDelay   = 100 * time.Millisecond
+)
+
+// readUserConfig reads the user config at path, if there is one. A config
+// that doesn't parse may be mid-write by a program writing it in place, so
+// it's read again shortly before the error is returned.
+func readUserConfig(path string) (Config, error) {
+	for attempt := 0; ; attempt++ {
+		var c Config
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return Config{}, nil
+			}
+			return Config{}, err
+		}
+		err = yaml.Unmarshal(data, &c)
+		if err == nil {
+			return c, nil
+		}
+		if attempt >= configReadRetries {
+			return Config{}, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		time.Sleep(configReadDelay)
+	}
+}
+
+// chartRulesAnnotation is the Chart.yaml annotation chart authors declare
+// rules in, as a YAML list in the format of the config's rules
+const chartRulesAnnotation = "list-to-map.helm.sh/rules"
+
+// useChartConfig merges the chart's config file (if any) over the current config.
+// Chart rules and ignores are consulted before user-level ones, and settings the
+// chart file sets override user settings. Rules declared in the chart's
+// Chart.yaml annotations come first of all, as the chart's authors know its
+// lists best. The returned function restores the previous config, so callers
+// processing several charts can scope it per chart.
+func useChartConfig(chartRoot string) (func(), error) {
+	prevConf := conf
+	prevHints := k8s.SetKindHints(nil)
+	prevLayout := pkgfs.SetTemplateLayout(pkgfs.DefaultTemplateLayout)
+	prevCurated := k8s.EnabledCuratedRuleSets()
+	restore := func() {
+		conf = prevConf
+		k8s.SetKindHints(prevHints)
+		pkgfs.SetTemplateLayout(prevLayout)
+		_, _ = k8s.SetCuratedRuleSets(prevCurated)
+	}
+
+	if err := mergeChartConfigFile(chartRoot); err != nil {
+		return restore, err
+	}
+	layout, err := templateLayout(conf)
+	if err != nil {
+		return restore, err
+	}
+	pkgfs.SetTemplateLayout(layout)
+	if _, err := templateStyle(chartRoot, conf.TemplateStyle); err != nil {
+		return restore, err
+	}
+	if _, err := k8s.SetCuratedRuleSets(conf.CuratedRules); err != nil {
+		return restore, fmt.Errorf("curatedRules: %w", err)
+	}
+	rules, err := chartAnnotationRules(chartRoot)
+	if err != nil {
+		return restore, err
+	}
+	if len(rules) > 0 {
+		conf.Rules = append(rules, conf.Rules...)
+	}
+	return restore, nil
+}
+
+// mergeChartConfigFile merges the chart's config file, if it has one, over
+// the current config
+func mergeChartConfigFile(chartRoot string) error {
+	path := filepath.Join(chartRoot, chartConfigFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("reading %s: %w", chartConfigFile, err)
+	}
+
+	merged, err := mergeConfig(conf, data)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", chartConfigFile, err)
+	}
+	conf = merged
+	hints, err := parseKindHints(conf.KindHints)
+	if err != nil {
+		return fmt.Errorf("%s: %w", chartConfigFile, err)
+	}
+	k8s.SetKindHints(hints)
+	return nil
+}
+
+// chartAnnotationRules returns the rules declared in the chart's Chart.yaml
+// under the chartRulesAnnotation annotation. A Chart.yaml that can't be read
+// has none here; the commands reading the chart report it.
+func chartAnnotationRules(chartRoot string) ([]Rule, error) {
+	data, err := os.ReadFile(filepath.Join(chartRoot, "Chart.yaml"))
+	if err != nil {
+		return nil, nil
+	}
+	var chart struct {
+		Annotations map[string]string `yaml:"annotations"`
+	}
+	if err := yaml.Unmarshal(data, &chart); err != nil {
+		return nil, nil
+	}
+	raw, ok := chart.Annotations[chartRulesAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	var rules []Rule
+	if err := yaml.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, fmt.Errorf("Chart.yaml annotation %s: %w", chartRulesAnnotation, err)
+	}
+	for _, r := range rules {
+		err := validatePathPattern(r.PathPattern, true)
+		if err == nil && len(r.UniqueKeys) == 0 && !r.Set {
+			err = fmt.Errorf("%s has no uniqueKeys", r.PathPattern)
+		}
+		if err == nil {
+			err = validateRule(r)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Chart.yaml annotation %s: %w", chartRulesAnnotation, err)
+		}
+	}
+	return rules, nil
+}
+
+// templateLayout returns the template directories and extensions set in c.
+// Directories must be inside the chart, and not the chart root itself, which
+// holds values files and subcharts.
+func templateLayout(c Config) (pkgfs.TemplateLayout, error) {
+	for _, d := range c.TemplateDirs {
+		clean := filepath.Clean(filepath.FromSlash(d))
+		if d == "" || filepath.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return pkgfs.TemplateLayout{}, fmt.Errorf("templateDirs: %q is not a directory inside the chart", d)
+		}
+	}
+	for _, e := range c.TemplateExtensions {
+		if strings.Trim(e, ".") == "" || strings.ContainsAny(e, `/\`) {
+			return pkgfs.TemplateLayout{}, fmt.Errorf("templateExtensions: invalid extension %q", e)
+		}
+	}
+	return pkgfs.TemplateLayout{Dirs: c.TemplateDirs, Extensions: c.TemplateExtensions}, nil
+}
+
+// templateStyle returns the style of generated template code for the chart at
+// root: the settings of the templateStyle config, and the style of the
+// chart's templates for those it leaves unset
+func templateStyle(root string, c TemplateStyleConfig) (template.Style, error) {
+	style := template.DetectStyle(pkgfs.OSFileSystem{}, root)
+	switch indent := strings.TrimSpace(c.Indent); indent {
+	case "":
+	case "tab":
+		style.Indent = "\t"
+	default:
+		n, err := strconv.Atoi(indent)
+		if err != nil || n < 0 {
+			return template.Style{}, fmt.Errorf("templateStyle.indent: %q is not a number of spaces or \"tab\"", c.Indent)
+		}
+		style.Indent = strings.Repeat(" ", n)
+	}
+	switch c.Actions {
+	case "":
+	case template.ActionsAligned, template.ActionsFlush:
+		style.Actions = c.Actions
+	default:
+		return template.Style{}, fmt.Errorf("templateStyle.actions: %q is not %q or %q", c.Actions, template.ActionsAligned, template.ActionsFlush)
+	}
+	if c.Trim != nil {
+		style.NoTrim = !*c.Trim
+	}
+	return style, nil
+}
+
+// templateOptions returns the helper name and style of the template code
+// written for the chart at chartRoot, from the current config
+func templateOptions(chartRoot string) (template.Options, error) {
+	style, err := templateStyle(chartRoot, conf.TemplateStyle)
+	if err != nil {
+		return template.Options{}, err
+	}
+	return template.Options{HelperName: conf.HelperName, Style: style}, nil
+}
+
+// parseKindHints parses the kindHints config, keyed by chart-relative template path
+func parseKindHints(raw map[string]string) (map[string]k8s.KindHint, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	hints := make(map[string]k8s.KindHint, len(raw))
+	for tmpl, s := range raw {
+		hint, err := k8s.ParseKindHint(s)
+		if err != nil {
+			return nil, fmt.Errorf("kindHints[%s]: %w", tmpl, err)
+		}
+		hints[filepath.ToSlash(filepath.Clean(tmpl))] = hint
+	}
+	return hints, nil
+}
+
+// mergeConfig decodes data over base. Scalar settings present in data replace
+// those in base; rules, ignore lists, and referenceFiles from data are placed
+// ahead of base's, and data's typePolicy entries replace base's for the same type. crdAuth is
+// kept from base, so a chart can't choose where credentials are sent, and so
+// are profiles, which only the user config defines.
+func mergeConfig(base Config, data []byte) (Config, error) {
+	merged := base
+	merged.Rules = nil
+	merged.IgnorePaths = nil
+	merged.IgnoreTypes = nil
+	merged.ReferenceFiles = nil
+	merged.KindHints = nil
+	merged.TypePolicy = nil
+	merged.RenamePaths = nil
+	merged.Profiles = nil
+	if err := yaml.Unmarshal(data, &merged); err != nil {
+		return base, err
+	}
+	merged.CRDAuth = base.CRDAuth
+	merged.Profiles = base.Profiles
+	merged.Rules = append(merged.Rules, base.Rules...)
+	merged.IgnorePaths = append(merged.IgnorePaths, base.IgnorePaths...)
+	merged.IgnoreTypes = append(merged.IgnoreTypes, base.IgnoreTypes...)
+	merged.ReferenceFiles = append(merged.ReferenceFiles, base.ReferenceFiles...)
+	for t, p := range base.TypePolicy {
+		if _, ok := merged.TypePolicy[t]; ok {
+			continue
+		}
+		if merged.TypePolicy == nil {
+			merged.TypePolicy = make(map[string]string)
+		}
+		merged.TypePolicy[t] = p
+	}
+	return merged, nil
+}
+
+// filterMinItems removes candidates whose values.yaml array has fewer than
+// conf.MinItems entries. Template-only candidates, and those whose type the
+// typePolicy always converts, are kept.
+// Returns the kept candidates and the values paths that were below the minimum.
+func filterMinItems(chartRoot string, candidates []k8s.DetectedCandidate) ([]k8s.DetectedCandidate, []string) {
+	if conf.MinItems <= 0 {
+		return candidates, nil
+	}
+	arrays, err := findValuesArrays(filepath.Join(chartRoot, "values.yaml"), "")
+	if err != nil {
+		return candidates, nil
+	}
+	counts := make(map[string]int, len(arrays))
+	for _, a := range arrays {
+		counts[a.Path] = a.Items
+	}
+
+	var kept []k8s.DetectedCandidate
+	var below []string
+	for _, c := range candidates {
+		if n, ok := counts[c.ValuesPath]; ok && n < conf.MinItems && typePolicyFor(c.ElementType) != typePolicyAlways {
+			below = append(below, c.ValuesPath)
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept, below
+}
+
+// validateRule checks the options of a configured rule
+func validateRule(r Rule) error {
+	if err := validateRuleKeyStrategy(r); err != nil {
+		return err
+	}
+	return validateRuleShape(r)
+}
+
+// validateRules checks every configured rule
+func validateRules() error {
+	for _, r := range conf.Rules {
+		if err := validateRule(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+	pkgfs "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/template"
+)
+
+func TestMergeConfig(t *testing.T) {
+	t.Parallel()
+
+	base := Config{
+		Rules:       []Rule{{PathPattern: "user.items[]", UniqueKeys: []string{"name"}}},
+		IgnorePaths: []string{"user.legacy"},
+		SortKeys:    true,
+		MinItems:    1,
+	}
+	data := []byte(`
+rules:
+  - pathPattern: chart.items[]
+    uniqueKeys: [id]
+ignorePaths: [chart.legacy]
+helperName: mychart.listmap.items
+minItems: 2
+crdAuth:
+  - host: attacker.example.com
+    tokenEnv: GITHUB_TOKEN
+`)
+
+	merged, err := mergeConfig(base, data)
+	if err != nil {
+		t.Fatalf("mergeConfig() error = %v", err)
+	}
+
+	if len(merged.Rules) != 2 || merged.Rules[0].PathPattern != "chart.items[]" {
+		t.Errorf("Rules = %+v, want chart rule first then user rule", merged.Rules)
+	}
+	if len(merged.IgnorePaths) != 2 || merged.IgnorePaths[1] != "user.legacy" {
+		t.Errorf("IgnorePaths = %v, want [chart.legacy user.legacy]", merged.IgnorePaths)
+	}
+	if merged.HelperName != "mychart.listmap.items" || merged.MinItems != 2 {
+		t.Errorf("HelperName = %q, MinItems = %d, want chart overrides", merged.HelperName, merged.MinItems)
+	}
+	if len(merged.CRDAuth) != 0 {
+		t.Errorf("CRDAuth = %+v, want it kept from the user config", merged.CRDAuth)
+	}
+	if !merged.SortKeys {
+		t.Error("SortKeys should keep the user setting when the chart config omits it")
+	}
+	if len(base.Rules) != 1 {
+		t.Errorf("base config was modified: %+v", base.Rules)
+	}
+}
+
+func TestConvertWithChartConfig(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	originalConf := conf
+	defer func() { conf = originalConf }()
+	conf = Config{}
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	chartConf := "helperName: mychart.listmap.items\nignorePaths: [volumes]\n"
+	if err := os.WriteFile(filepath.Join(chartPath, chartConfigFile), []byte(chartConf), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	values, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if !strings.Contains(string(values), "- name: config") {
+		t.Errorf("ignored volumes should stay a list, got:\n%s", values)
+	}
+	if strings.Contains(string(values), "- name: DB_HOST") {
+		t.Errorf("env should be converted, got:\n%s", values)
+	}
+
+	helper, err := os.ReadFile(filepath.Join(chartPath, "templates", "_listmap.tpl"))
+	if err != nil {
+		t.Fatalf("helper not created: %v", err)
+	}
+	if !strings.Contains(string(helper), `define "mychart.listmap.items"`) {
+		t.Errorf("helper should use the chart's helper name, got:\n%s", helper)
+	}
+	deployment, _ := os.ReadFile(filepath.Join(chartPath, "templates", "deployment.yaml"))
+	if !strings.Contains(string(deployment), `include "mychart.listmap.items"`) {
+		t.Errorf("templates should include the chart's helper name, got:\n%s", deployment)
+	}
+
+	// Chart config must not leak past the command
+	if conf.HelperName != "" || len(conf.IgnorePaths) != 0 {
+		t.Error("chart config should be restored after runConvert")
+	}
+}
+
+func TestFilterMinItems(t *testing.T) {
+	originalConf := conf
+	defer func() { conf = originalConf }()
+	conf = Config{MinItems: 3}
+
+	candidates := []k8s.DetectedCandidate{
+		{ValuesPath: "env"},
+		{ValuesPath: "volumes"},
+		{ValuesPath: "templateOnly"},
+	}
+	kept, below := filterMinItems("testdata/charts/basic", candidates)
+
+	if len(below) != 2 {
+		t.Errorf("below = %v, want env and volumes (2 items each)", below)
+	}
+	if len(kept) != 1 || kept[0].ValuesPath != "templateOnly" {
+		t.Errorf("kept = %+v, want only the template-only candidate", kept)
+	}
+}
+
+func TestKindHints(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	originalConf := conf
+	defer func() { conf = originalConf }()
+	conf = Config{}
+
+	root := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml": "apiVersion: v2\nname: test\nversion: 0.1.0\n",
+		"values.yaml": `workload:
+  kind: Deployment
+volumes:
+  - name: data
+    emptyDir: {}
+`,
+		"templates/workload.yaml": `apiVersion: apps/v1
+kind: {{ .Values.workload.kind }}
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      volumes:
+        {{- toYaml .Values.volumes | nindent 8 }}
+`,
+	}
+	writeChartFiles(t, root, files)
+
+	// Without a hint the templated kind can't be classified
+	result, err := k8s.DetectConversionCandidatesFull(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Candidates) != 0 || len(result.Undetected) != 1 || result.Undetected[0].Reason != "Resource kind is templated" {
+		t.Fatalf("without hints: candidates = %+v, undetected = %+v", result.Candidates, result.Undetected)
+	}
+
+	chartConf := "kindHints:\n  templates/workload.yaml: apps/v1/Deployment\n"
+	if err := os.WriteFile(filepath.Join(root, chartConfigFile), []byte(chartConf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	restore, err := useChartConfig(root)
+	if err != nil {
+		t.Fatalf("useChartConfig() error = %v", err)
+	}
+	result, err = k8s.DetectConversionCandidatesFull(root)
+	restore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Candidates) != 1 || result.Candidates[0].ValuesPath != "volumes" || result.Candidates[0].ResourceKind != "Deployment" {
+		t.Errorf("with hints: candidates = %+v, want volumes on Deployment", result.Candidates)
+	}
+
+	// Hints must not leak past the command
+	result, _ = k8s.DetectConversionCandidatesFull(root)
+	if len(result.Candidates) != 0 {
+		t.Errorf("kind hints should be restored, got candidates %+v", result.Candidates)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, chartConfigFile), []byte("kindHints:\n  templates/workload.yaml: Deployment\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	restore, err = useChartConfig(root)
+	restore()
+	if err == nil || !strings.Contains(err.Error(), "invalid kind hint") {
+		t.Errorf("useChartConfig() error = %v, want invalid kind hint", err)
+	}
+}
+
+func TestChartAnnotationRules(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	originalConf := conf
+	defer func() { conf = originalConf }()
+	conf = Config{Rules: []Rule{{PathPattern: "user.items[]", UniqueKeys: []string{"name"}}}}
+
+	root := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml": `apiVersion: v2
+name: test
+version: 0.1.0
+annotations:
+  list-to-map.helm.sh/rules: |
+    - pathPattern: widgets[]
+      uniqueKeys: [id]
+      note: Widget items are identified by id
+`,
+		chartConfigFile: "rules:\n  - pathPattern: chart.items[]\n    uniqueKeys: [name]\n",
+		"values.yaml": `widgets:
+  - id: first
+    size: 1
+  - id: second
+    size: 2
+`,
+		"templates/widget.yaml": `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: app
+spec:
+  widgets:
+    {{- toYaml .Values.widgets | nindent 4 }}
+`,
+	}
+	writeChartFiles(t, root, files)
+
+	restore, err := useChartConfig(root)
+	if err != nil {
+		t.Fatalf("useChartConfig() error = %v", err)
+	}
+	var patterns []string
+	for _, r := range conf.Rules {
+		patterns = append(patterns, r.PathPattern)
+	}
+	restore()
+	if got := strings.Join(patterns, ","); got != "widgets[],chart.items[],user.items[]" {
+		t.Errorf("rules = %s, want annotation, chart config, then user rules", got)
+	}
+	if len(conf.Rules) != 1 {
+		t.Errorf("annotation rules should be restored, got %+v", conf.Rules)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: root, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+	values, _ := os.ReadFile(filepath.Join(root, "values.yaml"))
+	if !strings.Contains(string(values), "  first:\n    size: 1\n") {
+		t.Errorf("widgets should be converted by the annotation rule, got:\n%s\nOutput: %s", values, output)
+	}
+
+	chart := "apiVersion: v2\nname: test\nversion: 0.1.0\nannotations:\n  list-to-map.helm.sh/rules: |\n    - pathPattern: widgets\n      uniqueKeys: [id]\n"
+	if err := os.WriteFile(filepath.Join(root, "Chart.yaml"), []byte(chart), 0644); err != nil {
+		t.Fatal(err)
+	}
+	restore, err = useChartConfig(root)
+	restore()
+	if err == nil || !strings.Contains(err.Error(), "Chart.yaml annotation list-to-map.helm.sh/rules") || !strings.Contains(err.Error(), "ends with []") {
+		t.Errorf("useChartConfig() error = %v, want an invalid annotation rule", err)
+	}
+}
+
+func TestTemplateLayout(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	originalConf := conf
+	defer func() { conf = originalConf }()
+	conf = Config{}
+
+	root := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml": "apiVersion: v2\nname: test\nversion: 0.1.0\n",
+		"values.yaml": `volumes:
+  - name: data
+    emptyDir: {}
+`,
+		"templates/workloads/app.yaml.gotmpl": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      volumes:
+        {{- toYaml .Values.volumes | nindent 8 }}
+`,
+		"templates/NOTES.txt": `Volumes:
+{{- range .Values.volumes }}
+  {{ .name }}
+{{- end }}
+`,
+		chartConfigFile: "templateExtensions: [.yaml, .tpl, .gotmpl, .txt]\n",
+	}
+	writeChartFiles(t, root, files)
+
+	restore, err := useChartConfig(root)
+	if err != nil {
+		restore()
+		t.Fatalf("useChartConfig() error = %v", err)
+	}
+	result, err := k8s.DetectConversionCandidatesFull(root)
+	if err != nil {
+		restore()
+		t.Fatal(err)
+	}
+	if len(result.Candidates) != 1 || result.Candidates[0].ValuesPath != "volumes" {
+		restore()
+		t.Fatalf("candidates = %+v, want volumes from the .gotmpl template", result.Candidates)
+	}
+	paths := []template.PathInfo{{DotPath: "volumes", MergeKey: "name"}}
+	rewrites, err := template.PreviewTemplateRewrites(pkgfs.OSFileSystem{}, root, paths, template.Options{})
+	notes := template.NotesReferences(root, paths)
+	restore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// NOTES.txt is scanned but never rewritten, though .txt is a template extension
+	if len(rewrites) != 1 || rewrites[0].Path != "templates/workloads/app.yaml.gotmpl" {
+		t.Errorf("rewrites = %+v, want only the .gotmpl template", rewrites)
+	}
+	if len(notes) != 1 || notes[0].Path != "templates/NOTES.txt" || strings.Join(notes[0].DotPaths, ",") != "volumes" {
+		t.Errorf("NotesReferences() = %+v, want templates/NOTES.txt using volumes", notes)
+	}
+
+	// The layout must not leak past the command
+	result, _ = k8s.DetectConversionCandidatesFull(root)
+	if len(result.Candidates) != 0 {
+		t.Errorf("template layout should be restored, got candidates %+v", result.Candidates)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, chartConfigFile), []byte("templateDirs: [../shared]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	restore, err = useChartConfig(root)
+	restore()
+	if err == nil || !strings.Contains(err.Error(), "not a directory inside the chart") {
+		t.Errorf("useChartConfig() error = %v, want a directory outside the chart rejected", err)
+	}
+}
+
+func TestTemplateStyleConfig(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	originalConf := conf
+	defer func() { conf = originalConf }()
+	conf = Config{}
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "templates"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Helpers indented by 2, actions aligned with the YAML they wrap
+	helpers := "{{- define \"app.name\" -}}\n  {{- if .Values.nameOverride }}\n    {{- .Values.nameOverride }}\n  {{- end }}\n{{- end -}}\n"
+	deployment := "spec:\n  {{- with .Values.env }}\n  env:\n    {{- toYaml . | nindent 4 }}\n  {{- end }}\n"
+	for name, content := range map[string]string{"_helpers.tpl": helpers, "deployment.yaml": deployment} {
+		if err := os.WriteFile(filepath.Join(root, "templates", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		config  string
+		want    template.Style
+		wantErr string
+	}{
+		{name: "detected", want: template.Style{Indent: "  ", Actions: template.ActionsAligned}},
+		{name: "tabs", config: "templateStyle:\n  indent: tab\n", want: template.Style{Indent: "\t", Actions: template.ActionsAligned}},
+		{name: "flush", config: "templateStyle:\n  indent: 0\n  actions: flush\n  trim: false\n", want: template.Style{Actions: template.ActionsFlush, NoTrim: true}},
+		{name: "bad indent", config: "templateStyle:\n  indent: wide\n", wantErr: "templateStyle.indent"},
+		{name: "bad actions", config: "templateStyle:\n  actions: centered\n", wantErr: "templateStyle.actions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(filepath.Join(root, chartConfigFile), []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			restore, err := useChartConfig(root)
+			var got template.Style
+			if err == nil {
+				// Read the style while the chart's config applies
+				o, _ := templateOptions(root)
+				got = o.Style
+			}
+			restore()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("useChartConfig() error = %v, want %s rejected", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("useChartConfig() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("style = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCuratedRules(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	originalConf := conf
+	defer func() { conf = originalConf }()
+	conf = Config{}
+
+	root := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml": "apiVersion: v2\nname: test\nversion: 0.1.0\n",
+		"values.yaml": `networkPolicy:
+  ingress:
+    - from:
+        - podSelector: {}
+    - name: monitoring
+      ports:
+        - port: 9090
+ingress:
+  hosts:
+    - host: a.example.com
+      http: {}
+`,
+		"templates/networkpolicy.yaml": `apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: app
+spec:
+  podSelector: {}
+  ingress:
+    {{- toYaml .Values.networkPolicy.ingress | nindent 4 }}
+`,
+		"templates/ingress.yaml": `apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: app
+spec:
+  rules:
+    {{- toYaml .Values.ingress.hosts | nindent 4 }}
+`,
+	}
+	writeChartFiles(t, root, files)
+
+	// The lists have no merge key until the chart opts in
+	result, err := k8s.DetectConversionCandidatesFull(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Candidates) != 0 || len(result.Undetected) != 2 || result.Undetected[0].Category != k8s.CategoryK8sNoKeys {
+		t.Fatalf("without curated rules: candidates = %+v, undetected = %+v", result.Candidates, result.Undetected)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, chartConfigFile), []byte("curatedRules: [ingress, networkpolicy]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	restore, err := useChartConfig(root)
+	if err != nil {
+		t.Fatalf("useChartConfig() error = %v", err)
+	}
+	result, err = k8s.DetectConversionCandidatesFull(root)
+	restore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]k8s.DetectedCandidate)
+	for _, c := range result.Candidates {
+		got[c.ValuesPath] = c
+	}
+	if c := got["networkPolicy.ingress"]; c.MergeKey != "name" || !c.Synthetic || c.Curated != "networkpolicy" {
+		t.Errorf("networkPolicy.ingress = %+v, want a synthetic name key from the networkpolicy rules", c)
+	}
+	if c := got["ingress.hosts"]; c.MergeKey != "host" || c.Synthetic || c.Curated != "ingress" {
+		t.Errorf("ingress.hosts = %+v, want keyed by host from the ingress rules", c)
+	}
+	if len(k8s.EnabledCuratedRuleSets()) != 0 {
+		t.Errorf("curated rules should be restored, got %v", k8s.EnabledCuratedRuleSets())
+	}
+
+	if _, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: root, BackupExt: ".bak", MigrationFile: "values-migration.yaml"})
+	}); err != nil {
+		t.Fatalf("runConvert failed: %v", err)
+	}
+	checks := map[string][]string{
+		"values.yaml":                  {"  ingress:\n    ingress-1:\n      from:\n        - podSelector: {}\n    monitoring:\n      ports:\n", "  hosts:\n    a.example.com:\n      http: {}\n"},
+		"templates/networkpolicy.yaml": {`include "chart.listmap.items.synthetic" (dict "items" (index .Values "networkPolicy" "ingress") "key" "name")`},
+		"templates/_listmap.tpl":       {`define "chart.listmap.items.synthetic"`},
+		"values-migration.yaml":        {"key: name\n      synthetic: true"},
+	}
+	for name, wants := range checks {
+		data, _ := os.ReadFile(filepath.Join(root, name))
+		for _, want := range wants {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("%s should contain %q, got:\n%s", name, want, data)
+			}
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(root, chartConfigFile), []byte("curatedRules: [psp]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	restore, err = useChartConfig(root)
+	restore()
+	if err == nil || !strings.Contains(err.Error(), `unknown curated rule set "psp"`) {
+		t.Errorf("useChartConfig() error = %v, want unknown curated rule set", err)
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import "github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+
+// useConfigDataKey enables detecting lists written into ConfigMap and Secret
+// data, keyed by the field given by flag or else by the configDataKey
+// setting. Detection stays off when neither is set. The returned function
+// restores the previous key.
+func useConfigDataKey(flag string) func() {
+	key := flag
+	if key == "" {
+		key = conf.ConfigDataKey
+	}
+	prev := k8s.SetConfigDataKey(key)
+	return func() { k8s.SetConfigDataKey(prev) }
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	pkgfs "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/parser"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/template"
+	"gopkg.in/yaml.v3"
+)
+
+// mapShapedPath is a values path a chart already keeps as a map
+type mapShapedPath struct {
+	Path string
+	Via  string // How templates render it: "list-map helper" or "range over map"
+}
+
+// shapeConsistency compares the values paths a chart keeps as maps with the
+// convertible paths still lists. A chart with both is hybrid: its users
+// override some collections by key and others by index.
+type shapeConsistency struct {
+	Maps  []mapShapedPath
+	Lists []string
+}
+
+// hybrid reports whether the chart has both map- and list-shaped paths
+func (c shapeConsistency) hybrid() bool {
+	return len(c.Maps) > 0 && len(c.Lists) > 0
+}
+
+// chartShapeConsistency finds the paths the chart at root already keeps as
+// maps, either rendered through the list-map helper or ranged over as
+// name: item maps (e.g., containers: {main: {...}, sidecar: {...}}), next to
+// lists, the convertible paths still lists
+func chartShapeConsistency(root string, lists []string) shapeConsistency {
+	c := shapeConsistency{Lists: append([]string(nil), lists...)}
+	sort.Strings(c.Lists)
+	isList := make(map[string]bool, len(lists))
+	for _, p := range lists {
+		isList[p] = true
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range template.ConvertedPaths(root) {
+		if !seen[p.DotPath] && !isList[p.DotPath] {
+			seen[p.DotPath] = true
+			c.Maps = append(c.Maps, mapShapedPath{Path: p.DotPath, Via: "list-map helper"})
+		}
+	}
+
+	doc, _, err := loadValuesNode(filepath.Join(root, "values.yaml"))
+	if err != nil || len(doc.Content) == 0 {
+		sortMapShapedPaths(c.Maps)
+		return c
+	}
+	_ = pkgfs.WalkTemplates(pkgfs.OSFileSystem{}, root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if !pkgfs.IsTemplate(path) {
+			return nil
+		}
+		parsed, err := parser.ParseTemplateFile(path)
+		if err != nil {
+			return nil
+		}
+		for _, directive := range parsed.Directives {
+			for _, u := range parser.AnalyzeDirectiveContent(directive.Content, directive.WithContext) {
+				if u.Pattern != "range_kv" || seen[u.ValuesPath] || isList[u.ValuesPath] {
+					continue
+				}
+				// A map of named items, not a map of settings
+				v := nodeAt(doc.Content[0], strings.Split(u.ValuesPath, ".")...)
+				if v == nil || v.Kind != yaml.MappingNode || !mapOfMappings(v) {
+					continue
+				}
+				seen[u.ValuesPath] = true
+				c.Maps = append(c.Maps, mapShapedPath{Path: u.ValuesPath, Via: "range over map"})
+			}
+		}
+		return nil
+	})
+	sortMapShapedPaths(c.Maps)
+	return c
+}
+
+// mapOfMappings reports whether every value of a non-empty mapping is itself
+// a mapping, as the items of a map keyed by name are
+func mapOfMappings(n *yaml.Node) bool {
+	if len(n.Content) == 0 {
+		return false
+	}
+	for i := 1; i < len(n.Content); i += 2 {
+		if n.Content[i].Kind != yaml.MappingNode {
+			return false
+		}
+	}
+	return true
+}
+
+// sortMapShapedPaths orders paths by name
+func sortMapShapedPaths(paths []mapShapedPath) {
+	sort.Slice(paths, func(i, j int) bool { return paths[i].Path < paths[j].Path })
+}
+
+// printShapeConsistency reports a hybrid chart's map- and list-shaped paths,
+// recommending converting the lists to match
+func printShapeConsistency(root string, c shapeConsistency) {
+	if !c.hybrid() {
+		return
+	}
+	fmt.Println()
+	fmt.Println(yellow("Mixed collection shapes:"))
+	fmt.Printf("  %d path(s) are already maps:\n", len(c.Maps))
+	for _, m := range c.Maps {
+		fmt.Printf("    %s (%s)\n", m.Path, m.Via)
+	}
+	fmt.Printf("  %d convertible path(s) are still lists:\n", len(c.Lists))
+	for _, p := range c.Lists {
+		fmt.Printf("    %s\n", p)
+	}
+	fmt.Printf("  Convert the lists to match with 'helm list-to-map convert --chart %s'.\n", root)
+}
+
+// withoutRuledConflicts drops the conflicts over paths a user rule converts;
+// the rule settles how they are keyed
+func withoutRuledConflicts(conflicts []k8s.ConsumerConflict, ruled []k8s.DetectedCandidate) []k8s.ConsumerConflict {
+	if len(ruled) == 0 {
+		return conflicts
+	}
+	hasRule := make(map[string]bool, len(ruled))
+	for _, c := range ruled {
+		hasRule[c.ValuesPath] = true
+	}
+	var kept []k8s.ConsumerConflict
+	for _, c := range conflicts {
+		if !hasRule[c.ValuesPath] {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// printConsumerConflicts reports the values paths rendered into resource
+// fields that disagree on conversion, with each consuming template
+func printConsumerConflicts(conflicts []k8s.ConsumerConflict, indent string) {
+	if len(conflicts) == 0 {
+		return
+	}
+	fmt.Println("\n" + indent + yellow("Used by resources that disagree on conversion (left as lists):"))
+	for _, c := range conflicts {
+		fmt.Printf("%s  %s\n", indent, c.ValuesPath)
+		for _, u := range c.Consumers {
+			key := "atomic list, no merge key"
+			if u.MergeKey != "" {
+				key = "key=" + u.MergeKey
+			}
+			fmt.Printf("%s    %s:%d: %s %s (%s)\n", indent, u.TemplateFile, u.LineNumber, u.Kind, u.YAMLPath, key)
+		}
+	}
+	fmt.Printf("%s  Split the value per resource, or add a rule for the path to convert it anyway.\n", indent)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+// writeHybridChart writes a chart keeping containers as a map of named
+// containers and volumes as a list
+func writeHybridChart(t *testing.T) string {
+	t.Helper()
+	chartPath := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml": "apiVersion: v2\nname: hybrid\nversion: 0.1.0\n",
+		"values.yaml": `containers:
+  main:
+    image: nginx
+  sidecar:
+    image: busybox
+volumes:
+  - name: data
+    emptyDir: {}
+`,
+		"templates/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: hybrid
+spec:
+  template:
+    spec:
+      containers:
+        {{- range $name, $c := .Values.containers }}
+        - name: {{ $name }}
+          image: {{ $c.image }}
+        {{- end }}
+      volumes:
+        {{- toYaml .Values.volumes | nindent 8 }}
+`,
+	}
+	writeChartFiles(t, chartPath, files)
+	return chartPath
+}
+
+func TestChartShapeConsistency(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	chartPath := writeHybridChart(t)
+
+	c := chartShapeConsistency(chartPath, []string{"volumes"})
+	if !c.hybrid() {
+		t.Fatalf("expected a hybrid chart, got %+v", c)
+	}
+	if len(c.Maps) != 1 || c.Maps[0] != (mapShapedPath{Path: "containers", Via: "range over map"}) {
+		t.Errorf("Maps = %+v, want containers ranged over", c.Maps)
+	}
+
+	// Without lists left, the chart is consistent
+	if c := chartShapeConsistency(chartPath, nil); c.hybrid() {
+		t.Errorf("expected no lists to be consistent, got %+v", c)
+	}
+}
+
+func TestDetectAndConvertHybridChart(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	chartPath := writeHybridChart(t)
+
+	output, err := captureOutput(t, func() error {
+		return runDetect(DetectOptions{ChartDir: chartPath})
+	})
+	if err != nil {
+		t.Fatalf("runDetect failed: %v\n%s", err, output)
+	}
+	for _, want := range []string{"Mixed collection shapes:", "containers (range over map)", "    volumes\n"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in detect output, got:\n%s", want, output)
+		}
+	}
+
+	output, err = captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\n%s", err, output)
+	}
+	if !strings.Contains(output, "These match the paths the chart already kept as maps: containers") {
+		t.Errorf("expected convert to note the matched maps, got:\n%s", output)
+	}
+}
+
+func TestConflictingConsumers(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	// shared feeds volumes (keyed by name) and tolerations (atomic)
+	chartPath := t.TempDir()
+	values := "shared:\n  - name: data\n    emptyDir: {}\nvolumes:\n  - name: cache\n    emptyDir: {}\n"
+	files := map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: conflict\nversion: 0.1.0\n",
+		"values.yaml": values,
+		"templates/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: conflict
+spec:
+  template:
+    spec:
+      volumes:
+        {{- toYaml .Values.volumes | nindent 8 }}
+        {{- toYaml .Values.shared | nindent 8 }}
+`,
+		"templates/job.yaml": `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: conflict
+spec:
+  template:
+    spec:
+      tolerations:
+        {{- toYaml .Values.shared | nindent 8 }}
+`,
+	}
+	writeChartFiles(t, chartPath, files)
+
+	output, err := captureOutput(t, func() error {
+		return runDetect(DetectOptions{ChartDir: chartPath})
+	})
+	if err != nil {
+		t.Fatalf("runDetect failed: %v\nOutput: %s", err, output)
+	}
+	for _, want := range []string{
+		"Used by resources that disagree on conversion",
+		"deployment.yaml:10: Deployment spec.template.spec.volumes (key=name)",
+		"job.yaml:9: Job spec.template.spec.tolerations (atomic list, no merge key)",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("detect output should contain %q, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "  shared (key=name") {
+		t.Errorf("shared should not be a candidate, got:\n%s", output)
+	}
+
+	output, err = captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "Used by resources that disagree on conversion") {
+		t.Errorf("convert should report the conflict, got:\n%s", output)
+	}
+	got, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if !strings.Contains(string(got), "shared:\n  - name: data") {
+		t.Errorf("shared should stay a list, got:\n%s", got)
+	}
+	if !strings.Contains(string(got), "volumes:\n  cache:") {
+		t.Errorf("volumes should still convert, got:\n%s", got)
+	}
+
+	// A rule for the path settles the conflict
+	rule := "rules:\n  - pathPattern: shared[]\n    uniqueKeys: [name]\n"
+	if err := os.WriteFile(filepath.Join(chartPath, chartConfigFile), []byte(rule), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err = captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+	if strings.Contains(output, "disagree on conversion") {
+		t.Errorf("a ruled path should not be reported as a conflict, got:\n%s", output)
+	}
+	got, _ = os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if !strings.Contains(string(got), "shared:\n  data:") {
+		t.Errorf("shared should convert under the rule, got:\n%s\nOutput: %s", got, output)
+	}
+}
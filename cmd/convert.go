@@ -2,76 +2,153 @@ package main
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	pkgfs "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
 	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/parser"
 	"github.com/scottrigby/helm-list-to-map-plugin/pkg/template"
 	"github.com/scottrigby/helm-list-to-map-plugin/pkg/transform"
+	"gopkg.in/yaml.v3"
 )
 
 func runConvert(opts ConvertOptions) error {
+	if opts.MetricsFile != "" && metrics == nil {
+		return runConvertWithMetrics(opts)
+	}
+	if opts.Summary != "" && summary == nil {
+		return runConvertWithSummary(opts)
+	}
+	if opts.ChartRef != "" {
+		return runConvertChartRef(opts)
+	}
+	if opts.SnapshotDir != "" {
+		return runConvertWithSnapshots(opts)
+	}
+	if opts.Atomic || opts.Workdir != "" {
+		return runConvertInWorkdir(opts)
+	}
 	root, err := findChartRoot(opts.ChartDir)
 	if err != nil {
 		return err
 	}
+	metrics.name(chartName(root))
+	summary.root(root)
+
+	// Apply the chart's own config over the user config
+	restore, err := useChartConfig(root)
+	defer restore()
+	if err != nil {
+		return err
+	}
+	restoreKeys, err := useKeyOverrides(opts.Keys)
+	defer restoreKeys()
+	if err != nil {
+		return err
+	}
+	if err := validateEnvOrdering(); err != nil {
+		return err
+	}
+	if err := validateTypePolicy(); err != nil {
+		return err
+	}
+	if err := validateRules(); err != nil {
+		return err
+	}
+	if err := validateRenamePaths(); err != nil {
+		return err
+	}
+	if err := validateReferenceFiles(); err != nil {
+		return err
+	}
+	if err := validateBumpLevel(opts.BumpVersion); err != nil {
+		return err
+	}
+	restoreKube, err := useKubeVersion(opts.KubeVersion)
+	defer restoreKube()
+	if err != nil {
+		return err
+	}
+	restoreSchema, err := useSchemas(opts.SchemaSource, false)
+	defer restoreSchema()
+	if err != nil {
+		return err
+	}
+	defer useConfigDataKey(opts.ConfigDataKey)()
+	topts, err := templateOptions(root)
+	if err != nil {
+		return err
+	}
+	if err := template.CheckHelperCollisions(pkgfs.OSFileSystem{}, root, topts); err != nil {
+		return err
+	}
+
+	// Give this run's backups their own snapshot so earlier backups survive
+	baseExt := opts.BackupExt
+	opts.BackupExt = snapshotBackupExt(root, baseExt)
 
 	// Handle recursive conversion of umbrella charts
 	if opts.Recursive || opts.IncludeChartsDir || opts.ExpandRemote {
-		return runRecursiveConvert(root, opts)
+		if opts.TUI {
+			return fmt.Errorf("--tui cannot be combined with --recursive, --include-charts-dir, or --expand-remote")
+		}
+		if err := runRecursiveConvert(root, opts); err != nil {
+			return err
+		}
+		if opts.DryRun {
+			return nil
+		}
+		return rotateBackups(root, baseExt, opts.MaxBackups)
 	}
 
 	// Local variable to track converted paths
 	var transformedPaths []template.PathInfo
 
-	// Load CRDs from plugin config directory
-	if err := loadCRDsFromConfig(); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: loading CRDs: %v\n", err)
-	}
-
-	// Use new programmatic detection via K8s API introspection
-	candidates, err := k8s.DetectConversionCandidates(root)
+	// Detect candidates and keep only paths with matching template patterns
+	metrics.chart()
+	detectStart := time.Now()
+	collected, err := collectConvertCandidates(root)
 	if err != nil {
+		metrics.failed()
 		return err
 	}
-
-	// Also check for user-defined rules (for CRDs)
-	userDetected := scanForUserRules(root)
-	candidates = append(candidates, userDetected...)
-
-	// Build PathInfo list and check which paths have matching template patterns
-	var pathInfos []template.PathInfo
-	for _, c := range candidates {
-		pathInfos = append(pathInfos, template.PathInfo{
-			DotPath:     c.ValuesPath,
-			MergeKey:    c.MergeKey,
-			SectionName: c.SectionName,
-		})
+	metrics.phase(phaseDetect, detectStart)
+	candidateList, skippedPaths := collected.Matched, collected.Skipped
+	parseErrs := parseErrors(collected.ParseErrors)
+	recordSkipped(collected, opts.TUI)
+
+	// Types the typePolicy asks about are only converted once selected
+	if opts.TUI {
+		candidateList = append(candidateList, collected.Ask...)
 	}
 
-	// Check template patterns BEFORE converting values
-	// Only convert values for paths where template patterns actually match
-	matchedPaths := template.CheckTemplatePatterns(root, pathInfos)
-
-	// Filter candidates to only include paths with matching template patterns
-	candidateMap := make(map[string]k8s.DetectedCandidate)
-	var skippedPaths []string
-	for _, c := range candidates {
-		if matchedPaths[c.ValuesPath] {
-			candidateMap[c.ValuesPath] = c
-		} else {
-			skippedPaths = append(skippedPaths, c.ValuesPath)
+	// Let the user review and select candidates interactively
+	if opts.TUI {
+		selected, apply, err := reviewCandidates(root, candidateList, os.Stdin, os.Stdout)
+		if err != nil {
+			return err
+		}
+		if !apply {
+			fmt.Println("No changes applied.")
+			return nil
 		}
+		opts.Paths = selected
 	}
 
-	// Check values.yaml existence for candidates with matching templates
-	var candidateList []k8s.DetectedCandidate
-	for _, c := range candidateMap {
-		candidateList = append(candidateList, c)
+	// Restrict to explicitly selected paths, if any
+	if len(opts.Paths) > 0 {
+		candidateList = filterCandidatesByPath(candidateList, opts.Paths)
 	}
+
+	// Check values.yaml existence for candidates with matching templates
 	candidateList = k8s.CheckCandidatesInValues(root, candidateList)
+	candidateList = withRenamedPaths(candidateList)
 
 	// Separate by values existence
 	var withValuesCandidates, templateOnlyCandidates []k8s.DetectedCandidate
@@ -83,65 +160,133 @@ func runConvert(opts ConvertOptions) error {
 		}
 	}
 
-	// Rebuild candidateMap with only candidates that have values
-	candidateMap = make(map[string]k8s.DetectedCandidate)
+	// Build candidateMap with only candidates that have values
+	candidateMap := make(map[string]k8s.DetectedCandidate)
 	for _, c := range withValuesCandidates {
 		candidateMap[c.ValuesPath] = c
 	}
 
-	// Warn about paths that couldn't be converted
-	if len(skippedPaths) > 0 {
-		fmt.Println("\nSkipped (template pattern not supported):")
-		for _, p := range skippedPaths {
+	// Decide how env arrays with $(VAR) order dependencies are converted
+	envPolicy := planEnvOrdering(filepath.Join(root, "values.yaml"), "", opts.ValuesFiles, candidateMap, "")
+
+	// Report paths excluded by ignore rules
+	if len(collected.Ignored) > 0 {
+		fmt.Println("\n" + yellow("Ignored (config or # list-to-map: ignore):"))
+		for _, p := range collected.Ignored {
 			fmt.Printf("  %s\n", p)
 		}
-		fmt.Println("  These paths use inline append patterns (e.g., static entries + toYaml)")
-		fmt.Println("  that cannot be automatically converted.")
 	}
 
+	// Report paths whose consuming resources disagree on the merge key
+	printConsumerConflicts(collected.Conflicts, "")
+
+	// Report paths with too few items to be worth converting
+	if len(collected.BelowMinItems) > 0 {
+		fmt.Println("\n" + yellow(fmt.Sprintf("Skipped (fewer than %d items):", conf.MinItems)))
+		for _, p := range collected.BelowMinItems {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+
+	// Report paths left for the user to choose
+	if len(collected.Ask) > 0 && !opts.TUI {
+		fmt.Println("\n" + yellow("Needs confirmation (typePolicy: ask):"))
+		for _, c := range collected.Ask {
+			fmt.Printf("  %s (type=%s)\n", c.ValuesPath, c.ElementType)
+		}
+		fmt.Println("  Select them with --tui, or set their typePolicy to always.")
+	}
+
+	// Warn about paths that couldn't be converted
+	if len(skippedPaths) > 0 {
+		fmt.Println("\n" + red("Skipped (template pattern not supported):"))
+		printSkippedPaths(root, skippedPaths, "  ")
+		fmt.Println("  These templates must be updated by hand before the paths can be converted.")
+	}
+	printUnhandledDictArgs(collected.Unhandled, "")
+
+	valuesStart := time.Now()
 	valuesPath := filepath.Join(root, "values.yaml")
 	doc, raw, err := loadValuesNode(valuesPath)
 	if err != nil {
+		metrics.failed()
+		// Nothing converts without the values, but report the file with the rest
+		if parseErrs.add(err) {
+			return parseErrs.report()
+		}
 		return err
 	}
 
-	// Use line-based editing to preserve original formatting
+	unshared := len(candidateMap)
+	candidateMap, merged := withoutMergedLists(doc, candidateMap)
+	printMergedLists(os.Stdout, merged, "")
+	metrics.skipped(skipShared, unshared-len(candidateMap))
+
+	// Use line-based editing to preserve original formatting. The chart's own
+	// defaults are converted, so null lists become {} too.
 	var edits []transform.ArrayEdit
-	transform.FindArrayEdits(doc, nil, candidateMap, &edits)
+	transform.FindArrayEditsWithOptions(doc, nil, candidateMap, transform.EditOptions{NullAsEmpty: true}, &edits)
+	applyOrderFields(edits, envPolicy)
+	printRepeatedSetValues(os.Stdout, edits, "")
+	out, examples := convertValuesComments(doc, raw, edits, candidateList, opts.ConvertComments)
+
+	// Renamed lists move along with their conversion, or not at all
+	repaired := staleTemplatePaths(doc, candidateMap)
+	var converted []k8s.DetectedCandidate
+	for _, edit := range edits {
+		converted = append(converted, edit.Candidate)
+	}
+	converted = append(converted, repaired...)
+	out, moved, err := moveRenamedValues(out, converted)
+	if err != nil {
+		metrics.failed()
+		return err
+	}
+	warnUnrenamed(doc, append(converted, templateOnlyCandidates...))
+	var referenced []template.PathInfo
+	for _, c := range append(converted, templateOnlyCandidates...) {
+		referenced = append(referenced, convertedPathInfo(c, envPolicy[c.ValuesPath], opts.EnvDependencySort))
+	}
+	warnExternalReferences(root, referenced)
 
 	// Track all backup files created
 	var backupFiles []string
 
-	if len(edits) > 0 {
-		out := transform.ApplyLineEdits(raw, edits)
-
+	if len(edits) > 0 || len(examples) > 0 || moved {
+		summary.file(valuesPath)
 		if opts.DryRun {
-			fmt.Println("=== values.yaml (updated preview) ===")
-			fmt.Println(string(out))
+			fmt.Println("=== values.yaml (dry-run diff) ===")
+			if len(examples) > 0 || moved {
+				printHunks("values.yaml", string(raw), string(out))
+			} else {
+				printValuesDiff("values.yaml", raw, edits)
+			}
 		} else {
 			backupPath := valuesPath + opts.BackupExt
 			if err := backupFile(valuesPath, opts.BackupExt, raw); err != nil {
 				return err
 			}
 			backupFiles = append(backupFiles, backupPath)
-			if err := os.WriteFile(valuesPath, out, 0644); err != nil {
+			if err := rewriteFile(valuesPath, out); err != nil {
 				return err
 			}
 		}
+	}
 
-		// Check if any env vars are being converted
-		hasEnvVars := false
+	if len(edits) > 0 {
+		// Collect env var paths being converted for the order check. Paths
+		// rendered in dependency order, or handled by the envOrdering policy,
+		// don't depend on alphabetical order.
+		var envPaths []string
 		for _, edit := range edits {
-			if strings.Contains(edit.Candidate.ElementType, "EnvVar") ||
-				strings.HasSuffix(edit.Candidate.ValuesPath, ".env") ||
-				strings.HasSuffix(edit.Candidate.ValuesPath, "Env") {
-				hasEnvVars = true
-				break
+			path := edit.Candidate.ValuesPath
+			if isEnvPath(path, edit.Candidate.ElementType) && !opts.EnvDependencySort && envPolicy[path] == "" {
+				envPaths = append(envPaths, edit.Candidate.ValuesPath)
 			}
 		}
 
 		// Report changes with detailed info
-		fmt.Println("\nConverted values.yaml fields:")
+		fmt.Println("\n" + green("Converted values.yaml fields:"))
 		for _, edit := range edits {
 			// Build JSONPath for display
 			jsonPath := edit.Candidate.YAMLPath
@@ -155,8 +300,20 @@ func runConvert(opts ConvertOptions) error {
 
 			// Display detailed info
 			fmt.Printf("  %s:\n", edit.Candidate.ValuesPath)
+			if edit.Candidate.NewPath != "" {
+				fmt.Printf("    Moved to: %s\n", edit.Candidate.NewPath)
+			}
 			fmt.Printf("    JSONPath: %s\n", jsonPath)
-			fmt.Printf("    Key:      %s\n", edit.Candidate.MergeKey)
+			if edit.Candidate.Set {
+				fmt.Printf("    Set of:   %s\n", setMembers(edit.Candidate.MergeKey))
+			} else if edit.Candidate.KeyStrategy != "" {
+				fmt.Printf("    Keys:     %s (%s)\n", strings.Join(edit.Candidate.MergeKeys, ", "), edit.Candidate.KeyStrategy)
+			} else {
+				fmt.Printf("    Key:      %s\n", edit.Candidate.MergeKey)
+			}
+			if edit.Candidate.Shaped() {
+				fmt.Printf("    Shape:    %s\n", edit.Candidate.ShapeDescription())
+			}
 			if edit.Candidate.ElementType != "" {
 				fmt.Printf("    Type:     %s\n", edit.Candidate.ElementType)
 			}
@@ -169,78 +326,106 @@ func runConvert(opts ConvertOptions) error {
 				fmt.Printf("    Items:    %d\n", itemCount)
 			}
 
-			transformedPaths = append(transformedPaths, template.PathInfo{
-				DotPath:     edit.Candidate.ValuesPath,
-				MergeKey:    edit.Candidate.MergeKey,
-				SectionName: edit.Candidate.SectionName,
-			})
+			transformedPaths = append(transformedPaths, convertedPathInfo(edit.Candidate, envPolicy[edit.Candidate.ValuesPath], opts.EnvDependencySort))
 		}
 
-		// Warn about env var ordering if applicable
-		if hasEnvVars {
-			fmt.Println("\n  WARNING: Environment variables will be rendered in alphabetical order.")
-			fmt.Println("  If any env var uses $(OTHER_VAR) syntax to reference another env var,")
-			fmt.Println("  ensure the referenced var comes BEFORE it alphabetically, or the")
-			fmt.Println("  reference will fail. See 'helm list-to-map --help' for details.")
+		// Note the chart's existing maps the conversion matched
+		var lists []string
+		for _, edit := range edits {
+			lists = append(lists, edit.Candidate.ValuesPath)
 		}
-	} else {
+		if shapes := chartShapeConsistency(root, lists); shapes.hybrid() {
+			var maps []string
+			for _, m := range shapes.Maps {
+				maps = append(maps, m.Path)
+			}
+			fmt.Printf("\n  These match the paths the chart already kept as maps: %s\n", strings.Join(maps, ", "))
+		}
+
+		// Warn about env var references that break in alphabetical order
+		warnEnvOrder(valuesPath, "", opts.ValuesFiles, envPaths, "  ")
+	} else if len(examples) == 0 {
 		fmt.Println("No changes needed in values.yaml.")
 	}
+	printConvertedExamples(examples, "")
+
+	// Values converted earlier whose templates still render them as lists
+	if len(repaired) > 0 {
+		fmt.Println("\n" + green("Repaired templates (values already maps, templates still list-style):"))
+		for _, c := range repaired {
+			fmt.Printf("  %s (key=%s)%s\n", c.ValuesPath, c.MergeKey, renamedSuffix(c.NewPath))
+			transformedPaths = append(transformedPaths, convertedPathInfo(c, envPolicy[c.ValuesPath], opts.EnvDependencySort))
+		}
+	}
+
+	metrics.phase(phaseValues, valuesStart)
 
 	// Add template-only candidates to transformedPaths for template rewriting
 	if len(templateOnlyCandidates) > 0 {
-		fmt.Println("\nTemplate-only conversions (no values.yaml entry):")
+		fmt.Println("\n" + green("Template-only conversions (no values.yaml entry):"))
 		for _, c := range templateOnlyCandidates {
-			fmt.Printf("  %s (key=%s)\n", c.ValuesPath, c.MergeKey)
-			transformedPaths = append(transformedPaths, template.PathInfo{
-				DotPath:     c.ValuesPath,
-				MergeKey:    c.MergeKey,
-				SectionName: c.SectionName,
-			})
+			fmt.Printf("  %s (key=%s)%s\n", c.ValuesPath, c.MergeKey, renamedSuffix(c.NewPath))
+			transformedPaths = append(transformedPaths, convertedPathInfo(c, "", opts.EnvDependencySort))
 		}
 		fmt.Println("\n  NOTE: These templates will be updated to use map-style syntax.")
 		fmt.Println("  Please manually update any comments in values.yaml or documentation")
 		fmt.Println("  that describe these fields to use map format instead of list format.")
 	}
 
+	metrics.converted(len(transformedPaths))
+
+	templatesStart := time.Now()
 	var tchanges []string
 	var helperCreated bool
 	if !opts.DryRun {
 		var err error
-		tchanges, backupFiles, err = template.RewriteTemplatesWithBackups(pkgfs.OSFileSystem{}, root, transformedPaths, opts.BackupExt, backupFiles)
+		tchanges, backupFiles, err = template.RewriteTemplatesWithBackups(pkgfs.OSFileSystem{}, root, transformedPaths, topts, opts.BackupExt, backupFiles)
 		if err != nil {
 			return err
 		}
 
 		if len(tchanges) > 0 {
-			fmt.Println("\nUpdated templates:")
+			fmt.Println("\n" + green("Updated templates:"))
 			for _, ch := range tchanges {
 				fmt.Printf("  %s\n", ch)
+				summary.file(filepath.Join(root, ch))
 			}
 		}
 
-		helperCreated = template.EnsureHelpersWithReport(pkgfs.OSFileSystem{}, root)
+		helperCreated = template.EnsureHelpersWithReport(pkgfs.OSFileSystem{}, root, topts)
 		if helperCreated {
 			fmt.Println("\nCreated helper template:")
 			fmt.Printf("  templates/_listmap.tpl\n")
+			summary.file(filepath.Join(root, helperFile))
 		}
+		warnOutdatedHelper(root, transformedPaths, topts)
 	} else if len(transformedPaths) > 0 {
-		fmt.Println("\nTemplate changes (dry-run, not applied):")
-		for _, p := range transformedPaths {
-			fmt.Printf("  Would update templates using .Values.%s\n", p.DotPath)
+		if err := printTemplatePreview(root, transformedPaths, topts); err != nil {
+			return err
+		}
+	}
+	metrics.phase(phaseTemplates, templatesStart)
+
+	var fields []migrationField
+	for _, edit := range edits {
+		fields = append(fields, candidateMigrationField(edit.Candidate))
+	}
+	for _, c := range templateOnlyCandidates {
+		fields = append(fields, candidateMigrationField(c))
+	}
+
+	// Converted values are a breaking change, released under a new version
+	if opts.BumpVersion != "" && len(fields) > 0 {
+		if err := reportVersionBump(root, opts, fields, &backupFiles); err != nil {
+			return err
 		}
-		fmt.Println("  Would create templates/_listmap.tpl (if not exists)")
 	}
 
 	// Report backup files
 	if !opts.DryRun && len(backupFiles) > 0 {
 		fmt.Println("\nBackup files created:")
 		for _, bf := range backupFiles {
-			relPath, _ := filepath.Rel(root, bf)
-			if relPath == "" {
-				relPath = bf
-			}
-			fmt.Printf("  %s\n", relPath)
+			fmt.Printf("  %s\n", rel(root, bf))
 		}
 	}
 
@@ -248,29 +433,206 @@ func runConvert(opts ConvertOptions) error {
 		fmt.Println("Nothing to convert.")
 	}
 
-	return nil
+	if opts.DryRun {
+		return parseErrs.report()
+	}
+	if opts.HelmDocs && len(edits) > 0 {
+		runHelmDocs(root)
+	}
+
+	if err := writeMigrationFile(root, opts.MigrationFile, fields); err != nil {
+		return err
+	}
+	if opts.UnitTests {
+		if err := writeUnitTests(root, raw, edits); err != nil {
+			return fmt.Errorf("writing helm-unittest suite: %w", err)
+		}
+	}
+	if opts.Upgrading {
+		var converted []k8s.DetectedCandidate
+		for _, edit := range edits {
+			converted = append(converted, edit.Candidate)
+		}
+		converted = append(converted, templateOnlyCandidates...)
+		if err := writeUpgradingNotes(root, doc, converted, opts.MigrationFile); err != nil {
+			return fmt.Errorf("writing %s: %w", upgradingFile, err)
+		}
+	}
+	if err := rotateBackups(root, baseExt, opts.MaxBackups); err != nil {
+		return err
+	}
+	return parseErrs.report()
 }
 
-// convertSubchartAndTrack converts a subchart and returns the converted paths
-func convertSubchartAndTrack(subchartPath string, opts ConvertOptions) (*SubchartConversion, error) {
-	// Local variable to track converted paths
-	var transformedPaths []template.PathInfo
+// staleTemplatePaths returns the candidates whose values are already maps but
+// whose templates still render them as lists (e.g., a template reverted by a
+// bad merge after an earlier conversion). Only the templates need fixing.
+// Config data lists are left out: nothing but their default value says they
+// are lists, so a map there is just a map.
+func staleTemplatePaths(doc *yaml.Node, candidates map[string]k8s.DetectedCandidate) []k8s.DetectedCandidate {
+	if doc == nil || len(doc.Content) == 0 {
+		return nil
+	}
+	var stale []k8s.DetectedCandidate
+	for path, c := range candidates {
+		if c.ConfigData {
+			continue
+		}
+		if v := nodeAt(doc.Content[0], strings.Split(path, ".")...); v != nil && v.Kind == yaml.MappingNode {
+			stale = append(stale, c)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool {
+		return stale[i].ValuesPath < stale[j].ValuesPath
+	})
+	return stale
+}
+
+// warnOutdatedHelper warns when templates now call a helper variant (env
+// ordering or JSON) but the chart's existing helper predates it
+func warnOutdatedHelper(root string, paths []template.PathInfo, o template.Options) {
+	variant := false
+	for _, p := range paths {
+		variant = variant || p.Ordered || p.OrderField
+	}
+	if !variant && !templatesInclude(root, o.JSONHelperName()) {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(root, helperFile))
+	if err != nil || template.ParseHelperVersion(string(data)) >= template.HelperVersion {
+		return
+	}
+	warnf("%s predates the helper variants these templates use; run 'helm list-to-map upgrade-helpers --chart %s'", helperFile, root)
+}
+
+// templatesInclude reports whether any chart template includes the named define
+func templatesInclude(root, name string) bool {
+	call := fmt.Sprintf("include %q", name)
+	found := false
+	_ = pkgfs.WalkTemplates(pkgfs.OSFileSystem{}, root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || found {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err == nil && strings.Contains(string(data), call) {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found
+}
+
+// runHelmDocs regenerates the chart README with helm-docs, if it is installed
+func runHelmDocs(root string) {
+	bin, err := exec.LookPath("helm-docs")
+	if err != nil {
+		warnf("--helm-docs: helm-docs not found in PATH, README not regenerated")
+		return
+	}
+	if out, err := exec.Command(bin, "--chart-search-root", root).CombinedOutput(); err != nil {
+		warnf("helm-docs failed: %v", err)
+		fmt.Fprintf(os.Stderr, "%s", out)
+		return
+	}
+	fmt.Println("\nRegenerated chart documentation with helm-docs.")
+}
 
-	// Load CRDs from plugin config directory
-	if err := loadCRDsFromConfig(); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: loading CRDs: %v\n", err)
+// printValuesDiff prints each values edit in the named file as a diff hunk
+func printValuesDiff(name string, raw []byte, edits []transform.ArrayEdit) {
+	lines := strings.Split(string(raw), "\n")
+	for _, e := range edits {
+		before := lines[e.KeyLine-1 : e.ValueEndLine]
+		fmt.Println(cyan(fmt.Sprintf("@@ %s:%d %s @@", name, e.KeyLine, e.Candidate.ValuesPath)))
+		printDiff(diffLines(before, previewEdit(before, e)))
+	}
+}
+
+// convertValuesComments applies edits to raw and, when enabled, rewrites the
+// commented-out examples of the candidates that are maps once the edits are
+// applied: the lists the edits convert, and paths that are already maps or
+// aren't set. The examples below converted keys are kept to be rewritten.
+func convertValuesComments(doc *yaml.Node, raw []byte, edits []transform.ArrayEdit, candidates []k8s.DetectedCandidate, enabled bool) ([]byte, []string) {
+	if !enabled {
+		return transform.ApplyLineEdits(raw, edits), nil
+	}
+	maps := make(map[string]k8s.DetectedCandidate)
+	for _, c := range candidates {
+		var v *yaml.Node
+		if len(doc.Content) > 0 {
+			v = nodeAt(doc.Content[0], strings.Split(c.ValuesPath, ".")...)
+		}
+		if v == nil || v.Kind != yaml.SequenceNode {
+			maps[c.ValuesPath] = c
+		}
+	}
+	for i := range edits {
+		edits[i].KeepExamples = true
+		maps[edits[i].Candidate.ValuesPath] = edits[i].Candidate
+	}
+	return transform.ConvertCommentedExamples(transform.ApplyLineEdits(raw, edits), maps)
+}
+
+// printConvertedExamples lists the paths whose commented-out examples in
+// values.yaml were rewritten to map syntax
+func printConvertedExamples(paths []string, indent string) {
+	if len(paths) == 0 {
+		return
+	}
+	fmt.Println("\n" + indent + green("Converted commented-out examples in values.yaml:"))
+	for _, p := range paths {
+		fmt.Printf("%s  %s\n", indent, p)
+	}
+}
+
+// printTemplatePreview prints the template rewrites for paths as diff hunks
+// without writing any files
+func printTemplatePreview(root string, paths []template.PathInfo, o template.Options) error {
+	rewrites, err := template.PreviewTemplateRewrites(pkgfs.OSFileSystem{}, root, paths, o)
+	if err != nil {
+		return err
+	}
+	for _, r := range rewrites {
+		printFileDiff(r.Path, r.Original, r.Updated)
+		summary.file(filepath.Join(root, r.Path))
 	}
+	if _, err := os.Stat(filepath.Join(root, helperFile)); os.IsNotExist(err) {
+		fmt.Printf("\nWould create %s\n", helperFile)
+		summary.file(filepath.Join(root, helperFile))
+	}
+	return nil
+}
+
+// convertCandidates holds the outcome of candidate collection for conversion
+type convertCandidates struct {
+	Matched       []k8s.DetectedCandidate     // Candidates rendered by a supported template pattern
+	Skipped       []string                    // Values paths with unsupported template patterns
+	Ignored       []string                    // Values paths excluded by ignore config or opt-out comments
+	BelowMinItems []string                    // Values paths with fewer items than minItems
+	Ask           []k8s.DetectedCandidate     // Matched candidates whose typePolicy asks for confirmation
+	Conflicts     []k8s.ConsumerConflict      // Values paths rendered into fields that disagree on conversion
+	ParseErrors   []*parser.FileError         // Templates that couldn't be read, left out of detection
+	Unhandled     []template.UnhandledDictArg // Include arguments keeping named templates from being rewritten
+}
 
+// collectConvertCandidates detects conversion candidates (K8s types, CRDs, and user rules)
+// and splits them by whether a supported template pattern renders them.
+func collectConvertCandidates(root string) (*convertCandidates, error) {
 	// Use programmatic detection via K8s API introspection
-	candidates, err := k8s.DetectConversionCandidates(subchartPath)
+	candidates, conflicts, parseErrs, err := k8s.DetectConversionCandidates(root)
 	if err != nil {
-		return nil, fmt.Errorf("detecting candidates: %w", err)
+		return nil, err
 	}
 
 	// Also check for user-defined rules (for CRDs)
-	userDetected := scanForUserRules(subchartPath)
+	userDetected := scanForUserRules(root)
 	candidates = append(candidates, userDetected...)
 
+	// Ignore rules take precedence over auto-detection and user rules
+	result := &convertCandidates{ParseErrors: parseErrs, Conflicts: withoutRuledConflicts(conflicts, userDetected)}
+	candidates, result.Ignored = filterIgnoredCandidates(root, candidates)
+	candidates, result.BelowMinItems = filterMinItems(root, candidates)
+
 	// Build PathInfo list and check which paths have matching template patterns
 	var pathInfos []template.PathInfo
 	for _, c := range candidates {
@@ -278,68 +640,206 @@ func convertSubchartAndTrack(subchartPath string, opts ConvertOptions) (*Subchar
 			DotPath:     c.ValuesPath,
 			MergeKey:    c.MergeKey,
 			SectionName: c.SectionName,
+			Set:         c.Set,
+			MergeKeys:   c.MergeKeys,
+			KeyStrategy: c.KeyStrategy,
+			Rename:      c.Rename,
+			Scalar:      c.Scalar,
+			Synthetic:   c.Synthetic,
 		})
 	}
 
 	// Check template patterns BEFORE converting values
-	matchedPaths := template.CheckTemplatePatterns(subchartPath, pathInfos)
+	// Only convert values for paths where template patterns actually match
+	matchedPaths := template.CheckTemplatePatterns(root, pathInfos)
+	result.Unhandled = template.UnhandledDictArgs(root, pathInfos)
 
-	// Filter candidates to only include paths with matching template patterns
-	candidateMap := make(map[string]k8s.DetectedCandidate)
+	// Later entries (user rules) replace earlier ones for the same path
+	index := make(map[string]int)
+	for _, c := range candidates {
+		if !matchedPaths[c.ValuesPath] {
+			result.Skipped = append(result.Skipped, c.ValuesPath)
+			continue
+		}
+		if i, ok := index[c.ValuesPath]; ok {
+			result.Matched[i] = c
+			continue
+		}
+		index[c.ValuesPath] = len(result.Matched)
+		result.Matched = append(result.Matched, c)
+	}
+	result.Matched, result.Ask = filterAskCandidates(result.Matched)
+	return result, nil
+}
+
+// filterCandidatesByPath keeps only candidates whose values path is in paths
+func filterCandidatesByPath(candidates []k8s.DetectedCandidate, paths []string) []k8s.DetectedCandidate {
+	keep := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		keep[p] = true
+	}
+	var result []k8s.DetectedCandidate
 	for _, c := range candidates {
-		if matchedPaths[c.ValuesPath] {
-			candidateMap[c.ValuesPath] = c
+		if keep[c.ValuesPath] {
+			result = append(result, c)
 		}
 	}
+	return result
+}
+
+// convertSubchartAndTrack converts a subchart and returns the converted paths.
+// overrides are the values files merged over the subchart's defaults, holding
+// its values under scope, for the env order check.
+func convertSubchartAndTrack(subchartPath string, opts ConvertOptions, scope string, overrides []string) (*SubchartConversion, error) {
+	// Local variable to track converted paths
+	var transformedPaths []template.PathInfo
+
+	// Apply the subchart's own config over the current config
+	restore, err := useChartConfig(subchartPath)
+	defer restore()
+	if err != nil {
+		return nil, err
+	}
+	if err := validateEnvOrdering(); err != nil {
+		return nil, err
+	}
+	if err := validateTypePolicy(); err != nil {
+		return nil, err
+	}
+	if err := validateRules(); err != nil {
+		return nil, err
+	}
+	if err := validateRenamePaths(); err != nil {
+		return nil, err
+	}
+	if err := validateReferenceFiles(); err != nil {
+		return nil, err
+	}
+	topts, err := templateOptions(subchartPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := template.CheckHelperCollisions(pkgfs.OSFileSystem{}, subchartPath, topts); err != nil {
+		return nil, err
+	}
+
+	// The subchart's config may set its own schema source; --schema still wins
+	restoreSchema, err := useSchemas(opts.SchemaSource, false)
+	defer restoreSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	// Detect candidates and keep only paths with matching template patterns
+	detectStart := time.Now()
+	collected, err := collectConvertCandidates(subchartPath)
+	if err != nil {
+		return nil, fmt.Errorf("detecting candidates: %w", err)
+	}
+	metrics.phase(phaseDetect, detectStart)
+	recordSkipped(collected, false)
+	collected.Matched = withRenamedPaths(collected.Matched)
+	candidateMap := make(map[string]k8s.DetectedCandidate)
+	for _, c := range collected.Matched {
+		candidateMap[c.ValuesPath] = c
+	}
 
+	valuesStart := time.Now()
 	valuesPath := filepath.Join(subchartPath, "values.yaml")
+	envPolicy := planEnvOrdering(valuesPath, scope, overrides, candidateMap, "  ")
+
 	doc, raw, err := loadValuesNode(valuesPath)
 	if err != nil {
 		return nil, fmt.Errorf("loading values.yaml: %w", err)
 	}
+	unshared := len(candidateMap)
+	candidateMap, merged := withoutMergedLists(doc, candidateMap)
+	printMergedLists(os.Stdout, merged, "  ")
+	metrics.skipped(skipShared, unshared-len(candidateMap))
 
-	// Use line-based editing to preserve original formatting
+	// Use line-based editing to preserve original formatting. The chart's own
+	// defaults are converted, so null lists become {} too.
 	var edits []transform.ArrayEdit
-	transform.FindArrayEdits(doc, nil, candidateMap, &edits)
-
-	if len(edits) > 0 {
-		out := transform.ApplyLineEdits(raw, edits)
+	transform.FindArrayEditsWithOptions(doc, nil, candidateMap, transform.EditOptions{NullAsEmpty: true}, &edits)
+	applyOrderFields(edits, envPolicy)
+	printRepeatedSetValues(os.Stdout, edits, "  ")
+	out, examples := convertValuesComments(doc, raw, edits, collected.Matched, opts.ConvertComments)
+
+	// Renamed lists move along with their conversion, or not at all
+	repaired := staleTemplatePaths(doc, candidateMap)
+	var converted []k8s.DetectedCandidate
+	for _, edit := range edits {
+		converted = append(converted, edit.Candidate)
+	}
+	converted = append(converted, repaired...)
+	out, moved, err := moveRenamedValues(out, converted)
+	if err != nil {
+		return nil, err
+	}
+	warnUnrenamed(doc, converted)
+	var referenced []template.PathInfo
+	for _, c := range converted {
+		referenced = append(referenced, convertedPathInfo(c, envPolicy[c.ValuesPath], opts.EnvDependencySort))
+	}
+	warnExternalReferences(subchartPath, referenced)
 
-		if !opts.DryRun {
+	if len(edits) > 0 || len(examples) > 0 || moved {
+		summary.file(valuesPath)
+		if opts.DryRun {
+			fmt.Println("  --- values.yaml (dry-run diff) ---")
+			if len(examples) > 0 || moved {
+				printHunks("values.yaml", string(raw), string(out))
+			} else {
+				printValuesDiff("values.yaml", raw, edits)
+			}
+		} else {
 			backupPath := valuesPath + opts.BackupExt
 			if err := backupFile(valuesPath, opts.BackupExt, raw); err != nil {
 				return nil, fmt.Errorf("backing up values.yaml: %w", err)
 			}
-			fmt.Printf("    Backup: %s\n", backupPath)
-			if err := os.WriteFile(valuesPath, out, 0644); err != nil {
+			fmt.Printf("    Backup: %s\n", shownPath(opts, backupPath))
+			if err := rewriteFile(valuesPath, out); err != nil {
 				return nil, fmt.Errorf("writing values.yaml: %w", err)
 			}
 		}
 
 		// Track converted paths
 		for _, edit := range edits {
-			transformedPaths = append(transformedPaths, template.PathInfo{
-				DotPath:     edit.Candidate.ValuesPath,
-				MergeKey:    edit.Candidate.MergeKey,
-				SectionName: edit.Candidate.SectionName,
-			})
+			transformedPaths = append(transformedPaths, convertedPathInfo(edit.Candidate, envPolicy[edit.Candidate.ValuesPath], opts.EnvDependencySort))
+		}
+	}
+	printConvertedExamples(examples, "  ")
+
+	for _, c := range repaired {
+		fmt.Printf("    Repairing template: %s (values already a map)\n", c.ValuesPath)
+		transformedPaths = append(transformedPaths, convertedPathInfo(c, envPolicy[c.ValuesPath], opts.EnvDependencySort))
+	}
+	metrics.phase(phaseValues, valuesStart)
+	defer metrics.phase(phaseTemplates, time.Now())
+
+	if opts.DryRun && len(transformedPaths) > 0 {
+		if err := printTemplatePreview(subchartPath, transformedPaths, topts); err != nil {
+			return nil, fmt.Errorf("previewing templates: %w", err)
 		}
 	}
 
 	// Rewrite templates
 	if !opts.DryRun && len(transformedPaths) > 0 {
-		tchanges, _, err := template.RewriteTemplatesWithBackups(pkgfs.OSFileSystem{}, subchartPath, transformedPaths, opts.BackupExt, nil)
+		tchanges, _, err := template.RewriteTemplatesWithBackups(pkgfs.OSFileSystem{}, subchartPath, transformedPaths, topts, opts.BackupExt, nil)
 		if err != nil {
 			return nil, fmt.Errorf("rewriting templates: %w", err)
 		}
 		for _, ch := range tchanges {
 			fmt.Printf("    Updated template: %s\n", ch)
+			summary.file(filepath.Join(subchartPath, ch))
 		}
 
 		// Create helper template
-		if template.EnsureHelpersWithReport(pkgfs.OSFileSystem{}, subchartPath) {
+		if template.EnsureHelpersWithReport(pkgfs.OSFileSystem{}, subchartPath, topts) {
 			fmt.Printf("    Created: templates/_listmap.tpl\n")
+			summary.file(filepath.Join(subchartPath, helperFile))
 		}
+		warnOutdatedHelper(subchartPath, transformedPaths, topts)
 	}
 
 	// Return conversion info
@@ -347,12 +847,14 @@ func convertSubchartAndTrack(subchartPath string, opts ConvertOptions) (*Subchar
 	return &SubchartConversion{
 		Name:           chartName,
 		ConvertedPaths: transformedPaths,
+		ParseErrors:    collected.ParseErrors,
 	}, nil
 }
 
 // updateUmbrellaValues updates the umbrella chart's values.yaml to convert arrays to maps
 // for paths that were converted in subcharts
 func updateUmbrellaValues(umbrellaRoot string, conversions []SubchartConversion, opts ConvertOptions) error {
+	defer metrics.phase(phaseValues, time.Now())
 	valuesPath := filepath.Join(umbrellaRoot, "values.yaml")
 	doc, raw, err := loadValuesNode(valuesPath)
 	if err != nil {
@@ -366,6 +868,9 @@ func updateUmbrellaValues(umbrellaRoot string, conversions []SubchartConversion,
 		for _, p := range conv.ConvertedPaths {
 			// Prefix with subchart name
 			prefixedPath := conv.Name + "." + p.DotPath
+			if p.NewPath != "" {
+				p.NewPath = conv.Name + "." + p.NewPath
+			}
 			subchartPaths[prefixedPath] = p
 		}
 	}
@@ -377,41 +882,66 @@ func updateUmbrellaValues(umbrellaRoot string, conversions []SubchartConversion,
 			ValuesPath:  path,
 			MergeKey:    info.MergeKey,
 			SectionName: info.SectionName,
+			MergeKeys:   info.MergeKeys,
+			KeyStrategy: info.KeyStrategy,
+			Rename:      info.Rename,
+			Scalar:      info.Scalar,
+			Synthetic:   info.Synthetic,
+			NewPath:     info.NewPath,
 		}
 	}
 
+	candidateMap, merged := withoutMergedLists(doc, candidateMap)
+	printMergedLists(os.Stdout, merged, "")
+
 	// Find array edits in umbrella values
 	var edits []transform.ArrayEdit
 	transform.FindArrayEdits(doc, nil, candidateMap, &edits)
+	printRepeatedSetValues(os.Stdout, edits, "")
+	candidates := make([]k8s.DetectedCandidate, 0, len(candidateMap))
+	for _, c := range candidateMap {
+		candidates = append(candidates, c)
+	}
+	sortCandidates(candidates)
+	out, examples := convertValuesComments(doc, raw, edits, candidates, opts.ConvertComments)
+	var converted []k8s.DetectedCandidate
+	for _, edit := range edits {
+		converted = append(converted, edit.Candidate)
+	}
+	out, moved, err := moveRenamedValues(out, converted)
+	if err != nil {
+		return err
+	}
 
-	if len(edits) == 0 {
+	if len(edits) == 0 && len(examples) == 0 {
 		fmt.Println("\nNo umbrella values.yaml updates needed.")
 		return nil
 	}
-
-	// Apply edits
-	out := transform.ApplyLineEdits(raw, edits)
+	summary.file(valuesPath)
 
 	if opts.DryRun {
-		fmt.Println("\n=== Umbrella values.yaml updates (dry-run) ===")
-		for _, edit := range edits {
-			fmt.Printf("  Would convert: %s\n", edit.Candidate.ValuesPath)
+		fmt.Println("\n=== Umbrella values.yaml updates (dry-run diff) ===")
+		if len(examples) > 0 || moved {
+			printHunks("values.yaml", string(raw), string(out))
+		} else {
+			printValuesDiff("values.yaml", raw, edits)
 		}
 	} else {
 		backupPath := valuesPath + opts.BackupExt
 		if err := backupFile(valuesPath, opts.BackupExt, raw); err != nil {
 			return fmt.Errorf("backing up umbrella values.yaml: %w", err)
 		}
-		if err := os.WriteFile(valuesPath, out, 0644); err != nil {
+		if err := rewriteFile(valuesPath, out); err != nil {
 			return fmt.Errorf("writing umbrella values.yaml: %w", err)
 		}
 
 		fmt.Println("\nUpdated umbrella values.yaml:")
-		fmt.Printf("  Backup: %s\n", backupPath)
+		fmt.Printf("  Backup: %s\n", shownPath(opts, backupPath))
 		for _, edit := range edits {
-			fmt.Printf("  Converted: %s (key=%s)\n", edit.Candidate.ValuesPath, edit.Candidate.MergeKey)
+			fmt.Printf("  Converted: %s (key=%s)%s\n", edit.Candidate.ValuesPath, edit.Candidate.MergeKey, renamedSuffix(edit.Candidate.NewPath))
 		}
 	}
+	printConvertedExamples(examples, "")
 
 	return nil
 }
@@ -419,10 +949,20 @@ func updateUmbrellaValues(umbrellaRoot string, conversions []SubchartConversion,
 // runRecursiveConvert handles the --recursive flag for umbrella charts
 // It converts all file:// subcharts and then updates the umbrella values.yaml
 func runRecursiveConvert(umbrellaRoot string, opts ConvertOptions) error {
-	fmt.Printf("Subchart conversion for umbrella chart: %s\n", umbrellaRoot)
+	fmt.Printf("Subchart conversion for umbrella chart: %s\n", shownPath(opts, umbrellaRoot))
 
 	// Collect subcharts based on flags
-	subcharts, err := collectSubcharts(umbrellaRoot, opts.Recursive, opts.IncludeChartsDir, opts.ExpandRemote)
+	// A dry run previews remote dependencies from copies, keeping charts/ as is
+	extractTo := ""
+	if opts.DryRun && opts.ExpandRemote {
+		tmp, err := os.MkdirTemp("", "helm-list-to-map-")
+		if err != nil {
+			return fmt.Errorf("creating preview directory: %w", err)
+		}
+		defer func() { _ = os.RemoveAll(tmp) }()
+		extractTo = tmp
+	}
+	subcharts, err := collectSubcharts(umbrellaRoot, opts.Recursive, opts.IncludeChartsDir, opts.ExpandRemote, extractTo)
 	if err != nil {
 		return fmt.Errorf("collecting subcharts: %w", err)
 	}
@@ -437,33 +977,47 @@ func runRecursiveConvert(umbrellaRoot string, opts ConvertOptions) error {
 
 	fmt.Printf("\nFound %d subchart(s):\n", len(subcharts))
 	for _, sub := range subcharts {
-		fmt.Printf("  - %s [%s]\n", sub.Name, sub.Source)
+		fmt.Printf("  - %s\n", sub.label())
 	}
 
 	// Convert each subchart
 	var conversions []SubchartConversion
+	var convertedCharts, totalPaths int
 	var expandedCharts []SubchartInfo
+	var parseErrs parseErrors
 
 	for _, sub := range subcharts {
 		// Check if subchart exists
 		if _, err := os.Stat(filepath.Join(sub.Path, "Chart.yaml")); err != nil {
-			fmt.Fprintf(os.Stderr, "\nWarning: Subchart %s not found at %s, skipping\n", sub.Name, sub.Path)
+			warnf("Subchart %s not found at %s, skipping", sub.Name, shownPath(opts, sub.Path))
 			continue
 		}
 
 		fmt.Printf("\n=== Converting subchart: %s [%s] ===\n", sub.Name, sub.Source)
-		fmt.Printf("  Path: %s\n", sub.Path)
+		metrics.chart()
+		fmt.Printf("  Path: %s\n", shownPath(opts, sub.Path))
 
 		// Track expanded charts for warning
 		if sub.WasExpanded {
 			expandedCharts = append(expandedCharts, sub)
 		}
 
-		conv, err := convertSubchartAndTrack(sub.Path, opts)
+		// The umbrella values and -f files override the subchart's defaults
+		overrides := append([]string{filepath.Join(umbrellaRoot, "values.yaml")}, opts.ValuesFiles...)
+		conv, err := convertSubchartAndTrack(sub.Path, opts, sub.Name, overrides)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "  Error: %v\n", err)
+			metrics.failed()
+			if parseErrs.add(err) {
+				fmt.Fprintf(os.Stderr, "  Skipped: %v\n", err)
+			} else {
+				fmt.Fprintf(os.Stderr, "  Error: %v\n", err)
+			}
 			continue
 		}
+		for _, fe := range conv.ParseErrors {
+			parseErrs.add(fe)
+		}
+		metrics.converted(len(conv.ConvertedPaths))
 
 		// Update conversion record with subchart name
 		conv.Name = sub.Name
@@ -471,11 +1025,29 @@ func runRecursiveConvert(umbrellaRoot string, opts ConvertOptions) error {
 		if len(conv.ConvertedPaths) == 0 {
 			fmt.Println("  No conversions needed")
 		} else {
-			fmt.Printf("  Converted %d path(s):\n", len(conv.ConvertedPaths))
+			if opts.DryRun {
+				fmt.Printf("  Would convert %d path(s):\n", len(conv.ConvertedPaths))
+			} else {
+				fmt.Printf("  Converted %d path(s):\n", len(conv.ConvertedPaths))
+			}
+			var envPaths []string
 			for _, p := range conv.ConvertedPaths {
-				fmt.Printf("    - %s (key=%s)\n", p.DotPath, p.MergeKey)
+				fmt.Printf("    - %s (key=%s)%s\n", p.DotPath, p.MergeKey, renamedSuffix(p.NewPath))
+				if isEnvPath(p.DotPath, "") && !p.Ordered && !p.OrderField {
+					envPaths = append(envPaths, p.DotPath)
+				}
 			}
 			conversions = append(conversions, *conv)
+			convertedCharts++
+			totalPaths += len(conv.ConvertedPaths)
+			// The umbrella holds the chart's values under each of its names
+			for _, alias := range sub.Aliases {
+				aliased := *conv
+				aliased.Name = alias
+				conversions = append(conversions, aliased)
+			}
+
+			warnEnvOrder(filepath.Join(sub.Path, "values.yaml"), sub.Name, overrides, envPaths, "  ")
 		}
 	}
 
@@ -487,8 +1059,12 @@ func runRecursiveConvert(umbrellaRoot string, opts ConvertOptions) error {
 	// Update umbrella values.yaml with converted subchart paths
 	if len(conversions) > 0 {
 		fmt.Printf("\n=== Updating umbrella values.yaml ===\n")
+		metrics.chart()
 		if err := updateUmbrellaValues(umbrellaRoot, conversions, opts); err != nil {
-			return err
+			metrics.failed()
+			if !parseErrs.add(err) {
+				return err
+			}
 		}
 	} else {
 		fmt.Println("\nNo subcharts were converted, umbrella values.yaml unchanged.")
@@ -496,16 +1072,48 @@ func runRecursiveConvert(umbrellaRoot string, opts ConvertOptions) error {
 
 	// Summary
 	fmt.Println("\n=== Conversion Summary ===")
-	totalPaths := 0
-	for _, conv := range conversions {
-		totalPaths += len(conv.ConvertedPaths)
+	if opts.DryRun {
+		fmt.Printf("Subcharts that would be converted: %d\n", convertedCharts)
+		fmt.Printf("Total paths that would be converted: %d\n", totalPaths)
+	} else {
+		fmt.Printf("Subcharts converted: %d\n", convertedCharts)
+		fmt.Printf("Total paths converted: %d\n", totalPaths)
 	}
-	fmt.Printf("Subcharts converted: %d\n", len(conversions))
-	fmt.Printf("Total paths converted: %d\n", totalPaths)
 
-	if !opts.DryRun {
+	var fields []migrationField
+	for _, conv := range conversions {
+		for _, p := range conv.ConvertedPaths {
+			f := newMigrationField(conv.Name+"."+p.DotPath, p.MergeKey, "")
+			if p.NewPath != "" {
+				f.New.Path = conv.Name + "." + p.NewPath
+			}
+			fields = append(fields, f)
+		}
+	}
+	if opts.DryRun {
+		if opts.BumpVersion != "" && len(fields) > 0 {
+			if err := reportVersionBump(umbrellaRoot, opts, fields, nil); err != nil {
+				return err
+			}
+		}
+		if opts.MigrationFile != "" && len(fields) > 0 {
+			fmt.Printf("Would write %s (%d field(s))\n", opts.MigrationFile, len(fields))
+		}
+	} else {
+		if opts.BumpVersion != "" && len(fields) > 0 {
+			var backupFiles []string
+			if err := reportVersionBump(umbrellaRoot, opts, fields, &backupFiles); err != nil {
+				return err
+			}
+			for _, bf := range backupFiles {
+				fmt.Printf("  Backup: %s\n", shownPath(opts, bf))
+			}
+		}
+		if err := writeMigrationFile(umbrellaRoot, opts.MigrationFile, fields); err != nil {
+			return err
+		}
 		fmt.Println("\nNote: Run 'helm dependency build' to rebuild chart dependencies.")
 	}
 
-	return nil
+	return parseErrs.report()
 }
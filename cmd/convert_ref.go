@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// runConvertChartRef pulls a chart reference with helm into opts.OutputDir
+// (default: ./<chart name>) and converts it there. With --dry-run the chart is
+// pulled to a temporary directory and removed after the preview.
+func runConvertChartRef(opts ConvertOptions) error {
+	ref := opts.ChartRef
+	if opts.ChartDir != "." {
+		return fmt.Errorf("a chart reference cannot be combined with --chart")
+	}
+	if _, err := os.Stat(ref); err == nil {
+		return fmt.Errorf("%s is a local path: use --chart to convert it in place", ref)
+	}
+	opts.ChartRef = ""
+
+	if opts.DryRun {
+		root, cleanup, err := resolveChartRef(ref, opts.Version)
+		defer cleanup()
+		if err != nil {
+			return err
+		}
+		opts.ChartDir = root
+		return runConvert(opts)
+	}
+
+	// Pull next to the output directory so the chart can be moved into place
+	dest := opts.OutputDir
+	parent := "."
+	if dest != "" {
+		if err := checkOutputDir(dest); err != nil {
+			return err
+		}
+		parent = filepath.Dir(dest)
+		if err := os.MkdirAll(parent, 0755); err != nil {
+			return fmt.Errorf("creating %s: %w", parent, err)
+		}
+	}
+	tmp, err := os.MkdirTemp(parent, ".list-to-map-pull-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+
+	root, err := pullChart(ref, opts.Version, tmp)
+	if err != nil {
+		return err
+	}
+	if dest == "" {
+		dest = filepath.Base(root)
+		if err := checkOutputDir(dest); err != nil {
+			return err
+		}
+	}
+	// An empty output directory is replaced
+	_ = os.Remove(dest)
+	if err := os.Rename(root, dest); err != nil {
+		return fmt.Errorf("moving chart to %s: %w", dest, err)
+	}
+
+	if version := chartVersion(dest); version != "" {
+		fmt.Printf("Pulled %s %s into %s\n\n", ref, version, dest)
+	} else {
+		fmt.Printf("Pulled %s into %s\n\n", ref, dest)
+	}
+
+	opts.ChartDir = dest
+	summary.at(dest)
+	return runConvert(opts)
+}
+
+// checkOutputDir returns an error if dir exists and isn't an empty directory
+func checkOutputDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("output directory %s: %w", dir, err)
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("output directory %s already exists and is not empty", dir)
+	}
+	return nil
+}
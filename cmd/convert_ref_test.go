@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+// fakeHelmPull installs a helm stand-in whose pull untars the basic chart
+func fakeHelmPull(t *testing.T) string {
+	t.Helper()
+	src, err := filepath.Abs(filepath.Join("testdata", "charts", "basic"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	// helm pull <ref> --untar --untardir <dir> [--version <version>]
+	script := "#!/bin/sh\necho \"$@\" > " + argsFile + "\ncp -r " + src + " \"$5/basic\"\n"
+	bin := filepath.Join(dir, "helm")
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HELM_BIN", bin)
+	return argsFile
+}
+
+func TestConvertChartRef(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	argsFile := fakeHelmPull(t)
+
+	outputDir := filepath.Join(t.TempDir(), "forked")
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{
+			ChartDir:  ".",
+			ChartRef:  "example/basic",
+			Version:   "1.2.3",
+			OutputDir: outputDir,
+			BackupExt: ".bak",
+		})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(args), "pull example/basic --untar") || !strings.Contains(string(args), "--version 1.2.3") {
+		t.Errorf("unexpected helm arguments: %s", args)
+	}
+	if !strings.Contains(output, "Pulled example/basic 0.1.0 into "+outputDir) {
+		t.Errorf("output should report the pulled chart, got:\n%s", output)
+	}
+	values, err := os.ReadFile(filepath.Join(outputDir, "values.yaml"))
+	if err != nil {
+		t.Fatalf("expected the chart in the output directory: %v", err)
+	}
+	if !strings.Contains(string(values), "DB_HOST:") {
+		t.Errorf("pulled chart should be converted, got values:\n%s", values)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(outputDir), ".list-to-map-pull-*"))
+	if len(leftovers) > 0 {
+		t.Errorf("temporary pull directories should be removed: %v", leftovers)
+	}
+}
+
+func TestConvertChartRefDefaultOutputDir(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	fakeHelmPull(t)
+	t.Chdir(t.TempDir())
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: ".", ChartRef: "example/basic", BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+	if _, err := os.Stat(filepath.Join("basic", "Chart.yaml")); err != nil {
+		t.Errorf("chart should be pulled into a directory named after it: %v", err)
+	}
+
+	// The pulled chart is now in the way
+	_, err = captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: ".", ChartRef: "example/basic", BackupExt: ".bak"})
+	})
+	if err == nil || !strings.Contains(err.Error(), "already exists and is not empty") {
+		t.Errorf("expected an error for an existing output directory, got %v", err)
+	}
+}
+
+func TestConvertChartRefErrors(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	fakeHelmPull(t)
+
+	outputDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outputDir, "keep.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runConvert(ConvertOptions{ChartDir: ".", ChartRef: "example/basic", OutputDir: outputDir}); err == nil || !strings.Contains(err.Error(), "not empty") {
+		t.Errorf("expected an error for a non-empty output directory, got %v", err)
+	}
+	if err := runConvert(ConvertOptions{ChartDir: "./chart", ChartRef: "example/basic"}); err == nil || !strings.Contains(err.Error(), "--chart") {
+		t.Errorf("expected an error combining a reference with --chart, got %v", err)
+	}
+	if err := runConvert(ConvertOptions{ChartDir: ".", ChartRef: outputDir}); err == nil || !strings.Contains(err.Error(), "local path") {
+		t.Errorf("expected an error for a local path, got %v", err)
+	}
+}
+
+func TestConvertChartRefDryRun(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	fakeHelmPull(t)
+
+	outputDir := filepath.Join(t.TempDir(), "forked")
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: ".", ChartRef: "example/basic", OutputDir: outputDir, DryRun: true})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "env") {
+		t.Errorf("dry run should preview the conversion, got:\n%s", output)
+	}
+	if _, err := os.Stat(outputDir); !os.IsNotExist(err) {
+		t.Error("dry run should not create the output directory")
+	}
+}
+
+// TestConvertChartRefWithoutHelm tests the error when the helm binary can't
+// be found to pull the chart
+func TestConvertChartRefWithoutHelm(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	t.Setenv("HELM_BIN", filepath.Join(t.TempDir(), "helm"))
+
+	_, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{
+			ChartDir:  ".",
+			ChartRef:  "example/basic",
+			OutputDir: filepath.Join(t.TempDir(), "forked"),
+			BackupExt: ".bak",
+		})
+	})
+	if err == nil || !strings.Contains(err.Error(), "pulling chart example/basic: helm binary") {
+		t.Errorf("runConvert() error = %v, want helm not found", err)
+	}
+}
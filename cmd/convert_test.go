@@ -1,12 +1,17 @@
 package main
 
 import (
+	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"gopkg.in/yaml.v3"
 )
 
 // copyChartForTest copies a chart to a temp directory for testing
@@ -37,6 +42,21 @@ func copyChartForTest(t *testing.T, srcChart string) string {
 	return dst
 }
 
+// writeChartFiles writes files, keyed by their path relative to root, creating
+// the directories they're in
+func writeChartFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 // TestConvertDryRun tests convert --dry-run functionality
 func TestConvertDryRun(t *testing.T) {
 	testutil.SetupTestEnv(t)
@@ -68,6 +88,18 @@ func TestConvertDryRun(t *testing.T) {
 	if !strings.Contains(string(valuesData), "- name: DB_HOST") {
 		t.Error("values.yaml should NOT be modified in dry-run mode")
 	}
+
+	// Dry run should preview the exact template rewrites
+	if !strings.Contains(output, "=== templates/deployment.yaml (dry-run diff) ===") {
+		t.Errorf("Expected template diff header in output\nGot:\n%s", output)
+	}
+	if !strings.Contains(output, `+            {{- include "chart.listmap.items" (dict "items" (index .Values "env") "key" "name") | nindent 12 }}`) {
+		t.Errorf("Expected rewritten env helper call in output\nGot:\n%s", output)
+	}
+	templateData, _ := os.ReadFile(filepath.Join(chartPath, "templates", "deployment.yaml"))
+	if !strings.Contains(string(templateData), "toYaml .Values.env") {
+		t.Error("templates should NOT be modified in dry-run mode")
+	}
 }
 
 // TestConvertActual tests actual conversion
@@ -116,10 +148,10 @@ func TestConvertActual(t *testing.T) {
 		t.Error("Converted values.yaml should have DB_HOST as map key")
 	}
 
-	// Backup should exist
-	backupPath := valuesPath + ".bak"
-	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
-		t.Error("Backup file should be created")
+	// Backup should exist, named with the run's snapshot timestamp
+	backups, _ := filepath.Glob(valuesPath + ".*.bak")
+	if len(backups) != 1 {
+		t.Errorf("Backup file should be created, got %v", backups)
 	}
 }
 
@@ -191,6 +223,125 @@ func TestConvertRecursive(t *testing.T) {
 	}
 }
 
+// TestConvertRecursiveDryRun tests that a recursive dry run previews every
+// subchart and umbrella change without writing any file
+func TestConvertRecursiveDryRun(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/umbrella")
+	before := readChartFiles(t, chartPath)
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{
+			ChartDir:      chartPath,
+			Recursive:     true,
+			DryRun:        true,
+			BackupExt:     ".bak",
+			BumpVersion:   "major",
+			MigrationFile: "values-migration.yaml",
+		})
+	})
+	if err != nil {
+		t.Fatalf("runConvert --recursive --dry-run failed: %v\nOutput: %s", err, output)
+	}
+
+	after := readChartFiles(t, chartPath)
+	if len(after) != len(before) {
+		t.Errorf("dry run changed the file set: before %d files, after %d", len(before), len(after))
+	}
+	for path, content := range before {
+		if after[path] != content {
+			t.Errorf("dry run modified %s", path)
+		}
+	}
+
+	for _, want := range []string{
+		"-  - name: SUBCHART_DEFAULT",
+		"+  SUBCHART_DEFAULT:",
+		"-    - name: SUBCHART_VAR",
+		"+    SUBCHART_VAR:",
+		"Would create templates/_listmap.tpl",
+		"Would bump chart version",
+		"Would write values-migration.yaml",
+		"Total paths that would be converted: 2",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q\nOutput: %s", want, output)
+		}
+	}
+}
+
+// readChartFiles returns the contents of every file under root by relative path
+func readChartFiles(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		files[rel] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("reading %s: %v", root, err)
+	}
+	return files
+}
+
+// TestConvertComments tests that --convert-comments rewrites commented-out
+// examples of converted lists, and only of those
+func TestConvertComments(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	valuesPath := filepath.Join(chartPath, "values.yaml")
+	original, err := os.ReadFile(valuesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	examples := `
+# To mount a secret instead:
+# volumes:
+#   - name: tls
+#     secret:
+#       secretName: my-tls
+#
+# Not a converted path:
+# sidecars:
+#   - name: proxy
+`
+	if err := os.WriteFile(valuesPath, append(original, examples...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak", ConvertComments: true})
+	})
+	if err != nil {
+		t.Fatalf("runConvert --convert-comments failed: %v\nOutput: %s", err, output)
+	}
+
+	converted, err := os.ReadFile(valuesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"#   tls:\n#     secret:\n#       secretName: my-tls\n", "# sidecars:\n#   - name: proxy\n"} {
+		if !strings.Contains(string(converted), want) {
+			t.Errorf("values.yaml missing %q:\n%s", want, converted)
+		}
+	}
+	if !strings.Contains(output, "Converted commented-out examples in values.yaml:\n  volumes") {
+		t.Errorf("output should list the converted example:\n%s", output)
+	}
+}
+
 // TestConvertOptions tests that convert options structure is correct
 func TestConvertOptions(t *testing.T) {
 	// This is a smoke test - just verify the Options structure is correct
@@ -209,3 +360,918 @@ func TestConvertOptions(t *testing.T) {
 		t.Error("BackupExt should be set")
 	}
 }
+
+// TestConvertSkipsMigrationFileByDefault tests that no migration map is added
+// to the chart unless one is asked for
+func TestConvertSkipsMigrationFileByDefault(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+
+	if _, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	}); err != nil {
+		t.Fatalf("runConvert failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(chartPath, "values-migration.yaml")); !os.IsNotExist(err) {
+		t.Errorf("values-migration.yaml should not be written without --migration-file, stat error = %v", err)
+	}
+}
+
+// TestConvertWritesMigrationFile tests the consumer migration map written after conversion
+func TestConvertWritesMigrationFile(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+
+	if _, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak", MigrationFile: "values-migration.yaml"})
+	}); err != nil {
+		t.Fatalf("runConvert failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(chartPath, "values-migration.yaml"))
+	if err != nil {
+		t.Fatalf("reading migration file: %v", err)
+	}
+	var m valuesMigration
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		t.Fatalf("parsing migration file: %v", err)
+	}
+	if m.APIVersion != migrationAPIVersion || m.Kind != "ValuesMigration" {
+		t.Errorf("header = %s %s, want %s ValuesMigration", m.APIVersion, m.Kind, migrationAPIVersion)
+	}
+
+	keys := make(map[string]string)
+	for _, f := range m.Fields {
+		if f.Old.Shape != "list" || f.New.Shape != "map" || f.Old.Path != f.New.Path {
+			t.Errorf("unexpected field entry: %+v", f)
+		}
+		keys[f.New.Path] = f.New.Key
+	}
+	want := map[string]string{"env": "name", "volumes": "name", "volumeMounts": "mountPath"}
+	for path, key := range want {
+		if keys[path] != key {
+			t.Errorf("field %s key = %q, want %q", path, keys[path], key)
+		}
+	}
+}
+
+// TestConvertRenamePaths tests that renamePaths moves converted lists, and
+// the references to them, to their new paths, recording the move for consumers
+func TestConvertRenamePaths(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	originalConf := conf
+	defer func() { conf = originalConf }()
+	conf = Config{}
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	for name, replace := range map[string][2]string{
+		"values.yaml":               {"\nenv:", "\nextraEnvVars:"},
+		"templates/deployment.yaml": {".Values.env ", ".Values.extraEnvVars "},
+	} {
+		path := filepath.Join(chartPath, name)
+		data, _ := os.ReadFile(path)
+		if err := os.WriteFile(path, []byte(strings.Replace(string(data), replace[0], replace[1], 1)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := "renamePaths:\n  extraEnvVars: env\n  volumes: pod.volumes\n"
+	if err := os.WriteFile(filepath.Join(chartPath, chartConfigFile), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak", MigrationFile: "values-migration.yaml"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "Moved to: env") || !strings.Contains(output, "Moved to: pod.volumes") {
+		t.Errorf("output should report the moves, got:\n%s", output)
+	}
+
+	var values map[string]any
+	data, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		t.Fatal(err)
+	}
+	pod, _ := values["pod"].(map[string]any)
+	if _, ok := values["extraEnvVars"]; ok || values["env"] == nil || values["volumes"] != nil || pod["volumes"] == nil {
+		t.Errorf("values should be moved to env and pod.volumes, got:\n%s", data)
+	}
+	tpl, _ := os.ReadFile(filepath.Join(chartPath, "templates", "deployment.yaml"))
+	for _, want := range []string{`(index .Values "env") "key" "name"`, `(index .Values "pod" "volumes") "key" "name"`} {
+		if !strings.Contains(string(tpl), want) {
+			t.Errorf("template should render %s, got:\n%s", want, tpl)
+		}
+	}
+
+	m, err := readMigrationFile(filepath.Join(chartPath, "values-migration.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved := make(map[string]string)
+	for _, f := range m.Fields {
+		moved[f.Old.Path] = f.New.Path
+	}
+	if moved["extraEnvVars"] != "env" || moved["volumes"] != "pod.volumes" || moved["volumeMounts"] != "volumeMounts" {
+		t.Errorf("migration map paths = %v", moved)
+	}
+
+	// A rename onto a path that's set fails before anything is written
+	chartPath = copyChartForTest(t, "testdata/charts/basic")
+	if err := os.WriteFile(filepath.Join(chartPath, chartConfigFile), []byte("renamePaths:\n  volumes: image\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	_, err = captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err == nil || !strings.Contains(err.Error(), "image is already set") {
+		t.Errorf("runConvert() error = %v, want image already set", err)
+	}
+	after, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if string(after) != string(before) {
+		t.Errorf("values.yaml should be left alone, got:\n%s", after)
+	}
+}
+
+func TestValidateRenamePaths(t *testing.T) {
+	originalConf := conf
+	defer func() { conf = originalConf }()
+
+	tests := []struct {
+		renames map[string]string
+		wantErr string
+	}{
+		{renames: map[string]string{"extraEnvVars": "env", "app.volumes": "pod.volumes"}},
+		{renames: map[string]string{"env": "env"}, wantErr: "renamed to itself"},
+		{renames: map[string]string{"env": "app.extra-env"}, wantErr: "can't read as .Values fields"},
+		{renames: map[string]string{"a": "c", "b": "c"}, wantErr: "a and b both move to c"},
+		{renames: map[string]string{"env": "env.vars"}, wantErr: "contains or is inside it"},
+		{renames: map[string]string{"a": "b", "b": "c"}, wantErr: "a moves to b, which is renamed too"},
+	}
+	for _, tt := range tests {
+		conf = Config{RenamePaths: tt.renames}
+		err := validateRenamePaths()
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("validateRenamePaths(%v) error = %v, want %q", tt.renames, err, tt.wantErr)
+		}
+	}
+}
+
+// TestConvertEnvDependencySort tests that env paths render through the ordered helper
+func TestConvertEnvDependencySort(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+
+	if _, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak", EnvDependencySort: true})
+	}); err != nil {
+		t.Fatalf("runConvert failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(chartPath, "templates", "deployment.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(data)
+	if !strings.Contains(content, `include "chart.listmap.items.ordered" (dict "items" (index .Values "env")`) {
+		t.Errorf("env should render through the ordered helper, got:\n%s", content)
+	}
+	if !strings.Contains(content, `include "chart.listmap.items" (dict "items" (index .Values "volumes")`) {
+		t.Errorf("volumes should render through the default helper, got:\n%s", content)
+	}
+
+	helper, _ := os.ReadFile(filepath.Join(chartPath, "templates", "_listmap.tpl"))
+	if !strings.Contains(string(helper), `define "chart.listmap.items.ordered"`) {
+		t.Error("helper template should define the ordered variant")
+	}
+}
+
+// TestConvertPreservesFileModes tests that rewritten files and their backups keep the original modes
+func TestConvertPreservesFileModes(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	valuesPath := filepath.Join(chartPath, "values.yaml")
+	templatePath := filepath.Join(chartPath, "templates", "deployment.yaml")
+	if err := os.Chmod(valuesPath, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(templatePath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	}); err != nil {
+		t.Fatalf("runConvert failed: %v", err)
+	}
+
+	valuesBackups, _ := filepath.Glob(valuesPath + ".*.bak")
+	templateBackups, _ := filepath.Glob(templatePath + ".*.bak")
+	if len(valuesBackups) != 1 || len(templateBackups) != 1 {
+		t.Fatalf("expected one backup each, got %v and %v", valuesBackups, templateBackups)
+	}
+	for path, want := range map[string]os.FileMode{
+		valuesPath:         0600,
+		valuesBackups[0]:   0600,
+		templatePath:       0755,
+		templateBackups[0]: 0755,
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s mode = %o, want %o", filepath.Base(path), got, want)
+		}
+	}
+}
+
+// TestConvertRepairsStaleTemplate tests that a list-style template over values
+// that are already maps is fixed without touching the values
+func TestConvertRepairsStaleTemplate(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := t.TempDir()
+	values := "# (key: name)\nenv:\n  A:\n    value: \"1\"\n"
+	files := map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: stale\nversion: 0.1.0\n",
+		"values.yaml": values,
+		"templates/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: stale
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          env:
+            {{- toYaml .Values.env | nindent 12 }}
+`,
+	}
+	writeChartFiles(t, chartPath, files)
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "Repaired templates") || !strings.Contains(output, "env (key=name)") {
+		t.Errorf("output should report the repaired template, got:\n%s", output)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if string(got) != values {
+		t.Errorf("values.yaml should be left alone, got:\n%s", got)
+	}
+	tpl, _ := os.ReadFile(filepath.Join(chartPath, "templates", "deployment.yaml"))
+	if !strings.Contains(string(tpl), `include "chart.listmap.items" (dict "items" (index .Values "env") "key" "name")`) {
+		t.Errorf("template should render env through the helper, got:\n%s", tpl)
+	}
+}
+
+func TestConvertHonorsHelmignore(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	deployment, err := os.ReadFile(filepath.Join(chartPath, "templates", "deployment.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := filepath.Join(chartPath, "templates", "legacy", "deployment.yaml")
+	if err := os.MkdirAll(filepath.Dir(legacy), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(legacy, deployment, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(chartPath, ".helmignore"), []byte("templates/legacy/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(chartPath, "templates", "deployment.yaml"))
+	if !strings.Contains(string(got), "chart.listmap") {
+		t.Errorf("deployment.yaml should be rewritten, got:\n%s", got)
+	}
+	got, _ = os.ReadFile(legacy)
+	if string(got) != string(deployment) {
+		t.Errorf("ignored template should be left alone, got:\n%s", got)
+	}
+	if _, err := os.Stat(legacy + ".bak"); !os.IsNotExist(err) {
+		t.Error("ignored template should not be backed up")
+	}
+}
+
+func TestConvertRefusesConflictingHelperDefine(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	helpers := `{{- define "chart.listmap.items" -}}
+{{- range $k, $v := .items }}
+- name: {{ $k }}
+{{- end }}
+{{- end -}}
+`
+	if err := os.WriteFile(filepath.Join(chartPath, "templates", "_custom.tpl"), []byte(helpers), 0644); err != nil {
+		t.Fatal(err)
+	}
+	values, err := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err == nil {
+		t.Fatalf("runConvert should fail on a conflicting helper define\nOutput: %s", output)
+	}
+	for _, want := range []string{`"chart.listmap.items" in templates/_custom.tpl`, "helperName"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should mention %q, got: %v", want, err)
+		}
+	}
+	got, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if string(got) != string(values) {
+		t.Error("values.yaml should be left alone")
+	}
+	if _, err := os.Stat(filepath.Join(chartPath, "templates", "_listmap.tpl")); !os.IsNotExist(err) {
+		t.Error("_listmap.tpl should not be written")
+	}
+
+	// A chart-specific helper name avoids the collision
+	if err := os.WriteFile(filepath.Join(chartPath, chartConfigFile), []byte("helperName: basic.listmap.items\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err = captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+	helper, _ := os.ReadFile(filepath.Join(chartPath, "templates", "_listmap.tpl"))
+	if !strings.Contains(string(helper), `define "basic.listmap.items"`) {
+		t.Errorf("helper should use the chart's helperName, got:\n%s", helper)
+	}
+}
+
+func TestConvertPodSpecLists(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/pod-lists")
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	values, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	for _, want := range []string{
+		"hostAliases:\n  127.0.0.1:\n    hostnames:\n      - foo.local\n",
+		"  \"::1\":\n    hostnames:\n      - ip6.local\n",
+		"topologySpreadConstraints:\n  topology.kubernetes.io/zone:\n    maxSkew: 1\n",
+		"imagePullSecrets:\n  regcred: {}\n",
+		// The Rollout's CRD isn't loaded; its pod template is keyed like a Pod's
+		"  # Rollout.spec.template.spec.hostAliases (key: ip)\n  hostAliases:\n    10.0.0.1:\n      hostnames:\n        - db.internal\n",
+		"  # Rollout.spec.template.spec.topologySpreadConstraints (key: topologyKey)\n",
+		"  # Pod.spec.imagePullSecrets (key: name)\n  imagePullSecrets:\n    debug-registry: {}\n",
+	} {
+		if !strings.Contains(string(values), want) {
+			t.Errorf("values.yaml should contain %q, got:\n%s", want, values)
+		}
+	}
+
+	rollout, _ := os.ReadFile(filepath.Join(chartPath, "templates", "rollout.yaml"))
+	for _, want := range []string{
+		`(dict "items" (index .Values "rollout" "hostAliases") "key" "ip")`,
+		`(dict "items" (index .Values "rollout" "topologySpreadConstraints") "key" "topologyKey")`,
+	} {
+		if !strings.Contains(string(rollout), want) {
+			t.Errorf("rollout.yaml should contain %q, got:\n%s", want, rollout)
+		}
+	}
+}
+
+func TestConvertIndexedValues(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: indexed\nversion: 0.1.0\n",
+		"values.yaml": "weird-key:\n  env:\n    - name: A\n      value: \"1\"\n",
+		"templates/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: indexed
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          env:
+            {{- toYaml (index .Values "weird-key" "env") | nindent 12 }}
+`,
+	}
+	writeChartFiles(t, chartPath, files)
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if !strings.Contains(string(got), "    A:\n") {
+		t.Errorf("weird-key.env should be converted, got:\n%s\nOutput: %s", got, output)
+	}
+	tpl, _ := os.ReadFile(filepath.Join(chartPath, "templates", "deployment.yaml"))
+	if !strings.Contains(string(tpl), `(dict "items" (index .Values "weird-key" "env") "key" "name")`) {
+		t.Errorf("the indexed path should render through the helper, got:\n%s", tpl)
+	}
+}
+
+func TestConvertRewritesIncludeDictPartial(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: partial\nversion: 0.1.0\n",
+		"values.yaml": "extraEnv:\n  - name: A\n    value: \"1\"\n",
+		"templates/_env.tpl": `{{- define "app.env" -}}
+{{- toYaml .env }}
+{{- end }}
+`,
+		"templates/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: partial
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          env:
+            {{- include "app.env" (dict "env" .Values.extraEnv "ctx" $) | nindent 12 }}
+`,
+	}
+	writeChartFiles(t, chartPath, files)
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if !strings.Contains(string(got), "  A:\n") {
+		t.Errorf("extraEnv should be converted, got:\n%s\nOutput: %s", got, output)
+	}
+	tpl, _ := os.ReadFile(filepath.Join(chartPath, "templates", "_env.tpl"))
+	if !strings.Contains(string(tpl), `{{- include "chart.listmap.items" (dict "items" .env "key" "name") }}`) {
+		t.Errorf("partial should render .env through the helper, got:\n%s", tpl)
+	}
+}
+
+func TestConvertRewritesConcatComposedLists(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: concat\nversion: 0.1.0\n",
+		"values.yaml": "env:\n  - name: A\n    value: \"1\"\nextraEnv:\n  - name: B\n    value: \"2\"\n",
+		"templates/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: concat
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          env:
+            {{- toYaml (concat .Values.env .Values.extraEnv) | nindent 12 }}
+`,
+	}
+	writeChartFiles(t, chartPath, files)
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if !strings.Contains(string(got), "  A:\n") || !strings.Contains(string(got), "  B:\n") {
+		t.Errorf("env and extraEnv should be converted, got:\n%s\nOutput: %s", got, output)
+	}
+	tpl, _ := os.ReadFile(filepath.Join(chartPath, "templates", "deployment.yaml"))
+	if !strings.Contains(string(tpl), `(list (index .Values "env") (index .Values "extraEnv"))`) {
+		t.Errorf("concat should be rewritten to merge the maps, got:\n%s", tpl)
+	}
+}
+
+func TestConvertRewritesWrappedLists(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: wrapped\nversion: 0.1.0\n",
+		"values.yaml": "env:\n  - name: A\n    value: \"1\"\nlegacyEnv: []\nvolumes:\n  - name: data\n    emptyDir: {}\n",
+		"templates/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: wrapped
+spec:
+  template:
+    spec:
+      volumes:
+        {{- toYaml (required "volumes are required" .Values.volumes) | nindent 8 }}
+      containers:
+        - name: app
+          env:
+            {{- toYaml (coalesce .Values.env .Values.legacyEnv) | nindent 12 }}
+`,
+	}
+	writeChartFiles(t, chartPath, files)
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if !strings.Contains(string(got), "  A:\n") || !strings.Contains(string(got), "  data:\n") {
+		t.Errorf("env and volumes should be converted, got:\n%s\nOutput: %s", got, output)
+	}
+	tpl, _ := os.ReadFile(filepath.Join(chartPath, "templates", "deployment.yaml"))
+	for _, want := range []string{
+		`(required "volumes are required" (index .Values "volumes"))`,
+		`(coalesce (index .Values "env") (index .Values "legacyEnv"))`,
+	} {
+		if !strings.Contains(string(tpl), want) {
+			t.Errorf("expected the wrapper kept around the converted map %s, got:\n%s", want, tpl)
+		}
+	}
+}
+
+func TestConvertSetRules(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: sets\nversion: 0.1.0\n",
+		"values.yaml": "imagePullSecrets:\n  - name: regcred\ncapabilities:\n  - NET_ADMIN\n  - SYS_TIME\n  - NET_ADMIN\n",
+		"templates/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: sets
+spec:
+  template:
+    spec:
+      imagePullSecrets:
+        {{- toYaml .Values.imagePullSecrets | nindent 8 }}
+      containers:
+        - name: app
+          securityContext:
+            capabilities:
+              add:
+                {{- toYaml .Values.capabilities | nindent 16 }}
+`,
+	}
+	writeChartFiles(t, chartPath, files)
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	for _, opts := range []AddRuleOptions{
+		{Path: "imagePullSecrets[]", UniqueKeys: []string{"name"}, Set: true, ConfigPath: configPath},
+		{Path: "capabilities[]", Set: true, ConfigPath: configPath},
+	} {
+		if _, err := captureOutput(t, func() error { return runAddRule(opts) }); err != nil {
+			t.Fatalf("runAddRule(%+v) error = %v", opts, err)
+		}
+	}
+	data, _ := os.ReadFile(configPath)
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak", MigrationFile: "values-migration.yaml"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	got, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if !strings.Contains(string(got), "  regcred: true\n") || !strings.Contains(string(got), "  NET_ADMIN: true\n  SYS_TIME: true\n") {
+		t.Errorf("lists should be converted to sets, got:\n%s\nOutput: %s", got, output)
+	}
+	if !strings.Contains(output, "Repeated values kept once") || !strings.Contains(output, "capabilities: NET_ADMIN") {
+		t.Errorf("output should report the repeated capability, got:\n%s", output)
+	}
+	tpl, _ := os.ReadFile(filepath.Join(chartPath, "templates", "deployment.yaml"))
+	for _, want := range []string{
+		`{{- include "chart.listmap.items.set" (dict "items" (index .Values "imagePullSecrets") "key" "name") | nindent 8 }}`,
+		`{{- include "chart.listmap.items.set" (dict "items" (index .Values "capabilities") "key" "") | nindent 16 }}`,
+	} {
+		if !strings.Contains(string(tpl), want) {
+			t.Errorf("template should render through the set helper (%s), got:\n%s", want, tpl)
+		}
+	}
+	migration, _ := os.ReadFile(filepath.Join(chartPath, "values-migration.yaml"))
+	if !strings.Contains(string(migration), "shape: set") {
+		t.Errorf("migration map should record the set shape, got:\n%s", migration)
+	}
+}
+
+func TestConvertWorkloads(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/workloads")
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	values, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	for _, want := range []string{
+		"  env:\n    SCHEDULED:\n      value: \"true\"\n",
+		"  volumeMounts:\n    /scratch:\n      name: scratch\n",
+		"  initContainers:\n    migrate:\n      image: busybox\n",
+		"  ports:\n    9100:\n      name: metrics\n",
+		"    accessModes:\n      - ReadWriteOnce\n",
+	} {
+		if !strings.Contains(string(values), want) {
+			t.Errorf("values.yaml should contain %q, got:\n%s", want, values)
+		}
+	}
+
+	cronjob, _ := os.ReadFile(filepath.Join(chartPath, "templates", "cronjob.yaml"))
+	if !strings.Contains(string(cronjob), `(dict "items" (index .Values "cronjob" "env") "key" "name") | nindent 16`) {
+		t.Errorf("cronjob.yaml env should render through the helper, got:\n%s", cronjob)
+	}
+	statefulset, _ := os.ReadFile(filepath.Join(chartPath, "templates", "statefulset.yaml"))
+	if !strings.Contains(string(statefulset), "toYaml .Values.statefulset.storage.accessModes") {
+		t.Errorf("statefulset.yaml accessModes should be left as is, got:\n%s", statefulset)
+	}
+}
+
+func TestConvertKeyOverride(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	rules := conf.Rules
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{
+			ChartDir:  chartPath,
+			BackupExt: ".bak",
+			Keys:      []string{"volumeMounts=name"},
+		})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	values, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if !strings.Contains(string(values), "volumeMounts:\n  config:\n    mountPath: /etc/config\n") {
+		t.Errorf("volumeMounts should be keyed by name, got:\n%s", values)
+	}
+	// Other lists keep their detected keys
+	if !strings.Contains(string(values), "env:\n  DB_HOST:\n") {
+		t.Errorf("env should be keyed by name, got:\n%s", values)
+	}
+	deployment, _ := os.ReadFile(filepath.Join(chartPath, "templates", "deployment.yaml"))
+	if !strings.Contains(string(deployment), `"volumeMounts") "key" "name")`) {
+		t.Errorf("volumeMounts should render keyed by name, got:\n%s", deployment)
+	}
+
+	// The override doesn't outlive the run
+	if !reflect.DeepEqual(conf.Rules, rules) {
+		t.Errorf("conf.Rules = %+v after the run, want %+v", conf.Rules, rules)
+	}
+}
+
+func TestParseKeyOverride(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Rule
+		wantErr bool
+	}{
+		{in: "deployment.env=id", want: Rule{PathPattern: "deployment.env[]", UniqueKeys: []string{"id"}}},
+		{in: " env[] = name ", want: Rule{PathPattern: "env[]", UniqueKeys: []string{"name"}}},
+		{in: "*.volumeMounts=name", want: Rule{PathPattern: "*.volumeMounts[]", UniqueKeys: []string{"name"}}},
+		{in: "env", wantErr: true},
+		{in: "env=", wantErr: true},
+		{in: "=name", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseKeyOverride(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseKeyOverride(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseKeyOverride(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestConvertConfigData(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/config-data")
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{
+			ChartDir:      chartPath,
+			BackupExt:     ".bak",
+			ConfigDataKey: "name",
+			Keys:          []string{"appConfig.upstreams=id"},
+		})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	values, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	for _, want := range []string{
+		"  servers:\n    primary:\n      host: primary.example.com\n",
+		"  upstreams:\n    api:\n      url: http://api:8080\n",
+		"  credentials:\n    admin:\n      password: changeme\n",
+	} {
+		if !strings.Contains(string(values), want) {
+			t.Errorf("values.yaml should contain %q, got:\n%s", want, values)
+		}
+	}
+
+	if !strings.Contains(string(values), "  settings:\n    logLevel: info\n    name: app\n") {
+		t.Errorf("values.yaml settings map should be left as is, got:\n%s", values)
+	}
+
+	configmap, _ := os.ReadFile(filepath.Join(chartPath, "templates", "configmap.yaml"))
+	for _, want := range []string{
+		`(dict "items" (index .Values "appConfig" "servers") "key" "name") | nindent 6 }}`,
+		`(dict "items" (index .Values "appConfig" "upstreams") "key" "id") | nindent 4 }}`,
+		// A map rendered beside the lists isn't taken for a converted list
+		"{{- toYaml .Values.appConfig.settings | nindent 4 }}",
+	} {
+		if !strings.Contains(string(configmap), want) {
+			t.Errorf("configmap.yaml should contain %q, got:\n%s", want, configmap)
+		}
+	}
+
+	// The setting doesn't outlive the run
+	if prev := k8s.SetConfigDataKey(""); prev != "" {
+		t.Errorf("config data key = %q after the run, want none", prev)
+	}
+}
+
+func TestConvertReportsUnhandledIncludeCallers(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := t.TempDir()
+	values := "extraEnv:\n  - name: A\n    value: \"1\"\n"
+	files := map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: partial\nversion: 0.1.0\n",
+		"values.yaml": values,
+		"templates/_env.tpl": `{{- define "app.env" -}}
+{{- toYaml .env }}
+{{- end }}
+`,
+		"templates/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: partial
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          env:
+            {{- include "app.env" (dict "env" .Values.extraEnv "ctx" $) | nindent 12 }}
+        {{- $sidecarEnv := list (dict "name" "B" "value" "2") }}
+        - name: sidecar
+          env:
+            {{- include "app.env" (dict "env" $sidecarEnv "ctx" $) | nindent 12 }}
+`,
+	}
+	writeChartFiles(t, chartPath, files)
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	// The sidecar still passes a list, so the partial and extraEnv stay as they are
+	if got, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml")); string(got) != values {
+		t.Errorf("extraEnv should stay a list, got:\n%s", got)
+	}
+	for _, want := range []string{
+		"templates/deployment.yaml:11: passed to a named template that other callers pass lists not converted alike",
+		"app.env (.env): $sidecarEnv is not a .Values path",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q, got:\n%s", want, output)
+		}
+	}
+}
+
+// TestCollectConvertCandidatesConcurrent detects the candidates of several
+// charts at once while the detection settings are set, for go test -race
+func TestCollectConvertCandidatesConcurrent(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	var charts []string
+	for range 4 {
+		charts = append(charts, copyChartForTest(t, "testdata/charts/basic"))
+	}
+	want, err := collectConvertCandidates(charts[0])
+	if err != nil {
+		t.Fatalf("collectConvertCandidates failed: %v", err)
+	}
+
+	// Set each setting to the value it already has, so results don't change
+	stop := make(chan struct{})
+	var setters sync.WaitGroup
+	setters.Add(1)
+	go func() {
+		defer setters.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			k8s.SetKindHints(k8s.SetKindHints(nil))
+			k8s.SetKubeVersion(k8s.SetKubeVersion(k8s.TargetKubeVersion()))
+			k8s.SetClusterSchema(k8s.ClusterSchema())
+			_, _ = k8s.SetCuratedRuleSets(k8s.EnabledCuratedRuleSets())
+			k8s.SetConfigDataKey(k8s.SetConfigDataKey(""))
+			k8s.SetOpenAPISpec(k8s.SetOpenAPISpec(nil))
+		}
+	}()
+
+	var detectors sync.WaitGroup
+	for _, chart := range charts {
+		detectors.Add(1)
+		go func() {
+			defer detectors.Done()
+			for range 3 {
+				got, err := collectConvertCandidates(chart)
+				if err != nil {
+					t.Errorf("collectConvertCandidates(%s) failed: %v", chart, err)
+					return
+				}
+				if len(got.Matched) != len(want.Matched) {
+					t.Errorf("collectConvertCandidates(%s) matched %d paths, want %d", chart, len(got.Matched), len(want.Matched))
+				}
+				_ = k8s.MergeKeyDoc("corev1.EnvVar", "name")
+			}
+		}()
+	}
+	detectors.Wait()
+	close(stop)
+	setters.Wait()
+}
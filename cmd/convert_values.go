@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/transform"
+	"gopkg.in/yaml.v3"
+)
+
+func runConvertValues(opts ConvertValuesOptions, stdin io.Reader, stdout io.Writer) error {
+	candidates, err := parseValuesPaths(opts.Paths)
+	if err != nil {
+		return err
+	}
+
+	var raw []byte
+	switch opts.Input {
+	case "", "-":
+		raw, err = io.ReadAll(stdin)
+	default:
+		raw, err = os.ReadFile(opts.Input)
+	}
+	if err != nil {
+		return fmt.Errorf("reading values: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return fmt.Errorf("parsing values: %w", err)
+	}
+
+	// Keep stdout clean for the values
+	candidates, merged := withoutMergedLists(&doc, candidates)
+	printMergedLists(os.Stderr, merged, "")
+
+	var edits []transform.ArrayEdit
+	transform.FindArrayEdits(&doc, nil, candidates, &edits)
+	_, err = stdout.Write(transform.ApplyLineEdits(raw, edits))
+	return err
+}
+
+// parseValuesPaths parses a comma-separated list of path=key pairs
+// (e.g., "deployment.env=name,service.ports=port") into conversion candidates
+func parseValuesPaths(spec string) (map[string]k8s.DetectedCandidate, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, fmt.Errorf("--paths is required")
+	}
+	candidates := make(map[string]k8s.DetectedCandidate)
+	for _, pair := range strings.Split(spec, ",") {
+		path, key, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		path = strings.TrimSuffix(path, "[]")
+		if !ok || path == "" || key == "" {
+			return nil, fmt.Errorf("invalid --paths entry %q: want path=key", pair)
+		}
+		parts := strings.Split(path, ".")
+		candidates[path] = k8s.DetectedCandidate{
+			ValuesPath:  path,
+			MergeKey:    key,
+			SectionName: parts[len(parts)-1],
+		}
+	}
+	return candidates, nil
+}
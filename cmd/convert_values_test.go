@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConvertValues(t *testing.T) {
+	in := `deployment:
+  env:
+    - name: A
+      value: "1"
+service:
+  ports:
+    - port: 80
+      name: http
+other:
+  - name: keep
+`
+	var out bytes.Buffer
+	err := runConvertValues(ConvertValuesOptions{Paths: "deployment.env=name, service.ports[]=port", Input: "-"}, strings.NewReader(in), &out)
+	if err != nil {
+		t.Fatalf("runConvertValues() error = %v", err)
+	}
+
+	want := `deployment:
+  # (key: name)
+  env:
+    A:
+      value: "1"
+service:
+  # (key: port)
+  ports:
+    80:
+      name: http
+other:
+  - name: keep
+`
+	if out.String() != want {
+		t.Errorf("runConvertValues() output =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestConvertValuesKeepsNull(t *testing.T) {
+	// Null drops the chart default in an override; converting it to {} would bring the default back
+	in := "env: null\nports:\n  - port: 80\n"
+	var out bytes.Buffer
+	if err := runConvertValues(ConvertValuesOptions{Paths: "env=name,ports=port", Input: "-"}, strings.NewReader(in), &out); err != nil {
+		t.Fatalf("runConvertValues() error = %v", err)
+	}
+	want := "env: null\n# (key: port)\nports:\n  80: {}\n"
+	if out.String() != want {
+		t.Errorf("runConvertValues() output =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestParseValuesPathsErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, spec := range []string{"", "env", "env=", "=name"} {
+		if _, err := parseValuesPaths(spec); err == nil {
+			t.Errorf("parseValuesPaths(%q) should fail", spec)
+		}
+	}
+}
+
+func TestConvertValuesSkipsMergedLists(t *testing.T) {
+	in := `defaults: &defaults
+  env:
+    - name: A
+worker:
+  <<: *defaults
+service:
+  ports:
+    - port: 80
+`
+	var out bytes.Buffer
+	err := runConvertValues(ConvertValuesOptions{Paths: "defaults.env=name,service.ports=port", Input: "-"}, strings.NewReader(in), &out)
+	if err != nil {
+		t.Fatalf("runConvertValues() error = %v", err)
+	}
+
+	// Converting defaults.env would change worker.env behind the chart's back
+	if !strings.Contains(out.String(), "  env:\n    - name: A\n") {
+		t.Errorf("merged list should be left alone, got:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "  ports:\n    80:") {
+		t.Errorf("unrelated list should still be converted, got:\n%s", out.String())
+	}
+}
+
+func TestConvertValuesSkipsAliasedLists(t *testing.T) {
+	in := `env: &env
+  - name: A
+migrations:
+  env: *env
+`
+	var out bytes.Buffer
+	err := runConvertValues(ConvertValuesOptions{Paths: "env=name", Input: "-"}, strings.NewReader(in), &out)
+	if err != nil {
+		t.Fatalf("runConvertValues() error = %v", err)
+	}
+
+	// Converting env would turn migrations.env into a map as well
+	if out.String() != in {
+		t.Errorf("aliased list should be left alone, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/crd"
+)
+
+func runCRDDiff(opts CRDDiffOptions) error {
+	i := strings.LastIndex(opts.Type, "/")
+	if i <= 0 || i == len(opts.Type)-1 {
+		return fmt.Errorf("invalid CRD type %q: want <group>/<kind>, e.g. monitoring.coreos.com/Alertmanager", opts.Type)
+	}
+	group, kind := opts.Type[:i], opts.Type[i+1:]
+
+	restoreSchema, err := useSchemas("", false)
+	defer restoreSchema()
+	if err != nil {
+		return err
+	}
+	diffs, same, err := crd.GetGlobalRegistry().DiffVersions(group, kind, opts.From, opts.To)
+	if err != nil {
+		return err
+	}
+
+	if len(diffs) == 0 {
+		fmt.Printf("%s %s and %s convert the same %d list field(s).\n", opts.Type, opts.From, opts.To, same)
+		fmt.Println("A version mismatch between them doesn't change what gets converted.")
+		return nil
+	}
+
+	width := len("Field")
+	for _, d := range diffs {
+		width = max(width, len(d.Path))
+	}
+	fmt.Printf("%s: %d convertible list field(s) differ between %s and %s (%d unchanged)\n\n", opts.Type, len(diffs), opts.From, opts.To, same)
+	fmt.Printf("%-*s  %s -> %s\n", width, "Field", opts.From, opts.To)
+	for _, d := range diffs {
+		fmt.Printf("%-*s  %s -> %s\n", width, d.Path, fieldConversion(d.FromKeys, d.FromList), fieldConversion(d.ToKeys, d.ToList))
+	}
+	fmt.Println("\nIf your chart's templates render any of these fields, convert with the CRD version the chart targets.")
+	return nil
+}
+
+// fieldConversion describes how a field converts in one CRD version
+func fieldConversion(keys []string, list bool) string {
+	switch {
+	case len(keys) > 0:
+		return "key: " + strings.Join(keys, ", ")
+	case list:
+		return "list without map keys"
+	}
+	return "not a list"
+}
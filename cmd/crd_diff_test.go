@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+func TestCRDDiff(t *testing.T) {
+	pluginDir := testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	data, err := os.ReadFile(filepath.Join("testdata", "crds", "version-diff.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(pluginDir, "crds", "example.com_gateways_v1.yaml"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runCRDDiff(CRDDiffOptions{Type: "example.com/Gateway", From: "v1", To: "v1alpha1"})
+	})
+	if err != nil {
+		t.Fatalf("runCRDDiff failed: %v\nOutput: %s", err, output)
+	}
+	for _, want := range []string{
+		"3 convertible list field(s) differ between v1 and v1alpha1 (1 unchanged)",
+		"spec.hosts    not a list -> key: hostname",
+		"spec.ports    key: port -> key: port, protocol",
+		"spec.volumes  key: name -> list without map keys",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q, got:\n%s", want, output)
+		}
+	}
+
+	output, err = captureOutput(t, func() error {
+		return runCRDDiff(CRDDiffOptions{Type: "example.com/Gateway", From: "v1", To: "v1"})
+	})
+	if err != nil || !strings.Contains(output, "convert the same 3 list field(s)") {
+		t.Errorf("runCRDDiff() of one version = %v, output:\n%s", err, output)
+	}
+
+	if err := runCRDDiff(CRDDiffOptions{Type: "Gateway", From: "v1", To: "v1alpha1"}); err == nil {
+		t.Error("runCRDDiff() should reject a type without a group")
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/template"
+)
+
+// Decisions convert makes about a values path
+const (
+	decisionConvert   = "convert"   // convert would turn the list into a map or set
+	decisionConverted = "converted" // already rendered through the list-map helper
+	decisionSkip      = "skip"      // left as a list
+)
+
+// Sources of the merge key of a converted path
+const (
+	sourceSchema  = "schema"  // the resource field's schema: a Kubernetes type or CRD
+	sourceRule    = "rule"    // a conversion rule from the config or Chart.yaml
+	sourceCurated = "curated" // a curated rule set enabled by curatedRules
+)
+
+// decisionsKind identifies the decisions document, under migrationAPIVersion
+const decisionsKind = "ConversionDecisions"
+
+// conversionDecision records what convert does with one values path, and why,
+// for policy engines such as OPA to evaluate
+type conversionDecision struct {
+	Path     string `json:"path"`
+	Decision string `json:"decision"` // convert, converted, or skip
+	// Reason is the category of the decision: the key's source for
+	// conversions, helper for converted paths, and a skip category or
+	// detection failure otherwise
+	Reason      string             `json:"reason"`
+	Detail      string             `json:"detail"`
+	Shape       string             `json:"shape,omitempty"` // map or set
+	Key         string             `json:"key,omitempty"`
+	Keys        []string           `json:"keys,omitempty"`
+	KeyStrategy string             `json:"keyStrategy,omitempty"`
+	ElementType string             `json:"elementType,omitempty"`
+	TypePolicy  string             `json:"typePolicy,omitempty"`
+	Synthetic   bool               `json:"synthetic,omitempty"` // Key only names entries
+	NewPath     string             `json:"newPath,omitempty"`   // Path renamePaths moves the value to
+	Rule        *decisionRule      `json:"rule,omitempty"`
+	Resources   []decisionResource `json:"resources,omitempty"`
+}
+
+// decisionRule is the conversion rule a decision follows
+type decisionRule struct {
+	PathPattern string   `json:"pathPattern"`
+	UniqueKeys  []string `json:"uniqueKeys,omitempty"`
+	Note        string   `json:"note,omitempty"`
+}
+
+// decisionResource is a resource field a decided path is rendered into
+type decisionResource struct {
+	Kind     string `json:"kind,omitempty"`
+	Template string `json:"template,omitempty"`
+	Field    string `json:"field,omitempty"`
+	MergeKey string `json:"mergeKey,omitempty"`
+}
+
+// chartDecisions is the decisions made about one chart
+type chartDecisions struct {
+	Chart     string               `json:"chart"`
+	Version   string               `json:"version,omitempty"`
+	Path      string               `json:"path"`
+	Decisions []conversionDecision `json:"decisions"`
+}
+
+func runDecisions(opts DecisionsOptions) error {
+	charts := opts.Charts
+	if len(charts) == 0 {
+		charts = []string{"."}
+	}
+
+	var all []chartDecisions
+	for _, dir := range charts {
+		root, err := findChartRoot(dir)
+		if err != nil {
+			return err
+		}
+		d, err := collectChartDecisions(root)
+		if err != nil {
+			return fmt.Errorf("%s: %w", root, err)
+		}
+		all = append(all, d)
+	}
+	return writeDecisionsJSON(os.Stdout, all)
+}
+
+// collectChartDecisions decides each list-rendered values path of the chart at
+// root as convert would, recording the schema, rule, or config behind it
+func collectChartDecisions(root string) (chartDecisions, error) {
+	// Apply the chart's own config over the user config
+	restore, err := useChartConfig(root)
+	defer restore()
+	if err != nil {
+		return chartDecisions{}, err
+	}
+	restoreSchema, err := useSchemas("", false)
+	defer restoreSchema()
+	if err != nil {
+		return chartDecisions{}, err
+	}
+
+	collected, err := collectConvertCandidates(root)
+	if err != nil {
+		return chartDecisions{}, err
+	}
+	full, err := k8s.DetectConversionCandidatesFull(root)
+	if err != nil {
+		return chartDecisions{}, err
+	}
+
+	// Details of every candidate, for the paths collection left behind
+	detected, _, _, err := k8s.DetectConversionCandidates(root)
+	if err != nil {
+		return chartDecisions{}, err
+	}
+	byPath := make(map[string]k8s.DetectedCandidate)
+	for _, c := range append(detected, scanForUserRules(root)...) {
+		byPath[c.ValuesPath] = c
+	}
+
+	d := chartDecisions{Chart: chartName(root), Version: chartVersion(root), Path: root}
+	decided := make(map[string]bool)
+	add := func(dec conversionDecision) {
+		if !decided[dec.Path] {
+			decided[dec.Path] = true
+			d.Decisions = append(d.Decisions, dec)
+		}
+	}
+
+	candidates := make(map[string]k8s.DetectedCandidate, len(collected.Matched))
+	for _, c := range collected.Matched {
+		candidates[c.ValuesPath] = c
+	}
+	if doc, _, err := loadValuesNode(filepath.Join(root, "values.yaml")); err == nil {
+		kept, merged := withoutMergedLists(doc, candidates)
+		for _, m := range merged {
+			for _, p := range []string{m.Path, m.Source} {
+				if _, ok := kept[p]; !ok && p != "" {
+					if c, ok := candidates[p]; ok {
+						add(candidateDecision(c, decisionSkip, skipShared, mergedListNote(m)))
+					}
+				}
+			}
+		}
+		candidates = kept
+	} else if !os.IsNotExist(err) {
+		return chartDecisions{}, err
+	}
+
+	// Paths rendered through the helper are converted, unless their values
+	// are lists again and convert would repair them
+	for _, p := range template.ConvertedPaths(root) {
+		if _, pending := candidates[p.DotPath]; pending {
+			continue
+		}
+		dec := conversionDecision{
+			Path:     p.DotPath,
+			Decision: decisionConverted,
+			Reason:   "helper",
+			Detail:   "rendered through the list-map helper",
+			Shape:    "map",
+			Key:      p.MergeKey,
+		}
+		if p.Set {
+			dec.Shape, dec.Key = "set", ""
+		}
+		if c, ok := byPath[p.DotPath]; ok {
+			dec.ElementType = c.ElementType
+		}
+		add(dec)
+	}
+
+	for _, c := range collected.Matched {
+		if _, ok := candidates[c.ValuesPath]; ok {
+			add(candidateDecision(c, decisionConvert, "", ""))
+		}
+	}
+	for _, c := range collected.Ask {
+		add(candidateDecision(c, decisionSkip, skipAsk, fmt.Sprintf("typePolicy for %s is ask; select it with convert --tui", c.ElementType)))
+	}
+	optOut := valuesOptOutPaths(root)
+	for _, p := range collected.Ignored {
+		c := byPath[p]
+		c.ValuesPath = p
+		add(candidateDecision(c, decisionSkip, skipIgnored, ignoreDetail(c, optOut)))
+	}
+	for _, p := range collected.BelowMinItems {
+		c := byPath[p]
+		c.ValuesPath = p
+		add(candidateDecision(c, decisionSkip, skipMinItems, fmt.Sprintf("fewer items in values.yaml than minItems (%d)", conf.MinItems)))
+	}
+	for _, p := range collected.Skipped {
+		c := byPath[p]
+		c.ValuesPath = p
+		add(candidateDecision(c, decisionSkip, skipTemplate, "rendered by a template pattern convert can't rewrite"))
+	}
+	for _, conflict := range collected.Conflicts {
+		dec := conversionDecision{
+			Path:     conflict.ValuesPath,
+			Decision: decisionSkip,
+			Reason:   skipConflict,
+			Detail:   "rendered into resource fields that disagree on the merge key",
+		}
+		for _, u := range conflict.Consumers {
+			dec.Resources = append(dec.Resources, decisionResource{Kind: u.Kind, Template: u.TemplateFile, Field: u.YAMLPath, MergeKey: u.MergeKey})
+		}
+		add(dec)
+	}
+	for _, u := range full.Undetected {
+		dec := conversionDecision{
+			Path:     u.ValuesPath,
+			Decision: decisionSkip,
+			Reason:   string(u.Category),
+			Detail:   u.Reason,
+		}
+		if u.Kind != "" || u.TemplateFile != "" {
+			dec.Resources = []decisionResource{{Kind: u.Kind, Template: u.TemplateFile}}
+		}
+		add(dec)
+	}
+
+	sort.Slice(d.Decisions, func(i, j int) bool { return d.Decisions[i].Path < d.Decisions[j].Path })
+	return d, nil
+}
+
+// candidateDecision returns the decision about a candidate. Conversions are
+// explained by where their key comes from.
+func candidateDecision(c k8s.DetectedCandidate, decision, reason, detail string) conversionDecision {
+	dec := conversionDecision{
+		Path:        c.ValuesPath,
+		Decision:    decision,
+		Reason:      reason,
+		Detail:      detail,
+		Shape:       "map",
+		Key:         c.MergeKey,
+		Keys:        c.MergeKeys,
+		KeyStrategy: c.KeyStrategy,
+		ElementType: c.ElementType,
+		TypePolicy:  typePolicyFor(c.ElementType),
+		Synthetic:   c.Synthetic,
+	}
+	if c.Set {
+		dec.Shape = "set"
+	}
+	if decision == decisionConvert {
+		dec.NewPath = conf.RenamePaths[c.ValuesPath]
+	}
+	if c.ResourceKind != "" || c.TemplateFile != "" {
+		dec.Resources = []decisionResource{{Kind: c.ResourceKind, Template: c.TemplateFile, Field: c.YAMLPath, MergeKey: c.MergeKey}}
+	}
+
+	rule := matchRule(strings.Split(c.ValuesPath, "."))
+	if c.ElementType == "(user rule)" && rule != nil {
+		dec.ElementType = ""
+		dec.Rule = &decisionRule{PathPattern: rule.PathPattern, UniqueKeys: rule.UniqueKeys, Note: rule.Note}
+		if decision == decisionConvert {
+			dec.Reason = sourceRule
+			dec.Detail = "conversion rule " + rule.PathPattern
+		}
+	} else if decision == decisionConvert && c.Curated != "" {
+		dec.Reason = sourceCurated
+		dec.Detail = fmt.Sprintf("%s is keyed by %s by the curated %s rules", c.YAMLPath, c.MergeKey, c.Curated)
+	} else if decision == decisionConvert {
+		dec.Reason = sourceSchema
+		dec.Detail = fmt.Sprintf("%s is keyed by %s in the %s schema", c.YAMLPath, c.MergeKey, c.ResourceKind)
+	}
+	if c.MergeKey == "" && !c.Set {
+		dec.Shape = ""
+	}
+	return dec
+}
+
+// ignoreDetail describes the config or comment excluding an ignored candidate
+func ignoreDetail(c k8s.DetectedCandidate, optOut []string) string {
+	switch {
+	case isIgnoredPath(c.ValuesPath):
+		return "matches ignorePaths"
+	case isIgnoredType(c.ElementType):
+		return fmt.Sprintf("element type %s matches ignoreTypes", c.ElementType)
+	case typePolicyFor(c.ElementType) == typePolicyNever:
+		return fmt.Sprintf("typePolicy for %s is never", c.ElementType)
+	case isOptedOut(c.ValuesPath, optOut):
+		return "opted out by a comment in values.yaml"
+	}
+	return "excluded by ignore config"
+}
+
+// writeDecisionsJSON writes the decisions about every chart as one JSON document
+func writeDecisionsJSON(w io.Writer, all []chartDecisions) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		APIVersion string           `json:"apiVersion"`
+		Kind       string           `json:"kind"`
+		Charts     []chartDecisions `json:"charts"`
+	}{migrationAPIVersion, decisionsKind, all})
+}
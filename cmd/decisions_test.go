@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+func TestCollectChartDecisions(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	originalConf := conf
+	defer func() { conf = originalConf }()
+	conf = Config{
+		IgnoreTypes: []string{"VolumeMount"},
+		Rules:       []Rule{{PathPattern: "gateway.routes[]", UniqueKeys: []string{"host"}, Note: "routes are unique per host"}},
+	}
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	values, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	values = append(values, []byte("tolerations:\n  - key: dedicated\n    operator: Exists\ngateway:\n  routes:\n    - host: example.com\n")...)
+	if err := os.WriteFile(filepath.Join(chartPath, "values.yaml"), values, 0644); err != nil {
+		t.Fatal(err)
+	}
+	deployment, _ := os.ReadFile(filepath.Join(chartPath, "templates", "deployment.yaml"))
+	deployment = append(deployment, []byte("      tolerations:\n        {{- toYaml .Values.tolerations | nindent 8 }}\n")...)
+	if err := os.WriteFile(filepath.Join(chartPath, "templates", "deployment.yaml"), deployment, 0644); err != nil {
+		t.Fatal(err)
+	}
+	gateway := "apiVersion: example.com/v1\nkind: Gateway\nmetadata:\n  name: gw\nspec:\n  routes:\n    {{- toYaml .Values.gateway.routes | nindent 4 }}\n"
+	if err := os.WriteFile(filepath.Join(chartPath, "templates", "gateway.yaml"), []byte(gateway), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := collectChartDecisions(chartPath)
+	if err != nil {
+		t.Fatalf("collectChartDecisions() error = %v", err)
+	}
+	if d.Chart != "basic" || d.Version != "0.1.0" {
+		t.Errorf("chart = %s %s, want basic 0.1.0", d.Chart, d.Version)
+	}
+	got := make(map[string]conversionDecision)
+	var paths []string
+	for _, dec := range d.Decisions {
+		got[dec.Path] = dec
+		paths = append(paths, dec.Path)
+	}
+	if strings.Join(paths, ",") != "env,gateway.routes,tolerations,volumeMounts,volumes" {
+		t.Fatalf("decided paths = %v", paths)
+	}
+
+	env := got["env"]
+	if env.Decision != decisionConvert || env.Reason != sourceSchema || env.Key != "name" || env.ElementType != "corev1.EnvVar" ||
+		len(env.Resources) != 1 || env.Resources[0].Kind != "Deployment" || env.Resources[0].Field != "spec.template.spec.containers.env" {
+		t.Errorf("env = %+v, want converted by the Deployment schema", env)
+	}
+	routes := got["gateway.routes"]
+	if routes.Decision != decisionConvert || routes.Reason != sourceRule || routes.Key != "host" ||
+		routes.Rule == nil || routes.Rule.PathPattern != "gateway.routes[]" || routes.Rule.Note != "routes are unique per host" {
+		t.Errorf("gateway.routes = %+v, want converted by the rule", routes)
+	}
+	mounts := got["volumeMounts"]
+	if mounts.Decision != decisionSkip || mounts.Reason != skipIgnored || mounts.Detail != "element type corev1.VolumeMount matches ignoreTypes" {
+		t.Errorf("volumeMounts = %+v, want ignored by ignoreTypes", mounts)
+	}
+	tolerations := got["tolerations"]
+	if tolerations.Decision != decisionSkip || tolerations.Reason != "k8s_no_keys" || tolerations.Shape != "" {
+		t.Errorf("tolerations = %+v, want skipped for having no merge key", tolerations)
+	}
+
+	if _, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	}); err != nil {
+		t.Fatalf("runConvert failed: %v", err)
+	}
+	d, err = collectChartDecisions(chartPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dec := range d.Decisions {
+		if dec.Path == "env" && (dec.Decision != decisionConverted || dec.Key != "name") {
+			t.Errorf("env after convert = %+v, want converted", dec)
+		}
+	}
+}
+
+func TestRunDecisionsJSON(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	output, err := captureOutput(t, func() error {
+		return runDecisions(DecisionsOptions{Charts: []string{chartPath}})
+	})
+	if err != nil {
+		t.Fatalf("runDecisions() error = %v", err)
+	}
+
+	var doc struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+		Charts     []struct {
+			Chart     string `json:"chart"`
+			Decisions []struct {
+				Path     string `json:"path"`
+				Decision string `json:"decision"`
+			} `json:"decisions"`
+		} `json:"charts"`
+	}
+	if err := json.Unmarshal([]byte(output), &doc); err != nil {
+		t.Fatalf("output isn't JSON: %v\n%s", err, output)
+	}
+	if doc.APIVersion != "list-to-map/v1" || doc.Kind != "ConversionDecisions" || len(doc.Charts) != 1 || len(doc.Charts[0].Decisions) != 3 {
+		t.Errorf("unexpected document:\n%s", output)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -305,7 +306,7 @@ dependencies:
 	_ = os.WriteFile(filepath.Join(subchartDir, "Chart.yaml"), []byte("apiVersion: v2\nname: subchart-a\n"), 0644)
 
 	// Test with only recursive flag
-	subcharts, err := collectSubcharts(dir, true, false, false)
+	subcharts, err := collectSubcharts(dir, true, false, false, "")
 	if err != nil {
 		t.Fatalf("collectSubcharts() error = %v", err)
 	}
@@ -338,7 +339,7 @@ func TestCollectSubcharts_OnlyIncludeChartsDir(t *testing.T) {
 	_ = os.WriteFile(filepath.Join(subDir, "Chart.yaml"), []byte("apiVersion: v2\nname: embedded\n"), 0644)
 
 	// Test with only include-charts-dir flag
-	subcharts, err := collectSubcharts(dir, false, true, false)
+	subcharts, err := collectSubcharts(dir, false, true, false, "")
 	if err != nil {
 		t.Fatalf("collectSubcharts() error = %v", err)
 	}
@@ -377,7 +378,7 @@ dependencies:
 	_ = os.WriteFile(filepath.Join(sharedDir, "Chart.yaml"), []byte("apiVersion: v2\nname: shared\n"), 0644)
 
 	// Test with both flags (should deduplicate)
-	subcharts, err := collectSubcharts(dir, true, true, false)
+	subcharts, err := collectSubcharts(dir, true, true, false, "")
 	if err != nil {
 		t.Fatalf("collectSubcharts() error = %v", err)
 	}
@@ -395,3 +396,124 @@ dependencies:
 		t.Errorf("expected source 'charts/ (via Chart.yaml)', got %s", subcharts[0].Source)
 	}
 }
+
+func TestCollectSubcharts_SortedByName(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("apiVersion: v2\nname: umbrella\n"), 0644)
+	names := []string{"delta", "alpha", "echo", "charlie", "bravo"}
+	for _, name := range names {
+		subDir := filepath.Join(dir, "charts", name)
+		_ = os.MkdirAll(subDir, 0755)
+		_ = os.WriteFile(filepath.Join(subDir, "Chart.yaml"), []byte("apiVersion: v2\nname: "+name+"\n"), 0644)
+	}
+
+	// Subcharts are collected through a map; reports list them in one order
+	for range 5 {
+		subcharts, err := collectSubcharts(dir, false, true, false, "")
+		if err != nil {
+			t.Fatalf("collectSubcharts() error = %v", err)
+		}
+		var got []string
+		for _, sc := range subcharts {
+			got = append(got, sc.Name)
+		}
+		if strings.Join(got, ",") != "alpha,bravo,charlie,delta,echo" {
+			t.Fatalf("subcharts = %v, want sorted by name", got)
+		}
+	}
+}
+
+func TestCollectSubcharts_CanonicalPaths(t *testing.T) {
+	t.Parallel()
+
+	// writeChart writes a minimal chart named after its directory
+	writeChart := func(t *testing.T, dir, chartYaml string) {
+		t.Helper()
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if chartYaml == "" {
+			chartYaml = "apiVersion: v2\nname: " + filepath.Base(dir) + "\n"
+		}
+		if err := os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte(chartYaml), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, root string) string // Returns the umbrella chart root
+		want  []string                               // name [source] (also as aliases)
+	}{
+		{
+			name: "file:// dependency symlinked into charts/",
+			setup: func(t *testing.T, root string) string {
+				umbrella := filepath.Join(root, "umbrella")
+				writeChart(t, umbrella, "apiVersion: v2\nname: umbrella\ndependencies:\n  - name: shared\n    repository: file://../shared\n")
+				writeChart(t, filepath.Join(root, "shared"), "")
+				if err := os.MkdirAll(filepath.Join(umbrella, "charts"), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Symlink(filepath.Join("..", "..", "shared"), filepath.Join(umbrella, "charts", "shared")); err != nil {
+					t.Skipf("symlinks unsupported: %v", err)
+				}
+				return umbrella
+			},
+			want: []string{"shared [charts/ (via Chart.yaml)]"},
+		},
+		{
+			name: "equivalent file:// paths",
+			setup: func(t *testing.T, root string) string {
+				umbrella := filepath.Join(root, "umbrella")
+				writeChart(t, umbrella, "apiVersion: v2\nname: umbrella\ndependencies:\n  - name: shared\n    repository: file://../shared\n  - name: shared\n    repository: file://./charts/../../shared/\n")
+				writeChart(t, filepath.Join(root, "shared"), "")
+				return umbrella
+			},
+			want: []string{"shared [file://]"},
+		},
+		{
+			name: "same chart under two aliases",
+			setup: func(t *testing.T, root string) string {
+				umbrella := filepath.Join(root, "umbrella")
+				writeChart(t, umbrella, "apiVersion: v2\nname: umbrella\ndependencies:\n  - name: worker\n    alias: email-worker\n    repository: file://../worker\n  - name: worker\n    alias: report-worker\n    repository: file://../worker\n")
+				writeChart(t, filepath.Join(root, "worker"), "")
+				return umbrella
+			},
+			want: []string{"email-worker [file://] (also as report-worker)"},
+		},
+		{
+			name: "chart depending on itself",
+			setup: func(t *testing.T, root string) string {
+				umbrella := filepath.Join(root, "umbrella")
+				writeChart(t, umbrella, "apiVersion: v2\nname: umbrella\ndependencies:\n  - name: umbrella\n    repository: file://.\n")
+				if err := os.MkdirAll(filepath.Join(umbrella, "charts"), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Symlink("..", filepath.Join(umbrella, "charts", "loop")); err != nil {
+					t.Skipf("symlinks unsupported: %v", err)
+				}
+				return umbrella
+			},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			umbrella := tt.setup(t, t.TempDir())
+			subcharts, err := collectSubcharts(umbrella, true, true, false, "")
+			if err != nil {
+				t.Fatalf("collectSubcharts() error = %v", err)
+			}
+			var got []string
+			for _, sub := range subcharts {
+				got = append(got, sub.label())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("collectSubcharts() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -9,31 +9,58 @@ import (
 	"strings"
 
 	"github.com/scottrigby/helm-list-to-map-plugin/pkg/crd"
+	pkgfs "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
 	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
 	"github.com/scottrigby/helm-list-to-map-plugin/pkg/template"
 )
 
 func runDetect(opts DetectOptions) error {
+	if err := validateGroupBy(opts.GroupBy); err != nil {
+		return err
+	}
 	root, err := findChartRoot(opts.ChartDir)
 	if err != nil {
 		return err
 	}
 
+	// Apply the chart's own config over the user config
+	restore, err := useChartConfig(root)
+	defer restore()
+	if err != nil {
+		return err
+	}
+	if err := validateTypePolicy(); err != nil {
+		return err
+	}
+	if err := validateRules(); err != nil {
+		return err
+	}
+	restoreKube, err := useKubeVersion(opts.KubeVersion)
+	defer restoreKube()
+	if err != nil {
+		return err
+	}
+	restoreSchema, err := useSchemas(opts.SchemaSource, false)
+	defer restoreSchema()
+	if err != nil {
+		return err
+	}
+	defer useConfigDataKey(opts.ConfigDataKey)()
+
 	// Handle recursive detection for umbrella charts
 	if opts.Recursive || opts.IncludeChartsDir || opts.ExpandRemote {
 		return runRecursiveDetect(root, opts)
 	}
 
-	// Load CRDs from plugin config directory
-	if err := loadCRDsFromConfig(); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: loading CRDs: %v\n", err)
-	}
-
 	// Use new programmatic detection via K8s API introspection
 	result, err := k8s.DetectConversionCandidatesFull(root)
 	if err != nil {
 		return err
 	}
+	parseErrs := parseErrors(result.ParseErrors)
+	if _, _, err := loadValuesNode(filepath.Join(root, "values.yaml")); err != nil {
+		parseErrs.add(err)
+	}
 
 	// Also check for user-defined rules (for CRDs)
 	userDetected := scanForUserRules(root)
@@ -54,6 +81,14 @@ func runDetect(opts DetectOptions) error {
 	for _, c := range allDetected {
 		allCandidates = append(allCandidates, c)
 	}
+	sortCandidates(allCandidates)
+
+	// Ignore rules take precedence over auto-detection and user rules
+	allCandidates, ignoredPaths := filterIgnoredCandidates(root, allCandidates)
+	result.Undetected = filterIgnoredUndetected(root, result.Undetected)
+	allCandidates, belowMinItems := filterMinItems(root, allCandidates)
+	allCandidates, askCandidates := filterAskCandidates(allCandidates)
+
 	allCandidates = k8s.CheckCandidatesInValues(root, allCandidates)
 
 	// Separate candidates with values vs template-only
@@ -68,26 +103,15 @@ func runDetect(opts DetectOptions) error {
 
 	// Print candidates with values (will be fully converted)
 	if len(withValues) > 0 {
-		fmt.Println("Detected convertible arrays:")
-		for _, info := range withValues {
-			if opts.Verbose {
-				fmt.Printf("  %s\n", info.ValuesPath)
-				fmt.Printf("    Key:      %s\n", info.MergeKey)
-				if info.ElementType != "" {
-					fmt.Printf("    Type:     %s\n", info.ElementType)
-				}
-				if info.TemplateFile != "" {
-					fmt.Printf("    Template: %s\n", info.TemplateFile)
-				}
-				if info.ResourceKind != "" {
-					fmt.Printf("    Resource: %s\n", info.ResourceKind)
-				}
-			} else {
-				typeInfo := ""
-				if info.ElementType != "" {
-					typeInfo = fmt.Sprintf(", type=%s", info.ElementType)
-				}
-				fmt.Printf("  %s (key=%s%s)\n", info.ValuesPath, info.MergeKey, typeInfo)
+		fmt.Println(green("Detected convertible arrays:"))
+		for _, g := range groupCandidates(withValues, opts.GroupBy) {
+			indent := "  "
+			if g.title != "" {
+				fmt.Printf("  %s:\n", g.title)
+				indent = "    "
+			}
+			for _, info := range g.candidates {
+				printDetectedArray(info, opts.Verbose, indent)
 			}
 		}
 	}
@@ -95,22 +119,66 @@ func runDetect(opts DetectOptions) error {
 	// Print template-only candidates (no values.yaml entry)
 	if len(templateOnly) > 0 {
 		fmt.Println()
-		fmt.Println("Template patterns without values.yaml entries:")
+		fmt.Println(green("Template patterns without values.yaml entries:"))
 		fmt.Println("  These templates reference arrays that don't exist in values.yaml.")
 		fmt.Println("  Convert will still update templates (making them map-ready).")
 		fmt.Println()
-		for _, info := range templateOnly {
-			typeInfo := ""
-			if info.ElementType != "" {
-				typeInfo = fmt.Sprintf(", type=%s", info.ElementType)
+		for _, g := range groupCandidates(templateOnly, opts.GroupBy) {
+			indent := "  "
+			if g.title != "" {
+				fmt.Printf("  %s:\n", g.title)
+				indent = "    "
 			}
-			fmt.Printf("  %s (key=%s%s)\n", info.ValuesPath, info.MergeKey, typeInfo)
-			if opts.Verbose && info.TemplateFile != "" {
-				fmt.Printf("    Template: %s\n", info.TemplateFile)
+			for _, info := range g.candidates {
+				typeInfo := ""
+				if info.ElementType != "" {
+					typeInfo = fmt.Sprintf(", type=%s", info.ElementType)
+				}
+				fmt.Printf("%s%s (key=%s%s)\n", indent, info.ValuesPath, info.MergeKey, typeInfo)
+				if opts.Verbose && info.TemplateFile != "" {
+					fmt.Printf("%s  Template: %s\n", indent, info.TemplateFile)
+				}
 			}
 		}
 	}
 
+	// Print paths excluded by ignore rules
+	if len(ignoredPaths) > 0 {
+		fmt.Println()
+		fmt.Println(yellow("Ignored (config or # list-to-map: ignore):"))
+		for _, p := range ignoredPaths {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+
+	// Print paths with too few items to be worth converting
+	if len(belowMinItems) > 0 {
+		fmt.Println()
+		fmt.Println(yellow(fmt.Sprintf("Below minItems (fewer than %d items):", conf.MinItems)))
+		for _, p := range belowMinItems {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+
+	// Print paths whose type the typePolicy leaves for the user to choose
+	if len(askCandidates) > 0 {
+		fmt.Println()
+		fmt.Println(yellow("Needs confirmation (typePolicy: ask):"))
+		for _, info := range askCandidates {
+			fmt.Printf("  %s (key=%s, type=%s)\n", info.ValuesPath, info.MergeKey, info.ElementType)
+		}
+	}
+
+	// Print paths whose consuming resources disagree on the merge key
+	printConsumerConflicts(withoutRuledConflicts(result.Conflicts, userDetected), "")
+
+	// Print the chart's map-shaped paths next to its remaining lists
+	var lists []string
+	for _, c := range withValues {
+		lists = append(lists, c.ValuesPath)
+	}
+	printShapeConsistency(root, chartShapeConsistency(root, lists))
+
 	// Print warnings for undetected usages, grouped by category
 	if len(result.Undetected) > 0 {
 		// Group by category
@@ -118,12 +186,13 @@ func runDetect(opts DetectOptions) error {
 		k8sNoKeys := filterByCategory(result.Undetected, k8s.CategoryK8sNoKeys)
 		missingCRD := filterByCategory(result.Undetected, k8s.CategoryMissingCRD)
 		unknownType := filterByCategory(result.Undetected, k8s.CategoryUnknownType)
+		notInRelease := filterByCategory(result.Undetected, k8s.CategoryNotInRelease)
 
 		// Arrays with known type but no merge keys (CRD or K8s)
 		knownArrays := append(crdNoKeys, k8sNoKeys...)
 		if len(knownArrays) > 0 {
 			fmt.Println()
-			fmt.Println("Arrays without auto-detected unique keys:")
+			fmt.Println(yellow("Arrays without auto-detected unique keys:"))
 			fmt.Println("  These are confirmed array fields, but lack merge key annotations.")
 			fmt.Println("  Add rules if you want to convert them to maps:")
 			fmt.Println()
@@ -144,8 +213,13 @@ func runDetect(opts DetectOptions) error {
 		// Missing CRDs - we don't know the type
 		if len(missingCRD) > 0 {
 			fmt.Println()
-			fmt.Println("Fields in Custom Resources without loaded CRDs:")
-			fmt.Println("  Load the CRD to determine if these are arrays:")
+			if k8s.ClusterSchema() {
+				fmt.Println(yellow("Fields in resources the cluster doesn't serve:"))
+				fmt.Println("  Install the CRD in the cluster and reload its schema to determine if these are arrays:")
+			} else {
+				fmt.Println(yellow("Fields in Custom Resources without loaded CRDs:"))
+				fmt.Println("  Load the CRD to determine if these are arrays:")
+			}
 			fmt.Println()
 			for _, u := range missingCRD {
 				fmt.Printf("  %s (in %s:%d)\n", u.ValuesPath, u.TemplateFile, u.LineNumber)
@@ -158,7 +232,7 @@ func runDetect(opts DetectOptions) error {
 		// Unknown type - no API info at all
 		if len(unknownType) > 0 {
 			fmt.Println()
-			fmt.Println("Fields with unknown type (may or may not be arrays):")
+			fmt.Println(yellow("Fields with unknown type (may or may not be arrays):"))
 			fmt.Println("  These use toYaml but the resource type couldn't be determined.")
 			fmt.Println("  Review manually and add rules for actual arrays:")
 			fmt.Println()
@@ -171,6 +245,20 @@ func runDetect(opts DetectOptions) error {
 			}
 		}
 
+		// Fields newer than the targeted Kubernetes release
+		if len(notInRelease) > 0 {
+			fmt.Println()
+			fmt.Println(yellow(fmt.Sprintf("Fields not in Kubernetes %s:", k8s.TargetKubeVersion())))
+			fmt.Println("  The release's OpenAPI spec doesn't have these fields, so they are left as-is:")
+			fmt.Println()
+			for _, u := range notInRelease {
+				fmt.Printf("  %s (in %s:%d)\n", u.ValuesPath, u.TemplateFile, u.LineNumber)
+				if opts.Verbose {
+					fmt.Printf("    %s\n", u.Reason)
+				}
+			}
+		}
+
 		// Check if any detected candidates have nested list fields that users should know about
 		nestedListWarnings := findNestedListFieldWarnings(result.Candidates)
 		if len(nestedListWarnings) > 0 && opts.Verbose {
@@ -206,17 +294,20 @@ func runDetect(opts DetectOptions) error {
 		}
 	}
 
+	printDeprecatedAPIs(result.DeprecatedAPIs)
+
 	// Collect unique Custom Resources without loaded CRDs (always shown, not just verbose)
 	missingCRDs, versionMismatches := collectMissingCRDs(result.Undetected)
 
 	// Show version mismatches first (user has CRD but wrong version)
 	if len(versionMismatches) > 0 {
 		fmt.Println()
-		fmt.Printf("Warning: %d Custom Resource type(s) using version not in loaded CRD:\n", len(versionMismatches))
+		fmt.Println(yellow(fmt.Sprintf("Warning: %d Custom Resource type(s) using version not in loaded CRD:", len(versionMismatches))))
 		for _, vm := range versionMismatches {
 			fmt.Printf("  - %s (loaded versions: %s)\n", vm.APIVersionKind, strings.Join(vm.AvailableVersions, ", "))
 		}
 		fmt.Println("Download CRD with matching version or update templates to use available version.")
+		fmt.Println("With both versions loaded, 'helm list-to-map crd diff <group>/<kind> <version> <version>' shows whether they convert differently.")
 	}
 
 	// Show completely missing CRDs with smart suggestions
@@ -261,7 +352,78 @@ func runDetect(opts DetectOptions) error {
 		fmt.Println("No convertible lists detected.")
 	}
 
-	return nil
+	return parseErrs.report()
+}
+
+// printDetectedArray prints a convertible array found in the chart at indent,
+// on one line or, verbose, with its key, type, and where it's rendered
+func printDetectedArray(info k8s.DetectedCandidate, verbose bool, indent string) {
+	if !verbose {
+		typeInfo := ""
+		if info.ElementType != "" {
+			typeInfo = fmt.Sprintf(", type=%s", info.ElementType)
+		}
+		if info.Curated != "" {
+			typeInfo += ", curated=" + info.Curated
+		}
+		fmt.Printf("%s%s (key=%s%s)\n", indent, info.ValuesPath, info.MergeKey, typeInfo)
+		return
+	}
+	fmt.Printf("%s%s\n", indent, info.ValuesPath)
+	fmt.Printf("%s  Key:      %s\n", indent, info.MergeKey)
+	if info.Curated != "" {
+		rule := info.Curated + " curated rules"
+		if info.Synthetic {
+			rule += "; the key only names entries and isn't rendered"
+		}
+		fmt.Printf("%s  Rule:     %s\n", indent, rule)
+	}
+	if info.ElementType != "" {
+		fmt.Printf("%s  Type:     %s\n", indent, info.ElementType)
+	}
+	if doc := k8s.ElementTypeDoc(info.ElementType); doc != "" {
+		fmt.Printf("%s  About:    %s\n", indent, doc)
+	}
+	if doc := k8s.MergeKeyDoc(info.ElementType, info.MergeKey); doc != "" {
+		fmt.Printf("%s  Key note: %s\n", indent, doc)
+	}
+	if info.TemplateFile != "" {
+		fmt.Printf("%s  Template: %s\n", indent, info.TemplateFile)
+	}
+	if info.ResourceKind != "" {
+		fmt.Printf("%s  Resource: %s\n", indent, info.ResourceKind)
+	}
+}
+
+// printDeprecatedAPIs warns about resources using deprecated API versions, and
+// those the target Kubernetes release no longer serves
+func printDeprecatedAPIs(deprecated []k8s.DeprecatedAPI) {
+	if len(deprecated) == 0 {
+		return
+	}
+	target := k8s.TargetKubeVersion()
+	fmt.Println()
+	if target.IsZero() {
+		fmt.Println(yellow("Deprecated API versions:"))
+	} else {
+		fmt.Println(yellow(fmt.Sprintf("Deprecated API versions for Kubernetes %s:", target)))
+	}
+	for _, d := range deprecated {
+		line := fmt.Sprintf("  %s: %s %s deprecated in %s", d.TemplateFile, d.APIVersion, d.Kind, d.Lifecycle.Deprecated)
+		if !d.Lifecycle.Removed.IsZero() {
+			line += fmt.Sprintf(", removed in %s", d.Lifecycle.Removed)
+		}
+		if d.Removed {
+			line = red(line + " (not served)")
+		}
+		fmt.Println(line)
+		if d.Lifecycle.Replacement != "" {
+			fmt.Printf("    Use %s\n", d.Lifecycle.Replacement)
+		}
+	}
+	if target.IsZero() {
+		fmt.Println("  Use --kube-version to check against the release the chart targets.")
+	}
 }
 
 // nestedListWarning represents a detected field that has nested list fields
@@ -302,6 +464,19 @@ type CRDStatus struct {
 	AvailableVersions []string // Versions available in loaded CRD (if any)
 }
 
+// filterIgnoredUndetected drops undetected usages whose paths are ignored by config
+// or opted out in values.yaml
+func filterIgnoredUndetected(chartRoot string, undetected []k8s.UndetectedUsage) []k8s.UndetectedUsage {
+	optOut := valuesOptOutPaths(chartRoot)
+	var result []k8s.UndetectedUsage
+	for _, u := range undetected {
+		if !isIgnoredPath(u.ValuesPath) && !isOptedOut(u.ValuesPath, optOut) {
+			result = append(result, u)
+		}
+	}
+	return result
+}
+
 // filterByCategory returns undetected usages matching the given category
 func filterByCategory(undetected []k8s.UndetectedUsage, category k8s.UndetectedCategory) []k8s.UndetectedUsage {
 	var result []k8s.UndetectedUsage
@@ -395,28 +570,39 @@ func collectMissingCRDs(undetected []k8s.UndetectedUsage) (missing []string, ver
 	return missing, versionMismatches
 }
 
-// scanForUserRules scans templates using user-defined rules (for CRDs)
-func scanForUserRules(chartRoot string) []k8s.DetectedCandidate {
-	var detected []k8s.DetectedCandidate
-	seen := make(map[string]bool)
-
-	// Only process user-defined rules (not built-in ones)
-	if len(conf.Rules) == 0 {
-		return detected
-	}
+// templateListUsage is a .Values path rendered as a list in a template
+type templateListUsage struct {
+	ValuesPath   string // Path in values.yaml (e.g., "istio.virtualService.http")
+	TemplateFile string // Path relative to the chart root (e.g., "templates/vs.yaml")
+	LineNumber   int    // 1-based line of the directive
+	Pattern      string // "toYaml", "with", or "range"
+}
 
-	tdir := filepath.Join(chartRoot, "templates")
+// Regex patterns for detecting list-rendering in templates
+var (
+	reRuleToYaml = regexp.MustCompile(`\{\{-?\s*toYaml\s+\.Values\.([a-zA-Z0-9_.]+)\s*\|`)
+	reRuleWith   = regexp.MustCompile(`\{\{-?\s*with\s+\.Values\.([a-zA-Z0-9_.]+)\s*\}\}`)
+	reRuleRange  = regexp.MustCompile(`\{\{-?\s*range\s+.*?\.Values\.([a-zA-Z0-9_.]+)\s*\}\}`)
+)
 
-	// Regex patterns for detecting list-rendering in templates
-	reToYaml := regexp.MustCompile(`\{\{-?\s*toYaml\s+\.Values\.([a-zA-Z0-9_.]+)\s*\|`)
-	reWith := regexp.MustCompile(`\{\{-?\s*with\s+\.Values\.([a-zA-Z0-9_.]+)\s*\}\}`)
-	reRange := regexp.MustCompile(`\{\{-?\s*range\s+.*?\.Values\.([a-zA-Z0-9_.]+)\s*\}\}`)
+// scanTemplateListUsages finds every .Values path rendered via toYaml, with, or range
+// in the chart's templates, in file and line order
+func scanTemplateListUsages(chartRoot string) []templateListUsage {
+	var usages []templateListUsage
+	patterns := []struct {
+		name string
+		re   *regexp.Regexp
+	}{
+		{"toYaml", reRuleToYaml},
+		{"with", reRuleWith},
+		{"range", reRuleRange},
+	}
 
-	_ = filepath.WalkDir(tdir, func(path string, d fs.DirEntry, err error) error {
+	_ = pkgfs.WalkTemplates(pkgfs.OSFileSystem{}, chartRoot, func(path string, d fs.DirEntry, err error) error {
 		if err != nil || d.IsDir() {
 			return err
 		}
-		if !strings.HasSuffix(path, ".yaml") && !strings.HasSuffix(path, ".yml") && !strings.HasSuffix(path, ".tpl") {
+		if !pkgfs.IsTemplate(path) {
 			return nil
 		}
 
@@ -424,69 +610,116 @@ func scanForUserRules(chartRoot string) []k8s.DetectedCandidate {
 		if err != nil {
 			return err
 		}
-		content := string(data)
-
-		// Extract all .Values.* paths from template patterns
-		paths := make(map[string]bool)
-		for _, match := range reToYaml.FindAllStringSubmatch(content, -1) {
-			if len(match) > 1 {
-				paths[match[1]] = true
-			}
-		}
-		for _, match := range reWith.FindAllStringSubmatch(content, -1) {
-			if len(match) > 1 {
-				paths[match[1]] = true
-			}
-		}
-		for _, match := range reRange.FindAllStringSubmatch(content, -1) {
-			if len(match) > 1 {
-				paths[match[1]] = true
+		relPath := rel(chartRoot, path)
+
+		for i, line := range strings.Split(string(data), "\n") {
+			for _, p := range patterns {
+				for _, match := range p.re.FindAllStringSubmatch(line, -1) {
+					usages = append(usages, templateListUsage{
+						ValuesPath:   match[1],
+						TemplateFile: relPath,
+						LineNumber:   i + 1,
+						Pattern:      p.name,
+					})
+				}
 			}
 		}
+		return nil
+	})
 
-		// Check each extracted path against user rules
-		for pathStr := range paths {
-			if seen[pathStr] {
-				continue
-			}
+	return usages
+}
 
-			segments := strings.Split(pathStr, ".")
-			rule := matchRule(segments)
-			if rule == nil {
-				continue
-			}
+// scanForUserRules scans templates using user-defined rules (for CRDs)
+func scanForUserRules(chartRoot string) []k8s.DetectedCandidate {
+	var detected []k8s.DetectedCandidate
+	seen := make(map[string]bool)
 
-			// Determine unique key
-			uniqueKey := rule.UniqueKeys[0]
-			for _, k := range rule.UniqueKeys {
-				if k == "name" {
-					uniqueKey = k
-					break
-				}
-			}
+	// Only process user-defined rules (not built-in ones)
+	if len(conf.Rules) == 0 {
+		return detected
+	}
 
-			seen[pathStr] = true
-			detected = append(detected, k8s.DetectedCandidate{
-				ValuesPath:  pathStr,
-				MergeKey:    uniqueKey,
-				ElementType: "(user rule)",
-				SectionName: getLastPathSegment(pathStr),
-			})
+	// Check each extracted path against user rules
+	for _, usage := range scanTemplateListUsages(chartRoot) {
+		pathStr := usage.ValuesPath
+		if seen[pathStr] {
+			continue
 		}
 
-		return nil
-	})
+		segments := strings.Split(pathStr, ".")
+		rule := matchRule(segments)
+		if rule == nil {
+			continue
+		}
+
+		seen[pathStr] = true
+		c := k8s.DetectedCandidate{
+			ValuesPath:  pathStr,
+			MergeKey:    ruleMergeKey(rule),
+			ElementType: "(user rule)",
+			SectionName: getLastPathSegment(pathStr),
+			Set:         rule.Set,
+		}
+		if rule.KeyStrategy != "" {
+			c.MergeKey, c.MergeKeys, c.KeyStrategy = rule.UniqueKeys[0], rule.UniqueKeys, rule.KeyStrategy
+		}
+		if rule.Shape != nil {
+			c.Rename, c.Scalar = rule.Shape.Rename, rule.Shape.Scalar
+		}
+		detected = append(detected, c)
+	}
 
 	return detected
 }
 
+// ruleMergeKey returns the unique key a rule converts with, preferring "name".
+// Set rules for scalar lists have none.
+func ruleMergeKey(rule *Rule) string {
+	if len(rule.UniqueKeys) == 0 {
+		return ""
+	}
+	uniqueKey := rule.UniqueKeys[0]
+	for _, k := range rule.UniqueKeys {
+		if k == "name" {
+			uniqueKey = k
+			break
+		}
+	}
+	return uniqueKey
+}
+
+// ruleDescription describes how a rule converts its list, e.g. "key=name" or "set"
+func ruleDescription(rule *Rule) string {
+	if rule.Set {
+		return "set of " + setMembers(ruleMergeKey(rule))
+	}
+	if rule.KeyStrategy != "" {
+		return fmt.Sprintf("keys=%s (%s)", strings.Join(rule.UniqueKeys, ","), rule.KeyStrategy)
+	}
+	if rule.Shape != nil {
+		shaped := k8s.DetectedCandidate{Rename: rule.Shape.Rename, Scalar: rule.Shape.Scalar}
+		return fmt.Sprintf("key=%s (%s)", ruleMergeKey(rule), shaped.ShapeDescription())
+	}
+	return "key=" + ruleMergeKey(rule)
+}
+
+// setMembers describes what a set conversion keys on: the items' key field,
+// or the items themselves for scalar lists
+func setMembers(key string) string {
+	if key == "" {
+		return "values"
+	}
+	return key + " values"
+}
+
 // runRecursiveDetect handles subchart detection (--recursive, --include-charts-dir, --expand-remote)
 // It detects convertible paths in all collected subcharts
 func runRecursiveDetect(umbrellaRoot string, opts DetectOptions) error {
 	fmt.Printf("Subchart detection for umbrella chart: %s\n", umbrellaRoot)
 
 	// Collect subcharts based on flags
-	subcharts, err := collectSubcharts(umbrellaRoot, opts.Recursive, opts.IncludeChartsDir, opts.ExpandRemote)
+	subcharts, err := collectSubcharts(umbrellaRoot, opts.Recursive, opts.IncludeChartsDir, opts.ExpandRemote, "")
 	if err != nil {
 		return fmt.Errorf("collecting subcharts: %w", err)
 	}
@@ -501,18 +734,14 @@ func runRecursiveDetect(umbrellaRoot string, opts DetectOptions) error {
 
 	fmt.Printf("\nFound %d subchart(s):\n", len(subcharts))
 	for _, sub := range subcharts {
-		fmt.Printf("  - %s [%s]\n", sub.Name, sub.Source)
-	}
-
-	// Load CRDs from plugin config directory
-	if err := loadCRDsFromConfig(); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: loading CRDs: %v\n", err)
+		fmt.Printf("  - %s\n", sub.label())
 	}
 
 	// Detect in each subchart
 	totalDetected := 0
 	totalSkipped := 0
 	var expandedCharts []SubchartInfo
+	var parseErrs parseErrors
 
 	for _, sub := range subcharts {
 		// Check if subchart exists
@@ -528,16 +757,60 @@ func runRecursiveDetect(umbrellaRoot string, opts DetectOptions) error {
 			expandedCharts = append(expandedCharts, sub)
 		}
 
+		// Apply the subchart's own config (kind hints, rules, and ignores)
+		restore, err := useChartConfig(sub.Path)
+		if err != nil {
+			restore()
+			fmt.Fprintf(os.Stderr, "  Error: %v\n", err)
+			continue
+		}
+		// The subchart's config may set its own schema source; --schema still wins
+		restoreSchema, err := useSchemas(opts.SchemaSource, false)
+		restoreConfig := restore
+		restore = func() { restoreSchema(); restoreConfig() }
+		if err != nil {
+			restore()
+			fmt.Fprintf(os.Stderr, "  Error: %v\n", err)
+			continue
+		}
+
 		// Detect candidates
-		candidates, err := k8s.DetectConversionCandidates(sub.Path)
+		candidates, conflicts, subParseErrs, err := k8s.DetectConversionCandidates(sub.Path)
 		if err != nil {
+			restore()
 			fmt.Fprintf(os.Stderr, "  Error: %v\n", err)
 			continue
 		}
+		for _, fe := range subParseErrs {
+			parseErrs.add(fe)
+		}
+		if _, _, err := loadValuesNode(filepath.Join(sub.Path, "values.yaml")); err != nil {
+			parseErrs.add(err)
+		}
 
 		// Also check for user-defined rules
 		userDetected := scanForUserRules(sub.Path)
 		candidates = append(candidates, userDetected...)
+		printConsumerConflicts(withoutRuledConflicts(conflicts, userDetected), "  ")
+
+		// Ignore rules take precedence over auto-detection and user rules
+		candidates, ignored := filterIgnoredCandidates(sub.Path, candidates)
+		if len(ignored) > 0 {
+			fmt.Println(yellow(fmt.Sprintf("  Ignored (%d): %s", len(ignored), strings.Join(ignored, ", "))))
+		}
+		candidates, below := filterMinItems(sub.Path, candidates)
+		if len(below) > 0 {
+			fmt.Println(yellow(fmt.Sprintf("  Below minItems (%d): %s", len(below), strings.Join(below, ", "))))
+		}
+		candidates, ask := filterAskCandidates(candidates)
+		if len(ask) > 0 {
+			var paths []string
+			for _, c := range ask {
+				paths = append(paths, c.ValuesPath)
+			}
+			fmt.Println(yellow(fmt.Sprintf("  Needs confirmation (%d): %s", len(ask), strings.Join(paths, ", "))))
+		}
+		restore()
 
 		// Check template patterns
 		var pathInfos []template.PathInfo
@@ -546,6 +819,11 @@ func runRecursiveDetect(umbrellaRoot string, opts DetectOptions) error {
 				DotPath:     c.ValuesPath,
 				MergeKey:    c.MergeKey,
 				SectionName: c.SectionName,
+				MergeKeys:   c.MergeKeys,
+				KeyStrategy: c.KeyStrategy,
+				Rename:      c.Rename,
+				Scalar:      c.Scalar,
+				Synthetic:   c.Synthetic,
 			})
 		}
 		matchedPaths := template.CheckTemplatePatterns(sub.Path, pathInfos)
@@ -579,23 +857,36 @@ func runRecursiveDetect(umbrellaRoot string, opts DetectOptions) error {
 		}
 
 		if len(withValues) > 0 {
-			fmt.Printf("  Convertible - has values (%d):\n", len(withValues))
-			for _, c := range withValues {
-				if opts.Verbose {
-					fmt.Printf("    %s\n", c.ValuesPath)
-					fmt.Printf("      Key:  %s\n", c.MergeKey)
-					if c.ElementType != "" {
-						fmt.Printf("      Type: %s\n", c.ElementType)
+			fmt.Println(green(fmt.Sprintf("  Convertible - has values (%d):", len(withValues))))
+			for _, g := range groupCandidates(withValues, opts.GroupBy) {
+				indent := "    "
+				if g.title != "" {
+					fmt.Printf("    %s:\n", g.title)
+					indent = "      "
+				}
+				for _, c := range g.candidates {
+					if opts.Verbose {
+						fmt.Printf("%s%s\n", indent, c.ValuesPath)
+						fmt.Printf("%s  Key:  %s\n", indent, c.MergeKey)
+						if c.ElementType != "" {
+							fmt.Printf("%s  Type: %s\n", indent, c.ElementType)
+						}
+						if doc := k8s.ElementTypeDoc(c.ElementType); doc != "" {
+							fmt.Printf("%s  About: %s\n", indent, doc)
+						}
+						if doc := k8s.MergeKeyDoc(c.ElementType, c.MergeKey); doc != "" {
+							fmt.Printf("%s  Key note: %s\n", indent, doc)
+						}
+					} else {
+						fmt.Printf("%s- %s (key=%s)\n", indent, c.ValuesPath, c.MergeKey)
 					}
-				} else {
-					fmt.Printf("    - %s (key=%s)\n", c.ValuesPath, c.MergeKey)
 				}
 			}
 			totalDetected += len(withValues)
 		}
 
 		if len(templateOnly) > 0 {
-			fmt.Printf("  Convertible - template only (%d):\n", len(templateOnly))
+			fmt.Println(green(fmt.Sprintf("  Convertible - template only (%d):", len(templateOnly))))
 			for _, c := range templateOnly {
 				fmt.Printf("    - %s (key=%s) [no value in values.yaml]\n", c.ValuesPath, c.MergeKey)
 			}
@@ -603,12 +894,15 @@ func runRecursiveDetect(umbrellaRoot string, opts DetectOptions) error {
 		}
 
 		if len(skipped) > 0 {
-			fmt.Printf("  Skipped - unsupported template pattern (%d):\n", len(skipped))
+			fmt.Println(red(fmt.Sprintf("  Skipped - unsupported template pattern (%d):", len(skipped))))
+			var skippedPaths []string
 			for _, c := range skipped {
-				fmt.Printf("    - %s\n", c.ValuesPath)
+				skippedPaths = append(skippedPaths, c.ValuesPath)
 			}
+			printSkippedPaths(sub.Path, skippedPaths, "    ")
 			totalSkipped += len(skipped)
 		}
+		printUnhandledDictArgs(template.UnhandledDictArgs(sub.Path, pathInfos), "  ")
 	}
 
 	// Display warning for expanded remote dependencies
@@ -640,5 +934,5 @@ func runRecursiveDetect(umbrellaRoot string, opts DetectOptions) error {
 		fmt.Printf("  helm list-to-map convert --chart %s%s\n", umbrellaRoot, flagStr)
 	}
 
-	return nil
+	return parseErrs.report()
 }
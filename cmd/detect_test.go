@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -159,6 +160,33 @@ func TestDetectVerbose(t *testing.T) {
 	if !strings.Contains(output, "deployment.yaml") && !strings.Contains(output, "Template:") {
 		t.Errorf("Verbose output should show template information\nGot:\n%s", output)
 	}
+
+	// Verbose mode should describe element types and what their keys mean
+	for _, want := range []string{
+		"About:    VolumeMount describes a mounting of a Volume within a container.",
+		"Key note: the path inside the container, not the volume name",
+		"About:    EnvVar represents an environment variable present in a Container.",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Verbose output missing %q\nGot:\n%s", want, output)
+		}
+	}
+}
+
+// TestDetectNonVerboseOmitsTypeDocs tests that type descriptions are verbose-only
+func TestDetectNonVerboseOmitsTypeDocs(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	output, err := captureOutput(t, func() error {
+		return runDetect(DetectOptions{ChartDir: "testdata/charts/basic"})
+	})
+	if err != nil {
+		t.Fatalf("runDetect failed: %v\nOutput: %s", err, output)
+	}
+	if strings.Contains(output, "About:") || strings.Contains(output, "Key note:") {
+		t.Errorf("Non-verbose output should not describe types\nGot:\n%s", output)
+	}
 }
 
 // TestDetectRecursive tests recursive detection in umbrella charts
@@ -212,3 +240,219 @@ func TestDetectHelp(t *testing.T) {
 		t.Error("ChartDir should be set")
 	}
 }
+
+// TestDetectDeprecatedAPIs tests warnings for deprecated and removed API versions
+func TestDetectDeprecatedAPIs(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	initColor(true)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	cronJob := "apiVersion: batch/v1beta1\nkind: CronJob\nmetadata:\n  name: backup\n"
+	if err := os.WriteFile(filepath.Join(chartPath, "templates", "cronjob.yaml"), []byte(cronJob), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		kubeVersion string
+		want        []string
+		notWant     []string
+	}{
+		{
+			kubeVersion: "",
+			want: []string{
+				"Deprecated API versions:",
+				"cronjob.yaml: batch/v1beta1 CronJob deprecated in 1.21, removed in 1.25\n",
+				"Use batch/v1 CronJob",
+			},
+		},
+		{
+			kubeVersion: "1.20",
+			notWant:     []string{"Deprecated API versions"},
+		},
+		{
+			kubeVersion: "1.27",
+			want: []string{
+				"Deprecated API versions for Kubernetes 1.27:",
+				"removed in 1.25 (not served)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		output, err := captureOutput(t, func() error {
+			return runDetect(DetectOptions{ChartDir: chartPath, KubeVersion: tt.kubeVersion})
+		})
+		if err != nil {
+			t.Fatalf("runDetect(--kube-version %q) failed: %v", tt.kubeVersion, err)
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(output, s) {
+				t.Errorf("--kube-version %q: output should contain %q\nGot:\n%s", tt.kubeVersion, s, output)
+			}
+		}
+		for _, s := range tt.notWant {
+			if strings.Contains(output, s) {
+				t.Errorf("--kube-version %q: output should not contain %q\nGot:\n%s", tt.kubeVersion, s, output)
+			}
+		}
+		// Convertible fields are still reported
+		if !strings.Contains(output, "volumeMounts") {
+			t.Errorf("--kube-version %q: convertible fields missing\nGot:\n%s", tt.kubeVersion, output)
+		}
+	}
+}
+
+// TestDetectWorkloads tests detection in the nested pod templates of Jobs,
+// CronJobs, StatefulSets, and DaemonSets
+func TestDetectWorkloads(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	output, err := captureOutput(t, func() error {
+		return runDetect(DetectOptions{ChartDir: "testdata/charts/workloads", Verbose: true})
+	})
+	if err != nil {
+		t.Fatalf("runDetect failed: %v\nOutput: %s", err, output)
+	}
+
+	for _, want := range []string{
+		"  cronjob.env\n    Key:      name\n",
+		"  cronjob.volumeMounts\n    Key:      mountPath\n",
+		"  cronjob.volumes\n    Key:      name\n",
+		"  job.initContainers\n    Key:      name\n",
+		"  job.env\n    Key:      name\n",
+		"  statefulset.env\n    Key:      name\n",
+		"  daemonset.ports\n    Key:      containerPort\n",
+		"  daemonset.volumeMounts\n    Key:      mountPath\n",
+		// Fields of volumeClaimTemplates items resolve through the PVC type
+		"Slice field spec.volumeClaimTemplates.spec.accessModes has no patchMergeKey",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q\nGot:\n%s", want, output)
+		}
+	}
+	// A map under an item's dash-line key isn't a list of unknown type
+	if strings.Contains(output, "statefulset.storage.labels") {
+		t.Errorf("statefulset.storage.labels should resolve to a map, not be reported\nGot:\n%s", output)
+	}
+}
+
+func TestDetectGroupBy(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	tests := []struct {
+		groupBy string
+		want    string
+	}{
+		{groupByPath, "Detected convertible arrays:\n  cronjob.env (key=name, type=corev1.EnvVar)\n  cronjob.volumeMounts"},
+		{groupByTemplate, "  templates/daemonset.yaml:\n    daemonset.ports (key=containerPort, type=corev1.ContainerPort)\n    daemonset.volumeMounts (key=mountPath, type=corev1.VolumeMount)\n  templates/job.yaml:\n"},
+		{groupByResource, "  Job (templates/job.yaml):\n    job.env (key=name, type=corev1.EnvVar)\n    job.initContainers (key=name, type=corev1.Container)\n  StatefulSet (templates/statefulset.yaml):\n    statefulset.env"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.groupBy, func(t *testing.T) {
+			output, err := captureOutput(t, func() error {
+				return runDetect(DetectOptions{ChartDir: "testdata/charts/workloads", GroupBy: tt.groupBy})
+			})
+			if err != nil {
+				t.Fatalf("runDetect failed: %v\nOutput: %s", err, output)
+			}
+			if !strings.Contains(output, tt.want) {
+				t.Errorf("output should contain %q\nGot:\n%s", tt.want, output)
+			}
+		})
+	}
+
+	err := runDetect(DetectOptions{ChartDir: "testdata/charts/workloads", GroupBy: "kind"})
+	if err == nil || !strings.Contains(err.Error(), "invalid --group-by") {
+		t.Errorf("runDetect() error = %v, want invalid --group-by", err)
+	}
+}
+
+// TestDetectGroupBySharedPath tests that a path rendered by several templates
+// is listed under each, and that templates with the same file name in
+// different directories aren't collapsed
+func TestDetectGroupBySharedPath(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	deployment := func(name string) string {
+		return `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: ` + name + `
+spec:
+  template:
+    spec:
+      containers:
+        - name: ` + name + `
+          env:
+            {{- toYaml .Values.env | nindent 12 }}
+          volumeMounts:
+            {{- toYaml .Values.` + name + `.volumeMounts | nindent 12 }}
+`
+	}
+	root := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml":                       "apiVersion: v2\nname: shared\nversion: 0.1.0\n",
+		"values.yaml":                      "env:\n  - name: A\n    value: a\napi:\n  volumeMounts:\n    - name: data\n      mountPath: /data\nworker:\n  volumeMounts:\n    - name: data\n      mountPath: /data\n",
+		"templates/api/deployment.yaml":    deployment("api"),
+		"templates/worker/deployment.yaml": deployment("worker"),
+	}
+	writeChartFiles(t, root, files)
+
+	output, err := captureOutput(t, func() error {
+		return runDetect(DetectOptions{ChartDir: root, GroupBy: groupByTemplate})
+	})
+	if err != nil {
+		t.Fatalf("runDetect failed: %v\nOutput: %s", err, output)
+	}
+	for _, want := range []string{
+		"  templates/api/deployment.yaml:\n    api.volumeMounts (key=mountPath, type=corev1.VolumeMount)\n    env (key=name, type=corev1.EnvVar)\n",
+		"  templates/worker/deployment.yaml:\n    env (key=name, type=corev1.EnvVar)\n    worker.volumeMounts (key=mountPath, type=corev1.VolumeMount)\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q\nGot:\n%s", want, output)
+		}
+	}
+}
+
+// TestDetectConfigData tests that lists written into ConfigMap and Secret data
+// are only detected when a config data key is set
+func TestDetectConfigData(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := "testdata/charts/config-data"
+	output, err := captureOutput(t, func() error {
+		return runDetect(DetectOptions{ChartDir: chartPath})
+	})
+	if err != nil {
+		t.Fatalf("runDetect failed: %v\nOutput: %s", err, output)
+	}
+	if strings.Contains(output, "Detected convertible arrays") {
+		t.Errorf("config data lists should not be detected by default\nGot:\n%s", output)
+	}
+
+	output, err = captureOutput(t, func() error {
+		return runDetect(DetectOptions{ChartDir: chartPath, ConfigDataKey: "name"})
+	})
+	if err != nil {
+		t.Fatalf("runDetect failed: %v\nOutput: %s", err, output)
+	}
+	for _, want := range []string{
+		"appConfig.servers (key=name, type=ConfigMap data)",
+		"appConfig.credentials (key=name, type=Secret data)",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q\nGot:\n%s", want, output)
+		}
+	}
+	// Only lists whose items all hold the key are config data lists: not
+	// upstreams, keyed by id, nor the settings map beside them
+	for _, unwanted := range []string{"appConfig.upstreams (key=", "appConfig.settings (key="} {
+		if strings.Contains(output, unwanted) {
+			t.Errorf("output should not contain %q\nGot:\n%s", unwanted, output)
+		}
+	}
+}
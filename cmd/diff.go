@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffOp is the kind of a line in a line diff
+type diffOp byte
+
+const (
+	diffEqual  diffOp = ' '
+	diffDelete diffOp = '-'
+	diffInsert diffOp = '+'
+)
+
+// diffLine is a single line of a line diff
+type diffLine struct {
+	Op   diffOp
+	Text string
+}
+
+// diffLines computes a minimal line diff between a and b using the longest
+// common subsequence. Inputs are small (single edits or files), so the
+// quadratic table is fine.
+func diffLines(a, b []string) []diffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []diffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, diffLine{diffEqual, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, diffLine{diffDelete, a[i]})
+			i++
+		default:
+			out = append(out, diffLine{diffInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, diffLine{diffDelete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		out = append(out, diffLine{diffInsert, b[j]})
+	}
+	return out
+}
+
+// printDiff prints a line diff, with removed lines in red and added lines in green
+func printDiff(lines []diffLine) {
+	for _, l := range lines {
+		switch l.Op {
+		case diffDelete:
+			fmt.Println(red("-" + l.Text))
+		case diffInsert:
+			fmt.Println(green("+" + l.Text))
+		default:
+			fmt.Println(" " + l.Text)
+		}
+	}
+}
+
+// diffHunk is a run of changed lines with surrounding context
+type diffHunk struct {
+	Line  int // 1-based line number of the first line in the original
+	Lines []diffLine
+}
+
+// diffHunks groups a line diff into hunks, keeping up to context unchanged
+// lines around each change and dropping the rest
+func diffHunks(lines []diffLine, context int) []diffHunk {
+	var hunks []diffHunk
+	var cur *diffHunk
+	lastChange := -1
+	origLine := 1
+	for i, l := range lines {
+		if l.Op != diffEqual {
+			if cur == nil || i-lastChange > 2*context {
+				start := max(i-context, lastChange+1)
+				if cur != nil {
+					cur.Lines = append(cur.Lines, lines[lastChange+1:lastChange+1+context]...)
+					hunks = append(hunks, *cur)
+				}
+				cur = &diffHunk{Line: origLine - countOrig(lines[start:i])}
+				cur.Lines = append(cur.Lines, lines[start:i]...)
+			} else {
+				cur.Lines = append(cur.Lines, lines[lastChange+1:i]...)
+			}
+			cur.Lines = append(cur.Lines, l)
+			lastChange = i
+		}
+		if l.Op != diffInsert {
+			origLine++
+		}
+	}
+	if cur != nil {
+		end := min(lastChange+1+context, len(lines))
+		cur.Lines = append(cur.Lines, lines[lastChange+1:end]...)
+		hunks = append(hunks, *cur)
+	}
+	return hunks
+}
+
+// countOrig counts the lines in a diff that come from the original
+func countOrig(lines []diffLine) int {
+	n := 0
+	for _, l := range lines {
+		if l.Op != diffInsert {
+			n++
+		}
+	}
+	return n
+}
+
+// printFileDiff prints the changes between two versions of a file as diff hunks
+func printFileDiff(name, before, after string) {
+	fmt.Printf("\n=== %s (dry-run diff) ===\n", name)
+	printHunks(name, before, after)
+}
+
+// printHunks prints the diff hunks between two versions of a file
+func printHunks(name, before, after string) {
+	a := strings.Split(strings.TrimSuffix(before, "\n"), "\n")
+	b := strings.Split(strings.TrimSuffix(after, "\n"), "\n")
+	for _, h := range diffHunks(diffLines(a, b), 3) {
+		fmt.Println(cyan(fmt.Sprintf("@@ %s:%d @@", name, h.Line)))
+		printDiff(h.Lines)
+	}
+}
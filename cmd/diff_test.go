@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{
+			name: "identical",
+			a:    "env:\n  A: 1",
+			b:    "env:\n  A: 1",
+			want: " env:|   A: 1",
+		},
+		{
+			name: "list to map",
+			a:    "env:\n  - name: A\n    value: x",
+			b:    "# comment\nenv:\n  A:\n    value: x",
+			want: "+# comment| env:|-  - name: A|+  A:|     value: x",
+		},
+		{
+			name: "all removed",
+			a:    "a\nb",
+			b:    "",
+			want: "-a|-b|+",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got []string
+			for _, l := range diffLines(strings.Split(tt.a, "\n"), strings.Split(tt.b, "\n")) {
+				got = append(got, string(l.Op)+l.Text)
+			}
+			if strings.Join(got, "|") != tt.want {
+				t.Errorf("diffLines() = %q, want %q", strings.Join(got, "|"), tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffHunks(t *testing.T) {
+	t.Parallel()
+
+	a := strings.Split("1\n2\n3\n4\n5\n6\n7\n8\n9\n10", "\n")
+	b := strings.Split("1\n2\nthree\n4\n5\n6\n7\n8\n9\nten", "\n")
+	hunks := diffHunks(diffLines(a, b), 1)
+	if len(hunks) != 2 {
+		t.Fatalf("diffHunks() returned %d hunks, want 2", len(hunks))
+	}
+
+	tests := []struct {
+		line int
+		want string
+	}{
+		{2, " 2|-3|+three| 4"},
+		{9, " 9|-10|+ten"},
+	}
+	for i, tt := range tests {
+		var got []string
+		for _, l := range hunks[i].Lines {
+			got = append(got, string(l.Op)+l.Text)
+		}
+		if hunks[i].Line != tt.line || strings.Join(got, "|") != tt.want {
+			t.Errorf("hunk %d = line %d %q, want line %d %q", i, hunks[i].Line, strings.Join(got, "|"), tt.line, tt.want)
+		}
+	}
+}
+
+func TestColorize(t *testing.T) {
+	original := colorEnabled
+	defer func() { colorEnabled = original }()
+
+	colorEnabled = false
+	if got := red("skipped"); got != "skipped" {
+		t.Errorf("red() with color disabled = %q, want plain text", got)
+	}
+
+	colorEnabled = true
+	if got := green("ok"); got != ansiGreen+"ok"+ansiReset {
+		t.Errorf("green() with color enabled = %q", got)
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	initColor(false)
+	if colorEnabled {
+		t.Error("initColor should disable color when NO_COLOR is set")
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/transform"
+	"gopkg.in/yaml.v3"
+)
+
+// valuesDifference is a field whose value differs between an original values
+// file, once converted, and the converted file it's compared with
+type valuesDifference struct {
+	Path   string // dot path, with list items as [index]
+	Reason string
+}
+
+// runDiffValues checks that a converted values file holds the same values as
+// the original list-style file, by converting the original's lists the same
+// way and comparing the two field by field, so map entries are matched by key
+// regardless of the order of the original items.
+func runDiffValues(opts DiffValuesOptions) error {
+	candidates := make(map[string]k8s.DetectedCandidate)
+	if opts.MigrationFile != "" {
+		recorded, err := migrationCandidates("", opts.MigrationFile)
+		if err != nil {
+			return err
+		}
+		for p, c := range recorded {
+			candidates[p] = c
+		}
+	}
+	if strings.TrimSpace(opts.Paths) != "" {
+		given, err := parseValuesPaths(opts.Paths)
+		if err != nil {
+			return err
+		}
+		for p, c := range given {
+			candidates[p] = c
+		}
+	}
+
+	origDoc, origRaw, err := loadValuesNode(opts.Original)
+	if err != nil {
+		return err
+	}
+	var original, converted any
+	if err := origDoc.Decode(&original); err != nil {
+		return fmt.Errorf("reading %s: %w", opts.Original, err)
+	}
+	convDoc, _, err := loadValuesNode(opts.Converted)
+	if err != nil {
+		return err
+	}
+	if err := convDoc.Decode(&converted); err != nil {
+		return fmt.Errorf("reading %s: %w", opts.Converted, err)
+	}
+	original, converted = normalizeValue(original), normalizeValue(converted)
+
+	// Lists converted by hand are keyed by whichever field matches the map keys
+	inferred := make(map[string]bool)
+	inferCandidates(original, converted, nil, candidates, inferred)
+
+	candidates, merged := withoutMergedLists(origDoc, candidates)
+	printMergedLists(os.Stderr, merged, "")
+	var edits []transform.ArrayEdit
+	transform.FindArrayEdits(origDoc, nil, candidates, &edits)
+	var expected any
+	if err := yaml.Unmarshal(transform.ApplyLineEdits(origRaw, edits), &expected); err != nil {
+		return fmt.Errorf("converting %s: %w", opts.Original, err)
+	}
+	expected = normalizeValue(expected)
+
+	var diffs []valuesDifference
+	compareValues(expected, converted, "", &diffs)
+
+	if len(edits) > 0 {
+		fmt.Println("Converted paths:")
+		sort.Slice(edits, func(i, j int) bool { return edits[i].Candidate.ValuesPath < edits[j].Candidate.ValuesPath })
+		for _, e := range edits {
+			fmt.Printf("  %s (%s)\n", e.Candidate.ValuesPath, candidateKeyDescription(e.Candidate, inferred[e.Candidate.ValuesPath]))
+		}
+		fmt.Println()
+	}
+
+	if len(diffs) == 0 {
+		fmt.Println(green(fmt.Sprintf("No differences: %s holds the same values as %s.", opts.Converted, opts.Original)))
+		return nil
+	}
+	fmt.Println(red(fmt.Sprintf("Differences from %s, once converted, in %s:", opts.Original, opts.Converted)))
+	for _, d := range diffs {
+		fmt.Printf("  %s: %s\n", d.Path, d.Reason)
+	}
+	return fmt.Errorf("%d field(s) differ", len(diffs))
+}
+
+// candidateKeyDescription describes how a path was converted, e.g. "keyed by name"
+func candidateKeyDescription(c k8s.DetectedCandidate, inferred bool) string {
+	desc := "keyed by " + c.MergeKey
+	switch {
+	case c.Set:
+		desc = "a set"
+	case c.KeyStrategy != "":
+		desc = fmt.Sprintf("keyed by %s, %s", strings.Join(c.MergeKeys, ", "), c.KeyStrategy)
+	}
+	if inferred {
+		desc += ", inferred"
+	}
+	return desc
+}
+
+// normalizeValue returns v with maps keyed by strings throughout. YAML keys
+// like ports (80:) decode as numbers, but key map entries the same as strings.
+func normalizeValue(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, e := range t {
+			t[k] = normalizeValue(e)
+		}
+		return t
+	case map[any]any:
+		m := make(map[string]any, len(t))
+		for k, e := range t {
+			m[fmt.Sprint(k)] = normalizeValue(e)
+		}
+		return m
+	case []any:
+		for i, e := range t {
+			t[i] = normalizeValue(e)
+		}
+		return t
+	}
+	return v
+}
+
+// inferCandidates adds a candidate for each path, not already in candidates,
+// that is a list in original and a map in converted, keyed by the item field
+// whose values are the map's keys. Paths are followed through maps only.
+func inferCandidates(original, converted any, path []string, candidates map[string]k8s.DetectedCandidate, inferred map[string]bool) {
+	om, ok := original.(map[string]any)
+	if !ok {
+		return
+	}
+	cm, ok := converted.(map[string]any)
+	if !ok {
+		return
+	}
+	for k, ov := range om {
+		cv, ok := cm[k]
+		if !ok {
+			continue
+		}
+		p := append(path[:len(path):len(path)], k)
+		dp := strings.Join(p, ".")
+		items, isList := ov.([]any)
+		entries, isMap := cv.(map[string]any)
+		if _, known := candidates[dp]; known || !isList || !isMap {
+			inferCandidates(ov, cv, p, candidates, inferred)
+			continue
+		}
+		if c, ok := inferCandidate(dp, items, entries); ok {
+			candidates[dp] = c
+			inferred[dp] = true
+		}
+	}
+}
+
+// inferCandidate returns the conversion of items to entries: a set if the
+// items are scalars and every entry is true, otherwise a map keyed by the
+// item field holding a distinct scalar in every item that matches the most
+// entry keys. Items and entries added or removed by hand are left to the
+// comparison to report.
+func inferCandidate(path string, items []any, entries map[string]any) (k8s.DetectedCandidate, bool) {
+	parts := strings.Split(path, ".")
+	c := k8s.DetectedCandidate{ValuesPath: path, SectionName: parts[len(parts)-1]}
+	if len(items) == 0 || len(entries) == 0 {
+		return c, false
+	}
+
+	set := true
+	for _, e := range entries {
+		if e != true {
+			set = false
+			break
+		}
+	}
+	if set {
+		for _, item := range items {
+			if _, ok := entries[fmt.Sprint(item)]; ok && item != nil && !isCompound(item) {
+				c.Set = true
+				return c, true
+			}
+		}
+	}
+
+	first, ok := items[0].(map[string]any)
+	if !ok {
+		return c, false
+	}
+	fields := make([]string, 0, len(first))
+	for f := range first {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	best := 0
+	for _, f := range fields {
+		if n := keyMatches(items, entries, f); n > best {
+			c.MergeKey, best = f, n
+		}
+	}
+	return c, best > 0
+}
+
+// keyMatches returns how many items have a field whose value is a key of
+// entries, or 0 if an item lacks the field or shares its value with another
+func keyMatches(items []any, entries map[string]any, field string) int {
+	keyed := keyedItems(items, field)
+	if keyed == nil {
+		return 0
+	}
+	n := 0
+	for k := range keyed {
+		if _, ok := entries[k]; ok {
+			n++
+		}
+	}
+	return n
+}
+
+// compareValues records the differences between want, the converted original,
+// and got, the converted file, below path. Map entries are matched by key and
+// list items by position.
+func compareValues(want, got any, path string, diffs *[]valuesDifference) {
+	if isEmptyCollection(want) && isEmptyCollection(got) {
+		// An empty list renders the same as an empty map
+		return
+	}
+	if want == nil && isEmptyCollection(got) {
+		// convert turns a null list in the chart's own values.yaml into {}
+		return
+	}
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			*diffs = append(*diffs, valuesDifference{path, fmt.Sprintf("a map in the original, %s in the converted file", describeKind(got))})
+			return
+		}
+		for _, k := range unionKeys(w, g) {
+			wv, inWant := w[k]
+			gv, inGot := g[k]
+			p := joinValuesPath(path, k)
+			switch {
+			case !inGot:
+				*diffs = append(*diffs, valuesDifference{p, "only in the original: " + describeValue(wv)})
+			case !inWant:
+				*diffs = append(*diffs, valuesDifference{p, "only in the converted file: " + describeValue(gv)})
+			default:
+				compareValues(wv, gv, p, diffs)
+			}
+		}
+	case []any:
+		g, ok := got.([]any)
+		if !ok {
+			reason := fmt.Sprintf("a list in the original, %s in the converted file", describeKind(got))
+			if _, isMap := got.(map[string]any); isMap {
+				reason += " (no item field matches its keys; pass the key with --paths)"
+			}
+			*diffs = append(*diffs, valuesDifference{path, reason})
+			return
+		}
+		for i := 0; i < max(len(w), len(g)); i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(g):
+				*diffs = append(*diffs, valuesDifference{p, "only in the original: " + describeValue(w[i])})
+			case i >= len(w):
+				*diffs = append(*diffs, valuesDifference{p, "only in the converted file: " + describeValue(g[i])})
+			default:
+				compareValues(w[i], g[i], p, diffs)
+			}
+		}
+	default:
+		if !reflect.DeepEqual(want, got) {
+			*diffs = append(*diffs, valuesDifference{path, fmt.Sprintf("%s in the original, %s in the converted file", describeValue(want), describeValue(got))})
+		}
+	}
+}
+
+// keyedItems returns list items by the value of their key field, or nil if
+// an item isn't a map with a distinct scalar key
+func keyedItems(items []any, key string) map[string]any {
+	keyed := make(map[string]any, len(items))
+	for _, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v, ok := m[key]
+		if !ok || v == nil || isCompound(v) {
+			return nil
+		}
+		k := fmt.Sprint(v)
+		if _, dup := keyed[k]; dup {
+			return nil
+		}
+		keyed[k] = item
+	}
+	return keyed
+}
+
+// unionKeys returns the keys of a and b, sorted
+func unionKeys(a, b map[string]any) []string {
+	var keys []string
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// joinValuesPath appends a map key to a dot path, bracketing keys with dots
+// (e.g., annotations["example.com/owner"])
+func joinValuesPath(path, key string) string {
+	if strings.ContainsAny(key, ". ") {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func isCompound(v any) bool {
+	switch v.(type) {
+	case map[string]any, []any:
+		return true
+	}
+	return false
+}
+
+func isEmptyCollection(v any) bool {
+	switch t := v.(type) {
+	case map[string]any:
+		return len(t) == 0
+	case []any:
+		return len(t) == 0
+	}
+	return false
+}
+
+// describeKind describes a value by its kind: a map, a list, or the value
+func describeKind(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "a map"
+	case []any:
+		return "a list"
+	}
+	return describeValue(v)
+}
+
+// describeValue describes a value in a difference: scalars and small
+// collections in JSON, larger collections by their kind and size
+func describeValue(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		if len(t) > 3 {
+			return fmt.Sprintf("a map of %d entries", len(t))
+		}
+	case []any:
+		if len(t) > 3 {
+			return fmt.Sprintf("a list of %d items", len(t))
+		}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
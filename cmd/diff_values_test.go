@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffValues(t *testing.T) {
+	dir := t.TempDir()
+	original := filepath.Join(dir, "values-old.yaml")
+	if err := os.WriteFile(original, []byte(`env:
+  - name: B
+    value: "2"
+  - name: A
+    value: "1"
+service:
+  ports:
+    - port: 80
+      name: http
+pullSecrets:
+  - regcred
+args:
+  - --verbose
+tolerations: []
+volumes:
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Converted by hand: maps in another order, a list that was already
+	// empty, and a null default convert made {}
+	converted := filepath.Join(dir, "values.yaml")
+	if err := os.WriteFile(converted, []byte(`tolerations: {}
+volumes: {}
+args:
+  - --verbose
+pullSecrets:
+  regcred: true
+service:
+  ports:
+    80:
+      name: http
+env:
+  A:
+    value: "1"
+  B:
+    value: "2"
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runDiffValues(DiffValuesOptions{Original: original, Converted: converted})
+	})
+	if err != nil {
+		t.Fatalf("runDiffValues() error = %v\nOutput: %s", err, output)
+	}
+	for _, want := range []string{
+		"env (keyed by name, inferred)",
+		"pullSecrets (a set, inferred)",
+		"service.ports (keyed by port, inferred)",
+		"No differences:",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q, got:\n%s", want, output)
+		}
+	}
+
+	// A value changed, an item dropped, and a field added by hand
+	if err := os.WriteFile(converted, []byte(`tolerations: {}
+volumes: {}
+args:
+  - --debug
+pullSecrets:
+  regcred: true
+service:
+  ports:
+    80:
+      name: web
+      protocol: TCP
+env:
+  A:
+    value: "1"
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err = captureOutput(t, func() error {
+		return runDiffValues(DiffValuesOptions{Original: original, Converted: converted, Paths: "env=name"})
+	})
+	if err == nil || err.Error() != "4 field(s) differ" {
+		t.Fatalf("runDiffValues() error = %v, want 4 differences\nOutput: %s", err, output)
+	}
+	for _, want := range []string{
+		"env (keyed by name)\n",
+		`args[0]: "--verbose" in the original, "--debug" in the converted file`,
+		`env.B: only in the original: {"value":"2"}`,
+		`service.ports.80.name: "http" in the original, "web" in the converted file`,
+		`service.ports.80.protocol: only in the converted file: "TCP"`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "tolerations") {
+		t.Errorf("an empty list matches an empty map, got:\n%s", output)
+	}
+}
+
+func TestDiffValuesUnconvertedList(t *testing.T) {
+	dir := t.TempDir()
+	original := filepath.Join(dir, "a.yaml")
+	converted := filepath.Join(dir, "b.yaml")
+	if err := os.WriteFile(original, []byte("volumes:\n  - name: data\n    emptyDir: {}\nenv:\n  - name: A\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// volumes is left a list, and env is keyed by a field the items don't have
+	if err := os.WriteFile(converted, []byte("volumes:\n  - name: data\n    emptyDir: {}\nenv:\n  B: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err := captureOutput(t, func() error {
+		return runDiffValues(DiffValuesOptions{Original: original, Converted: converted, Paths: "volumes=name"})
+	})
+	if err == nil || err.Error() != "2 field(s) differ" {
+		t.Fatalf("runDiffValues() error = %v, want 2 differences\nOutput: %s", err, output)
+	}
+	for _, want := range []string{
+		"volumes: a map in the original, a list in the converted file",
+		"env: a list in the original, a map in the converted file (no item field matches its keys; pass the key with --paths)",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q, got:\n%s", want, output)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/crd"
+	pkgfs "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/template"
+	"gopkg.in/yaml.v3"
+)
+
+// Doctor check statuses
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// doctorCheck is the outcome of a single environment check
+type doctorCheck struct {
+	Status string // checkOK, checkWarn, or checkFail
+	Name   string // What was checked
+	Detail string // What was found
+	Fix    string // Suggested fix (warnings and failures only)
+}
+
+// doctorSourceTimeout bounds each CRD source reachability probe
+var doctorSourceTimeout = 5 * time.Second
+
+func runDoctor(opts DoctorOptions) error {
+	var checks []doctorCheck
+	checks = append(checks, checkEnvironment()...)
+	checks = append(checks, checkUserConfig()...)
+	checks = append(checks, checkStoredCRDs()...)
+	if opts.Offline || crd.Offline() {
+		checks = append(checks, doctorCheck{Status: checkOK, Name: "CRD sources", Detail: "skipped (--offline)"})
+	} else {
+		checks = append(checks, checkCRDSources()...)
+	}
+	checks = append(checks, checkHelperDrift(opts.ChartDir)...)
+
+	failures := 0
+	for _, c := range checks {
+		fmt.Printf("[%s] %s: %s\n", c.Status, c.Name, c.Detail)
+		if c.Fix != "" {
+			fmt.Printf("       Fix: %s\n", c.Fix)
+		}
+		if c.Status == checkFail {
+			failures++
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("doctor found %d problem(s)", failures)
+	}
+	fmt.Println("\nNo problems found.")
+	return nil
+}
+
+// checkEnvironment reports how HELM_PLUGIN_DIR and HELM_CONFIG_HOME resolve
+func checkEnvironment() []doctorCheck {
+	var checks []doctorCheck
+
+	if dir := os.Getenv("HELM_PLUGIN_DIR"); dir == "" {
+		checks = append(checks, doctorCheck{
+			Status: checkWarn,
+			Name:   "HELM_PLUGIN_DIR",
+			Detail: "not set; bundled files such as common-crds.yaml are looked up in the current directory",
+			Fix:    "run through Helm ('helm list-to-map doctor') rather than invoking the binary directly",
+		})
+	} else if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		checks = append(checks, doctorCheck{
+			Status: checkFail,
+			Name:   "HELM_PLUGIN_DIR",
+			Detail: fmt.Sprintf("%s is not a directory", dir),
+			Fix:    "reinstall the plugin with 'helm plugin install'",
+		})
+	} else {
+		checks = append(checks, doctorCheck{Status: checkOK, Name: "HELM_PLUGIN_DIR", Detail: dir})
+	}
+
+	home := os.Getenv("HELM_CONFIG_HOME")
+	switch {
+	case home != "":
+		checks = append(checks, doctorCheck{Status: checkOK, Name: "HELM_CONFIG_HOME", Detail: home})
+	case os.Getenv("HOME") == "":
+		checks = append(checks, doctorCheck{
+			Status: checkFail,
+			Name:   "HELM_CONFIG_HOME",
+			Detail: "neither HELM_CONFIG_HOME nor HOME is set; config and CRDs resolve relative to the current directory",
+			Fix:    "export HELM_CONFIG_HOME=\"$(helm env HELM_CONFIG_HOME)\"",
+		})
+	default:
+		checks = append(checks, doctorCheck{
+			Status: checkOK,
+			Name:   "HELM_CONFIG_HOME",
+			Detail: fmt.Sprintf("not set, using %s", filepath.Dir(filepath.Dir(defaultUserConfigPath()))),
+		})
+	}
+	return checks
+}
+
+// checkUserConfig verifies the user config file exists, parses, and has valid rules
+func checkUserConfig() []doctorCheck {
+	path := userConfigPath()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []doctorCheck{{Status: checkOK, Name: "Config", Detail: fmt.Sprintf("%s not found (optional)", path)}}
+	}
+	if err != nil {
+		return []doctorCheck{{
+			Status: checkFail,
+			Name:   "Config",
+			Detail: fmt.Sprintf("cannot read %s: %v", path, err),
+			Fix:    "check the file's permissions",
+		}}
+	}
+
+	var c Config
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return []doctorCheck{{
+			Status: checkFail,
+			Name:   "Config",
+			Detail: fmt.Sprintf("cannot parse %s: %v", path, err),
+			Fix:    "fix the YAML syntax, or remove the file and re-add rules with 'helm list-to-map add-rule'",
+		}}
+	}
+
+	checks := []doctorCheck{{Status: checkOK, Name: "Config", Detail: fmt.Sprintf("%s (%d rule(s))", path, len(c.Rules))}}
+	for _, r := range c.Rules {
+		switch {
+		case !strings.HasSuffix(r.PathPattern, "[]"):
+			checks = append(checks, doctorCheck{
+				Status: checkFail,
+				Name:   "Config rule",
+				Detail: fmt.Sprintf("pathPattern %q does not end with []", r.PathPattern),
+				Fix:    fmt.Sprintf("change it to %q in %s", r.PathPattern+"[]", path),
+			})
+		case len(r.UniqueKeys) == 0 && !r.Set:
+			checks = append(checks, doctorCheck{
+				Status: checkFail,
+				Name:   "Config rule",
+				Detail: fmt.Sprintf("%s has no uniqueKeys", r.PathPattern),
+				Fix:    fmt.Sprintf("add a uniqueKeys entry for it in %s", path),
+			})
+		case validateRule(r) != nil:
+			checks = append(checks, doctorCheck{
+				Status: checkFail,
+				Name:   "Config rule",
+				Detail: validateRule(r).Error(),
+				Fix:    fmt.Sprintf("fix the rule's keyStrategy or shape in %s (see the README's rule options)", path),
+			})
+		}
+	}
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := applyProfile(c, name); err != nil {
+			checks = append(checks, doctorCheck{
+				Status: checkFail,
+				Name:   "Config profile",
+				Detail: err.Error(),
+				Fix:    fmt.Sprintf("fix the profile's settings in %s; they take the same form as the rest of the config", path),
+			})
+		}
+	}
+	return checks
+}
+
+// checkStoredCRDs verifies every stored CRD file can be loaded
+func checkStoredCRDs() []doctorCheck {
+	dir := crdConfigDir()
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []doctorCheck{{Status: checkOK, Name: "Stored CRDs", Detail: fmt.Sprintf("%s not found (no CRDs loaded)", dir)}}
+	}
+	if err != nil {
+		return []doctorCheck{{
+			Status: checkFail,
+			Name:   "Stored CRDs",
+			Detail: fmt.Sprintf("cannot read %s: %v", dir, err),
+			Fix:    "check the directory's permissions",
+		}}
+	}
+
+	var checks []doctorCheck
+	loaded := 0
+	for _, e := range entries {
+		if e.IsDir() || (!strings.HasSuffix(e.Name(), ".yaml") && !strings.HasSuffix(e.Name(), ".yml")) {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if err := crd.NewCRDRegistry(pkgfs.OSFileSystem{}).LoadFromFile(path); err != nil {
+			checks = append(checks, doctorCheck{
+				Status: checkFail,
+				Name:   "Stored CRD",
+				Detail: fmt.Sprintf("%s: %v", e.Name(), err),
+				Fix:    fmt.Sprintf("remove %s and reload it with 'helm list-to-map load-crd --force'", path),
+			})
+			continue
+		}
+		loaded++
+	}
+	checks = append([]doctorCheck{{Status: checkOK, Name: "Stored CRDs", Detail: fmt.Sprintf("%d file(s) in %s load cleanly", loaded, dir)}}, checks...)
+	return checks
+}
+
+// checkCRDSources probes each common CRD source with a HEAD request
+func checkCRDSources() []doctorCheck {
+	file := commonCRDsFile()
+	sources, err := crd.LoadCRDSources(file)
+	if err != nil {
+		return []doctorCheck{{
+			Status: checkWarn,
+			Name:   "CRD sources",
+			Detail: err.Error(),
+			Fix:    "run through Helm so HELM_PLUGIN_DIR points at the plugin's bundled common-crds.yaml",
+		}}
+	}
+
+	groups := make([]string, 0, len(sources))
+	for g := range sources {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+
+	client := &http.Client{Timeout: doctorSourceTimeout}
+	var checks []doctorCheck
+	unreachable := 0
+	for _, g := range groups {
+		entry := sources[g]
+		version := entry.DefaultVersion
+		if version == "" {
+			version = "main"
+		}
+		url := entry.GetDownloadURL(version)
+		if url == "" {
+			continue
+		}
+		resp, err := client.Head(url)
+		if err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode >= 400 {
+				err = fmt.Errorf("HTTP %d", resp.StatusCode)
+			}
+		}
+		if err != nil {
+			unreachable++
+			checks = append(checks, doctorCheck{
+				Status: checkWarn,
+				Name:   "CRD source",
+				Detail: fmt.Sprintf("%s unreachable (%v)", g, err),
+				Fix:    "check network and proxy settings, or load CRDs from local files with 'helm list-to-map load-crd <file>'",
+			})
+		}
+	}
+	summary := doctorCheck{Status: checkOK, Name: "CRD sources", Detail: fmt.Sprintf("all sources in %s reachable", file)}
+	if unreachable > 0 {
+		summary.Status = checkWarn
+		summary.Detail = fmt.Sprintf("%d source(s) in %s unreachable", unreachable, file)
+	}
+	return append([]doctorCheck{summary}, checks...)
+}
+
+// checkHelperDrift compares generated helper templates under chartDir (including
+// subcharts) with the helper this version of the plugin would generate
+func checkHelperDrift(chartDir string) []doctorCheck {
+	if _, err := os.Stat(chartDir); err != nil {
+		return []doctorCheck{{Status: checkOK, Name: "Helper templates", Detail: fmt.Sprintf("skipped (%s not found)", chartDir)}}
+	}
+
+	helpers := findHelperFiles(chartDir)
+	if len(helpers) == 0 {
+		return []doctorCheck{{Status: checkOK, Name: "Helper templates", Detail: fmt.Sprintf("none found under %s", chartDir)}}
+	}
+
+	var checks []doctorCheck
+	for _, path := range helpers {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		chartRoot := filepath.Dir(filepath.Dir(path))
+		restore, err := useChartConfig(chartRoot)
+		var o template.Options
+		if err == nil {
+			o, err = templateOptions(chartRoot)
+		}
+		restore()
+		expected := strings.TrimSpace(o.ListMapHelper())
+		if err != nil {
+			checks = append(checks, doctorCheck{
+				Status: checkFail,
+				Name:   "Chart config",
+				Detail: err.Error(),
+				Fix:    fmt.Sprintf("fix the YAML syntax in %s", filepath.Join(chartRoot, chartConfigFile)),
+			})
+			continue
+		}
+		switch v := template.ParseHelperVersion(string(data)); {
+		case v < template.HelperVersion:
+			checks = append(checks, doctorCheck{
+				Status: checkWarn,
+				Name:   "Helper template",
+				Detail: fmt.Sprintf("%s is helper version %d, older than %d", path, v, template.HelperVersion),
+				Fix:    fmt.Sprintf("run 'helm list-to-map upgrade-helpers --chart %s'", chartRoot),
+			})
+		case v > template.HelperVersion:
+			checks = append(checks, doctorCheck{
+				Status: checkWarn,
+				Name:   "Helper template",
+				Detail: fmt.Sprintf("%s is helper version %d, newer than this plugin supports", path, v),
+				Fix:    "update the plugin with 'helm plugin update list-to-map'",
+			})
+		case strings.TrimSpace(string(data)) != expected:
+			checks = append(checks, doctorCheck{
+				Status: checkWarn,
+				Name:   "Helper template",
+				Detail: fmt.Sprintf("%s has local changes", path),
+				Fix:    fmt.Sprintf("review the changes, then run 'helm list-to-map upgrade-helpers --chart %s'", chartRoot),
+			})
+		}
+	}
+	if len(checks) == 0 {
+		return []doctorCheck{{Status: checkOK, Name: "Helper templates", Detail: fmt.Sprintf("%d up to date", len(helpers))}}
+	}
+	return checks
+}
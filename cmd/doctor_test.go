@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/template"
+)
+
+func TestDoctorHealthy(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	t.Setenv("HELM_LIST_TO_MAP_CONFIG", "")
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	helper := strings.TrimSpace(template.Options{}.ListMapHelper()) + "\n"
+	if err := os.WriteFile(filepath.Join(chartPath, "templates", "_listmap.tpl"), []byte(helper), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runDoctor(DoctorOptions{ChartDir: chartPath, Offline: true})
+	})
+	if err != nil {
+		t.Fatalf("runDoctor() error = %v\nOutput: %s", err, output)
+	}
+	for _, want := range []string{"[ok] HELM_CONFIG_HOME", "[ok] Helper templates: 1 up to date", "No problems found."} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q\nGot:\n%s", want, output)
+		}
+	}
+}
+
+func TestDoctorReportsProblems(t *testing.T) {
+	pluginDir := testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	t.Setenv("HELM_LIST_TO_MAP_CONFIG", "")
+
+	config := "rules:\n  - pathPattern: myapp.listeners\n    uniqueKeys: [port]\nprofiles:\n  strict:\n    minItems: 2\n  broken:\n    minItems: many\n"
+	if err := os.WriteFile(filepath.Join(pluginDir, "config.yaml"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	if err := os.WriteFile(filepath.Join(chartPath, "templates", "_listmap.tpl"), []byte("{{- define \"chart.listmap.items\" -}}{{- end -}}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runDoctor(DoctorOptions{ChartDir: chartPath, Offline: true})
+	})
+	if err == nil {
+		t.Fatalf("runDoctor() should fail for an invalid rule\nOutput: %s", output)
+	}
+	for _, want := range []string{
+		`[fail] Config rule: pathPattern "myapp.listeners" does not end with []`,
+		`Fix: change it to "myapp.listeners[]"`,
+		`[fail] Config profile: profile "broken": yaml: unmarshal errors:`,
+		"[warn] Helper template:",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q\nGot:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, `profile "strict"`) {
+		t.Errorf("a valid profile shouldn't be reported\nGot:\n%s", output)
+	}
+}
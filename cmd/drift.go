@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	pkgfs "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/parser"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/template"
+	"gopkg.in/yaml.v3"
+)
+
+// driftFinding is a converted path set or rendered as a list again
+type driftFinding struct {
+	File   string // chart-relative file
+	Line   int
+	Path   string // converted values path
+	Reason string
+}
+
+// runDrift checks that the paths recorded as converted, in the consumer
+// migration map or by templates rendering them through the list-map helper,
+// haven't gone back to lists in values files or templates
+func runDrift(opts DriftOptions) error {
+	root, err := findChartRoot(opts.ChartDir)
+	if err != nil {
+		return err
+	}
+
+	// Apply the chart's own config, for where its templates are
+	restore, err := useChartConfig(root)
+	defer restore()
+	if err != nil {
+		return err
+	}
+
+	converted, source, err := convertedPaths(root, opts.MigrationFile)
+	if err != nil {
+		return err
+	}
+	if len(converted) == 0 {
+		return fmt.Errorf("no converted paths recorded in %s: %s not found and no templates render through the list-map helper", root, opts.MigrationFile)
+	}
+
+	var findings []driftFinding
+	var parseErrs parseErrors
+	valuesFiles := append([]string{filepath.Join(root, "values.yaml")}, opts.ValuesFiles...)
+	for _, f := range valuesFiles {
+		found, err := valuesDrift(root, f, converted)
+		if err != nil {
+			if !parseErrs.add(err) && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		findings = append(findings, found...)
+	}
+	found, err := templateDrift(root, converted)
+	if err != nil {
+		return err
+	}
+	findings = append(findings, found...)
+
+	if len(findings) == 0 {
+		fmt.Println(green(fmt.Sprintf("No drift: the %d converted path(s) recorded in %s are still maps.", len(converted), source)))
+		return parseErrs.report()
+	}
+
+	fmt.Println(red(fmt.Sprintf("Converted paths back in list form (recorded in %s):", source)))
+	paths := make(map[string]bool)
+	for _, f := range findings {
+		fmt.Printf("  %s:%d: %s %s\n", f.File, f.Line, f.Path, f.Reason)
+		paths[f.Path] = true
+	}
+	fmt.Printf("\nConvert them again with 'helm list-to-map convert --chart %s'.\n", root)
+	if err := parseErrs.report(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%d converted path(s) drifted back to lists", len(paths))
+}
+
+// convertedPaths returns the paths converted to maps or sets, keyed by path
+// with the description of their shape, and where they were recorded
+func convertedPaths(root, migrationFile string) (map[string]string, string, error) {
+	converted := make(map[string]string)
+	var sources []string
+
+	if migrationFile != "" {
+		path := migrationFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(root, path)
+		}
+		m, err := readMigrationFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, "", err
+		}
+		for _, f := range m.Fields {
+			if f.New.Shape == "map" || f.New.Shape == "set" {
+				converted[f.New.Path] = migrationShapeDescription(f.New)
+			}
+		}
+		if len(m.Fields) > 0 {
+			sources = append(sources, rel(root, path))
+		}
+	}
+
+	helper := false
+	for _, p := range template.ConvertedPaths(root) {
+		if _, ok := converted[p.DotPath]; !ok {
+			converted[p.DotPath] = "a map keyed by " + p.MergeKey
+			helper = true
+		}
+	}
+	if helper {
+		sources = append(sources, "templates")
+	}
+	return converted, strings.Join(sources, " and "), nil
+}
+
+// migrationShapeDescription describes a converted shape, e.g., "a map keyed by name"
+func migrationShapeDescription(s migrationShape) string {
+	if s.Shape == "set" {
+		return "a set"
+	}
+	if len(s.Keys) > 0 {
+		return "a map keyed by " + strings.Join(s.Keys, ", ")
+	}
+	return "a map keyed by " + s.Key
+}
+
+// valuesDrift finds the converted paths set to non-empty lists in a values
+// file. An empty list renders the same as an empty map, so it isn't drift.
+func valuesDrift(root, path string, converted map[string]string) ([]driftFinding, error) {
+	doc, _, err := loadValuesNode(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	var findings []driftFinding
+	for p, shape := range converted {
+		v := nodeAt(doc.Content[0], strings.Split(p, ".")...)
+		if v == nil || v.Kind != yaml.SequenceNode || len(v.Content) == 0 {
+			continue
+		}
+		findings = append(findings, driftFinding{
+			File:   rel(root, path),
+			Line:   v.Line,
+			Path:   p,
+			Reason: fmt.Sprintf("is a list again (converted to %s)", shape),
+		})
+	}
+	sortDriftFindings(findings)
+	return findings, nil
+}
+
+// templateDrift finds templates rendering converted paths as lists, such as a
+// template added after the conversion that uses toYaml on the path
+func templateDrift(root string, converted map[string]string) ([]driftFinding, error) {
+	var findings []driftFinding
+	seen := make(map[string]bool)
+	err := pkgfs.WalkTemplates(pkgfs.OSFileSystem{}, root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if !pkgfs.IsManifest(path) {
+			return nil
+		}
+		parsed, err := parser.ParseTemplateFile(path)
+		if err != nil {
+			return err
+		}
+		for _, directive := range parsed.Directives {
+			var usages []parser.ValuesUsage
+			if parser.HasIncludeDirective(directive.Content) {
+				usages = parser.FollowIncludeChain(root, directive.Content, directive.WithContext, make(map[string]bool))
+			} else {
+				usages = parser.AnalyzeDirectiveContent(directive.Content, directive.WithContext)
+			}
+			for _, u := range usages {
+				if _, ok := converted[u.ValuesPath]; !ok || !u.IsListUse || u.Pattern == "with" {
+					continue
+				}
+				key := fmt.Sprintf("%s:%d:%s", path, directive.LineNumber, u.ValuesPath)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				findings = append(findings, driftFinding{
+					File:   rel(root, path),
+					Line:   directive.LineNumber,
+					Path:   u.ValuesPath,
+					Reason: "is rendered as a list: " + strings.TrimSpace(directive.Content),
+				})
+			}
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	sortDriftFindings(findings)
+	return findings, err
+}
+
+// sortDriftFindings orders findings by file and line
+func sortDriftFindings(findings []driftFinding) {
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		if findings[i].Line != findings[j].Line {
+			return findings[i].Line < findings[j].Line
+		}
+		return findings[i].Path < findings[j].Path
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+func TestDrift(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	valuesPath := filepath.Join(chartPath, "values.yaml")
+	original, _ := os.ReadFile(valuesPath)
+
+	if _, err := captureOutput(t, func() error {
+		return runDrift(DriftOptions{ChartDir: chartPath, MigrationFile: "values-migration.yaml"})
+	}); err == nil || !strings.Contains(err.Error(), "no converted paths recorded") {
+		t.Errorf("expected an error for an unconverted chart, got %v", err)
+	}
+
+	if _, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak", MigrationFile: "values-migration.yaml"})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	output, err := captureOutput(t, func() error {
+		return runDrift(DriftOptions{ChartDir: chartPath, MigrationFile: "values-migration.yaml"})
+	})
+	if err != nil {
+		t.Fatalf("runDrift failed on a converted chart: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "No drift: the 3 converted path(s) recorded in values-migration.yaml are still maps.") {
+		t.Errorf("unexpected output:\n%s", output)
+	}
+
+	// A merge brings back the list values, and a new template renders env as a list
+	if err := os.WriteFile(valuesPath, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+	job := "apiVersion: batch/v1\nkind: Job\nspec:\n  template:\n    spec:\n      containers:\n        - name: migrate\n          env:\n            {{- toYaml .Values.env | nindent 12 }}\n"
+	if err := os.WriteFile(filepath.Join(chartPath, "templates", "job.yaml"), []byte(job), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ciValues := filepath.Join(chartPath, "ci-values.yaml")
+	if err := os.WriteFile(ciValues, []byte("volumes: []\nenv:\n  - name: CI\n    value: \"true\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err = captureOutput(t, func() error {
+		return runDrift(DriftOptions{ChartDir: chartPath, MigrationFile: "values-migration.yaml", ValuesFiles: []string{ciValues}})
+	})
+	if err == nil || err.Error() != "3 converted path(s) drifted back to lists" {
+		t.Fatalf("expected drift, got %v\nOutput: %s", err, output)
+	}
+	for _, want := range []string{
+		"values.yaml:8: env is a list again (converted to a map keyed by name)",
+		"values.yaml:21: volumeMounts is a list again (converted to a map keyed by mountPath)",
+		"ci-values.yaml:3: env is a list again (converted to a map keyed by name)",
+		"templates/job.yaml:9: env is rendered as a list: {{- toYaml .Values.env | nindent 12 }}",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "ci-values.yaml:1:") {
+		t.Errorf("an empty list renders like an empty map and isn't drift, got:\n%s", output)
+	}
+	if strings.Contains(output, "templates/deployment.yaml") {
+		t.Errorf("templates rendering through the helper haven't drifted, got:\n%s", output)
+	}
+}
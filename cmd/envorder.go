@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/parser"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/template"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/transform"
+	"gopkg.in/yaml.v3"
+)
+
+// envRefRe matches $(VAR) references; an even run of $ is an escaped literal
+var envRefRe = regexp.MustCompile(`(\$+)\(([A-Za-z_][A-Za-z0-9_.-]*)\)`)
+
+// envOrderIssue is an env var whose $(VAR) reference breaks once the env map
+// is rendered in alphabetical order
+type envOrderIssue struct {
+	Path string // Values path of the env list or map
+	Name string // Env var holding the reference
+	Ref  string // Referenced env var, rendered after Name
+}
+
+// envEntry is one env var from a values list or map
+type envEntry struct {
+	Name  string
+	Value string
+}
+
+// isEnvPath reports whether a converted path holds container env vars
+func isEnvPath(valuesPath, elementType string) bool {
+	return strings.Contains(elementType, "EnvVar") ||
+		valuesPath == "env" ||
+		strings.HasSuffix(valuesPath, ".env") ||
+		strings.HasSuffix(valuesPath, "Env")
+}
+
+// mergedChartValues merges override values files over the chart's values file
+// the way helm does for -f: maps are merged, anything else is replaced, and
+// null removes a key. When scope is set, overrides hold the chart's values
+// under that key (e.g., umbrella values for a subchart).
+func mergedChartValues(valuesPath, scope string, overrides []string) (map[string]interface{}, error) {
+	values, err := readValuesMap(valuesPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range overrides {
+		layer, err := readValuesMap(f)
+		if err != nil {
+			return nil, err
+		}
+		if scope != "" {
+			layer, _ = layer[scope].(map[string]interface{})
+		}
+		mergeValues(values, layer)
+	}
+	return values, nil
+}
+
+// readValuesMap reads a values file into a map; a missing or empty file is empty
+func readValuesMap(path string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return values, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, parser.YAMLFileError(path, data, err)
+	}
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+	return values, nil
+}
+
+// mergeValues merges src over dst in place
+func mergeValues(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if v == nil {
+			delete(dst, k)
+			continue
+		}
+		srcMap, srcIsMap := v.(map[string]interface{})
+		dstMap, dstIsMap := dst[k].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeValues(dstMap, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// envEntries returns the env vars at a dot path, whether still a list or
+// already a map keyed by name
+func envEntries(values map[string]interface{}, path string) []envEntry {
+	var node interface{} = values
+	for _, part := range strings.Split(path, ".") {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = m[part]
+	}
+
+	var entries []envEntry
+	switch v := node.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if m, ok := item.(map[string]interface{}); ok {
+				entries = append(entries, envEntry{Name: fmt.Sprint(m["name"]), Value: envValue(m)})
+			}
+		}
+	case map[string]interface{}:
+		for name, item := range v {
+			m, _ := item.(map[string]interface{})
+			entries = append(entries, envEntry{Name: name, Value: envValue(m)})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	}
+	return entries
+}
+
+// envValue returns the literal value of an env var, or "" for valueFrom
+func envValue(m map[string]interface{}) string {
+	if s, ok := m["value"].(string); ok {
+		return s
+	}
+	return ""
+}
+
+// findEnvOrderIssues returns the $(VAR) references between env vars at paths
+// that point at a var rendered later in alphabetical order, which Kubernetes
+// leaves unexpanded
+func findEnvOrderIssues(values map[string]interface{}, paths []string) []envOrderIssue {
+	var issues []envOrderIssue
+	for _, path := range paths {
+		entries := envEntries(values, path)
+		names := make(map[string]bool, len(entries))
+		for _, e := range entries {
+			names[e.Name] = true
+		}
+		for _, e := range entries {
+			for _, match := range envRefRe.FindAllStringSubmatch(e.Value, -1) {
+				ref := match[2]
+				if len(match[1])%2 == 0 || !names[ref] || ref <= e.Name {
+					continue
+				}
+				issues = append(issues, envOrderIssue{Path: path, Name: e.Name, Ref: ref})
+			}
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].Path != issues[j].Path {
+			return issues[i].Path < issues[j].Path
+		}
+		if issues[i].Name != issues[j].Name {
+			return issues[i].Name < issues[j].Name
+		}
+		return issues[i].Ref < issues[j].Ref
+	})
+	return issues
+}
+
+// warnEnvOrder checks the env paths against the merged values and prints any
+// references that break in alphabetical order
+func warnEnvOrder(valuesPath, scope string, overrides, paths []string, indent string) {
+	if len(paths) == 0 {
+		return
+	}
+	values, err := mergedChartValues(valuesPath, scope, overrides)
+	if err != nil {
+		warnf("checking env var order: %v", err)
+		return
+	}
+	issues := findEnvOrderIssues(values, paths)
+	if len(issues) == 0 {
+		return
+	}
+
+	fmt.Println("\n" + indent + yellow("WARNING: Environment variables will be rendered in alphabetical order."))
+	fmt.Println(indent + "These $(VAR) references point at a var rendered after them and will not expand:")
+	for _, i := range issues {
+		fmt.Printf("%s  %s: %s references $(%s)\n", indent, i.Path, i.Name, i.Ref)
+		summary.warn(fmt.Sprintf("%s: %s references $(%s), rendered after it in alphabetical order", i.Path, i.Name, i.Ref))
+	}
+	if len(overrides) > 0 {
+		fmt.Println(indent + "(checked against the chart defaults merged with the given values files)")
+	}
+	fmt.Println(indent + "Rename the vars, or keep the list unconverted. See 'helm list-to-map --help' for details.")
+}
+
+// Policies for env arrays whose $(VAR) references break in alphabetical order
+const (
+	envOrderingSkip           = "skip"            // keep the array as a list
+	envOrderingOrderField     = "order-field"     // add order fields and render by them
+	envOrderingDependencySort = "dependency-sort" // render through the dependency-ordered helper
+)
+
+// validateEnvOrdering checks the configured envOrdering policy
+func validateEnvOrdering() error {
+	switch conf.EnvOrdering {
+	case "", envOrderingSkip, envOrderingOrderField, envOrderingDependencySort:
+		return nil
+	}
+	return fmt.Errorf("invalid envOrdering %q: want %s, %s, or %s", conf.EnvOrdering, envOrderingSkip, envOrderingOrderField, envOrderingDependencySort)
+}
+
+// planEnvOrdering applies the envOrdering policy to the env candidates whose
+// $(VAR) references break in alphabetical order in the merged values. Skipped
+// paths are removed from candidates. It returns the policy applied per path.
+func planEnvOrdering(valuesPath, scope string, overrides []string, candidates map[string]k8s.DetectedCandidate, indent string) map[string]string {
+	if conf.EnvOrdering == "" {
+		return nil
+	}
+	var paths []string
+	for path, c := range candidates {
+		if isEnvPath(path, c.ElementType) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	if len(paths) == 0 {
+		return nil
+	}
+	values, err := mergedChartValues(valuesPath, scope, overrides)
+	if err != nil {
+		warnf("checking env var order: %v", err)
+		return nil
+	}
+	issues := findEnvOrderIssues(values, paths)
+	if len(issues) == 0 {
+		return nil
+	}
+
+	policy := make(map[string]string)
+	for _, i := range issues {
+		policy[i.Path] = conf.EnvOrdering
+	}
+	switch conf.EnvOrdering {
+	case envOrderingSkip:
+		fmt.Println("\n" + indent + yellow("Skipped (env $(VAR) references depend on order, envOrdering: skip):"))
+	case envOrderingOrderField:
+		fmt.Println("\n" + indent + yellow("Adding order fields (env $(VAR) references depend on order, envOrdering: order-field):"))
+	case envOrderingDependencySort:
+		fmt.Println("\n" + indent + yellow("Rendering in dependency order (env $(VAR) references depend on order, envOrdering: dependency-sort):"))
+	}
+	for _, i := range issues {
+		fmt.Printf("%s  %s: %s references $(%s)\n", indent, i.Path, i.Name, i.Ref)
+		if conf.EnvOrdering == envOrderingSkip {
+			delete(candidates, i.Path)
+		}
+	}
+	return policy
+}
+
+// convertedPathInfo returns the template rewrite info for a converted path,
+// rendered through the helper variant its env ordering calls for
+func convertedPathInfo(c k8s.DetectedCandidate, policy string, dependencySort bool) template.PathInfo {
+	env := isEnvPath(c.ValuesPath, c.ElementType)
+	return template.PathInfo{
+		DotPath:     c.ValuesPath,
+		MergeKey:    c.MergeKey,
+		SectionName: c.SectionName,
+		Ordered:     policy == envOrderingDependencySort || (dependencySort && env),
+		OrderField:  policy == envOrderingOrderField,
+		Set:         c.Set,
+		MergeKeys:   c.MergeKeys,
+		KeyStrategy: c.KeyStrategy,
+		Rename:      c.Rename,
+		Scalar:      c.Scalar,
+		Synthetic:   c.Synthetic,
+		NewPath:     c.NewPath,
+	}
+}
+
+// applyOrderFields marks the edits of paths using the order-field policy
+func applyOrderFields(edits []transform.ArrayEdit, policy map[string]string) {
+	for i := range edits {
+		if policy[edits[i].Candidate.ValuesPath] == envOrderingOrderField {
+			edits[i].OrderField = "order"
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+func TestFindEnvOrderIssuesMergedValues(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// Chart defaults are still a list; the escaped reference is a literal
+	chartValues := write("values.yaml", `env:
+  - name: BASE_URL
+    value: https://example.com
+  - name: API_URL
+    value: https://example.com/api
+  - name: ESCAPED
+    value: $$(ZZZ)
+  - name: ZZZ
+    value: z
+`)
+	// The umbrella holds the subchart's values under its name and replaces the list
+	umbrella := write("umbrella.yaml", `app:
+  env:
+    - name: BASE_URL
+      value: https://prod.example.com
+    - name: API_URL
+      value: $(BASE_URL)/api
+`)
+	// An override in map format replaces the list again
+	prod := write("prod.yaml", `app:
+  env:
+    AUTH_URL:
+      value: $(BASE_URL)/auth
+`)
+
+	// The same umbrella values once converted: maps merge key by key
+	umbrellaMap := write("umbrella-map.yaml", `app:
+  env:
+    BASE_URL:
+      value: https://prod.example.com
+`)
+
+	tests := []struct {
+		name      string
+		overrides []string
+		want      []envOrderIssue
+	}{
+		{"chart defaults only", nil, nil},
+		{"umbrella replaces the list", []string{umbrella}, []envOrderIssue{
+			{Path: "env", Name: "API_URL", Ref: "BASE_URL"},
+		}},
+		{"override file merged last", []string{umbrella, prod}, nil},
+		{"map override merged over map", []string{umbrellaMap, prod}, []envOrderIssue{
+			{Path: "env", Name: "AUTH_URL", Ref: "BASE_URL"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := mergedChartValues(chartValues, "app", tt.overrides)
+			if err != nil {
+				t.Fatalf("mergedChartValues() error = %v", err)
+			}
+			got := findEnvOrderIssues(values, []string{"env"})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findEnvOrderIssues() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertEnvOrderingPolicy(t *testing.T) {
+	tests := []struct {
+		policy       string
+		wantValues   string // substring of the converted values.yaml
+		wantTemplate string // substring of the converted deployment template
+	}{
+		{"skip", "  - name: DB_HOST\n    value: $(DB_PORT)", "toYaml .Values.env"},
+		{"order-field", "  DB_HOST:\n    order: 10\n    value: $(DB_PORT)", `include "chart.listmap.items.byorder"`},
+		{"dependency-sort", "  DB_HOST:\n    value: $(DB_PORT)", `include "chart.listmap.items.ordered"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			testutil.SetupTestEnv(t)
+			testutil.ResetGlobalState(t)
+
+			chartPath := copyChartForTest(t, "testdata/charts/basic")
+			valuesPath := filepath.Join(chartPath, "values.yaml")
+			data, _ := os.ReadFile(valuesPath)
+			values := strings.Replace(string(data), "value: localhost", "value: $(DB_PORT)", 1)
+			if err := os.WriteFile(valuesPath, []byte(values), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(chartPath, chartConfigFile), []byte("envOrdering: "+tt.policy+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			output, err := captureOutput(t, func() error {
+				return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+			})
+			if err != nil {
+				t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+			}
+			if !strings.Contains(output, "envOrdering: "+tt.policy) || !strings.Contains(output, "env: DB_HOST references $(DB_PORT)") {
+				t.Errorf("output should report the policy decision, got:\n%s", output)
+			}
+
+			got, _ := os.ReadFile(valuesPath)
+			if !strings.Contains(string(got), tt.wantValues) {
+				t.Errorf("values.yaml missing %q, got:\n%s", tt.wantValues, got)
+			}
+			tpl, _ := os.ReadFile(filepath.Join(chartPath, "templates", "deployment.yaml"))
+			if !strings.Contains(string(tpl), tt.wantTemplate) {
+				t.Errorf("deployment.yaml missing %q, got:\n%s", tt.wantTemplate, tpl)
+			}
+			// Unaffected paths convert as usual
+			if !strings.Contains(string(got), "  /data:\n    name: data") {
+				t.Errorf("volumeMounts should still be converted, got:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestValidateEnvOrdering(t *testing.T) {
+	originalConf := conf
+	defer func() { conf = originalConf }()
+	conf = Config{EnvOrdering: "alphabetical"}
+	if err := validateEnvOrdering(); err == nil {
+		t.Error("validateEnvOrdering() should reject an unknown policy")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/detect"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+)
+
+// Ways detect can group the arrays it reports
+const (
+	groupByPath     = "path"     // one list, by values path
+	groupByTemplate = "template" // under the template file rendering them
+	groupByResource = "resource" // under the resource kind and its template
+)
+
+// candidateGroup is a heading of detect output and the arrays under it
+type candidateGroup struct {
+	title      string
+	candidates []k8s.DetectedCandidate
+}
+
+// validateGroupBy checks a --group-by value
+func validateGroupBy(by string) error {
+	switch by {
+	case "", groupByPath, groupByTemplate, groupByResource:
+		return nil
+	}
+	return fmt.Errorf("invalid --group-by %q: want %s, %s, or %s", by, groupByPath, groupByTemplate, groupByResource)
+}
+
+// groupCandidates groups candidates for detect output, with groups ordered by
+// title and candidates within each by values path. A candidate rendered by
+// several templates is listed under each. Grouping by path (or not at all)
+// gives a single untitled group.
+func groupCandidates(candidates []k8s.DetectedCandidate, by string) []candidateGroup {
+	sorted := append([]k8s.DetectedCandidate(nil), candidates...)
+	sortCandidates(sorted)
+	if by != groupByTemplate && by != groupByResource {
+		return []candidateGroup{{candidates: sorted}}
+	}
+
+	var groups []candidateGroup
+	index := make(map[string]int)
+	for _, c := range sorted {
+		for _, title := range candidateGroupTitles(c, by) {
+			i, ok := index[title]
+			if !ok {
+				i = len(groups)
+				index[title] = i
+				groups = append(groups, candidateGroup{title: title})
+			}
+			groups[i].candidates = append(groups[i].candidates, c)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].title < groups[j].title })
+	return groups
+}
+
+// candidateGroupTitles names the groups of a candidate, one per template
+// rendering it, e.g. "templates/api/deployment.yaml" by template or
+// "Deployment (templates/api/deployment.yaml)" by resource. Templates are
+// named relative to the chart root, so api/deployment.yaml and
+// worker/deployment.yaml are told apart.
+func candidateGroupTitles(c k8s.DetectedCandidate, by string) []string {
+	renderers := c.RenderedBy
+	if len(renderers) == 0 {
+		renderers = []detect.Renderer{{Template: c.TemplatePath, Kind: c.ResourceKind}}
+	}
+	var titles []string
+	seen := make(map[string]bool)
+	for _, r := range renderers {
+		template := r.Template
+		if template == "" {
+			template = "no template"
+		}
+		title := template
+		if by == groupByResource {
+			kind := r.Kind
+			if kind == "" {
+				kind = "Unknown kind"
+			}
+			title = fmt.Sprintf("%s (%s)", kind, template)
+		}
+		if !seen[title] {
+			seen[title] = true
+			titles = append(titles, title)
+		}
+	}
+	return titles
+}
+
+// sortCandidates sorts candidates by values path, then template file, so
+// output built from maps of them is the same from run to run
+func sortCandidates(candidates []k8s.DetectedCandidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].ValuesPath != candidates[j].ValuesPath {
+			return candidates[i].ValuesPath < candidates[j].ValuesPath
+		}
+		return candidates[i].TemplateFile < candidates[j].TemplateFile
+	})
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/transform"
+	"gopkg.in/yaml.v3"
+)
+
+// deployMigration collects the outcome of migrating the deployment config
+// (helmfiles, kustomizations) that supplies values to one chart
+type deployMigration struct {
+	Chart      string                           // Chart name releases must reference
+	Candidates map[string]k8s.DetectedCandidate // Converted list paths of the chart
+	DryRun     bool
+	BackupExt  string
+	Done       map[string]bool // Values files already migrated
+	Manual     []string        // Things that need migrating by hand
+}
+
+func runConvertHelmfile(opts ConvertHelmfileOptions) error {
+	if opts.File == "" || opts.Chart == "" {
+		return fmt.Errorf("--file and --chart are required")
+	}
+
+	root, cleanup, err := resolveChartRef(opts.Chart, opts.Version)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	candidates, err := chartConversionCandidates(root)
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		fmt.Printf("No convertible or converted list paths found in chart %s.\n", opts.Chart)
+		return nil
+	}
+
+	files, err := helmfilePaths(opts.File)
+	if err != nil {
+		return err
+	}
+
+	m := &deployMigration{
+		Chart:      chartName(root),
+		Candidates: candidates,
+		DryRun:     opts.DryRun,
+		BackupExt:  opts.BackupExt,
+		Done:       make(map[string]bool),
+	}
+	for _, f := range files {
+		if err := m.migrateHelmfile(f); err != nil {
+			return err
+		}
+	}
+
+	m.printManual()
+	return nil
+}
+
+// printManual lists everything that needs migrating by hand
+func (m *deployMigration) printManual() {
+	if len(m.Manual) == 0 {
+		return
+	}
+	fmt.Println("\n" + yellow("Not migrated automatically:"))
+	for _, s := range m.Manual {
+		fmt.Printf("  %s\n", s)
+	}
+}
+
+// helmfilePaths returns path itself, or the helmfiles in path if it is a
+// directory (e.g., helmfile.d/), in name order
+func helmfilePaths(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml") || strings.HasSuffix(name, ".gotmpl") {
+			files = append(files, filepath.Join(path, name))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// migrateHelmfile converts the inline values of releases of the chart in one
+// helmfile, then the values files they reference
+func (m *deployMigration) migrateHelmfile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var docs []*yaml.Node
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			// Helmfiles are often Go templates that only parse once rendered
+			m.Manual = append(m.Manual, fmt.Sprintf("%s: cannot parse (templated helmfile?): %v", path, err))
+			return nil
+		}
+		if len(doc.Content) > 0 {
+			docs = append(docs, doc.Content[0])
+		}
+	}
+
+	var edits []transform.ArrayEdit
+	var changes []manifestChange
+	var valuesFiles []string
+	for _, doc := range docs {
+		releases := nodeAt(doc, "releases")
+		if releases == nil || releases.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, rel := range releases.Content {
+			if !sameChart(scalarAt(rel, "chart"), m.Chart) {
+				continue
+			}
+			name := scalarAt(rel, "name")
+			change := manifestChange{Kind: "release", Name: name}
+
+			if values := nodeAt(rel, "values"); values != nil && values.Kind == yaml.SequenceNode {
+				for _, v := range values.Content {
+					switch v.Kind {
+					case yaml.MappingNode:
+						var blockEdits []transform.ArrayEdit
+						transform.FindArrayEdits(v, nil, m.Candidates, &blockEdits)
+						for _, e := range blockEdits {
+							change.Paths = append(change.Paths, e.Candidate)
+						}
+						edits = append(edits, blockEdits...)
+					case yaml.ScalarNode:
+						valuesFiles = append(valuesFiles, m.resolveValuesFile(path, name, v.Value))
+					}
+				}
+			}
+			m.checkSetValues(path, name, rel)
+			changes = append(changes, change)
+		}
+	}
+
+	printManifestChanges(changes)
+	if len(edits) > 0 {
+		if err := writeConverted(path, raw, transform.ApplyLineEdits(raw, edits), m.DryRun, m.BackupExt); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range valuesFiles {
+		if f == "" {
+			continue
+		}
+		if err := m.migrateValuesFile(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveValuesFile returns the path of a release values file relative to the
+// helmfile, or "" if the file cannot be migrated automatically
+func (m *deployMigration) resolveValuesFile(helmfile, release, ref string) string {
+	switch {
+	case strings.Contains(ref, "{{"), strings.HasSuffix(ref, ".gotmpl"):
+		m.Manual = append(m.Manual, fmt.Sprintf("%s: release %s: templated values file %s", helmfile, release, ref))
+		return ""
+	case strings.Contains(ref, "://"), strings.HasPrefix(ref, "git::"):
+		m.Manual = append(m.Manual, fmt.Sprintf("%s: release %s: remote values file %s", helmfile, release, ref))
+		return ""
+	}
+	if filepath.IsAbs(ref) {
+		return ref
+	}
+	return filepath.Join(filepath.Dir(helmfile), ref)
+}
+
+// checkSetValues reports set entries that index into a converted list, since
+// their list indexes no longer apply once the values are maps
+func (m *deployMigration) checkSetValues(helmfile, release string, rel *yaml.Node) {
+	for _, field := range []string{"set", "setString"} {
+		set := nodeAt(rel, field)
+		if set == nil || set.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, s := range set.Content {
+			name := scalarAt(s, "name")
+			for path := range m.Candidates {
+				if strings.HasPrefix(name, path+"[") {
+					m.Manual = append(m.Manual, fmt.Sprintf("%s: release %s: %s %s indexes the converted list %s", helmfile, release, field, name, path))
+					break
+				}
+			}
+		}
+	}
+}
+
+// migrateValuesFile converts a plain values file referenced by a release
+func (m *deployMigration) migrateValuesFile(path string) error {
+	if m.Done[path] {
+		return nil
+	}
+	m.Done[path] = true
+
+	doc, raw, err := loadValuesNode(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			m.Manual = append(m.Manual, fmt.Sprintf("%s: values file not found", path))
+			return nil
+		}
+		m.Manual = append(m.Manual, fmt.Sprintf("%s: cannot parse: %v", path, err))
+		return nil
+	}
+
+	candidates, merged := withoutMergedLists(doc, m.Candidates)
+	for _, mp := range merged {
+		m.Manual = append(m.Manual, fmt.Sprintf("%s: %s", path, mergedListNote(mp)))
+	}
+
+	var edits []transform.ArrayEdit
+	transform.FindArrayEdits(doc, nil, candidates, &edits)
+	if len(edits) == 0 {
+		return nil
+	}
+	fmt.Println(green(fmt.Sprintf("Converted %s:", path)))
+	for _, e := range edits {
+		fmt.Printf("  %s (key=%s)\n", e.Candidate.ValuesPath, e.Candidate.MergeKey)
+	}
+	return writeConverted(path, raw, transform.ApplyLineEdits(raw, edits), m.DryRun, m.BackupExt)
+}
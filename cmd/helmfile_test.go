@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+func TestConvertHelmfile(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	dir := copyChartForTest(t, "testdata/helmfile")
+	helmfile := filepath.Join(dir, "helmfile.yaml")
+	origHelmfile, _ := os.ReadFile(helmfile)
+	origValues, _ := os.ReadFile(filepath.Join(dir, "values", "app.yaml"))
+
+	output, err := captureOutput(t, func() error {
+		return runConvertHelmfile(ConvertHelmfileOptions{File: dir, Chart: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvertHelmfile failed: %v\nOutput: %s", err, output)
+	}
+
+	// Inline values of the matching release are converted; the other release is not
+	got, _ := os.ReadFile(helmfile)
+	want := strings.Replace(string(origHelmfile),
+		"      - env:\n          - name: LOG_LEVEL\n            value: debug\n",
+		"      # Deployment.spec.template.spec.containers.env (key: name)\n      - env:\n          LOG_LEVEL:\n            value: debug\n", 1)
+	if string(got) != want {
+		t.Errorf("converted helmfile =\n%s\nwant\n%s", got, want)
+	}
+
+	// Referenced values files are converted
+	gotValues, _ := os.ReadFile(filepath.Join(dir, "values", "app.yaml"))
+	if strings.Contains(string(gotValues), "- name: data") || !strings.Contains(string(gotValues), "  /data:\n    name: data") {
+		t.Errorf("values/app.yaml should be converted, got:\n%s\noriginal:\n%s", gotValues, origValues)
+	}
+
+	// Templated files and indexed set entries are reported for manual migration
+	for _, want := range []string{"templated values file values/secrets.yaml.gotmpl", "set volumes[0].name indexes the converted list volumes"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q\nGot:\n%s", want, output)
+		}
+	}
+}
@@ -7,8 +7,15 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
 
+	pkgfs "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/parser"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/transform"
 	"gopkg.in/yaml.v3"
 )
 
@@ -51,6 +58,29 @@ func parseChartDependencies(chartRoot string) ([]ChartDependency, error) {
 	return fileDeps, nil
 }
 
+// valuesName returns the key the dependency's values sit under in the parent
+// chart: its alias, if it has one
+func (d ChartDependency) valuesName() string {
+	if d.Alias != "" {
+		return d.Alias
+	}
+	return d.Name
+}
+
+// canonicalPath returns the absolute path of a chart directory with symlinks
+// resolved, so a chart reached several ways has one path. A path that
+// doesn't exist is only made absolute.
+func canonicalPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = filepath.Clean(path)
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	return abs
+}
+
 // resolveSubchartPath resolves a file:// repository reference to an absolute path
 func resolveSubchartPath(umbrellaRoot, repository string) string {
 	// Remove file:// prefix
@@ -67,13 +97,112 @@ func loadValuesNode(path string) (*yaml.Node, []byte, error) {
 	}
 	var doc yaml.Node
 	if err := yaml.Unmarshal(data, &doc); err != nil {
-		return nil, nil, err
+		return nil, nil, parser.YAMLFileError(path, data, err)
 	}
 	return &doc, data, nil
 }
 
+// withoutMergedLists returns the candidates minus the paths whose list is
+// shared through a YAML merge key (<<) or alias (*name), and the shared lists
+// involved. A list reached through << or an alias has no line of its own to
+// edit, and converting its source would also change every block that reuses it.
+func withoutMergedLists(doc *yaml.Node, candidates map[string]k8s.DetectedCandidate) (map[string]k8s.DetectedCandidate, []transform.MergedPath) {
+	kept := candidates
+	var skipped []transform.MergedPath
+	shared := append(transform.FindMergedPaths(doc), transform.FindAliasedPaths(doc)...)
+	for _, m := range shared {
+		_, atPath := candidates[m.Path]
+		_, atSource := candidates[m.Source]
+		if !atPath && !atSource {
+			continue
+		}
+		if skipped == nil {
+			// Leave the caller's map alone; it may be shared across files
+			kept = make(map[string]k8s.DetectedCandidate, len(candidates))
+			for p, c := range candidates {
+				kept[p] = c
+			}
+		}
+		delete(kept, m.Path)
+		delete(kept, m.Source)
+		skipped = append(skipped, m)
+	}
+	return kept, skipped
+}
+
+// mergedListNote describes a list shared through a YAML merge key or alias
+func mergedListNote(m transform.MergedPath) string {
+	if m.Alias {
+		if m.Path == "" {
+			return fmt.Sprintf("%s is aliased (*) inside a list item", m.Source)
+		}
+		return fmt.Sprintf("%s is an alias (*) of %s", m.Path, m.Source)
+	}
+	if m.Source == "" {
+		return fmt.Sprintf("%s is set through an inline merge key (<<)", m.Path)
+	}
+	return fmt.Sprintf("%s is merged from %s (<<)", m.Path, m.Source)
+}
+
+// printMergedLists reports the lists skipped because they are shared through
+// YAML merge keys or aliases
+func printMergedLists(w io.Writer, merged []transform.MergedPath, indent string) {
+	if len(merged) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\n"+indent+yellow("Skipped (list shared through a YAML merge key or alias):"))
+	for _, m := range merged {
+		fmt.Fprintf(w, "%s  %s\n", indent, mergedListNote(m))
+	}
+	fmt.Fprintln(w, indent+"  Converting the anchored list would change every block that merges or aliases it.")
+	fmt.Fprintln(w, indent+"  Set the list under each key directly to convert these paths.")
+}
+
+// printRepeatedSetValues reports the values repeated in lists converted to
+// sets, which keep each value once, so a list that relied on repeating one
+// (e.g., a flag given twice) isn't changed unnoticed
+func printRepeatedSetValues(w io.Writer, edits []transform.ArrayEdit, indent string) {
+	var lines []string
+	for _, edit := range edits {
+		if len(edit.Repeated) > 0 {
+			lines = append(lines, fmt.Sprintf("%s  %s: %s", indent, edit.Candidate.ValuesPath, strings.Join(edit.Repeated, ", ")))
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\n"+indent+yellow("Repeated values kept once (converted to a set):"))
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintln(w, indent+"  A set holds each value once and renders its values sorted. Leave lists whose")
+	fmt.Fprintln(w, indent+"  order or repeats matter out of set rules.")
+}
+
+// backupFile writes original to path+ext with the mode of path, so backups of
+// private values files stay private
 func backupFile(path, ext string, original []byte) error {
-	return os.WriteFile(path+ext, original, 0644)
+	mode := fileMode(path)
+	if err := os.WriteFile(path+ext, original, mode); err != nil {
+		return err
+	}
+	// An existing backup keeps its own mode, and the umask may have masked bits
+	return os.Chmod(path+ext, mode)
+}
+
+// fileMode returns the permission bits of path, or 0644 if it does not exist
+func fileMode(path string) os.FileMode {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0644
+	}
+	return info.Mode().Perm()
+}
+
+// rewriteFile writes data over path in place. An existing file keeps its mode
+// and, since it is truncated rather than replaced, its owner.
+func rewriteFile(path string, data []byte) error {
+	return os.WriteFile(path, data, fileMode(path))
 }
 
 // matchRule checks if a path matches any user-defined rule (for CRDs)
@@ -87,6 +216,105 @@ func matchRule(path []string) *Rule {
 	return nil
 }
 
+// isIgnoredPath reports whether a values path, or any of its ancestors,
+// matches one of the configured ignore patterns
+func isIgnoredPath(valuesPath string) bool {
+	if len(conf.IgnorePaths) == 0 {
+		return false
+	}
+	segments := strings.Split(valuesPath, ".")
+	for _, pattern := range conf.IgnorePaths {
+		pattern = strings.TrimSuffix(pattern, "[]")
+		for i := len(segments); i > 0; i-- {
+			if matchGlob(pattern, strings.Join(segments[:i], ".")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isIgnoredType reports whether an element type matches a configured ignore type.
+// "Toleration" matches "corev1.Toleration"; a qualified name must match exactly.
+func isIgnoredType(elementType string) bool {
+	if elementType == "" {
+		return false
+	}
+	for _, t := range conf.IgnoreTypes {
+		if t == elementType || strings.HasSuffix(elementType, "."+t) {
+			return true
+		}
+	}
+	return false
+}
+
+// reValuesOptOut matches the in-values opt-out comment, e.g. "# list-to-map: ignore"
+var reValuesOptOut = regexp.MustCompile(`(?i)list-to-map:\s*ignore\b`)
+
+// valuesOptOutPaths returns the values paths annotated with an opt-out comment
+// in the chart's values.yaml. The comment may sit on the line above the key or
+// at the end of the key's line, on the array itself or on any parent key.
+func valuesOptOutPaths(chartRoot string) []string {
+	doc, _, err := loadValuesNode(filepath.Join(chartRoot, "values.yaml"))
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	collectOptOutPaths(doc, nil, &paths)
+	return paths
+}
+
+func collectOptOutPaths(node *yaml.Node, path []string, paths *[]string) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			collectOptOutPaths(child, path, paths)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode := node.Content[i]
+			valueNode := node.Content[i+1]
+			p := append(append([]string{}, path...), keyNode.Value)
+			if hasOptOutComment(keyNode) || hasOptOutComment(valueNode) {
+				*paths = append(*paths, strings.Join(p, "."))
+				continue
+			}
+			collectOptOutPaths(valueNode, p, paths)
+		}
+	}
+}
+
+func hasOptOutComment(n *yaml.Node) bool {
+	return reValuesOptOut.MatchString(n.HeadComment) || reValuesOptOut.MatchString(n.LineComment)
+}
+
+// isOptedOut reports whether valuesPath is, or is nested under, an opted-out path
+func isOptedOut(valuesPath string, optOut []string) bool {
+	for _, p := range optOut {
+		if valuesPath == p || strings.HasPrefix(valuesPath, p+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// filterIgnoredCandidates removes candidates excluded by ignorePaths, ignoreTypes,
+// a typePolicy of never, or an opt-out comment in the chart's values.yaml.
+// Returns the kept candidates and the values paths that were ignored.
+func filterIgnoredCandidates(chartRoot string, candidates []k8s.DetectedCandidate) ([]k8s.DetectedCandidate, []string) {
+	optOut := valuesOptOutPaths(chartRoot)
+	var kept []k8s.DetectedCandidate
+	var ignored []string
+	for _, c := range candidates {
+		if isIgnoredPath(c.ValuesPath) || isIgnoredType(c.ElementType) || typePolicyFor(c.ElementType) == typePolicyNever || isOptedOut(c.ValuesPath, optOut) {
+			ignored = append(ignored, c.ValuesPath)
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept, ignored
+}
+
 func matchGlob(pattern, text string) bool {
 	psegs := strings.Split(pattern, ".")
 	tsegs := strings.Split(text, ".")
@@ -125,11 +353,21 @@ func getLastPathSegment(path string) string {
 
 // SubchartInfo represents a subchart to be processed
 type SubchartInfo struct {
-	Name         string // subchart name (directory name or Chart.yaml name)
-	Path         string // absolute path to subchart
-	Source       string // "file://", "charts/", or "remote"
-	RemoteSource string // repository URL (for remote charts)
-	WasExpanded  bool   // true if extracted from .tgz
+	Name         string   // subchart name (directory name or Chart.yaml name)
+	Aliases      []string // other names the umbrella holds its values under, e.g. aliased dependencies
+	Path         string   // canonical path to subchart
+	Source       string   // "file://", "charts/", or "remote"
+	RemoteSource string   // repository URL (for remote charts)
+	WasExpanded  bool     // true if extracted from .tgz
+}
+
+// label describes the subchart for the list of subcharts found
+func (s SubchartInfo) label() string {
+	label := fmt.Sprintf("%s [%s]", s.Name, s.Source)
+	if len(s.Aliases) > 0 {
+		label += " (also as " + strings.Join(s.Aliases, ", ") + ")"
+	}
+	return label
 }
 
 // scanChartsDirectory scans the charts/ directory for embedded subcharts
@@ -147,14 +385,15 @@ func scanChartsDirectory(chartRoot string) ([]SubchartInfo, error) {
 		return nil, fmt.Errorf("reading charts/ directory: %w", err)
 	}
 
+	ignore := pkgfs.LoadIgnore(pkgfs.OSFileSystem{}, chartRoot)
 	var subcharts []SubchartInfo
 	for _, entry := range entries {
-		// Skip non-directories and .tgz files
-		if !entry.IsDir() {
+		// Skip non-directories and .tgz files, following symlinks to directories
+		subchartPath := filepath.Join(chartsDir, entry.Name())
+		if info, err := os.Stat(subchartPath); err != nil || !info.IsDir() || ignore.Ignored(subchartPath, true) {
 			continue
 		}
 
-		subchartPath := filepath.Join(chartsDir, entry.Name())
 		chartYamlPath := filepath.Join(subchartPath, "Chart.yaml")
 
 		// Check if this directory contains Chart.yaml
@@ -184,8 +423,12 @@ func scanChartsTarballs(chartRoot string) ([]string, error) {
 		return nil, fmt.Errorf("reading charts/ directory: %w", err)
 	}
 
+	ignore := pkgfs.LoadIgnore(pkgfs.OSFileSystem{}, chartRoot)
 	var tarballs []string
 	for _, entry := range entries {
+		if ignore.Ignored(filepath.Join(chartsDir, entry.Name()), entry.IsDir()) {
+			continue
+		}
 		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".tgz") {
 			tarballs = append(tarballs, filepath.Join(chartsDir, entry.Name()))
 		}
@@ -196,9 +439,14 @@ func scanChartsTarballs(chartRoot string) ([]string, error) {
 
 // collectSubcharts gathers all subcharts to process based on flags
 // Handles file:// deps (--recursive), charts/ dirs (--include-charts-dir), and .tgz files (--expand-remote)
-// Deduplicates by absolute path
-func collectSubcharts(chartRoot string, recursive, includeChartsDir, expandRemote bool) ([]SubchartInfo, error) {
-	subchartMap := make(map[string]SubchartInfo) // key: absolute path
+// Deduplicates by canonical path, so a chart reached several ways, such as a
+// file:// dependency on a symlink into charts/, is processed once; the other
+// names its values go under are kept as aliases. The chart itself is never
+// its own subchart. Tarballs are expanded in place, or into copies under
+// extractTo when set, leaving charts/ untouched (e.g., --dry-run).
+func collectSubcharts(chartRoot string, recursive, includeChartsDir, expandRemote bool, extractTo string) ([]SubchartInfo, error) {
+	subchartMap := make(map[string]SubchartInfo) // key: canonical path
+	self := canonicalPath(chartRoot)
 
 	// Collect file:// dependencies from Chart.yaml
 	if recursive {
@@ -208,16 +456,23 @@ func collectSubcharts(chartRoot string, recursive, includeChartsDir, expandRemot
 		}
 
 		for _, dep := range deps {
-			subchartPath := resolveSubchartPath(chartRoot, dep.Repository)
-			// Make absolute for deduplication
-			absPath, err := filepath.Abs(subchartPath)
-			if err != nil {
-				absPath = subchartPath
+			path := canonicalPath(resolveSubchartPath(chartRoot, dep.Repository))
+			if path == self {
+				continue
 			}
-
-			subchartMap[absPath] = SubchartInfo{
-				Name:   dep.Name,
-				Path:   absPath,
+			name := dep.valuesName()
+			if existing, exists := subchartMap[path]; exists {
+				// The same chart under another alias: convert it once and
+				// update the umbrella values under each name
+				if name != existing.Name && !slices.Contains(existing.Aliases, name) {
+					existing.Aliases = append(existing.Aliases, name)
+					subchartMap[path] = existing
+				}
+				continue
+			}
+			subchartMap[path] = SubchartInfo{
+				Name:   name,
+				Path:   path,
 				Source: "file://",
 			}
 		}
@@ -231,19 +486,18 @@ func collectSubcharts(chartRoot string, recursive, includeChartsDir, expandRemot
 		}
 
 		for _, sub := range embedded {
-			// Make absolute for deduplication
-			absPath, err := filepath.Abs(sub.Path)
-			if err != nil {
-				absPath = sub.Path
+			path := canonicalPath(sub.Path)
+			if path == self {
+				continue
 			}
 
 			// If already exists (from file:// dep), mark as "charts/ (via Chart.yaml)"
-			if existing, exists := subchartMap[absPath]; exists {
+			if existing, exists := subchartMap[path]; exists {
 				existing.Source = "charts/ (via Chart.yaml)"
-				subchartMap[absPath] = existing
+				subchartMap[path] = existing
 			} else {
-				sub.Path = absPath
-				subchartMap[absPath] = sub
+				sub.Path = path
+				subchartMap[path] = sub
 			}
 		}
 	}
@@ -256,52 +510,68 @@ func collectSubcharts(chartRoot string, recursive, includeChartsDir, expandRemot
 		}
 
 		for _, tgzPath := range tarballs {
-			extractedPath, repoURL, err := extractTarball(tgzPath)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to extract %s: %v\n", filepath.Base(tgzPath), err)
-				continue
+			extractDir := ""
+			if extractTo != "" {
+				extractDir = filepath.Join(extractTo, strings.TrimSuffix(filepath.Base(tgzPath), ".tgz"))
 			}
-
-			// Make absolute for deduplication
-			absPath, err := filepath.Abs(extractedPath)
+			extractedPath, repoURL, err := extractTarball(tgzPath, extractDir)
 			if err != nil {
-				absPath = extractedPath
+				warnf("failed to extract %s: %v", filepath.Base(tgzPath), err)
+				continue
 			}
+			path := canonicalPath(extractedPath)
 
 			// Extract name from tarball filename (remove .tgz)
 			name := strings.TrimSuffix(filepath.Base(tgzPath), ".tgz")
 
-			subchartMap[absPath] = SubchartInfo{
+			// Expanded over a chart already collected, e.g. one left by an
+			// earlier expansion: it's the same directory, now from the tarball
+			sub := SubchartInfo{
 				Name:         name,
-				Path:         absPath,
+				Path:         path,
 				Source:       "remote",
 				RemoteSource: repoURL,
 				WasExpanded:  true,
 			}
+			if existing, exists := subchartMap[path]; exists {
+				sub.Name, sub.Aliases = existing.Name, existing.Aliases
+			}
+			subchartMap[path] = sub
 		}
 	}
 
-	// Convert map to slice
+	// Convert map to slice, in a stable order for reports
 	var subcharts []SubchartInfo
 	for _, sub := range subchartMap {
 		subcharts = append(subcharts, sub)
 	}
+	sort.Slice(subcharts, func(i, j int) bool {
+		if subcharts[i].Name != subcharts[j].Name {
+			return subcharts[i].Name < subcharts[j].Name
+		}
+		return subcharts[i].Path < subcharts[j].Path
+	})
 
 	return subcharts, nil
 }
 
 // extractTarball extracts a .tgz file to a directory in the same location
 // Returns the extracted directory path and repository URL from Chart.yaml
-// Creates a backup of the original .tgz file
-func extractTarball(tgzPath string) (string, string, error) {
-	// Create backup of .tgz
-	backupPath := tgzPath + ".bak"
-	tgzData, err := os.ReadFile(tgzPath)
-	if err != nil {
-		return "", "", fmt.Errorf("reading tarball: %w", err)
-	}
-	if err := os.WriteFile(backupPath, tgzData, 0644); err != nil {
-		return "", "", fmt.Errorf("creating backup: %w", err)
+// Creates a backup of the original .tgz file. When extractDir is set, the
+// chart is extracted there instead and the tarball is left as it is.
+func extractTarball(tgzPath, extractDir string) (string, string, error) {
+	inPlace := extractDir == ""
+	if inPlace {
+		// Create backup of .tgz
+		tgzData, err := os.ReadFile(tgzPath)
+		if err != nil {
+			return "", "", fmt.Errorf("reading tarball: %w", err)
+		}
+		if err := backupFile(tgzPath, ".bak", tgzData); err != nil {
+			return "", "", fmt.Errorf("creating backup: %w", err)
+		}
+		// Extract to directory with same name as tarball (minus .tgz)
+		extractDir = strings.TrimSuffix(tgzPath, ".tgz")
 	}
 
 	// Open tarball
@@ -319,8 +589,6 @@ func extractTarball(tgzPath string) (string, string, error) {
 
 	tr := tar.NewReader(gzr)
 
-	// Extract to directory with same name as tarball (minus .tgz)
-	extractDir := strings.TrimSuffix(tgzPath, ".tgz")
 	var chartYamlContent []byte
 
 	for {
@@ -374,8 +642,10 @@ func extractTarball(tgzPath string) (string, string, error) {
 	}
 
 	// Remove original .tgz file
-	if err := os.Remove(tgzPath); err != nil {
-		return "", "", fmt.Errorf("removing original tarball: %w", err)
+	if inPlace {
+		if err := os.Remove(tgzPath); err != nil {
+			return "", "", fmt.Errorf("removing original tarball: %w", err)
+		}
 	}
 
 	// Extract repository URL from Chart.yaml
@@ -410,6 +680,7 @@ func displayRemoteWarning(expandedCharts []SubchartInfo) {
 	fmt.Println("│                                                                          │")
 	fmt.Println("│ The following dependencies were expanded from tarballs and converted:   │")
 	for _, chart := range expandedCharts {
+		summary.warn(fmt.Sprintf("remote dependency %s was converted; 'helm dependency update' undoes it", chart.Name))
 		if chart.RemoteSource != "" {
 			fmt.Printf("│   - %-65s │\n", fmt.Sprintf("%s (%s)", chart.Name, chart.RemoteSource))
 		} else {
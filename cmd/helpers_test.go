@@ -1,7 +1,12 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
 )
 
 func TestMatchGlob(t *testing.T) {
@@ -249,3 +254,105 @@ func TestMatchRule(t *testing.T) {
 		})
 	}
 }
+
+func TestIsIgnoredPath(t *testing.T) {
+	// isIgnoredPath reads conf.IgnorePaths
+	originalConf := conf
+	defer func() { conf = originalConf }()
+
+	conf.IgnorePaths = []string{"tolerations[]", "legacy.*"}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "tolerations", want: true},
+		{path: "worker.tolerations", want: true},
+		{path: "legacy.env", want: true},
+		{path: "legacy.sidecar.volumes", want: true},
+		{path: "env", want: false},
+		{path: "legacyEnv", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := isIgnoredPath(tt.path); got != tt.want {
+				t.Errorf("isIgnoredPath(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterIgnoredCandidates(t *testing.T) {
+	originalConf := conf
+	defer func() { conf = originalConf }()
+
+	conf.IgnorePaths = []string{"legacy.*"}
+	conf.IgnoreTypes = []string{"Toleration"}
+
+	candidates := []k8s.DetectedCandidate{
+		{ValuesPath: "env", ElementType: "corev1.EnvVar"},
+		{ValuesPath: "tolerations", ElementType: "corev1.Toleration"},
+		{ValuesPath: "legacy.volumes", ElementType: "corev1.Volume"},
+	}
+
+	kept, ignored := filterIgnoredCandidates(t.TempDir(), candidates)
+	if len(kept) != 1 || kept[0].ValuesPath != "env" {
+		t.Errorf("kept = %+v, want only env", kept)
+	}
+	if !slices.Equal(ignored, []string{"tolerations", "legacy.volumes"}) {
+		t.Errorf("ignored = %v, want [tolerations legacy.volumes]", ignored)
+	}
+}
+
+func TestValuesOptOutPaths(t *testing.T) {
+	t.Parallel()
+
+	chartRoot := t.TempDir()
+	values := `# Application settings
+replicas: 1
+
+# Order matters here, keep it a list
+# list-to-map: ignore
+env:
+  - name: A
+    value: "1"
+
+volumes: # list-to-map: ignore
+  - name: data
+
+legacy: # List-To-Map: ignore
+  sidecar:
+    volumeMounts:
+      - name: data
+        mountPath: /data
+
+volumeMounts:
+  - name: data
+    mountPath: /data
+`
+	if err := os.WriteFile(filepath.Join(chartRoot, "values.yaml"), []byte(values), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	optOut := valuesOptOutPaths(chartRoot)
+	if !slices.Equal(optOut, []string{"env", "volumes", "legacy"}) {
+		t.Fatalf("valuesOptOutPaths() = %v, want [env volumes legacy]", optOut)
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "env", want: true},
+		{path: "volumes", want: true},
+		{path: "legacy.sidecar.volumeMounts", want: true},
+		{path: "volumeMounts", want: false},
+		{path: "legacyEnv", want: false},
+	}
+	for _, tt := range tests {
+		if got := isOptedOut(tt.path, optOut); got != tt.want {
+			t.Errorf("isOptedOut(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// keyOverridesFlag collects repeated --key flags, each of which may hold a
+// comma-separated list of path=field overrides
+type keyOverridesFlag []string
+
+func (k *keyOverridesFlag) String() string { return strings.Join(*k, ",") }
+
+func (k *keyOverridesFlag) Set(s string) error {
+	*k = append(*k, strings.Split(s, ",")...)
+	return nil
+}
+
+// parseKeyOverride parses a --key override of the form <values path>=<field>
+// into the rule it stands for, e.g. deployment.env=id converts the list at
+// deployment.env keyed by each item's id
+func parseKeyOverride(s string) (Rule, error) {
+	path, field, ok := strings.Cut(s, "=")
+	path, field = strings.TrimSuffix(strings.TrimSpace(path), "[]"), strings.TrimSpace(field)
+	if !ok || path == "" || field == "" {
+		return Rule{}, fmt.Errorf("invalid --key %q: want <values path>=<field>, e.g. deployment.env=name", s)
+	}
+	return Rule{PathPattern: path + "[]", UniqueKeys: []string{field}}, nil
+}
+
+// useKeyOverrides places a rule for each --key override ahead of the
+// configured rules, so the overrides win over rules and detected keys for
+// this run only. The returned function restores the configured rules.
+func useKeyOverrides(overrides []string) (func(), error) {
+	prev := conf.Rules
+	restore := func() { conf.Rules = prev }
+	if len(overrides) == 0 {
+		return restore, nil
+	}
+	rules := make([]Rule, 0, len(overrides)+len(prev))
+	for _, s := range overrides {
+		r, err := parseKeyOverride(s)
+		if err != nil {
+			return restore, err
+		}
+		rules = append(rules, r)
+	}
+	conf.Rules = append(rules, prev...)
+	return restore, nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/detect"
+)
+
+// validateRuleKeyStrategy checks a rule's keyStrategy: it needs two or more
+// uniqueKeys to convert by, and can't be combined with set
+func validateRuleKeyStrategy(r Rule) error {
+	switch r.KeyStrategy {
+	case "":
+		return nil
+	case detect.KeyStrategyNested, detect.KeyStrategyComposite:
+	default:
+		return fmt.Errorf("invalid keyStrategy %q for %s: want %s or %s", r.KeyStrategy, r.PathPattern, detect.KeyStrategyNested, detect.KeyStrategyComposite)
+	}
+	if len(r.UniqueKeys) < 2 {
+		return fmt.Errorf("keyStrategy %s for %s needs two or more uniqueKeys", r.KeyStrategy, r.PathPattern)
+	}
+	if r.Set {
+		return fmt.Errorf("keyStrategy %s for %s can't be combined with set", r.KeyStrategy, r.PathPattern)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+func TestValidateRuleKeyStrategy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		rule    Rule
+		wantErr bool
+	}{
+		{Rule{PathPattern: "a[]", UniqueKeys: []string{"name"}}, false},
+		{Rule{PathPattern: "a[]", UniqueKeys: []string{"namespace", "name"}, KeyStrategy: "nested"}, false},
+		{Rule{PathPattern: "a[]", UniqueKeys: []string{"namespace", "name"}, KeyStrategy: "composite"}, false},
+		{Rule{PathPattern: "a[]", UniqueKeys: []string{"namespace", "name"}, KeyStrategy: "flat"}, true},
+		{Rule{PathPattern: "a[]", UniqueKeys: []string{"name"}, KeyStrategy: "nested"}, true},
+		{Rule{PathPattern: "a[]", UniqueKeys: []string{"namespace", "name"}, KeyStrategy: "nested", Set: true}, true},
+	}
+	for _, tt := range tests {
+		if err := validateRuleKeyStrategy(tt.rule); (err != nil) != tt.wantErr {
+			t.Errorf("validateRuleKeyStrategy(%+v) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+		}
+	}
+}
+
+func TestConvertKeyStrategy(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	originalConf := conf
+	defer func() { conf = originalConf }()
+	conf = Config{}
+
+	root := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml": "apiVersion: v2\nname: test\nversion: 0.1.0\n",
+		"values.yaml": `mesh:
+  services:
+    - namespace: ns-a
+      name: svc-a
+      port: 80
+    - namespace: ns-b
+      name: svc-b
+`,
+		"templates/mesh.yaml": `apiVersion: mesh.example.com/v1
+kind: ServiceMesh
+metadata:
+  name: app
+spec:
+  services:
+    {{- toYaml .Values.mesh.services | nindent 4 }}
+`,
+		chartConfigFile: `rules:
+  - pathPattern: mesh.services[]
+    uniqueKeys: [namespace, name]
+    keyStrategy: nested
+`,
+	}
+	writeChartFiles(t, root, files)
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: root, BackupExt: ".bak", MigrationFile: "values-migration.yaml"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	checks := map[string][]string{
+		"values.yaml":            {"# (keys: namespace, name; nested)\n  services:\n    ns-a:\n      svc-a:\n        port: 80\n    ns-b:\n      svc-b: {}\n"},
+		"templates/mesh.yaml":    {`include "chart.listmap.items.nested" (dict "items" (index .Values "mesh" "services") "keys" (list "namespace" "name"))`},
+		"templates/_listmap.tpl": {`define "chart.listmap.items.nested"`},
+		"values-migration.yaml":  {"keys:\n        - namespace\n        - name\n      keyStrategy: nested"},
+	}
+	for name, wants := range checks {
+		data, _ := os.ReadFile(filepath.Join(root, name))
+		for _, want := range wants {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("%s should contain %q, got:\n%s", name, want, data)
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/crd"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+)
+
+// useKubeVersion targets detection at the Kubernetes release given by flag,
+// or else by the kubeVersion setting, along with its OpenAPI spec if one was
+// saved with load-openapi. The returned function restores the previous target.
+func useKubeVersion(flag string) (func(), error) {
+	s := flag
+	if s == "" {
+		s = conf.KubeVersion
+	}
+	if s == "" {
+		return func() {}, nil
+	}
+	v, err := k8s.ParseKubeVersion(s)
+	if err != nil {
+		return func() {}, err
+	}
+
+	spec, err := k8s.LoadOpenAPISpec(openAPISpecPath(v))
+	if err != nil && !os.IsNotExist(err) {
+		warnf("loading OpenAPI spec for Kubernetes %s: %v", v, err)
+	}
+	prevVersion := k8s.SetKubeVersion(v)
+	prevSpec := k8s.SetOpenAPISpec(spec)
+	return func() {
+		k8s.SetKubeVersion(prevVersion)
+		k8s.SetOpenAPISpec(prevSpec)
+	}, nil
+}
+
+// openAPISpecPath returns where load-openapi saves the spec of a release
+func openAPISpecPath(v k8s.KubeVersion) string {
+	return filepath.Join(openAPIConfigDir(), fmt.Sprintf("swagger-v%s.json", v))
+}
+
+// openAPISpecURL returns the swagger.json the kubernetes repo publishes for a release
+func openAPISpecURL(v k8s.KubeVersion) string {
+	return fmt.Sprintf("https://raw.githubusercontent.com/kubernetes/kubernetes/v%s.0/api/openapi-spec/swagger.json", v)
+}
+
+func runLoadOpenAPI(opts LoadOpenAPIOptions) error {
+	if opts.KubeVersion == "" {
+		return fmt.Errorf("--kube-version is required")
+	}
+	v, err := k8s.ParseKubeVersion(opts.KubeVersion)
+	if err != nil {
+		return err
+	}
+	dest := openAPISpecPath(v)
+	if _, err := os.Stat(dest); err == nil && !opts.Force {
+		fmt.Printf("Skipped: %s already exists (use --force to replace it)\n", dest)
+		return nil
+	}
+
+	source := opts.Source
+	if source == "" {
+		source = openAPISpecURL(v)
+	}
+	data, err := readOpenAPISource(source)
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	// Don't save anything detection couldn't use
+	if _, err := k8s.ParseOpenAPISpec(data); err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+
+	if err := os.MkdirAll(openAPIConfigDir(), 0755); err != nil {
+		return fmt.Errorf("creating OpenAPI directory: %w", err)
+	}
+	if err := writeFileAtomic(dest, data, 0644); err != nil {
+		return fmt.Errorf("writing to config: %w", err)
+	}
+	fmt.Printf("Loaded: %s -> %s\n", source, dest)
+	return nil
+}
+
+// readOpenAPISource reads a spec from a file or URL
+func readOpenAPISource(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+	return crd.Fetch(source, "")
+}
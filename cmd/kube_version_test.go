@@ -0,0 +1,162 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+)
+
+// kubeVersionChart writes a chart whose Deployment picks its apiVersion from
+// .Capabilities and renders two lists into the pod spec
+func kubeVersionChart(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml": "apiVersion: v2\nname: kube-version\nversion: 0.1.0\n",
+		"values.yaml": `volumes:
+  - name: data
+    emptyDir: {}
+topologySpreadConstraints:
+  - topologyKey: zone
+    maxSkew: 1
+    whenUnsatisfiable: DoNotSchedule
+`,
+		"templates/deployment.yaml": `apiVersion: {{ include "app.deployment.apiVersion" . }}
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      volumes:
+        {{- toYaml .Values.volumes | nindent 8 }}
+      topologySpreadConstraints:
+        {{- toYaml .Values.topologySpreadConstraints | nindent 8 }}
+`,
+	}
+	writeChartFiles(t, root, files)
+	return root
+}
+
+// minimalSpec is an OpenAPI spec whose pod spec predates topologySpreadConstraints
+const minimalSpec = `{
+  "definitions": {
+    "io.k8s.api.apps.v1.Deployment": {
+      "properties": {"spec": {"$ref": "#/definitions/io.k8s.api.apps.v1.DeploymentSpec"}},
+      "x-kubernetes-group-version-kind": [{"group": "apps", "version": "v1", "kind": "Deployment"}]
+    },
+    "io.k8s.api.apps.v1.DeploymentSpec": {
+      "properties": {"template": {"$ref": "#/definitions/io.k8s.api.core.v1.PodTemplateSpec"}}
+    },
+    "io.k8s.api.core.v1.PodTemplateSpec": {
+      "properties": {"spec": {"$ref": "#/definitions/io.k8s.api.core.v1.PodSpec"}}
+    },
+    "io.k8s.api.core.v1.PodSpec": {
+      "properties": {
+        "containers": {"type": "array", "items": {"$ref": "#/definitions/io.k8s.api.core.v1.Container"}},
+        "volumes": {"type": "array", "items": {"$ref": "#/definitions/io.k8s.api.core.v1.Volume"}}
+      }
+    },
+    "io.k8s.api.core.v1.Container": {"properties": {"name": {"type": "string"}}},
+    "io.k8s.api.core.v1.Volume": {"properties": {"name": {"type": "string"}}}
+  }
+}`
+
+func detectedPaths(t *testing.T, root string) (candidates, notInRelease []string) {
+	t.Helper()
+	result, err := k8s.DetectConversionCandidatesFull(root)
+	if err != nil {
+		t.Fatalf("DetectConversionCandidatesFull() error = %v", err)
+	}
+	for _, c := range result.Candidates {
+		candidates = append(candidates, c.ValuesPath)
+	}
+	for _, u := range result.Undetected {
+		if u.Category == k8s.CategoryNotInRelease {
+			notInRelease = append(notInRelease, u.ValuesPath)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates, notInRelease
+}
+
+func TestKubeVersionResolvesTemplatedAPIVersion(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	root := kubeVersionChart(t)
+
+	// Without a target release the resource type is unknown
+	if got, _ := detectedPaths(t, root); len(got) != 0 {
+		t.Errorf("without --kube-version: got candidates %v, want none", got)
+	}
+
+	restore, err := useKubeVersion("1.27")
+	defer restore()
+	if err != nil {
+		t.Fatalf("useKubeVersion() error = %v", err)
+	}
+	got, _ := detectedPaths(t, root)
+	want := []string{"topologySpreadConstraints", "volumes"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("with --kube-version 1.27: got candidates %v, want %v", got, want)
+	}
+}
+
+func TestKubeVersionChecksFieldsAgainstOpenAPISpec(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	root := kubeVersionChart(t)
+
+	specFile := filepath.Join(t.TempDir(), "swagger.json")
+	if err := os.WriteFile(specFile, []byte(minimalSpec), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := captureOutput(t, func() error {
+		return runLoadOpenAPI(LoadOpenAPIOptions{KubeVersion: "v1.18.3", Source: specFile})
+	}); err != nil {
+		t.Fatalf("runLoadOpenAPI() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(openAPIConfigDir(), "swagger-v1.18.json")); err != nil {
+		t.Fatalf("spec not saved: %v", err)
+	}
+
+	conf.KubeVersion = "1.18"
+	defer func() { conf.KubeVersion = "" }()
+	restore, err := useKubeVersion("")
+	defer restore()
+	if err != nil {
+		t.Fatalf("useKubeVersion() error = %v", err)
+	}
+	candidates, notInRelease := detectedPaths(t, root)
+	if len(candidates) != 1 || candidates[0] != "volumes" {
+		t.Errorf("got candidates %v, want [volumes]", candidates)
+	}
+	if len(notInRelease) != 1 || notInRelease[0] != "topologySpreadConstraints" {
+		t.Errorf("got fields not in release %v, want [topologySpreadConstraints]", notInRelease)
+	}
+
+	restore()
+	if _, notInRelease := detectedPaths(t, root); len(notInRelease) != 0 {
+		t.Errorf("after restore: got fields not in release %v, want none", notInRelease)
+	}
+}
+
+func TestLoadOpenAPIRejectsInvalidSpec(t *testing.T) {
+	testutil.SetupTestEnv(t)
+
+	specFile := filepath.Join(t.TempDir(), "swagger.json")
+	if err := os.WriteFile(specFile, []byte(`{"swagger": "2.0"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := runLoadOpenAPI(LoadOpenAPIOptions{KubeVersion: "1.27", Source: specFile})
+	if err == nil {
+		t.Fatal("runLoadOpenAPI() succeeded with a spec without definitions")
+	}
+	if _, err := os.Stat(filepath.Join(openAPIConfigDir(), "swagger-v1.27.json")); !os.IsNotExist(err) {
+		t.Errorf("invalid spec was saved")
+	}
+}
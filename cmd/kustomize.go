@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/transform"
+	"gopkg.in/yaml.v3"
+)
+
+// kustomizationNames are the file names kustomize accepts for a kustomization
+var kustomizationNames = map[string]bool{
+	"kustomization.yaml": true,
+	"kustomization.yml":  true,
+	"Kustomization":      true,
+}
+
+func runConvertKustomize(opts ConvertKustomizeOptions) error {
+	if opts.File == "" || opts.Chart == "" {
+		return fmt.Errorf("--file and --chart are required")
+	}
+
+	root, cleanup, err := resolveChartRef(opts.Chart, opts.Version)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	candidates, err := chartConversionCandidates(root)
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		fmt.Printf("No convertible or converted list paths found in chart %s.\n", opts.Chart)
+		return nil
+	}
+
+	files, err := kustomizationPaths(opts.File)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no kustomization found in %s", opts.File)
+	}
+
+	m := &deployMigration{
+		Chart:      chartName(root),
+		Candidates: candidates,
+		DryRun:     opts.DryRun,
+		BackupExt:  opts.BackupExt,
+		Done:       make(map[string]bool),
+	}
+	for _, f := range files {
+		if err := m.migrateKustomization(f); err != nil {
+			return err
+		}
+	}
+
+	m.printManual()
+	return nil
+}
+
+// kustomizationPaths returns path itself, or every kustomization below path if
+// it is a directory (e.g., a base and its overlays), in path order
+func kustomizationPaths(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if kustomizationNames[d.Name()] {
+			files = append(files, p)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// migrateKustomization converts the valuesInline blocks of helmCharts entries
+// for the chart in one kustomization, then the values files they reference
+func (m *deployMigration) migrateKustomization(path string) error {
+	doc, raw, err := loadValuesNode(path)
+	if err != nil {
+		m.Manual = append(m.Manual, fmt.Sprintf("%s: cannot parse: %v", path, err))
+		return nil
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	charts := nodeAt(doc.Content[0], "helmCharts")
+	if charts == nil || charts.Kind != yaml.SequenceNode {
+		return nil
+	}
+
+	var edits []transform.ArrayEdit
+	var changes []manifestChange
+	var valuesFiles []string
+	for _, c := range charts.Content {
+		if !sameChart(scalarAt(c, "name"), m.Chart) {
+			continue
+		}
+		name := scalarAt(c, "releaseName")
+		if name == "" {
+			name = scalarAt(c, "name")
+		}
+		change := manifestChange{Kind: "helmChart", Name: name}
+
+		if v := nodeAt(c, "valuesInline"); v != nil && v.Kind == yaml.MappingNode {
+			var blockEdits []transform.ArrayEdit
+			transform.FindArrayEdits(v, nil, m.Candidates, &blockEdits)
+			for _, e := range blockEdits {
+				change.Paths = append(change.Paths, e.Candidate)
+			}
+			edits = append(edits, blockEdits...)
+		}
+
+		refs := []string{scalarAt(c, "valuesFile")}
+		if extra := nodeAt(c, "additionalValuesFiles"); extra != nil && extra.Kind == yaml.SequenceNode {
+			for _, f := range extra.Content {
+				refs = append(refs, f.Value)
+			}
+		}
+		for _, ref := range refs {
+			if ref != "" {
+				valuesFiles = append(valuesFiles, m.resolveValuesFile(path, name, ref))
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	printManifestChanges(changes)
+	if len(edits) > 0 {
+		if err := writeConverted(path, raw, transform.ApplyLineEdits(raw, edits), m.DryRun, m.BackupExt); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range valuesFiles {
+		if f == "" {
+			continue
+		}
+		if err := m.migrateValuesFile(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
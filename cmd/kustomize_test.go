@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+func TestConvertKustomize(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	dir := copyChartForTest(t, "testdata/kustomize")
+	kustomization := filepath.Join(dir, "base", "kustomization.yaml")
+	orig, _ := os.ReadFile(kustomization)
+
+	output, err := captureOutput(t, func() error {
+		return runConvertKustomize(ConvertKustomizeOptions{File: dir, Chart: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvertKustomize failed: %v\nOutput: %s", err, output)
+	}
+
+	// valuesInline of the matching entry is converted; the other chart is not
+	got, _ := os.ReadFile(kustomization)
+	want := strings.Replace(string(orig),
+		"      env:\n        - name: LOG_LEVEL\n          value: debug\n",
+		"      # Deployment.spec.template.spec.containers.env (key: name)\n      env:\n        LOG_LEVEL:\n          value: debug\n", 1)
+	if string(got) != want {
+		t.Errorf("converted kustomization =\n%s\nwant\n%s", got, want)
+	}
+
+	// The referenced valuesFile is converted
+	gotValues, _ := os.ReadFile(filepath.Join(dir, "base", "values.yaml"))
+	if !strings.Contains(string(gotValues), "  /data:\n    name: data") {
+		t.Errorf("base/values.yaml should be converted, got:\n%s", gotValues)
+	}
+
+	// Overlays are found and their remote values files reported
+	if !strings.Contains(output, "remote values file https://config.example.com/prod/values.yaml") {
+		t.Errorf("output missing remote values file report\nGot:\n%s", output)
+	}
+}
@@ -2,16 +2,17 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/scottrigby/helm-list-to-map-plugin/pkg/crd"
 )
 
 func runListCRDs(opts ListCRDsOptions) error {
-	// Load CRDs from config
-	if err := loadCRDsFromConfig(); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	// Load CRDs from config, or the cluster's schemas with the cluster source
+	restoreSchema, err := useSchemas("", false)
+	defer restoreSchema()
+	if err != nil {
+		return err
 	}
 
 	types := crd.GetGlobalRegistry().ListTypes()
@@ -2,9 +2,56 @@ package main
 
 import (
 	"fmt"
+	"sort"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
 )
 
 func runListRules(opts ListRulesOptions) error {
+	if len(conf.IgnorePaths) > 0 || len(conf.IgnoreTypes) > 0 {
+		fmt.Println("Ignored:")
+		for _, p := range conf.IgnorePaths {
+			fmt.Printf("- path %s\n", p)
+		}
+		for _, t := range conf.IgnoreTypes {
+			fmt.Printf("- type %s\n", t)
+		}
+		fmt.Println()
+	}
+
+	if len(conf.TypePolicy) > 0 {
+		types := make([]string, 0, len(conf.TypePolicy))
+		for t := range conf.TypePolicy {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		fmt.Println("Type policy:")
+		for _, t := range types {
+			fmt.Printf("- %s: %s\n", t, conf.TypePolicy[t])
+		}
+		fmt.Println()
+	}
+
+	if len(conf.CuratedRules) > 0 {
+		prev, err := k8s.SetCuratedRuleSets(conf.CuratedRules)
+		if err != nil {
+			return fmt.Errorf("curatedRules: %w", err)
+		}
+		defer func() { _, _ = k8s.SetCuratedRuleSets(prev) }()
+		fmt.Println("Curated rules:")
+		for _, set := range k8s.EnabledCuratedRuleSets() {
+			fmt.Printf("- %s\n", set)
+			for _, r := range k8s.CuratedRuleSets[set] {
+				key := "key=" + r.MergeKey
+				if r.Synthetic {
+					key += ", synthetic"
+				}
+				fmt.Printf("    %s (%s)\n", r.Type, key)
+			}
+		}
+		fmt.Println()
+	}
+
 	if len(conf.Rules) == 0 {
 		fmt.Println("No custom rules defined.")
 		fmt.Println("Built-in K8s types are detected automatically via API introspection.")
@@ -13,7 +60,13 @@ func runListRules(opts ListRulesOptions) error {
 
 	fmt.Println("Custom rules:")
 	for _, r := range conf.Rules {
-		fmt.Printf("- %s (key=%s)\n", r.PathPattern, r.UniqueKeys[0])
+		fmt.Printf("- %s (%s)\n", r.PathPattern, ruleDescription(&r))
+		if r.PromoteScalar != "" {
+			fmt.Printf("    scalar items promoted into %s\n", r.PromoteScalar)
+		}
+		if r.Note != "" {
+			fmt.Printf("    note: %s\n", r.Note)
+		}
 	}
 	return nil
 }
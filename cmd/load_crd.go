@@ -2,24 +2,45 @@ package main
 
 import (
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/scottrigby/helm-list-to-map-plugin/pkg/crd"
 	pkgfs "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
 )
 
 func runLoadCRD(opts LoadCRDOptions) error {
+	if opts.Timeout < 0 || opts.Retries < 0 {
+		return fmt.Errorf("--timeout and --retries can't be negative")
+	}
+	fetch := crd.FetchOptions{Timeout: opts.Timeout, Retries: opts.Retries}
+	if fetch.Timeout == 0 {
+		fetch.Timeout = crd.DefaultFetchOptions.Timeout
+	}
+	defer crd.SetFetchOptions(crd.SetFetchOptions(fetch))
+	defer crd.SetAuthRules(crd.SetAuthRules(conf.CRDAuth))
+
+	if opts.Common && opts.Bundle != "" {
+		return fmt.Errorf("--common and --bundle cannot be combined")
+	}
+
 	// Handle --common flag
 	if opts.Common {
 		return loadCommonCRDs()
 	}
+	if opts.Bundle != "" {
+		if err := loadCRDArchive(opts.Bundle, crdConfigDir(), opts.Force); err != nil {
+			return fmt.Errorf("%s: %w", opts.Bundle, err)
+		}
+		if len(opts.Sources) == 0 {
+			return nil
+		}
+	}
 
 	if len(opts.Sources) == 0 {
-		return fmt.Errorf("at least one CRD source is required (or use --common)")
+		return fmt.Errorf("at least one CRD source is required (or use --common or --bundle)")
 	}
 
 	// Ensure CRD config directory exists
@@ -41,26 +62,10 @@ func runLoadCRD(opts LoadCRDOptions) error {
 
 // loadCommonCRDs loads CRDs from the bundled common-crds.yaml file
 func loadCommonCRDs() error {
-	// Find common-crds.yaml in plugin directory
-	pluginDir := os.Getenv("HELM_PLUGIN_DIR")
-	if pluginDir == "" {
-		// Fallback: check current directory and parent
-		candidates := []string{"common-crds.yaml", "../common-crds.yaml"}
-		for _, c := range candidates {
-			if _, err := os.Stat(c); err == nil {
-				pluginDir = filepath.Dir(c)
-				break
-			}
-		}
-	}
-
-	sourcesFile := filepath.Join(pluginDir, "common-crds.yaml")
-	if _, err := os.Stat(sourcesFile); err != nil {
-		// Try current directory as fallback
-		sourcesFile = "common-crds.yaml"
+	if crd.Offline() {
+		return fmt.Errorf("--common downloads its CRDs: %w; load an archive made with 'helm list-to-map bundle-crds' on a connected machine instead (load-crd --bundle crds-bundle.tgz)", crd.ErrOffline)
 	}
-
-	sources, err := crd.LoadCRDSources(sourcesFile)
+	sources, err := crd.LoadCRDSources(commonCRDsFile())
 	if err != nil {
 		return fmt.Errorf("loading common-crds.yaml: %w", err)
 	}
@@ -77,19 +82,9 @@ func loadCommonCRDs() error {
 	skipped := 0
 
 	for group, entry := range sources {
-		// Use entry's default_version, fallback to "main" if not specified
-		version := entry.DefaultVersion
-		if version == "" {
-			version = "main"
-		}
-
-		url := entry.GetDownloadURL(version)
+		url, version, skip := commonCRDURL(entry)
 		if url == "" {
-			if entry.Note != "" {
-				fmt.Printf("  %s: skipped (%s)\n", group, entry.Note)
-			} else {
-				fmt.Printf("  %s: skipped (no direct URL, only url_pattern available)\n", group)
-			}
+			fmt.Printf("  %s: skipped (%s)\n", group, skip)
 			skipped++
 			continue
 		}
@@ -97,7 +92,7 @@ func loadCommonCRDs() error {
 		fmt.Printf("  %s (version: %s)\n", group, version)
 		fmt.Printf("    Source: %s\n", url)
 
-		if err := loadAndStoreCRDFromURL(url, crdsDir, false); err != nil {
+		if err := loadAndStoreCRDFromURL(url, entry.SHA256, crdsDir, false); err != nil {
 			fmt.Printf("    Error: %v\n", err)
 			continue
 		}
@@ -119,11 +114,51 @@ func loadCommonCRDs() error {
 	return nil
 }
 
+// commonCRDURL returns the download URL of a common-crds.yaml entry at its
+// default_version ("main" if it has none) and the version, or else "" and why
+// the entry is skipped
+func commonCRDURL(entry crd.CRDSourceEntry) (url, version, skip string) {
+	version = entry.DefaultVersion
+	if version == "" {
+		version = "main"
+	}
+	if url = entry.GetDownloadURL(version); url != "" {
+		return url, version, ""
+	}
+	if entry.Note != "" {
+		return "", version, entry.Note
+	}
+	return "", version, "no direct URL, only url_pattern available"
+}
+
+// commonCRDsFile returns the path to the bundled common-crds.yaml file
+func commonCRDsFile() string {
+	// Find common-crds.yaml in plugin directory
+	pluginDir := os.Getenv("HELM_PLUGIN_DIR")
+	if pluginDir == "" {
+		// Fallback: check current directory and parent
+		candidates := []string{"common-crds.yaml", "../common-crds.yaml"}
+		for _, c := range candidates {
+			if _, err := os.Stat(c); err == nil {
+				pluginDir = filepath.Dir(c)
+				break
+			}
+		}
+	}
+
+	sourcesFile := filepath.Join(pluginDir, "common-crds.yaml")
+	if _, err := os.Stat(sourcesFile); err != nil {
+		// Try current directory as fallback
+		sourcesFile = "common-crds.yaml"
+	}
+	return sourcesFile
+}
+
 // loadAndStoreCRD loads a CRD from file, directory, or URL and stores it in the config directory
 func loadAndStoreCRD(source, crdsDir string, force bool) error {
 	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
 		// Download from URL
-		return loadAndStoreCRDFromURL(source, crdsDir, force)
+		return loadAndStoreCRDFromURL(source, "", crdsDir, force)
 	}
 
 	// Check if source is a directory
@@ -141,21 +176,23 @@ func loadAndStoreCRD(source, crdsDir string, force bool) error {
 	return loadAndStoreCRDFromFile(source, crdsDir, force)
 }
 
-// loadAndStoreCRDFromURL downloads a CRD from a URL and stores it
-func loadAndStoreCRDFromURL(url, crdsDir string, force bool) error {
-	resp, err := http.Get(url) //nolint:gosec // User-provided URL is intentional
+// loadAndStoreCRDFromURL downloads a CRD from a URL and stores it. When
+// sha256sum is set, the download must match it.
+func loadAndStoreCRDFromURL(url, sha256sum, crdsDir string, force bool) error {
+	filename, data, err := downloadCRD(url, sha256sum)
 	if err != nil {
-		return fmt.Errorf("fetching URL: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP %d", resp.StatusCode)
+		return err
 	}
+	destPath := filepath.Join(crdsDir, filename)
+	return storeCRD(url, data, destPath, force)
+}
 
-	data, err := io.ReadAll(resp.Body)
+// downloadCRD downloads a CRD from a URL and returns it with the filename it
+// is stored under. When sha256sum is set, the download must match it.
+func downloadCRD(url, sha256sum string) (string, []byte, error) {
+	data, err := crd.Fetch(url, sha256sum)
 	if err != nil {
-		return fmt.Errorf("reading response: %w", err)
+		return "", nil, err
 	}
 
 	// Extract canonical filename from CRD metadata (includes storage version)
@@ -168,25 +205,39 @@ func loadAndStoreCRDFromURL(url, crdsDir string, force bool) error {
 			filename = "crd-" + fmt.Sprintf("%d", len(url)%10000) + ".yaml"
 		}
 	}
+	return filename, data, nil
+}
 
-	destPath := filepath.Join(crdsDir, filename)
-
-	// Check if file exists (skip unless --force)
-	if exists, reason := crd.CRDFileExists(pkgfs.OSFileSystem{}, destPath); exists && !force {
-		fmt.Printf("Skipped: %s -> %s (%s)\n", url, destPath, reason)
-		return nil
+// loadCRDArchive stores the CRDs of an archive made by bundle-crds, after
+// checking each against the checksum recorded when it was downloaded
+func loadCRDArchive(path, crdsDir string, force bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
 	}
-
-	// Write to config directory
-	if err := os.WriteFile(destPath, data, 0644); err != nil {
-		return fmt.Errorf("writing to config: %w", err)
+	defer func() { _ = f.Close() }()
+	entries, err := crd.ReadArchive(f)
+	if err != nil {
+		return err
 	}
-
-	fmt.Printf("Loaded: %s -> %s\n", url, destPath)
+	if len(entries) == 0 {
+		return fmt.Errorf("the archive holds no CRDs")
+	}
+	if err := os.MkdirAll(crdsDir, 0755); err != nil {
+		return fmt.Errorf("creating CRD directory: %w", err)
+	}
+	for _, e := range entries {
+		source := fmt.Sprintf("%s (%s)", e.File, e.Source)
+		if err := storeCRD(source, e.Data, filepath.Join(crdsDir, e.File), force); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("\nLoaded %d CRD file(s) from %s\n", len(entries), path)
 	return nil
 }
 
-// loadAndStoreCRDFromFile loads a CRD from a file and stores it
+// loadAndStoreCRDFromFile loads a CRD from a file and stores it. A file-based
+// OLM catalog has the CRDs embedded in its bundles stored instead.
 func loadAndStoreCRDFromFile(source, crdsDir string, force bool) error {
 	data, err := os.ReadFile(source)
 	if err != nil {
@@ -197,10 +248,48 @@ func loadAndStoreCRDFromFile(source, crdsDir string, force bool) error {
 	// This also validates that the file contains a valid CRD
 	filename, err := crd.ExtractCanonicalFilename(data)
 	if err != nil {
+		if bundles, catalogErr := crd.CatalogBundles(data); catalogErr == nil {
+			return storeCatalogCRDs(source, bundles, crdsDir, force)
+		}
 		return fmt.Errorf("not a valid CRD: %w", err)
 	}
 
-	destPath := filepath.Join(crdsDir, filename)
+	return storeCRD(source, data, filepath.Join(crdsDir, filename), force)
+}
+
+// storeCatalogCRDs stores the CRDs embedded in the bundles of an OLM catalog.
+// Bundles of one package often repeat a CRD; the first bundle listing each
+// storage version of it is stored.
+func storeCatalogCRDs(source string, bundles []crd.CatalogBundle, crdsDir string, force bool) error {
+	stored := make(map[string]bool)
+	for _, b := range bundles {
+		for _, data := range b.CRDs {
+			filename, err := crd.ExtractCanonicalFilename(data)
+			if err != nil || stored[filename] {
+				continue
+			}
+			stored[filename] = true
+			label := fmt.Sprintf("%s (bundle %s)", source, b.Name)
+			if err := storeCRD(label, data, filepath.Join(crdsDir, filename), force); err != nil {
+				return err
+			}
+		}
+	}
+	if len(stored) == 0 {
+		return fmt.Errorf("no CRDs embedded in the catalog's bundles")
+	}
+	return nil
+}
+
+// storeCRD writes CRD data to destPath, skipping an existing file unless force.
+// The CRD directory is locked while storing, as other runs may store the same
+// CRD, and the file is replaced whole, as they may be reading it.
+func storeCRD(source string, data []byte, destPath string, force bool) error {
+	unlock, err := lockPath(filepath.Dir(destPath))
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	// Check if file exists (skip unless --force)
 	if exists, reason := crd.CRDFileExists(pkgfs.OSFileSystem{}, destPath); exists && !force {
@@ -209,7 +298,7 @@ func loadAndStoreCRDFromFile(source, crdsDir string, force bool) error {
 	}
 
 	// Write to config directory
-	if err := os.WriteFile(destPath, data, 0644); err != nil {
+	if err := writeFileAtomic(destPath, data, 0644); err != nil {
 		return fmt.Errorf("writing to config: %w", err)
 	}
 
@@ -217,8 +306,14 @@ func loadAndStoreCRDFromFile(source, crdsDir string, force bool) error {
 	return nil
 }
 
-// loadAndStoreCRDsFromDirectory loads all CRD YAML files from a directory
+// loadAndStoreCRDsFromDirectory loads all CRD YAML files from a directory.
+// For an OLM bundle only its manifests directory is searched.
 func loadAndStoreCRDsFromDirectory(sourceDir, crdsDir string, force bool) error {
+	if manifests := crd.BundleManifestsDir(pkgfs.OSFileSystem{}, sourceDir); manifests != "" {
+		fmt.Printf("OLM bundle: loading CRDs from %s\n", manifests)
+		sourceDir = manifests
+	}
+
 	var loaded, skipped int
 	err := filepath.WalkDir(sourceDir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
@@ -227,11 +322,11 @@ func loadAndStoreCRDsFromDirectory(sourceDir, crdsDir string, force bool) error
 		if d.IsDir() {
 			return nil
 		}
-		if !strings.HasSuffix(path, ".yaml") && !strings.HasSuffix(path, ".yml") {
+		if !strings.HasSuffix(path, ".yaml") && !strings.HasSuffix(path, ".yml") && !strings.HasSuffix(path, ".json") {
 			return nil
 		}
 
-		// Try to load each YAML file as a CRD
+		// Try to load each YAML or JSON file as a CRD or catalog
 		// Files that aren't valid CRDs are silently skipped
 		if err := loadAndStoreCRDFromFile(path, crdsDir, force); err != nil {
 			skipped++
@@ -247,9 +342,9 @@ func loadAndStoreCRDsFromDirectory(sourceDir, crdsDir string, force bool) error
 
 	if loaded == 0 {
 		if skipped > 0 {
-			fmt.Fprintf(os.Stderr, "Warning: no CRD files found in %s (%d YAML file(s) checked but none contained CRDs)\n", sourceDir, skipped)
+			fmt.Fprintf(os.Stderr, "Warning: no CRD files found in %s (%d file(s) checked but none contained CRDs)\n", sourceDir, skipped)
 		} else {
-			fmt.Fprintf(os.Stderr, "Warning: no YAML files found in %s\n", sourceDir)
+			fmt.Fprintf(os.Stderr, "Warning: no YAML or JSON files found in %s\n", sourceDir)
 		}
 	} else {
 		fmt.Printf("\nLoaded %d CRD file(s) from %s\n", loaded, sourceDir)
@@ -258,8 +353,13 @@ func loadAndStoreCRDsFromDirectory(sourceDir, crdsDir string, force bool) error
 	return nil
 }
 
-// loadCRDsFromConfig loads all CRD definitions from the plugin's config directory
+// loadCRDsFromConfig loads all CRD definitions from the plugin's config
+// directory, or with the cluster schema source, the schemas saved from the cluster
 func loadCRDsFromConfig() error {
+	if k8s.ClusterSchema() {
+		return crd.GetGlobalRegistry().LoadOpenAPIV3Directory(clusterSchemaDir())
+	}
+
 	crdsDir := crdConfigDir()
 	if info, err := os.Stat(crdsDir); err != nil || !info.IsDir() {
 		// No CRDs directory - that's fine, just skip
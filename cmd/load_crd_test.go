@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/crd"
+)
+
+func TestLoadCRDFromOLM(t *testing.T) {
+	crdData, err := os.ReadFile(filepath.Join("testdata", "crds", "list-map-keys.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const stored = "example.com_tests_v1.yaml"
+
+	t.Run("bundle directory", func(t *testing.T) {
+		pluginDir := testutil.SetupTestEnv(t)
+		testutil.ResetGlobalState(t)
+
+		bundle := t.TempDir()
+		files := map[string]string{
+			"metadata/annotations.yaml":                    "annotations:\n  operators.operatorframework.io.bundle.manifests.v1: manifests/\n",
+			"manifests/example.clusterserviceversion.yaml": "apiVersion: operators.coreos.com/v1alpha1\nkind: ClusterServiceVersion\n",
+			"manifests/example.com_tests.yaml":             string(crdData),
+			// Outside the manifests directory, so not loaded
+			"tests/scorecard/crd.yaml": strings.Replace(string(crdData), "plural: tests", "plural: others", 1),
+		}
+		writeChartFiles(t, bundle, files)
+
+		output, err := captureOutput(t, func() error {
+			return runLoadCRD(LoadCRDOptions{Sources: []string{bundle}})
+		})
+		if err != nil {
+			t.Fatalf("runLoadCRD failed: %v\nOutput: %s", err, output)
+		}
+		if !strings.Contains(output, "OLM bundle: loading CRDs from "+filepath.Join(bundle, "manifests")) {
+			t.Errorf("output should name the bundle's manifests directory, got:\n%s", output)
+		}
+		if _, err := os.Stat(filepath.Join(pluginDir, "crds", stored)); err != nil {
+			t.Errorf("expected %s to be stored: %v", stored, err)
+		}
+		if _, err := os.Stat(filepath.Join(pluginDir, "crds", "example.com_others_v1.yaml")); err == nil {
+			t.Error("CRDs outside the bundle's manifests directory should not be loaded")
+		}
+	})
+
+	t.Run("catalog", func(t *testing.T) {
+		pluginDir := testutil.SetupTestEnv(t)
+		testutil.ResetGlobalState(t)
+
+		// Two bundle versions of the package embed the same CRD
+		object := base64.StdEncoding.EncodeToString(crdData)
+		var catalog strings.Builder
+		catalog.WriteString(`{"schema": "olm.package", "name": "example-operator"}` + "\n")
+		for _, version := range []string{"v1.0.0", "v1.1.0"} {
+			catalog.WriteString(`{"schema": "olm.bundle", "name": "example-operator.` + version + `", "package": "example-operator", ` +
+				`"properties": [{"type": "olm.bundle.object", "value": {"data": "` + object + `"}}]}` + "\n")
+		}
+		catalogFile := filepath.Join(t.TempDir(), "catalog.json")
+		if err := os.WriteFile(catalogFile, []byte(catalog.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		output, err := captureOutput(t, func() error {
+			return runLoadCRD(LoadCRDOptions{Sources: []string{catalogFile}})
+		})
+		if err != nil {
+			t.Fatalf("runLoadCRD failed: %v\nOutput: %s", err, output)
+		}
+		if !strings.Contains(output, "Loaded: "+catalogFile+" (bundle example-operator.v1.0.0)") {
+			t.Errorf("output should name the bundle the CRD came from, got:\n%s", output)
+		}
+		if strings.Count(output, "Loaded:")+strings.Count(output, "Skipped:") != 1 {
+			t.Errorf("a CRD repeated across bundles should be stored once, got:\n%s", output)
+		}
+		stored, err := os.ReadFile(filepath.Join(pluginDir, "crds", stored))
+		if err != nil {
+			t.Fatalf("expected the CRD to be stored: %v", err)
+		}
+		if string(stored) != string(crdData) {
+			t.Error("stored CRD should be the decoded bundle object")
+		}
+	})
+}
+
+func TestBundleCRDs(t *testing.T) {
+	pluginDir := testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	bundle := filepath.Join(t.TempDir(), "out", "crds-bundle.tgz")
+	sources := []string{
+		filepath.Join("testdata", "crds", "list-map-keys.yaml"),
+		filepath.Join("testdata", "crds", "multi-version.yaml"),
+		// Not a CRD: reported, and the rest bundled
+		filepath.Join("testdata", "crds", "non-crd-configmap.yaml"),
+	}
+	output, err := captureOutput(t, func() error {
+		return runBundleCRDs(BundleCRDsOptions{Sources: sources, Output: bundle})
+	})
+	if err == nil || !strings.Contains(err.Error(), "1 source(s) couldn't be bundled") {
+		t.Fatalf("runBundleCRDs() error = %v, want the failed source counted\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "Bundled 2 CRD file(s)") {
+		t.Errorf("output should report 2 bundled CRDs, got:\n%s", output)
+	}
+
+	// Loaded without network access, as on an air-gapped machine
+	crd.SetOffline(true)
+	output, err = captureOutput(t, func() error {
+		return runLoadCRD(LoadCRDOptions{Bundle: bundle})
+	})
+	if err != nil {
+		t.Fatalf("runLoadCRD(--bundle) failed: %v\nOutput: %s", err, output)
+	}
+	entries, _ := os.ReadDir(filepath.Join(pluginDir, "crds"))
+	if len(entries) != 2 {
+		t.Errorf("stored %d CRD files, want 2:\n%s", len(entries), output)
+	}
+
+	_, err = captureOutput(t, func() error {
+		return runLoadCRD(LoadCRDOptions{Common: true})
+	})
+	if !errors.Is(err, crd.ErrOffline) || !strings.Contains(err.Error(), "--bundle") {
+		t.Errorf("runLoadCRD(--common) offline error = %v, want ErrOffline pointing at --bundle", err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// lockTimeout is how long to wait for another run to release a lock
+var lockTimeout = 30 * time.Second
+
+// staleLockAge is the age past which a lock is taken to be left by a run
+// that died holding it, and is replaced
+var staleLockAge = 2 * time.Minute
+
+// lockPoll is how often a held lock is checked for release
+var lockPoll = 50 * time.Millisecond
+
+// lockPath takes the lock guarding path (a file or directory in the plugin's
+// config) from other runs of the plugin, such as parallel CI jobs sharing a
+// config. The lock is a path.lock file created exclusively, so it works
+// alike on every platform and filesystem. The returned function releases it.
+func lockPath(path string) (func(), error) {
+	lock := path + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lock), 0755); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, _ = f.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+			_ = f.Close()
+			return func() { _ = os.Remove(lock) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("locking %s: %w", path, err)
+		}
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			removeStaleLock(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is locked by another run of the plugin (if none is running, remove %s)", path, lock)
+		}
+		time.Sleep(lockPoll)
+	}
+}
+
+// staleLocks numbers the stale locks this process moves aside
+var staleLocks atomic.Int64
+
+// removeStaleLock removes a lock found stale. Runs finding it stale together
+// would otherwise each remove it, the later ones removing the lock the first
+// has just taken. The lock is renamed aside instead, which only one run can
+// do, and checked again there: a fresh lock, taken by another run since this
+// one found it stale, is put back unless yet another run has locked since.
+func removeStaleLock(lock string) {
+	aside := fmt.Sprintf("%s.stale-%d-%d", lock, os.Getpid(), staleLocks.Add(1))
+	if err := os.Rename(lock, aside); err != nil {
+		return // Released, or moved aside by another run
+	}
+	if info, err := os.Stat(aside); err == nil && time.Since(info.ModTime()) <= staleLockAge {
+		if err := os.Link(aside, lock); err != nil && !errors.Is(err, os.ErrExist) {
+			// No hard links on this filesystem
+			_ = os.Rename(aside, lock)
+		}
+	}
+	_ = os.Remove(aside)
+}
+
+// writeFileAtomic writes data to path through a temporary file beside it,
+// renamed over path, so readers see the old content or the new, never a
+// partly written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".list-to-map-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
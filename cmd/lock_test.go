@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+	"gopkg.in/yaml.v3"
+)
+
+func TestLockPath(t *testing.T) {
+	prevTimeout, prevStale := lockTimeout, staleLockAge
+	defer func() { lockTimeout, staleLockAge = prevTimeout, prevStale }()
+	lockTimeout = 200 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "crds")
+	unlock, err := lockPath(path)
+	if err != nil {
+		t.Fatalf("lockPath() error = %v", err)
+	}
+	if _, err := lockPath(path); err == nil || !strings.Contains(err.Error(), "locked by another run") {
+		t.Errorf("second lockPath() error = %v, want locked", err)
+	}
+	unlock()
+	unlock, err = lockPath(path)
+	if err != nil {
+		t.Fatalf("lockPath() after unlock error = %v", err)
+	}
+
+	// A lock left by a run that died is replaced once stale
+	staleLockAge = time.Minute
+	old := time.Now().Add(-2 * time.Minute)
+	if err := os.Chtimes(path+".lock", old, old); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = lockPath(path)
+	if err != nil {
+		t.Fatalf("lockPath() over a stale lock error = %v", err)
+	}
+
+	// Another run that found the lock stale before it was taken over leaves
+	// the new lock in place
+	removeStaleLock(path + ".lock")
+	if _, err := lockPath(path); err == nil {
+		t.Error("a lock taken over from a stale one should not be removed as stale")
+	}
+	unlock()
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 0 {
+		t.Errorf("files left behind: %v", entries)
+	}
+}
+
+func TestLockPathStaleConcurrent(t *testing.T) {
+	prevTimeout, prevStale, prevPoll := lockTimeout, staleLockAge, lockPoll
+	defer func() { lockTimeout, staleLockAge, lockPoll = prevTimeout, prevStale, prevPoll }()
+	lockTimeout, staleLockAge, lockPoll = 10*time.Second, time.Minute, time.Millisecond
+
+	for round := 0; round < 20; round++ {
+		path := filepath.Join(t.TempDir(), "crds")
+		old := time.Now().Add(-2 * time.Minute)
+		if err := os.WriteFile(path+".lock", []byte("1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path+".lock", old, old); err != nil {
+			t.Fatal(err)
+		}
+
+		// Every run finds the same stale lock, but only one may hold the lock at a time
+		const runs = 16
+		var holders, overlaps atomic.Int32
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for i := 0; i < runs; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				unlock, err := lockPath(path)
+				if err != nil {
+					t.Errorf("lockPath() error = %v", err)
+					return
+				}
+				if holders.Add(1) > 1 {
+					overlaps.Add(1)
+				}
+				time.Sleep(time.Millisecond)
+				holders.Add(-1)
+				unlock()
+			}()
+		}
+		close(start)
+		wg.Wait()
+		if n := overlaps.Load(); n > 0 {
+			t.Fatalf("round %d: the lock was held by more than one run %d time(s)", round, n)
+		}
+		entries, _ := os.ReadDir(filepath.Dir(path))
+		if len(entries) != 0 {
+			t.Fatalf("round %d: files left behind: %v", round, entries)
+		}
+	}
+}
+
+func TestAddRuleConcurrent(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+
+	const runs = 8
+	errs := make(chan error, runs)
+	_, _ = captureOutput(t, func() error {
+		var wg sync.WaitGroup
+		for i := 0; i < runs; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs <- runAddRule(AddRuleOptions{Path: fmt.Sprintf("app%d.items[]", i), UniqueKeys: []string{"name"}, ConfigPath: configPath})
+			}(i)
+		}
+		wg.Wait()
+		return nil
+	})
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("runAddRule() error = %v", err)
+		}
+	}
+
+	data, _ := os.ReadFile(configPath)
+	var got Config
+	if err := yaml.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Rules) != runs {
+		t.Errorf("got %d rules, want %d: no run's rule may be lost\n%s", len(got.Rules), runs, data)
+	}
+	if _, err := os.Stat(configPath + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("lock left behind: %v", err)
+	}
+}
+
+func TestAddRuleUnparsableConfig(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	broken := "rules: [\n"
+	if err := os.WriteFile(configPath, []byte(broken), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := runAddRule(AddRuleOptions{Path: "env[]", UniqueKeys: []string{"name"}, ConfigPath: configPath})
+	if err == nil || !strings.Contains(err.Error(), "cannot parse") {
+		t.Errorf("runAddRule() error = %v, want cannot parse", err)
+	}
+	if data, _ := os.ReadFile(configPath); string(data) != broken {
+		t.Errorf("unparsable config was overwritten: %q", data)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(path, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	info, _ := os.Stat(path)
+	if string(data) != "new" || info.Mode().Perm() != 0600 {
+		t.Errorf("got %q with mode %v", data, info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestReadUserConfig(t *testing.T) {
+	prev := configReadDelay
+	defer func() { configReadDelay = prev }()
+	configReadDelay = time.Millisecond
+
+	dir := t.TempDir()
+	if c, err := readUserConfig(filepath.Join(dir, "missing.yaml")); err != nil || len(c.Rules) != 0 {
+		t.Errorf("readUserConfig(missing) = %+v, %v", c, err)
+	}
+
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("rules:\n  - pathPattern: env[]\n    uniqueKeys: [name]\nsortKeys: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := readUserConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "parsing") {
+		t.Errorf("readUserConfig(partial) error = %v, want a parse error", err)
+	}
+	if len(c.Rules) != 0 {
+		t.Errorf("a config that doesn't parse must not be half applied, got %+v", c.Rules)
+	}
+
+	if err := os.WriteFile(path, []byte("rules:\n  - pathPattern: env[]\n    uniqueKeys: [name]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := readUserConfig(path); err != nil || len(c.Rules) != 1 {
+		t.Errorf("readUserConfig() = %+v, %v", c, err)
+	}
+}
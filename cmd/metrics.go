@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Phases of a conversion timed for --metrics-file
+const (
+	phaseDetect    = "detect"    // detecting candidates in templates
+	phaseValues    = "values"    // converting values.yaml
+	phaseTemplates = "templates" // rewriting templates
+	phaseRender    = "render"    // rendering with helm for --snapshot-dir
+)
+
+// convertMetrics records the outcome of a convert run for --metrics-file. Its
+// methods do nothing on a nil receiver, so conversion code records into
+// metrics without checking whether the run collects them.
+type convertMetrics struct {
+	Chart        string             `json:"chart"`           // name of the chart converted
+	Timestamp    int64              `json:"timestamp"`       // when the run started, in Unix seconds
+	DryRun       bool               `json:"dryRun"`          // nothing was written
+	Success      bool               `json:"success"`         // the run finished without error
+	Charts       int                `json:"charts"`          // charts processed
+	FailedCharts int                `json:"failedCharts"`    // charts that couldn't be converted
+	Converted    int                `json:"converted"`       // values paths converted
+	Skipped      map[string]int     `json:"skipped"`         // paths left as lists, by category
+	ParseErrors  int                `json:"parseErrors"`     // files that couldn't be parsed
+	Duration     float64            `json:"durationSeconds"` // the whole run
+	Phases       map[string]float64 `json:"phaseSeconds"`    // time spent in each phase, summed over charts
+}
+
+// metrics collects the current convert run's metrics, if it writes them
+var metrics *convertMetrics
+
+// runConvertWithMetrics runs the conversion while collecting metrics, and
+// writes them to opts.MetricsFile whether or not it succeeds
+func runConvertWithMetrics(opts ConvertOptions) error {
+	start := time.Now()
+	metrics = &convertMetrics{
+		Timestamp: start.Unix(),
+		DryRun:    opts.DryRun,
+		Skipped:   make(map[string]int),
+		Phases:    make(map[string]float64),
+	}
+	defer func() { metrics = nil }()
+
+	err := runConvert(opts)
+	metrics.Success = err == nil
+	metrics.Duration = time.Since(start).Seconds()
+	if werr := metrics.write(opts.MetricsFile); werr != nil {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("writing metrics: %w", werr)
+	}
+	return err
+}
+
+// name sets the name of the chart the run converts, once
+func (m *convertMetrics) name(chart string) {
+	if m != nil && m.Chart == "" {
+		m.Chart = chart
+	}
+}
+
+// chart counts a processed chart
+func (m *convertMetrics) chart() {
+	if m != nil {
+		m.Charts++
+	}
+}
+
+// failed counts a chart that couldn't be converted
+func (m *convertMetrics) failed() {
+	if m != nil {
+		m.FailedCharts++
+	}
+}
+
+// converted counts converted values paths
+func (m *convertMetrics) converted(n int) {
+	if m != nil {
+		m.Converted += n
+	}
+}
+
+// skipped counts paths left as lists in a category
+func (m *convertMetrics) skipped(category string, n int) {
+	if m != nil && n > 0 {
+		m.Skipped[category] += n
+	}
+}
+
+// recordSkipped counts the paths candidate collection left as lists. Paths
+// awaiting confirmation are only left when they aren't offered for review.
+func recordSkipped(c *convertCandidates, review bool) {
+	metrics.skipped(skipTemplate, len(c.Skipped))
+	metrics.skipped(skipIgnored, len(c.Ignored))
+	metrics.skipped(skipMinItems, len(c.BelowMinItems))
+	metrics.skipped(skipConflict, len(c.Conflicts))
+	if !review {
+		metrics.skipped(skipAsk, len(c.Ask))
+	}
+}
+
+// phase adds the time since start to a phase
+func (m *convertMetrics) phase(name string, start time.Time) {
+	if m != nil {
+		m.Phases[name] += time.Since(start).Seconds()
+	}
+}
+
+// unparsed counts the files that couldn't be parsed
+func (m *convertMetrics) unparsed(errs parseErrors) {
+	if m != nil {
+		m.ParseErrors += len(errs)
+	}
+}
+
+// write writes the metrics to path, as JSON for a .json file and otherwise in
+// the Prometheus textfile format. The file is replaced by rename, so a
+// collector reading it never sees it half-written.
+func (m *convertMetrics) write(path string) error {
+	var data []byte
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var err error
+		if data, err = json.MarshalIndent(m, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	} else {
+		data = []byte(m.prometheus())
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// prometheus formats the metrics in the Prometheus text exposition format.
+// Every sample is labeled with the chart, so files from runs over different
+// charts can sit side by side in the textfile collector's directory.
+func (m *convertMetrics) prometheus() string {
+	var b strings.Builder
+	gauge := func(name, help string, samples ...string) {
+		fmt.Fprintf(&b, "# HELP helm_list_to_map_%s %s\n", name, help)
+		fmt.Fprintf(&b, "# TYPE helm_list_to_map_%s gauge\n", name)
+		for _, s := range samples {
+			fmt.Fprintf(&b, "helm_list_to_map_%s%s\n", name, s)
+		}
+	}
+	value := func(v float64) string {
+		return fmt.Sprintf("{chart=%q} %s", m.Chart, strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	labeled := func(label string, values map[string]float64) []string {
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		samples := make([]string, 0, len(keys))
+		for _, k := range keys {
+			samples = append(samples, fmt.Sprintf("{chart=%q,%s=%q} %s", m.Chart, label, k, strconv.FormatFloat(values[k], 'f', -1, 64)))
+		}
+		return samples
+	}
+
+	skipped := make(map[string]float64, len(m.Skipped))
+	for k, v := range m.Skipped {
+		skipped[k] = float64(v)
+	}
+
+	gauge("last_run_timestamp_seconds", "When the last convert run started.", value(float64(m.Timestamp)))
+	gauge("last_run_success", "Whether the last convert run finished without error.", value(boolFloat(m.Success)))
+	gauge("last_run_dry_run", "Whether the last convert run was a dry run.", value(boolFloat(m.DryRun)))
+	gauge("charts_processed", "Charts processed by the last convert run.", value(float64(m.Charts)))
+	gauge("charts_failed", "Charts the last convert run couldn't convert.", value(float64(m.FailedCharts)))
+	gauge("paths_converted", "Values paths converted by the last convert run.", value(float64(m.Converted)))
+	gauge("paths_skipped", "Values paths the last convert run left as lists, by category.", labeled("category", skipped)...)
+	gauge("parse_errors", "Files the last convert run couldn't parse.", value(float64(m.ParseErrors)))
+	gauge("run_duration_seconds", "Duration of the last convert run.", value(m.Duration))
+	gauge("phase_duration_seconds", "Time the last convert run spent in each phase.", labeled("phase", m.Phases)...)
+	return b.String()
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
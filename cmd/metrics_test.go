@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+func TestConvertMetricsFile(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	metricsFile := filepath.Join(t.TempDir(), "list-to-map.prom")
+
+	if _, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak", MetricsFile: metricsFile})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(metricsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(data)
+	for _, want := range []string{
+		"# TYPE helm_list_to_map_paths_converted gauge\n",
+		`helm_list_to_map_last_run_success{chart="basic"} 1` + "\n",
+		`helm_list_to_map_charts_processed{chart="basic"} 1` + "\n",
+		`helm_list_to_map_paths_converted{chart="basic"} 3` + "\n",
+		`helm_list_to_map_phase_duration_seconds{chart="basic",phase="detect"} `,
+		`helm_list_to_map_phase_duration_seconds{chart="basic",phase="templates"} `,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("metrics should contain %q, got:\n%s", want, text)
+		}
+	}
+	if _, err := os.Stat(metricsFile + ".tmp"); !os.IsNotExist(err) {
+		t.Error("the temporary metrics file should be renamed into place")
+	}
+}
+
+func TestConvertMetricsFileJSON(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	breakValues(t, chartPath)
+	metricsFile := filepath.Join(t.TempDir(), "metrics.json")
+
+	// A failed run still writes its metrics
+	if _, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak", MetricsFile: metricsFile})
+	}); err == nil {
+		t.Fatal("expected the values parse error to fail convert")
+	}
+	data, err := os.ReadFile(metricsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m convertMetrics
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("metrics should be JSON: %v\n%s", err, data)
+	}
+	if m.Chart != "basic" || m.Success || m.Charts != 1 || m.FailedCharts != 1 || m.ParseErrors != 1 || m.Converted != 0 {
+		t.Errorf("unexpected metrics for a failed run: %+v", m)
+	}
+	if _, ok := m.Phases[phaseDetect]; !ok {
+		t.Errorf("metrics should time the phases that ran, got %v", m.Phases)
+	}
+	if metrics != nil {
+		t.Error("metrics should stop being collected after the run")
+	}
+}
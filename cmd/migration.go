@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"gopkg.in/yaml.v3"
+)
+
+// migrationAPIVersion identifies the values-migration.yaml schema
+const migrationAPIVersion = "list-to-map/v1"
+
+// valuesMigration is the consumer migration map written after conversion.
+// It tells downstream tools how to rewrite values overrides for the chart.
+type valuesMigration struct {
+	APIVersion string           `yaml:"apiVersion"`
+	Kind       string           `yaml:"kind"`
+	Chart      string           `yaml:"chart,omitempty"`
+	Version    string           `yaml:"version,omitempty"`
+	Fields     []migrationField `yaml:"fields"`
+}
+
+// migrationField describes how one converted field changed shape, and where
+// it moved to if renamePaths renamed it
+type migrationField struct {
+	Old         migrationShape `yaml:"old"`
+	New         migrationShape `yaml:"new"`
+	ElementType string         `yaml:"elementType,omitempty"`
+}
+
+// migrationShape is a values path and the shape of the value stored there.
+// For maps, Key is the list item field whose value became the map key. Maps
+// keyed by several fields list them in Keys, outermost first, with the
+// KeyStrategy combining them: "nested" or "composite" (joined with "/").
+// Reshaped map entries rename item fields by Rename, and an entry holding only
+// the Scalar field is that field's value. A Synthetic key isn't an item field:
+// it only names the entries, and is dropped from the items converted to them.
+type migrationShape struct {
+	Path        string            `yaml:"path"`
+	Shape       string            `yaml:"shape"` // "list", "map", or "set" (each value a key set to true)
+	Key         string            `yaml:"key,omitempty"`
+	Keys        []string          `yaml:"keys,omitempty"`
+	KeyStrategy string            `yaml:"keyStrategy,omitempty"`
+	Rename      map[string]string `yaml:"rename,omitempty"`
+	Scalar      string            `yaml:"scalar,omitempty"`
+	Synthetic   bool              `yaml:"synthetic,omitempty"`
+}
+
+// newMigrationField returns the field entry for a list at path converted to a map keyed by key
+func newMigrationField(path, key, elementType string) migrationField {
+	return migrationField{
+		Old:         migrationShape{Path: path, Shape: "list"},
+		New:         migrationShape{Path: path, Shape: "map", Key: key},
+		ElementType: elementType,
+	}
+}
+
+// newSetMigrationField returns the field entry for a list at path converted to
+// a set of its values (or of its items' key fields, if key is set)
+func newSetMigrationField(path, key, elementType string) migrationField {
+	f := newMigrationField(path, key, elementType)
+	f.New.Shape = "set"
+	return f
+}
+
+// candidateMigrationField returns the field entry for a converted candidate
+func candidateMigrationField(c k8s.DetectedCandidate) migrationField {
+	if c.Set {
+		return newSetMigrationField(c.ValuesPath, c.MergeKey, c.ElementType)
+	}
+	f := newMigrationField(c.ValuesPath, c.MergeKey, c.ElementType)
+	if c.KeyStrategy != "" {
+		f.New.Key, f.New.Keys, f.New.KeyStrategy = "", c.MergeKeys, c.KeyStrategy
+	}
+	f.New.Rename, f.New.Scalar, f.New.Synthetic = c.Rename, c.Scalar, c.Synthetic
+	if c.NewPath != "" {
+		f.New.Path = c.NewPath
+	}
+	return f
+}
+
+// readMigrationFile reads a consumer migration map. A missing file is an empty
+// map along with the error from reading it.
+func readMigrationFile(path string) (valuesMigration, error) {
+	m := valuesMigration{APIVersion: migrationAPIVersion, Kind: "ValuesMigration"}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// writeMigrationFile writes the migration map for the chart at root to path
+// (relative to root). Fields from an earlier run that are not converted again
+// are kept, so repeated conversions accumulate a complete map.
+func writeMigrationFile(root, path string, fields []migrationField) error {
+	if path == "" || len(fields) == 0 {
+		return nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+
+	m, err := readMigrationFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "Chart.yaml")); err == nil {
+		var chart ChartYAML
+		if yaml.Unmarshal(data, &chart) == nil {
+			m.Chart = chart.Name
+			m.Version = chart.Version
+		}
+	}
+
+	index := make(map[string]int, len(m.Fields))
+	for i, f := range m.Fields {
+		index[f.Old.Path] = i
+	}
+	for _, f := range fields {
+		if i, ok := index[f.Old.Path]; ok {
+			m.Fields[i] = f
+			continue
+		}
+		index[f.Old.Path] = len(m.Fields)
+		m.Fields = append(m.Fields, f)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by helm list-to-map: how values paths changed shape in this chart.\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(m); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("\nWrote consumer migration map: %s\n", rel(root, path))
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/crd"
+)
+
+// offlineEnv turns network access off for every command, like --offline, when
+// set to true
+const offlineEnv = "HELM_LIST_TO_MAP_OFFLINE"
+
+// useOffline takes --offline, which every command accepts, out of args and
+// turns network access off if it was given or offlineEnv is set. Arguments
+// after -- are left as they are.
+func useOffline(args []string) []string {
+	off, _ := strconv.ParseBool(os.Getenv(offlineEnv))
+	rest := make([]string, 0, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		switch arg {
+		case "--offline", "-offline", "--offline=true", "-offline=true":
+			off = true
+		case "--offline=false", "-offline=false":
+			off = false
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	crd.SetOffline(off)
+	return rest
+}
+
+// requireNetwork fails while network access is off, naming what needs it
+func requireNetwork(what string) error {
+	if !crd.Offline() {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", what, crd.ErrOffline)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/crd"
+)
+
+func TestUseOffline(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		args    []string
+		want    []string
+		offline bool
+	}{
+		{
+			name: "not given",
+			args: []string{"load-crd", "--common"},
+			want: []string{"load-crd", "--common"},
+		},
+		{
+			name:    "any command, anywhere",
+			args:    []string{"--offline", "convert", "--chart", "."},
+			want:    []string{"convert", "--chart", "."},
+			offline: true,
+		},
+		{
+			name:    "single dash",
+			args:    []string{"load-crd", "-offline", "--bundle", "b.tgz"},
+			want:    []string{"load-crd", "--bundle", "b.tgz"},
+			offline: true,
+		},
+		{
+			name: "left after --",
+			args: []string{"convert-values", "--", "--offline"},
+			want: []string{"convert-values", "--", "--offline"},
+		},
+		{
+			name:    "from the environment",
+			env:     "true",
+			args:    []string{"detect"},
+			want:    []string{"detect"},
+			offline: true,
+		},
+		{
+			name: "flag overrides the environment",
+			env:  "1",
+			args: []string{"detect", "--offline=false"},
+			want: []string{"detect"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.ResetGlobalState(t)
+			t.Setenv(offlineEnv, tt.env)
+			got := useOffline(tt.args)
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("useOffline() = %q, want %q", got, tt.want)
+			}
+			if crd.Offline() != tt.offline {
+				t.Errorf("offline = %v, want %v", crd.Offline(), tt.offline)
+			}
+		})
+	}
+	crd.SetOffline(false)
+}
+
+func TestOfflineForbidsNetwork(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	crd.SetOffline(true)
+	defer crd.SetOffline(false)
+
+	for name, run := range map[string]func() error{
+		"pull":           func() error { _, err := pullChart("oci://example.com/charts/app", "", t.TempDir()); return err },
+		"release values": func() error { _, err := fetchReleaseValues(ConvertReleaseValuesOptions{Release: "app"}); return err },
+		"cluster":        func() error { return runLoadClusterOpenAPI(LoadOpenAPIOptions{}) },
+		"openapi":        func() error { return runLoadOpenAPI(LoadOpenAPIOptions{KubeVersion: "1.27"}) },
+	} {
+		if err := run(); !errors.Is(err, crd.ErrOffline) {
+			t.Errorf("%s: error = %v, want ErrOffline", name, err)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 // DetectOptions holds configuration for the detect command
 type DetectOptions struct {
 	ChartDir         string
@@ -8,17 +10,109 @@ type DetectOptions struct {
 	IncludeChartsDir bool
 	ExpandRemote     bool
 	Verbose          bool
+	NoColor          bool
+	Check            bool     // read-only check that fails when anything is convertible
+	Quiet            bool     // print only findings
+	Files            []string // restrict --check to these changed files (empty = whole chart)
+	Watch            bool     // re-run detection when chart files change
+	KubeVersion      string   // Kubernetes release to resolve types for (empty = config or any)
+	SchemaSource     string   // types or cluster (empty = config or types)
+	ConfigDataKey    string   // key field for lists in ConfigMap/Secret data (empty = config or off)
+	GroupBy          string   // group detected arrays by path, template, or resource
 }
 
 // ConvertOptions holds configuration for the convert command
 type ConvertOptions struct {
-	ChartDir         string
-	ConfigPath       string
-	DryRun           bool
-	BackupExt        string
-	Recursive        bool
-	IncludeChartsDir bool
-	ExpandRemote     bool
+	ChartDir          string
+	ConfigPath        string
+	DryRun            bool
+	BackupExt         string
+	MaxBackups        int // keep at most this many backup snapshots (0 = keep all)
+	Recursive         bool
+	IncludeChartsDir  bool
+	ExpandRemote      bool
+	TUI               bool     // interactively review candidates before applying
+	Paths             []string // restrict conversion to these values paths (empty = all)
+	HelmDocs          bool     // run helm-docs after converting
+	ConvertComments   bool     // rewrite commented-out examples of converted lists to map syntax
+	MigrationFile     string   // consumer migration map path relative to the chart (empty = skip)
+	ValuesFiles       []string // override values files merged for the env order check (-f)
+	Keys              []string // per-path key overrides for this run, as <values path>=<field>
+	EnvDependencySort bool     // render env vars through the dependency-ordered helper
+	KubeVersion       string   // Kubernetes release to resolve types for (empty = config or any)
+	SchemaSource      string   // types or cluster (empty = config or types)
+	ConfigDataKey     string   // key field for lists in ConfigMap/Secret data (empty = config or off)
+	SnapshotDir       string   // save renders from before and after converting here (empty = skip)
+	UnitTests         bool     // write a helm-unittest suite for the converted paths
+	BumpVersion       string   // bump the chart version by major, minor, or patch (empty = keep)
+	Upgrading         bool     // add before/after examples of the converted values to UPGRADING.md
+	ChartRef          string   // chart reference to pull and convert (repo/chart, oci://, or URL)
+	Version           string   // chart version when ChartRef is set
+	OutputDir         string   // where to pull ChartRef to (empty = ./<chart name>)
+	MetricsFile       string   // write run metrics here, as JSON for .json or Prometheus text (empty = skip)
+	Summary           string   // summary to end the run with: short, full, or none (empty = none)
+	Atomic            bool     // convert a copy in a scratch directory and sync the changes back once it validates
+	Workdir           string   // where to make the scratch copy (empty = system temp dir; implies Atomic)
+	ShownAs           string   // the chart ChartDir is a scratch copy of, which paths are printed under (empty = ChartDir)
+	NoColor           bool
+}
+
+// ConvertReleaseOptions holds configuration for the convert-release command
+type ConvertReleaseOptions struct {
+	File      string // manifest file with embedded values
+	Chart     string // chart path or reference the values belong to
+	Version   string // chart version when Chart is a reference
+	DryRun    bool
+	BackupExt string
+	NoColor   bool
+}
+
+// ConvertReleaseValuesOptions holds configuration for the convert-release-values command
+type ConvertReleaseValuesOptions struct {
+	Release     string // installed release name
+	Namespace   string // release namespace (empty = helm's default)
+	KubeContext string // kubeconfig context (empty = helm's default)
+	Revision    int    // release revision (0 = latest)
+	Chart       string // converted chart path or reference
+	Version     string // chart version when Chart is a reference
+	Output      string // converted values file ("-" = stdout)
+	NoColor     bool
+}
+
+// ConvertHelmfileOptions holds configuration for the convert-helmfile command
+type ConvertHelmfileOptions struct {
+	File      string // helmfile.yaml or a directory of helmfiles
+	Chart     string // chart path or reference the releases deploy
+	Version   string // chart version when Chart is a reference
+	DryRun    bool
+	BackupExt string
+	NoColor   bool
+}
+
+// ConvertKustomizeOptions holds configuration for the convert-kustomize command
+type ConvertKustomizeOptions struct {
+	File      string // kustomization.yaml or a directory of kustomizations
+	Chart     string // chart path or reference the helmCharts entries deploy
+	Version   string // chart version when Chart is a reference
+	DryRun    bool
+	BackupExt string
+	NoColor   bool
+}
+
+// ConvertTerraformOptions holds configuration for the convert-terraform command
+type ConvertTerraformOptions struct {
+	File      string // Terraform file or a directory of .tf and .tfvars files
+	Chart     string // chart path or reference the helm_release resources deploy
+	Version   string // chart version when Chart is a reference
+	DryRun    bool
+	BackupExt string
+	NoColor   bool
+}
+
+// ConvertValuesOptions holds configuration for the convert-values command
+type ConvertValuesOptions struct {
+	Paths string // comma-separated path=key pairs to convert
+	Input string // values file to read ("-" or empty = stdin)
 }
 
 // LoadCRDOptions holds configuration for the load-crd command
@@ -26,6 +120,26 @@ type LoadCRDOptions struct {
 	Sources []string
 	Force   bool
 	Common  bool
+	Bundle  string        // Archive made by bundle-crds
+	Timeout time.Duration // Limit for each download attempt
+	Retries int           // Extra attempts after a failure that may be transient
+}
+
+// BundleCRDsOptions holds configuration for the bundle-crds command
+type BundleCRDsOptions struct {
+	Sources []string
+	Common  bool
+	Output  string
+	Timeout time.Duration // Limit for each download attempt
+	Retries int           // Extra attempts after a failure that may be transient
+}
+
+// LoadOpenAPIOptions holds configuration for the load-openapi command
+type LoadOpenAPIOptions struct {
+	KubeVersion string
+	Source      string // swagger.json file or URL (empty = the release's spec on GitHub)
+	Force       bool
+	Cluster     bool // save the current cluster's /openapi/v3 schemas instead
 }
 
 // ListCRDsOptions holds configuration for the list-crds command
@@ -33,13 +147,133 @@ type ListCRDsOptions struct {
 	Verbose bool
 }
 
+// CRDDiffOptions holds configuration for the crd diff command
+type CRDDiffOptions struct {
+	Type string // CRD group/kind (e.g., monitoring.coreos.com/Alertmanager)
+	From string // First version to compare (e.g., v1)
+	To   string // Second version to compare (e.g., v1alpha1)
+}
+
 // AddRuleOptions holds configuration for the add-rule command
 type AddRuleOptions struct {
 	Path       string
-	UniqueKey  string
+	UniqueKeys []string
 	ConfigPath string
+	Ignore     bool
+	Set        bool
+	// KeyStrategy converts by several unique keys (nested or composite)
+	KeyStrategy   string
+	PromoteScalar string // field scalar items are promoted into
+	Note          string // why the rule exists, kept with it in the config
+}
+
+// RuleTestOptions holds configuration for the rules test command
+type RuleTestOptions struct {
+	Path      string
+	UniqueKey string
+	ChartDir  string
 }
 
 // ListRulesOptions holds configuration for the rules command
 // Currently has no options, but included for consistency
 type ListRulesOptions struct{}
+
+// DoctorOptions holds configuration for the doctor command
+type DoctorOptions struct {
+	ChartDir string
+	Offline  bool
+}
+
+// StatsOptions holds configuration for the stats command
+type StatsOptions struct {
+	Charts  []string // chart directories (empty = current directory)
+	Output  string   // text or json
+	NoColor bool
+}
+
+// PackageOptions holds configuration for the package command
+type PackageOptions struct {
+	ChartDir     string
+	Destination  string // directory to write the chart archive to
+	InPlace      bool   // convert the chart itself instead of a temporary copy
+	BackupExt    string
+	KubeVersion  string // Kubernetes release to resolve types for (empty = config or any)
+	SchemaSource string // types or cluster (empty = config or types)
+	BumpVersion  string // bump the chart version by major, minor, or patch (empty = keep)
+	NoColor      bool
+}
+
+// DiffValuesOptions holds configuration for the diff-values command
+type DiffValuesOptions struct {
+	Original      string // list-style values file
+	Converted     string // map-style values file to compare with it
+	Paths         string // comma-separated path=key pairs converted
+	MigrationFile string // migration map recording the converted paths
+	NoColor       bool
+}
+
+// DecisionsOptions holds configuration for the decisions command
+type DecisionsOptions struct {
+	Charts []string // chart directories (empty = current directory)
+}
+
+// AnalyzeOptions holds configuration for the analyze command
+type AnalyzeOptions struct {
+	Charts []string // chart directories (empty = current directory)
+	Stream bool     // write events as JSON lines as each path is decided
+}
+
+// DriftOptions holds configuration for the drift command
+type DriftOptions struct {
+	ChartDir      string
+	MigrationFile string   // consumer migration map recording converted paths, relative to the chart
+	ValuesFiles   []string // other values files to check, such as ci/ values
+	NoColor       bool
+}
+
+// RevertOptions holds configuration for the revert command
+type RevertOptions struct {
+	ChartDir  string
+	BackupExt string
+	Snapshot  string   // snapshot ID to restore (empty = latest)
+	Files     []string // restore only these files, relative to the chart (empty = all)
+	List      bool
+}
+
+// CleanOptions holds configuration for the clean command
+type CleanOptions struct {
+	ChartDir  string
+	BackupExt string
+	DryRun    bool
+}
+
+// VerifyOptions holds configuration for the verify command
+type VerifyOptions struct {
+	ChartDir      string
+	Overrides     string // directory of sample override files (empty = chart defaults only)
+	Original      string // chart path or reference before conversion (empty = restore from backups)
+	MigrationFile string // migration map relative to the chart, to convert the overrides with
+	BackupExt     string
+	NoColor       bool
+}
+
+// VersionOptions holds configuration for the version command
+type VersionOptions struct {
+	ChartDir string // report the helper version of this chart (empty = skip)
+}
+
+// UpgradeHelpersOptions holds configuration for the upgrade-helpers command
+type UpgradeHelpersOptions struct {
+	ChartDir  string
+	BackupExt string
+}
+
+// SnapshotTestOptions holds configuration for the snapshot-test command
+type SnapshotTestOptions struct {
+	ChartDir     string
+	Golden       string // directory of golden manifests, one file per source template
+	Update       bool   // write the golden manifests from the chart instead of comparing
+	KubeVersion  string // Kubernetes release to resolve types for (empty = config or any)
+	SchemaSource string // types or cluster (empty = config or types)
+	NoColor      bool
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runPackage converts a chart, lints the result, and packages it with helm.
+// The conversion runs on a temporary copy of the chart unless --in-place is
+// set. Backups written by the conversion are left out of the package, and no
+// migration map is written into it.
+func runPackage(opts PackageOptions) error {
+	root, err := findChartRoot(opts.ChartDir)
+	if err != nil {
+		return err
+	}
+	// Fail before converting, which --in-place would leave behind
+	if _, err := helmCommand(); err != nil {
+		return err
+	}
+	dest := opts.Destination
+	if dest == "" {
+		dest = "."
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return fmt.Errorf("creating destination: %w", err)
+	}
+
+	tmp, err := os.MkdirTemp("", "list-to-map-package-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+
+	// The copy is named after the chart, which helm lint expects
+	name := chartName(root)
+	if name == "" {
+		name = filepath.Base(root)
+	}
+	work := root
+	if !opts.InPlace {
+		work = filepath.Join(tmp, name)
+		if err := copyDir(root, work); err != nil {
+			return fmt.Errorf("copying chart: %w", err)
+		}
+		fmt.Printf("Converting a copy of %s\n", root)
+	}
+
+	if err := runConvert(ConvertOptions{
+		ChartDir:     work,
+		BackupExt:    opts.BackupExt,
+		KubeVersion:  opts.KubeVersion,
+		SchemaSource: opts.SchemaSource,
+		BumpVersion:  opts.BumpVersion,
+	}); err != nil {
+		return fmt.Errorf("converting: %w", err)
+	}
+
+	// Package a copy without the backups, in place or not
+	stage := work
+	if opts.InPlace {
+		stage = filepath.Join(tmp, name)
+		if err := copyDir(root, stage); err != nil {
+			return fmt.Errorf("copying chart: %w", err)
+		}
+	}
+	if err := removeBackups(stage, opts.BackupExt); err != nil {
+		return err
+	}
+
+	fmt.Println("\nLinting the converted chart")
+	lint, err := helmCommand("lint", stage)
+	if err != nil {
+		return err
+	}
+	if out, err := lint.CombinedOutput(); err != nil {
+		return fmt.Errorf("converted chart failed helm lint: %v\n%s", err, strings.TrimSpace(string(out)))
+	}
+
+	absDest, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+	pkg, err := helmCommand("package", stage, "--destination", absDest)
+	if err != nil {
+		return err
+	}
+	if out, err := pkg.CombinedOutput(); err != nil {
+		return fmt.Errorf("packaging chart: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	archive := fmt.Sprintf("%s-%s.tgz", chartName(stage), chartVersion(stage))
+	fmt.Println(green(fmt.Sprintf("Packaged the converted chart: %s", filepath.Join(dest, archive))))
+	return nil
+}
+
+// removeBackups removes the backup files of every snapshot under root
+func removeBackups(root, ext string) error {
+	snapshots, err := listBackupSnapshots(root, ext)
+	if err != nil {
+		return fmt.Errorf("listing backups: %w", err)
+	}
+	for _, s := range snapshots {
+		for _, f := range s.Files {
+			if err := os.Remove(f.Backup); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+// fakeHelmPackage stands in for helm lint and helm package. Packaging copies
+// the chart directory to <destination>/packaged so tests can inspect it, and
+// lint fails when lintOK is false.
+func fakeHelmPackage(t *testing.T, lintOK bool) {
+	t.Helper()
+	lintExit := "0"
+	if !lintOK {
+		lintExit = "1"
+	}
+	// helm lint <dir> | helm package <dir> --destination <dest>
+	script := `#!/bin/sh
+if [ "$1" = lint ]; then
+  echo "1 chart(s) linted"
+  exit ` + lintExit + `
+fi
+cp -r "$2" "$4/packaged"
+`
+	bin := filepath.Join(t.TempDir(), "helm")
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HELM_BIN", bin)
+}
+
+func TestPackage(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	fakeHelmPackage(t, true)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	original, err := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(t.TempDir(), "dist")
+
+	output, err := captureOutput(t, func() error {
+		return runPackage(PackageOptions{ChartDir: chartPath, Destination: dest, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runPackage failed: %v\n%s", err, output)
+	}
+	if !strings.Contains(output, "Packaged the converted chart: "+filepath.Join(dest, "basic-0.1.0.tgz")) {
+		t.Errorf("expected the archive to be reported, got:\n%s", output)
+	}
+
+	packaged := filepath.Join(dest, "packaged")
+	values, err := os.ReadFile(filepath.Join(packaged, "values.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(values), "DB_HOST:") {
+		t.Errorf("expected converted values in the package, got:\n%s", values)
+	}
+	if _, err := os.Stat(filepath.Join(packaged, "values-migration.yaml")); !os.IsNotExist(err) {
+		t.Errorf("expected no migration map in the package, stat error = %v", err)
+	}
+	snapshots, err := listBackupSnapshots(packaged, ".bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 0 {
+		t.Errorf("expected no backups in the package, got %d snapshot(s)", len(snapshots))
+	}
+
+	// The chart itself is left alone
+	after, err := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(original) {
+		t.Errorf("expected the chart's values.yaml to be unchanged, got:\n%s", after)
+	}
+}
+
+func TestPackageInPlace(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	fakeHelmPackage(t, true)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	dest := t.TempDir()
+
+	output, err := captureOutput(t, func() error {
+		return runPackage(PackageOptions{ChartDir: chartPath, Destination: dest, InPlace: true, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runPackage failed: %v\n%s", err, output)
+	}
+
+	values, err := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(values), "DB_HOST:") {
+		t.Errorf("expected the chart to be converted in place, got:\n%s", values)
+	}
+	// Backups stay with the chart, but not in the package
+	if snapshots, _ := listBackupSnapshots(chartPath, ".bak"); len(snapshots) == 0 {
+		t.Error("expected the conversion's backups to stay with the chart")
+	}
+	if snapshots, _ := listBackupSnapshots(filepath.Join(dest, "packaged"), ".bak"); len(snapshots) != 0 {
+		t.Errorf("expected no backups in the package, got %d snapshot(s)", len(snapshots))
+	}
+}
+
+func TestPackageLintFailure(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	fakeHelmPackage(t, false)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	dest := t.TempDir()
+
+	output, err := captureOutput(t, func() error {
+		return runPackage(PackageOptions{ChartDir: chartPath, Destination: dest, BackupExt: ".bak"})
+	})
+	if err == nil || !strings.Contains(err.Error(), "failed helm lint") {
+		t.Fatalf("expected a lint failure, got %v\n%s", err, output)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "packaged")); !os.IsNotExist(err) {
+		t.Error("expected nothing to be packaged when lint fails")
+	}
+}
+
+func TestPackageWithoutHelm(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	t.Setenv("HELM_BIN", filepath.Join(t.TempDir(), "helm"))
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	original, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+
+	output, err := captureOutput(t, func() error {
+		return runPackage(PackageOptions{ChartDir: chartPath, Destination: t.TempDir(), InPlace: true, BackupExt: ".bak"})
+	})
+	if err == nil || !strings.Contains(err.Error(), "install helm or set HELM_BIN") {
+		t.Fatalf("expected helm not found, got %v\n%s", err, output)
+	}
+	// Nothing is converted when the chart can't be packaged
+	if after, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml")); string(after) != string(original) {
+		t.Errorf("expected the chart's values.yaml to be unchanged, got:\n%s", after)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/parser"
+)
+
+// parseErrors collects the chart files a command couldn't parse, so it can go
+// on with the rest and report them together at the end
+type parseErrors []*parser.FileError
+
+// add records err if it is located in a file, reporting whether it was
+func (p *parseErrors) add(err error) bool {
+	var fe *parser.FileError
+	if !errors.As(err, &fe) {
+		return false
+	}
+	for _, seen := range *p {
+		if seen.Error() == fe.Error() {
+			return true
+		}
+	}
+	*p = append(*p, fe)
+	return true
+}
+
+// report prints the collected errors to stderr, each with the offending line
+// where known, and returns an error counting the files, or nil if there are none
+func (p parseErrors) report() error {
+	metrics.unparsed(p)
+	if len(p) == 0 {
+		return nil
+	}
+	sort.SliceStable(p, func(i, j int) bool {
+		if p[i].File != p[j].File {
+			return p[i].File < p[j].File
+		}
+		return p[i].Line < p[j].Line
+	})
+
+	files := make(map[string]bool)
+	for _, fe := range p {
+		files[fe.File] = true
+	}
+	fmt.Fprintln(os.Stderr, "\n"+red(fmt.Sprintf("Could not parse %d file(s):", len(files))))
+	for _, fe := range p {
+		fmt.Fprintf(os.Stderr, "  %s\n", fe)
+		if fe.Source == "" {
+			continue
+		}
+		gutter := strings.Repeat(" ", len(fmt.Sprint(fe.Line)))
+		fmt.Fprintf(os.Stderr, "    %d | %s\n", fe.Line, fe.Source)
+		if fe.Column > 0 && fe.Column <= len(fe.Source)+1 {
+			// The column follows the line's indentation, so reuse it, tabs and all
+			fmt.Fprintf(os.Stderr, "    %s | %s^\n", gutter, fe.Source[:fe.Column-1])
+		}
+	}
+	return fmt.Errorf("%d file(s) could not be parsed", len(files))
+}
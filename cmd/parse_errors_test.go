@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+// breakValues appends a line yaml.v3 can't parse to a chart's values.yaml
+func breakValues(t *testing.T, chartPath string) {
+	t.Helper()
+	valuesPath := filepath.Join(chartPath, "values.yaml")
+	data, err := os.ReadFile(valuesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(valuesPath, append(data, "broken:\n  key: a: b\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDetectReportsParseErrors(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	breakValues(t, chartPath)
+	data, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	line := strings.Count(string(data), "\n")
+
+	output, err := captureOutput(t, func() error {
+		return runDetect(DetectOptions{ChartDir: chartPath})
+	})
+	if err == nil || err.Error() != "1 file(s) could not be parsed" {
+		t.Fatalf("expected the parse error to fail detect, got %v", err)
+	}
+
+	// Templates are still scanned, with the error summarized after them
+	detected := strings.Index(output, "Detected convertible arrays:")
+	summary := strings.Index(output, "Could not parse 1 file(s):")
+	if detected < 0 || summary < detected {
+		t.Errorf("detection should go on and summarize the error at the end, got:\n%s", output)
+	}
+	loc := filepath.Join(chartPath, "values.yaml") + ":" + strconv.Itoa(line) + ":3: mapping values are not allowed in this context"
+	if !strings.Contains(output, loc) {
+		t.Errorf("output should locate the error as %q, got:\n%s", loc, output)
+	}
+	if !strings.Contains(output, strconv.Itoa(line)+" |   key: a: b\n") || !strings.Contains(output, " |   ^\n") {
+		t.Errorf("output should quote the offending line, got:\n%s", output)
+	}
+}
+
+func TestConvertRecursiveReportsParseErrors(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/umbrella")
+	subchart := filepath.Join(chartPath, "subcharts", "subchart-a")
+	breakValues(t, subchart)
+	original, _ := os.ReadFile(filepath.Join(subchart, "values.yaml"))
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, Recursive: true, BackupExt: ".bak"})
+	})
+	if err == nil || err.Error() != "1 file(s) could not be parsed" {
+		t.Fatalf("expected the parse error to fail convert, got %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "=== Conversion Summary ===") {
+		t.Errorf("convert should go on past the subchart, got:\n%s", output)
+	}
+	if !strings.Contains(output, filepath.Join(subchart, "values.yaml")+":") {
+		t.Errorf("output should name the file that couldn't be parsed, got:\n%s", output)
+	}
+	after, _ := os.ReadFile(filepath.Join(subchart, "values.yaml"))
+	if string(after) != string(original) {
+		t.Error("values that couldn't be parsed should be left as they are")
+	}
+}
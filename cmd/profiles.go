@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// profileEnv selects a profile of the user config, like --profile
+const profileEnv = "HELM_LIST_TO_MAP_PROFILE"
+
+// useProfile takes --profile <name>, which every command accepts, out of args
+// and returns the profile it selects, or the one profileEnv names if it isn't
+// given. Arguments after -- are left as they are.
+func useProfile(args []string) (string, []string, error) {
+	profile := os.Getenv(profileEnv)
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		switch {
+		case arg == "--profile" || arg == "-profile":
+			if i+1 >= len(args) {
+				return "", nil, fmt.Errorf("flag needs an argument: %s", arg)
+			}
+			i++
+			profile = args[i]
+		case strings.HasPrefix(arg, "--profile="):
+			profile = strings.TrimPrefix(arg, "--profile=")
+		case strings.HasPrefix(arg, "-profile="):
+			profile = strings.TrimPrefix(arg, "-profile=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return profile, rest, nil
+}
+
+// applyProfile merges the named profile of c over the rest of c, as a chart
+// config is merged: its settings replace c's, and its rules and ignores come
+// first. An empty name leaves c as it is.
+func applyProfile(c Config, name string) (Config, error) {
+	if name == "" {
+		return c, nil
+	}
+	node, ok := c.Profiles[name]
+	if !ok {
+		if len(c.Profiles) == 0 {
+			return c, fmt.Errorf("unknown profile %q: the user config has no profiles", name)
+		}
+		names := make([]string, 0, len(c.Profiles))
+		for n := range c.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return c, fmt.Errorf("unknown profile %q: want one of %s", name, strings.Join(names, ", "))
+	}
+	if node.Kind != 0 && node.Kind != yaml.MappingNode && !(node.Kind == yaml.ScalarNode && node.Tag == "!!null") {
+		return c, fmt.Errorf("profile %q: not a mapping of config settings", name)
+	}
+	data, err := yaml.Marshal(&node)
+	if err != nil {
+		return c, err
+	}
+	merged, err := mergeConfig(c, data)
+	if err != nil {
+		return c, fmt.Errorf("profile %q: %w", name, err)
+	}
+	return merged, nil
+}
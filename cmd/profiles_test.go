@@ -0,0 +1,227 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"gopkg.in/yaml.v3"
+)
+
+func TestUseProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		args    []string
+		want    []string
+		profile string
+		wantErr bool
+	}{
+		{
+			name: "not given",
+			args: []string{"convert", "--chart", "."},
+			want: []string{"convert", "--chart", "."},
+		},
+		{
+			name:    "separate value, any command",
+			args:    []string{"--profile", "strict", "detect", "--chart", "."},
+			want:    []string{"detect", "--chart", "."},
+			profile: "strict",
+		},
+		{
+			name:    "joined value",
+			args:    []string{"convert", "-profile=lenient"},
+			want:    []string{"convert"},
+			profile: "lenient",
+		},
+		{
+			name:    "from the environment",
+			env:     "strict",
+			args:    []string{"rules"},
+			want:    []string{"rules"},
+			profile: "strict",
+		},
+		{
+			name:    "flag overrides the environment",
+			env:     "strict",
+			args:    []string{"detect", "--profile=lenient"},
+			want:    []string{"detect"},
+			profile: "lenient",
+		},
+		{
+			name: "left after --",
+			args: []string{"convert-values", "--", "--profile", "strict"},
+			want: []string{"convert-values", "--", "--profile", "strict"},
+		},
+		{
+			name:    "missing value",
+			args:    []string{"detect", "--profile"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(profileEnv, tt.env)
+			profile, rest, err := useProfile(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("useProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if profile != tt.profile || strings.Join(rest, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("useProfile() = %q, %q; want %q, %q", profile, rest, tt.profile, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	t.Parallel()
+
+	const user = `minItems: 2
+envOrdering: skip
+ignorePaths: [user.ignored]
+rules:
+  - pathPattern: user.list[]
+    uniqueKeys: [name]
+profiles:
+  strict:
+    minItems: 0
+    envOrdering: order-field
+    ignorePaths: [strict.ignored]
+    rules:
+      - pathPattern: strict.list[]
+        uniqueKeys: [id]
+    profiles:
+      nested:
+        minItems: 9
+  empty:
+  broken: [minItems]
+`
+	var base Config
+	if err := yaml.Unmarshal([]byte(user), &base); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		profile string
+		check   func(t *testing.T, c Config)
+		wantErr string
+	}{
+		{
+			name: "none selected",
+			check: func(t *testing.T, c Config) {
+				if c.MinItems != 2 || c.EnvOrdering != envOrderingSkip || len(c.Rules) != 1 {
+					t.Errorf("config should be left as it is, got %+v", c)
+				}
+			},
+		},
+		{
+			name:    "merged over the user config",
+			profile: "strict",
+			check: func(t *testing.T, c Config) {
+				if c.MinItems != 0 || c.EnvOrdering != envOrderingOrderField {
+					t.Errorf("profile settings should replace the user config's, got minItems %d, envOrdering %q", c.MinItems, c.EnvOrdering)
+				}
+				if len(c.Rules) != 2 || c.Rules[0].PathPattern != "strict.list[]" || c.Rules[1].PathPattern != "user.list[]" {
+					t.Errorf("profile rules should come first, got %+v", c.Rules)
+				}
+				if strings.Join(c.IgnorePaths, ",") != "strict.ignored,user.ignored" {
+					t.Errorf("profile ignores should come first, got %v", c.IgnorePaths)
+				}
+				if _, ok := c.Profiles["nested"]; ok {
+					t.Error("a profile shouldn't define profiles")
+				}
+			},
+		},
+		{
+			name:    "empty profile",
+			profile: "empty",
+			check: func(t *testing.T, c Config) {
+				if c.MinItems != 2 || len(c.Rules) != 1 {
+					t.Errorf("an empty profile should change nothing, got %+v", c)
+				}
+			},
+		},
+		{
+			name:    "unknown",
+			profile: "lenient",
+			wantErr: `unknown profile "lenient": want one of broken, empty, strict`,
+		},
+		{
+			name:    "not a mapping",
+			profile: "broken",
+			wantErr: `profile "broken": not a mapping of config settings`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := applyProfile(base, tt.profile)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("applyProfile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyProfile() error = %v", err)
+			}
+			tt.check(t, got)
+		})
+	}
+
+	if _, err := applyProfile(Config{}, "strict"); err == nil || !strings.Contains(err.Error(), "has no profiles") {
+		t.Errorf("applyProfile() without profiles error = %v", err)
+	}
+}
+
+// TestProfilePrecedence checks the layers of config: the user config, the
+// selected profile over it, the chart config over both, and flags over all
+func TestProfilePrecedence(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	originalConf := conf
+	defer func() { conf = originalConf }()
+
+	var user Config
+	if err := yaml.Unmarshal([]byte("minItems: 5\nprofiles:\n  strict:\n    minItems: 3\n    kubeVersion: \"1.25\"\n"), &user); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	if conf, err = applyProfile(user, "strict"); err != nil {
+		t.Fatal(err)
+	}
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	if err := os.WriteFile(filepath.Join(chartPath, chartConfigFile), []byte("minItems: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	restore, err := useChartConfig(chartPath)
+	defer restore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.MinItems != 1 {
+		t.Errorf("the chart config should override the profile, got minItems %d", conf.MinItems)
+	}
+	if conf.KubeVersion != "1.25" {
+		t.Errorf("profile settings the chart config leaves unset should stay, got kubeVersion %q", conf.KubeVersion)
+	}
+
+	// --kube-version wins over every config
+	restoreKube, err := useKubeVersion("1.29")
+	defer restoreKube()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := k8s.TargetKubeVersion().String(); v != "1.29" {
+		t.Errorf("--kube-version should override the config, got %q", v)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	pkgfs "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/template"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultReferenceFiles are checked for references to converted paths along
+// with the referenceFiles config: the values files chart-testing installs
+// the chart with
+var defaultReferenceFiles = []string{"ci/*.yaml", "ci/*.yml"}
+
+// externalReference is a use of a converted path that convert doesn't
+// rewrite, left for the chart's authors to update by hand
+type externalReference struct {
+	File   string // relative to the chart root, with forward slashes
+	Line   int
+	Path   string // the converted values path
+	Detail string // how the file uses it, e.g. "declared as an array"
+}
+
+// validateReferenceFiles checks the referenceFiles globs
+func validateReferenceFiles() error {
+	for _, pattern := range conf.ReferenceFiles {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("referenceFiles: %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// warnExternalReferences warns about the uses of paths, about to be
+// converted, in files convert doesn't rewrite: the values schema, NOTES.txt,
+// hook templates in forms the rewrite leaves as they are, and the files
+// matching referenceFiles
+func warnExternalReferences(root string, paths []template.PathInfo) {
+	refs := externalReferences(root, paths)
+	if len(refs) == 0 {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "Warning: these files use converted paths and aren't rewritten; update them by hand:")
+	for _, r := range refs {
+		fmt.Fprintf(os.Stderr, "  %s:%d: %s (%s)\n", r.File, r.Line, r.Path, r.Detail)
+		summary.warn(fmt.Sprintf("%s:%d: %s (%s); update it by hand", r.File, r.Line, r.Path, r.Detail))
+	}
+}
+
+// externalReferences returns the uses of paths in files convert doesn't
+// rewrite, sorted by file and line
+func externalReferences(root string, paths []template.PathInfo) []externalReference {
+	if len(paths) == 0 {
+		return nil
+	}
+	var refs []externalReference
+	refs = append(refs, schemaReferences(root, paths)...)
+	refs = append(refs, templateReferences(root, paths)...)
+	refs = append(refs, fileReferences(root, paths)...)
+	sort.SliceStable(refs, func(i, j int) bool {
+		if refs[i].File != refs[j].File {
+			return refs[i].File < refs[j].File
+		}
+		return refs[i].Line < refs[j].Line
+	})
+	return refs
+}
+
+// valuesReference returns the pattern of a .Values field reference to path
+func valuesReference(path string) *regexp.Regexp {
+	return regexp.MustCompile(`\.Values\.` + regexp.QuoteMeta(path) + `(?:[^a-zA-Z0-9_.]|$)`)
+}
+
+// schemaReferences returns the paths the chart's values.schema.json declares
+// as arrays, which Helm rejects as maps once they're converted
+func schemaReferences(root string, paths []template.PathInfo) []externalReference {
+	data, err := os.ReadFile(filepath.Join(root, "values.schema.json"))
+	if err != nil {
+		return nil
+	}
+	var schema map[string]any
+	if json.Unmarshal(data, &schema) != nil {
+		return nil
+	}
+	var refs []externalReference
+	for _, p := range paths {
+		parts := strings.Split(p.DotPath, ".")
+		node := schema
+		for _, part := range parts {
+			props, _ := node["properties"].(map[string]any)
+			node, _ = props[part].(map[string]any)
+			if node == nil {
+				break
+			}
+		}
+		if node == nil || !schemaArray(node) {
+			continue
+		}
+		refs = append(refs, externalReference{File: "values.schema.json", Line: jsonKeyLine(string(data), parts), Path: p.DotPath, Detail: "declared as an array"})
+	}
+	return refs
+}
+
+// schemaArray reports whether a JSON schema allows only arrays
+func schemaArray(node map[string]any) bool {
+	switch t := node["type"].(type) {
+	case string:
+		return t == "array"
+	case []any:
+		for _, v := range t {
+			if v != "array" && v != "null" {
+				return false
+			}
+		}
+		return len(t) > 0
+	}
+	_, items := node["items"]
+	return items
+}
+
+// jsonKeyLine returns the line of the last of keys in data, finding each
+// after the one before it, or 1 if they aren't all found
+func jsonKeyLine(data string, keys []string) int {
+	pos := 0
+	for _, k := range keys {
+		i := strings.Index(data[pos:], fmt.Sprintf("%q", k))
+		if i < 0 {
+			return 1
+		}
+		pos += i + 1
+	}
+	return strings.Count(data[:pos], "\n") + 1
+}
+
+// templateReferences returns the uses of paths in NOTES.txt, which is never
+// rewritten, and in hook templates, on lines the rewrite leaves as they are
+func templateReferences(root string, paths []template.PathInfo) []externalReference {
+	// Only which lines the rewrite leaves alone matters, not the helper
+	// name or style it writes
+	updated := make(map[string]string)
+	if rewrites, err := template.PreviewTemplateRewrites(pkgfs.OSFileSystem{}, root, paths, template.Options{}); err == nil {
+		for _, r := range rewrites {
+			updated[r.Path] = r.Updated
+		}
+	}
+	var refs []externalReference
+	_ = pkgfs.WalkTemplates(pkgfs.OSFileSystem{}, root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		notes := pkgfs.IsNotes(path)
+		if !notes && !pkgfs.IsTemplate(path) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || (!notes && !strings.Contains(string(data), "helm.sh/hook")) {
+			return nil
+		}
+		name := rel(root, path)
+		after, rewritten := updated[name]
+		for i, line := range strings.Split(string(data), "\n") {
+			for _, p := range paths {
+				if !valuesReference(p.DotPath).MatchString(line) {
+					continue
+				}
+				switch {
+				case notes:
+					refs = append(refs, externalReference{File: name, Line: i + 1, Path: p.DotPath, Detail: "NOTES.txt is never rewritten"})
+				case !rewritten || strings.Contains(after, line):
+					refs = append(refs, externalReference{File: name, Line: i + 1, Path: p.DotPath, Detail: "hook template, not rewritten"})
+				}
+			}
+		}
+		return nil
+	})
+	return refs
+}
+
+// fileReferences returns the uses of paths in the files matching
+// defaultReferenceFiles and referenceFiles: lists set at the paths in YAML
+// files, and .Values references and --set list indexes (env[0].name) in any
+func fileReferences(root string, paths []template.PathInfo) []externalReference {
+	var files []string
+	seen := make(map[string]bool)
+	for _, pattern := range append(append([]string{}, defaultReferenceFiles...), conf.ReferenceFiles...) {
+		matches, _ := filepath.Glob(filepath.Join(root, filepath.FromSlash(pattern)))
+		for _, m := range matches {
+			name := rel(root, m)
+			if info, err := os.Stat(m); err != nil || info.IsDir() || seen[name] || name == "values.yaml" || pkgfs.InTemplateDir(filepath.FromSlash(name)) {
+				continue
+			}
+			seen[name] = true
+			files = append(files, m)
+		}
+	}
+
+	var refs []externalReference
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		name := rel(root, f)
+		found := make(map[int]bool)
+		add := func(line int, path, detail string) {
+			if !found[line] {
+				found[line] = true
+				refs = append(refs, externalReference{File: name, Line: line, Path: path, Detail: detail})
+			}
+		}
+		if ext := strings.ToLower(filepath.Ext(f)); ext == ".yaml" || ext == ".yml" {
+			var doc yaml.Node
+			if yaml.Unmarshal(data, &doc) == nil && len(doc.Content) > 0 {
+				for _, p := range paths {
+					if key := valuesKeyAt(doc.Content[0], strings.Split(p.DotPath, ".")); key != nil {
+						add(key.Line, p.DotPath, "set as a list")
+					}
+				}
+			}
+		}
+		for i, line := range strings.Split(string(data), "\n") {
+			for _, p := range paths {
+				setIndex := regexp.MustCompile(`(?:^|[^a-zA-Z0-9_.])` + regexp.QuoteMeta(p.DotPath) + `\[\d+\]`)
+				if valuesReference(p.DotPath).MatchString(line) || setIndex.MatchString(line) {
+					add(i+1, p.DotPath, "used as a list")
+				}
+			}
+		}
+	}
+	return refs
+}
+
+// valuesKeyAt returns the key node of the list at path under a values
+// mapping, or nil if there's no list there
+func valuesKeyAt(n *yaml.Node, path []string) *yaml.Node {
+	parent := nodeAt(n, path[:len(path)-1]...)
+	if parent == nil || parent.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(parent.Content); i += 2 {
+		if parent.Content[i].Value == path[len(path)-1] && parent.Content[i+1].Kind == yaml.SequenceNode {
+			return parent.Content[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/template"
+)
+
+func TestExternalReferences(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	originalConf := conf
+	defer func() { conf = originalConf }()
+	conf = Config{ReferenceFiles: []string{"scripts/*.sh", "../.github/workflows/*.yaml"}}
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	files := map[string]string{
+		"values.schema.json": `{
+  "properties": {
+    "image": {"type": "object"},
+    "env": {"type": ["array", "null"]},
+    "volumes": {"type": "object"}
+  }
+}
+`,
+		"templates/NOTES.txt": "Env vars: {{ len .Values.env }}\n",
+		// The range is rewritten along with the template, the label isn't
+		"templates/hook.yaml": `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  labels:
+    env-count: "{{ len .Values.env }}"
+  annotations:
+    "helm.sh/hook": pre-install
+spec:
+  template:
+    spec:
+      containers:
+      - name: migrate
+        env:
+        {{- range .Values.env }}
+        - name: {{ .name }}
+        {{- end }}
+`,
+		"ci/default-values.yaml": "image:\n  tag: test\nenv:\n- name: CI\n  value: \"true\"\n",
+		"scripts/install.sh":     "helm install app . --set env[0].name=A --set image.tag=x\n",
+		"scripts/other.txt":      "--set env[0].name=A\n",
+	}
+	writeChartFiles(t, chartPath, files)
+
+	if err := validateReferenceFiles(); err != nil {
+		t.Fatalf("validateReferenceFiles() error = %v", err)
+	}
+	paths := []template.PathInfo{{DotPath: "env", MergeKey: "name"}, {DotPath: "volumes", MergeKey: "name"}}
+	var got []string
+	for _, r := range externalReferences(chartPath, paths) {
+		got = append(got, fmt.Sprintf("%s:%d: %s (%s)", r.File, r.Line, r.Path, r.Detail))
+	}
+	want := []string{
+		"ci/default-values.yaml:3: env (set as a list)",
+		"scripts/install.sh:1: env (used as a list)",
+		"templates/NOTES.txt:1: env (NOTES.txt is never rewritten)",
+		"templates/hook.yaml:6: env (hook template, not rewritten)",
+		"values.schema.json:4: env (declared as an array)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("externalReferences() =\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	conf.ReferenceFiles = []string{"ci/[*.yaml"}
+	if err := validateReferenceFiles(); err == nil || !strings.Contains(err.Error(), "referenceFiles") {
+		t.Errorf("validateReferenceFiles() error = %v, want a referenceFiles pattern error", err)
+	}
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	pkgfs "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/template"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/transform"
+	"gopkg.in/yaml.v3"
+)
+
+// embeddedValues is a chart values block embedded in a deployment manifest
+type embeddedValues struct {
+	Kind   string     // Manifest kind (e.g., "HelmRelease", "Application")
+	Name   string     // metadata.name of the manifest
+	Node   *yaml.Node // Mapping node holding the values, or a string node if Inline
+	Inline bool       // Node is a string holding a values document (Argo CD helm.values)
+}
+
+// manifestChange reports what was converted in one embedded values block
+type manifestChange struct {
+	Kind    string
+	Name    string
+	Paths   []k8s.DetectedCandidate // Converted list paths
+	Warning string                  // Why the block could not be converted, if it couldn't
+}
+
+func runConvertRelease(opts ConvertReleaseOptions) error {
+	if opts.File == "" || opts.Chart == "" {
+		return fmt.Errorf("--file and --chart are required")
+	}
+
+	root, cleanup, err := resolveChartRef(opts.Chart, opts.Version)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	candidates, err := chartConversionCandidates(root)
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		fmt.Printf("No convertible or converted list paths found in chart %s.\n", opts.Chart)
+		return nil
+	}
+
+	raw, err := os.ReadFile(opts.File)
+	if err != nil {
+		return err
+	}
+	out, changes, err := convertManifest(raw, chartName(root), candidates)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opts.File, err)
+	}
+	if len(changes) == 0 {
+		fmt.Printf("No HelmRelease or Argo CD values found in %s.\n", opts.File)
+		return nil
+	}
+	printManifestChanges(changes)
+	if bytes.Equal(out, raw) {
+		fmt.Printf("No changes needed in %s.\n", opts.File)
+		return nil
+	}
+
+	return writeConverted(opts.File, raw, out, opts.DryRun, opts.BackupExt)
+}
+
+// writeConverted backs up and rewrites path with out, keeping the format of
+// raw, or prints the diff in dry-run mode
+func writeConverted(path string, raw, out []byte, dryRun bool, backupExt string) error {
+	out = pkgfs.MatchFormat(raw, out)
+	if dryRun {
+		printFileDiff(path, string(raw), string(out))
+		return nil
+	}
+
+	if err := backupFile(path, backupExt, raw); err != nil {
+		return err
+	}
+	if err := rewriteFile(path, out); err != nil {
+		return err
+	}
+	fmt.Printf("\nUpdated %s\n", path)
+	fmt.Printf("  Backup: %s\n", path+backupExt)
+	return nil
+}
+
+// printManifestChanges reports the converted paths and warnings per values block
+func printManifestChanges(changes []manifestChange) {
+	for _, c := range changes {
+		switch {
+		case c.Warning != "":
+			fmt.Println(yellow(fmt.Sprintf("Skipped %s/%s values: %s", c.Kind, c.Name, c.Warning)))
+		case len(c.Paths) > 0:
+			fmt.Println(green(fmt.Sprintf("Converted %s/%s values:", c.Kind, c.Name)))
+			for _, p := range c.Paths {
+				fmt.Printf("  %s (key=%s)\n", p.ValuesPath, p.MergeKey)
+			}
+		}
+	}
+}
+
+// convertManifest converts the list values the chart converts in every values
+// block embedded in raw, leaving the rest of the manifest untouched. Blocks that
+// deploy a different chart are left alone.
+func convertManifest(raw []byte, chart string, candidates map[string]k8s.DetectedCandidate) ([]byte, []manifestChange, error) {
+	blocks, err := findManifestValues(raw, chart)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Inline values strings are rewritten first; mapping edits are found on the
+	// result so their line numbers stay valid
+	changes := make([]manifestChange, 0, len(blocks))
+	lines := strings.Split(string(raw), "\n")
+	for i := len(blocks) - 1; i >= 0; i-- {
+		b := blocks[i]
+		if !b.Inline {
+			continue
+		}
+		change := manifestChange{Kind: b.Kind, Name: b.Name}
+		lines, change.Paths, change.Warning = convertInlineValues(lines, b, candidates)
+		changes = append(changes, change)
+	}
+	out := []byte(strings.Join(lines, "\n"))
+
+	blocks, err = findManifestValues(out, chart)
+	if err != nil {
+		return nil, nil, err
+	}
+	var edits []transform.ArrayEdit
+	for _, b := range blocks {
+		if b.Inline {
+			continue
+		}
+		var blockEdits []transform.ArrayEdit
+		transform.FindArrayEdits(b.Node, nil, candidates, &blockEdits)
+		change := manifestChange{Kind: b.Kind, Name: b.Name}
+		for _, e := range blockEdits {
+			change.Paths = append(change.Paths, e.Candidate)
+		}
+		changes = append(changes, change)
+		edits = append(edits, blockEdits...)
+	}
+	return transform.ApplyLineEdits(out, edits), changes, nil
+}
+
+// convertInlineValues converts the values document held in the literal block
+// scalar b and splices it back into lines
+func convertInlineValues(lines []string, b embeddedValues, candidates map[string]k8s.DetectedCandidate) ([]string, []k8s.DetectedCandidate, string) {
+	if b.Node.Style&yaml.LiteralStyle == 0 {
+		return lines, nil, "values is not a literal block (values: |); convert it by hand"
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(b.Node.Value), &doc); err != nil {
+		return lines, nil, fmt.Sprintf("values is not valid YAML: %v", err)
+	}
+	var edits []transform.ArrayEdit
+	transform.FindArrayEdits(&doc, nil, candidates, &edits)
+	if len(edits) == 0 {
+		return lines, nil, ""
+	}
+	var paths []k8s.DetectedCandidate
+	for _, e := range edits {
+		paths = append(paths, e.Candidate)
+	}
+	converted := strings.TrimSuffix(string(transform.ApplyLineEdits([]byte(b.Node.Value), edits)), "\n")
+
+	// The block content starts on the line after the "|" indicator and runs
+	// while lines are blank or indented at least as far as its first line
+	start := b.Node.Line
+	indent := ""
+	end := start
+	for i := start; i < len(lines); i++ {
+		trimmed := strings.TrimLeft(lines[i], " ")
+		if trimmed == "" {
+			continue
+		}
+		lineIndent := lines[i][:len(lines[i])-len(trimmed)]
+		if indent == "" {
+			indent = lineIndent
+		}
+		if len(lineIndent) < len(indent) {
+			break
+		}
+		end = i + 1
+	}
+
+	block := indentLines(converted, indent)
+	result := make([]string, 0, len(lines)-(end-start)+len(block))
+	result = append(result, lines[:start]...)
+	result = append(result, block...)
+	result = append(result, lines[end:]...)
+	return result, paths, ""
+}
+
+// indentLines splits text into lines and prefixes each non-blank line with indent
+func indentLines(text, indent string) []string {
+	var lines []string
+	for _, l := range strings.Split(text, "\n") {
+		if l == "" {
+			lines = append(lines, "")
+			continue
+		}
+		lines = append(lines, indent+l)
+	}
+	return lines
+}
+
+// chartConversionCandidates returns the list paths that are (or would be)
+// converted in the chart at root, keyed by values path. Paths the chart's
+// templates already render through the helper come first; paths convert would
+// still change are added with their detected resource info.
+func chartConversionCandidates(root string) (map[string]k8s.DetectedCandidate, error) {
+	// Apply the chart's own config over the user config
+	restore, err := useChartConfig(root)
+	defer restore()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make(map[string]k8s.DetectedCandidate)
+	for _, p := range template.ConvertedPaths(root) {
+		candidates[p.DotPath] = k8s.DetectedCandidate{
+			ValuesPath:  p.DotPath,
+			MergeKey:    p.MergeKey,
+			SectionName: p.SectionName,
+			Set:         p.Set,
+			MergeKeys:   p.MergeKeys,
+			KeyStrategy: p.KeyStrategy,
+			Rename:      p.Rename,
+			Scalar:      p.Scalar,
+			Synthetic:   p.Synthetic,
+		}
+	}
+
+	restoreSchema, err := useSchemas("", false)
+	defer restoreSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	collected, err := collectConvertCandidates(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range collected.Matched {
+		candidates[c.ValuesPath] = c
+	}
+	return candidates, nil
+}
+
+// findManifestValues returns every values block for chart embedded in the
+// YAML documents of raw. Node line numbers are relative to raw as a whole.
+func findManifestValues(raw []byte, chart string) ([]embeddedValues, error) {
+	var blocks []embeddedValues
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		blocks = append(blocks, manifestValues(doc.Content[0], chart)...)
+	}
+	return blocks, nil
+}
+
+// manifestValues returns the values blocks of a single manifest
+func manifestValues(m *yaml.Node, chart string) []embeddedValues {
+	kind := scalarAt(m, "kind")
+	name := scalarAt(m, "metadata", "name")
+	apiVersion := scalarAt(m, "apiVersion")
+
+	switch {
+	case kind == "HelmRelease" && strings.HasPrefix(apiVersion, "helm.toolkit.fluxcd.io/"):
+		if !sameChart(scalarAt(m, "spec", "chart", "spec", "chart"), chart) {
+			return nil
+		}
+		if v := nodeAt(m, "spec", "values"); v != nil && v.Kind == yaml.MappingNode {
+			return []embeddedValues{{Kind: kind, Name: name, Node: v}}
+		}
+	case kind == "Application" && strings.HasPrefix(apiVersion, "argoproj.io/"):
+		return argoSourceValues(kind, name, nodeAt(m, "spec"), chart)
+	case kind == "ApplicationSet" && strings.HasPrefix(apiVersion, "argoproj.io/"):
+		return argoSourceValues(kind, name, nodeAt(m, "spec", "template", "spec"), chart)
+	}
+	return nil
+}
+
+// argoSourceValues returns the helm values blocks of an Argo CD application
+// spec, from spec.source and each entry of spec.sources
+func argoSourceValues(kind, name string, spec *yaml.Node, chart string) []embeddedValues {
+	sources := []*yaml.Node{nodeAt(spec, "source")}
+	if list := nodeAt(spec, "sources"); list != nil && list.Kind == yaml.SequenceNode {
+		sources = append(sources, list.Content...)
+	}
+
+	var blocks []embeddedValues
+	for _, src := range sources {
+		if src == nil || !sameChart(scalarAt(src, "chart"), chart) {
+			continue
+		}
+		if v := nodeAt(src, "helm", "valuesObject"); v != nil && v.Kind == yaml.MappingNode {
+			blocks = append(blocks, embeddedValues{Kind: kind, Name: name, Node: v})
+		}
+		if v := nodeAt(src, "helm", "values"); v != nil && v.Kind == yaml.ScalarNode {
+			blocks = append(blocks, embeddedValues{Kind: kind, Name: name, Node: v, Inline: true})
+		}
+	}
+	return blocks
+}
+
+// sameChart reports whether a manifest's chart reference may point at chart.
+// Manifests that don't name a chart (e.g., Git path sources) always match.
+func sameChart(ref, chart string) bool {
+	return ref == "" || chart == "" || filepath.Base(ref) == chart
+}
+
+// chartName returns the name from the chart's Chart.yaml, or "" if unreadable
+func chartName(root string) string {
+	return readChartYAML(root).Name
+}
+
+// chartVersion returns the version from the chart's Chart.yaml, or "" if unreadable
+func chartVersion(root string) string {
+	return readChartYAML(root).Version
+}
+
+// readChartYAML reads the chart's Chart.yaml, returning a zero value if unreadable
+func readChartYAML(root string) ChartYAML {
+	var chart ChartYAML
+	data, err := os.ReadFile(filepath.Join(root, "Chart.yaml"))
+	if err != nil {
+		return chart
+	}
+	if err := yaml.Unmarshal(data, &chart); err != nil {
+		return ChartYAML{}
+	}
+	return chart
+}
+
+// nodeAt returns the node at the given mapping keys below n, or nil
+func nodeAt(n *yaml.Node, keys ...string) *yaml.Node {
+	for _, k := range keys {
+		if n == nil || n.Kind != yaml.MappingNode {
+			return nil
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == k {
+				next = n.Content[i+1]
+				break
+			}
+		}
+		n = next
+	}
+	return n
+}
+
+// scalarAt returns the scalar value at the given mapping keys below n, or ""
+func scalarAt(n *yaml.Node, keys ...string) string {
+	if v := nodeAt(n, keys...); v != nil && v.Kind == yaml.ScalarNode {
+		return v.Value
+	}
+	return ""
+}
+
+// resolveChartRef returns the chart root for a local path, or pulls a chart
+// reference (repo/chart, oci://, or URL) with helm into a temporary directory.
+// The returned cleanup function removes any pulled chart.
+func resolveChartRef(ref, version string) (string, func(), error) {
+	noop := func() {}
+	if _, err := os.Stat(ref); err == nil {
+		root, err := findChartRoot(ref)
+		return root, noop, err
+	}
+
+	tmp, err := os.MkdirTemp("", "list-to-map-chart-")
+	if err != nil {
+		return "", noop, err
+	}
+	cleanup := func() { _ = os.RemoveAll(tmp) }
+	root, err := pullChart(ref, version, tmp)
+	return root, cleanup, err
+}
+
+// pullChart pulls a chart reference with helm, untarred into dir, and returns
+// the chart root. Running helm pull uses the user's repositories and registry
+// logins.
+func pullChart(ref, version, dir string) (string, error) {
+	if err := requireNetwork("pulling chart " + ref); err != nil {
+		return "", err
+	}
+	args := []string{"pull", ref, "--untar", "--untardir", dir}
+	if version != "" {
+		args = append(args, "--version", version)
+	}
+	cmd, err := helmCommand(args...)
+	if err != nil {
+		return "", fmt.Errorf("pulling chart %s: %w", ref, err)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("pulling chart %s: %v: %s", ref, err, strings.TrimSpace(string(out)))
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var dirs []string
+	for _, e := range entries {
+		if e.IsDir() {
+			dirs = append(dirs, e.Name())
+		}
+	}
+	sort.Strings(dirs)
+	if len(dirs) == 0 {
+		return "", fmt.Errorf("pulling chart %s: no chart directory found", ref)
+	}
+	return filepath.Join(dir, dirs[0]), nil
+}
+
+// helmBin returns the helm binary to run, as set by helm for plugins
+func helmBin() string {
+	if bin := os.Getenv("HELM_BIN"); bin != "" {
+		return bin
+	}
+	return "helm"
+}
+
+// helmCommand returns a command running the helm binary with args, or an
+// error naming the binary if it can't be found. Helm is run rather than used
+// through its Go SDK so the user's own helm version, plugins, registry logins,
+// and kube contexts apply, as they would running helm by hand.
+func helmCommand(args ...string) (*exec.Cmd, error) {
+	bin, err := exec.LookPath(helmBin())
+	if err != nil {
+		return nil, fmt.Errorf("helm binary %q not found: install helm or set HELM_BIN: %w", helmBin(), err)
+	}
+	return exec.Command(bin, args...), nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+func TestConvertRelease(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	if _, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	}); err != nil {
+		t.Fatalf("runConvert failed: %v", err)
+	}
+
+	src, err := os.ReadFile("testdata/releases/helmrelease.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "helmrelease.yaml")
+	if err := os.WriteFile(file, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runConvertRelease(ConvertReleaseOptions{File: file, Chart: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvertRelease failed: %v\nOutput: %s", err, output)
+	}
+
+	got, _ := os.ReadFile(file)
+	want := strings.NewReplacer(
+		"    env:\n      - name: LOG_LEVEL\n        value: debug\n",
+		"    # (key: name)\n    env:\n      LOG_LEVEL:\n        value: debug\n",
+		"    volumeMounts:\n      - name: cache\n        mountPath: /cache\n",
+		"    # (key: mountPath)\n    volumeMounts:\n      /cache:\n        name: cache\n",
+	).Replace(string(src))
+	if string(got) != want {
+		t.Errorf("converted manifest =\n%s\nwant\n%s", got, want)
+	}
+	if _, err := os.Stat(file + ".bak"); err != nil {
+		t.Errorf("expected backup file: %v", err)
+	}
+}
+
+func TestFindManifestValuesIgnoresOtherKinds(t *testing.T) {
+	raw := []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: not-a-release
+spec:
+  values:
+    env: []
+`)
+	blocks, err := findManifestValues(raw, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 0 {
+		t.Errorf("findManifestValues() = %d blocks, want 0", len(blocks))
+	}
+}
+
+func TestConvertReleaseArgoCD(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	src, err := os.ReadFile("testdata/releases/application.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "application.yaml")
+	if err := os.WriteFile(file, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The chart has not been converted yet; its detected candidates drive the conversion
+	output, err := captureOutput(t, func() error {
+		return runConvertRelease(ConvertReleaseOptions{File: file, Chart: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvertRelease failed: %v\nOutput: %s", err, output)
+	}
+
+	got, _ := os.ReadFile(file)
+	want := strings.NewReplacer(
+		"          env:\n            - name: LOG_LEVEL\n              value: debug\n",
+		"          # Deployment.spec.template.spec.containers.env (key: name)\n          env:\n            LOG_LEVEL:\n              value: debug\n",
+		"            volumes:\n              - name: data\n                emptyDir: {}\n",
+		"            # Deployment.spec.template.spec.volumes (key: name)\n            volumes:\n              data:\n                emptyDir: {}\n",
+	).Replace(string(src))
+	if string(got) != want {
+		t.Errorf("converted manifest =\n%s\nwant\n%s", got, want)
+	}
+	if !strings.Contains(output, "Converted ApplicationSet/basic-set values:") {
+		t.Errorf("output should report the ApplicationSet conversion\nGot:\n%s", output)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/transform"
+	"gopkg.in/yaml.v3"
+)
+
+func runConvertReleaseValues(opts ConvertReleaseValuesOptions) error {
+	if opts.Release == "" || opts.Chart == "" {
+		return fmt.Errorf("--release and --chart are required")
+	}
+	output := opts.Output
+	if output == "" {
+		output = opts.Release + "-values.yaml"
+	}
+	// Keep stdout clean for the values when writing them there
+	report := os.Stdout
+	if output == "-" {
+		report = os.Stderr
+	}
+
+	root, cleanup, err := resolveChartRef(opts.Chart, opts.Version)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	candidates, err := chartConversionCandidates(root)
+	if err != nil {
+		return err
+	}
+
+	raw, err := fetchReleaseValues(opts)
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return fmt.Errorf("parsing values of release %s: %w", opts.Release, err)
+	}
+	candidates, merged := withoutMergedLists(&doc, candidates)
+	printMergedLists(report, merged, "")
+
+	var edits []transform.ArrayEdit
+	transform.FindArrayEdits(&doc, nil, candidates, &edits)
+	out := transform.ApplyLineEdits(raw, edits)
+
+	if len(edits) == 0 {
+		fmt.Fprintf(report, "No values of release %s need converting.\n", opts.Release)
+	} else {
+		fmt.Fprintln(report, green(fmt.Sprintf("Converted values of release %s:", opts.Release)))
+		for _, e := range edits {
+			fmt.Fprintf(report, "  %s (key=%s)\n", e.Candidate.ValuesPath, e.Candidate.MergeKey)
+		}
+	}
+
+	if output == "-" {
+		_, err := os.Stdout.Write(out)
+		return err
+	}
+	// User-supplied values often hold credentials
+	if err := os.WriteFile(output, out, 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(report, "\nWrote %s\n", output)
+	fmt.Fprintf(report, "  Upgrade with: helm upgrade %s %s -f %s\n", opts.Release, opts.Chart, output)
+	return nil
+}
+
+// fetchReleaseValues returns the user-supplied values of an installed release
+// as a YAML document, using helm get values
+func fetchReleaseValues(opts ConvertReleaseValuesOptions) ([]byte, error) {
+	if err := requireNetwork("reading the values of release " + opts.Release); err != nil {
+		return nil, err
+	}
+	args := []string{"get", "values", opts.Release, "--output", "yaml"}
+	if opts.Namespace != "" {
+		args = append(args, "--namespace", opts.Namespace)
+	}
+	if opts.KubeContext != "" {
+		args = append(args, "--kube-context", opts.KubeContext)
+	}
+	if opts.Revision > 0 {
+		args = append(args, "--revision", strconv.Itoa(opts.Revision))
+	}
+
+	cmd, err := helmCommand(args...)
+	if err != nil {
+		return nil, fmt.Errorf("getting values of release %s: %w", opts.Release, err)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("getting values of release %s: %v: %s", opts.Release, err, strings.TrimSpace(stderr.String()))
+	}
+	// Releases installed without values print null
+	if strings.TrimSpace(string(out)) == "null" {
+		return []byte("{}\n"), nil
+	}
+	return out, nil
+}
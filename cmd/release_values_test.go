@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+// fakeHelm installs a helm script that records its arguments and prints output
+func fakeHelm(t *testing.T, output string) string {
+	t.Helper()
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	script := "#!/bin/sh\necho \"$@\" > " + argsFile + "\ncat <<'EOF'\n" + output + "EOF\n"
+	bin := filepath.Join(dir, "helm")
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HELM_BIN", bin)
+	return argsFile
+}
+
+func TestConvertReleaseValues(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	argsFile := fakeHelm(t, "env:\n  - name: LOG_LEVEL\n    value: debug\nreplicas: 3\n")
+	out := filepath.Join(t.TempDir(), "values.yaml")
+
+	output, err := captureOutput(t, func() error {
+		return runConvertReleaseValues(ConvertReleaseValuesOptions{
+			Release: "my-app", Namespace: "prod", Revision: 4, Chart: chartPath, Output: out,
+		})
+	})
+	if err != nil {
+		t.Fatalf("runConvertReleaseValues failed: %v\nOutput: %s", err, output)
+	}
+
+	args, _ := os.ReadFile(argsFile)
+	if want := "get values my-app --output yaml --namespace prod --revision 4"; strings.TrimSpace(string(args)) != want {
+		t.Errorf("helm args = %q, want %q", strings.TrimSpace(string(args)), want)
+	}
+
+	got, _ := os.ReadFile(out)
+	want := "# Deployment.spec.template.spec.containers.env (key: name)\nenv:\n  LOG_LEVEL:\n    value: debug\nreplicas: 3\n"
+	if string(got) != want {
+		t.Errorf("converted values =\n%s\nwant\n%s", got, want)
+	}
+	if info, err := os.Stat(out); err != nil {
+		t.Errorf("stat converted values: %v", err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("converted values mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+// TestConvertReleaseValuesWithoutHelm tests the error when the helm binary
+// can't be found
+func TestConvertReleaseValuesWithoutHelm(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	t.Setenv("HELM_BIN", filepath.Join(t.TempDir(), "helm"))
+
+	_, err := captureOutput(t, func() error {
+		return runConvertReleaseValues(ConvertReleaseValuesOptions{Release: "my-app", Chart: chartPath, Output: "-"})
+	})
+	if err == nil || !strings.Contains(err.Error(), "not found: install helm or set HELM_BIN") {
+		t.Errorf("runConvertReleaseValues() error = %v, want helm not found", err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/transform"
+	"gopkg.in/yaml.v3"
+)
+
+// reFieldPath matches a values path templates can read as .Values fields
+var reFieldPath = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// validateRenamePaths checks the renamePaths config. New paths must be
+// readable as .Values fields, and no two lists may move to the same path,
+// into one another, or to a path that is itself renamed.
+func validateRenamePaths() error {
+	olds := make([]string, 0, len(conf.RenamePaths))
+	for old := range conf.RenamePaths {
+		olds = append(olds, old)
+	}
+	sort.Strings(olds)
+	targets := make(map[string]string, len(olds))
+	for _, old := range olds {
+		to := conf.RenamePaths[old]
+		switch {
+		case old == "" || strings.Contains(old, ".."):
+			return fmt.Errorf("renamePaths: %q is not a values path", old)
+		case !reFieldPath.MatchString(to):
+			return fmt.Errorf("renamePaths: %s can't move to %q, which templates can't read as .Values fields", old, to)
+		case old == to:
+			return fmt.Errorf("renamePaths: %s is renamed to itself", old)
+		case strings.HasPrefix(to, old+".") || strings.HasPrefix(old, to+"."):
+			return fmt.Errorf("renamePaths: %s can't move to %s, which contains or is inside it", old, to)
+		}
+		if other, ok := targets[to]; ok {
+			return fmt.Errorf("renamePaths: %s and %s both move to %s", other, old, to)
+		}
+		if _, ok := conf.RenamePaths[to]; ok {
+			return fmt.Errorf("renamePaths: %s moves to %s, which is renamed too", old, to)
+		}
+		targets[to] = old
+	}
+	return nil
+}
+
+// withRenamedPaths sets the new path of each candidate renamePaths moves
+func withRenamedPaths(candidates []k8s.DetectedCandidate) []k8s.DetectedCandidate {
+	for i, c := range candidates {
+		candidates[i].NewPath = conf.RenamePaths[c.ValuesPath]
+	}
+	return candidates
+}
+
+// moveRenamedValues moves the renamed lists of the converted values to their
+// new paths. out is checked before any file is written, so a rename that
+// can't be made fails the conversion rather than leaving it half done.
+func moveRenamedValues(out []byte, converted []k8s.DetectedCandidate) ([]byte, bool, error) {
+	moved := false
+	for _, c := range converted {
+		if c.NewPath == "" {
+			continue
+		}
+		var err error
+		if out, err = transform.MoveValue(out, c.ValuesPath, c.NewPath); err != nil {
+			return nil, false, fmt.Errorf("renamePaths: moving %s to %s: %w", c.ValuesPath, c.NewPath, err)
+		}
+		moved = true
+	}
+	return out, moved, nil
+}
+
+// warnUnrenamed warns about the renamePaths entries whose lists are still in
+// values.yaml but aren't converted in this run, so they aren't moved either
+func warnUnrenamed(doc *yaml.Node, converted []k8s.DetectedCandidate) {
+	if len(conf.RenamePaths) == 0 || doc == nil || len(doc.Content) == 0 {
+		return
+	}
+	done := make(map[string]bool, len(converted))
+	for _, c := range converted {
+		done[c.ValuesPath] = true
+	}
+	var olds []string
+	for old := range conf.RenamePaths {
+		if !done[old] && nodeAt(doc.Content[0], strings.Split(old, ".")...) != nil {
+			olds = append(olds, old)
+		}
+	}
+	sort.Strings(olds)
+	for _, old := range olds {
+		warnf("renamePaths: %s isn't converted, so it isn't moved to %s", old, conf.RenamePaths[old])
+	}
+}
+
+// renamedSuffix returns " -> <new path>" for a renamed candidate, or ""
+func renamedSuffix(newPath string) string {
+	if newPath == "" {
+		return ""
+	}
+	return " -> " + newPath
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/template"
+	"gopkg.in/yaml.v3"
+)
+
+func runRevert(opts RevertOptions) error {
+	root, err := findChartRoot(opts.ChartDir)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := listBackupSnapshots(root, opts.BackupExt)
+	if err != nil {
+		return fmt.Errorf("listing backups: %w", err)
+	}
+	if len(snapshots) == 0 {
+		return fmt.Errorf("no backups with extension %q found under %s", opts.BackupExt, root)
+	}
+
+	if opts.List {
+		fmt.Println("Backup snapshots (oldest first):")
+		for _, s := range snapshots {
+			fmt.Printf("  %s (%d file(s))\n", s.ID, len(s.Files))
+			for _, f := range s.Files {
+				fmt.Printf("    %s\n", rel(root, f.Original))
+			}
+		}
+		return nil
+	}
+
+	snapshot := snapshots[len(snapshots)-1]
+	if opts.Snapshot != "" {
+		found := false
+		for _, s := range snapshots {
+			if s.ID == opts.Snapshot {
+				snapshot, found = s, true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("snapshot %q not found (use --list to see available snapshots)", opts.Snapshot)
+		}
+	}
+
+	files := snapshot.Files
+	if len(opts.Files) > 0 {
+		if files, err = selectBackupFiles(root, snapshot, opts.Files); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range files {
+		data, err := os.ReadFile(f.Backup)
+		if err != nil {
+			return fmt.Errorf("reading backup: %w", err)
+		}
+		if err := rewriteFile(f.Original, data); err != nil {
+			return fmt.Errorf("restoring %s: %w", rel(root, f.Original), err)
+		}
+	}
+
+	if len(files) < len(snapshot.Files) {
+		fmt.Printf("Restored %d of %d file(s) from snapshot %s:\n", len(files), len(snapshot.Files), snapshot.ID)
+	} else {
+		fmt.Printf("Restored snapshot %s:\n", snapshot.ID)
+	}
+	for _, f := range files {
+		fmt.Printf("  %s\n", rel(root, f.Original))
+	}
+	if len(files) < len(snapshot.Files) {
+		// The files left converted may no longer agree with those restored
+		if mismatches := valuesTemplateMismatches(root); len(mismatches) > 0 {
+			fmt.Println("\n" + yellow("Warning: values.yaml and templates now disagree:"))
+			for _, m := range mismatches {
+				fmt.Printf("  %s\n", m)
+			}
+			fmt.Printf("Restore the rest of the snapshot with 'helm list-to-map revert --chart %s --snapshot %s',\n", root, snapshot.ID)
+			fmt.Printf("or convert again with 'helm list-to-map convert --chart %s'.\n", root)
+		}
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(root, "templates", "_listmap.tpl")); err == nil {
+		fmt.Println("\nNote: templates/_listmap.tpl is not part of any backup. Remove it if no templates use it.")
+	}
+	return nil
+}
+
+// selectBackupFiles returns the backups in snapshot of the given files, each
+// relative to the chart root
+func selectBackupFiles(root string, snapshot backupSnapshot, names []string) ([]backupEntry, error) {
+	byName := make(map[string]backupEntry, len(snapshot.Files))
+	for _, f := range snapshot.Files {
+		byName[rel(root, f.Original)] = f
+	}
+	var files []backupEntry
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = filepath.ToSlash(filepath.Clean(name))
+		f, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("%s has no backup in snapshot %s (use --list to see its files)", name, snapshot.ID)
+		}
+		if !seen[name] {
+			seen[name] = true
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// valuesTemplateMismatches describes the paths whose values and templates
+// disagree: lists in values.yaml rendered through the list-map helper, and maps
+// rendered by list-style templates
+func valuesTemplateMismatches(root string) []string {
+	doc, _, err := loadValuesNode(filepath.Join(root, "values.yaml"))
+	if err != nil || len(doc.Content) == 0 {
+		return nil
+	}
+
+	var mismatches []string
+	for _, p := range template.ConvertedPaths(root) {
+		if v := nodeAt(doc.Content[0], strings.Split(p.DotPath, ".")...); v != nil && v.Kind == yaml.SequenceNode {
+			mismatches = append(mismatches, fmt.Sprintf("%s is a list in values.yaml, but templates render it as a map", p.DotPath))
+		}
+	}
+
+	// Apply the chart's own config, as convert would to find the list-style templates
+	restore, err := useChartConfig(root)
+	defer restore()
+	if err != nil {
+		return mismatches
+	}
+	restoreSchema, err := useSchemas("", false)
+	defer restoreSchema()
+	if err != nil {
+		return mismatches
+	}
+	collected, err := collectConvertCandidates(root)
+	if err != nil {
+		return mismatches
+	}
+	candidates := make(map[string]k8s.DetectedCandidate, len(collected.Matched))
+	for _, c := range append(collected.Matched, collected.Ask...) {
+		candidates[c.ValuesPath] = c
+	}
+	for _, c := range staleTemplatePaths(doc, candidates) {
+		mismatches = append(mismatches, fmt.Sprintf("%s is a map in values.yaml, but templates render it as a list", c.ValuesPath))
+	}
+	sort.Strings(mismatches)
+	return mismatches
+}
+
+// rel returns p relative to root with forward slashes, so reports read the
+// same on every platform, or p itself if it cannot be made relative
+func rel(root, p string) string {
+	if r, err := filepath.Rel(root, p); err == nil {
+		return filepath.ToSlash(r)
+	}
+	return p
+}
@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/crd"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/parser"
 	"github.com/scottrigby/helm-list-to-map-plugin/pkg/template"
 	"gopkg.in/yaml.v3"
 )
@@ -16,6 +19,26 @@ type Rule struct {
 	PathPattern   string   `yaml:"pathPattern"`
 	UniqueKeys    []string `yaml:"uniqueKeys"`
 	PromoteScalar string   `yaml:"promoteScalar,omitempty"`
+	// Note records why the rule exists
+	Note string `yaml:"note,omitempty"`
+	// Set converts the list to a set keyed by each item's value (regcred: true).
+	// Items are scalars, or objects holding only the unique key, if one is given.
+	Set bool `yaml:"set,omitempty"`
+	// KeyStrategy converts by every unique key, in order: "nested" nests a map
+	// level per key (namespaceA: {svcA: {...}}), "composite" joins the values
+	// with "/" (namespaceA/svcA: {...})
+	KeyStrategy string `yaml:"keyStrategy,omitempty"`
+	// Shape customizes the map entries the rule converts to
+	Shape *EntryShape `yaml:"shape,omitempty"`
+}
+
+// EntryShape is a custom shape for the map entries of a converted list. The
+// generated helper inverts it, so templates render the original items.
+type EntryShape struct {
+	// Rename renames item fields in map entries (value: v)
+	Rename map[string]string `yaml:"rename,omitempty"`
+	// Scalar shortens an entry holding only this field to its value (FOO: bar)
+	Scalar string `yaml:"scalar,omitempty"`
 }
 
 // Config holds user-defined conversion rules
@@ -23,23 +46,97 @@ type Config struct {
 	Rules              []Rule `yaml:"rules"`
 	LastWinsDuplicates bool   `yaml:"lastWinsDuplicates"`
 	SortKeys           bool   `yaml:"sortKeys"`
+	// IgnorePaths excludes values paths (and everything under them) from detection
+	// and conversion. Patterns use the same suffix glob syntax as rules.
+	IgnorePaths []string `yaml:"ignorePaths,omitempty"`
+	// IgnoreTypes excludes element types (e.g., "Toleration" or "corev1.Toleration")
+	IgnoreTypes []string `yaml:"ignoreTypes,omitempty"`
+	// TypePolicy decides conversion by element type (e.g., EnvVar: always,
+	// Toleration: never, ContainerPort: ask)
+	TypePolicy map[string]string `yaml:"typePolicy,omitempty"`
+	// HelperName overrides the define name of the generated helper template
+	HelperName string `yaml:"helperName,omitempty"`
+	// MinItems skips arrays with fewer entries in values.yaml than this
+	MinItems int `yaml:"minItems,omitempty"`
+	// EnvOrdering decides what convert does with env arrays whose $(VAR)
+	// references break in alphabetical order: skip, order-field, or dependency-sort
+	EnvOrdering string `yaml:"envOrdering,omitempty"`
+	// KubeVersion is the Kubernetes release charts target (e.g., "1.27"),
+	// used to resolve API versions and check fields; --kube-version overrides it
+	KubeVersion string `yaml:"kubeVersion,omitempty"`
+	// SchemaSource is where Kubernetes schemas are read from: types (the
+	// client-go structs and loaded CRDs) or cluster (saved by load-openapi
+	// --cluster); --schema overrides it
+	SchemaSource string `yaml:"schemaSource,omitempty"`
+	// ConfigDataKey enables detecting lists written into ConfigMap and
+	// Secret data (config files rendered with toYaml), keyed by this field;
+	// --config-data-key overrides it
+	ConfigDataKey string `yaml:"configDataKey,omitempty"`
+	// KindHints declares the resource type of templates whose kind is
+	// templated, keyed by chart-relative path (templates/deployment.yaml:
+	// apps/v1/Deployment). Hints are per chart and aren't merged.
+	KindHints map[string]string `yaml:"kindHints,omitempty"`
+	// CRDAuth sets the credentials load-crd sends to private CRD sources,
+	// by host
+	CRDAuth []crd.AuthRule `yaml:"crdAuth,omitempty"`
+	// TemplateDirs are the chart directories scanned and rewritten as
+	// templates, relative to the chart root (default: templates)
+	TemplateDirs []string `yaml:"templateDirs,omitempty"`
+	// TemplateExtensions are the extensions of template files in them
+	// (default: .yaml, .yml, .tpl). NOTES.txt is never rewritten.
+	TemplateExtensions []string `yaml:"templateExtensions,omitempty"`
+	// TemplateStyle overrides the layout of generated template code, which
+	// otherwise follows the chart's own templates
+	TemplateStyle TemplateStyleConfig `yaml:"templateStyle,omitempty"`
+	// CuratedRules enables built-in keys for lists Kubernetes merges
+	// atomically, by set: ingress, networkpolicy, rbac, or all
+	CuratedRules []string `yaml:"curatedRules,omitempty"`
+	// RenamePaths moves converted lists to new values paths as they're
+	// converted (extraEnvVars: env), so awkward names change along with the
+	// shape. Renames are per chart and aren't merged.
+	RenamePaths map[string]string `yaml:"renamePaths,omitempty"`
+	// ReferenceFiles are globs, relative to the chart root, of files convert
+	// doesn't rewrite that may use converted paths, such as CI scripts
+	// (../.github/workflows/*.yaml), checked before converting
+	ReferenceFiles []string `yaml:"referenceFiles,omitempty"`
+	// Profiles are named sets of settings in the user config, merged over
+	// the rest of it when selected with --profile (e.g., strict or lenient
+	// policies for different teams). Charts can't set profiles.
+	Profiles map[string]yaml.Node `yaml:"profiles,omitempty"`
+}
+
+// TemplateStyleConfig is the layout of the helper and template actions convert
+// generates. Unset settings are detected from the chart's templates.
+type TemplateStyleConfig struct {
+	// Indent indents the generated helper's actions per block: a number of
+	// spaces, or "tab" (0 keeps them flush left)
+	Indent string `yaml:"indent,omitempty"`
+	// Actions places the if and end actions around rewritten lists "aligned"
+	// with the YAML they wrap, or "flush" left
+	Actions string `yaml:"actions,omitempty"`
+	// Trim writes those actions with trim markers ({{- if), or without
+	Trim *bool `yaml:"trim,omitempty"`
 }
 
 // SubchartConversion tracks what was converted in a subchart
 type SubchartConversion struct {
 	Name           string              // Subchart name (used as prefix in umbrella values)
 	ConvertedPaths []template.PathInfo // Paths that were converted
+	ParseErrors    []*parser.FileError // Templates left out because they couldn't be read
 }
 
 // ChartDependency represents a dependency from Chart.yaml
 type ChartDependency struct {
 	Name       string `yaml:"name"`
+	Alias      string `yaml:"alias,omitempty"`
 	Repository string `yaml:"repository"`
 	Condition  string `yaml:"condition,omitempty"`
 }
 
 // ChartYAML represents the relevant parts of Chart.yaml
 type ChartYAML struct {
+	Name         string            `yaml:"name"`
+	Version      string            `yaml:"version,omitempty"`
 	Dependencies []ChartDependency `yaml:"dependencies"`
 	Annotations  map[string]string `yaml:"annotations,omitempty"`
 	Sources      []string          `yaml:"sources,omitempty"`
@@ -49,6 +146,13 @@ type ChartYAML struct {
 var conf Config
 
 func main() {
+	os.Args = append(os.Args[:1:1], useOffline(os.Args[1:])...)
+	profile, args, err := useProfile(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	os.Args = append(os.Args[:1:1], args...)
 	if len(os.Args) < 2 {
 		usage()
 		return
@@ -62,28 +166,74 @@ func main() {
 	}
 
 	// Load user-defined rules for CRDs and custom resources
-	configPath := os.Getenv("HELM_LIST_TO_MAP_CONFIG")
-	if configPath == "" {
-		configPath = defaultUserConfigPath()
+	if c, err := readUserConfig(userConfigPath()); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring user config: %v\n", err)
+	} else {
+		conf = c
 	}
-	if b, err := os.ReadFile(configPath); err == nil {
-		_ = yaml.Unmarshal(b, &conf)
+	// The selected profile goes over the user config, under chart configs and flags
+	if conf, err = applyProfile(conf, profile); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
 	}
 
-	var err error
 	switch subcmd {
 	case "detect":
 		err = runDetectCommand()
 	case "convert":
 		err = runConvertCommand()
+	case "convert-release":
+		err = runConvertReleaseCommand()
+	case "convert-release-values":
+		err = runConvertReleaseValuesCommand()
+	case "convert-helmfile":
+		err = runConvertHelmfileCommand()
+	case "convert-kustomize":
+		err = runConvertKustomizeCommand()
+	case "convert-terraform":
+		err = runConvertTerraformCommand()
+	case "convert-values":
+		err = runConvertValuesCommand()
 	case "add-rule":
 		err = runAddRuleCommand()
 	case "rules":
 		err = runListRulesCommand()
 	case "load-crd":
 		err = runLoadCRDCommand()
+	case "bundle-crds":
+		err = runBundleCRDsCommand()
+	case "load-openapi":
+		err = runLoadOpenAPICommand()
 	case "list-crds":
 		err = runListCRDsCommand()
+	case "crd":
+		err = runCRDCommand()
+	case "package":
+		err = runPackageCommand()
+	case "snapshot-test":
+		err = runSnapshotTestCommand()
+	case "verify":
+		err = runVerifyCommand()
+	case "stats":
+		err = runStatsCommand()
+	case "drift":
+		err = runDriftCommand()
+	case "decisions":
+		err = runDecisionsCommand()
+	case "analyze":
+		err = runAnalyzeCommand()
+	case "diff-values":
+		err = runDiffValuesCommand()
+	case "doctor":
+		err = runDoctorCommand()
+	case "revert":
+		err = runRevertCommand()
+	case "clean":
+		err = runCleanCommand()
+	case "upgrade-helpers", "upgrade-helper":
+		err = runUpgradeHelpersCommand()
+	case "version":
+		err = runVersionCommand()
 	default:
 		fmt.Fprintf(os.Stderr, "Error: unknown command %q for \"helm list-to-map\"\n", subcmd)
 		fmt.Fprintf(os.Stderr, "Run 'helm list-to-map --help' for usage.\n")
@@ -105,15 +255,41 @@ Usage:
   helm list-to-map [command] [flags]
 
 Available Commands:
-  detect      scan values.yaml and report convertible arrays
-  convert     transform values.yaml and update templates
-  load-crd    load CRD definitions for Custom Resource support
-  list-crds   list loaded CRD types and their convertible fields
-  add-rule    add a custom conversion rule to your config
-  rules       list all active rules (built-in + custom)
+  detect                  scan values.yaml and report convertible arrays
+  convert                 transform values.yaml and update templates
+  convert-release         convert values embedded in Flux and Argo CD manifests
+  convert-release-values  convert the deployed values of an installed release
+  convert-helmfile        convert helmfile release values for a converted chart
+  convert-kustomize       convert kustomize helmCharts values for a converted chart
+  convert-terraform       convert Terraform helm_release values for a converted chart
+  convert-values          convert a values document from stdin to stdout
+  load-crd                load CRD definitions for Custom Resource support
+  bundle-crds             download CRDs into an archive for load-crd --bundle
+  load-openapi            save a Kubernetes release's or cluster's OpenAPI spec
+  list-crds               list loaded CRD types and their convertible fields
+  crd                     compare the convertible fields of loaded CRD versions
+  add-rule                add a custom conversion rule to your config
+  rules                   list all active rules (built-in + custom)
+  revert                  restore files from a convert backup snapshot
+  clean                   remove the backups convert left in a chart
+  upgrade-helpers         refresh the generated helper templates of a chart and its subcharts
+  package                 convert a chart and package it with helm
+  snapshot-test           check that a converted chart renders its golden manifests
+  verify                  check that consumers' overrides render the same after conversion
+  stats                   report how far charts are through conversion
+  decisions               explain what convert decides for each path, as JSON for policy checks
+  analyze                 locate findings in chart files, as JSON for editor integrations
+  drift                   check that converted paths haven't gone back to lists
+  diff-values             check that a converted values file matches the original
+  doctor                  diagnose environment and configuration issues
+  version                 print the plugin and helper template versions
 
 Flags:
-  -h, --help   help for list-to-map
+  -h, --help             help for list-to-map
+      --offline          forbid network access, with any command (or set
+                         HELM_LIST_TO_MAP_OFFLINE=true)
+      --profile string   merge this profile of the user config over the rest of it,
+                         with any command (or set HELM_LIST_TO_MAP_PROFILE)
 
 IMPORTANT - Ordering Limitation:
   Map-based values are rendered in alphabetical order (sorted by key).
@@ -128,11 +304,33 @@ IMPORTANT - Ordering Limitation:
         value: "https://example.com"
 
   Ensure your env vars don't rely on definition order, or keep them as arrays.
+  'convert' reports references that would break; pass the values files you
+  deploy with (-f) so the check sees the merged values.
+  Or convert with --env-dependency-sort to render env vars in dependency order.
 
 Use "helm list-to-map [command] --help" for more information about a command.
 `)
 }
 
+// valuesFilesFlag collects repeated -f/--values flags, each of which may
+// hold a comma-separated list like helm's
+type valuesFilesFlag []string
+
+func (v *valuesFilesFlag) String() string { return strings.Join(*v, ",") }
+
+func (v *valuesFilesFlag) Set(s string) error {
+	*v = append(*v, strings.Split(s, ",")...)
+	return nil
+}
+
+// userConfigPath returns the user config path, honoring $HELM_LIST_TO_MAP_CONFIG
+func userConfigPath() string {
+	if p := os.Getenv("HELM_LIST_TO_MAP_CONFIG"); p != "" {
+		return p
+	}
+	return defaultUserConfigPath()
+}
+
 func defaultUserConfigPath() string {
 	home := os.Getenv("HELM_CONFIG_HOME")
 	if home == "" {
@@ -150,6 +348,14 @@ func crdConfigDir() string {
 	return filepath.Join(home, "list-to-map", "crds")
 }
 
+func openAPIConfigDir() string {
+	home := os.Getenv("HELM_CONFIG_HOME")
+	if home == "" {
+		home = filepath.Join(os.Getenv("HOME"), ".config", "helm")
+	}
+	return filepath.Join(home, "list-to-map", "openapi")
+}
+
 // Command wrapper functions that parse flags and create Options structs
 
 func runDetectCommand() error {
@@ -161,6 +367,14 @@ func runDetectCommand() error {
 	fs.BoolVar(&opts.Recursive, "recursive", false, "recursively detect in file:// subcharts")
 	fs.BoolVar(&opts.IncludeChartsDir, "include-charts-dir", false, "include subcharts in charts/ directory")
 	fs.BoolVar(&opts.ExpandRemote, "expand-remote", false, "expand and process .tgz files in charts/")
+	fs.BoolVar(&opts.NoColor, "no-color", false, "disable colored output")
+	fs.BoolVar(&opts.Check, "check", false, "exit non-zero if any arrays can be converted")
+	fs.BoolVar(&opts.Quiet, "quiet", false, "print only findings")
+	fs.BoolVar(&opts.Watch, "watch", false, "re-run detection when chart files change")
+	fs.StringVar(&opts.KubeVersion, "kube-version", "", "Kubernetes version the chart targets")
+	fs.StringVar(&opts.SchemaSource, "schema", "", "where to read Kubernetes schemas from: types or cluster")
+	fs.StringVar(&opts.ConfigDataKey, "config-data-key", "", "detect lists written into ConfigMap and Secret data, keyed by this field")
+	fs.StringVar(&opts.GroupBy, "group-by", groupByPath, "group detected arrays by path, template, or resource")
 	fs.Usage = func() {
 		fmt.Print(`
 Scan a Helm chart to detect arrays that can be converted to maps based on
@@ -170,17 +384,70 @@ without modifying any files.
 Built-in Kubernetes types (Deployment, Pod, Service, etc.) are detected automatically.
 For Custom Resources (CRs), first load their CRD definitions using 'helm list-to-map load-crd'.
 
+With --check, detect runs as a fast gate for pre-commit hooks and CI: it only
+reports paths that convert would change, never downloads CRDs, and exits 1 if
+there are any. Changed files may be passed as arguments to limit the check to
+the charts (and templates) they belong to.
+
+With --kube-version, types are resolved for that Kubernetes release: a templated
+apiVersion is taken to be the one the release prefers for the kind, and if an
+OpenAPI spec for the release was saved with 'helm list-to-map load-openapi',
+fields that don't exist in it are reported instead of converted. The chart
+config or user config may set kubeVersion instead.
+
+With --schema cluster, every kind is resolved through the OpenAPI v3 schemas
+saved from the target cluster with 'helm list-to-map load-openapi --cluster',
+built-in kinds and installed CRDs alike, in place of the plugin's built-in
+types and loaded CRDs. The chart config or user config may set schemaSource
+instead.
+
+Lists written into the data of a ConfigMap or Secret, such as a config file
+rendered with "servers:\n  {{- toYaml .Values.config.servers | nindent 4 }}",
+follow the application's format rather than a Kubernetes schema, so they
+aren't detected by default. With --config-data-key <field> (or configDataKey
+in the chart or user config), they are reported as convertible, keyed by that
+field, when their default in values.yaml is a list whose items all have it.
+
+Resources using deprecated API versions are always reported, along with the
+apiVersion to use instead; with --kube-version, only those deprecated by that
+release, marking the ones it no longer serves.
+
+With --watch, detect keeps running after the first report, checking the chart
+every second and printing the findings that appear or go away whenever
+values.yaml, Chart.yaml, the chart config, or a template changes. With
+--recursive or --include-charts-dir, the subcharts found at the start are
+watched too, and their findings are prefixed with the subchart name.
+--expand-remote can't be watched: remote subcharts are extracted once.
+
+Detected arrays are listed by values path. With --group-by template, they are
+listed under each template rendering them instead, named relative to the
+chart root, and with --group-by resource under the resource kind and its
+template (e.g., "StatefulSet (templates/statefulset.yaml)"), which is easier
+to review for charts with many workloads sharing value prefixes.
+
 Usage:
   helm list-to-map detect [flags]
+  helm list-to-map detect --check [--quiet] [files...]
 
 Flags:
       --chart string         path to chart root (default: current directory)
+      --check                exit non-zero if any arrays can be converted
       --config string        path to user config (default: $HELM_CONFIG_HOME/list-to-map/config.yaml)
+      --config-data-key string
+                             detect lists written into ConfigMap and Secret data, keyed by this
+                             field (default: configDataKey from config, or off)
       --expand-remote        expand and process .tgz files in charts/
+      --group-by string      group detected arrays by path (default), template, or resource
   -h, --help                 help for detect
       --include-charts-dir   include subcharts in charts/ directory
+      --kube-version string  Kubernetes version the chart targets (e.g., 1.27)
+      --no-color             disable colored output (also honors NO_COLOR)
+      --quiet                print only findings (with --check)
       --recursive            recursively detect in file:// subcharts (for umbrella charts)
-  -v                         verbose output (show template files, partials, and warnings)
+      --schema string        where to read Kubernetes schemas from: types (default) or cluster
+  -v                         verbose output (show template files, partials, warnings, and
+                             what each element type and its unique key mean)
+      --watch                re-run detection when chart files change (Ctrl+C to stop)
 
 Examples:
   # Detect convertible fields in a chart
@@ -201,9 +468,34 @@ Examples:
 
   # Process all dependency types (file://, charts/ dirs, .tgz files)
   helm list-to-map detect --chart ./umbrella-chart --recursive --include-charts-dir --expand-remote
+
+  # Fail a pre-commit hook when changed chart files introduce convertible lists
+  helm list-to-map detect --check --quiet charts/app/values.yaml charts/app/templates/deployment.yaml
+
+  # Detect against the schema of the cluster the chart targets
+  helm list-to-map load-openapi --kube-version 1.27
+  helm list-to-map detect --chart ./my-chart --kube-version 1.27
+
+  # Detect with the exact schemas the current cluster publishes
+  helm list-to-map load-openapi --cluster
+  helm list-to-map detect --chart ./my-chart --schema cluster
+
+  # Watch for new list-style patterns while editing templates
+  helm list-to-map detect --chart ./my-chart --watch
+
+  # Review detected arrays workload by workload
+  helm list-to-map detect --chart ./my-chart --group-by resource
 `)
 	}
 	_ = fs.Parse(os.Args[2:])
+	opts.Files = fs.Args()
+	initColor(opts.NoColor)
+	if opts.Watch {
+		return runDetectWatch(opts)
+	}
+	if opts.Check {
+		return runDetectCheck(opts)
+	}
 	return runDetect(opts)
 }
 
@@ -214,9 +506,32 @@ func runConvertCommand() error {
 	fs.StringVar(&opts.ConfigPath, "config", "", "path to user config")
 	fs.BoolVar(&opts.DryRun, "dry-run", false, "preview changes without writing files")
 	fs.StringVar(&opts.BackupExt, "backup-ext", ".bak", "backup file extension")
+	fs.IntVar(&opts.MaxBackups, "max-backups", 0, "keep at most this many backup snapshots (0 keeps all)")
 	fs.BoolVar(&opts.Recursive, "recursive", false, "recursively convert file:// subcharts")
 	fs.BoolVar(&opts.IncludeChartsDir, "include-charts-dir", false, "include subcharts in charts/ directory")
 	fs.BoolVar(&opts.ExpandRemote, "expand-remote", false, "expand and process .tgz files in charts/")
+	fs.BoolVar(&opts.TUI, "tui", false, "review candidates in a navigable list with previews before converting")
+	fs.BoolVar(&opts.HelmDocs, "helm-docs", false, "regenerate the chart README with helm-docs after converting")
+	fs.BoolVar(&opts.ConvertComments, "convert-comments", false, "rewrite commented-out examples of converted lists in values.yaml to map syntax")
+	fs.StringVar(&opts.MigrationFile, "migration-file", "", "consumer migration map to write, relative to the chart (e.g., values-migration.yaml)")
+	fs.BoolVar(&opts.EnvDependencySort, "env-dependency-sort", false, "render env vars in $(VAR) dependency order instead of alphabetically")
+	fs.Var((*valuesFilesFlag)(&opts.ValuesFiles), "values", "values file merged over the chart defaults for the env order check")
+	fs.Var((*valuesFilesFlag)(&opts.ValuesFiles), "f", "shorthand for --values")
+	fs.Var((*keyOverridesFlag)(&opts.Keys), "key", "convert the list at a values path by this key field for this run (path=field)")
+	fs.StringVar(&opts.KubeVersion, "kube-version", "", "Kubernetes version the chart targets")
+	fs.StringVar(&opts.SchemaSource, "schema", "", "where to read Kubernetes schemas from: types or cluster")
+	fs.StringVar(&opts.ConfigDataKey, "config-data-key", "", "detect lists written into ConfigMap and Secret data, keyed by this field")
+	fs.BoolVar(&opts.UnitTests, "unittest", false, "write a helm-unittest suite asserting the converted values render as before")
+	fs.StringVar(&opts.SnapshotDir, "snapshot-dir", "", "save rendered manifests from before and after converting to this directory")
+	fs.StringVar(&opts.BumpVersion, "bump-version", "", "bump the chart version after converting: major, minor, or patch")
+	fs.BoolVar(&opts.Upgrading, "upgrading", false, "add before/after examples of the converted values to UPGRADING.md")
+	fs.StringVar(&opts.Version, "version", "", "chart version to pull when converting a chart reference")
+	fs.StringVar(&opts.OutputDir, "output-dir", "", "directory to pull a chart reference into")
+	fs.StringVar(&opts.MetricsFile, "metrics-file", "", "write run metrics to this file")
+	fs.StringVar(&opts.Summary, "summary", summaryShort, "summary to end the run with: short, full, or none")
+	fs.BoolVar(&opts.Atomic, "atomic", false, "convert a copy of the chart and sync the changes back once it validates")
+	fs.StringVar(&opts.Workdir, "workdir", "", "directory to convert the copy in (implies --atomic)")
+	fs.BoolVar(&opts.NoColor, "no-color", false, "disable colored output")
 	fs.Usage = func() {
 		fmt.Print(`
 Transform array-based configurations to map-based configurations in values.yaml
@@ -230,26 +545,156 @@ The conversion process:
   4. Updates template files to use new helper functions
   5. Generates helper templates if they don't exist
 
+With --migration-file, a consumer migration map (e.g., values-migration.yaml)
+records the old and new shape of every converted field, so downstream value
+overrides can be migrated mechanically. See the README for its schema.
+
+Env vars are rendered in alphabetical order after conversion. Any $(VAR)
+reference to a var rendered later is reported, checked against the chart
+defaults merged with the umbrella values and any -f/--values files, so the
+warning reflects the values actually deployed. With --env-dependency-sort, env
+vars are instead rendered through a helper variant that emits each var after
+the vars it references, so interdependent env vars convert safely.
+
+helm-docs comments ("# -- ...") on converted fields are kept bound to their
+keys and rewritten to describe the map format, including list @default values.
+
+Commented-out list examples directly below a converted key are removed. With
+--convert-comments, commented-out examples of converted lists anywhere in
+values.yaml, such as "# extraEnv:" followed by commented items, are rewritten
+to map syntax instead, so the documentation in values.yaml matches the new
+format. Examples of lists that aren't converted are left as they are.
+
+With --config-data-key <field> (or configDataKey in config), lists written
+into ConfigMap and Secret data are converted too, keyed by that field, when
+every item of their default has it; use --key for lists in it keyed by
+another field. See 'helm list-to-map detect --help'.
+
+With --key <path>=<field>, the list at that values path is converted keyed by
+the given field for this run only, as if a rule for it came first in the
+config: it wins over detected merge keys, CRD list-map keys, and configured
+rules, without adding a persistent rule (e.g., --key deployment.env=id for env
+vars carrying a custom id field). Paths are relative to the chart they're in
+and may use * like rule paths.
+
+With --snapshot-dir, the chart is rendered with 'helm template' before and after
+converting, and the manifests are saved under before/ and after/ in that
+directory, one file per source template, so the two renders can be reviewed or
+diffed. Files from a previous snapshot are replaced. before/ is saved as soon
+as it's rendered, so it's kept even if the conversion fails.
+
+With --unittest, a helm-unittest suite is written to tests/list-to-map_test.yaml
+asserting that each converted list's default items still render, and that
+items can be overridden, added, and removed by key, so the chart's CI keeps
+guarding the conversion. Run it with 'helm unittest'. An existing suite there is
+merged into: generated tests it already has are replaced, and any other tests
+are kept.
+
+Converting values is a breaking change for anyone overriding them. With
+--bump-version, the version in Chart.yaml is bumped after converting, and an
+entry listing the converted fields is added to the artifacthub.io/changes
+annotation, so the change ships as a new release.
+
+With --upgrading, a section for chart consumers is added to UPGRADING.md in the
+chart root, with before/after examples of each converted field taken from the
+chart's values. It is headed with the chart version, after any --bump-version,
+and merges into a section from an earlier run for the same version: fields
+converted again are updated, and the others are kept.
+
+A chart reference (repo/chart, oci://, or URL) may be given instead of --chart,
+to fork a published chart: it is pulled with helm into --output-dir (default:
+a directory named after the chart), which must not exist or be empty, and
+converted there. With --dry-run, the chart is pulled to a temporary directory
+for the preview and removed.
+
+With --atomic, the chart is copied to a scratch directory and converted there.
+The files the conversion changed are checked to still parse (YAML as YAML,
+templates as Go templates), and only then are the changes synced back:
+existing files are rewritten in place, keeping their owner, mode and ACLs,
+and new files are written beside their target and renamed over it. Until
+then the chart is left untouched: a failed conversion changes nothing, and
+Ctrl-C removes the copy and exits. Ctrl-C while syncing is held off until every file is written.
+--workdir makes the copy under the given directory instead of the system temp
+directory, and implies --atomic. File:// subcharts outside the chart can't be
+converted this way.
+
+With --tui, the candidates are listed to move through with the arrow keys (or
+j and k). Space toggles the path under the cursor, which is previewed side by
+side as it is and as it would be converted, and enter shows a summary of the
+paths to convert and those left as lists, to apply with y or go back to with
+b. When stdin isn't a terminal, numbered commands are read line by line
+instead ('h' lists them).
+
+With --metrics-file, metrics of the run are written to that file when it ends,
+successfully or not: charts processed and failed, values paths converted,
+paths left as lists by category, files that couldn't be parsed, and the time
+spent detecting, converting values, rewriting templates, and rendering. The
+file is in the Prometheus textfile format (for node_exporter's textfile
+collector), or JSON if its name ends in .json.
+
+Every run ends with a summary: the values paths converted and the files
+changed, the paths left as lists, how many warnings were printed along the
+way, and the commands to run next ('helm dependency build' for a chart with
+dependencies, 'helm lint', and 'helm list-to-map verify'). --summary=full
+also lists the changed files and repeats each warning, and --summary=none
+leaves the summary out.
+
 Built-in Kubernetes types are detected automatically. For Custom Resources (CRs),
-first load their CRD definitions using 'helm list-to-map load-crd'.
+first load their CRD definitions using 'helm list-to-map load-crd'. Use
+--kube-version to resolve types for the Kubernetes release the chart targets,
+or --schema cluster to use the schemas saved from the target cluster (see
+'helm list-to-map detect --help').
 
 Usage:
   helm list-to-map convert [flags]
+  helm list-to-map convert [flags] <chart-ref> [--version <version>] [--output-dir <dir>]
 
 Flags:
+      --atomic               convert a copy of the chart and sync the changes back once it validates
       --backup-ext string    backup file extension (default: ".bak")
+      --bump-version string  bump the chart version after converting: major, minor, or patch
       --chart string         path to chart root (default: current directory)
       --config string        path to user config (default: $HELM_CONFIG_HOME/list-to-map/config.yaml)
+      --config-data-key string
+                             detect lists written into ConfigMap and Secret data, keyed by this
+                             field (default: configDataKey from config, or off)
+      --convert-comments     rewrite commented-out examples of converted lists in values.yaml to map syntax
       --dry-run              preview changes without writing files
+      --env-dependency-sort  render env vars in $(VAR) dependency order instead of alphabetically
       --expand-remote        expand and process .tgz files in charts/
   -h, --help                 help for convert
+      --helm-docs            regenerate the chart README with helm-docs after converting
       --include-charts-dir   include subcharts in charts/ directory
+      --key strings          convert the list at a values path by this key field for this run,
+                             as path=field (can be repeated or comma-separated)
+      --kube-version string  Kubernetes version the chart targets (e.g., 1.27)
+      --max-backups int      keep at most this many backup snapshots (default: 0, keep all)
+      --metrics-file string  write run metrics to this file, in Prometheus text format or JSON for .json
+      --migration-file string
+                             consumer migration map to write, relative to the chart
+                             (e.g., values-migration.yaml; not written by default)
+      --no-color             disable colored output (also honors NO_COLOR)
+      --output-dir string    directory to pull a chart reference into (default: ./<chart name>)
       --recursive            recursively convert file:// subcharts and update umbrella values
+      --schema string        where to read Kubernetes schemas from: types (default) or cluster
+      --snapshot-dir string  save rendered manifests from before and after converting to this directory
+      --summary string       summary to end the run with: short, full (listing files and warnings),
+                             or none (default: "short")
+      --tui                  review candidates in a navigable list with previews before converting
+      --unittest             write a helm-unittest suite asserting the converted values render as before
+      --upgrading            add before/after examples of the converted values to UPGRADING.md
+  -f, --values strings       values file merged over the chart defaults for the env order check
+                             (can be repeated or comma-separated)
+      --version string       chart version to pull when converting a chart reference
+      --workdir string       directory to convert the copy in (implies --atomic)
 
 Examples:
   # Convert a chart with built-in K8s types
   helm list-to-map convert --chart ./my-chart
 
+  # Fork a chart from a Helm repository and convert it
+  helm list-to-map convert bitnami/nginx --version 15.0.0 --output-dir ./nginx-maps
+
   # First load CRDs for Custom Resources, then convert
   helm list-to-map load-crd https://raw.githubusercontent.com/.../alertmanager-crd.yaml
   helm list-to-map convert --chart ./my-chart
@@ -257,6 +702,35 @@ Examples:
   # Preview changes without modifying files
   helm list-to-map convert --dry-run
 
+  # Key a list by a different field than the detected one, for this run only
+  helm list-to-map convert --chart ./my-chart --key deployment.env=id
+
+  # Check env var order against the values a deployment actually uses
+  helm list-to-map convert --chart ./my-chart -f values-prod.yaml --dry-run
+
+  # Save before/after renders for review
+  helm list-to-map convert --chart ./my-chart --snapshot-dir ./snapshots
+  diff -r ./snapshots/before ./snapshots/after
+
+  # Convert and add helm-unittest tests guarding the conversion
+  helm list-to-map convert --chart ./my-chart --unittest
+  helm unittest ./my-chart
+
+  # Convert and release as a new minor version with an Artifact Hub changes entry
+  helm list-to-map convert --chart ./my-chart --bump-version minor
+
+  # Release with consumer-facing upgrade notes
+  helm list-to-map convert --chart ./my-chart --bump-version major --upgrading
+
+  # Review candidates with before/after previews and pick which to apply
+  helm list-to-map convert --chart ./my-chart --tui
+
+  # End with every changed file and warning listed, e.g. to review them in CI logs
+  helm list-to-map convert --chart ./my-chart --summary=full
+
+  # Export metrics for node_exporter's textfile collector
+  helm list-to-map convert --chart ./my-chart --metrics-file /var/lib/node_exporter/list-to-map.prom
+
   # Convert umbrella chart and all file:// subcharts recursively
   helm list-to-map convert --chart ./umbrella-chart --recursive
 
@@ -268,6 +742,18 @@ Examples:
 `)
 	}
 	_ = fs.Parse(os.Args[2:])
+	// Flags may follow the chart reference (convert repo/chart --version 1.2.3)
+	if fs.NArg() > 0 {
+		opts.ChartRef = fs.Arg(0)
+		_ = fs.Parse(fs.Args()[1:])
+		if fs.NArg() > 0 {
+			return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+		}
+	}
+	initColor(opts.NoColor)
+	if opts.ChartRef == "" && (opts.Version != "" || opts.OutputDir != "") {
+		return fmt.Errorf("--version and --output-dir require a chart reference")
+	}
 	return runConvert(opts)
 }
 
@@ -276,6 +762,9 @@ func runLoadCRDCommand() error {
 	opts := LoadCRDOptions{}
 	fs.BoolVar(&opts.Force, "force", false, "overwrite existing CRD files")
 	fs.BoolVar(&opts.Common, "common", false, "load CRDs from bundled crd-sources.yaml")
+	fs.StringVar(&opts.Bundle, "bundle", "", "load the CRDs of an archive made by bundle-crds")
+	fs.DurationVar(&opts.Timeout, "timeout", crd.DefaultFetchOptions.Timeout, "time limit for each download attempt")
+	fs.IntVar(&opts.Retries, "retries", crd.DefaultFetchOptions.Retries, "extra download attempts after a transient failure")
 	fs.Usage = func() {
 		fmt.Print(`
 Load CRD (Custom Resource Definition) files to enable detection of convertible
@@ -289,17 +778,41 @@ CRD files are named using the pattern {group}_{plural}_{storageVersion}.yaml,
 so different storage versions of the same CRD coexist without overwriting.
 Existing files are preserved unless --force is used.
 
+Operators distributed through OperatorHub can be loaded from their OLM
+bundles: a bundle directory has the CRDs in the manifests directory named by
+its metadata/annotations.yaml loaded, and a file-based catalog (such as the
+output of 'opm render') has the CRDs embedded in its bundles loaded.
+
+Downloads go through the proxy set by HTTPS_PROXY, HTTP_PROXY and NO_PROXY.
+Each attempt is limited by --timeout, and network errors, HTTP 429 and 5xx
+responses are retried --retries times with a growing delay. Sources in
+common-crds.yaml with a sha256 checksum must match it to be stored.
+
+Private sources are downloaded with the credentials of the first crdAuth
+entry in the config matching the URL's host, or else GITHUB_TOKEN (or
+GH_TOKEN) for GitHub, or else the host's entry in ~/.netrc or $NETRC.
+Credentials are only sent over HTTPS.
+
+Where downloads aren't allowed, make an archive of the CRDs with 'bundle-crds'
+on a connected machine and load it with --bundle. Each CRD is checked against
+the checksum recorded when it was downloaded. With --offline, URLs and
+--common fail without any request being made.
+
 Usage:
   helm list-to-map load-crd [flags] <source> [source...]
   helm list-to-map load-crd --common
+  helm list-to-map load-crd --bundle <archive>
 
 Arguments:
-  source    CRD file path, directory, or URL (can specify multiple)
+  source    CRD file path, directory, OLM bundle or catalog, or URL (can specify multiple)
 
 Flags:
-      --common  load CRDs from bundled crd-sources.yaml (uses 'main' branch)
-      --force   overwrite existing CRD files with same storage version
-  -h, --help    help for load-crd
+      --bundle string     load the CRDs of an archive made by bundle-crds
+      --common            load CRDs from bundled crd-sources.yaml (uses 'main' branch)
+      --force             overwrite existing CRD files with same storage version
+  -h, --help              help for load-crd
+      --retries int       extra attempts after a transient download failure (default 2)
+      --timeout duration  time limit for each download attempt (default 30s)
 
 Examples:
   # Load CRD from a local file
@@ -311,11 +824,22 @@ Examples:
   # Load all CRDs from a directory (recursively)
   helm list-to-map load-crd ./my-chart/crds/
 
+  # Load the CRDs of an operator from its OLM bundle or rendered catalog
+  helm list-to-map load-crd ./my-operator-bundle/
+  opm render quay.io/example/my-operator-bundle:v1.2.0 > catalog.json
+  helm list-to-map load-crd ./catalog.json
+
   # Load bundled common CRDs (from crd-sources.yaml)
   helm list-to-map load-crd --common
 
   # Force overwrite existing CRDs
   helm list-to-map load-crd --force ./crds/
+
+  # Allow slow networks more time, and retry more often
+  helm list-to-map load-crd --timeout 2m --retries 5 --common
+
+  # Load the CRDs bundled on a connected machine, without network access
+  helm list-to-map load-crd --offline --bundle ./crds-bundle.tgz
 `)
 	}
 	_ = fs.Parse(os.Args[2:])
@@ -323,6 +847,111 @@ Examples:
 	return runLoadCRD(opts)
 }
 
+func runBundleCRDsCommand() error {
+	fs := flag.NewFlagSet("bundle-crds", flag.ExitOnError)
+	opts := BundleCRDsOptions{}
+	fs.BoolVar(&opts.Common, "common", false, "bundle the CRDs of the bundled crd-sources.yaml")
+	fs.StringVar(&opts.Output, "output", defaultCRDBundle, "archive to write")
+	fs.DurationVar(&opts.Timeout, "timeout", crd.DefaultFetchOptions.Timeout, "time limit for each download attempt")
+	fs.IntVar(&opts.Retries, "retries", crd.DefaultFetchOptions.Retries, "extra download attempts after a transient failure")
+	fs.Usage = func() {
+		fmt.Print(`
+Download CRDs on a machine with network access and write them to a gzipped
+tar archive, for 'load-crd --bundle' on machines that can't download them.
+
+The archive holds each CRD under crds/, named like the files load-crd stores,
+and an index.yaml listing where each was downloaded from and its SHA256
+checksum. load-crd checks every CRD against the index before storing it.
+Downloads work as in load-crd: through the configured proxy, with crdAuth
+credentials, and checked against the sha256 of common-crds.yaml entries.
+
+The command exits non-zero if any source couldn't be downloaded, after
+writing the archive with the CRDs that were.
+
+Usage:
+  helm list-to-map bundle-crds [flags] <source> [source...]
+  helm list-to-map bundle-crds --common [source...]
+
+Arguments:
+  source    CRD file path or URL (can specify multiple)
+
+Flags:
+      --common            bundle the CRDs of the bundled crd-sources.yaml
+  -h, --help              help for bundle-crds
+      --output string     archive to write (default "crds-bundle.tgz")
+      --retries int       extra attempts after a transient download failure (default 2)
+      --timeout duration  time limit for each download attempt (default 30s)
+
+Examples:
+  # On a connected machine: bundle the common CRDs and a private one
+  helm list-to-map bundle-crds --common https://example.com/crds/widgets.yaml
+
+  # On the air-gapped machine
+  helm list-to-map load-crd --offline --bundle ./crds-bundle.tgz
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	opts.Sources = fs.Args()
+	return runBundleCRDs(opts)
+}
+
+func runLoadOpenAPICommand() error {
+	fs := flag.NewFlagSet("load-openapi", flag.ExitOnError)
+	opts := LoadOpenAPIOptions{}
+	fs.StringVar(&opts.KubeVersion, "kube-version", "", "Kubernetes version of the spec")
+	fs.BoolVar(&opts.Force, "force", false, "replace a saved spec")
+	fs.BoolVar(&opts.Cluster, "cluster", false, "save the current cluster's OpenAPI v3 schemas")
+	fs.Usage = func() {
+		fmt.Print(`
+Save the OpenAPI spec of a Kubernetes release in the plugin's config directory,
+so 'detect' and 'convert' with --kube-version (or kubeVersion in config) can
+report fields that don't exist in that release.
+
+By default the spec is downloaded from the release's api/openapi-spec/swagger.json
+in the kubernetes repository. A file or URL may be given instead, e.g. the output
+of 'kubectl get --raw /openapi/v2' from the target cluster.
+
+With --cluster, the OpenAPI v3 schemas published by the cluster of the current
+kubeconfig context (or Helm's --kube-context) are saved instead, covering
+built-in kinds and installed CRDs alike. 'detect' and 'convert' with --schema
+cluster (or schemaSource: cluster in config) then resolve every kind through
+them, matching the cluster exactly. Reload them after installing or upgrading
+CRDs.
+
+Usage:
+  helm list-to-map load-openapi --kube-version <version> [source]
+  helm list-to-map load-openapi --cluster
+
+Arguments:
+  source    swagger.json file path or URL (default: the release's spec on GitHub)
+
+Flags:
+      --cluster               save the schemas published by the current cluster
+      --force                 replace a spec already saved for the version
+  -h, --help                  help for load-openapi
+      --kube-version string   Kubernetes version of the spec (e.g., 1.27)
+
+Examples:
+  # Download the spec of Kubernetes 1.27
+  helm list-to-map load-openapi --kube-version 1.27
+
+  # Save the spec served by the target cluster
+  kubectl get --raw /openapi/v2 > cluster-swagger.json
+  helm list-to-map load-openapi --kube-version 1.27 cluster-swagger.json
+
+  # Save the current cluster's schemas, including its CRDs, and detect with them
+  helm list-to-map load-openapi --cluster --force
+  helm list-to-map detect --chart ./my-chart --schema cluster
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	opts.Source = fs.Arg(0)
+	if opts.Cluster {
+		return runLoadClusterOpenAPI(opts)
+	}
+	return runLoadOpenAPI(opts)
+}
+
 func runListCRDsCommand() error {
 	fs := flag.NewFlagSet("list-crds", flag.ExitOnError)
 	opts := ListCRDsOptions{}
@@ -343,12 +972,890 @@ Flags:
 	return runListCRDs(opts)
 }
 
+func runCRDCommand() error {
+	if len(os.Args) > 2 && os.Args[2] == "diff" {
+		return runCRDDiffCommand()
+	}
+
+	fs := flag.NewFlagSet("crd", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Print(`
+Inspect loaded CRD definitions.
+
+Usage:
+  helm list-to-map crd [command]
+
+Available Commands:
+  diff        compare the convertible list fields of two loaded CRD versions
+
+Flags:
+  -h, --help   help for crd
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	fs.Usage()
+	return nil
+}
+
+func runCRDDiffCommand() error {
+	fs := flag.NewFlagSet("crd diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Print(`
+Compare the convertible list fields of two loaded versions of a CRD: fields
+convertible in only one version, and fields whose map keys
+(x-kubernetes-list-map-keys) differ. Use it to decide whether a version
+mismatch reported by 'detect' matters for your chart: if no field the chart
+uses differs, the loaded version converts it the same way.
+
+Load each version first with 'helm list-to-map load-crd'.
+
+Usage:
+  helm list-to-map crd diff <group>/<kind> <version> <version>
+
+Flags:
+  -h, --help   help for crd diff
+
+Examples:
+  helm list-to-map crd diff monitoring.coreos.com/Alertmanager v1 v1alpha1
+`)
+	}
+	_ = fs.Parse(os.Args[3:])
+	if fs.NArg() != 3 {
+		fs.Usage()
+		return fmt.Errorf("crd diff requires a <group>/<kind> and two versions")
+	}
+	return runCRDDiff(CRDDiffOptions{Type: fs.Arg(0), From: fs.Arg(1), To: fs.Arg(2)})
+}
+
+func runConvertReleaseCommand() error {
+	fs := flag.NewFlagSet("convert-release", flag.ExitOnError)
+	opts := ConvertReleaseOptions{}
+	fs.StringVar(&opts.File, "file", "", "manifest file with embedded values")
+	fs.StringVar(&opts.Chart, "chart", "", "chart path or reference the values belong to")
+	fs.StringVar(&opts.Version, "version", "", "chart version when --chart is a reference")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "preview changes without writing files")
+	fs.StringVar(&opts.BackupExt, "backup-ext", ".bak", "backup file extension")
+	fs.BoolVar(&opts.NoColor, "no-color", false, "disable colored output")
+	fs.Usage = func() {
+		fmt.Print(`
+Convert chart values embedded in GitOps manifests to the map format of a
+converted chart. Only the list values the chart converts are rewritten; the
+rest of the manifest is left untouched.
+
+Supported values blocks:
+  - Flux HelmRelease: spec.values
+  - Argo CD Application: spec.source(s).helm.valuesObject and helm.values
+  - Argo CD ApplicationSet: the same fields under spec.template
+
+Sources that name a different chart are skipped. Inline helm.values strings
+must be literal blocks (values: |).
+
+The chart may be a local path or a reference that 'helm pull' understands
+(repo/chart, oci://...). Paths are taken from the helper calls in the chart's
+templates, plus any paths 'convert' would still convert.
+
+Usage:
+  helm list-to-map convert-release [flags]
+
+Flags:
+      --backup-ext string   backup file extension (default: ".bak")
+      --chart string        chart path or reference the values belong to (required)
+      --dry-run             preview changes without writing files
+      --file string         manifest file with embedded values (required)
+  -h, --help                help for convert-release
+      --no-color            disable colored output (also honors NO_COLOR)
+      --version string      chart version when --chart is a reference
+
+Examples:
+  # Preview the HelmRelease changes for a locally converted chart
+  helm list-to-map convert-release --file ./apps/my-app/helmrelease.yaml --chart ./charts/my-app --dry-run
+
+  # Convert every Argo CD Application for the chart in a GitOps repo
+  for f in apps/*/application.yaml; do helm list-to-map convert-release --file "$f" --chart ./charts/my-app; done
+
+  # Convert against a published chart version
+  helm list-to-map convert-release --file helmrelease.yaml --chart oci://registry.example.com/charts/my-app --version 2.0.0
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	initColor(opts.NoColor)
+	return runConvertRelease(opts)
+}
+
+func runConvertReleaseValuesCommand() error {
+	fs := flag.NewFlagSet("convert-release-values", flag.ExitOnError)
+	opts := ConvertReleaseValuesOptions{}
+	fs.StringVar(&opts.Release, "release", "", "name of the installed release")
+	fs.StringVar(&opts.Namespace, "namespace", "", "namespace of the release")
+	fs.StringVar(&opts.KubeContext, "kube-context", "", "kubeconfig context to use")
+	fs.IntVar(&opts.Revision, "revision", 0, "release revision to read values from")
+	fs.StringVar(&opts.Chart, "chart", "", "converted chart path or reference")
+	fs.StringVar(&opts.Version, "version", "", "chart version when --chart is a reference")
+	fs.StringVar(&opts.Output, "output", "", "file to write the converted values to")
+	fs.BoolVar(&opts.NoColor, "no-color", false, "disable colored output")
+	fs.Usage = func() {
+		fmt.Print(`
+Fetch the user-supplied values of an installed release (helm get values),
+convert them to the map format of the converted chart, and write them to a
+file ready for the next 'helm upgrade -f'.
+
+The release itself is not changed. Helm's own environment (KUBECONFIG,
+HELM_NAMESPACE, HELM_KUBECONTEXT) applies when flags are not set.
+
+Usage:
+  helm list-to-map convert-release-values [flags]
+
+Flags:
+      --chart string          converted chart path or reference (required)
+  -h, --help                  help for convert-release-values
+      --kube-context string   kubeconfig context to use
+      --namespace string      namespace of the release
+      --no-color              disable colored output (also honors NO_COLOR)
+      --output string         file to write the converted values to, or - for stdout
+                              (default: <release>-values.yaml)
+      --release string        name of the installed release (required)
+      --revision int          release revision to read values from (default: latest)
+      --version string        chart version when --chart is a reference
+
+Examples:
+  # Convert the values of a production release
+  helm list-to-map convert-release-values --release my-app --namespace prod --chart ./charts/my-app
+
+  # Upgrade straight from the converted values
+  helm list-to-map convert-release-values --release my-app --chart ./charts/my-app --output - | helm upgrade my-app ./charts/my-app -f -
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	initColor(opts.NoColor)
+	return runConvertReleaseValues(opts)
+}
+
+func runConvertHelmfileCommand() error {
+	fs := flag.NewFlagSet("convert-helmfile", flag.ExitOnError)
+	opts := ConvertHelmfileOptions{}
+	fs.StringVar(&opts.File, "file", "", "helmfile.yaml or a directory of helmfiles")
+	fs.StringVar(&opts.Chart, "chart", "", "chart path or reference the releases deploy")
+	fs.StringVar(&opts.Version, "version", "", "chart version when --chart is a reference")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "preview changes without writing files")
+	fs.StringVar(&opts.BackupExt, "backup-ext", ".bak", "backup file extension")
+	fs.BoolVar(&opts.NoColor, "no-color", false, "disable colored output")
+	fs.Usage = func() {
+		fmt.Print(`
+Migrate helmfile releases of a converted chart to its map format. For every
+release whose chart matches, inline values blocks and the plain values files
+they reference are converted.
+
+Anything that cannot be migrated automatically is reported instead: helmfiles
+that only parse once rendered, templated (.gotmpl) or remote values files, and
+set/setString entries that index into a converted list.
+
+Usage:
+  helm list-to-map convert-helmfile [flags]
+
+Flags:
+      --backup-ext string   backup file extension (default: ".bak")
+      --chart string        chart path or reference the releases deploy (required)
+      --dry-run             preview changes without writing files
+      --file string         helmfile.yaml or a directory of helmfiles (required)
+  -h, --help                help for convert-helmfile
+      --no-color            disable colored output (also honors NO_COLOR)
+      --version string      chart version when --chart is a reference
+
+Examples:
+  # Preview the migration of a helmfile
+  helm list-to-map convert-helmfile --file helmfile.yaml --chart ./charts/my-app --dry-run
+
+  # Migrate every helmfile in helmfile.d/
+  helm list-to-map convert-helmfile --file helmfile.d --chart ./charts/my-app
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	initColor(opts.NoColor)
+	return runConvertHelmfile(opts)
+}
+
+func runConvertKustomizeCommand() error {
+	fs := flag.NewFlagSet("convert-kustomize", flag.ExitOnError)
+	opts := ConvertKustomizeOptions{}
+	fs.StringVar(&opts.File, "file", "", "kustomization.yaml or a directory of kustomizations")
+	fs.StringVar(&opts.Chart, "chart", "", "chart path or reference the helmCharts entries deploy")
+	fs.StringVar(&opts.Version, "version", "", "chart version when --chart is a reference")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "preview changes without writing files")
+	fs.StringVar(&opts.BackupExt, "backup-ext", ".bak", "backup file extension")
+	fs.BoolVar(&opts.NoColor, "no-color", false, "disable colored output")
+	fs.Usage = func() {
+		fmt.Print(`
+Migrate kustomize helmCharts entries of a converted chart to its map format. For
+every entry whose name matches the chart, the valuesInline block and the local
+valuesFile and additionalValuesFiles it references are converted.
+
+When --file is a directory, every kustomization below it (e.g., a base and its
+overlays) is migrated. Remote values files are reported for manual migration.
+
+Usage:
+  helm list-to-map convert-kustomize [flags]
+
+Flags:
+      --backup-ext string   backup file extension (default: ".bak")
+      --chart string        chart path or reference the helmCharts entries deploy (required)
+      --dry-run             preview changes without writing files
+      --file string         kustomization.yaml or a directory of kustomizations (required)
+  -h, --help                help for convert-kustomize
+      --no-color            disable colored output (also honors NO_COLOR)
+      --version string      chart version when --chart is a reference
+
+Examples:
+  # Preview the migration of a kustomization
+  helm list-to-map convert-kustomize --file overlays/prod --chart ./charts/my-app --dry-run
+
+  # Migrate a base and all of its overlays
+  helm list-to-map convert-kustomize --file deploy --chart ./charts/my-app
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	initColor(opts.NoColor)
+	return runConvertKustomize(opts)
+}
+
+func runConvertTerraformCommand() error {
+	fs := flag.NewFlagSet("convert-terraform", flag.ExitOnError)
+	opts := ConvertTerraformOptions{}
+	fs.StringVar(&opts.File, "file", "", "Terraform file or a directory of .tf and .tfvars files")
+	fs.StringVar(&opts.Chart, "chart", "", "chart path or reference the helm_release resources deploy")
+	fs.StringVar(&opts.Version, "version", "", "chart version when --chart is a reference")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "preview changes without writing files")
+	fs.StringVar(&opts.BackupExt, "backup-ext", ".bak", "backup file extension")
+	fs.BoolVar(&opts.NoColor, "no-color", false, "disable colored output")
+	fs.Usage = func() {
+		fmt.Print(`
+Migrate Terraform helm_release resources of a converted chart to its map format.
+For every release whose chart matches, the values list is converted: heredoc
+YAML, values files read with file(), and heredocs assigned in .tfvars files to
+variables the values list references.
+
+Anything that cannot be migrated automatically is reported instead: values built
+with templatefile(), yamlencode() or jsonencode(), file paths that depend on
+other Terraform expressions, and set blocks that index into a converted list.
+
+Usage:
+  helm list-to-map convert-terraform [flags]
+
+Flags:
+      --backup-ext string   backup file extension (default: ".bak")
+      --chart string        chart path or reference the helm_release resources deploy (required)
+      --dry-run             preview changes without writing files
+      --file string         Terraform file or a directory of .tf and .tfvars files (required)
+  -h, --help                help for convert-terraform
+      --no-color            disable colored output (also honors NO_COLOR)
+      --version string      chart version when --chart is a reference
+
+Examples:
+  # Preview the migration of a Terraform module
+  helm list-to-map convert-terraform --file infra/app --chart ./charts/my-app --dry-run
+
+  # Migrate a single file
+  helm list-to-map convert-terraform --file infra/app/main.tf --chart ./charts/my-app
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	initColor(opts.NoColor)
+	return runConvertTerraform(opts)
+}
+
+func runConvertValuesCommand() error {
+	fs := flag.NewFlagSet("convert-values", flag.ExitOnError)
+	opts := ConvertValuesOptions{}
+	fs.StringVar(&opts.Paths, "paths", "", "comma-separated path=key pairs to convert")
+	fs.Usage = func() {
+		fmt.Print(`
+Convert the given list paths of a values YAML document to maps, without a chart.
+The document is read from stdin (or the file argument) and the converted
+document is written to stdout, so the transform can be used in pipelines.
+
+Usage:
+  helm list-to-map convert-values --paths path=key[,path=key...] [- | file]
+
+Flags:
+  -h, --help           help for convert-values
+      --paths string   comma-separated path=key pairs, e.g. deployment.env=name,service.ports=port
+
+Examples:
+  helm list-to-map convert-values --paths deployment.env=name,service.ports=port - < values.yaml
+  yq '.spec.values' helmrelease.yaml | helm list-to-map convert-values --paths env=name -
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	if fs.NArg() > 0 {
+		opts.Input = fs.Arg(0)
+	}
+	return runConvertValues(opts, os.Stdin, os.Stdout)
+}
+
+func runRevertCommand() error {
+	fs := flag.NewFlagSet("revert", flag.ExitOnError)
+	opts := RevertOptions{}
+	fs.StringVar(&opts.ChartDir, "chart", ".", "path to chart root")
+	fs.StringVar(&opts.BackupExt, "backup-ext", ".bak", "backup file extension")
+	fs.StringVar(&opts.Snapshot, "snapshot", "", "snapshot ID to restore (default: latest)")
+	fs.Var((*valuesFilesFlag)(&opts.Files), "file", "restore only this file, relative to the chart")
+	fs.BoolVar(&opts.List, "list", false, "list available backup snapshots")
+	fs.Usage = func() {
+		fmt.Print(`
+Restore files from backups created by 'convert'.
+
+Each convert run writes its backups as a snapshot, named with the UTC time of
+the run (e.g., values.yaml.20261015T120000Z.bak). By default the latest snapshot
+is restored; use --list to see all snapshots and --snapshot to pick one, such as
+the oldest to get back the original chart.
+
+With --file, only the named files of the snapshot are restored, such as
+values.yaml alone while keeping the rewritten templates. If the values and
+templates then disagree (a list in values.yaml rendered through the list-map
+helper, or a map rendered by a list-style template), the paths are reported.
+
+Usage:
+  helm list-to-map revert [flags]
+
+Flags:
+      --backup-ext string   backup file extension (default: ".bak")
+      --chart string        path to chart root (default: current directory)
+      --file strings        restore only this file, relative to the chart
+                            (can be repeated or comma-separated)
+  -h, --help                help for revert
+      --list                list available backup snapshots
+      --snapshot string     snapshot ID to restore (default: latest)
+
+Examples:
+  # Undo the last conversion
+  helm list-to-map revert --chart ./my-chart
+
+  # Restore a specific snapshot
+  helm list-to-map revert --chart ./my-chart --list
+  helm list-to-map revert --chart ./my-chart --snapshot 20261015T120000Z
+
+  # Restore one template, keeping the rest of the conversion
+  helm list-to-map revert --chart ./my-chart --file templates/deployment.yaml
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	return runRevert(opts)
+}
+
+func runCleanCommand() error {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	opts := CleanOptions{}
+	fs.StringVar(&opts.ChartDir, "chart", ".", "path to chart root")
+	fs.StringVar(&opts.BackupExt, "backup-ext", ".bak", "backup file extension")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "list backups without removing them")
+	fs.Usage = func() {
+		fmt.Print(`
+Remove the backups left by 'convert' once you are satisfied with a conversion.
+
+Only files named the way the plugin names its backups are removed,
+including in subcharts: convert snapshots (e.g.,
+values.yaml.20261015T120000Z.bak) and the tarballs kept by --expand-remote
+(e.g., charts/redis-17.0.0.tgz.bak). Other files ending in the backup
+extension are kept. The extension must start with a dot and can't be one of
+a chart's own (.yaml, .yml, .tpl, .txt, .json, .tgz). Removed backups can no
+longer be restored with 'revert'.
+
+Usage:
+  helm list-to-map clean [flags]
+
+Flags:
+      --backup-ext string   backup file extension (default: ".bak")
+      --chart string        path to chart root (default: current directory)
+      --dry-run             list backups without removing them
+  -h, --help                help for clean
+
+Examples:
+  # See what would be removed
+  helm list-to-map clean --chart ./my-chart --dry-run
+
+  # Remove all backups
+  helm list-to-map clean --chart ./my-chart
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	return runClean(opts)
+}
+
+func runVersionCommand() error {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	opts := VersionOptions{}
+	fs.StringVar(&opts.ChartDir, "chart", "", "path to chart root to check its helper template version")
+	fs.Usage = func() {
+		fmt.Print(`
+Print the plugin version and the version of the helper template it generates.
+With --chart, also report whether the chart's templates/_listmap.tpl is older
+than the plugin's current helper.
+
+Usage:
+  helm list-to-map version [flags]
+
+Flags:
+      --chart string   path to chart root to check its helper template version
+  -h, --help           help for version
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	return runVersion(opts)
+}
+
+func runUpgradeHelpersCommand() error {
+	fs := flag.NewFlagSet("upgrade-helpers", flag.ExitOnError)
+	opts := UpgradeHelpersOptions{}
+	fs.StringVar(&opts.ChartDir, "chart", ".", "path to chart root")
+	fs.StringVar(&opts.BackupExt, "backup-ext", ".bak", "backup file extension")
+	fs.Usage = func() {
+		fmt.Print(`
+Replace the generated templates/_listmap.tpl of a chart and of its subcharts
+with the helper template from this plugin version. Each previous helper is
+backed up first, and values are left alone.
+
+Each helper records the version that generated it. Upgrading lists what every
+version since changed in how converted lists render, so the effect on
+rendered manifests can be reviewed. Helpers newer than this plugin are left
+as they are.
+
+'upgrade-helper' is an alias, kept for helpers that name it.
+
+Usage:
+  helm list-to-map upgrade-helpers [flags]
+
+Flags:
+      --backup-ext string   backup file extension (default: ".bak")
+      --chart string        path to chart root (default: current directory)
+  -h, --help                help for upgrade-helpers
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	return runUpgradeHelpers(opts)
+}
+
+func runPackageCommand() error {
+	fs := flag.NewFlagSet("package", flag.ExitOnError)
+	opts := PackageOptions{}
+	fs.StringVar(&opts.ChartDir, "chart", ".", "path to chart root")
+	fs.StringVar(&opts.Destination, "destination", ".", "directory to write the chart archive to")
+	fs.BoolVar(&opts.InPlace, "in-place", false, "convert the chart itself instead of a temporary copy")
+	fs.StringVar(&opts.BackupExt, "backup-ext", ".bak", "backup file extension")
+	fs.StringVar(&opts.KubeVersion, "kube-version", "", "Kubernetes version the chart targets")
+	fs.StringVar(&opts.SchemaSource, "schema", "", "where to read Kubernetes schemas from: types or cluster")
+	fs.StringVar(&opts.BumpVersion, "bump-version", "", "bump the chart version after converting: major, minor, or patch")
+	fs.BoolVar(&opts.NoColor, "no-color", false, "disable colored output")
+	fs.Usage = func() {
+		fmt.Print(`
+Convert a chart, lint it, and package it with helm in one step.
+
+The chart is converted as by 'helm list-to-map convert', in a temporary copy
+unless --in-place is set, so the packaged chart has map values while the
+chart's own files are left as they are. The converted chart is checked with
+'helm lint' and then packaged with 'helm package' into --destination. Backups
+written by the conversion are left out of the archive, and no migration map is
+written into it. Both run the helm binary (HELM_BIN, or helm on the PATH), so
+the chart is checked and packaged by the helm version you release with.
+
+Usage:
+  helm list-to-map package [flags]
+
+Flags:
+      --backup-ext string    backup file extension (default: ".bak")
+      --bump-version string  bump the chart version after converting: major, minor, or patch
+      --chart string         path to chart root (default: current directory)
+      --destination string   directory to write the chart archive to (default: current directory)
+  -h, --help                 help for package
+      --in-place             convert the chart itself instead of a temporary copy
+      --kube-version string  Kubernetes version the chart targets (e.g., 1.27)
+      --no-color             disable colored output (also honors NO_COLOR)
+      --schema string        where to read Kubernetes schemas from: types (default) or cluster
+
+Examples:
+  # Package a map-values release of a chart, leaving the chart as it is
+  helm list-to-map package --chart ./my-chart --destination ./dist
+
+  # Convert the chart for good, and release it as a new major version
+  helm list-to-map package --chart ./my-chart --destination ./dist --in-place --bump-version major
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	initColor(opts.NoColor)
+	return runPackage(opts)
+}
+
+func runSnapshotTestCommand() error {
+	fs := flag.NewFlagSet("snapshot-test", flag.ExitOnError)
+	opts := SnapshotTestOptions{}
+	fs.StringVar(&opts.ChartDir, "chart", ".", "path to chart root")
+	fs.StringVar(&opts.Golden, "golden", "", "directory of golden manifests")
+	fs.BoolVar(&opts.Update, "update", false, "write the golden manifests from the chart")
+	fs.StringVar(&opts.KubeVersion, "kube-version", "", "Kubernetes version the chart targets")
+	fs.StringVar(&opts.SchemaSource, "schema", "", "where to read Kubernetes schemas from: types or cluster")
+	fs.BoolVar(&opts.NoColor, "no-color", false, "disable colored output")
+	fs.Usage = func() {
+		fmt.Print(`
+Check that converting a chart doesn't change what it renders. The chart is
+converted in a temporary copy, rendered with 'helm template' and its default
+values, and compared against golden manifests committed to the chart repo,
+one file per source template as with 'convert --snapshot-dir'. Any drift is
+printed as a diff and exits non-zero, so chart repos can run the check in CI.
+
+With --update, the golden manifests are written from the chart as it is, and
+nothing is converted. Update them whenever the chart's templates or defaults
+change on purpose.
+
+Usage:
+  helm list-to-map snapshot-test --golden <dir> [flags]
+
+Flags:
+      --chart string         path to chart root (default: current directory)
+      --golden string        directory of golden manifests
+  -h, --help                 help for snapshot-test
+      --kube-version string  Kubernetes version the chart targets (e.g., 1.27)
+      --no-color             disable colored output (also honors NO_COLOR)
+      --schema string        where to read Kubernetes schemas from: types (default) or cluster
+      --update               write the golden manifests from the chart instead of comparing
+
+Examples:
+  # Record what the chart renders today
+  helm list-to-map snapshot-test --chart ./my-chart --golden ./golden/ --update
+
+  # Fail CI if converting the chart would change its manifests
+  helm list-to-map snapshot-test --chart ./my-chart --golden ./golden/
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	initColor(opts.NoColor)
+	return runSnapshotTest(opts)
+}
+
+func runVerifyCommand() error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	opts := VerifyOptions{}
+	fs.StringVar(&opts.ChartDir, "chart", ".", "path to chart root")
+	fs.StringVar(&opts.Overrides, "with-overrides", "", "directory of sample override files")
+	fs.StringVar(&opts.Original, "original", "", "chart path or reference as it was before conversion")
+	fs.StringVar(&opts.MigrationFile, "migration-file", "values-migration.yaml", "migration map to convert the overrides with, relative to the chart")
+	fs.StringVar(&opts.BackupExt, "backup-ext", ".bak", "backup file extension")
+	fs.BoolVar(&opts.NoColor, "no-color", false, "disable colored output")
+	fs.Usage = func() {
+		fmt.Print(`
+Check that a converted chart still works for its consumers. The chart as it was
+before conversion is rendered with 'helm template' and each sample override
+file in --with-overrides, and compared against the converted chart rendered
+with the same overrides converted through the chart's migration map, as
+consumers would convert them. The chart defaults are compared as well. Any
+render that differs is printed as a diff and exits non-zero, catching overrides
+that silently stop working the same way, such as a list that replaced the
+default items but now merges with them. Manifests are compared parsed, and
+lists of objects whose items only moved (the helper renders converted maps in
+key order) are reported as reordered without failing.
+
+The chart before conversion is restored in a temporary copy from the oldest
+backup of each file, so edits made since converting are compared as changes.
+Pass --original with the chart path or reference as it was instead, e.g. after
+the backups were removed with 'clean'.
+
+Usage:
+  helm list-to-map verify [flags]
+
+Flags:
+      --backup-ext string       backup file extension (default: ".bak")
+      --chart string            path to chart root (default: current directory)
+  -h, --help                    help for verify
+      --migration-file string   migration map to convert the overrides with, relative to the chart
+                                (default: "values-migration.yaml")
+      --no-color                disable colored output (also honors NO_COLOR)
+      --original string         chart path or reference as it was before conversion
+                                (default: restored from the chart's backups)
+      --with-overrides string   directory of sample override files (*.yaml, *.yml)
+
+Examples:
+  # Check the chart defaults and the overrides in ./examples after converting
+  helm list-to-map convert --chart ./my-chart
+  helm list-to-map verify --chart ./my-chart --with-overrides ./examples
+
+  # Compare against the last release of the chart
+  helm list-to-map verify --chart ./my-chart --with-overrides ./examples --original myrepo/my-chart
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	initColor(opts.NoColor)
+	return runVerify(opts)
+}
+
+func runStatsCommand() error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	opts := StatsOptions{}
+	fs.StringVar(&opts.Output, "output", "text", "output format: text or json")
+	fs.BoolVar(&opts.NoColor, "no-color", false, "disable colored output")
+	fs.Usage = func() {
+		fmt.Print(`
+Report how far charts are through conversion. For each chart, list-rendering
+usages are counted as converted (rendered through the helper), convertible
+(convert would change them), or skipped by category:
+
+  template   rendered by a template pattern convert can't rewrite
+  shared     shared through a YAML merge key or alias
+  conflict   rendered into resource fields that disagree on the merge key
+  ignored    excluded by ignore config or opt-out comments
+  minItems   fewer items than minItems
+
+Map readiness is the percentage of converted usages among those that should
+be maps; ignored and minItems usages are kept as lists on purpose and don't
+count. This is a read-only operation; only CRDs already loaded into the plugin
+config are used.
+
+Usage:
+  helm list-to-map stats [flags] [charts...]
+
+Flags:
+  -h, --help            help for stats
+      --no-color        disable colored output (also honors NO_COLOR)
+      --output string   output format: text or json (default "text")
+
+Examples:
+  # Readiness of the chart in the current directory
+  helm list-to-map stats
+
+  # Track many charts over time
+  helm list-to-map stats --output json charts/* > stats.json
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	opts.Charts = fs.Args()
+	initColor(opts.NoColor)
+	return runStats(opts)
+}
+
+func runDecisionsCommand() error {
+	fs := flag.NewFlagSet("decisions", flag.ExitOnError)
+	opts := DecisionsOptions{}
+	fs.Usage = func() {
+		fmt.Print(`
+Write the decisions convert makes about each list-rendered values path of the
+charts as a JSON document, for policy engines such as OPA and conftest to
+evaluate before converting (e.g., "tolerations must never be converted").
+
+Each decision records the path and one of:
+
+  convert     convert would turn it into a map or set; the reason is where
+              its key comes from: schema (the Kubernetes type or CRD of the
+              resource field) or rule (a conversion rule, included)
+  converted   already rendered through the list-map helper
+  skip        left as a list; the reason is a stats category (template,
+              shared, conflict, ignored, minItems, ask) or why it couldn't be
+              detected (e.g., k8s_no_keys for lists without a merge key)
+
+along with its key, element type, typePolicy, the resource fields it's
+rendered into, and the path renamePaths moves it to. This is a read-only
+operation; only CRDs already loaded into the plugin config are used.
+
+Usage:
+  helm list-to-map decisions [flags] [charts...]
+
+Flags:
+  -h, --help   help for decisions
+
+Examples:
+  # Check the chart's conversion against organization policies
+  helm list-to-map decisions ./my-chart > decisions.json
+  conftest test decisions.json --policy ./policy
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	opts.Charts = fs.Args()
+	return runDecisions(opts)
+}
+
+func runAnalyzeCommand() error {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	opts := AnalyzeOptions{}
+	fs.BoolVar(&opts.Stream, "stream", false, "write newline-delimited JSON events as each path is decided")
+	fs.Usage = func() {
+		fmt.Print(`
+Report the decisions convert makes about each values path of the charts as
+findings located in their files, for editor plugins and language servers to
+show list-to-map suggestions while charts are edited.
+
+A path gets a finding on its key in values.yaml and on every template line
+that renders it. Each finding has the file (relative to the chart root), its
+lines, the values path, the decision (convert or skip), the category (the
+decision's reason, as in the decisions command), a severity, a message, and a
+suggested fix when there is one:
+
+  info      convert would turn the list into a map or set
+  warning   left as a list until a key, rule, or CRD is added, or the
+            template is changed
+  hint      kept as a list on purpose (ignored, minItems, not_in_release)
+
+Paths already converted have no findings. Without --stream, one JSON document
+is written once every chart is analyzed, values.yaml findings first. With
+--stream, newline-delimited JSON events are written as each path is decided,
+its values.yaml finding followed by its template lines:
+
+  start     {"event":"start","root":...,"chart":...,"version":...}
+  finding   {"event":"finding","root":...,"file":...,"lines":{"start":...,"end":...},...}
+  end       {"event":"end","root":...,"findings":N}
+  error     {"event":"error","root":...,"error":...}; other charts go on
+
+This is a read-only operation; only CRDs already loaded into the plugin config
+are used.
+
+Usage:
+  helm list-to-map analyze [flags] [charts...]
+
+Flags:
+  -h, --help     help for analyze
+      --stream   write newline-delimited JSON events as each path is decided
+
+Examples:
+  # Findings in the chart in the current directory
+  helm list-to-map analyze
+
+  # Stream findings for an editor plugin
+  helm list-to-map analyze --stream ./my-chart
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	opts.Charts = fs.Args()
+	return runAnalyze(opts)
+}
+
+func runDriftCommand() error {
+	fs := flag.NewFlagSet("drift", flag.ExitOnError)
+	opts := DriftOptions{}
+	fs.StringVar(&opts.ChartDir, "chart", ".", "path to chart root")
+	fs.StringVar(&opts.MigrationFile, "migration-file", "values-migration.yaml", "consumer migration map recording the converted paths, relative to the chart")
+	fs.Var((*valuesFilesFlag)(&opts.ValuesFiles), "values", "other values file to check")
+	fs.Var((*valuesFilesFlag)(&opts.ValuesFiles), "f", "shorthand for --values")
+	fs.BoolVar(&opts.NoColor, "no-color", false, "disable colored output")
+	fs.Usage = func() {
+		fmt.Print(`
+Check that the paths a conversion turned into maps are still maps, so lists
+brought back by a merge or a new template are caught in CI.
+
+The converted paths are read from the consumer migration map written by
+convert --migration-file (values-migration.yaml), along with any paths the
+templates render through the list-map helper. Each is reported, with its file and line, if:
+
+  - values.yaml, or a file given with -f, sets it to a non-empty list
+  - a template renders it as a list (e.g., a new template using toYaml on it)
+
+Exits non-zero if any path has drifted. This is a read-only operation.
+
+Usage:
+  helm list-to-map drift [flags]
+
+Flags:
+      --chart string           path to chart root (default: current directory)
+  -h, --help                   help for drift
+      --migration-file string  consumer migration map recording the converted paths, relative
+                               to the chart (default: "values-migration.yaml")
+      --no-color               disable colored output (also honors NO_COLOR)
+  -f, --values strings         other values file to check (can be repeated or comma-separated)
+
+Examples:
+  # Check a converted chart in CI
+  helm list-to-map drift --chart ./my-chart
+
+  # Also check the values files used by chart-testing
+  helm list-to-map drift --chart ./my-chart -f ./my-chart/ci/default-values.yaml
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	initColor(opts.NoColor)
+	return runDrift(opts)
+}
+
+func runDiffValuesCommand() error {
+	fs := flag.NewFlagSet("diff-values", flag.ExitOnError)
+	opts := DiffValuesOptions{}
+	fs.StringVar(&opts.Paths, "paths", "", "comma-separated path=key pairs converted")
+	fs.StringVar(&opts.MigrationFile, "migration-file", "", "migration map recording the converted paths")
+	fs.BoolVar(&opts.NoColor, "no-color", false, "disable colored output")
+	fs.Usage = func() {
+		fmt.Print(`
+Check that a map-style values file holds the same values as the original
+list-style file, such as after converting values by hand. The original's lists
+are converted as convert would, and the two files are compared field by field:
+map entries are matched by key, regardless of the order of the list items.
+
+The key of each converted list is taken from --paths or --migration-file, or
+else inferred from the converted file: the item field whose values are the
+keys of the map it became. Every field that differs is printed, and the
+command exits non-zero. This is a read-only operation.
+
+Usage:
+  helm list-to-map diff-values [flags] <original> <converted>
+
+Flags:
+  -h, --help                    help for diff-values
+      --migration-file string   migration map recording the converted paths (e.g., values-migration.yaml)
+      --no-color                disable colored output (also honors NO_COLOR)
+      --paths string            comma-separated path=key pairs, e.g. deployment.env=name,service.ports=port
+
+Examples:
+  # Check values converted by hand
+  helm list-to-map diff-values values-old.yaml values.yaml
+
+  # Compare a consumer's overrides with the chart's migration map
+  helm list-to-map diff-values --migration-file ./my-chart/values-migration.yaml prod-old.yaml prod.yaml
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("diff-values requires the original and converted values files")
+	}
+	opts.Original, opts.Converted = fs.Arg(0), fs.Arg(1)
+	initColor(opts.NoColor)
+	return runDiffValues(opts)
+}
+
+func runDoctorCommand() error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	opts := DoctorOptions{}
+	fs.StringVar(&opts.ChartDir, "chart", ".", "path to chart root to check for helper template drift")
+	fs.BoolVar(&opts.Offline, "offline", false, "skip CRD source reachability checks")
+	fs.Usage = func() {
+		fmt.Print(`
+Diagnose common environment and configuration problems.
+
+Checks:
+  - HELM_PLUGIN_DIR and HELM_CONFIG_HOME resolution
+  - user config file existence, syntax, and rules
+  - stored CRD files load cleanly
+  - reachability of common CRD sources (see load-crd --common)
+  - generated helper templates match this plugin version
+
+Each warning or failure is printed with a suggested fix. Exits non-zero if any
+check fails.
+
+Usage:
+  helm list-to-map doctor [flags]
+
+Flags:
+      --chart string   path to chart root to check for helper template drift (default ".")
+  -h, --help           help for doctor
+      --offline        skip CRD source reachability checks
+`)
+	}
+	_ = fs.Parse(os.Args[2:])
+	return runDoctor(opts)
+}
+
 func runAddRuleCommand() error {
 	fs := flag.NewFlagSet("add-rule", flag.ExitOnError)
 	opts := AddRuleOptions{}
 	fs.StringVar(&opts.Path, "path", "", "dot path to array (end with [])")
-	fs.StringVar(&opts.UniqueKey, "uniqueKey", "", "unique key field")
+	fs.Var((*uniqueKeysFlag)(&opts.UniqueKeys), "uniqueKey", "unique key field (repeatable)")
 	fs.StringVar(&opts.ConfigPath, "config", "", "path to user config")
+	fs.BoolVar(&opts.Ignore, "ignore", false, "add the path to ignorePaths instead of adding a rule")
+	fs.BoolVar(&opts.Set, "set", false, "convert the list to a set of its values (value: true)")
+	fs.StringVar(&opts.KeyStrategy, "key-strategy", "", "convert by several unique keys: nested or composite")
+	fs.StringVar(&opts.PromoteScalar, "promote-scalar", "", "field scalar items are promoted into")
+	fs.StringVar(&opts.Note, "note", "", "why the rule exists, kept with it in the config")
 	fs.Usage = func() {
 		fmt.Print(`
 Add a custom conversion rule to your user configuration file.
@@ -358,18 +1865,55 @@ Use this for:
   - Custom resources without available CRD definitions
   - Any list field you want to convert that isn't auto-detected
 
+Use --ignore to exclude a path (and everything under it) from detection and
+conversion instead. Ignore paths take precedence over auto-detection and rules.
+
+Use --set for lists of scalars, or of objects with a single field such as
+imagePullSecrets: [{name: regcred}]. Each value becomes a key set to true
+(regcred: true), so overrides add an item with <path>.<value>=true and remove
+it with false or null. --uniqueKey names the single field, if items are objects.
+A set sorts and deduplicates: values render in key order, each once, so lists
+whose order or repeats matter, such as container args, can't be sets. Repeated
+values are reported when converting.
+
+Items unique only by several fields together, such as
+x-kubernetes-list-map-keys [namespace, name], take a --uniqueKey per field (or
+one comma-separated --uniqueKey), outermost first. By default the map is keyed
+by the values joined with "/" (ns-a/svc-a: {...}); --key-strategy=nested keys
+it one level per field instead (ns-a: {svc-a: {...}}).
+
+--promote-scalar records the field that scalar items of a mixed list are
+promoted into (promoteScalar in the rule), and --note records why the rule
+exists, so 'rules' shows it and the config needs no hand-editing.
+
+The path must be a dot path of field names and * wildcards, each matching one
+whole segment, ending with [] for the list a rule converts.
+
 Usage:
   helm list-to-map add-rule [flags]
 
 Flags:
-      --config string      path to user config (default: $HELM_CONFIG_HOME/list-to-map/config.yaml)
-  -h, --help               help for add-rule
-      --path string        dot path to array (end with []), e.g. database.primary.extraEnv[]
-      --uniqueKey string   unique key field, e.g. name
+      --config string          path to user config (default: $HELM_CONFIG_HOME/list-to-map/config.yaml)
+  -h, --help                   help for add-rule
+      --ignore                 add the path to ignorePaths instead of adding a rule
+      --key-strategy string    convert by several unique keys: composite (default) or nested
+      --note string            why the rule exists, kept with it in the config
+      --path string            dot path to array (end with []), e.g. database.primary.extraEnv[]
+      --promote-scalar string  field scalar items are promoted into, e.g. value
+      --set                    convert the list to a set of its values (value: true)
+      --uniqueKey string       unique key field, e.g. name (repeat, or comma-separate, for
+                               several fields)
 
 Examples:
   helm list-to-map add-rule --path='istio.virtualService.http[]' --uniqueKey=name
   helm list-to-map add-rule --path='myapp.listeners[]' --uniqueKey=port
+  helm list-to-map add-rule --path='legacy.*' --ignore
+  helm list-to-map add-rule --path='imagePullSecrets[]' --uniqueKey=name --set
+  helm list-to-map add-rule --path='ingress.hosts[]' --set
+  helm list-to-map add-rule --path='mesh.services[]' --uniqueKey=namespace,name --key-strategy=nested
+  helm list-to-map add-rule --path='gateway.routes[]' --uniqueKey=host --uniqueKey=path
+  helm list-to-map add-rule --path='myapp.plugins[]' --uniqueKey=name --promote-scalar=name \
+    --note='plugins may be listed by name only'
 `)
 	}
 	_ = fs.Parse(os.Args[2:])
@@ -377,6 +1921,10 @@ Examples:
 }
 
 func runListRulesCommand() error {
+	if len(os.Args) > 2 && os.Args[2] == "test" {
+		return runRuleTestCommand()
+	}
+
 	fs := flag.NewFlagSet("rules", flag.ExitOnError)
 	fs.Usage = func() {
 		fmt.Print(`
@@ -387,6 +1935,10 @@ and do not require rules. Use 'detect' to see what will be converted.
 
 Usage:
   helm list-to-map rules [flags]
+  helm list-to-map rules test [flags]
+
+Available Commands:
+  test        show what a rule pattern would match before saving it
 
 Flags:
   -h, --help   help for rules
@@ -395,3 +1947,35 @@ Flags:
 	_ = fs.Parse(os.Args[2:])
 	return runListRules(ListRulesOptions{})
 }
+
+func runRuleTestCommand() error {
+	fs := flag.NewFlagSet("rules test", flag.ExitOnError)
+	opts := RuleTestOptions{}
+	fs.StringVar(&opts.Path, "path", "", "dot path pattern to test (end with [])")
+	fs.StringVar(&opts.UniqueKey, "uniqueKey", "", "unique key field to check in values entries")
+	fs.StringVar(&opts.ChartDir, "chart", ".", "path to chart root")
+	fs.Usage = func() {
+		fmt.Print(`
+Dry-evaluate a rule pattern against a chart without saving it. Shows which
+template usages and values.yaml arrays the pattern matches.
+
+Patterns are matched from the end of the values path, segment by segment.
+A '*' segment matches any single key, and the pattern must end with '[]'.
+
+Usage:
+  helm list-to-map rules test [flags]
+
+Flags:
+      --chart string       path to chart root (default: current directory)
+  -h, --help               help for rules test
+      --path string        dot path pattern to test (end with []), e.g. istio.virtualService.http[]
+      --uniqueKey string   unique key field to check in matched values entries
+
+Examples:
+  helm list-to-map rules test --path='istio.virtualService.http[]' --chart ./my-chart
+  helm list-to-map rules test --path='*.listeners[]' --uniqueKey=port
+`)
+	}
+	_ = fs.Parse(os.Args[3:])
+	return runRuleTest(opts)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// validateRuleShape checks a rule's entry shape: it needs the single unique
+// key it shapes the entries of, and renamed fields must stay distinct so the
+// helper can invert them
+func validateRuleShape(r Rule) error {
+	if r.Shape == nil {
+		return nil
+	}
+	switch {
+	case r.Set || r.KeyStrategy != "":
+		return fmt.Errorf("shape for %s can't be combined with set or keyStrategy", r.PathPattern)
+	case len(r.UniqueKeys) == 0:
+		return fmt.Errorf("shape for %s needs a uniqueKeys entry", r.PathPattern)
+	}
+	key := ruleMergeKey(&r)
+	if r.Shape.Scalar == key {
+		return fmt.Errorf("shape for %s can't use the unique key %s as its scalar field", r.PathPattern, key)
+	}
+
+	fields := make([]string, 0, len(r.Shape.Rename))
+	for field := range r.Shape.Rename {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	targets := make(map[string]string)
+	for _, field := range fields {
+		to := r.Shape.Rename[field]
+		switch {
+		case field == key:
+			return fmt.Errorf("shape for %s can't rename the unique key %s", r.PathPattern, key)
+		case to == "":
+			return fmt.Errorf("shape for %s renames %s to an empty name", r.PathPattern, field)
+		case targets[to] != "":
+			return fmt.Errorf("shape for %s renames both %s and %s to %s", r.PathPattern, targets[to], field, to)
+		}
+		targets[to] = field
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+func TestValidateRuleShape(t *testing.T) {
+	t.Parallel()
+
+	keyed := func(shape EntryShape) Rule {
+		return Rule{PathPattern: "env[]", UniqueKeys: []string{"name"}, Shape: &shape}
+	}
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{"no shape", Rule{PathPattern: "env[]", UniqueKeys: []string{"name"}}, false},
+		{"rename and scalar", keyed(EntryShape{Rename: map[string]string{"valueFrom": "from"}, Scalar: "value"}), false},
+		{"no unique key", Rule{PathPattern: "env[]", Shape: &EntryShape{Scalar: "value"}}, true},
+		{"with set", Rule{PathPattern: "env[]", UniqueKeys: []string{"name"}, Set: true, Shape: &EntryShape{Scalar: "value"}}, true},
+		{"scalar key", keyed(EntryShape{Scalar: "name"}), true},
+		{"rename key", keyed(EntryShape{Rename: map[string]string{"name": "n"}}), true},
+		{"rename collision", keyed(EntryShape{Rename: map[string]string{"a": "x", "b": "x"}}), true},
+	}
+	for _, tt := range tests {
+		if err := validateRuleShape(tt.rule); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateRuleShape() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestConvertShape(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	originalConf := conf
+	defer func() { conf = originalConf }()
+	conf = Config{}
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	chartConf := `rules:
+  - pathPattern: env[]
+    uniqueKeys: [name]
+    shape:
+      scalar: value
+`
+	if err := os.WriteFile(filepath.Join(chartPath, chartConfigFile), []byte(chartConf), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak", MigrationFile: "values-migration.yaml"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	checks := map[string][]string{
+		"values.yaml":               {"# (key: name; scalar value)\nenv:\n  DB_HOST: localhost\n"},
+		"templates/deployment.yaml": {`include "chart.listmap.items.shaped" (dict "items" (index .Values "env") "key" "name" "scalar" "value")`},
+		"templates/_listmap.tpl":    {`define "chart.listmap.items.shaped"`},
+		"values-migration.yaml":     {"key: name\n      scalar: value"},
+	}
+	for name, wants := range checks {
+		data, _ := os.ReadFile(filepath.Join(chartPath, name))
+		for _, want := range wants {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("%s should contain %q, got:\n%s", name, want, data)
+			}
+		}
+	}
+	if !strings.Contains(output, "Shape:    scalar value") {
+		t.Errorf("output should report the shape, got:\n%s", output)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	pkgfs "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/template"
+)
+
+// skippedFrameContext is the number of template lines shown around a skipped usage
+const skippedFrameContext = 2
+
+// skippedUsage is a template line that renders a skipped values path
+type skippedUsage struct {
+	TemplateFile string   // Path relative to the chart root (e.g., "templates/deployment.yaml")
+	LineNumber   int      // 1-based line of the usage
+	Reason       string   // Why the rewriter could not handle the construct
+	Frame        []string // Numbered template lines around the usage
+}
+
+var (
+	reIndentPipe   = regexp.MustCompile(`\|\s*n?indent\s+\d+`)
+	reConcat       = regexp.MustCompile(`\b(concat|append|prepend)\b`)
+	reCoalesce     = regexp.MustCompile(`\bcoalesce\b`)
+	reTplCall      = regexp.MustCompile(`\btpl\b`)
+	reIncludeDict  = regexp.MustCompile(`\binclude\s+"[^"]+"\s+\(\s*dict\b`)
+	reStaticItem   = regexp.MustCompile(`^\s*-\s+\S`)
+	reCondition    = regexp.MustCompile(`\{\{-?\s*(if|else if)\s`)
+	reWithDirect   = regexp.MustCompile(`\{\{-?\s*with\s`)
+	reRangeDirect  = regexp.MustCompile(`\{\{-?\s*range\s`)
+	reToYamlDirect = regexp.MustCompile(`\btoYaml\b`)
+)
+
+// explainSkippedPath finds the template lines that render valuesPath and
+// categorizes the construct that defeated the rewriter
+func explainSkippedPath(chartRoot, valuesPath string) []skippedUsage {
+	var usages []skippedUsage
+	indexed := `index\s+\$?\.Values`
+	for _, part := range strings.Split(valuesPath, ".") {
+		indexed += `\s+` + regexp.QuoteMeta(strconv.Quote(part))
+	}
+	ref := regexp.MustCompile(`\.Values\.` + regexp.QuoteMeta(valuesPath) + `(?:[^a-zA-Z0-9_.]|$)|` + indexed + `\s*(?:[^\s"]|$)`)
+
+	_ = pkgfs.WalkTemplates(pkgfs.OSFileSystem{}, chartRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if !pkgfs.IsTemplate(path) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		relPath := rel(chartRoot, path)
+
+		lines := strings.Split(string(data), "\n")
+		for i, line := range lines {
+			if !ref.MatchString(line) {
+				continue
+			}
+			// Conditions only guard rendering; the construct is on another line
+			if reCondition.MatchString(line) && !reToYamlDirect.MatchString(line) {
+				continue
+			}
+			usages = append(usages, skippedUsage{
+				TemplateFile: relPath,
+				LineNumber:   i + 1,
+				Reason:       skipReason(lines, i),
+				Frame:        codeFrame(lines, i, skippedFrameContext),
+			})
+		}
+		return nil
+	})
+	return usages
+}
+
+// skipReason categorizes the unsupported construct on lines[i]
+func skipReason(lines []string, i int) string {
+	line := lines[i]
+	switch {
+	case reConcat.MatchString(line):
+		return "list built with concat/append"
+	case reCoalesce.MatchString(line):
+		return "coalesce over lists not all converted with the same key"
+	case reTplCall.MatchString(line):
+		return "values rendered through tpl"
+	case reIncludeDict.MatchString(line):
+		return "passed to a named template that other callers pass lists not converted alike"
+	case reToYamlDirect.MatchString(line) && precededByStaticItem(lines, i):
+		return "static list entries combined with toYaml (inline append)"
+	case reToYamlDirect.MatchString(line) && !reIndentPipe.MatchString(line):
+		return "toYaml without an indent or nindent pipe"
+	case reToYamlDirect.MatchString(line):
+		return "toYaml in an unsupported surrounding block"
+	case reWithDirect.MatchString(line):
+		return "with block whose body is not a single 'toYaml . | nindent N' (or indent N)"
+	case reRangeDirect.MatchString(line):
+		return "range loop without a section key on the line above"
+	}
+	return "unrecognized template construct"
+}
+
+// precededByStaticItem reports whether the nearest non-blank line above
+// lines[i] is a literal list entry
+func precededByStaticItem(lines []string, i int) bool {
+	for j := i - 1; j >= 0; j-- {
+		if strings.TrimSpace(lines[j]) == "" {
+			continue
+		}
+		return reStaticItem.MatchString(lines[j]) && !strings.Contains(lines[j], "{{")
+	}
+	return false
+}
+
+// codeFrame returns lines around lines[i] numbered for display, marking line i
+func codeFrame(lines []string, i, context int) []string {
+	start := max(i-context, 0)
+	end := min(i+context+1, len(lines))
+	width := len(fmt.Sprint(end))
+
+	var frame []string
+	for j := start; j < end; j++ {
+		marker := "  "
+		if j == i {
+			marker = "> "
+		}
+		frame = append(frame, fmt.Sprintf("%s%*d | %s", marker, width, j+1, lines[j]))
+	}
+	return frame
+}
+
+// printSkippedPaths prints each skipped path with a code frame and reason for
+// every template line that renders it
+func printSkippedPaths(chartRoot string, paths []string, indent string) {
+	for _, p := range paths {
+		fmt.Printf("%s%s\n", indent, p)
+		for _, u := range explainSkippedPath(chartRoot, p) {
+			fmt.Printf("%s  %s:%d: %s\n", indent, u.TemplateFile, u.LineNumber, yellow(u.Reason))
+			for _, l := range u.Frame {
+				fmt.Printf("%s    %s\n", indent, l)
+			}
+		}
+	}
+}
+
+// printUnhandledDictArgs prints the include arguments keeping named templates
+// that render converted paths from being rewritten. The templates still render
+// lists, so they must be updated by hand, like skipped paths.
+func printUnhandledDictArgs(unhandled []template.UnhandledDictArg, indent string) {
+	if len(unhandled) == 0 {
+		return
+	}
+	fmt.Println("\n" + indent + yellow("Named templates left unchanged (not every caller passes a converted list):"))
+	for _, u := range unhandled {
+		fmt.Printf("%s  %s (.%s): %s is %s\n", indent, u.Define, u.Key, u.Arg, u.Reason)
+	}
+}
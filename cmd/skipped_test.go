@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExplainSkippedPath(t *testing.T) {
+	chart := t.TempDir()
+	tpl := `spec:
+  containers:
+    - name: app
+      volumeMounts:
+        {{- toYaml .Values.volumeMounts }}
+  {{- if .Values.volumes }}
+  volumes:
+    {{- tpl (toYaml .Values.volumes) . | nindent 4 }}
+  {{- end }}
+  ports:
+    - containerPort: 80
+    {{- toYaml .Values.ports | nindent 4 }}
+  hostAliases: {{ concat .Values.hostAliases (list) | toYaml | nindent 4 }}
+`
+	if err := os.MkdirAll(filepath.Join(chart, "templates"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(chart, "templates", "deployment.yaml"), []byte(tpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path   string
+		line   int
+		reason string
+	}{
+		{"volumeMounts", 5, "toYaml without an indent or nindent pipe"},
+		{"volumes", 8, "values rendered through tpl"},
+		{"ports", 12, "static list entries combined with toYaml (inline append)"},
+		{"hostAliases", 13, "list built with concat/append"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			usages := explainSkippedPath(chart, tt.path)
+			if len(usages) != 1 {
+				t.Fatalf("explainSkippedPath(%q) returned %d usages, want 1: %+v", tt.path, len(usages), usages)
+			}
+			u := usages[0]
+			if u.TemplateFile != "templates/deployment.yaml" || u.LineNumber != tt.line {
+				t.Errorf("location = %s:%d, want templates/deployment.yaml:%d", u.TemplateFile, u.LineNumber, tt.line)
+			}
+			if u.Reason != tt.reason {
+				t.Errorf("reason = %q, want %q", u.Reason, tt.reason)
+			}
+			if !strings.Contains(strings.Join(u.Frame, "\n"), "> ") {
+				t.Errorf("frame should mark the usage line:\n%s", strings.Join(u.Frame, "\n"))
+			}
+		})
+	}
+}
+
+func TestCodeFrame(t *testing.T) {
+	t.Parallel()
+
+	lines := strings.Split("a\nb\nc\nd", "\n")
+	got := codeFrame(lines, 0, 1)
+	want := []string{"> 1 | a", "  2 | b"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("codeFrame() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Subdirectories of --snapshot-dir holding each render
+const (
+	snapshotBefore = "before"
+	snapshotAfter  = "after"
+)
+
+// runConvertWithSnapshots renders the chart before and after converting it and
+// saves both renders under opts.SnapshotDir for review. The render before is
+// saved as soon as it's made, and the after/ of an earlier snapshot removed,
+// so a conversion that fails still leaves it to compare against.
+func runConvertWithSnapshots(opts ConvertOptions) error {
+	if opts.DryRun {
+		return fmt.Errorf("--snapshot-dir cannot be combined with --dry-run")
+	}
+	root, err := findChartRoot(opts.ChartDir)
+	if err != nil {
+		return err
+	}
+	dir := opts.SnapshotDir
+	opts.SnapshotDir = ""
+
+	before, err := renderManifests(root)
+	if err != nil {
+		return fmt.Errorf("rendering chart before converting: %w", err)
+	}
+	if err := writeSnapshot(filepath.Join(dir, snapshotBefore), before); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(dir, snapshotAfter)); err != nil {
+		return fmt.Errorf("clearing snapshot: %w", err)
+	}
+	if err := runConvert(opts); err != nil {
+		fmt.Printf("\nRendered manifests before converting saved to %s\n", filepath.Join(dir, snapshotBefore))
+		return err
+	}
+	after, err := renderManifests(root)
+	if err != nil {
+		fmt.Printf("\nRendered manifests before converting saved to %s\n", filepath.Join(dir, snapshotBefore))
+		return fmt.Errorf("rendering chart after converting: %w", err)
+	}
+	if err := writeSnapshot(filepath.Join(dir, snapshotAfter), after); err != nil {
+		return err
+	}
+
+	changed := changedManifests(before, after)
+	fmt.Printf("\nRendered manifests saved to %s (%s/ and %s/)\n", dir, snapshotBefore, snapshotAfter)
+	if len(changed) == 0 {
+		fmt.Println("  " + green("Renders are identical."))
+		return nil
+	}
+	fmt.Println("  " + yellow(fmt.Sprintf("%d of %d manifest file(s) render differently:", len(changed), len(after))))
+	for _, name := range changed {
+		fmt.Printf("    %s\n", name)
+	}
+	fmt.Printf("  Review with: diff -r %s %s\n", filepath.Join(dir, snapshotBefore), filepath.Join(dir, snapshotAfter))
+	return nil
+}
+
+// renderManifests renders the chart with its default values, and any values
+// files over them, using helm template, split by source template into
+// chart-relative file names. The helm binary is run, as for every helm call,
+// so renders match what the user's helm produces.
+func renderManifests(root string, valuesFiles ...string) (map[string]string, error) {
+	defer metrics.phase(phaseRender, time.Now())
+	args := []string{"template", chartName(root), root}
+	for _, f := range valuesFiles {
+		args = append(args, "-f", f)
+	}
+	cmd, err := helmCommand(args...)
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("helm template: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return splitManifests(string(out)), nil
+}
+
+// splitManifests groups the documents of a helm template render by their
+// "# Source:" comment. Documents without one are kept under "manifests.yaml".
+func splitManifests(render string) map[string]string {
+	docs := make(map[string][]string)
+	for _, doc := range strings.Split("\n"+render, "\n---") {
+		doc = strings.Trim(doc, "\n")
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		name := "manifests.yaml"
+		first, _, _ := strings.Cut(doc, "\n")
+		if source, ok := strings.CutPrefix(first, "# Source: "); ok {
+			name = filepath.Clean(strings.TrimSpace(source))
+		}
+		docs[name] = append(docs[name], doc)
+	}
+
+	files := make(map[string]string, len(docs))
+	for name, d := range docs {
+		files[name] = "---\n" + strings.Join(d, "\n---\n") + "\n"
+	}
+	return files
+}
+
+// writeSnapshot replaces dir with the rendered files
+func writeSnapshot(dir string, files map[string]string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("clearing snapshot: %w", err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if !strings.HasPrefix(path, filepath.Clean(dir)+string(filepath.Separator)) {
+			return fmt.Errorf("manifest source %q escapes the snapshot directory", name)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("writing snapshot: %w", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return fmt.Errorf("writing snapshot: %w", err)
+		}
+	}
+	return nil
+}
+
+// changedManifests returns the sorted names of files that differ between renders
+func changedManifests(before, after map[string]string) []string {
+	var changed []string
+	for name, content := range after {
+		if before[name] != content {
+			changed = append(changed, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
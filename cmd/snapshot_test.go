@@ -0,0 +1,163 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+// fakeHelmTemplate installs a helm stand-in whose template render includes
+// the chart's values.yaml, so converting the chart changes the render
+func fakeHelmTemplate(t *testing.T) {
+	t.Helper()
+	script := `#!/bin/sh
+printf -- '---\n# Source: basic/templates/service.yaml\nkind: Service\n'
+printf -- '---\n# Source: basic/templates/values.yaml\n'
+cat "$3/values.yaml"
+`
+	bin := filepath.Join(t.TempDir(), "helm")
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HELM_BIN", bin)
+}
+
+func TestConvertSnapshotDir(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	fakeHelmTemplate(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	snapshots := filepath.Join(t.TempDir(), "snapshots")
+	// Stale files from an earlier snapshot are removed
+	stale := filepath.Join(snapshots, snapshotAfter, "basic", "templates", "old.yaml")
+	if err := os.MkdirAll(filepath.Dir(stale), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stale, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak", SnapshotDir: snapshots})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "1 of 2 manifest file(s) render differently") ||
+		!strings.Contains(output, "basic/templates/values.yaml") {
+		t.Errorf("output should list the changed manifest\nGot:\n%s", output)
+	}
+
+	read := func(stage, name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(snapshots, stage, "basic", "templates", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if before, after := read(snapshotBefore, "service.yaml"), read(snapshotAfter, "service.yaml"); before != after {
+		t.Errorf("service.yaml renders differ:\n%s\n%s", before, after)
+	}
+	if before := read(snapshotBefore, "values.yaml"); !strings.Contains(before, "- name: DB_HOST") {
+		t.Errorf("before render should hold the list values:\n%s", before)
+	}
+	if after := read(snapshotAfter, "values.yaml"); !strings.Contains(after, "DB_HOST:") {
+		t.Errorf("after render should hold the map values:\n%s", after)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale snapshot file was kept")
+	}
+}
+
+func TestConvertSnapshotDirConvertFails(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	fakeHelmTemplate(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	// A differing helper define stops the conversion after the first render
+	writeChartFiles(t, chartPath, map[string]string{
+		"templates/_helpers.tpl": "{{- define \"chart.listmap.items\" -}}{{- end -}}\n",
+	})
+	snapshots := filepath.Join(t.TempDir(), "snapshots")
+	stale := filepath.Join(snapshots, snapshotAfter, "basic", "templates", "values.yaml")
+	writeChartFiles(t, snapshots, map[string]string{filepath.Join(snapshotAfter, "basic", "templates", "values.yaml"): "old"})
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak", SnapshotDir: snapshots})
+	})
+	if err == nil || !strings.Contains(err.Error(), "helperName") {
+		t.Fatalf("runConvert() error = %v, want a helper collision\nOutput: %s", err, output)
+	}
+	if _, err := os.Stat(filepath.Join(snapshots, snapshotBefore, "basic", "templates", "values.yaml")); err != nil {
+		t.Errorf("render before converting should be saved: %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("after/ of an earlier snapshot should be removed")
+	}
+	if !strings.Contains(output, "before converting saved to") {
+		t.Errorf("output should point at the saved render\nGot:\n%s", output)
+	}
+}
+
+func TestConvertSnapshotDirRejectsDryRun(t *testing.T) {
+	err := runConvert(ConvertOptions{ChartDir: "testdata/charts/basic", DryRun: true, SnapshotDir: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "--dry-run") {
+		t.Errorf("runConvert() error = %v, want --dry-run conflict", err)
+	}
+}
+
+func TestSplitManifests(t *testing.T) {
+	render := `---
+# Source: app/templates/service.yaml
+kind: Service
+---
+# Source: app/templates/deployment.yaml
+kind: Deployment
+metadata:
+  name: a
+---
+# Source: app/templates/deployment.yaml
+kind: Deployment
+metadata:
+  name: b
+---
+kind: ConfigMap
+`
+	got := splitManifests(render)
+	want := map[string]string{
+		"app/templates/service.yaml":    "---\n# Source: app/templates/service.yaml\nkind: Service\n",
+		"app/templates/deployment.yaml": "---\n# Source: app/templates/deployment.yaml\nkind: Deployment\nmetadata:\n  name: a\n---\n# Source: app/templates/deployment.yaml\nkind: Deployment\nmetadata:\n  name: b\n",
+		"manifests.yaml":                "---\nkind: ConfigMap\n",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("splitManifests() =\n%#v\nwant\n%#v", got, want)
+	}
+}
+
+// TestConvertSnapshotDirWithoutHelm tests that a missing helm binary stops
+// the conversion before the chart is changed
+func TestConvertSnapshotDirWithoutHelm(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	t.Setenv("HELM_BIN", filepath.Join(t.TempDir(), "helm"))
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	before, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+
+	_, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak", SnapshotDir: t.TempDir()})
+	})
+	if err == nil || !strings.Contains(err.Error(), "not found: install helm or set HELM_BIN") {
+		t.Errorf("runConvert() error = %v, want helm not found", err)
+	}
+	if after, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml")); string(after) != string(before) {
+		t.Error("values.yaml should not be converted without a render to compare")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// runSnapshotTest converts a temporary copy of the chart, renders it, and
+// compares the render against the golden manifests, failing on any drift.
+// With --update, the golden manifests are written from the chart as it is, so
+// later runs check that converting it doesn't change what it renders.
+func runSnapshotTest(opts SnapshotTestOptions) error {
+	if opts.Golden == "" {
+		return fmt.Errorf("--golden is required")
+	}
+	root, err := findChartRoot(opts.ChartDir)
+	if err != nil {
+		return err
+	}
+
+	if opts.Update {
+		files, err := renderManifests(root)
+		if err != nil {
+			return err
+		}
+		if err := writeSnapshot(opts.Golden, files); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %d golden manifest file(s) to %s\n", len(files), opts.Golden)
+		return nil
+	}
+
+	golden, err := readSnapshot(opts.Golden)
+	if err != nil {
+		return err
+	}
+	if len(golden) == 0 {
+		return fmt.Errorf("no golden manifests in %s: write them with --update", opts.Golden)
+	}
+
+	tmp, err := os.MkdirTemp("", "list-to-map-snapshot-test-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+	chartCopy := filepath.Join(tmp, filepath.Base(root))
+	if err := copyDir(root, chartCopy); err != nil {
+		return fmt.Errorf("copying chart: %w", err)
+	}
+
+	fmt.Printf("Converting a copy of %s\n", root)
+	if err := runConvert(ConvertOptions{
+		ChartDir:     chartCopy,
+		BackupExt:    ".bak",
+		KubeVersion:  opts.KubeVersion,
+		SchemaSource: opts.SchemaSource,
+	}); err != nil {
+		return fmt.Errorf("converting: %w", err)
+	}
+	rendered, err := renderManifests(chartCopy)
+	if err != nil {
+		return fmt.Errorf("rendering converted chart: %w", err)
+	}
+
+	drifted := changedManifests(golden, rendered)
+	fmt.Println()
+	if len(drifted) == 0 {
+		fmt.Println(green(fmt.Sprintf("Converted chart renders the %d golden manifest file(s) in %s.", len(golden), opts.Golden)))
+		return nil
+	}
+	for _, name := range drifted {
+		fmt.Printf("\n=== %s (golden drift) ===\n", name)
+		printHunks(name, golden[name], rendered[name])
+	}
+	return fmt.Errorf("%d manifest file(s) drifted from the golden manifests in %s", len(drifted), opts.Golden)
+}
+
+// readSnapshot reads the manifest files of a snapshot directory, keyed by
+// their path in it, as written by writeSnapshot
+func readSnapshot(dir string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[rel] = string(data)
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no golden manifests in %s: write them with --update", dir)
+	}
+	return files, err
+}
+
+// copyDir copies the files under src to dst, keeping their modes
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, info.Mode().Perm())
+	})
+}
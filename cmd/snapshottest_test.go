@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+func TestSnapshotTest(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	fakeHelmTemplate(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	golden := filepath.Join(t.TempDir(), "golden")
+
+	if _, err := captureOutput(t, func() error {
+		return runSnapshotTest(SnapshotTestOptions{ChartDir: chartPath, Golden: golden})
+	}); err == nil || !strings.Contains(err.Error(), "--update") {
+		t.Errorf("expected missing golden manifests to point at --update, got %v", err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runSnapshotTest(SnapshotTestOptions{ChartDir: chartPath, Golden: golden, Update: true})
+	})
+	if err != nil {
+		t.Fatalf("runSnapshotTest --update failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "Wrote 2 golden manifest file(s)") {
+		t.Errorf("output should report the golden files written, got:\n%s", output)
+	}
+	if data, err := os.ReadFile(filepath.Join(golden, "basic", "templates", "values.yaml")); err != nil || !strings.Contains(string(data), "- name: DB_HOST") {
+		t.Errorf("golden render should be taken from the unconverted chart: %v\n%s", err, data)
+	}
+
+	// The stand-in renders values.yaml, so converting it drifts
+	output, err = captureOutput(t, func() error {
+		return runSnapshotTest(SnapshotTestOptions{ChartDir: chartPath, Golden: golden})
+	})
+	if err == nil || !strings.Contains(err.Error(), "1 manifest file(s) drifted") {
+		t.Fatalf("expected drift from the golden manifests, got %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "=== basic/templates/values.yaml (golden drift) ===") || !strings.Contains(output, "-  - name: DB_HOST") {
+		t.Errorf("output should show the drifted manifest as a diff, got:\n%s", output)
+	}
+	if strings.Contains(output, "basic/templates/service.yaml (golden drift)") {
+		t.Errorf("unchanged manifests should not be reported, got:\n%s", output)
+	}
+	values, err := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(values), "- name: DB_HOST") {
+		t.Error("the chart itself should not be converted")
+	}
+}
+
+func TestSnapshotTestMatchesGolden(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	// A render that doesn't depend on the shape of the values
+	script := "#!/bin/sh\nprintf -- '---\\n# Source: basic/templates/service.yaml\\nkind: Service\\n'\n"
+	bin := filepath.Join(t.TempDir(), "helm")
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HELM_BIN", bin)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	golden := filepath.Join(t.TempDir(), "golden")
+	if _, err := captureOutput(t, func() error {
+		return runSnapshotTest(SnapshotTestOptions{ChartDir: chartPath, Golden: golden, Update: true})
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runSnapshotTest(SnapshotTestOptions{ChartDir: chartPath, Golden: golden})
+	})
+	if err != nil {
+		t.Fatalf("runSnapshotTest failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "Converted chart renders the 1 golden manifest file(s)") {
+		t.Errorf("output should report a match, got:\n%s", output)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/template"
+)
+
+// Categories of list usages that convert leaves as lists
+const (
+	skipTemplate = "template" // rendered by a template pattern the rewriter can't handle
+	skipShared   = "shared"   // shared through a YAML merge key or alias
+	skipIgnored  = "ignored"  // excluded by ignore config or opt-out comments
+	skipMinItems = "minItems" // fewer items than minItems
+	skipAsk      = "ask"      // awaiting confirmation under the typePolicy
+	skipConflict = "conflict" // rendered into resource fields that disagree on the merge key
+)
+
+// chartStats is the map-readiness of one chart
+type chartStats struct {
+	Chart       string         `json:"chart"`
+	Path        string         `json:"path"`
+	Usages      int            `json:"usages"`      // list-rendering usages found
+	Converted   int            `json:"converted"`   // rendered through the list-map helper
+	Convertible int            `json:"convertible"` // convert would change them
+	Skipped     map[string]int `json:"skipped"`     // left as lists, by category
+	Readiness   float64        `json:"readiness"`   // percent of the usages that should be maps and are
+}
+
+func runStats(opts StatsOptions) error {
+	charts := opts.Charts
+	if len(charts) == 0 {
+		charts = []string{"."}
+	}
+	if opts.Output != "text" && opts.Output != "json" {
+		return fmt.Errorf("invalid --output %q: want text or json", opts.Output)
+	}
+
+	var all []chartStats
+	for _, dir := range charts {
+		root, err := findChartRoot(dir)
+		if err != nil {
+			return err
+		}
+		s, err := collectChartStats(root)
+		if err != nil {
+			return fmt.Errorf("%s: %w", root, err)
+		}
+		all = append(all, s)
+	}
+
+	if opts.Output == "json" {
+		return writeStatsJSON(os.Stdout, all)
+	}
+	printStats(os.Stdout, all)
+	return nil
+}
+
+// collectChartStats counts the list usages of the chart at root by how far
+// along their conversion is
+func collectChartStats(root string) (chartStats, error) {
+	// Apply the chart's own config over the user config
+	restore, err := useChartConfig(root)
+	defer restore()
+	if err != nil {
+		return chartStats{}, err
+	}
+	restoreSchema, err := useSchemas("", false)
+	defer restoreSchema()
+	if err != nil {
+		return chartStats{}, err
+	}
+
+	collected, err := collectConvertCandidates(root)
+	if err != nil {
+		return chartStats{}, err
+	}
+
+	s := chartStats{
+		Chart:   chartName(root),
+		Path:    root,
+		Skipped: make(map[string]int),
+	}
+
+	candidates := make(map[string]k8s.DetectedCandidate, len(collected.Matched))
+	for _, c := range collected.Matched {
+		candidates[c.ValuesPath] = c
+	}
+	if doc, _, err := loadValuesNode(filepath.Join(root, "values.yaml")); err == nil {
+		kept, _ := withoutMergedLists(doc, candidates)
+		s.Skipped[skipShared] = len(candidates) - len(kept)
+		candidates = kept
+	} else if !os.IsNotExist(err) {
+		return chartStats{}, err
+	}
+
+	// Paths rendered through the helper are converted, unless their values
+	// are lists again and convert would repair them
+	for _, p := range template.ConvertedPaths(root) {
+		if _, pending := candidates[p.DotPath]; !pending {
+			s.Converted++
+		}
+	}
+	s.Convertible = len(candidates)
+	s.Skipped[skipTemplate] = len(collected.Skipped)
+	s.Skipped[skipIgnored] = len(collected.Ignored)
+	s.Skipped[skipMinItems] = len(collected.BelowMinItems)
+	s.Skipped[skipAsk] = len(collected.Ask)
+	s.Skipped[skipConflict] = len(collected.Conflicts)
+	for category, n := range s.Skipped {
+		if n == 0 {
+			delete(s.Skipped, category)
+		}
+	}
+
+	s.score()
+	return s, nil
+}
+
+// score sets the usage total and readiness from the counts
+func (s *chartStats) score() {
+	s.Usages = s.Converted + s.Convertible
+	for _, n := range s.Skipped {
+		s.Usages += n
+	}
+
+	// Ignored, small, and unconfirmed lists are kept as lists on purpose
+	target := s.Converted + s.Convertible + s.Skipped[skipTemplate] + s.Skipped[skipShared] + s.Skipped[skipConflict]
+	s.Readiness = 100
+	if target > 0 {
+		s.Readiness = math.Round(float64(s.Converted)/float64(target)*1000) / 10
+	}
+}
+
+// totalStats sums the counts of several charts
+func totalStats(all []chartStats) chartStats {
+	total := chartStats{Chart: "Total", Path: fmt.Sprintf("%d charts", len(all)), Skipped: make(map[string]int)}
+	for _, s := range all {
+		total.Converted += s.Converted
+		total.Convertible += s.Convertible
+		for category, n := range s.Skipped {
+			total.Skipped[category] += n
+		}
+	}
+	total.score()
+	return total
+}
+
+// writeStatsJSON writes the stats of every chart as one JSON document
+func writeStatsJSON(w io.Writer, all []chartStats) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Charts []chartStats `json:"charts"`
+	}{all})
+}
+
+// printStats prints the stats of every chart, and totals for several charts
+func printStats(w io.Writer, all []chartStats) {
+	if len(all) > 1 {
+		all = append(all, totalStats(all))
+	}
+	for i, s := range all {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s (%s)\n", s.Chart, s.Path)
+		fmt.Fprintf(w, "  List usages:    %d\n", s.Usages)
+		fmt.Fprintf(w, "  Converted:      %d\n", s.Converted)
+		fmt.Fprintf(w, "  Convertible:    %d\n", s.Convertible)
+		skipped := 0
+		for _, n := range s.Skipped {
+			skipped += n
+		}
+		fmt.Fprintf(w, "  Skipped:        %d\n", skipped)
+		categories := make([]string, 0, len(s.Skipped))
+		for category := range s.Skipped {
+			categories = append(categories, category)
+		}
+		sort.Strings(categories)
+		for _, category := range categories {
+			fmt.Fprintf(w, "    %-13s %d\n", category+":", s.Skipped[category])
+		}
+		fmt.Fprintf(w, "  Map readiness:  %s\n", readinessColor(s.Readiness)(fmt.Sprintf("%.1f%%", s.Readiness)))
+	}
+}
+
+// readinessColor returns the color for a readiness percentage
+func readinessColor(readiness float64) func(string) string {
+	switch {
+	case readiness == 100:
+		return green
+	case readiness >= 50:
+		return yellow
+	}
+	return red
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+func TestCollectChartStats(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	// Keep volumes as a list on purpose, and share volumeMounts through an alias
+	values, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	values = []byte(strings.Replace(string(values), "volumes:", "volumes: # list-to-map: ignore", 1))
+	values = []byte(strings.Replace(string(values), "volumeMounts:", "volumeMounts: &mounts", 1) + "sidecar:\n  volumeMounts: *mounts\n")
+	if err := os.WriteFile(filepath.Join(chartPath, "values.yaml"), values, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := collectChartStats(chartPath)
+	if err != nil {
+		t.Fatalf("collectChartStats() error = %v", err)
+	}
+	want := chartStats{
+		Chart:       "basic",
+		Path:        chartPath,
+		Usages:      3,
+		Convertible: 1,
+		Skipped:     map[string]int{skipShared: 1, skipIgnored: 1},
+		Readiness:   0,
+	}
+	if !reflect.DeepEqual(before, want) {
+		t.Errorf("before convert: got %+v, want %+v", before, want)
+	}
+
+	if _, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	}); err != nil {
+		t.Fatalf("runConvert failed: %v", err)
+	}
+
+	after, err := collectChartStats(chartPath)
+	if err != nil {
+		t.Fatalf("collectChartStats() error = %v", err)
+	}
+	want.Converted, want.Convertible, want.Readiness = 1, 0, 50
+	if !reflect.DeepEqual(after, want) {
+		t.Errorf("after convert: got %+v, want %+v", after, want)
+	}
+}
+
+func TestRunStatsJSON(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	output, err := captureOutput(t, func() error {
+		return runStats(StatsOptions{Charts: []string{chartPath}, Output: "json"})
+	})
+	if err != nil {
+		t.Fatalf("runStats() error = %v", err)
+	}
+
+	var got struct {
+		Charts []chartStats `json:"charts"`
+	}
+	if err := json.Unmarshal([]byte(output), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, output)
+	}
+	if len(got.Charts) != 1 || got.Charts[0].Convertible != 3 || got.Charts[0].Readiness != 0 {
+		t.Errorf("runStats() = %+v, want 3 convertible usages at 0%% readiness", got.Charts)
+	}
+}
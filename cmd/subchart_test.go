@@ -650,3 +650,66 @@ func TestN3MIX_ThreeLevelNesting(t *testing.T) {
 
 	t.Log("Three-level nesting test infrastructure verified")
 }
+
+// TestAliasedDependencyConvertedOnce tests a chart listed twice under
+// aliases: it is converted once, and the umbrella values under both aliases
+func TestAliasedDependencyConvertedOnce(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	workerPath := copyChartForTest(t, "testdata/charts/basic")
+	umbrellaPath := t.TempDir()
+	workerRel, err := filepath.Rel(umbrellaPath, workerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chartYaml := `apiVersion: v2
+name: umbrella
+version: 1.0.0
+dependencies:
+  - name: basic
+    alias: email
+    repository: file://` + workerRel + `
+  - name: basic
+    alias: reports
+    repository: file://` + workerRel + `
+`
+	values := `email:
+  env:
+    - name: QUEUE
+      value: email
+reports:
+  env:
+    - name: QUEUE
+      value: reports
+`
+	if err := os.WriteFile(filepath.Join(umbrellaPath, "Chart.yaml"), []byte(chartYaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(umbrellaPath, "values.yaml"), []byte(values), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: umbrellaPath, Recursive: true, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\n%s", err, out)
+	}
+	if n := strings.Count(out, "=== Converting subchart:"); n != 1 {
+		t.Errorf("the chart should be converted once, got %d times:\n%s", n, out)
+	}
+	if !strings.Contains(out, "email [file://] (also as reports)") || !strings.Contains(out, "Subcharts converted: 1\n") {
+		t.Errorf("output should list the chart once with its alias, got:\n%s", out)
+	}
+
+	umbrellaValues, err := os.ReadFile(filepath.Join(umbrellaPath, "values.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"QUEUE:\n      value: email", "QUEUE:\n      value: reports"} {
+		if !strings.Contains(string(umbrellaValues), want) {
+			t.Errorf("umbrella values should contain %q, got:\n%s", want, umbrellaValues)
+		}
+	}
+}
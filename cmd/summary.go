@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Levels of the summary convert ends with, set by --summary
+const (
+	summaryShort = "short" // counts and the commands to run next
+	summaryFull  = "full"  // also the changed files and each warning
+	summaryNone  = "none"
+)
+
+// convertSummary collects what a convert run changed and warned about, for
+// the summary it ends with. Like convertMetrics, its methods do nothing on a
+// nil receiver, so conversion code records into it unconditionally.
+type convertSummary struct {
+	Level    string
+	Chart    string          // the chart as the user named it, for the next commands
+	DryRun   bool            // nothing was written
+	Root     string          // root of the chart converted, which files are shown relative to
+	Verify   string          // flags verify needs beyond the chart, to find what it was before
+	Files    map[string]bool // files changed, or that would be with --dry-run
+	Warnings []string
+}
+
+// summary collects the current convert run's summary, if it prints one
+var summary *convertSummary
+
+// runConvertWithSummary runs the conversion and ends it with a summary of
+// what changed, the warnings printed along the way, and what to run next.
+// Counts come from the run's metrics, collected for the summary if they
+// aren't written to a file.
+func runConvertWithSummary(opts ConvertOptions) error {
+	switch opts.Summary {
+	case summaryShort, summaryFull:
+	case summaryNone:
+		opts.Summary = ""
+		return runConvert(opts)
+	default:
+		return fmt.Errorf("invalid --summary %q: want %s, %s, or %s", opts.Summary, summaryShort, summaryFull, summaryNone)
+	}
+	summary = &convertSummary{Level: opts.Summary, Chart: opts.ChartDir, DryRun: opts.DryRun, Files: make(map[string]bool)}
+	if opts.BackupExt != "" && opts.BackupExt != ".bak" {
+		summary.Verify = " --backup-ext " + opts.BackupExt
+	}
+	defer func() { summary = nil }()
+	if metrics == nil {
+		metrics = &convertMetrics{Skipped: make(map[string]int), Phases: make(map[string]float64)}
+		defer func() { metrics = nil }()
+	}
+
+	err := runConvert(opts)
+	// A failed run is summarized only if it got as far as converting something
+	if err == nil || metrics.Converted > 0 {
+		summary.print(metrics)
+	}
+	return err
+}
+
+// warnf prints a warning to stderr, and records it for the summary
+func warnf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	fmt.Fprintf(os.Stderr, "Warning: %s\n", msg)
+	summary.warn(msg)
+}
+
+// warn records a warning already printed
+func (s *convertSummary) warn(msg string) {
+	if s != nil {
+		s.Warnings = append(s.Warnings, msg)
+	}
+}
+
+// at sets the chart the next commands are run on, once it's known, e.g.
+// where a chart reference was pulled to
+func (s *convertSummary) at(chart string) {
+	if s != nil {
+		s.Chart = chart
+	}
+}
+
+// root sets the root of the chart converted, once
+func (s *convertSummary) root(root string) {
+	if s != nil && s.Root == "" {
+		s.Root = root
+	}
+}
+
+// file records a file the conversion changed, or would change
+func (s *convertSummary) file(path string) {
+	if s != nil {
+		s.Files[path] = true
+	}
+}
+
+// print prints the summary with the counts of m
+func (s *convertSummary) print(m *convertMetrics) {
+	skipped := 0
+	for _, n := range m.Skipped {
+		skipped += n
+	}
+	files := make([]string, 0, len(s.Files))
+	for f := range s.Files {
+		if r, err := filepath.Rel(s.Root, f); err == nil && s.Root != "" {
+			f = r
+		}
+		files = append(files, filepath.ToSlash(f))
+	}
+	sort.Strings(files)
+
+	fmt.Println("\n=== Summary ===")
+	converted := "Converted:"
+	if s.DryRun {
+		converted = "Would convert:"
+	}
+	fmt.Printf("%-15s %d path(s) in %d file(s)\n", converted, m.Converted, len(files))
+	if s.Level == summaryFull {
+		for _, f := range files {
+			fmt.Printf("  %s\n", f)
+		}
+	}
+	if skipped > 0 {
+		fmt.Printf("%-15s %d path(s)\n", "Left as lists:", skipped)
+	}
+	if m.ParseErrors > 0 {
+		fmt.Printf("%-15s %d file(s)\n", "Not parsed:", m.ParseErrors)
+	}
+	if m.FailedCharts > 0 {
+		fmt.Printf("%-15s %d chart(s)\n", "Failed:", m.FailedCharts)
+	}
+	switch {
+	case len(s.Warnings) == 0:
+		fmt.Printf("%-15s 0\n", "Warnings:")
+	case s.Level == summaryFull:
+		fmt.Printf("%-15s %s\n", "Warnings:", yellow(fmt.Sprint(len(s.Warnings))))
+		for _, w := range s.Warnings {
+			fmt.Printf("  %s\n", w)
+		}
+	default:
+		fmt.Printf("%-15s %s (--summary=full lists them)\n", "Warnings:", yellow(fmt.Sprint(len(s.Warnings))))
+	}
+
+	if next := s.next(m); len(next) > 0 {
+		fmt.Println("Next:")
+		for _, cmd := range next {
+			fmt.Printf("  %s\n", cmd)
+		}
+	}
+}
+
+// next returns the commands to run after the conversion: rebuilding the
+// packaged dependencies of a chart that has them, linting, and checking that
+// consumers' overrides still render the same
+func (s *convertSummary) next(m *convertMetrics) []string {
+	if m.Converted == 0 {
+		return nil
+	}
+	if s.DryRun {
+		return []string{"rerun without --dry-run to apply the changes"}
+	}
+	chart := s.Chart
+	if strings.ContainsAny(chart, " \t'\"") {
+		chart = fmt.Sprintf("%q", chart)
+	}
+	var next []string
+	if hasDependencies(s.Chart) {
+		next = append(next, "helm dependency build "+chart)
+	}
+	return append(next,
+		"helm lint "+chart,
+		"helm list-to-map verify --chart "+chart+s.Verify,
+	)
+}
+
+// hasDependencies reports whether the chart's Chart.yaml lists dependencies
+func hasDependencies(chart string) bool {
+	root, err := findChartRoot(chart)
+	if err != nil {
+		return false
+	}
+	data, err := os.ReadFile(filepath.Join(root, "Chart.yaml"))
+	if err != nil {
+		return false
+	}
+	var c ChartYAML
+	return yaml.Unmarshal(data, &c) == nil && len(c.Dependencies) > 0
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+func TestConvertSummary(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	notes := "Env vars: {{ len .Values.env }}\n"
+	tests := []struct {
+		name      string
+		chart     string
+		opts      ConvertOptions
+		want      []string
+		wantNot   []string
+		wantError bool
+	}{
+		{
+			name:  "short",
+			chart: "testdata/charts/basic",
+			opts:  ConvertOptions{Summary: summaryShort},
+			want: []string{
+				"=== Summary ===",
+				"Converted:      3 path(s) in 3 file(s)\n",
+				"Warnings:       1 (--summary=full lists them)\n",
+				"Next:\n  helm lint CHART\n  helm list-to-map verify --chart CHART\n",
+			},
+			wantNot: []string{"  values.yaml\n", "helm dependency build"},
+		},
+		{
+			name:  "full",
+			chart: "testdata/charts/basic",
+			opts:  ConvertOptions{Summary: summaryFull},
+			want: []string{
+				"Converted:      3 path(s) in 3 file(s)\n  templates/_listmap.tpl\n  templates/deployment.yaml\n  values.yaml\n",
+				"Warnings:       1\n  templates/NOTES.txt:1: env (NOTES.txt is never rewritten); update it by hand\n",
+			},
+		},
+		{
+			name:    "dry run",
+			chart:   "testdata/charts/basic",
+			opts:    ConvertOptions{Summary: summaryShort, DryRun: true},
+			want:    []string{"Would convert:  3 path(s) in 3 file(s)\n", "Next:\n  rerun without --dry-run to apply the changes\n"},
+			wantNot: []string{"helm lint"},
+		},
+		{
+			name:    "none",
+			chart:   "testdata/charts/basic",
+			opts:    ConvertOptions{Summary: summaryNone},
+			wantNot: []string{"=== Summary ==="},
+		},
+		{
+			name:  "umbrella with dependencies",
+			chart: "testdata/charts/umbrella",
+			opts:  ConvertOptions{Summary: summaryShort, Recursive: true},
+			want: []string{
+				"Converted:      2 path(s) in 4 file(s)\n",
+				"Next:\n  helm dependency build CHART\n  helm lint CHART\n",
+			},
+		},
+		{
+			name:      "invalid",
+			chart:     "testdata/charts/basic",
+			opts:      ConvertOptions{Summary: "long"},
+			wantNot:   []string{"=== Summary ==="},
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chartPath := copyChartForTest(t, tt.chart)
+			if err := os.WriteFile(filepath.Join(chartPath, "templates", "NOTES.txt"), []byte(notes), 0644); err != nil {
+				t.Fatal(err)
+			}
+			opts := tt.opts
+			opts.ChartDir = chartPath
+			opts.BackupExt = ".bak"
+			out, err := captureOutput(t, func() error { return runConvert(opts) })
+			if (err != nil) != tt.wantError {
+				t.Fatalf("runConvert() error = %v, wantError %v\n%s", err, tt.wantError, out)
+			}
+			for _, want := range tt.want {
+				want = strings.ReplaceAll(want, "CHART", chartPath)
+				if !strings.Contains(out, want) {
+					t.Errorf("output should contain %q, got:\n%s", want, out)
+				}
+			}
+			for _, unwanted := range tt.wantNot {
+				if strings.Contains(out, unwanted) {
+					t.Errorf("output should not contain %q, got:\n%s", unwanted, out)
+				}
+			}
+			if summary != nil || metrics != nil {
+				t.Error("the summary and metrics should stop being collected after the run")
+			}
+		})
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/transform"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	tfReleaseRe  = regexp.MustCompile(`^\s*resource\s+"helm_release"\s+"([^"]+)"`)
+	tfChartRe    = regexp.MustCompile(`^\s*chart\s*=\s*"([^"]*)"`)
+	tfValuesRe   = regexp.MustCompile(`^\s*values\s*=`)
+	tfHeredocRe  = regexp.MustCompile(`<<(-?)([A-Za-z_][A-Za-z0-9_]*)\s*$`)
+	tfFileRe     = regexp.MustCompile(`\bfile\(\s*"([^"]+)"\s*\)`)
+	tfVarRe      = regexp.MustCompile(`\bvar\.([A-Za-z_][A-Za-z0-9_-]*)`)
+	tfSetNameRe  = regexp.MustCompile(`^\s*name\s*=\s*"([^"]+)"`)
+	tfTfvarsRe   = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_-]*)\s*=\s*<<-?[A-Za-z_][A-Za-z0-9_]*\s*$`)
+	tfModulePath = strings.NewReplacer("${path.module}/", "", "${path.root}/", "")
+)
+
+// tfReplacement replaces lines [Start, End) of a Terraform file
+type tfReplacement struct {
+	Start, End int
+	Lines      []string
+}
+
+// tfFile is a Terraform file being migrated
+type tfFile struct {
+	Path         string
+	Lines        []string
+	Replacements []tfReplacement
+}
+
+func runConvertTerraform(opts ConvertTerraformOptions) error {
+	if opts.File == "" || opts.Chart == "" {
+		return fmt.Errorf("--file and --chart are required")
+	}
+
+	root, cleanup, err := resolveChartRef(opts.Chart, opts.Version)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	candidates, err := chartConversionCandidates(root)
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		fmt.Printf("No convertible or converted list paths found in chart %s.\n", opts.Chart)
+		return nil
+	}
+
+	files, err := terraformPaths(opts.File)
+	if err != nil {
+		return err
+	}
+
+	m := &deployMigration{
+		Chart:      chartName(root),
+		Candidates: candidates,
+		DryRun:     opts.DryRun,
+		BackupExt:  opts.BackupExt,
+		Done:       make(map[string]bool),
+	}
+	if err := m.migrateTerraform(files); err != nil {
+		return err
+	}
+
+	m.printManual()
+	return nil
+}
+
+// terraformPaths returns path itself, or the .tf and .tfvars files below path
+// if it is a directory, in path order
+func terraformPaths(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" || d.Name() == ".terraform" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(p, ".tf") || strings.HasSuffix(p, ".tfvars") {
+			files = append(files, p)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// migrateTerraform converts the values of helm_release resources for the chart:
+// heredoc YAML in values lists, values files read with file(), and heredocs
+// assigned in .tfvars files to variables the values list references
+func (m *deployMigration) migrateTerraform(paths []string) error {
+	var files []*tfFile
+	for _, p := range paths {
+		raw, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files = append(files, &tfFile{Path: p, Lines: strings.Split(string(raw), "\n")})
+	}
+
+	var changes []manifestChange
+	var valuesFiles []string
+	vars := make(map[string]map[string]bool) // Directory -> referenced variables
+	for _, f := range files {
+		if !strings.HasSuffix(f.Path, ".tf") {
+			continue
+		}
+		for i := 0; i < len(f.Lines); i++ {
+			match := tfReleaseRe.FindStringSubmatch(f.Lines[i])
+			if match == nil {
+				continue
+			}
+			end := hclBlockEnd(f.Lines, i)
+			change, releaseFiles, refs := m.migrateRelease(f, match[1], i, end)
+			i = end
+			if change == nil {
+				continue
+			}
+			changes = append(changes, *change)
+			valuesFiles = append(valuesFiles, releaseFiles...)
+			dir := filepath.Dir(f.Path)
+			if vars[dir] == nil {
+				vars[dir] = make(map[string]bool)
+			}
+			for _, v := range refs {
+				vars[dir][v] = true
+			}
+		}
+	}
+
+	for _, f := range files {
+		if strings.HasSuffix(f.Path, ".tfvars") {
+			changes = append(changes, m.migrateTfvars(f, vars[filepath.Dir(f.Path)])...)
+		}
+	}
+
+	printManifestChanges(changes)
+	for _, f := range files {
+		if len(f.Replacements) == 0 {
+			continue
+		}
+		raw := []byte(strings.Join(f.Lines, "\n"))
+		if err := writeConverted(f.Path, raw, f.apply(), m.DryRun, m.BackupExt); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range valuesFiles {
+		if err := m.migrateValuesFile(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateRelease converts the values list of the helm_release block in lines
+// [start, end] of f. It returns nil if the release deploys a different chart,
+// along with the values files and variables the values list references.
+func (m *deployMigration) migrateRelease(f *tfFile, name string, start, end int) (*manifestChange, []string, []string) {
+	for i := start; i <= end; i++ {
+		if match := tfChartRe.FindStringSubmatch(f.Lines[i]); match != nil && !sameChart(match[1], m.Chart) {
+			return nil, nil, nil
+		}
+	}
+
+	change := &manifestChange{Kind: "helm_release", Name: name}
+	var valuesFiles, vars []string
+	depth := 0
+	inValues := false
+	for i := start; i <= end; i++ {
+		line := f.Lines[i]
+		if !inValues && tfValuesRe.MatchString(line) {
+			inValues = true
+			depth = 0
+		}
+
+		if inValues {
+			for _, match := range tfFileRe.FindAllStringSubmatch(line, -1) {
+				if path := m.resolveTerraformFile(f.Path, name, match[1]); path != "" {
+					valuesFiles = append(valuesFiles, path)
+				}
+			}
+			for _, match := range tfVarRe.FindAllStringSubmatch(line, -1) {
+				vars = append(vars, match[1])
+			}
+			for _, fn := range []string{"templatefile(", "yamlencode(", "jsonencode("} {
+				if strings.Contains(line, fn) {
+					m.Manual = append(m.Manual, fmt.Sprintf("%s:%d: helm_release %s: values built with %s)", f.Path, i+1, name, fn))
+				}
+			}
+		} else if match := tfSetNameRe.FindStringSubmatch(line); match != nil {
+			if path := m.indexedPath(match[1]); path != "" {
+				m.Manual = append(m.Manual, fmt.Sprintf("%s:%d: helm_release %s: set %s indexes the converted list %s", f.Path, i+1, name, match[1], path))
+			}
+		}
+
+		last := i
+		if heredoc := tfHeredocRe.FindStringSubmatch(line); heredoc != nil {
+			last = heredocEnd(f.Lines, i, heredoc[2])
+			if inValues {
+				paths, warning := f.convertHeredoc(i+1, last, m.Candidates)
+				change.Paths = append(change.Paths, paths...)
+				if warning != "" {
+					m.Manual = append(m.Manual, fmt.Sprintf("%s:%d: helm_release %s: %s", f.Path, i+1, name, warning))
+				}
+			}
+		}
+
+		if inValues {
+			depth += hclDepth(line, '[', ']')
+			if depth <= 0 {
+				inValues = false
+			}
+		}
+		i = last
+	}
+	return change, valuesFiles, vars
+}
+
+// migrateTfvars converts heredoc values assigned to the given variables in a
+// .tfvars file
+func (m *deployMigration) migrateTfvars(f *tfFile, vars map[string]bool) []manifestChange {
+	var changes []manifestChange
+	for i := 0; i < len(f.Lines); i++ {
+		match := tfTfvarsRe.FindStringSubmatch(f.Lines[i])
+		if match == nil {
+			continue
+		}
+		heredoc := tfHeredocRe.FindStringSubmatch(f.Lines[i])
+		last := heredocEnd(f.Lines, i, heredoc[2])
+		if vars[match[1]] {
+			change := manifestChange{Kind: "variable", Name: match[1]}
+			change.Paths, change.Warning = f.convertHeredoc(i+1, last, m.Candidates)
+			changes = append(changes, change)
+		}
+		i = last
+	}
+	return changes
+}
+
+// resolveTerraformFile returns the path of a file() argument relative to the
+// Terraform file, or "" if the file cannot be migrated automatically
+func (m *deployMigration) resolveTerraformFile(tf, release, ref string) string {
+	ref = tfModulePath.Replace(ref)
+	if strings.Contains(ref, "${") {
+		m.Manual = append(m.Manual, fmt.Sprintf("%s: helm_release %s: values file path %s depends on Terraform expressions", tf, release, ref))
+		return ""
+	}
+	if filepath.IsAbs(ref) {
+		return ref
+	}
+	return filepath.Join(filepath.Dir(tf), ref)
+}
+
+// indexedPath returns the converted list path a set name indexes into, or ""
+func (m *deployMigration) indexedPath(name string) string {
+	for path := range m.Candidates {
+		if strings.HasPrefix(name, path+"[") {
+			return path
+		}
+	}
+	return ""
+}
+
+// convertHeredoc converts the YAML held in heredoc lines [start, end) of f.
+// The common indentation is removed before parsing and restored afterwards.
+func (f *tfFile) convertHeredoc(start, end int, candidates map[string]k8s.DetectedCandidate) ([]k8s.DetectedCandidate, string) {
+	body := f.Lines[start:end]
+	indent := ""
+	found := false
+	for _, l := range body {
+		trimmed := strings.TrimLeft(l, " ")
+		if trimmed == "" {
+			continue
+		}
+		if lineIndent := l[:len(l)-len(trimmed)]; !found || len(lineIndent) < len(indent) {
+			indent = lineIndent
+			found = true
+		}
+	}
+
+	var stripped []string
+	for _, l := range body {
+		stripped = append(stripped, strings.TrimPrefix(l, indent))
+	}
+	text := strings.Join(stripped, "\n")
+	if strings.Contains(text, "%{") {
+		return nil, "heredoc values use template directives; convert them by hand"
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(text), &doc); err != nil {
+		return nil, fmt.Sprintf("heredoc values are not valid YAML: %v", err)
+	}
+	var edits []transform.ArrayEdit
+	transform.FindArrayEdits(&doc, nil, candidates, &edits)
+	if len(edits) == 0 {
+		return nil, ""
+	}
+
+	var paths []k8s.DetectedCandidate
+	for _, e := range edits {
+		paths = append(paths, e.Candidate)
+	}
+	converted := strings.TrimSuffix(string(transform.ApplyLineEdits([]byte(text), edits)), "\n")
+	f.Replacements = append(f.Replacements, tfReplacement{Start: start, End: end, Lines: indentLines(converted, indent)})
+	return paths, ""
+}
+
+// apply returns the file content with all replacements made
+func (f *tfFile) apply() []byte {
+	lines := append([]string(nil), f.Lines...)
+	sort.Slice(f.Replacements, func(i, j int) bool { return f.Replacements[i].Start > f.Replacements[j].Start })
+	for _, r := range f.Replacements {
+		result := make([]string, 0, len(lines)-(r.End-r.Start)+len(r.Lines))
+		result = append(result, lines[:r.Start]...)
+		result = append(result, r.Lines...)
+		result = append(result, lines[r.End:]...)
+		lines = result
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// hclBlockEnd returns the index of the line that closes the block opened on
+// line start
+func hclBlockEnd(lines []string, start int) int {
+	depth := 0
+	for i := start; i < len(lines); i++ {
+		if heredoc := tfHeredocRe.FindStringSubmatch(lines[i]); heredoc != nil {
+			depth += hclDepth(lines[i], '{', '}')
+			i = heredocEnd(lines, i, heredoc[2])
+			continue
+		}
+		depth += hclDepth(lines[i], '{', '}')
+		if depth <= 0 && i > start {
+			return i
+		}
+	}
+	return len(lines) - 1
+}
+
+// heredocEnd returns the index of the line closing the heredoc opened on line
+// start with the given marker
+func heredocEnd(lines []string, start int, marker string) int {
+	for i := start + 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == marker {
+			return i
+		}
+	}
+	return len(lines) - 1
+}
+
+// hclDepth returns how much line changes the nesting of openCh/closeCh brackets,
+// ignoring brackets in strings and comments
+func hclDepth(line string, openCh, closeCh byte) int {
+	depth := 0
+	inString := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '#', c == '/' && i+1 < len(line) && line[i+1] == '/':
+			return depth
+		case c == openCh:
+			depth++
+		case c == closeCh:
+			depth--
+		}
+	}
+	return depth
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+func TestConvertTerraform(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	dir := copyChartForTest(t, "testdata/terraform")
+	origMain, _ := os.ReadFile(filepath.Join(dir, "main.tf"))
+	origTfvars, _ := os.ReadFile(filepath.Join(dir, "prod.tfvars"))
+
+	output, err := captureOutput(t, func() error {
+		return runConvertTerraform(ConvertTerraformOptions{File: dir, Chart: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvertTerraform failed: %v\nOutput: %s", err, output)
+	}
+
+	// Heredoc values of the matching release are converted; the other release is not
+	got, _ := os.ReadFile(filepath.Join(dir, "main.tf"))
+	want := strings.Replace(string(origMain),
+		"    env:\n      - name: LOG_LEVEL\n        value: debug\n",
+		"    # Deployment.spec.template.spec.containers.env (key: name)\n    env:\n      LOG_LEVEL:\n        value: debug\n", 1)
+	if string(got) != want {
+		t.Errorf("converted main.tf =\n%s\nwant\n%s", got, want)
+	}
+
+	// Heredocs of referenced variables are converted; other variables are not
+	gotTfvars, _ := os.ReadFile(filepath.Join(dir, "prod.tfvars"))
+	wantTfvars := strings.Replace(string(origTfvars),
+		"volumes:\n  - name: cache\n    emptyDir: {}\n",
+		"# Deployment.spec.template.spec.volumes (key: name)\nvolumes:\n  cache:\n    emptyDir: {}\n", 1)
+	if string(gotTfvars) != wantTfvars {
+		t.Errorf("converted prod.tfvars =\n%s\nwant\n%s", gotTfvars, wantTfvars)
+	}
+
+	// Values files read with file() are converted
+	gotValues, _ := os.ReadFile(filepath.Join(dir, "values.yaml"))
+	if !strings.Contains(string(gotValues), "  /data:\n    name: data") {
+		t.Errorf("values.yaml should be converted, got:\n%s", gotValues)
+	}
+
+	// Indexed set blocks are reported for manual migration
+	if !strings.Contains(output, "set volumes[0].name indexes the converted list volumes") {
+		t.Errorf("output missing set report\nGot:\n%s", output)
+	}
+}
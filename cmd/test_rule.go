@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// valuesArray is a sequence found in values.yaml
+type valuesArray struct {
+	Path        string // Dot path (e.g., "istio.virtualService.http")
+	Line        int    // Line of the key in values.yaml
+	Items       int    // Number of items in the sequence
+	MissingKeys int    // Items lacking the tested unique key (if one was given)
+}
+
+func runRuleTest(opts RuleTestOptions) error {
+	if opts.Path == "" {
+		return fmt.Errorf("--path is required")
+	}
+
+	root, err := findChartRoot(opts.ChartDir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Rule pattern: %s\n", opts.Path)
+	if opts.UniqueKey != "" {
+		fmt.Printf("Unique key:   %s\n", opts.UniqueKey)
+	}
+	if !strings.HasSuffix(opts.Path, "[]") {
+		fmt.Println()
+		fmt.Println("Warning: pattern does not end with '[]' and will never match.")
+		fmt.Printf("  Did you mean --path='%s[]'?\n", opts.Path)
+	}
+
+	// Template usages the rule would pick up
+	var matchedUsages []templateListUsage
+	for _, u := range scanTemplateListUsages(root) {
+		if matchGlob(opts.Path, u.ValuesPath+"[]") {
+			matchedUsages = append(matchedUsages, u)
+		}
+	}
+
+	fmt.Println()
+	if len(matchedUsages) == 0 {
+		fmt.Println("Template usages matched: none")
+	} else {
+		fmt.Printf("Template usages matched (%d):\n", len(matchedUsages))
+		for _, u := range matchedUsages {
+			fmt.Printf("  %s (%s:%d, %s)\n", u.ValuesPath, u.TemplateFile, u.LineNumber, u.Pattern)
+		}
+	}
+
+	// Arrays in values.yaml the rule would convert
+	arrays, err := findValuesArrays(filepath.Join(root, "values.yaml"), opts.UniqueKey)
+	if err != nil {
+		return fmt.Errorf("reading values.yaml: %w", err)
+	}
+	var matchedArrays, otherArrays []valuesArray
+	for _, a := range arrays {
+		if matchGlob(opts.Path, a.Path+"[]") {
+			matchedArrays = append(matchedArrays, a)
+		} else {
+			otherArrays = append(otherArrays, a)
+		}
+	}
+
+	fmt.Println()
+	if len(matchedArrays) == 0 {
+		fmt.Println("Values entries matched: none")
+	} else {
+		fmt.Printf("Values entries matched (%d):\n", len(matchedArrays))
+		for _, a := range matchedArrays {
+			fmt.Printf("  %s (values.yaml:%d, %d item(s))\n", a.Path, a.Line, a.Items)
+			if opts.UniqueKey != "" && a.MissingKeys > 0 {
+				fmt.Printf("    Warning: %d item(s) missing %q - this array will not be converted\n", a.MissingKeys, opts.UniqueKey)
+			}
+		}
+	}
+
+	// Help users adjust a pattern that matched nothing
+	if len(matchedUsages) == 0 && len(matchedArrays) == 0 && len(otherArrays) > 0 {
+		fmt.Println()
+		fmt.Println("Arrays in values.yaml (for reference):")
+		for _, a := range otherArrays {
+			fmt.Printf("  %s[]\n", a.Path)
+		}
+		fmt.Println()
+		fmt.Println("Patterns match from the end of the path; use '*' for any single segment.")
+	}
+
+	// A rule only converts paths that are both rendered and present in values
+	if len(matchedUsages) > 0 {
+		fmt.Println()
+		fmt.Println("To save this rule:")
+		key := opts.UniqueKey
+		if key == "" {
+			key = "name"
+		}
+		fmt.Printf("  helm list-to-map add-rule --path='%s' --uniqueKey=%s\n", opts.Path, key)
+	}
+
+	return nil
+}
+
+// findValuesArrays returns every sequence in values.yaml with its dot path.
+// If uniqueKey is set, items without that key are counted in MissingKeys.
+func findValuesArrays(valuesPath, uniqueKey string) ([]valuesArray, error) {
+	doc, _, err := loadValuesNode(valuesPath)
+	if err != nil {
+		return nil, err
+	}
+	var arrays []valuesArray
+	collectValuesArrays(doc, nil, uniqueKey, &arrays)
+	return arrays, nil
+}
+
+func collectValuesArrays(node *yaml.Node, path []string, uniqueKey string, arrays *[]valuesArray) {
+	if node == nil {
+		return
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			collectValuesArrays(child, path, uniqueKey, arrays)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode := node.Content[i]
+			valueNode := node.Content[i+1]
+			p := append(append([]string{}, path...), keyNode.Value)
+			if valueNode.Kind == yaml.SequenceNode {
+				a := valuesArray{
+					Path:  strings.Join(p, "."),
+					Line:  keyNode.Line,
+					Items: len(valueNode.Content),
+				}
+				if uniqueKey != "" {
+					for _, item := range valueNode.Content {
+						if !mappingHasKey(item, uniqueKey) {
+							a.MissingKeys++
+						}
+					}
+				}
+				*arrays = append(*arrays, a)
+				continue
+			}
+			collectValuesArrays(valueNode, p, uniqueKey, arrays)
+		}
+	}
+}
+
+// mappingHasKey reports whether a mapping node has the given key
+func mappingHasKey(node *yaml.Node, key string) bool {
+	if node.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return true
+		}
+	}
+	return false
+}
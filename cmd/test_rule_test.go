@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+// TestRuleTest tests dry-evaluating rule patterns against a chart
+func TestRuleTest(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	tests := []struct {
+		name        string
+		opts        RuleTestOptions
+		wantContain []string
+		wantAbsent  []string
+	}{
+		{
+			name: "wildcard matches nested template and values paths",
+			opts: RuleTestOptions{Path: "*.extraEnv[]", ChartDir: "testdata/charts/all-patterns"},
+			wantContain: []string{
+				"Template usages matched (1)",
+				"deployment.extraEnv (templates/",
+				"Values entries matched (1)",
+				"add-rule --path='*.extraEnv[]'",
+			},
+		},
+		{
+			name: "missing [] suffix warns",
+			opts: RuleTestOptions{Path: "env", ChartDir: "testdata/charts/all-patterns"},
+			wantContain: []string{
+				"will never match",
+				"Template usages matched: none",
+				"Arrays in values.yaml (for reference)",
+			},
+			wantAbsent: []string{"To save this rule"},
+		},
+		{
+			name: "unique key missing from items",
+			opts: RuleTestOptions{Path: "ports[]", UniqueKey: "port", ChartDir: "testdata/charts/all-patterns"},
+			wantContain: []string{
+				`missing "port"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := captureOutput(t, func() error {
+				return runRuleTest(tt.opts)
+			})
+			if err != nil {
+				t.Fatalf("runRuleTest failed: %v\nOutput: %s", err, output)
+			}
+			for _, want := range tt.wantContain {
+				if !strings.Contains(output, want) {
+					t.Errorf("output should contain %q\nGot:\n%s", want, output)
+				}
+			}
+			for _, absent := range tt.wantAbsent {
+				if strings.Contains(output, absent) {
+					t.Errorf("output should not contain %q\nGot:\n%s", absent, output)
+				}
+			}
+		})
+	}
+}
+
+// TestRuleTestRequiresPath tests that --path is required
+func TestRuleTestRequiresPath(t *testing.T) {
+	if err := runRuleTest(RuleTestOptions{ChartDir: "testdata/charts/basic"}); err == nil {
+		t.Error("expected error when --path is missing")
+	}
+}
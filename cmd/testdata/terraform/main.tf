@@ -0,0 +1,34 @@
+resource "helm_release" "app" {
+  name       = "app"
+  repository = "https://charts.example.com"
+  chart      = "basic"
+  version    = "1.0.0"
+
+  values = [
+    file("${path.module}/values.yaml"),
+    <<-EOT
+    env:
+      - name: LOG_LEVEL
+        value: debug
+    EOT
+    ,
+    var.extra_values,
+  ]
+
+  set {
+    name  = "volumes[0].name"
+    value = "config"
+  }
+}
+
+resource "helm_release" "other" {
+  name  = "other"
+  chart = "other"
+
+  values = [<<-EOT
+    env:
+      - name: UNTOUCHED
+        value: "1"
+    EOT
+  ]
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/transform"
+	"golang.org/x/term"
+)
+
+// reviewItem is a single candidate shown in the interactive review
+type reviewItem struct {
+	candidate k8s.DetectedCandidate
+	selected  bool
+	before    []string // original values.yaml lines (empty for template-only)
+	after     []string // converted values.yaml lines
+}
+
+// previewColumnWidth is the width of the "before" column in side-by-side previews
+const previewColumnWidth = 44
+
+// reviewCandidates runs an interactive review of conversion candidates.
+// Users can toggle paths, preview before/after values, and apply or quit.
+// Returns the selected values paths and whether the user chose to apply.
+// On a terminal the candidates are a navigable list; otherwise commands are
+// read line by line, so the review can be scripted.
+func reviewCandidates(root string, candidates []k8s.DetectedCandidate, in io.Reader, out io.Writer) ([]string, bool, error) {
+	candidates = k8s.CheckCandidatesInValues(root, candidates)
+	items, err := buildReviewItems(filepath.Join(root, "values.yaml"), candidates)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(items) == 0 {
+		_, _ = fmt.Fprintln(out, "No convertible lists detected.")
+		return nil, false, nil
+	}
+
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		return reviewInTerminal(f, out, items)
+	}
+	return reviewByPrompt(in, out, items)
+}
+
+// reviewByPrompt reviews items with numbered commands read line by line
+func reviewByPrompt(in io.Reader, out io.Writer, items []reviewItem) ([]string, bool, error) {
+	scanner := bufio.NewScanner(in)
+	printReviewList(out, items)
+	for {
+		_, _ = fmt.Fprint(out, "\n> ")
+		if !scanner.Scan() {
+			// EOF without an explicit apply is treated as quit
+			_, _ = fmt.Fprintln(out)
+			return nil, false, scanner.Err()
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "q", "quit":
+			return nil, false, nil
+		case "y", "apply":
+			selected := selectedPaths(items)
+			if len(selected) == 0 {
+				_, _ = fmt.Fprintln(out, "Nothing selected. Toggle paths or use 'q' to quit.")
+				continue
+			}
+			return selected, true, nil
+		case "a", "all":
+			for i := range items {
+				items[i].selected = true
+			}
+			printReviewList(out, items)
+		case "n", "none":
+			for i := range items {
+				items[i].selected = false
+			}
+			printReviewList(out, items)
+		case "l", "list":
+			printReviewList(out, items)
+		case "p", "preview":
+			if len(fields) < 2 {
+				_, _ = fmt.Fprintln(out, "Usage: p <number>")
+				continue
+			}
+			idx, ok := parseReviewIndex(fields[1], len(items))
+			if !ok {
+				_, _ = fmt.Fprintf(out, "Invalid number %q\n", fields[1])
+				continue
+			}
+			printReviewPreview(out, items[idx])
+		case "h", "help", "?":
+			printReviewHelp(out)
+		default:
+			// One or more numbers toggle the matching paths
+			var indexes []int
+			for _, f := range fields {
+				idx, ok := parseReviewIndex(f, len(items))
+				if !ok {
+					_, _ = fmt.Fprintf(out, "Unknown command %q (use 'h' for help)\n", f)
+					indexes = nil
+					break
+				}
+				indexes = append(indexes, idx)
+			}
+			for _, idx := range indexes {
+				items[idx].selected = !items[idx].selected
+			}
+			if len(indexes) > 0 {
+				printReviewList(out, items)
+			}
+		}
+	}
+}
+
+// selectedPaths returns the values paths of the selected items
+func selectedPaths(items []reviewItem) []string {
+	var selected []string
+	for _, it := range items {
+		if it.selected {
+			selected = append(selected, it.candidate.ValuesPath)
+		}
+	}
+	return selected
+}
+
+// buildReviewItems computes the before/after values snippets for each
+// candidate. A chart without values.yaml has only template-only candidates.
+func buildReviewItems(valuesPath string, candidates []k8s.DetectedCandidate) ([]reviewItem, error) {
+	doc, raw, err := loadValuesNode(valuesPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	candidateMap := make(map[string]k8s.DetectedCandidate)
+	for _, c := range candidates {
+		if c.ExistsInValues {
+			candidateMap[c.ValuesPath] = c
+		}
+	}
+	var edits []transform.ArrayEdit
+	if doc != nil {
+		transform.FindArrayEditsWithOptions(doc, nil, candidateMap, transform.EditOptions{NullAsEmpty: true}, &edits)
+	}
+	editByPath := make(map[string]transform.ArrayEdit)
+	for _, e := range edits {
+		editByPath[e.Candidate.ValuesPath] = e
+	}
+
+	lines := strings.Split(string(raw), "\n")
+	var items []reviewItem
+	for _, c := range candidates {
+		// Types the typePolicy asks about start out unselected
+		item := reviewItem{candidate: c, selected: typePolicyFor(c.ElementType) != typePolicyAsk}
+		if e, ok := editByPath[c.ValuesPath]; ok {
+			item.before = lines[e.KeyLine-1 : e.ValueEndLine]
+			item.after = previewEdit(item.before, e)
+		} else if c.ExistsInValues {
+			// Present in values.yaml but not a convertible sequence
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// previewEdit applies a single edit to an isolated snippet of values.yaml lines
+func previewEdit(snippet []string, edit transform.ArrayEdit) []string {
+	local := edit
+	local.KeyLine = 1
+	local.ValueStartLine = edit.ValueStartLine - edit.KeyLine + 1
+	local.ValueEndLine = edit.ValueEndLine - edit.KeyLine + 1
+	out := transform.ApplyLineEdits([]byte(strings.Join(snippet, "\n")), []transform.ArrayEdit{local})
+	return strings.Split(string(out), "\n")
+}
+
+// parseReviewIndex parses a 1-based item number into a slice index
+func parseReviewIndex(s string, n int) (int, bool) {
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 1 || i > n {
+		return 0, false
+	}
+	return i - 1, true
+}
+
+func printReviewList(out io.Writer, items []reviewItem) {
+	_, _ = fmt.Fprintln(out, "\nConversion candidates:")
+	for i, it := range items {
+		mark := " "
+		if it.selected {
+			mark = "x"
+		}
+		_, _ = fmt.Fprintf(out, "  [%s] %d. %s (%s)\n", mark, i+1, it.candidate.ValuesPath, reviewDetail(it))
+	}
+	_, _ = fmt.Fprintln(out, "\nToggle with <number>, preview with 'p <number>', 'y' to apply, 'q' to quit, 'h' for help.")
+}
+
+// reviewDetail describes an item's key, type, and how it will be converted
+func reviewDetail(it reviewItem) string {
+	detail := fmt.Sprintf("key=%s", it.candidate.MergeKey)
+	if it.candidate.ElementType != "" {
+		detail += ", type=" + it.candidate.ElementType
+	}
+	if it.before == nil {
+		detail += ", template only"
+	}
+	if typePolicyFor(it.candidate.ElementType) == typePolicyAsk {
+		detail += ", ask"
+	}
+	return detail
+}
+
+func printReviewHelp(out io.Writer) {
+	_, _ = fmt.Fprint(out, `
+Commands:
+  <n> [n...]   toggle the numbered path(s)
+  p <n>        side-by-side preview of values.yaml before/after
+  a            select all paths
+  n            deselect all paths
+  l            list candidates
+  y            apply conversion for selected paths
+  q            quit without changes
+`)
+}
+
+// printReviewPreview renders a side-by-side before/after view of a candidate
+func printReviewPreview(out io.Writer, it reviewItem) {
+	_, _ = fmt.Fprintf(out, "\n%s (key=%s)\n", it.candidate.ValuesPath, it.candidate.MergeKey)
+	if it.before == nil {
+		_, _ = fmt.Fprintln(out, "  No values.yaml entry; only templates will be updated.")
+		if it.candidate.TemplateFile != "" {
+			_, _ = fmt.Fprintf(out, "  Template: templates/%s\n", it.candidate.TemplateFile)
+		}
+		return
+	}
+
+	_, _ = fmt.Fprintf(out, "  %-*s | %s\n", previewColumnWidth, "Before", "After")
+	_, _ = fmt.Fprintf(out, "  %s-+-%s\n", strings.Repeat("-", previewColumnWidth), strings.Repeat("-", previewColumnWidth))
+	rows := len(it.before)
+	if len(it.after) > rows {
+		rows = len(it.after)
+	}
+	for i := 0; i < rows; i++ {
+		var left, right string
+		if i < len(it.before) {
+			left = it.before[i]
+		}
+		if i < len(it.after) {
+			right = it.after[i]
+		}
+		_, _ = fmt.Fprintf(out, "  %-*s | %s\n", previewColumnWidth, truncateColumn(left, previewColumnWidth), right)
+	}
+}
+
+// truncateColumn shortens s to fit within width runes
+func truncateColumn(s string, width int) string {
+	r := []rune(s)
+	if len(r) <= width {
+		return s
+	}
+	return string(r[:width-1]) + "…"
+}
+
+// Keys of the navigable review, other than printable characters
+const (
+	keyUp        = "up"
+	keyDown      = "down"
+	keyHome      = "home"
+	keyEnd       = "end"
+	keyEnter     = "enter"
+	keySpace     = "space"
+	keyEsc       = "esc"
+	keyBackspace = "backspace"
+	keyInterrupt = "ctrl-c"
+)
+
+// reviewModel is the state of the navigable review: the list of candidates
+// with a cursor, or the summary confirming the selection
+type reviewModel struct {
+	items      []reviewItem
+	cursor     int
+	confirming bool   // showing the summary before applying
+	message    string // shown under the list until the next key
+	height     int    // terminal rows
+}
+
+// reviewInTerminal runs the navigable review on the terminal f, restoring it
+// however the review ends
+func reviewInTerminal(f *os.File, out io.Writer, items []reviewItem) ([]string, bool, error) {
+	fd := int(f.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, false, fmt.Errorf("starting the interactive review: %w", err)
+	}
+	defer func() { _ = term.Restore(fd, state) }()
+	_, height, err := term.GetSize(fd)
+	if err != nil || height == 0 {
+		height = 24
+	}
+
+	// Draw on the alternate screen, so the shell's scrollback is left as it was
+	_, _ = fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer func() { _, _ = fmt.Fprint(out, "\x1b[?25h\x1b[?1049l") }()
+	return navigateReview(bufio.NewReader(f), out, items, height)
+}
+
+// navigateReview redraws the review after each key read from in until the
+// selection is applied or the review is quit
+func navigateReview(in *bufio.Reader, out io.Writer, items []reviewItem, height int) ([]string, bool, error) {
+	m := &reviewModel{items: items, height: height}
+	for {
+		// Raw mode doesn't return the carriage at line ends
+		_, _ = fmt.Fprint(out, "\x1b[H\x1b[2J"+strings.ReplaceAll(m.view(), "\n", "\r\n"))
+		key, err := readReviewKey(in)
+		if err == io.EOF {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if done, apply := m.update(key); done {
+			if !apply {
+				return nil, false, nil
+			}
+			return selectedPaths(m.items), true, nil
+		}
+	}
+}
+
+// readReviewKey reads one key press, decoding the escape sequences of the
+// arrow, Home, and End keys
+func readReviewKey(in *bufio.Reader) (string, error) {
+	b, err := in.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	switch b {
+	case '\r', '\n':
+		return keyEnter, nil
+	case ' ':
+		return keySpace, nil
+	case 3:
+		return keyInterrupt, nil
+	case 127, 8:
+		return keyBackspace, nil
+	case 0x1b:
+		// A lone Esc has nothing buffered after it
+		if in.Buffered() == 0 {
+			return keyEsc, nil
+		}
+		if next, _ := in.ReadByte(); next != '[' && next != 'O' {
+			return keyEsc, nil
+		}
+		seq, err := in.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch seq {
+		case 'A':
+			return keyUp, nil
+		case 'B':
+			return keyDown, nil
+		case 'H':
+			return keyHome, nil
+		case 'F':
+			return keyEnd, nil
+		}
+		// Other sequences, such as ESC [ 5 ~, end with a letter or ~
+		for seq >= '0' && seq <= '9' || seq == ';' {
+			if seq, err = in.ReadByte(); err != nil {
+				return "", err
+			}
+		}
+		return "", nil
+	}
+	return string(rune(b)), nil
+}
+
+// update applies a key to the model and reports whether the review is done,
+// and if so whether the selection is to be applied
+func (m *reviewModel) update(key string) (done, apply bool) {
+	m.message = ""
+	if key == keyInterrupt || key == "q" {
+		return true, false
+	}
+	if m.confirming {
+		switch key {
+		case "y", keyEnter:
+			return true, true
+		case "b", "n", keyEsc, keyBackspace:
+			m.confirming = false
+		}
+		return false, false
+	}
+
+	switch key {
+	case keyUp, "k":
+		m.cursor = max(m.cursor-1, 0)
+	case keyDown, "j":
+		m.cursor = min(m.cursor+1, len(m.items)-1)
+	case keyHome, "g":
+		m.cursor = 0
+	case keyEnd, "G":
+		m.cursor = len(m.items) - 1
+	case keySpace, "x":
+		m.items[m.cursor].selected = !m.items[m.cursor].selected
+	case "a":
+		for i := range m.items {
+			m.items[i].selected = true
+		}
+	case "n":
+		for i := range m.items {
+			m.items[i].selected = false
+		}
+	case keyEnter:
+		if len(selectedPaths(m.items)) == 0 {
+			m.message = "Nothing selected. Toggle paths with space, or press q to quit."
+			break
+		}
+		m.confirming = true
+	}
+	return false, false
+}
+
+// view renders the list with the preview of the path under the cursor, or
+// the summary of the selection
+func (m *reviewModel) view() string {
+	var b bytes.Buffer
+	if m.confirming {
+		m.viewSummary(&b)
+		return b.String()
+	}
+
+	selected := len(selectedPaths(m.items))
+	fmt.Fprintf(&b, "Conversion candidates (%d of %d selected)\n\n", selected, len(m.items))
+
+	// Show a window of the list around the cursor, leaving room for the preview
+	rows := max(3, m.height/3)
+	start := min(max(m.cursor-rows/2, 0), max(len(m.items)-rows, 0))
+	end := min(start+rows, len(m.items))
+	if start > 0 {
+		fmt.Fprintf(&b, "    ↑ %d more\n", start)
+	}
+	for i := start; i < end; i++ {
+		it := m.items[i]
+		cursor, mark := " ", " "
+		if i == m.cursor {
+			cursor = ">"
+		}
+		if it.selected {
+			mark = "x"
+		}
+		fmt.Fprintf(&b, "%s [%s] %s (%s)\n", cursor, mark, it.candidate.ValuesPath, reviewDetail(it))
+	}
+	if end < len(m.items) {
+		fmt.Fprintf(&b, "    ↓ %d more\n", len(m.items)-end)
+	}
+
+	var preview bytes.Buffer
+	printReviewPreview(&preview, m.items[m.cursor])
+	lines := strings.Split(strings.TrimRight(preview.String(), "\n"), "\n")
+	if room := m.height - strings.Count(b.String(), "\n") - 4; len(lines) > room {
+		lines = append(lines[:max(room-1, 0)], "  …")
+	}
+	b.WriteString(strings.Join(lines, "\n") + "\n\n")
+
+	if m.message != "" {
+		b.WriteString(yellow(m.message) + "\n")
+	}
+	b.WriteString("↑/↓ move  space toggle  a all  n none  enter review  q quit\n")
+	return b.String()
+}
+
+// viewSummary renders the paths that will be converted and those left as
+// lists, before the selection is applied
+func (m *reviewModel) viewSummary(b *bytes.Buffer) {
+	var convert, keep []reviewItem
+	for _, it := range m.items {
+		if it.selected {
+			convert = append(convert, it)
+		} else {
+			keep = append(keep, it)
+		}
+	}
+	fmt.Fprintf(b, "Summary\n\nConvert %d path(s):\n", len(convert))
+	for _, it := range convert {
+		fmt.Fprintf(b, "  %s (%s)\n", it.candidate.ValuesPath, reviewDetail(it))
+	}
+	if len(keep) > 0 {
+		fmt.Fprintf(b, "\nLeave %d as lists:\n", len(keep))
+		for _, it := range keep {
+			fmt.Fprintf(b, "  %s\n", it.candidate.ValuesPath)
+		}
+	}
+	b.WriteString("\ny apply  b back  q quit\n")
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+)
+
+// TestReviewCandidates tests toggling, previewing, and applying in the interactive review
+func TestReviewCandidates(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	collected, err := collectConvertCandidates(chartPath)
+	if err != nil {
+		t.Fatalf("collectConvertCandidates failed: %v", err)
+	}
+	candidates := collected.Matched
+
+	// Find the list position of "env" so the test doesn't depend on detection order
+	envIndex := 0
+	for i, c := range candidates {
+		if c.ValuesPath == "env" {
+			envIndex = i + 1
+		}
+	}
+	if envIndex == 0 {
+		t.Fatal("expected env to be a candidate")
+	}
+
+	var out bytes.Buffer
+	input := strings.NewReader("n\np " + strconv.Itoa(envIndex) + "\n" + strconv.Itoa(envIndex) + "\ny\n")
+	selected, apply, err := reviewCandidates(chartPath, candidates, input, &out)
+	if err != nil {
+		t.Fatalf("reviewCandidates failed: %v", err)
+	}
+	if !apply {
+		t.Fatalf("expected apply\nOutput:\n%s", out.String())
+	}
+	if len(selected) != 1 || selected[0] != "env" {
+		t.Errorf("expected only env selected, got %v", selected)
+	}
+
+	// Preview shows the list form on the left and map form on the right
+	if !strings.Contains(out.String(), "- name: DB_HOST") || !strings.Contains(out.String(), "DB_HOST:") {
+		t.Errorf("expected before/after preview\nOutput:\n%s", out.String())
+	}
+}
+
+// TestReviewCandidatesQuit tests that quitting (or EOF) applies nothing
+func TestReviewCandidatesQuit(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	collected, err := collectConvertCandidates(chartPath)
+	if err != nil {
+		t.Fatalf("collectConvertCandidates failed: %v", err)
+	}
+	candidates := collected.Matched
+
+	for _, input := range []string{"q\n", ""} {
+		var out bytes.Buffer
+		_, apply, err := reviewCandidates(chartPath, candidates, strings.NewReader(input), &out)
+		if err != nil {
+			t.Fatalf("reviewCandidates failed: %v", err)
+		}
+		if apply {
+			t.Errorf("input %q: expected no apply", input)
+		}
+	}
+}
+
+// TestBuildReviewItemsValuesError tests that a values.yaml that can't be read
+// fails the review instead of showing no previews
+func TestBuildReviewItemsValuesError(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	collected, err := collectConvertCandidates(chartPath)
+	if err != nil {
+		t.Fatalf("collectConvertCandidates failed: %v", err)
+	}
+	candidates := k8s.CheckCandidatesInValues(chartPath, collected.Matched)
+	valuesPath := filepath.Join(chartPath, "values.yaml")
+	writeChartFiles(t, chartPath, map[string]string{"values.yaml": "env: [\n"})
+	if _, err := buildReviewItems(valuesPath, candidates); err == nil || !strings.Contains(err.Error(), "values.yaml") {
+		t.Errorf("buildReviewItems() error = %v, want one naming values.yaml", err)
+	}
+
+	// A chart without values.yaml has nothing to preview, which is fine
+	if _, err := buildReviewItems(filepath.Join(t.TempDir(), "values.yaml"), nil); err != nil {
+		t.Errorf("buildReviewItems() without values.yaml error = %v", err)
+	}
+}
+
+// TestNavigateReview tests moving through the list, toggling, and going back
+// from the summary before applying
+func TestNavigateReview(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	collected, err := collectConvertCandidates(chartPath)
+	if err != nil {
+		t.Fatalf("collectConvertCandidates failed: %v", err)
+	}
+	candidates := k8s.CheckCandidatesInValues(chartPath, collected.Matched)
+	items, err := buildReviewItems(filepath.Join(chartPath, "values.yaml"), candidates)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("buildReviewItems() = %d items, %v; want 3", len(items), err)
+	}
+
+	// Deselect all, try to apply nothing, select the second and last paths
+	// with the arrow keys and j, look at the summary, go back, drop the
+	// second again and apply
+	keys := "n\r\x1b[B \x1b[Fx\rb\x1b[A\x1bOAj \ry"
+	var out bytes.Buffer
+	selected, apply, err := navigateReview(bufio.NewReader(strings.NewReader(keys)), &out, items, 40)
+	if err != nil {
+		t.Fatalf("navigateReview() error = %v", err)
+	}
+	if !apply || len(selected) != 1 || selected[0] != items[2].candidate.ValuesPath {
+		t.Errorf("navigateReview() = %v, %v; want only %s applied", selected, apply, items[2].candidate.ValuesPath)
+	}
+	for _, want := range []string{
+		"Nothing selected.",
+		"Conversion candidates (2 of 3 selected)",
+		"Summary\r\n\r\nConvert 2 path(s):",
+		"Leave 1 as lists:\r\n  " + items[0].candidate.ValuesPath,
+		"> [x] " + items[2].candidate.ValuesPath,
+		"- name: DB_HOST",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output should contain %q, got:\n%s", want, out.String())
+		}
+	}
+
+	// q, Ctrl-C, and the end of input quit without applying
+	for _, keys := range []string{"q", "\x03", " \r\x03", ""} {
+		_, apply, err := navigateReview(bufio.NewReader(strings.NewReader(keys)), io.Discard, items, 40)
+		if err != nil || apply {
+			t.Errorf("keys %q: navigateReview() apply = %v, error = %v; want a quit", keys, apply, err)
+		}
+	}
+}
+
+// TestConvertPathsFilter tests that ConvertOptions.Paths restricts conversion
+func TestConvertPathsFilter(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{
+			ChartDir:  chartPath,
+			BackupExt: ".bak",
+			Paths:     []string{"volumes"},
+		})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	values, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if !strings.Contains(string(values), "- name: DB_HOST") {
+		t.Error("env should not be converted when not selected")
+	}
+	if strings.Contains(string(values), "- name: config\n    configMap") {
+		t.Error("volumes should be converted")
+	}
+}
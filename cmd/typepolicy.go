@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+)
+
+// Conversion policies for element types in the typePolicy config
+const (
+	typePolicyAlways = "always" // convert, even below minItems
+	typePolicyNever  = "never"  // never convert, as with ignoreTypes
+	typePolicyAsk    = "ask"    // convert only when selected with --tui
+)
+
+// validateTypePolicy checks the configured typePolicy entries
+func validateTypePolicy() error {
+	types := make([]string, 0, len(conf.TypePolicy))
+	for t := range conf.TypePolicy {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		switch conf.TypePolicy[t] {
+		case typePolicyAlways, typePolicyNever, typePolicyAsk:
+			continue
+		}
+		return fmt.Errorf("invalid typePolicy %q for %s: want %s, %s, or %s", conf.TypePolicy[t], t, typePolicyAlways, typePolicyNever, typePolicyAsk)
+	}
+	return nil
+}
+
+// typePolicyFor returns the configured policy for an element type, or "" if
+// none applies. As with ignoreTypes, "EnvVar" matches "corev1.EnvVar" and a
+// qualified name must match exactly; a qualified entry wins over a bare one.
+func typePolicyFor(elementType string) string {
+	if elementType == "" {
+		return ""
+	}
+	if p, ok := conf.TypePolicy[elementType]; ok {
+		return p
+	}
+	if i := strings.LastIndex(elementType, "."); i >= 0 {
+		return conf.TypePolicy[elementType[i+1:]]
+	}
+	return ""
+}
+
+// filterAskCandidates removes candidates whose element type needs confirmation
+// under the typePolicy. Returns the kept candidates and those held back.
+func filterAskCandidates(candidates []k8s.DetectedCandidate) ([]k8s.DetectedCandidate, []k8s.DetectedCandidate) {
+	var kept, ask []k8s.DetectedCandidate
+	for _, c := range candidates {
+		if typePolicyFor(c.ElementType) == typePolicyAsk {
+			ask = append(ask, c)
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept, ask
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+)
+
+func TestTypePolicyFor(t *testing.T) {
+	originalConf := conf
+	defer func() { conf = originalConf }()
+	conf = Config{TypePolicy: map[string]string{
+		"EnvVar":        typePolicyAlways,
+		"Toleration":    typePolicyNever,
+		"corev1.Volume": typePolicyAsk,
+		"Volume":        typePolicyAlways,
+	}}
+
+	tests := []struct {
+		elementType string
+		want        string
+	}{
+		{"corev1.EnvVar", typePolicyAlways},
+		{"EnvVar", typePolicyAlways},
+		{"corev1.Toleration", typePolicyNever},
+		{"corev1.Volume", typePolicyAsk},   // qualified entry wins
+		{"other.Volume", typePolicyAlways}, // bare entry matches any package
+		{"corev1.ContainerPort", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := typePolicyFor(tt.elementType); got != tt.want {
+			t.Errorf("typePolicyFor(%q) = %q, want %q", tt.elementType, got, tt.want)
+		}
+	}
+
+	conf.TypePolicy["ContainerPort"] = "sometimes"
+	if err := validateTypePolicy(); err == nil || !strings.Contains(err.Error(), "sometimes") {
+		t.Errorf("validateTypePolicy() error = %v, want invalid policy", err)
+	}
+}
+
+func TestMergeConfigTypePolicy(t *testing.T) {
+	t.Parallel()
+
+	base := Config{TypePolicy: map[string]string{"EnvVar": typePolicyAsk, "Volume": typePolicyAlways}}
+	merged, err := mergeConfig(base, []byte("typePolicy:\n  EnvVar: always\n  Toleration: never\n"))
+	if err != nil {
+		t.Fatalf("mergeConfig() error = %v", err)
+	}
+	want := map[string]string{"EnvVar": typePolicyAlways, "Volume": typePolicyAlways, "Toleration": typePolicyNever}
+	if len(merged.TypePolicy) != len(want) {
+		t.Errorf("TypePolicy = %v, want %v", merged.TypePolicy, want)
+	}
+	for k, v := range want {
+		if merged.TypePolicy[k] != v {
+			t.Errorf("TypePolicy[%s] = %q, want %q", k, merged.TypePolicy[k], v)
+		}
+	}
+	if base.TypePolicy["EnvVar"] != typePolicyAsk || len(base.TypePolicy) != 2 {
+		t.Errorf("base config was modified: %v", base.TypePolicy)
+	}
+}
+
+func TestConvertTypePolicy(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	originalConf := conf
+	defer func() { conf = originalConf }()
+	conf = Config{
+		TypePolicy: map[string]string{
+			"EnvVar":      typePolicyAsk,
+			"VolumeMount": typePolicyNever,
+		},
+	}
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	if !strings.Contains(output, "Needs confirmation (typePolicy: ask):") || !strings.Contains(output, "  env (type=") {
+		t.Errorf("output should list env as needing confirmation, got:\n%s", output)
+	}
+
+	values, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if !strings.Contains(string(values), "- name: DB_HOST") {
+		t.Errorf("env (ask) should stay a list, got:\n%s", values)
+	}
+	if !strings.Contains(string(values), "- name: config\n    mountPath") {
+		t.Errorf("volumeMounts (never) should stay a list, got:\n%s", values)
+	}
+	if strings.Contains(string(values), "- name: data\n    emptyDir") {
+		t.Errorf("volumes should be converted, got:\n%s", values)
+	}
+}
+
+func TestFilterMinItemsTypePolicyAlways(t *testing.T) {
+	originalConf := conf
+	defer func() { conf = originalConf }()
+	conf = Config{MinItems: 3, TypePolicy: map[string]string{"Volume": typePolicyAlways}}
+
+	candidates := []k8s.DetectedCandidate{
+		{ValuesPath: "env", ElementType: "corev1.EnvVar"},
+		{ValuesPath: "volumes", ElementType: "corev1.Volume"},
+	}
+	kept, below := filterMinItems("testdata/charts/basic", candidates)
+	if len(kept) != 1 || kept[0].ValuesPath != "volumes" {
+		t.Errorf("kept = %+v, want volumes (always)", kept)
+	}
+	if len(below) != 1 || below[0] != "env" {
+		t.Errorf("below = %v, want [env]", below)
+	}
+}
+
+func TestBuildReviewItemsTypePolicyAsk(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	originalConf := conf
+	defer func() { conf = originalConf }()
+	conf = Config{TypePolicy: map[string]string{"EnvVar": typePolicyAsk}}
+
+	collected, err := collectConvertCandidates("testdata/charts/basic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collected.Ask) != 1 || collected.Ask[0].ValuesPath != "env" {
+		t.Fatalf("Ask = %+v, want env", collected.Ask)
+	}
+
+	candidates := k8s.CheckCandidatesInValues("testdata/charts/basic", append(collected.Matched, collected.Ask...))
+	items, err := buildReviewItems("testdata/charts/basic/values.yaml", candidates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, it := range items {
+		if want := it.candidate.ValuesPath != "env"; it.selected != want {
+			t.Errorf("%s selected = %v, want %v", it.candidate.ValuesPath, it.selected, want)
+		}
+	}
+}
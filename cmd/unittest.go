@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/transform"
+	"gopkg.in/yaml.v3"
+)
+
+// unittestFile is the chart-relative path of the generated helm-unittest suite
+var unittestFile = filepath.Join("tests", "list-to-map_test.yaml")
+
+// unittestAddedKey is the map key of the entry the generated tests add
+const unittestAddedKey = "list-to-map-test"
+
+// unittestOverride is the value the generated tests override a field with
+const unittestOverride = "list-to-map-override"
+
+// unittestSuite is a helm-unittest test suite (https://github.com/helm-unittest/helm-unittest)
+type unittestSuite struct {
+	Suite     string         `yaml:"suite"`
+	Templates []string       `yaml:"templates"`
+	Tests     []unittestCase `yaml:"tests"`
+}
+
+type unittestCase struct {
+	It       string                 `yaml:"it"`
+	Template string                 `yaml:"template"`
+	Set      map[string]interface{} `yaml:"set,omitempty"`
+	Asserts  []unittestAssert       `yaml:"asserts"`
+}
+
+type unittestAssert struct {
+	Contains    *unittestContent `yaml:"contains,omitempty"`
+	NotContains *unittestContent `yaml:"notContains,omitempty"`
+}
+
+type unittestContent struct {
+	Path    string                 `yaml:"path"`
+	Content map[string]interface{} `yaml:"content"`
+}
+
+// buildUnitTests returns helm-unittest cases asserting that the converted
+// values render the same items the lists did, and that the map form can be
+// overridden, extended, and pruned by key. raw is values.yaml before
+// conversion. It also returns the paths no tests could be written for.
+func buildUnitTests(raw []byte, edits []transform.ArrayEdit) (*unittestSuite, []string) {
+	var values map[string]interface{}
+	_ = yaml.Unmarshal(raw, &values)
+
+	suite := &unittestSuite{Suite: "list-to-map conversion"}
+	templates := make(map[string]bool)
+	var skipped []string
+	for _, edit := range edits {
+		c := edit.Candidate
+		items := listItems(values, c.ValuesPath, c.MergeKey)
+		// Order fields aren't rendered, so items wouldn't match as written
+		if len(items) == 0 || c.TemplateFile == "" || c.YAMLPath == "" || edit.OrderField != "" {
+			skipped = append(skipped, c.ValuesPath)
+			continue
+		}
+		tmpl := "templates/" + c.TemplateFile
+		templates[tmpl] = true
+		path := k8s.IndexedYAMLPath(c.ResourceKind, c.YAMLPath, c.ListIndexes)
+		suite.Tests = append(suite.Tests, pathUnitTests(c.ValuesPath, c.MergeKey, tmpl, path, items)...)
+	}
+	for tmpl := range templates {
+		suite.Templates = append(suite.Templates, tmpl)
+	}
+	sort.Strings(suite.Templates)
+	return suite, skipped
+}
+
+// pathUnitTests returns the cases for one converted values path
+func pathUnitTests(valuesPath, key, tmpl, path string, items []map[string]interface{}) []unittestCase {
+	// The helper renders every key as a string
+	rendered := func(item map[string]interface{}) map[string]interface{} {
+		out := make(map[string]interface{}, len(item))
+		for k, v := range item {
+			out[k] = v
+		}
+		out[key] = fmt.Sprint(item[key])
+		return out
+	}
+
+	defaults := unittestCase{It: fmt.Sprintf("renders the default %s items", valuesPath), Template: tmpl}
+	for _, item := range items {
+		defaults.Asserts = append(defaults.Asserts, unittestAssert{Contains: &unittestContent{Path: path, Content: rendered(item)}})
+	}
+	cases := []unittestCase{defaults}
+
+	first := rendered(items[0])
+	firstKey := fmt.Sprint(first[key])
+	// helm-unittest set paths are dot-separated
+	if strings.Contains(firstKey, ".") {
+		return cases
+	}
+	entry := valuesPath + "." + firstKey
+
+	if field := scalarField(first, key); field != "" {
+		overridden := rendered(first)
+		overridden[field] = unittestOverride
+		cases = append(cases, unittestCase{
+			It:       fmt.Sprintf("overrides a %s field by key", valuesPath),
+			Template: tmpl,
+			Set:      map[string]interface{}{entry + "." + field: unittestOverride},
+			Asserts:  []unittestAssert{{Contains: &unittestContent{Path: path, Content: overridden}}},
+		})
+	}
+
+	spec := rendered(first)
+	delete(spec, key)
+	added := rendered(first)
+	added[key] = unittestAddedKey
+	cases = append(cases, unittestCase{
+		It:       fmt.Sprintf("adds a %s item by key", valuesPath),
+		Template: tmpl,
+		Set:      map[string]interface{}{valuesPath + "." + unittestAddedKey: spec},
+		Asserts: []unittestAssert{
+			{Contains: &unittestContent{Path: path, Content: added}},
+			{Contains: &unittestContent{Path: path, Content: first}},
+		},
+	})
+
+	cases = append(cases, unittestCase{
+		It:       fmt.Sprintf("removes a %s item with null", valuesPath),
+		Template: tmpl,
+		Set:      map[string]interface{}{entry: nil},
+		Asserts:  []unittestAssert{{NotContains: &unittestContent{Path: path, Content: first}}},
+	})
+	return cases
+}
+
+// listItems returns the items of the list at a values path that have the key
+func listItems(values map[string]interface{}, path, key string) []map[string]interface{} {
+	var node interface{} = values
+	for _, part := range strings.Split(path, ".") {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = m[part]
+	}
+	list, _ := node.([]interface{})
+	var items []map[string]interface{}
+	for _, v := range list {
+		if item, ok := v.(map[string]interface{}); ok && item[key] != nil {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// scalarField returns the first non-key string field of an item, in name order
+func scalarField(item map[string]interface{}, key string) string {
+	var fields []string
+	for k, v := range item {
+		if _, ok := v.(string); ok && k != key {
+			fields = append(fields, k)
+		}
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	sort.Strings(fields)
+	return fields[0]
+}
+
+// writeUnitTests writes the helm-unittest suite for the converted paths to
+// the chart's tests directory, merged into any earlier one
+func writeUnitTests(root string, raw []byte, edits []transform.ArrayEdit) error {
+	if len(edits) == 0 {
+		return nil
+	}
+	suite, skipped := buildUnitTests(raw, edits)
+	if len(suite.Tests) == 0 {
+		fmt.Println("\nNo helm-unittest tests written: no converted list has items to assert on.")
+		return nil
+	}
+
+	path := filepath.Join(root, unittestFile)
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var buf bytes.Buffer
+	kept := 0
+	if len(bytes.TrimSpace(existing)) == 0 {
+		buf.WriteString("# Generated by helm list-to-map: checks converted values render as the lists did.\n")
+		buf.WriteString("# Run with: helm unittest .\n")
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(suite); err != nil {
+			return err
+		}
+	} else {
+		var doc yaml.Node
+		if err := yaml.Unmarshal(existing, &doc); err != nil {
+			return fmt.Errorf("%s: %w", unittestFile, err)
+		}
+		if kept, err = mergeUnitTests(&doc, suite); err != nil {
+			return fmt.Errorf("%s: %w", unittestFile, err)
+		}
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(&doc); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if kept > 0 {
+		fmt.Printf("\nUpdated helm-unittest suite: %s (%d tests written, %d kept)\n", unittestFile, len(suite.Tests), kept)
+	} else {
+		fmt.Printf("\nWrote helm-unittest suite: %s (%d tests)\n", unittestFile, len(suite.Tests))
+	}
+	if len(skipped) > 0 {
+		fmt.Printf("  No tests for: %s\n", strings.Join(skipped, ", "))
+	}
+	return nil
+}
+
+// mergeUnitTests merges suite into an existing suite document, so tests
+// written for earlier conversions or by hand are kept: tests named the same
+// as a generated one are replaced in place, the rest of the generated tests
+// and templates are appended. It returns how many existing tests were kept.
+func mergeUnitTests(doc *yaml.Node, suite *unittestSuite) (int, error) {
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return 0, fmt.Errorf("not a helm-unittest suite")
+	}
+	top := doc.Content[0]
+	var generated yaml.Node
+	if err := generated.Encode(suite); err != nil {
+		return 0, err
+	}
+
+	_, templates := mappingEntry(top, "templates")
+	_, newTemplates := mappingEntry(&generated, "templates")
+	if templates == nil {
+		top.Content = append(top.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "templates"}, newTemplates)
+	} else if templates.Kind == yaml.SequenceNode {
+		have := make(map[string]bool)
+		for _, n := range templates.Content {
+			have[n.Value] = true
+		}
+		for _, n := range newTemplates.Content {
+			if !have[n.Value] {
+				templates.Content = append(templates.Content, n)
+			}
+		}
+	}
+
+	_, tests := mappingEntry(top, "tests")
+	_, newTests := mappingEntry(&generated, "tests")
+	if tests == nil || tests.Kind != yaml.SequenceNode {
+		if tests != nil {
+			return 0, fmt.Errorf("tests is not a list")
+		}
+		top.Content = append(top.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "tests"}, newTests)
+		return 0, nil
+	}
+	byName := make(map[string]*yaml.Node)
+	for _, n := range newTests.Content {
+		if _, it := mappingEntry(n, "it"); it != nil {
+			byName[it.Value] = n
+		}
+	}
+	kept := 0
+	for i, n := range tests.Content {
+		_, it := mappingEntry(n, "it")
+		if it == nil || byName[it.Value] == nil {
+			kept++
+			continue
+		}
+		tests.Content[i] = byName[it.Value]
+		delete(byName, it.Value)
+	}
+	for _, n := range newTests.Content {
+		if _, it := mappingEntry(n, "it"); it != nil && byName[it.Value] != nil {
+			tests.Content = append(tests.Content, n)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/transform"
+	"gopkg.in/yaml.v3"
+)
+
+func TestConvertUnitTests(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak", UnitTests: true})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	data, err := os.ReadFile(filepath.Join(chartPath, unittestFile))
+	if err != nil {
+		t.Fatalf("suite not written: %v\nOutput: %s", err, output)
+	}
+	var suite unittestSuite
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		t.Fatalf("suite is not valid YAML: %v", err)
+	}
+	if len(suite.Templates) != 1 || suite.Templates[0] != "templates/deployment.yaml" {
+		t.Errorf("templates = %v, want [templates/deployment.yaml]", suite.Templates)
+	}
+
+	tests := make(map[string]unittestCase)
+	for _, tc := range suite.Tests {
+		tests[tc.It] = tc
+	}
+	defaults, ok := tests["renders the default env items"]
+	if !ok {
+		t.Fatalf("missing env defaults test in:\n%s", data)
+	}
+	first := defaults.Asserts[0].Contains
+	if first == nil || first.Path != "spec.template.spec.containers[0].env" {
+		t.Errorf("env assert = %+v, want path spec.template.spec.containers[0].env", first)
+	} else if first.Content["name"] != "DB_HOST" || first.Content["value"] != "localhost" {
+		t.Errorf("env assert content = %v, want DB_HOST=localhost", first.Content)
+	}
+
+	if tc := tests["overrides a env field by key"]; tc.Set["env.DB_HOST.value"] != unittestOverride {
+		t.Errorf("override test set = %v", tc.Set)
+	}
+	if tc := tests["adds a env item by key"]; tc.Set["env."+unittestAddedKey] == nil {
+		t.Errorf("add test set = %v", tc.Set)
+	}
+	if tc, ok := tests["removes a env item with null"]; !ok || tc.Asserts[0].NotContains == nil {
+		t.Errorf("remove test = %+v, want a notContains assert", tc)
+	}
+	// Volumes have no string field besides the key to override
+	if _, ok := tests["overrides a volumes field by key"]; ok {
+		t.Errorf("unexpected volumes override test")
+	}
+	if _, ok := tests["adds a volumes item by key"]; !ok {
+		t.Errorf("missing volumes add test")
+	}
+}
+
+func TestConvertUnitTestsMerge(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	existing := `suite: my chart
+templates:
+  - templates/service.yaml
+tests:
+  - it: renders the service
+    template: templates/service.yaml
+    asserts:
+      - equal:
+          path: spec.type
+          value: ClusterIP
+  - it: renders the default env items
+    template: templates/deployment.yaml
+    asserts:
+      - contains:
+          path: spec.template.spec.containers[0].env
+          content:
+            name: STALE
+`
+	writeChartFiles(t, chartPath, map[string]string{unittestFile: existing})
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak", UnitTests: true})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	data, err := os.ReadFile(filepath.Join(chartPath, unittestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var suite struct {
+		Suite     string                   `yaml:"suite"`
+		Templates []string                 `yaml:"templates"`
+		Tests     []map[string]interface{} `yaml:"tests"`
+	}
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		t.Fatalf("suite is not valid YAML: %v", err)
+	}
+	if suite.Suite != "my chart" {
+		t.Errorf("suite = %q, want the existing name kept", suite.Suite)
+	}
+	if want := []string{"templates/service.yaml", "templates/deployment.yaml"}; !reflect.DeepEqual(suite.Templates, want) {
+		t.Errorf("templates = %v, want %v", suite.Templates, want)
+	}
+	if len(suite.Tests) < 3 || suite.Tests[0]["it"] != "renders the service" || suite.Tests[1]["it"] != "renders the default env items" {
+		t.Fatalf("tests not merged in place:\n%s", data)
+	}
+	if _, ok := suite.Tests[0]["asserts"].([]interface{})[0].(map[string]interface{})["equal"]; !ok {
+		t.Errorf("hand-written test lost its equal assert:\n%s", data)
+	}
+	if strings.Contains(string(data), "STALE") {
+		t.Errorf("earlier generated test not replaced:\n%s", data)
+	}
+	if !strings.Contains(output, "1 kept") {
+		t.Errorf("output doesn't report the kept test:\n%s", output)
+	}
+}
+
+func TestBuildUnitTestsListIndex(t *testing.T) {
+	raw := []byte("sidecarEnv:\n  - name: A\n    value: b\n")
+	edits := []transform.ArrayEdit{{Candidate: k8s.DetectedCandidate{
+		ValuesPath:   "sidecarEnv",
+		YAMLPath:     "spec.template.spec.containers.env",
+		ListIndexes:  map[string]int{"spec.template.spec.containers": 1},
+		MergeKey:     "name",
+		ResourceKind: "Deployment",
+		TemplateFile: "deployment.yaml",
+	}}}
+	suite, _ := buildUnitTests(raw, edits)
+	if len(suite.Tests) == 0 {
+		t.Fatal("no tests built")
+	}
+	if got := suite.Tests[0].Asserts[0].Contains.Path; got != "spec.template.spec.containers[1].env" {
+		t.Errorf("assert path = %q, want spec.template.spec.containers[1].env", got)
+	}
+}
+
+func TestConvertWithoutUnitTests(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	if _, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(chartPath, unittestFile)); !os.IsNotExist(err) {
+		t.Errorf("suite written without --unittest")
+	}
+}
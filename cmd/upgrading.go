@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/detect"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/transform"
+	"gopkg.in/yaml.v3"
+)
+
+// upgradingFile is the chart-relative path of the consumer upgrade notes
+const upgradingFile = "UPGRADING.md"
+
+// upgradingExampleItems is the most list items shown in each example
+const upgradingExampleItems = 2
+
+// upgradingSection returns the UPGRADING.md section for the converted
+// candidates, with before/after examples taken from the chart's values. doc
+// is values.yaml before conversion (nil if the chart has none).
+func upgradingSection(heading string, doc *yaml.Node, candidates []k8s.DetectedCandidate, migrationFile string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s\n\n", heading)
+	b.WriteString("The values below changed from lists to maps, so items can be overridden by key\n")
+	b.WriteString("instead of by replacing the whole list. Rewrite any overrides of them in the new\n")
+	b.WriteString("format; list overrides no longer render as intended.\n")
+	if migrationFile != "" {
+		fmt.Fprintf(&b, "Tools can migrate overrides mechanically with `%s`.\n", migrationFile)
+	}
+
+	var root *yaml.Node
+	if doc != nil && len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+	for _, c := range candidates {
+		path := c.ValuesPath
+		if c.NewPath != "" {
+			path = c.NewPath
+		}
+		before, after, keys := upgradingExample(nodeAt(root, strings.Split(c.ValuesPath, ".")...), c)
+		beforeYAML, err := nestedYAML(c.ValuesPath, before)
+		if err != nil {
+			return "", err
+		}
+		afterYAML, err := nestedYAML(path, after)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&b, "\n### `%s`\n\n", c.ValuesPath)
+		switch {
+		case c.Set:
+			b.WriteString("Each item is now a key set to `true`.\n")
+		case c.KeyStrategy == detect.KeyStrategyNested:
+			fmt.Fprintf(&b, "Items are now nested by their `%s`, which are no longer repeated in each item.\n", strings.Join(c.MergeKeys, "`, then `"))
+		case c.KeyStrategy == detect.KeyStrategyComposite:
+			fmt.Fprintf(&b, "Items are now keyed by their `%s` joined with `%s`, which are no longer repeated in each item.\n", strings.Join(c.MergeKeys, "`, `"), detect.CompositeKeySeparator)
+		case c.Synthetic:
+			fmt.Fprintf(&b, "Items are now named by their keys, which aren't rendered. Items without a `%s` were named after their position.\n", c.MergeKey)
+		default:
+			fmt.Fprintf(&b, "Items are now keyed by their `%s`, which is no longer repeated in each item.\n", c.MergeKey)
+		}
+		if c.Shaped() {
+			fmt.Fprintf(&b, "Entries also use a custom shape: %s.\n", c.ShapeDescription())
+		}
+		if c.NewPath != "" {
+			fmt.Fprintf(&b, "The value also moved to `%s`, so overrides must move there too.\n", c.NewPath)
+		}
+		fmt.Fprintf(&b, "\nBefore:\n\n```yaml\n%s```\n\nAfter:\n\n```yaml\n%s```\n", beforeYAML, afterYAML)
+
+		// helm --set paths are dot-separated, so keys with dots can't be shown
+		if len(keys) > 0 && !strings.Contains(strings.Join(keys[0], ""), ".") {
+			entry := path + "." + strings.Join(keys[0], ".")
+			if c.Set {
+				fmt.Fprintf(&b, "\nAdd an item with `--set %s.<value>=true`, and remove one with `--set %s=false`.\n", path, entry)
+			} else {
+				fmt.Fprintf(&b, "\nOverride a field of one item with `--set %s.<field>=<value>`, and remove the item with `--set %s=null`.\n", entry, entry)
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// upgradingExample returns the before and after forms of up to
+// upgradingExampleItems items of a converted list, and the map keys of the
+// items shown (one per level for nested maps). Lists without usable items get
+// a placeholder item.
+func upgradingExample(seq *yaml.Node, c k8s.DetectedCandidate) (*yaml.Node, *yaml.Node, [][]string) {
+	if c.KeyStrategy != "" || c.Shaped() {
+		return keyedUpgradingExample(seq, c)
+	}
+	before := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	after := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	var keys [][]string
+	add := func(item *yaml.Node, key string, rest []*yaml.Node) {
+		before.Content = append(before.Content, withoutComments(item))
+		keys = append(keys, []string{key})
+		if c.Set {
+			after.Content = append(after.Content, scalarNode(key), &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"})
+			return
+		}
+		value := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, n := range rest {
+			value.Content = append(value.Content, withoutComments(n))
+		}
+		if len(rest) == 0 {
+			value.Style = yaml.FlowStyle
+		}
+		after.Content = append(after.Content, scalarNode(key), value)
+	}
+
+	if seq != nil && seq.Kind == yaml.SequenceNode {
+		for n, item := range seq.Content {
+			if len(keys) == upgradingExampleItems {
+				break
+			}
+			if item.Kind == yaml.ScalarNode && c.Set {
+				add(item, item.Value, nil)
+				continue
+			}
+			if item.Kind != yaml.MappingNode {
+				continue
+			}
+			key := ""
+			var rest []*yaml.Node
+			for i := 0; i+1 < len(item.Content); i += 2 {
+				if item.Content[i].Value == c.MergeKey && item.Content[i+1].Kind == yaml.ScalarNode {
+					key = item.Content[i+1].Value
+					continue
+				}
+				rest = append(rest, item.Content[i], item.Content[i+1])
+			}
+			if key == "" && c.Synthetic {
+				key = fmt.Sprintf("%s-%d", c.SectionName, n+1)
+			}
+			if key != "" {
+				add(item, key, rest)
+			}
+		}
+	}
+
+	if len(keys) == 0 {
+		// The chart has no default items to show
+		item := scalarNode("example")
+		if c.Synthetic {
+			item = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Style: yaml.FlowStyle}
+		} else if c.MergeKey != "" {
+			item = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{scalarNode(c.MergeKey), scalarNode("example")}}
+		}
+		add(item, "example", nil)
+	}
+	return before, after, keys
+}
+
+// keyedUpgradingExample is upgradingExample for lists converted by several key
+// fields or with reshaped entries, with the after form generated as convert
+// writes it
+func keyedUpgradingExample(seq *yaml.Node, c k8s.DetectedCandidate) (*yaml.Node, *yaml.Node, [][]string) {
+	keyFields := c.MergeKeys
+	if c.KeyStrategy == "" {
+		keyFields = []string{c.MergeKey}
+	}
+	before := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	if seq != nil && seq.Kind == yaml.SequenceNode {
+		for _, item := range seq.Content {
+			if len(before.Content) == upgradingExampleItems {
+				break
+			}
+			if _, ok := itemKeyValues(item, keyFields); ok {
+				before.Content = append(before.Content, withoutComments(item))
+			}
+		}
+	}
+	if len(before.Content) == 0 {
+		// The chart has no default items to show
+		item := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, k := range keyFields {
+			item.Content = append(item.Content, scalarNode(k), scalarNode("example-"+k))
+		}
+		before.Content = append(before.Content, item)
+	}
+
+	var keys [][]string
+	for _, item := range before.Content {
+		values, _ := itemKeyValues(item, keyFields)
+		if c.KeyStrategy == detect.KeyStrategyComposite {
+			values = []string{strings.Join(values, detect.CompositeKeySeparator)}
+		}
+		keys = append(keys, values)
+	}
+	generated := transform.GenerateKeyedReplacement(before, c)
+	if c.Shaped() {
+		generated = transform.GenerateShapedReplacement(before, c)
+	}
+	after := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	var doc yaml.Node
+	if yaml.Unmarshal([]byte(generated), &doc) == nil && len(doc.Content) > 0 {
+		after = doc.Content[0]
+	}
+	return before, after, keys
+}
+
+// itemKeyValues returns the values of the key fields of a list item, in keys order
+func itemKeyValues(item *yaml.Node, keys []string) ([]string, bool) {
+	if item.Kind != yaml.MappingNode {
+		return nil, false
+	}
+	values := make([]string, len(keys))
+	for i, k := range keys {
+		for j := 0; j+1 < len(item.Content); j += 2 {
+			if item.Content[j].Value == k && item.Content[j+1].Kind == yaml.ScalarNode {
+				values[i] = item.Content[j+1].Value
+			}
+		}
+		if values[i] == "" {
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// nestedYAML renders value under the keys of a dot-separated values path
+func nestedYAML(path string, value *yaml.Node) (string, error) {
+	parts := strings.Split(path, ".")
+	for i := len(parts) - 1; i >= 0; i-- {
+		value = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{scalarNode(parts[i]), value}}
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(value); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// withoutComments returns a deep copy of n with its comments removed, so
+// examples don't carry the chart's documentation
+func withoutComments(n *yaml.Node) *yaml.Node {
+	out := *n
+	out.HeadComment, out.LineComment, out.FootComment = "", "", ""
+	out.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		out.Content[i] = withoutComments(child)
+	}
+	return &out
+}
+
+// writeUpgradingNotes adds the upgrade notes for the converted candidates to
+// the chart's UPGRADING.md, creating it if needed. A section with the same
+// heading, from an earlier conversion to this version, is merged into: notes
+// for values not converted again are kept, so repeated conversions accumulate
+// complete notes as the migration map does.
+func writeUpgradingNotes(root string, doc *yaml.Node, candidates []k8s.DetectedCandidate, migrationFile string) error {
+	if len(candidates) == 0 {
+		return nil
+	}
+	heading := "Upgrading to list-to-map values"
+	if data, err := os.ReadFile(filepath.Join(root, "Chart.yaml")); err == nil {
+		var chart ChartYAML
+		if yaml.Unmarshal(data, &chart) == nil && chart.Version != "" {
+			heading = "Upgrading to " + chart.Version
+		}
+	}
+	section, err := upgradingSection(heading, doc, candidates, migrationFile)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(root, upgradingFile)
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	out := mergeMarkdownSection(string(existing), "## "+heading, section)
+	if err := rewriteFile(path, []byte(out)); err != nil {
+		return err
+	}
+	fmt.Printf("\nWrote upgrade notes: %s (%s)\n", upgradingFile, heading)
+	return nil
+}
+
+// mergeMarkdownSection merges section into the section starting with the
+// heading line in doc, up to the next heading of the same level. The merged
+// section has section's text before its first subsection, then the existing
+// subsections, each replaced by the one in section with the same heading line,
+// and then section's other subsections. A missing section is appended, and an
+// empty doc gets a title first.
+func mergeMarkdownSection(doc, heading, section string) string {
+	if strings.TrimSpace(doc) == "" {
+		return "# Upgrading\n\n" + section
+	}
+	lines := strings.SplitAfter(doc, "\n")
+	start := -1
+	for i, l := range lines {
+		if strings.TrimRight(l, "\r\n") == heading {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return strings.TrimRight(doc, "\n") + "\n\n" + section
+	}
+	end := len(lines)
+	for i := start + 1; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], "## ") {
+			end = i
+			break
+		}
+	}
+
+	_, existing := markdownSubsections(strings.Join(lines[start:end], ""))
+	intro, added := markdownSubsections(section)
+	replaced := make(map[string]string, len(added))
+	for _, sub := range added {
+		replaced[sub[0]] = sub[1]
+	}
+	merged := strings.TrimRight(intro, "\n")
+	for _, sub := range existing {
+		if body, ok := replaced[sub[0]]; ok {
+			sub[1] = body
+			delete(replaced, sub[0])
+		}
+		merged += "\n\n" + strings.TrimRight(sub[1], "\n")
+	}
+	for _, sub := range added {
+		if _, ok := replaced[sub[0]]; ok {
+			merged += "\n\n" + strings.TrimRight(sub[1], "\n")
+		}
+	}
+	merged += "\n"
+
+	rest := strings.Join(lines[end:], "")
+	if rest != "" {
+		merged += "\n"
+	}
+	return strings.Join(lines[:start], "") + merged + rest
+}
+
+// markdownSubsections splits a section into its text before the first "### "
+// heading and its subsections, each as its heading line and its full text
+func markdownSubsections(section string) (string, [][2]string) {
+	var intro strings.Builder
+	var subs [][2]string
+	for _, l := range strings.SplitAfter(section, "\n") {
+		if strings.HasPrefix(l, "### ") {
+			subs = append(subs, [2]string{strings.TrimRight(l, "\r\n"), ""})
+		}
+		if len(subs) == 0 {
+			intro.WriteString(l)
+			continue
+		}
+		subs[len(subs)-1][1] += l
+	}
+	return intro.String(), subs
+}
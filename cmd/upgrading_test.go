@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"gopkg.in/yaml.v3"
+)
+
+func TestConvertUpgrading(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	existing := "# Upgrading\n\n## Upgrading to 0.1.0\n\nFirst release.\n"
+	if err := os.WriteFile(filepath.Join(chartPath, upgradingFile), []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak", BumpVersion: "major", Upgrading: true, MigrationFile: "values-migration.yaml"})
+	})
+	if err != nil {
+		t.Fatalf("runConvert failed: %v\nOutput: %s", err, output)
+	}
+
+	data, err := os.ReadFile(filepath.Join(chartPath, upgradingFile))
+	if err != nil {
+		t.Fatalf("%s not written: %v", upgradingFile, err)
+	}
+	notes := string(data)
+	for _, want := range []string{
+		existing + "\n## Upgrading to 1.0.0\n",
+		"mechanically with `values-migration.yaml`",
+		"### `env`\n\nItems are now keyed by their `name`",
+		"```yaml\nenv:\n  - name: DB_HOST\n    value: localhost\n",
+		"```yaml\nenv:\n  DB_HOST:\n    value: localhost\n",
+		"`--set env.DB_HOST=null`",
+		"### `volumes`",
+	} {
+		if !strings.Contains(notes, want) {
+			t.Errorf("%s should contain %q, got:\n%s", upgradingFile, want, notes)
+		}
+	}
+}
+
+func TestUpgradingSectionSet(t *testing.T) {
+	t.Parallel()
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte("imagePullSecrets:\n  - name: regcred\n# Hosts served\nhosts: []\n"), &doc); err != nil {
+		t.Fatal(err)
+	}
+	candidates := []k8s.DetectedCandidate{
+		{ValuesPath: "imagePullSecrets", MergeKey: "name", Set: true},
+		{ValuesPath: "hosts", MergeKey: "host"},
+	}
+	section, err := upgradingSection("Upgrading to 2.0.0", &doc, candidates, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"## Upgrading to 2.0.0\n",
+		"```yaml\nimagePullSecrets:\n  - name: regcred\n```",
+		"```yaml\nimagePullSecrets:\n  regcred: true\n```",
+		"`--set imagePullSecrets.regcred=false`",
+		// Empty lists are shown with a placeholder item
+		"```yaml\nhosts:\n  - host: example\n```",
+		"```yaml\nhosts:\n  example: {}\n```",
+	} {
+		if !strings.Contains(section, want) {
+			t.Errorf("section should contain %q, got:\n%s", want, section)
+		}
+	}
+	if strings.Contains(section, "Hosts served") || strings.Contains(section, "mechanically") {
+		t.Errorf("section should have no values comments or migration file note, got:\n%s", section)
+	}
+}
+
+func TestMergeMarkdownSection(t *testing.T) {
+	t.Parallel()
+
+	doc := "# Upgrading\n\n## Upgrading to 2.0.0\n\nOld notes.\n\n### `env`\n\nOld env.\n\n### `volumes`\n\nKept volumes.\n\n## Upgrading to 1.0.0\n\nKept.\n"
+	got := mergeMarkdownSection(doc, "## Upgrading to 2.0.0", "## Upgrading to 2.0.0\n\nNew notes.\n\n### `ports`\n\nNew ports.\n\n### `env`\n\nNew env.\n")
+	want := "# Upgrading\n\n## Upgrading to 2.0.0\n\nNew notes.\n\n### `env`\n\nNew env.\n\n### `volumes`\n\nKept volumes.\n\n### `ports`\n\nNew ports.\n\n## Upgrading to 1.0.0\n\nKept.\n"
+	if got != want {
+		t.Errorf("mergeMarkdownSection() =\n%s\nwant:\n%s", got, want)
+	}
+	if got := mergeMarkdownSection("", "## A", "## A\n"); got != "# Upgrading\n\n## A\n" {
+		t.Errorf("mergeMarkdownSection() on empty doc = %q", got)
+	}
+	if got := mergeMarkdownSection("# Upgrading\n", "## A", "## A\n"); got != "# Upgrading\n\n## A\n" {
+		t.Errorf("mergeMarkdownSection() with a missing section = %q", got)
+	}
+}
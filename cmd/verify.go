@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/transform"
+	"gopkg.in/yaml.v3"
+)
+
+// verifyCase is one render compared by verify: the chart defaults, or an
+// override file as consumers pass it before and after conversion
+type verifyCase struct {
+	Name      string   // Override file relative to --with-overrides, or "chart defaults"
+	Before    []string // Values files for the chart before conversion
+	After     []string // Values files for the converted chart
+	Converted []string // Paths converted in the override file
+}
+
+// runVerify renders the chart as it was before conversion and as it is now,
+// with its defaults and with each override file, and reports the renders that
+// differ. Override files are converted with the chart's migration map for the
+// converted chart, as its consumers would convert them.
+func runVerify(opts VerifyOptions) error {
+	root, err := findChartRoot(opts.ChartDir)
+	if err != nil {
+		return err
+	}
+
+	original, source, cleanup, err := originalChart(root, opts)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	cases := []verifyCase{{Name: "chart defaults"}}
+	if opts.Overrides != "" {
+		candidates, err := migrationCandidates(root, opts.MigrationFile)
+		if err != nil {
+			return err
+		}
+		tmp, err := os.MkdirTemp("", "list-to-map-verify-")
+		if err != nil {
+			return err
+		}
+		defer func() { _ = os.RemoveAll(tmp) }()
+
+		files, err := overrideFiles(opts.Overrides)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("no override files (*.yaml, *.yml) in %s", opts.Overrides)
+		}
+		for i, f := range files {
+			converted, paths, err := convertOverride(f, candidates, filepath.Join(tmp, fmt.Sprintf("%d-%s", i, filepath.Base(f))))
+			if err != nil {
+				return fmt.Errorf("converting %s: %w", f, err)
+			}
+			cases = append(cases, verifyCase{Name: rel(opts.Overrides, f), Before: []string{f}, After: []string{converted}, Converted: paths})
+		}
+	}
+
+	fmt.Printf("Comparing renders of %s with %s:\n", root, source)
+	type failure struct {
+		Case          verifyCase
+		Before, After map[string]string
+	}
+	var failed []failure
+	for _, c := range cases {
+		before, err := renderManifests(original, c.Before...)
+		if err != nil {
+			return fmt.Errorf("rendering the chart before conversion with %s: %w", c.Name, err)
+		}
+		after, err := renderManifests(root, c.After...)
+		if err != nil {
+			return fmt.Errorf("rendering the converted chart with %s: %w", c.Name, err)
+		}
+
+		name := c.Name
+		if len(c.Converted) > 0 {
+			name += fmt.Sprintf(" (converted %s)", strings.Join(c.Converted, ", "))
+		}
+		changed, reordered := splitReordered(changedManifests(before, after), before, after)
+		if len(changed) == 0 && len(reordered) > 0 {
+			fmt.Printf("  %s: %s\n", name, green(fmt.Sprintf("renders the same, with list items reordered in %d manifest file(s)", len(reordered))))
+			continue
+		}
+		if len(changed) == 0 {
+			fmt.Printf("  %s: %s\n", name, green("renders the same"))
+			continue
+		}
+		fmt.Printf("  %s: %s\n", name, yellow(fmt.Sprintf("%d manifest file(s) render differently", len(changed))))
+		failed = append(failed, failure{c, before, after})
+	}
+
+	if len(failed) == 0 {
+		fmt.Println("\n" + green("Consumers' overrides render the same after conversion."))
+		return nil
+	}
+	for _, f := range failed {
+		changed, _ := splitReordered(changedManifests(f.Before, f.After), f.Before, f.After)
+		for _, name := range changed {
+			fmt.Printf("\n=== %s with %s (before/after conversion) ===\n", name, f.Case.Name)
+			printHunks(name, f.Before[name], f.After[name])
+		}
+	}
+	return fmt.Errorf("%d of %d render(s) differ after conversion", len(failed), len(cases))
+}
+
+// splitReordered splits the manifest files rendering differently into those
+// that changed and those whose only change is the order of list items. The
+// helper renders converted maps in key order, so a keyed list whose items were
+// in another order renders the same objects differently ordered, which
+// Kubernetes treats alike.
+func splitReordered(names []string, before, after map[string]string) (changed, reordered []string) {
+	for _, name := range names {
+		b, errB := parseManifests(before[name])
+		a, errA := parseManifests(after[name])
+		if errB == nil && errA == nil && reflect.DeepEqual(sortListItems(b), sortListItems(a)) {
+			reordered = append(reordered, name)
+			continue
+		}
+		changed = append(changed, name)
+	}
+	return changed, reordered
+}
+
+// parseManifests parses the YAML documents of a manifest file
+func parseManifests(content string) ([]interface{}, error) {
+	var docs []interface{}
+	dec := yaml.NewDecoder(strings.NewReader(content))
+	for {
+		var doc interface{}
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+}
+
+// sortListItems sorts, at every level of v, the items of lists of objects by
+// their JSON encoding, so lists holding the same objects compare equal. Lists
+// of scalars, such as args, keep their order, which matters.
+func sortListItems(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = sortListItems(item)
+		}
+	case []interface{}:
+		objects := true
+		for i, item := range v {
+			v[i] = sortListItems(item)
+			if _, ok := v[i].(map[string]interface{}); !ok {
+				objects = false
+			}
+		}
+		if objects {
+			sort.SliceStable(v, func(i, j int) bool {
+				a, _ := json.Marshal(v[i])
+				b, _ := json.Marshal(v[j])
+				return string(a) < string(b)
+			})
+		}
+	}
+	return v
+}
+
+// originalChart returns the chart as it was before conversion, and a
+// description of where it came from: opts.Original if set (a chart path or
+// reference), or else a copy of the chart with each file restored from its
+// oldest backup. The returned func removes any copy.
+func originalChart(root string, opts VerifyOptions) (string, string, func(), error) {
+	if opts.Original != "" {
+		original, cleanup, err := resolveChartRef(opts.Original, "")
+		return original, opts.Original, cleanup, err
+	}
+
+	noop := func() {}
+	snapshots, err := listBackupSnapshots(root, opts.BackupExt)
+	if err != nil {
+		return "", "", noop, fmt.Errorf("listing backups: %w", err)
+	}
+	if len(snapshots) == 0 {
+		return "", "", noop, fmt.Errorf("no backups with extension %q found under %s: pass the chart as it was before conversion with --original", opts.BackupExt, root)
+	}
+
+	tmp, err := os.MkdirTemp("", "list-to-map-original-")
+	if err != nil {
+		return "", "", noop, err
+	}
+	cleanup := func() { _ = os.RemoveAll(tmp) }
+	original := filepath.Join(tmp, filepath.Base(root))
+	if err := copyDir(root, original); err != nil {
+		return "", "", cleanup, fmt.Errorf("copying chart: %w", err)
+	}
+	// A file's oldest backup holds it as it was before any conversion
+	restored := make(map[string]bool)
+	for _, s := range snapshots {
+		for _, f := range s.Files {
+			name := rel(root, f.Original)
+			if restored[name] {
+				continue
+			}
+			restored[name] = true
+			data, err := os.ReadFile(f.Backup)
+			if err != nil {
+				return "", "", cleanup, fmt.Errorf("reading backup: %w", err)
+			}
+			if err := os.WriteFile(filepath.Join(original, name), data, fileMode(f.Original)); err != nil {
+				return "", "", cleanup, fmt.Errorf("restoring %s: %w", name, err)
+			}
+		}
+	}
+	return original, fmt.Sprintf("its backups (from snapshot %s)", snapshots[0].ID), cleanup, nil
+}
+
+// migrationCandidates returns the paths recorded as converted in the chart's
+// migration map, to convert override files with
+func migrationCandidates(root, migrationFile string) (map[string]k8s.DetectedCandidate, error) {
+	path := migrationFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	m, err := readMigrationFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no migration map at %s: convert the chart with --migration-file to record one", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make(map[string]k8s.DetectedCandidate)
+	for _, f := range m.Fields {
+		if f.Old.Shape != "list" || (f.New.Shape != "map" && f.New.Shape != "set") {
+			continue
+		}
+		parts := strings.Split(f.Old.Path, ".")
+		candidates[f.Old.Path] = k8s.DetectedCandidate{
+			ValuesPath:  f.Old.Path,
+			MergeKey:    f.New.Key,
+			SectionName: parts[len(parts)-1],
+			ElementType: f.ElementType,
+			Set:         f.New.Shape == "set",
+			MergeKeys:   f.New.Keys,
+			KeyStrategy: f.New.KeyStrategy,
+			Rename:      f.New.Rename,
+			Scalar:      f.New.Scalar,
+			Synthetic:   f.New.Synthetic,
+		}
+		if f.New.Path != f.Old.Path {
+			c := candidates[f.Old.Path]
+			c.NewPath = f.New.Path
+			candidates[f.Old.Path] = c
+		}
+	}
+	return candidates, nil
+}
+
+// overrideFiles returns the YAML files under dir, in lexical order
+func overrideFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// convertOverride converts the candidate lists of an override file, moving
+// those renamed to their new paths, and writes the result to dst. Returns dst
+// and the converted paths.
+func convertOverride(path string, candidates map[string]k8s.DetectedCandidate, dst string) (string, []string, error) {
+	doc, raw, err := loadValuesNode(path)
+	if err != nil {
+		return "", nil, err
+	}
+	candidates, _ = withoutMergedLists(doc, candidates)
+	var edits []transform.ArrayEdit
+	transform.FindArrayEdits(doc, nil, candidates, &edits)
+	var paths []string
+	var converted []k8s.DetectedCandidate
+	for _, e := range edits {
+		paths = append(paths, e.Candidate.ValuesPath)
+		converted = append(converted, e.Candidate)
+	}
+	out, _, err := moveRenamedValues(transform.ApplyLineEdits(raw, edits), converted)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := os.WriteFile(dst, out, 0600); err != nil {
+		return "", nil, err
+	}
+	return dst, paths, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+// fakeHelmOverrides installs a helm stand-in that renders the override file
+// passed with -f, in its order, reading a list item's name as the key of a map
+// entry, like a template ranging over either shape by name would
+func fakeHelmOverrides(t *testing.T) {
+	t.Helper()
+	script := `#!/bin/sh
+printf -- '---\n# Source: basic/templates/overrides.yaml\n'
+[ -n "$5" ] && grep -v '^ *#' "$5" | sed -e 's/^ *- name: \(.*\)/\1:/' -e 's/^ *//'
+exit 0
+`
+	bin := filepath.Join(t.TempDir(), "helm")
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HELM_BIN", bin)
+}
+
+func TestVerify(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	fakeHelmOverrides(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	if _, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{ChartDir: chartPath, BackupExt: ".bak", MigrationFile: "values-migration.yaml"})
+	}); err != nil {
+		t.Fatalf("runConvert failed: %v", err)
+	}
+
+	overrides := t.TempDir()
+	files := map[string]string{
+		// Keyed by name, so the stand-in renders both shapes alike
+		"env.yaml": "env:\n  - name: DB_HOST\n    value: prod-db\n",
+		// Keyed by mountPath once converted
+		"mounts.yaml": "volumeMounts:\n  - name: data\n    mountPath: /srv\n",
+		"notes.txt":   "not an override",
+	}
+	writeChartFiles(t, overrides, files)
+
+	opts := VerifyOptions{ChartDir: chartPath, Overrides: overrides, MigrationFile: "values-migration.yaml", BackupExt: ".bak"}
+	output, err := captureOutput(t, func() error { return runVerify(opts) })
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 render(s) differ") {
+		t.Fatalf("runVerify() error = %v, want one differing render\nOutput: %s", err, output)
+	}
+	for _, want := range []string{
+		"chart defaults: renders the same",
+		"env.yaml (converted env): renders the same",
+		"mounts.yaml (converted volumeMounts): 1 manifest file(s) render differently",
+		"=== basic/templates/overrides.yaml with mounts.yaml (before/after conversion) ===",
+		"+/srv:",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q\nOutput: %s", want, output)
+		}
+	}
+
+	// The override files themselves are left as they are
+	if data, _ := os.ReadFile(filepath.Join(overrides, "env.yaml")); string(data) != files["env.yaml"] {
+		t.Errorf("env.yaml was modified:\n%s", data)
+	}
+}
+
+func TestVerifyWithoutBackups(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	err := runVerify(VerifyOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	if err == nil || !strings.Contains(err.Error(), "--original") {
+		t.Errorf("runVerify() error = %v, want a hint to pass --original", err)
+	}
+}
+
+func TestSplitReordered(t *testing.T) {
+	before := map[string]string{
+		"env.yaml":  "env:\n- name: B\n  value: b\n- name: A\n  value: a\n",
+		"args.yaml": "args: [--b, --a]\n",
+		"port.yaml": "ports:\n- containerPort: 80\n- containerPort: 443\n",
+	}
+	after := map[string]string{
+		// The helper renders the converted map in key order
+		"env.yaml": "env:\n- name: A\n  value: a\n- name: B\n  value: b\n",
+		// Scalar lists keep their order
+		"args.yaml": "args: [--a, --b]\n",
+		"port.yaml": "ports:\n- containerPort: 443\n- containerPort: 8080\n",
+	}
+	changed, reordered := splitReordered([]string{"args.yaml", "env.yaml", "port.yaml"}, before, after)
+	if !reflect.DeepEqual(changed, []string{"args.yaml", "port.yaml"}) {
+		t.Errorf("changed = %v, want args.yaml and port.yaml", changed)
+	}
+	if !reflect.DeepEqual(reordered, []string{"env.yaml"}) {
+		t.Errorf("reordered = %v, want env.yaml", reordered)
+	}
+}
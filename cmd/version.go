@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/template"
+)
+
+// version is the plugin version, set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+// helperFile is the chart-relative path of the generated helper template
+var helperFile = filepath.Join("templates", "_listmap.tpl")
+
+func runVersion(opts VersionOptions) error {
+	fmt.Printf("Plugin version: %s\n", version)
+	fmt.Printf("Helper version: %d\n", template.HelperVersion)
+
+	if opts.ChartDir == "" {
+		return nil
+	}
+	root, err := findChartRoot(opts.ChartDir)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, helperFile))
+	if os.IsNotExist(err) {
+		fmt.Printf("Chart helper:   not found (%s)\n", helperFile)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading helper: %w", err)
+	}
+
+	v := template.ParseHelperVersion(string(data))
+	switch {
+	case v < template.HelperVersion:
+		fmt.Printf("Chart helper:   version %d, older than %d\n", v, template.HelperVersion)
+		fmt.Println("  Changes since:")
+		printHelperChanges(v, "    ")
+		fmt.Printf("  Run 'helm list-to-map upgrade-helpers --chart %s' to refresh it.\n", opts.ChartDir)
+	case v > template.HelperVersion:
+		fmt.Printf("Chart helper:   version %d, newer than this plugin supports\n", v)
+		fmt.Println("  Update the plugin with 'helm plugin update list-to-map'.")
+	default:
+		fmt.Printf("Chart helper:   version %d, up to date\n", v)
+	}
+	return nil
+}
+
+// runUpgradeHelpers replaces the generated helpers of a chart and its
+// subcharts with this plugin version's, listing how each upgrade changes what
+// the chart renders. Values are left alone.
+func runUpgradeHelpers(opts UpgradeHelpersOptions) error {
+	root, err := findChartRoot(opts.ChartDir)
+	if err != nil {
+		return err
+	}
+
+	helpers := findHelperFiles(root)
+	if len(helpers) == 0 {
+		return fmt.Errorf("no helper found at %s; run 'helm list-to-map convert' first", helperFile)
+	}
+
+	var newer int
+	for _, path := range helpers {
+		chartRoot := filepath.Dir(filepath.Dir(path))
+		ok, err := upgradeHelper(chartRoot, rel(root, path), opts.BackupExt)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			newer++
+		}
+	}
+	if newer > 0 {
+		return fmt.Errorf("%d helper(s) newer than this plugin's version %d; update the plugin instead", newer, template.HelperVersion)
+	}
+	return nil
+}
+
+// upgradeHelper replaces the generated helper of the chart at chartRoot, shown
+// as name, reporting false if it is newer than this plugin's
+func upgradeHelper(chartRoot, name, backupExt string) (bool, error) {
+	// The chart config may set a custom helper name
+	restore, err := useChartConfig(chartRoot)
+	defer restore()
+	if err != nil {
+		return false, err
+	}
+	o, err := templateOptions(chartRoot)
+	if err != nil {
+		return false, err
+	}
+
+	path := filepath.Join(chartRoot, helperFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("reading helper: %w", err)
+	}
+
+	v := template.ParseHelperVersion(string(data))
+	if v > template.HelperVersion {
+		fmt.Println(red(fmt.Sprintf("%s is version %d, newer than this plugin's (%d); left as is.", name, v, template.HelperVersion)))
+		return false, nil
+	}
+
+	expected := strings.TrimSpace(o.ListMapHelper()) + "\n"
+	if string(data) == expected {
+		fmt.Printf("%s is up to date (version %d).\n", name, v)
+		return true, nil
+	}
+
+	ext := snapshotBackupExt(chartRoot, backupExt)
+	if err := backupFile(path, ext, data); err != nil {
+		return false, fmt.Errorf("backing up helper: %w", err)
+	}
+	if err := rewriteFile(path, []byte(expected)); err != nil {
+		return false, fmt.Errorf("writing helper: %w", err)
+	}
+
+	if v == template.HelperVersion {
+		fmt.Printf("Restored %s to version %d, replacing local changes.\n", name, v)
+	} else {
+		fmt.Printf("Upgraded %s from version %d to %d:\n", name, v, template.HelperVersion)
+		printHelperChanges(v, "  ")
+	}
+	fmt.Printf("  Backup: %s\n", name+ext)
+	return true, nil
+}
+
+// printHelperChanges lists the helper changes made after version v
+func printHelperChanges(v int, indent string) {
+	for _, c := range template.HelperChangesSince(v) {
+		fmt.Printf("%sv%d: %s\n", indent, c.Version, c.Summary)
+	}
+}
+
+// findHelperFiles returns the generated helpers of the chart under dir and
+// of its subcharts
+func findHelperFiles(dir string) []string {
+	var helpers []string
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && (d.Name() == ".git" || d.Name() == "node_modules") {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && d.Name() == filepath.Base(helperFile) && filepath.Base(filepath.Dir(path)) == filepath.Dir(helperFile) {
+			helpers = append(helpers, path)
+		}
+		return nil
+	})
+	return helpers
+}
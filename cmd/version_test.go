@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/template"
+)
+
+// legacyHelper is a helper template written before helper versioning
+const legacyHelper = `{{- define "chart.listmap.items" -}}
+{{- range $keyVal := keys .items | sortAlpha }}
+- {{ $.key }}: {{ $keyVal | quote }}
+{{- end }}
+{{- end -}}
+`
+
+func TestVersionReportsOlderChartHelper(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	if err := os.WriteFile(filepath.Join(chartPath, helperFile), []byte(legacyHelper), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runVersion(VersionOptions{ChartDir: chartPath})
+	})
+	if err != nil {
+		t.Fatalf("runVersion failed: %v", err)
+	}
+	for _, want := range []string{"Plugin version: dev", "Chart helper:   version 0, older than", "v1: ", "upgrade-helpers"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q\nGot:\n%s", want, output)
+		}
+	}
+}
+
+func TestUpgradeHelpers(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	path := filepath.Join(chartPath, helperFile)
+	if err := os.WriteFile(path, []byte(legacyHelper), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runUpgradeHelpers(UpgradeHelpersOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runUpgradeHelpers failed: %v\nOutput: %s", err, output)
+	}
+
+	if !strings.Contains(output, "Upgraded templates/_listmap.tpl from version 0") || !strings.Contains(output, "v7: Sorts numeric keys") {
+		t.Errorf("expected the upgrade to list the changes, got:\n%s", output)
+	}
+
+	data, _ := os.ReadFile(path)
+	if got := template.ParseHelperVersion(string(data)); got != template.HelperVersion {
+		t.Errorf("upgraded helper version = %d, want %d", got, template.HelperVersion)
+	}
+	backups, _ := filepath.Glob(path + ".*.bak")
+	if len(backups) != 1 {
+		t.Errorf("expected one helper backup, got %v", backups)
+	}
+
+	// A second run has nothing to do
+	output, err = captureOutput(t, func() error {
+		return runUpgradeHelpers(UpgradeHelpersOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil || !strings.Contains(output, "up to date") {
+		t.Errorf("second upgrade should report up to date, err = %v\nOutput: %s", err, output)
+	}
+}
+
+func TestUpgradeHelpersSubcharts(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/umbrella")
+	rootHelper := filepath.Join(chartPath, helperFile)
+	subHelper := filepath.Join(chartPath, "subcharts", "subchart-a", helperFile)
+	for _, path := range []string{rootHelper, subHelper} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The umbrella's helper is current, the subchart's predates versioning
+	current := strings.TrimSpace(template.Options{}.ListMapHelper()) + "\n"
+	if err := os.WriteFile(rootHelper, []byte(current), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(subHelper, []byte(legacyHelper), 0644); err != nil {
+		t.Fatal(err)
+	}
+	values, err := os.ReadFile(filepath.Join(chartPath, "subcharts", "subchart-a", "values.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureOutput(t, func() error {
+		return runUpgradeHelpers(UpgradeHelpersOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err != nil {
+		t.Fatalf("runUpgradeHelpers failed: %v\nOutput: %s", err, output)
+	}
+	for _, want := range []string{
+		"templates/_listmap.tpl is up to date",
+		filepath.Join("subcharts", "subchart-a", helperFile) + " from version 0 to",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q\nGot:\n%s", want, output)
+		}
+	}
+	data, _ := os.ReadFile(subHelper)
+	if got := template.ParseHelperVersion(string(data)); got != template.HelperVersion {
+		t.Errorf("subchart helper version = %d, want %d", got, template.HelperVersion)
+	}
+	after, _ := os.ReadFile(filepath.Join(chartPath, "subcharts", "subchart-a", "values.yaml"))
+	if string(after) != string(values) {
+		t.Error("upgrading helpers should not touch values")
+	}
+
+	// A helper from a newer plugin is left alone and reported
+	newer := strings.Replace(current, fmt.Sprintf("version %d", template.HelperVersion), fmt.Sprintf("version %d", template.HelperVersion+1), 1)
+	if err := os.WriteFile(subHelper, []byte(newer), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err = captureOutput(t, func() error {
+		return runUpgradeHelpers(UpgradeHelpersOptions{ChartDir: chartPath, BackupExt: ".bak"})
+	})
+	if err == nil || !strings.Contains(err.Error(), "1 helper(s) newer") {
+		t.Errorf("expected an error for the newer helper, got %v\nOutput: %s", err, output)
+	}
+	if data, _ := os.ReadFile(subHelper); string(data) != newer {
+		t.Error("newer helper should be left as is")
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	pkgfs "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+)
+
+// watchInterval is how often detect --watch polls the chart for changes
+const watchInterval = time.Second
+
+// runDetectWatch prints a full detection, then watches the chart and prints
+// the findings that appear or go away each time its files change, until
+// interrupted. With --recursive or --include-charts-dir, the subcharts detect
+// reports are watched along with the chart.
+func runDetectWatch(opts DetectOptions) error {
+	if opts.Check {
+		return fmt.Errorf("--watch cannot be combined with --check")
+	}
+	if opts.ExpandRemote {
+		return fmt.Errorf("--watch cannot be combined with --expand-remote: remote subcharts are extracted once and don't change")
+	}
+	root, err := findChartRoot(opts.ChartDir)
+	if err != nil {
+		return err
+	}
+	if err := runDetect(opts); err != nil {
+		return err
+	}
+	charts, err := watchedCharts(root, opts)
+	if err != nil {
+		return err
+	}
+	// runDetect's target release, schema source, and config data key end
+	// with it; keep the flags' for the watch
+	restoreKube, err := useKubeVersion(opts.KubeVersion)
+	defer restoreKube()
+	if err != nil {
+		return err
+	}
+	restoreSchema, err := useSchemaSource(opts.SchemaSource)
+	defer restoreSchema()
+	if err != nil {
+		return err
+	}
+	defer useConfigDataKey(opts.ConfigDataKey)()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fmt.Println()
+	return watchChart(ctx, charts, watchInterval, os.Stdout)
+}
+
+// watchedChart is a chart detect --watch follows, with the prefix its
+// findings are reported under ("" for the chart itself)
+type watchedChart struct {
+	root   string
+	prefix string
+}
+
+// watchedCharts returns the chart at root and, with --recursive or
+// --include-charts-dir, the subcharts detect reports for those flags
+func watchedCharts(root string, opts DetectOptions) ([]watchedChart, error) {
+	charts := []watchedChart{{root: root}}
+	if !opts.Recursive && !opts.IncludeChartsDir {
+		return charts, nil
+	}
+	subcharts, err := collectSubcharts(root, opts.Recursive, opts.IncludeChartsDir, false, "")
+	if err != nil {
+		return nil, fmt.Errorf("collecting subcharts: %w", err)
+	}
+	for _, sub := range subcharts {
+		if _, err := os.Stat(filepath.Join(sub.Path, "Chart.yaml")); err != nil {
+			continue // Reported missing by detect
+		}
+		charts = append(charts, watchedChart{root: sub.Path, prefix: sub.Name + ": "})
+	}
+	return charts, nil
+}
+
+// watchChart re-runs detection whenever the files of the watched charts
+// change and prints the difference from the previous run
+func watchChart(ctx context.Context, charts []watchedChart, interval time.Duration, w io.Writer) error {
+	stamp, err := chartsStamp(charts)
+	if err != nil {
+		return err
+	}
+	prev, err := watchFindings(charts)
+	if err != nil {
+		return err
+	}
+	if len(charts) > 1 {
+		fmt.Fprintf(w, "Watching %s and %d subchart(s) for changes (Ctrl+C to stop)...\n", charts[0].root, len(charts)-1)
+	} else {
+		fmt.Fprintf(w, "Watching %s for changes (Ctrl+C to stop)...\n", charts[0].root)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		s, err := chartsStamp(charts)
+		if err != nil || s == stamp {
+			continue
+		}
+		stamp = s
+
+		findings, err := watchFindings(charts)
+		if err != nil {
+			// Files are often mid-edit; report and keep watching
+			fmt.Fprintf(w, "[%s] %s\n", time.Now().Format("15:04:05"), yellow(fmt.Sprintf("Warning: %v", err)))
+			continue
+		}
+		printWatchChanges(w, prev, findings)
+		prev = findings
+	}
+}
+
+// watchFindings returns the convertible and skipped paths of the watched
+// charts, each with a short description, keyed by path under each chart's
+// prefix
+func watchFindings(charts []watchedChart) (map[string]string, error) {
+	findings := make(map[string]string)
+	for _, c := range charts {
+		if err := chartFindings(c, findings); err != nil {
+			return nil, err
+		}
+	}
+	return findings, nil
+}
+
+// chartFindings adds the convertible and skipped paths of one watched chart
+// to findings
+func chartFindings(chart watchedChart, findings map[string]string) error {
+	// Apply the chart's own config over the user config
+	restore, err := useChartConfig(chart.root)
+	defer restore()
+	if err != nil {
+		return err
+	}
+
+	collected, err := collectConvertCandidates(chart.root)
+	if err != nil {
+		return err
+	}
+	for _, c := range collected.Matched {
+		findings[chart.prefix+c.ValuesPath] = fmt.Sprintf("convertible, key=%s", c.MergeKey)
+	}
+	for _, p := range collected.Skipped {
+		findings[chart.prefix+p] = "unsupported template pattern"
+	}
+	return nil
+}
+
+// printWatchChanges prints the findings added, changed, and resolved since prev
+func printWatchChanges(w io.Writer, prev, findings map[string]string) {
+	paths := make([]string, 0, len(prev)+len(findings))
+	for path := range findings {
+		paths = append(paths, path)
+	}
+	for path := range prev {
+		if _, ok := findings[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var lines []string
+	for _, path := range paths {
+		desc, ok := findings[path]
+		old, had := prev[path]
+		switch {
+		case !had:
+			lines = append(lines, green(fmt.Sprintf("  + %s (%s)", path, desc)))
+		case !ok:
+			lines = append(lines, red(fmt.Sprintf("  - %s (%s)", path, old)))
+		case old != desc:
+			lines = append(lines, yellow(fmt.Sprintf("  ~ %s (%s, was %s)", path, desc, old)))
+		}
+	}
+
+	now := time.Now().Format("15:04:05")
+	if len(lines) == 0 {
+		fmt.Fprintf(w, "[%s] Chart changed; findings unchanged (%d).\n", now, len(findings))
+		return
+	}
+	fmt.Fprintf(w, "[%s] Chart changed; %d finding(s):\n", now, len(findings))
+	for _, l := range lines {
+		fmt.Fprintln(w, l)
+	}
+}
+
+// chartsStamp returns a fingerprint of the files detection reads in every
+// watched chart
+func chartsStamp(charts []watchedChart) (string, error) {
+	var b strings.Builder
+	for _, c := range charts {
+		s, err := chartStamp(c.root)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(s)
+	}
+	return b.String(), nil
+}
+
+// chartStamp returns a fingerprint of the files detection reads: values.yaml,
+// Chart.yaml, the chart config, and templates
+func chartStamp(root string) (string, error) {
+	var b strings.Builder
+	for _, name := range []string{"values.yaml", "Chart.yaml", chartConfigFile} {
+		if info, err := os.Stat(filepath.Join(root, name)); err == nil {
+			fmt.Fprintf(&b, "%s %d %d\n", name, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	err := pkgfs.WalkTemplates(pkgfs.OSFileSystem{}, root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // Removed while walking
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return b.String(), err
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+// syncBuffer is a bytes.Buffer safe to read while the watcher writes to it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWatchChart(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	initColor(true)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	ctx, cancel := context.WithCancel(context.Background())
+	var out syncBuffer
+	done := make(chan error, 1)
+	go func() {
+		done <- watchChart(ctx, []watchedChart{{root: chartPath}}, 10*time.Millisecond, &out)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("watchChart() error = %v", err)
+		}
+	}()
+
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !strings.Contains(out.String(), want) {
+			if time.Now().After(deadline) {
+				t.Fatalf("output never contained %q:\n%s", want, out.String())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitFor("Watching ")
+
+	// Opting a list out resolves its finding
+	valuesPath := filepath.Join(chartPath, "values.yaml")
+	values, _ := os.ReadFile(valuesPath)
+	updated := strings.Replace(string(values), "volumes:", "volumes: # list-to-map: ignore", 1)
+	if err := os.WriteFile(valuesPath, []byte(updated), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("  - volumes (convertible, key=name)")
+
+	// Touching a template without changing what it renders reports no change
+	tmpl := filepath.Join(chartPath, "templates", "deployment.yaml")
+	data, _ := os.ReadFile(tmpl)
+	if err := os.WriteFile(tmpl, append(data, '\n'), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("findings unchanged")
+
+	// Removing the opt-out brings it back
+	if err := os.WriteFile(valuesPath, values, 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("  + volumes (convertible, key=name)")
+}
+
+func TestWatchChartRecursive(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+	initColor(true)
+
+	chartPath := copyChartForTest(t, "testdata/charts/umbrella")
+	charts, err := watchedCharts(chartPath, DetectOptions{Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(charts) != 2 || charts[1].prefix != "subchart-a: " {
+		t.Fatalf("watchedCharts() = %+v, want the umbrella and subchart-a", charts)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var out syncBuffer
+	done := make(chan error, 1)
+	go func() {
+		done <- watchChart(ctx, charts, 10*time.Millisecond, &out)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("watchChart() error = %v", err)
+		}
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	waitFor := func(want string) {
+		t.Helper()
+		for !strings.Contains(out.String(), want) {
+			if time.Now().After(deadline) {
+				t.Fatalf("output never contained %q:\n%s", want, out.String())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor("and 1 subchart(s)")
+
+	// A change in the subchart is reported under its name
+	valuesPath := filepath.Join(chartPath, "subcharts", "subchart-a", "values.yaml")
+	values, _ := os.ReadFile(valuesPath)
+	updated := strings.Replace(string(values), "volumes:", "volumes: # list-to-map: ignore", 1)
+	if err := os.WriteFile(valuesPath, []byte(updated), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("  - subchart-a: volumes (convertible, key=name)")
+}
+
+func TestDetectWatchRejectsExpandRemote(t *testing.T) {
+	err := runDetectWatch(DetectOptions{Watch: true, ExpandRemote: true})
+	if err == nil || !strings.Contains(err.Error(), "--expand-remote") {
+		t.Errorf("runDetectWatch() error = %v, want one rejecting --expand-remote", err)
+	}
+}
+
+func TestPrintWatchChanges(t *testing.T) {
+	initColor(true)
+	prev := map[string]string{
+		"env":     "convertible, key=name",
+		"ports":   "convertible, key=containerPort",
+		"volumes": "convertible, key=name",
+	}
+	findings := map[string]string{
+		"env":          "convertible, key=name",
+		"extraEnvFrom": "unsupported template pattern",
+		"ports":        "convertible, key=name",
+	}
+
+	var buf bytes.Buffer
+	printWatchChanges(&buf, prev, findings)
+	got := buf.String()
+	got = got[strings.Index(got, "]")+1:] // Drop the timestamp
+	want := ` Chart changed; 3 finding(s):
+  + extraEnvFrom (unsupported template pattern)
+  ~ ports (convertible, key=name, was convertible, key=containerPort)
+  - volumes (convertible, key=name)
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template/parse"
+
+	pkgfs "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/parser"
+	"gopkg.in/yaml.v3"
+)
+
+// runConvertInWorkdir converts a scratch copy of the chart, checks that the
+// files the conversion changed still parse, and only then syncs the changes
+// back to the chart. A failed conversion, or an interrupt before syncing,
+// leaves the chart as it was; interrupts while syncing are held off until
+// every change is written.
+func runConvertInWorkdir(opts ConvertOptions) error {
+	root, err := findChartRoot(opts.ChartDir)
+	if err != nil {
+		return err
+	}
+	// A dry run doesn't write, so there's nothing to protect
+	if opts.DryRun {
+		opts.Atomic, opts.Workdir = false, ""
+		opts.ChartDir = root
+		return runConvert(opts)
+	}
+	if opts.Recursive {
+		if err := checkSubchartsInside(root); err != nil {
+			return err
+		}
+	}
+	if opts.Workdir != "" {
+		if err := os.MkdirAll(opts.Workdir, 0755); err != nil {
+			return fmt.Errorf("creating work directory: %w", err)
+		}
+	}
+	tmp, err := os.MkdirTemp(opts.Workdir, "list-to-map-convert-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+	guard := guardInterrupts(tmp)
+	defer guard.stop()
+
+	work := filepath.Join(tmp, filepath.Base(root))
+	if err := copyDir(root, work); err != nil {
+		return fmt.Errorf("copying chart: %w", err)
+	}
+	fmt.Printf("Converting a copy of %s in %s\n", root, tmp)
+	opts.Atomic, opts.Workdir = false, ""
+	opts.ChartDir, opts.ShownAs = work, root
+	if err := runConvert(opts); err != nil {
+		return fmt.Errorf("%w (%s was left unchanged)", err, root)
+	}
+
+	changed, removed, err := chartChanges(root, work)
+	if err != nil {
+		return err
+	}
+	if err := validateConverted(work, changed); err != nil {
+		return fmt.Errorf("converted chart is invalid, %s was left unchanged: %w", root, err)
+	}
+
+	guard.hold()
+	if err := syncChanges(root, work, changed, removed); err != nil {
+		return fmt.Errorf("syncing converted files to %s: %w", root, err)
+	}
+	fmt.Println(green(fmt.Sprintf("\nSynced %d changed and %d removed file(s) to %s", len(changed), len(removed), root)))
+	if guard.interrupted() {
+		return fmt.Errorf("interrupted after syncing the converted chart")
+	}
+	return nil
+}
+
+// shownPath returns path as it's printed: for a conversion of a scratch copy,
+// the path it syncs to in the chart
+func shownPath(opts ConvertOptions, path string) string {
+	if opts.ShownAs == "" {
+		return path
+	}
+	rel, err := filepath.Rel(opts.ChartDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.Join(opts.ShownAs, rel)
+}
+
+// checkSubchartsInside returns an error if a file:// dependency of the chart
+// lies outside it, where a copy of the chart can't reach it
+func checkSubchartsInside(root string) error {
+	deps, err := parseChartDependencies(root)
+	if err != nil {
+		return err
+	}
+	for _, dep := range deps {
+		rel, err := filepath.Rel(root, resolveSubchartPath(root, dep.Repository))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("subchart %s (%s) is outside the chart, so it can't be converted in a work directory: convert without --atomic or --workdir", dep.Name, dep.Repository)
+		}
+	}
+	return nil
+}
+
+// chartChanges compares the converted copy of a chart with the chart,
+// returning the chart-relative paths of files the conversion added or changed,
+// and of files it removed. Only regular files are compared, as only they are
+// copied.
+func chartChanges(root, work string) (changed, removed []string, err error) {
+	before, err := regularFiles(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err := regularFiles(work)
+	if err != nil {
+		return nil, nil, err
+	}
+	for rel, info := range after {
+		old, ok := before[rel]
+		if ok && old.Mode() == info.Mode() && old.Size() == info.Size() {
+			a, err := os.ReadFile(filepath.Join(root, rel))
+			if err != nil {
+				return nil, nil, err
+			}
+			b, err := os.ReadFile(filepath.Join(work, rel))
+			if err != nil {
+				return nil, nil, err
+			}
+			if bytes.Equal(a, b) {
+				continue
+			}
+		}
+		changed = append(changed, rel)
+	}
+	for rel := range before {
+		if _, ok := after[rel]; !ok {
+			removed = append(removed, rel)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return changed, removed, nil
+}
+
+// regularFiles returns the regular files under dir, keyed by relative path
+func regularFiles(dir string) (map[string]fs.FileInfo, error) {
+	files := make(map[string]fs.FileInfo)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[rel] = info
+		return nil
+	})
+	return files, err
+}
+
+// validateConverted checks that the changed files of a converted chart still
+// parse: YAML files as YAML, and templates as Go templates. Functions aren't
+// checked, as helm and the chart define them.
+func validateConverted(work string, changed []string) error {
+	for _, rel := range changed {
+		ext := filepath.Ext(rel)
+		isTemplate := inTemplateDir(work, rel)
+		if isTemplate && !pkgfs.IsTemplate(rel) || !isTemplate && ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		path := filepath.Join(work, rel)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if isTemplate {
+			t := parse.New(rel)
+			t.Mode = parse.SkipFuncCheck
+			if _, err := t.Parse(string(data), "{{", "}}", map[string]*parse.Tree{}); err != nil {
+				return fmt.Errorf("%s: %w", rel, err)
+			}
+			continue
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		for {
+			var doc yaml.Node
+			if err := dec.Decode(&doc); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return parser.YAMLFileError(rel, data, err)
+			}
+		}
+	}
+	return nil
+}
+
+// inTemplateDir reports whether rel, relative to the chart root work, is in
+// the template directories of the nearest chart holding it: the chart itself,
+// or a subchart anywhere inside it
+func inTemplateDir(work, rel string) bool {
+	rel = filepath.Clean(rel)
+	for dir := filepath.Dir(rel); dir != "."; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(work, dir, "Chart.yaml")); err == nil {
+			sub, err := filepath.Rel(dir, rel)
+			return err == nil && pkgfs.InTemplateDir(sub)
+		}
+	}
+	return pkgfs.InTemplateDir(rel)
+}
+
+// syncChanges copies the changed files of the converted copy into the chart,
+// then removes the files the conversion removed. An existing file is rewritten
+// in place, so it keeps its inode, mode, owner, group and ACLs, and hard links
+// to it still see the conversion. A new file is written beside its target and
+// renamed over it so it is never half written.
+func syncChanges(root, work string, changed, removed []string) error {
+	for _, rel := range changed {
+		src := filepath.Join(work, rel)
+		info, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(root, rel)
+		if _, err := os.Stat(dst); err == nil {
+			if err := rewriteFile(dst, data); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(dst, data, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	for _, rel := range removed {
+		if err := os.Remove(filepath.Join(root, rel)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// interruptGuard handles interrupts during a work directory conversion.
+// Until hold is called, an interrupt removes the work directory and exits,
+// leaving the chart untouched. After that, interrupts are only recorded, so
+// syncing runs to completion.
+type interruptGuard struct {
+	mu      sync.Mutex
+	held    bool
+	caught  bool
+	signals chan os.Signal
+	done    chan struct{}
+}
+
+// guardInterrupts starts handling interrupts for a conversion in tmp
+func guardInterrupts(tmp string) *interruptGuard {
+	g := &interruptGuard{signals: make(chan os.Signal, 1), done: make(chan struct{})}
+	signal.Notify(g.signals, os.Interrupt)
+	go func() {
+		for {
+			select {
+			case <-g.signals:
+				g.mu.Lock()
+				if !g.held {
+					_ = os.RemoveAll(tmp)
+					fmt.Fprintln(os.Stderr, "\nInterrupted: the chart was left unchanged")
+					os.Exit(130)
+				}
+				g.caught = true
+				g.mu.Unlock()
+			case <-g.done:
+				return
+			}
+		}
+	}()
+	return g
+}
+
+// hold stops interrupts from exiting, before changes are synced
+func (g *interruptGuard) hold() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.held = true
+}
+
+// interrupted reports whether an interrupt arrived while held
+func (g *interruptGuard) interrupted() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.caught
+}
+
+// stop restores the default interrupt handling
+func (g *interruptGuard) stop() {
+	signal.Stop(g.signals)
+	close(g.done)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/internal/testutil"
+)
+
+func TestConvertWorkdir(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	workdir := t.TempDir()
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{
+			ChartDir:  chartPath,
+			BackupExt: ".bak",
+			Workdir:   workdir,
+		})
+	})
+	if err != nil {
+		t.Fatalf("runConvert --workdir failed: %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(output, "Converting a copy of") || !strings.Contains(output, "Synced") {
+		t.Errorf("Expected copy and sync messages\nGot:\n%s", output)
+	}
+
+	values, _ := os.ReadFile(filepath.Join(chartPath, "values.yaml"))
+	if strings.Contains(string(values), "- name: DB_HOST") || !strings.Contains(string(values), "DB_HOST:") {
+		t.Errorf("values.yaml was not converted:\n%s", values)
+	}
+	if _, err := os.Stat(filepath.Join(chartPath, "templates", "_listmap.tpl")); err != nil {
+		t.Errorf("helper template was not synced: %v", err)
+	}
+	backups, _ := filepath.Glob(filepath.Join(chartPath, "values.yaml*.bak"))
+	if len(backups) != 1 {
+		t.Errorf("Expected one values.yaml backup, got %v", backups)
+	}
+
+	// The scratch copy is removed
+	entries, _ := os.ReadDir(workdir)
+	if len(entries) != 0 {
+		t.Errorf("work directory not cleaned up: %v", entries)
+	}
+}
+
+// TestConvertWorkdirShowsChartPaths tests that paths in the scratch copy are
+// printed as the chart paths they sync to
+func TestConvertWorkdirShowsChartPaths(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/umbrella")
+	workdir := t.TempDir()
+
+	output, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{
+			ChartDir:    chartPath,
+			BackupExt:   ".bak",
+			Workdir:     workdir,
+			Recursive:   true,
+			BumpVersion: "minor",
+		})
+	})
+	if err != nil {
+		t.Fatalf("runConvert --workdir failed: %v\nOutput: %s", err, output)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if strings.Contains(line, workdir) && !strings.HasPrefix(line, "Converting a copy of") {
+			t.Errorf("output shows a scratch copy path: %q", line)
+		}
+	}
+	for _, want := range []string{
+		"  Path: " + filepath.Join(chartPath, "subcharts", "subchart-a") + "\n",
+		"    Backup: " + filepath.Join(chartPath, "subcharts", "subchart-a", "values.yaml."),
+		"  Backup: " + filepath.Join(chartPath, "Chart.yaml."),
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output should contain %q\nGot:\n%s", want, output)
+		}
+	}
+}
+
+func TestConvertAtomicFailureLeavesChart(t *testing.T) {
+	testutil.SetupTestEnv(t)
+	testutil.ResetGlobalState(t)
+
+	chartPath := copyChartForTest(t, "testdata/charts/basic")
+	before := readChartFiles(t, chartPath)
+
+	_, err := captureOutput(t, func() error {
+		return runConvert(ConvertOptions{
+			ChartDir:    chartPath,
+			BackupExt:   ".bak",
+			Atomic:      true,
+			BumpVersion: "huge",
+		})
+	})
+	if err == nil || !strings.Contains(err.Error(), "was left unchanged") {
+		t.Fatalf("Expected a failed conversion leaving the chart unchanged, got %v", err)
+	}
+	after := readChartFiles(t, chartPath)
+	if len(after) != len(before) {
+		t.Errorf("chart files changed: %d before, %d after", len(before), len(after))
+	}
+	for name, data := range before {
+		if after[name] != data {
+			t.Errorf("%s changed", name)
+		}
+	}
+}
+
+func TestChartChangesAndSync(t *testing.T) {
+	root, work := t.TempDir(), t.TempDir()
+	write := func(dir, name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(root, "Chart.yaml", "name: test\n")
+	write(root, "values.yaml", "env: []\n")
+	write(root, "charts/redis-1.0.0.tgz", "archive")
+	write(work, "Chart.yaml", "name: test\n")
+	write(work, "values.yaml", "env: {}\n")
+	write(work, "values.yaml.bak", "env: []\n")
+	write(work, "charts/redis/Chart.yaml", "name: redis\n")
+
+	changed, removed, err := chartChanges(root, work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(changed, ","); got != "charts/redis/Chart.yaml,values.yaml,values.yaml.bak" {
+		t.Errorf("changed = %s", got)
+	}
+	if got := strings.Join(removed, ","); got != "charts/redis-1.0.0.tgz" {
+		t.Errorf("removed = %s", got)
+	}
+
+	if err := syncChanges(root, work, changed, removed); err != nil {
+		t.Fatal(err)
+	}
+	changed, removed, err = chartChanges(root, work)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 0 || len(removed) != 0 {
+		t.Errorf("after sync, changed = %v, removed = %v", changed, removed)
+	}
+	// No temporary files are left beside the synced ones
+	entries, _ := os.ReadDir(root)
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".list-to-map-") {
+			t.Errorf("temporary file left behind: %s", e.Name())
+		}
+	}
+}
+
+// TestSyncChangesKeepsFile tests that syncing rewrites an existing file in
+// place, keeping its inode and mode, so owner, group, ACLs and hard links
+// survive too
+func TestSyncChangesKeepsFile(t *testing.T) {
+	root, work := t.TempDir(), t.TempDir()
+	values := filepath.Join(root, "values.yaml")
+	if err := os.WriteFile(values, []byte("env: []\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(work, "values.yaml"), []byte("env: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := syncChanges(root, work, []string{"values.yaml"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) {
+		t.Error("values.yaml was replaced by another file instead of rewritten in place")
+	}
+	if after.Mode().Perm() != 0600 {
+		t.Errorf("values.yaml mode = %v, want 0600", after.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(values); string(data) != "env: {}\n" {
+		t.Errorf("values.yaml = %q, want the converted values", data)
+	}
+}
+
+func TestValidateConverted(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr bool
+	}{
+		{"valid values", "values.yaml", "env:\n  FOO:\n    value: bar\n", false},
+		{"invalid values", "values.yaml", "env:\n  FOO: [\n", true},
+		{"valid template", "templates/deployment.yaml", "env:\n  {{- include \"chart.listmap.items\" (dict \"items\" .Values.env) | nindent 2 }}\n", false},
+		{"unclosed action", "templates/deployment.yaml", "env:\n  {{- if .Values.env }}\n", true},
+		{"templates aren't parsed as YAML", "templates/_helpers.tpl", "{{- define \"x\" }}: [{{- end }}\n", false},
+		{"other files skipped", "README.md", "{{ not a template", false},
+		{"subchart templates", "subcharts/app/templates/deployment.yaml", "{{- with .Values.env }}\nenv: {{ . }}\n{{- end }}\n", false},
+		{"subchart values", "subcharts/app/values.yaml", "env:\n  FOO: [\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			path := filepath.Join(work, tt.file)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if dir, ok := strings.CutSuffix(filepath.ToSlash(filepath.Dir(tt.file)), "/templates"); ok && dir != "" {
+				if err := os.WriteFile(filepath.Join(work, dir, "Chart.yaml"), []byte("apiVersion: v2\nname: app\nversion: 0.1.0\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := validateConverted(work, []string{tt.file})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateConverted() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConvertWorkdirSubchartOutsideChart(t *testing.T) {
+	root := t.TempDir()
+	chart := "apiVersion: v2\nname: umbrella\nversion: 1.0.0\ndependencies:\n  - name: app\n    repository: file://../app\n"
+	if err := os.WriteFile(filepath.Join(root, "Chart.yaml"), []byte(chart), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := runConvertInWorkdir(ConvertOptions{ChartDir: root, Recursive: true, Atomic: true})
+	if err == nil || !strings.Contains(err.Error(), "outside the chart") {
+		t.Errorf("Expected an error for a subchart outside the chart, got %v", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/scottrigby/helm-list-to-map-plugin/pkg/crd"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
 )
 
 // SetupTestEnv creates an isolated HELM_CONFIG_HOME for tests
@@ -27,4 +28,6 @@ func SetupTestEnv(t *testing.T) string {
 func ResetGlobalState(t *testing.T) {
 	t.Helper()
 	crd.ResetGlobalRegistry()
+	_, _ = k8s.SetCuratedRuleSets(nil)
+	crd.SetOffline(false)
 }
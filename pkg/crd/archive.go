@@ -0,0 +1,167 @@
+package crd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Layout of a CRD archive: the CRD files under crdArchiveDir, listed with
+// their sources and checksums in crdArchiveIndex
+const (
+	crdArchiveDir   = "crds"
+	crdArchiveIndex = "index.yaml"
+)
+
+// ArchiveEntry is a CRD file in a CRD archive
+type ArchiveEntry struct {
+	File   string `yaml:"file"`   // Canonical filename ({group}_{plural}_{version}.yaml)
+	Source string `yaml:"source"` // Where the CRD was loaded from
+	SHA256 string `yaml:"sha256"` // Hex SHA256 checksum of Data
+	Data   []byte `yaml:"-"`
+}
+
+type archiveIndex struct {
+	CRDs []ArchiveEntry `yaml:"crds"`
+}
+
+// WriteArchive writes entries to w as a gzipped tar archive, for loading CRDs
+// on machines without network access. Each CRD is stored under crds/ and
+// listed in index.yaml with its source and checksum. The archive is the same
+// for the same entries, whatever their order.
+func WriteArchive(w io.Writer, entries []ArchiveEntry) error {
+	sorted := make([]ArchiveEntry, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].File < sorted[j].File })
+
+	var index archiveIndex
+	for i, e := range sorted {
+		if !validArchiveFile(e.File) {
+			return fmt.Errorf("invalid CRD filename %q", e.File)
+		}
+		if i > 0 && sorted[i-1].File == e.File {
+			return fmt.Errorf("%s is included twice", e.File)
+		}
+		sum := sha256.Sum256(e.Data)
+		e.SHA256 = hex.EncodeToString(sum[:])
+		index.CRDs = append(index.CRDs, e)
+	}
+	var indexBuf bytes.Buffer
+	enc := yaml.NewEncoder(&indexBuf)
+	enc.SetIndent(2)
+	if err := enc.Encode(index); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	indexData := indexBuf.Bytes()
+
+	gzw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gzw)
+	write := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err := write(crdArchiveIndex, indexData); err != nil {
+		return err
+	}
+	for _, e := range sorted {
+		if err := write(path.Join(crdArchiveDir, e.File), e.Data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gzw.Close()
+}
+
+// ReadArchive reads a CRD archive written by WriteArchive. Every CRD must be
+// listed in the index and match its checksum, and every one listed must be
+// in the archive.
+func ReadArchive(r io.Reader) ([]ArchiveEntry, error) {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a gzipped archive: %w", err)
+	}
+	defer func() { _ = gzr.Close() }()
+
+	var indexData []byte
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, tr); err != nil { //nolint:gosec // Archives hold CRDs the user chose to load
+			return nil, fmt.Errorf("reading %s: %w", header.Name, err)
+		}
+		dir, file := path.Split(path.Clean(header.Name))
+		switch {
+		case header.Name == crdArchiveIndex:
+			indexData = buf.Bytes()
+		case dir == crdArchiveDir+"/" && validArchiveFile(file):
+			files[file] = buf.Bytes()
+		default:
+			return nil, fmt.Errorf("unexpected file %s in archive", header.Name)
+		}
+	}
+	if indexData == nil {
+		return nil, fmt.Errorf("%s is missing, so the archive wasn't made by bundle-crds", crdArchiveIndex)
+	}
+	var index archiveIndex
+	if err := yaml.Unmarshal(indexData, &index); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", crdArchiveIndex, err)
+	}
+
+	entries := make([]ArchiveEntry, 0, len(index.CRDs))
+	for _, e := range index.CRDs {
+		data, ok := files[e.File]
+		if !ok {
+			return nil, fmt.Errorf("%s is listed in %s but not in the archive", e.File, crdArchiveIndex)
+		}
+		delete(files, e.File)
+		sum := sha256.Sum256(data)
+		if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, e.SHA256) {
+			return nil, fmt.Errorf("%s: checksum mismatch: got sha256 %s, want %s", e.File, got, e.SHA256)
+		}
+		e.Data = data
+		entries = append(entries, e)
+	}
+	if len(files) > 0 {
+		unlisted := make([]string, 0, len(files))
+		for file := range files {
+			unlisted = append(unlisted, path.Join(crdArchiveDir, file))
+		}
+		sort.Strings(unlisted)
+		return nil, fmt.Errorf("%s isn't listed in %s", strings.Join(unlisted, ", "), crdArchiveIndex)
+	}
+	return entries, nil
+}
+
+// validArchiveFile reports whether name is a YAML filename without a directory
+func validArchiveFile(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `/\`) && !strings.HasPrefix(name, ".") &&
+		(strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml"))
+}
@@ -0,0 +1,130 @@
+package crd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+// tarGz returns a gzipped tar archive of files, in the order given
+func tarGz(t *testing.T, files ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f[0], Mode: 0644, Size: int64(len(f[1])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	entries := []ArchiveEntry{
+		{File: "monitoring.coreos.com_alertmanagers_v1.yaml", Source: "https://example.com/am.yaml", Data: []byte("kind: CustomResourceDefinition\n")},
+		{File: "cert-manager.io_certificates_v1.yaml", Source: "./certificates.yaml", Data: []byte("kind: CustomResourceDefinition\nspec: {}\n")},
+	}
+	var first, second bytes.Buffer
+	if err := WriteArchive(&first, entries); err != nil {
+		t.Fatalf("WriteArchive() error = %v", err)
+	}
+	if err := WriteArchive(&second, []ArchiveEntry{entries[1], entries[0]}); err != nil {
+		t.Fatalf("WriteArchive() error = %v", err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Error("WriteArchive() should write the same archive whatever the order of entries")
+	}
+
+	got, err := ReadArchive(&first)
+	if err != nil {
+		t.Fatalf("ReadArchive() error = %v", err)
+	}
+	if len(got) != 2 || got[0].File != entries[1].File || got[1].File != entries[0].File {
+		t.Fatalf("ReadArchive() = %+v, want both entries sorted by file", got)
+	}
+	if got[0].Source != "./certificates.yaml" || string(got[0].Data) != string(entries[1].Data) || len(got[0].SHA256) != 64 {
+		t.Errorf("ReadArchive() entry = %+v", got[0])
+	}
+
+	if err := WriteArchive(&bytes.Buffer{}, []ArchiveEntry{{File: "../crd.yaml"}}); err == nil {
+		t.Error("WriteArchive() should reject a filename with a directory")
+	}
+}
+
+func TestReadArchiveRejects(t *testing.T) {
+	t.Parallel()
+
+	const crd = "kind: CustomResourceDefinition\n"
+	const index = "crds:\n  - file: a_b_v1.yaml\n    source: a.yaml\n    sha256: 6d6e8c4e1c1b3d0bb5c5c1b4d3f6b2d1b0c7a8e9f0a1b2c3d4e5f6a7b8c9d0e1\n"
+	valid := func() string {
+		var buf bytes.Buffer
+		if err := WriteArchive(&buf, []ArchiveEntry{{File: "a_b_v1.yaml", Source: "a.yaml", Data: []byte(crd)}}); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := ReadArchive(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "crds:\n  - file: a_b_v1.yaml\n    source: a.yaml\n    sha256: " + entries[0].SHA256 + "\n"
+	}()
+
+	tests := []struct {
+		name    string
+		archive []byte
+		wantErr string
+	}{
+		{
+			name:    "not gzipped",
+			archive: []byte("crds: []\n"),
+			wantErr: "not a gzipped archive",
+		},
+		{
+			name:    "no index",
+			archive: tarGz(t, [2]string{"crds/a_b_v1.yaml", crd}),
+			wantErr: "index.yaml is missing",
+		},
+		{
+			name:    "checksum mismatch",
+			archive: tarGz(t, [2]string{"index.yaml", index}, [2]string{"crds/a_b_v1.yaml", crd}),
+			wantErr: "a_b_v1.yaml: checksum mismatch",
+		},
+		{
+			name:    "listed file missing",
+			archive: tarGz(t, [2]string{"index.yaml", valid}),
+			wantErr: "a_b_v1.yaml is listed in index.yaml but not in the archive",
+		},
+		{
+			name:    "unlisted file",
+			archive: tarGz(t, [2]string{"index.yaml", valid}, [2]string{"crds/a_b_v1.yaml", crd}, [2]string{"crds/extra.yaml", crd}),
+			wantErr: "crds/extra.yaml isn't listed in index.yaml",
+		},
+		{
+			name:    "file outside crds/",
+			archive: tarGz(t, [2]string{"index.yaml", valid}, [2]string{"../evil.yaml", crd}),
+			wantErr: "unexpected file ../evil.yaml",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := ReadArchive(bytes.NewReader(tt.archive))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ReadArchive() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package crd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// AuthRule sets the credentials sent when downloading from a host, for
+// private CRD sources such as internal mirrors
+type AuthRule struct {
+	// Host is the host the credentials are sent to, optionally followed by a
+	// path prefix (e.g., "artifacts.example.com/crds")
+	Host string `yaml:"host"`
+	// TokenEnv names the environment variable holding a bearer token
+	TokenEnv string `yaml:"tokenEnv,omitempty"`
+	// UsernameEnv and PasswordEnv name the environment variables holding
+	// basic auth credentials
+	UsernameEnv string `yaml:"usernameEnv,omitempty"`
+	PasswordEnv string `yaml:"passwordEnv,omitempty"`
+	// CredentialHelper is a git credential helper (e.g., "git credential-store"),
+	// run with "get" to look up basic auth credentials
+	CredentialHelper string `yaml:"credentialHelper,omitempty"`
+}
+
+// authRules are consulted before GitHub tokens and netrc
+var authRules []AuthRule
+
+// githubHosts are the hosts GITHUB_TOKEN or GH_TOKEN is sent to
+var githubHosts = map[string]bool{
+	"github.com":                    true,
+	"api.github.com":                true,
+	"raw.githubusercontent.com":     true,
+	"objects.githubusercontent.com": true,
+}
+
+// SetAuthRules sets the credentials used for downloads and returns the
+// previous rules
+func SetAuthRules(rules []AuthRule) []AuthRule {
+	prev := authRules
+	authRules = rules
+	return prev
+}
+
+// authorize adds credentials for the URL of req, from the first of: a matching
+// auth rule, GITHUB_TOKEN or GH_TOKEN for GitHub, and the netrc file. It
+// returns where the credentials came from, or "" if none were added.
+// Credentials are only sent over HTTPS, or to the local machine.
+func authorize(req *http.Request) (string, error) {
+	u := req.URL
+	if u.Scheme != "https" && !isLoopback(u.Hostname()) {
+		return "", nil
+	}
+	if rule := matchAuthRule(u); rule != nil {
+		return rule.apply(req)
+	}
+	if githubHosts[u.Hostname()] {
+		for _, env := range []string{"GITHUB_TOKEN", "GH_TOKEN"} {
+			if token := os.Getenv(env); token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+				return env, nil
+			}
+		}
+	}
+	if login, password, ok := netrcLogin(u.Hostname()); ok {
+		req.SetBasicAuth(login, password)
+		return "netrc", nil
+	}
+	return "", nil
+}
+
+// matchAuthRule returns the auth rule for u with the longest host and path
+// prefix, or nil
+func matchAuthRule(u *url.URL) *AuthRule {
+	var best *AuthRule
+	bestLen := -1
+	for i := range authRules {
+		r := &authRules[i]
+		host, prefix, _ := strings.Cut(strings.TrimSuffix(r.Host, "/"), "/")
+		if host != u.Host && host != u.Hostname() {
+			continue
+		}
+		if path := strings.TrimPrefix(u.Path, "/"); prefix != "" && path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			continue
+		}
+		if n := len(r.Host); n > bestLen {
+			best, bestLen = r, n
+		}
+	}
+	return best
+}
+
+// apply adds the rule's credentials to req
+func (r *AuthRule) apply(req *http.Request) (string, error) {
+	source := "crdAuth for " + r.Host
+	switch {
+	case r.TokenEnv != "":
+		token := os.Getenv(r.TokenEnv)
+		if token == "" {
+			return "", fmt.Errorf("%s: $%s is not set", source, r.TokenEnv)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case r.UsernameEnv != "" || r.PasswordEnv != "":
+		req.SetBasicAuth(os.Getenv(r.UsernameEnv), os.Getenv(r.PasswordEnv))
+	case r.CredentialHelper != "":
+		login, password, err := runCredentialHelper(r.CredentialHelper, req.URL)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", source, err)
+		}
+		req.SetBasicAuth(login, password)
+	default:
+		return "", fmt.Errorf("%s: set tokenEnv, usernameEnv and passwordEnv, or credentialHelper", source)
+	}
+	return source, nil
+}
+
+// runCredentialHelper looks up credentials for u with a git credential
+// helper, speaking git's credential protocol on its stdin and stdout
+func runCredentialHelper(helper string, u *url.URL) (string, string, error) {
+	args := strings.Fields(helper)
+	if len(args) == 0 {
+		return "", "", fmt.Errorf("empty credential helper")
+	}
+	cmd := exec.Command(args[0], append(args[1:], "get")...) //nolint:gosec // Helper comes from the user's config
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=%s\nhost=%s\npath=%s\n\n", u.Scheme, u.Host, strings.TrimPrefix(u.Path, "/")))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", "", fmt.Errorf("credential helper %q failed: %w: %s", helper, err, msg)
+		}
+		return "", "", fmt.Errorf("credential helper %q failed: %w", helper, err)
+	}
+	var login, password string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), "=")
+		switch key {
+		case "username":
+			login = value
+		case "password":
+			password = value
+		}
+	}
+	if password == "" {
+		return "", "", fmt.Errorf("credential helper %q returned no password for %s", helper, u.Host)
+	}
+	return login, password, nil
+}
+
+// netrcLogin returns the login and password for host in the netrc file
+// named by NETRC, or ~/.netrc, falling back to its default entry
+func netrcLogin(host string) (string, string, bool) {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", false
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", false
+	}
+	return parseNetrc(string(data), host)
+}
+
+// parseNetrc finds the login and password for host in netrc content
+func parseNetrc(data, host string) (string, string, bool) {
+	type entry struct{ login, password string }
+	var match, fallback, cur *entry
+	var tokens []string
+	inMacro := false
+	for _, line := range strings.Split(data, "\n") {
+		// A macro definition runs to the next blank line
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		fields := strings.Fields(line)
+		for i, f := range fields {
+			if f == "macdef" {
+				tokens = append(tokens, fields[:i]...)
+				tokens = append(tokens, f)
+				inMacro = true
+				break
+			}
+		}
+		if !inMacro {
+			tokens = append(tokens, fields...)
+		}
+	}
+	for i := 0; i < len(tokens); i++ {
+		switch tok := tokens[i]; tok {
+		case "machine", "default":
+			cur = nil
+			if tok == "default" && fallback == nil {
+				fallback = &entry{}
+				cur = fallback
+			} else if tok == "machine" && i+1 < len(tokens) {
+				i++
+				if tokens[i] == host && match == nil {
+					match = &entry{}
+					cur = match
+				}
+			}
+		case "macdef":
+			cur = nil
+		case "login", "password", "account":
+			if i+1 >= len(tokens) {
+				break
+			}
+			i++
+			if cur != nil && tok == "login" {
+				cur.login = tokens[i]
+			} else if cur != nil && tok == "password" {
+				cur.password = tokens[i]
+			}
+		}
+	}
+	for _, e := range []*entry{match, fallback} {
+		if e != nil && e.password != "" {
+			return e.login, e.password, true
+		}
+	}
+	return "", "", false
+}
+
+// isLoopback reports whether host is the local machine
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,173 @@
+package crd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchWithAuthRule(t *testing.T) {
+	useFetchOptions(t, FetchOptions{Timeout: 5 * time.Second})
+	t.Setenv("TEST_CRD_TOKEN", "s3cret")
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+		if got != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("kind: CustomResourceDefinition\n"))
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	prev := SetAuthRules([]AuthRule{{Host: host + "/crds", TokenEnv: "TEST_CRD_TOKEN"}})
+	defer SetAuthRules(prev)
+
+	if _, err := Fetch(srv.URL+"/crds/widgets.yaml", ""); err != nil {
+		t.Errorf("Fetch() error = %v", err)
+	}
+	if got != "Bearer s3cret" {
+		t.Errorf("Authorization = %q", got)
+	}
+
+	// Paths outside the rule's prefix get no credentials
+	_, err := Fetch(srv.URL+"/other/widgets.yaml", "")
+	if err == nil || !strings.Contains(err.Error(), "crdAuth in the config") {
+		t.Errorf("Fetch() outside prefix error = %v, want a hint to configure credentials", err)
+	}
+
+	// Rejected credentials are named
+	t.Setenv("TEST_CRD_TOKEN", "expired")
+	_, err = Fetch(srv.URL+"/crds/widgets.yaml", "")
+	if err == nil || !strings.Contains(err.Error(), "credentials from crdAuth for "+host+"/crds") {
+		t.Errorf("Fetch() with rejected token error = %v", err)
+	}
+}
+
+func TestFetchWithCredentialHelper(t *testing.T) {
+	useFetchOptions(t, FetchOptions{Timeout: 5 * time.Second})
+	dir := t.TempDir()
+	helper := filepath.Join(dir, "helper")
+	script := "#!/bin/sh\ncat > " + filepath.Join(dir, "request") + "\necho username=robot\necho password=hunter2\n"
+	if err := os.WriteFile(helper, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	var user, pass string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ = r.BasicAuth()
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	prev := SetAuthRules([]AuthRule{{Host: host, CredentialHelper: helper}})
+	defer SetAuthRules(prev)
+
+	if _, err := Fetch(srv.URL+"/crds.yaml", ""); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if user != "robot" || pass != "hunter2" {
+		t.Errorf("basic auth = %q:%q, want robot:hunter2", user, pass)
+	}
+	request, _ := os.ReadFile(filepath.Join(dir, "request"))
+	if want := "protocol=http\nhost=" + host + "\npath=crds.yaml\n"; !strings.HasPrefix(string(request), want) {
+		t.Errorf("helper got %q, want %q", request, want)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	dir := t.TempDir()
+	netrc := filepath.Join(dir, "netrc")
+	if err := os.WriteFile(netrc, []byte("machine mirror.example.com login robot password hunter2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NETRC", netrc)
+	t.Setenv("GITHUB_TOKEN", "ghp_token")
+	t.Setenv("GH_TOKEN", "")
+	prev := SetAuthRules(nil)
+	defer SetAuthRules(prev)
+
+	tests := []struct {
+		url        string
+		wantSource string
+		wantHeader string
+	}{
+		{"https://raw.githubusercontent.com/org/repo/main/crd.yaml", "GITHUB_TOKEN", "Bearer ghp_token"},
+		{"https://mirror.example.com/crd.yaml", "netrc", "Basic cm9ib3Q6aHVudGVyMg=="},
+		// GitHub tokens stay with GitHub
+		{"https://example.com/crd.yaml", "", ""},
+		// Credentials aren't sent over plain HTTP
+		{"http://mirror.example.com/crd.yaml", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			source, err := authorize(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if source != tt.wantSource || req.Header.Get("Authorization") != tt.wantHeader {
+				t.Errorf("authorize() = %q with %q, want %q with %q", source, req.Header.Get("Authorization"), tt.wantSource, tt.wantHeader)
+			}
+		})
+	}
+}
+
+func TestMatchAuthRule(t *testing.T) {
+	prev := SetAuthRules([]AuthRule{
+		{Host: "artifacts.example.com", TokenEnv: "ALL"},
+		{Host: "artifacts.example.com/crds", TokenEnv: "CRDS"},
+	})
+	defer SetAuthRules(prev)
+
+	tests := map[string]string{
+		"https://artifacts.example.com/crds/widgets.yaml":  "CRDS",
+		"https://artifacts.example.com/crdsx/widgets.yaml": "ALL",
+		"https://artifacts.example.com/other.yaml":         "ALL",
+		"https://example.com/crds/widgets.yaml":            "",
+	}
+	for raw, want := range tests {
+		u, _ := url.Parse(raw)
+		got := ""
+		if r := matchAuthRule(u); r != nil {
+			got = r.TokenEnv
+		}
+		if got != want {
+			t.Errorf("matchAuthRule(%s) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestParseNetrc(t *testing.T) {
+	data := `machine other.example.com
+  login nobody password nothing
+
+macdef init
+machine mirror.example.com login fake password fake
+
+machine mirror.example.com login robot password hunter2
+default login anonymous password guest
+`
+	tests := []struct {
+		host, login, password string
+		ok                    bool
+	}{
+		{"mirror.example.com", "robot", "hunter2", true},
+		{"other.example.com", "nobody", "nothing", true},
+		{"unknown.example.com", "anonymous", "guest", true},
+	}
+	for _, tt := range tests {
+		login, password, ok := parseNetrc(data, tt.host)
+		if login != tt.login || password != tt.password || ok != tt.ok {
+			t.Errorf("parseNetrc(%s) = %q, %q, %v", tt.host, login, password, ok)
+		}
+	}
+	if _, _, ok := parseNetrc("machine a login b\n", "a"); ok {
+		t.Error("parseNetrc() found an entry without a password")
+	}
+}
@@ -1,11 +1,15 @@
 package crd
 
 import (
+	"encoding/base64"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"slices"
+	"sync"
 	"testing"
+	"unsafe"
 
 	"github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
 	corev1 "k8s.io/api/core/v1"
@@ -117,6 +121,43 @@ func TestCRDRegistry_LoadFromFile(t *testing.T) {
 	}
 }
 
+// TestCRDRegistry_ConcurrentLoadAndQuery loads CRDs while other goroutines
+// query the registry; run with -race to catch unsynchronized access
+func TestCRDRegistry_ConcurrentLoadAndQuery(t *testing.T) {
+	t.Parallel()
+
+	reg := NewCRDRegistry(fs.OSFileSystem{})
+	fixtures := []string{"list-map-keys.yaml", "multi-version.yaml", "multi-field.yaml", "array-field.yaml"}
+
+	var wg sync.WaitGroup
+	for _, f := range fixtures {
+		path := getCRDFixturePath(t, f)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := reg.LoadFromFile(path); err != nil {
+				t.Errorf("LoadFromFile(%s): %v", path, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				for _, typ := range reg.ListTypes() {
+					reg.HasType(typ, "")
+				}
+				reg.CheckVersionMismatch("example.com/v1", "MultiVer")
+				reg.GetAvailableVersions("example.com", "MultiVer")
+				reg.IsArrayField("example.com/v1", "MultiVer", "spec.items")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(reg.ListTypes()); got < len(fixtures) {
+		t.Errorf("expected at least %d types after concurrent loads, got %d", len(fixtures), got)
+	}
+}
+
 // TestCRDRegistry_LoadFromFileInvalid tests error handling for invalid files
 func TestCRDRegistry_LoadFromFileInvalid(t *testing.T) {
 	t.Parallel()
@@ -134,6 +175,32 @@ func TestCRDRegistry_LoadFromFileInvalid(t *testing.T) {
 	}
 }
 
+// TestCRDRegistry_InternsFieldStrings verifies repeated strings share storage after load
+func TestCRDRegistry_InternsFieldStrings(t *testing.T) {
+	t.Parallel()
+
+	reg := NewCRDRegistry(fs.OSFileSystem{})
+	if err := reg.LoadFromFile(getCRDFixturePath(t, "multi-field.yaml")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fields := reg.ListFields("example.com/v1", "App")
+	if len(fields) < 2 {
+		t.Fatalf("expected at least 2 fields, got %d", len(fields))
+	}
+	for _, f := range fields[1:] {
+		if unsafe.StringData(f.Kind) != unsafe.StringData(fields[0].Kind) {
+			t.Errorf("field %s: Kind not interned", f.Path)
+		}
+		if unsafe.StringData(f.APIVersion) != unsafe.StringData(fields[0].APIVersion) {
+			t.Errorf("field %s: APIVersion not interned", f.Path)
+		}
+	}
+	if cap(fields) != len(fields) {
+		t.Errorf("expected clipped field slice, got len=%d cap=%d", len(fields), cap(fields))
+	}
+}
+
 // TestCRDRegistry_LoadFromDirectory tests loading CRDs from a directory
 func TestCRDRegistry_LoadFromDirectory(t *testing.T) {
 	t.Parallel()
@@ -152,6 +219,9 @@ func TestCRDRegistry_LoadFromDirectory(t *testing.T) {
 	if len(types) < 3 {
 		t.Errorf("expected at least 3 types from crds directory, got %d: %v", len(types), types)
 	}
+	if !slices.IsSorted(types) {
+		t.Errorf("ListTypes() = %v, want sorted", types)
+	}
 }
 
 // TestCRDRegistry_GetFieldInfo tests field lookup using multi-field fixture
@@ -390,6 +460,38 @@ func TestCRDRegistry_IsArrayField(t *testing.T) {
 	}
 }
 
+func TestCRDRegistry_DiffVersions(t *testing.T) {
+	t.Parallel()
+
+	reg := NewCRDRegistry(fs.OSFileSystem{})
+	if err := reg.LoadFromFile(getCRDFixturePath(t, "version-diff.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, same, err := reg.DiffVersions("example.com", "Gateway", "v1", "v1alpha1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FieldDiff{
+		{Path: "spec.hosts", ToKeys: []string{"hostname"}, ToList: true},
+		{Path: "spec.ports", FromKeys: []string{"port"}, ToKeys: []string{"port", "protocol"}, FromList: true, ToList: true},
+		{Path: "spec.volumes", FromKeys: []string{"name"}, FromList: true, ToList: true},
+	}
+	if !reflect.DeepEqual(diffs, want) {
+		t.Errorf("DiffVersions() = %+v, want %+v", diffs, want)
+	}
+	if same != 1 {
+		t.Errorf("DiffVersions() same = %d, want 1 (spec.containers)", same)
+	}
+
+	if _, _, err := reg.DiffVersions("example.com", "Gateway", "v1", "v2"); err == nil {
+		t.Error("DiffVersions() should fail for a version that isn't loaded")
+	}
+	if _, _, err := reg.DiffVersions("other.com", "Gateway", "v1", "v1alpha1"); err == nil {
+		t.Error("DiffVersions() should fail for a kind that isn't loaded")
+	}
+}
+
 // TestExtractCRDMetadata tests metadata extraction from fixture files
 func TestExtractCRDMetadata(t *testing.T) {
 	t.Parallel()
@@ -757,3 +859,125 @@ func TestAppendUnique(t *testing.T) {
 		t.Errorf("expected 1 element, got %d", len(result))
 	}
 }
+
+// TestCatalogBundles verifies that CRDs are decoded from the bundle objects
+// of YAML and JSON file-based catalogs
+func TestCatalogBundles(t *testing.T) {
+	t.Parallel()
+
+	crdData, err := os.ReadFile(getCRDFixturePath(t, "list-map-keys.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crdObject := base64.StdEncoding.EncodeToString(crdData)
+	csvObject := base64.StdEncoding.EncodeToString([]byte("apiVersion: operators.coreos.com/v1alpha1\nkind: ClusterServiceVersion\n"))
+
+	yamlCatalog := `schema: olm.package
+name: example-operator
+---
+schema: olm.bundle
+name: example-operator.v1.0.0
+package: example-operator
+properties:
+- type: olm.package
+  value:
+    packageName: example-operator
+- type: olm.bundle.object
+  value:
+    data: ` + csvObject + `
+- type: olm.bundle.object
+  value:
+    data: ` + crdObject + `
+`
+	jsonCatalog := `{"schema": "olm.package", "name": "example-operator"}
+{"schema": "olm.bundle", "name": "example-operator.v1.0.0", "package": "example-operator",
+ "properties": [{"type": "olm.bundle.object", "value": {"data": "` + csvObject + `"}},
+                {"type": "olm.bundle.object", "value": {"data": "` + crdObject + `"}}]}
+`
+
+	for name, catalog := range map[string]string{"yaml": yamlCatalog, "json": jsonCatalog} {
+		t.Run(name, func(t *testing.T) {
+			bundles, err := CatalogBundles([]byte(catalog))
+			if err != nil {
+				t.Fatalf("CatalogBundles failed: %v", err)
+			}
+			if len(bundles) != 1 {
+				t.Fatalf("expected 1 bundle, got %d", len(bundles))
+			}
+			b := bundles[0]
+			if b.Name != "example-operator.v1.0.0" || b.Package != "example-operator" {
+				t.Errorf("unexpected bundle %s in package %s", b.Name, b.Package)
+			}
+			if len(b.CRDs) != 1 || string(b.CRDs[0]) != string(crdData) {
+				t.Errorf("expected the CRD object only, got %d object(s)", len(b.CRDs))
+			}
+		})
+	}
+
+	if _, err := CatalogBundles(crdData); err == nil {
+		t.Error("expected an error for data without olm.bundle entries")
+	}
+}
+
+// TestBundleManifestsDir verifies that the manifests directory of an OLM
+// bundle is read from its annotations
+func TestBundleManifestsDir(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	filesystem := fs.OSFileSystem{}
+	if got := BundleManifestsDir(filesystem, dir); got != "" {
+		t.Errorf("expected no manifests directory for a plain directory, got %q", got)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "metadata"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	annotations := "annotations:\n  operators.operatorframework.io.bundle.manifests.v1: bundle-manifests/\n"
+	if err := os.WriteFile(filepath.Join(dir, "metadata", "annotations.yaml"), []byte(annotations), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := BundleManifestsDir(filesystem, dir), filepath.Join(dir, "bundle-manifests"); got != want {
+		t.Errorf("BundleManifestsDir = %q, want %q", got, want)
+	}
+}
+
+// TestCRDRegistry_LoadOpenAPIV3 verifies that kinds are registered from a
+// cluster's OpenAPI v3 document, following references to nested types
+func TestCRDRegistry_LoadOpenAPIV3(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile(getTestdataPath(t, filepath.Join("openapi", "apis__apps__v1.json")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := NewCRDRegistry(fs.OSFileSystem{})
+	if err := registry.LoadOpenAPIV3(data, "apis__apps__v1.json"); err != nil {
+		t.Fatalf("LoadOpenAPIV3 failed: %v", err)
+	}
+
+	if !registry.HasType("apps/v1", "Deployment") {
+		t.Fatal("expected apps/v1 Deployment to be registered")
+	}
+	tests := []struct {
+		path    string
+		wantKey string // "" for an array without keys
+	}{
+		{"spec.template.spec.containers", "name"},
+		{"spec.template.spec.containers.env", "name"},      // list-map keys
+		{"spec.template.spec.volumes", "name"},             // patch merge key
+		{"spec.template.spec.containers.volumeMounts", ""}, // atomic list
+	}
+	for _, tt := range tests {
+		if !registry.IsArrayField("apps/v1", "Deployment", tt.path) {
+			t.Errorf("%s should be an array field", tt.path)
+		}
+		info := registry.GetFieldInfo("apps/v1", "Deployment", tt.path)
+		switch {
+		case tt.wantKey == "" && info != nil:
+			t.Errorf("%s should have no keys, got %v", tt.path, info.MapKeys)
+		case tt.wantKey != "" && (info == nil || info.MapKeys[0] != tt.wantKey):
+			t.Errorf("%s should be keyed by %s, got %+v", tt.path, tt.wantKey, info)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package crd
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// FieldDiff is a list field whose conversion differs between two versions of a CRD
+type FieldDiff struct {
+	Path     string
+	FromKeys []string // x-kubernetes-list-map-keys in the first version; nil if not convertible there
+	ToKeys   []string // x-kubernetes-list-map-keys in the second version; nil if not convertible there
+	FromList bool     // Whether the field is a list at all in the first version
+	ToList   bool     // Whether the field is a list at all in the second version
+}
+
+// DiffVersions compares the convertible list fields of two loaded versions of
+// a CRD group/kind, returning the fields whose map keys differ (including
+// fields convertible in only one version) sorted by path, and the number of
+// convertible fields both versions share unchanged
+func (r *CRDRegistry) DiffVersions(group, kind, from, to string) ([]FieldDiff, int, error) {
+	available := r.GetAvailableVersions(group, kind)
+	if len(available) == 0 {
+		return nil, 0, fmt.Errorf("no CRD loaded for %s/%s", group, kind)
+	}
+	for _, v := range []string{from, to} {
+		if !slices.Contains(available, v) {
+			return nil, 0, fmt.Errorf("version %s of %s/%s is not loaded (loaded: %s)", v, group, kind, strings.Join(available, ", "))
+		}
+	}
+
+	fromAPI, toAPI := group+"/"+from, group+"/"+to
+	keys := func(apiVersion string) map[string][]string {
+		m := make(map[string][]string)
+		for _, f := range r.ListFields(apiVersion, kind) {
+			m[f.Path] = f.MapKeys
+		}
+		return m
+	}
+	fromKeys, toKeys := keys(fromAPI), keys(toAPI)
+
+	paths := make(map[string]bool)
+	for p := range fromKeys {
+		paths[p] = true
+	}
+	for p := range toKeys {
+		paths[p] = true
+	}
+
+	var diffs []FieldDiff
+	same := 0
+	for p := range paths {
+		a, b := fromKeys[p], toKeys[p]
+		if a != nil && b != nil && slices.Equal(a, b) {
+			same++
+			continue
+		}
+		diffs = append(diffs, FieldDiff{
+			Path:     p,
+			FromKeys: a,
+			ToKeys:   b,
+			FromList: a != nil || r.IsArrayField(fromAPI, kind, p),
+			ToList:   b != nil || r.IsArrayField(toAPI, kind, p),
+		})
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+	return diffs, same, nil
+}
@@ -0,0 +1,178 @@
+package crd
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FetchOptions configures how CRDs and specs are downloaded
+type FetchOptions struct {
+	Timeout time.Duration // Limit for each attempt, including reading the body
+	Retries int           // Extra attempts after a network error, HTTP 429 or 5xx
+}
+
+// DefaultFetchOptions are used until SetFetchOptions is called
+var DefaultFetchOptions = FetchOptions{Timeout: 30 * time.Second, Retries: 2}
+
+var fetchOptions = DefaultFetchOptions
+
+// retryBackoff is the wait before the first retry, doubled for each one after
+var retryBackoff = time.Second
+
+// ErrOffline is returned by Fetch while downloads are turned off
+var ErrOffline = errors.New("network access is turned off (--offline)")
+
+var offline bool
+
+// SetOffline turns downloads off, or back on, and returns the previous setting
+func SetOffline(off bool) bool {
+	prev := offline
+	offline = off
+	return prev
+}
+
+// Offline reports whether downloads are turned off
+func Offline() bool {
+	return offline
+}
+
+// SetFetchOptions sets how downloads are made and returns the previous options
+func SetFetchOptions(opts FetchOptions) FetchOptions {
+	prev := fetchOptions
+	fetchOptions = opts
+	return prev
+}
+
+// Fetch downloads rawURL, going through the proxy named by HTTPS_PROXY,
+// HTTP_PROXY and NO_PROXY, and retrying failures that may be transient.
+// When sha256sum is set, the download must have that hex SHA256 checksum.
+// Fails with ErrOffline, without any request, while downloads are off.
+func Fetch(rawURL, sha256sum string) ([]byte, error) {
+	if offline {
+		return nil, ErrOffline
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	client := &http.Client{Timeout: fetchOptions.Timeout, Transport: transport}
+
+	var data []byte
+	var err error
+	attempts := 0
+	for backoff := retryBackoff; ; backoff *= 2 {
+		attempts++
+		data, err = fetchOnce(client, rawURL)
+		if err == nil || !isRetryable(err) || attempts > fetchOptions.Retries {
+			break
+		}
+		time.Sleep(backoff)
+	}
+	if err != nil {
+		if attempts > 1 {
+			return nil, fmt.Errorf("%w (gave up after %d attempts)", err, attempts)
+		}
+		return nil, err
+	}
+	if sha256sum != "" {
+		sum := sha256.Sum256(data)
+		if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, sha256sum) {
+			return nil, fmt.Errorf("checksum mismatch: got sha256 %s, want %s", got, sha256sum)
+		}
+	}
+	return data, nil
+}
+
+// retryableError marks a failure worth another attempt
+type retryableError struct{ err error }
+
+func (e retryableError) Error() string { return e.err.Error() }
+func (e retryableError) Unwrap() error { return e.err }
+
+func isRetryable(err error) bool {
+	var r retryableError
+	return errors.As(err, &r)
+}
+
+// fetchOnce makes a single attempt at downloading rawURL, with credentials
+// for it if any are configured
+func fetchOnce(client *http.Client, rawURL string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	authSource, err := authorize(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req) //nolint:gosec // User-provided URL is intentional
+	if err != nil {
+		return nil, describeRequestError(rawURL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, describeStatus(resp, authSource)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, retryableError{fmt.Errorf("reading response: %w", err)}
+	}
+	return data, nil
+}
+
+// describeRequestError explains a failed request, pointing TLS failures at
+// the usual cause: a proxy or private CA the system doesn't trust
+func describeRequestError(rawURL string, err error) error {
+	var unknownAuthority x509.UnknownAuthorityError
+	var verification *tls.CertificateVerificationError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &unknownAuthority), errors.As(err, &verification),
+		errors.As(err, &hostname), errors.As(err, &invalid):
+		return fmt.Errorf("TLS certificate verification failed%s: %w (if a proxy or private CA intercepts HTTPS, add its certificate to the system trust store or point SSL_CERT_FILE at it)", viaProxy(rawURL), err)
+	case strings.Contains(err.Error(), "tls:"):
+		return fmt.Errorf("TLS handshake failed%s: %w", viaProxy(rawURL), err)
+	}
+	return retryableError{fmt.Errorf("fetching URL%s: %w", viaProxy(rawURL), err)}
+}
+
+// describeStatus explains an HTTP error response to a request sent with
+// credentials from authSource, or without any if it's empty
+func describeStatus(resp *http.Response, authSource string) error {
+	err := fmt.Errorf("HTTP %s", resp.Status)
+	switch code := resp.StatusCode; {
+	case (code == http.StatusUnauthorized || code == http.StatusForbidden) && authSource != "":
+		return fmt.Errorf("%w: access denied with the credentials from %s (check they're current and can read this source)", err, authSource)
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		if u := resp.Request.URL; u.Scheme == "http" && !isLoopback(u.Hostname()) {
+			return fmt.Errorf("%w: access denied (credentials are only sent over HTTPS)", err)
+		}
+		return fmt.Errorf("%w: access denied (for a private source, set credentials with crdAuth in the config, GITHUB_TOKEN for GitHub, or in ~/.netrc)", err)
+	case code == http.StatusProxyAuthRequired:
+		return fmt.Errorf("%w: the proxy rejected the request (check the credentials in HTTPS_PROXY or HTTP_PROXY)", err)
+	case code == http.StatusTooManyRequests || code >= 500:
+		return retryableError{err}
+	}
+	return err
+}
+
+// viaProxy names the proxy a request for rawURL goes through, if any
+func viaProxy(rawURL string) string {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return ""
+	}
+	proxy, err := http.ProxyFromEnvironment(req)
+	if err != nil || proxy == nil {
+		return ""
+	}
+	return " via proxy " + proxy.Redacted()
+}
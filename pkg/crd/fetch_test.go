@@ -0,0 +1,136 @@
+package crd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useFetchOptions sets fetch options without waiting between retries, and
+// without credentials from the environment, for the duration of a test
+func useFetchOptions(t *testing.T, opts FetchOptions) {
+	t.Helper()
+	t.Setenv("NETRC", filepath.Join(t.TempDir(), "netrc"))
+	prev := SetFetchOptions(opts)
+	prevBackoff := retryBackoff
+	retryBackoff = time.Millisecond
+	t.Cleanup(func() {
+		SetFetchOptions(prev)
+		retryBackoff = prevBackoff
+	})
+}
+
+func TestFetchRetriesTransientFailures(t *testing.T) {
+	useFetchOptions(t, FetchOptions{Timeout: 5 * time.Second, Retries: 2})
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("kind: CustomResourceDefinition\n"))
+	}))
+	defer srv.Close()
+
+	data, err := Fetch(srv.URL, "")
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if string(data) != "kind: CustomResourceDefinition\n" {
+		t.Errorf("Fetch() = %q", data)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("requests = %d, want 3", n)
+	}
+}
+
+func TestFetchGivesUp(t *testing.T) {
+	useFetchOptions(t, FetchOptions{Timeout: 5 * time.Second, Retries: 1})
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	_, err := Fetch(srv.URL, "")
+	if err == nil || !strings.Contains(err.Error(), "502") || !strings.Contains(err.Error(), "gave up after 2 attempts") {
+		t.Errorf("Fetch() error = %v, want a 502 after 2 attempts", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+}
+
+func TestFetchAccessDenied(t *testing.T) {
+	useFetchOptions(t, FetchOptions{Timeout: 5 * time.Second, Retries: 2})
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	_, err := Fetch(srv.URL, "")
+	if err == nil || !strings.Contains(err.Error(), "access denied") {
+		t.Errorf("Fetch() error = %v, want access denied", err)
+	}
+	// Auth failures aren't retried
+	if n := requests.Load(); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+}
+
+func TestFetchUntrustedCertificate(t *testing.T) {
+	useFetchOptions(t, FetchOptions{Timeout: 5 * time.Second, Retries: 2})
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	_, err := Fetch(srv.URL, "")
+	if err == nil || !strings.Contains(err.Error(), "TLS certificate verification failed") || !strings.Contains(err.Error(), "SSL_CERT_FILE") {
+		t.Errorf("Fetch() error = %v, want a certificate verification failure", err)
+	}
+}
+
+func TestFetchChecksum(t *testing.T) {
+	useFetchOptions(t, FetchOptions{Timeout: 5 * time.Second})
+	body := "kind: CustomResourceDefinition\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	sum := sha256.Sum256([]byte(body))
+	want := hex.EncodeToString(sum[:])
+
+	if _, err := Fetch(srv.URL, strings.ToUpper(want)); err != nil {
+		t.Errorf("Fetch() with matching checksum error = %v", err)
+	}
+	_, err := Fetch(srv.URL, strings.Repeat("0", 64))
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") || !strings.Contains(err.Error(), want) {
+		t.Errorf("Fetch() with wrong checksum error = %v", err)
+	}
+}
+
+func TestFetchOffline(t *testing.T) {
+	useFetchOptions(t, FetchOptions{Timeout: 5 * time.Second})
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer srv.Close()
+
+	defer SetOffline(SetOffline(true))
+	if _, err := Fetch(srv.URL, ""); !errors.Is(err, ErrOffline) {
+		t.Errorf("Fetch() error = %v, want ErrOffline", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("requests = %d, want none", n)
+	}
+}
@@ -1,11 +1,12 @@
 package crd
 
 import (
+	"bytes"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
@@ -92,19 +93,9 @@ func (r *CRDRegistry) LoadFromFile(path string) error {
 
 // LoadFromURL loads CRD definitions from a URL
 func (r *CRDRegistry) LoadFromURL(url string) error {
-	resp, err := http.Get(url) //nolint:gosec // User-provided URL is intentional
+	data, err := Fetch(url, "")
 	if err != nil {
-		return fmt.Errorf("fetching CRD from URL: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP %d fetching CRD from %s", resp.StatusCode, url)
-	}
-
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("reading CRD response: %w", err)
+		return fmt.Errorf("fetching CRD from %s: %w", url, err)
 	}
 	return r.loadFromBytes(data, url)
 }
@@ -131,13 +122,15 @@ func (r *CRDRegistry) LoadFromDirectory(dir string) error {
 }
 
 // loadFromBytes parses CRD YAML content (supports multi-document)
+// Only the extracted field paths and keys are retained; the parsed schema trees
+// are dropped after each document so large bundles don't stay resident.
 func (r *CRDRegistry) loadFromBytes(data []byte, source string) error {
-	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
 	docIndex := 0
 
 	for {
-		var doc crdDocument
-		err := decoder.Decode(&doc)
+		var node yaml.Node
+		err := decoder.Decode(&node)
 		if err == io.EOF {
 			break
 		}
@@ -146,51 +139,109 @@ func (r *CRDRegistry) loadFromBytes(data []byte, source string) error {
 		}
 		docIndex++
 
-		// Skip non-CRD documents
-		if doc.Kind != "CustomResourceDefinition" {
+		// Skip non-CRD documents without decoding them further
+		if !isCRDNode(&node) {
 			continue
 		}
 
-		// Track versions for this group+kind
+		var doc crdDocument
+		if err := node.Decode(&doc); err != nil {
+			return fmt.Errorf("parsing YAML document %d in %s: %w", docIndex-1, source, err)
+		}
+
 		group := doc.Spec.Group
 		kind := doc.Spec.Names.Kind
-		groupKindKey := group + "/" + kind
 
 		// Process each version in the CRD
-		for _, version := range doc.Spec.Versions {
+		for i := range doc.Spec.Versions {
+			version := &doc.Spec.Versions[i]
 			apiVersion := group + "/" + version.Name
-			key := apiVersion + "/" + kind
-
-			// Track this version for the group+kind
-			r.versions[groupKindKey] = appendUnique(r.versions[groupKindKey], version.Name)
-
-			// Ensure this CRD type is registered (even if no convertible fields)
-			if r.fields[key] == nil {
-				r.fields[key] = []CRDFieldInfo{}
-			}
 
 			// Extract list fields from the schema
 			var fields []CRDFieldInfo
 			allArrays := make(map[string]bool)
 			findCRDListFields(&version.Schema.OpenAPIV3Schema, "", apiVersion, kind, &fields, allArrays)
 
-			// Store ALL array field paths for this type (for filtering non-arrays)
-			if len(allArrays) > 0 {
-				r.arrayFields[key] = allArrays
-			}
+			// Release the schema tree as soon as its fields are extracted
+			version.Schema.OpenAPIV3Schema = yaml.Node{}
 
-			// Store fields that have map-type lists
-			for _, f := range fields {
-				if f.ListType == "map" && len(f.MapKeys) > 0 {
-					r.fields[key] = append(r.fields[key], f)
-				}
-			}
+			r.addVersion(group, kind, version.Name, fields, allArrays)
 		}
 	}
 
 	return nil
 }
 
+// addVersion stores the fields extracted from one CRD version
+func (r *CRDRegistry) addVersion(group, kind, version string, fields []CRDFieldInfo, allArrays map[string]bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kind = r.intern(kind)
+	apiVersion := r.intern(group + "/" + version)
+	key := apiVersion + "/" + kind
+
+	// Track this version for the group+kind
+	groupKindKey := group + "/" + kind
+	r.versions[groupKindKey] = appendUnique(r.versions[groupKindKey], r.intern(version))
+
+	// Ensure this CRD type is registered (even if no convertible fields)
+	if r.fields[key] == nil {
+		r.fields[key] = []CRDFieldInfo{}
+	}
+
+	// Store ALL array field paths for this type (for filtering non-arrays)
+	if len(allArrays) > 0 {
+		arrays := make(map[string]bool, len(allArrays))
+		for p := range allArrays {
+			arrays[r.intern(p)] = true
+		}
+		r.arrayFields[key] = arrays
+	}
+
+	// Store fields that have map-type lists
+	stored := r.fields[key]
+	for _, f := range fields {
+		if f.ListType == "map" && len(f.MapKeys) > 0 {
+			stored = append(stored, r.compactField(f))
+		}
+	}
+	r.fields[key] = slices.Clip(stored)
+}
+
+// isCRDNode reports whether a decoded document is a CustomResourceDefinition
+func isCRDNode(doc *yaml.Node) bool {
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		doc = doc.Content[0]
+	}
+	if doc.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == "kind" {
+			return doc.Content[i+1].Value == "CustomResourceDefinition"
+		}
+	}
+	return false
+}
+
+// compactField returns a copy of f whose strings are interned in the registry.
+// Callers must hold the write lock.
+func (r *CRDRegistry) compactField(f CRDFieldInfo) CRDFieldInfo {
+	keys := make([]string, len(f.MapKeys))
+	for i, k := range f.MapKeys {
+		keys[i] = r.intern(k)
+	}
+	return CRDFieldInfo{
+		Path:       r.intern(f.Path),
+		Type:       r.intern(f.Type),
+		MapKeys:    keys,
+		ListType:   r.intern(f.ListType),
+		APIVersion: r.intern(f.APIVersion),
+		Kind:       r.intern(f.Kind),
+	}
+}
+
 func findCRDListFields(node *yaml.Node, path, apiVersion, kind string, fields *[]CRDFieldInfo, allArrays map[string]bool) {
 	if node == nil || node.Kind != yaml.MappingNode {
 		return
@@ -324,19 +375,20 @@ func (e *CRDSourceEntry) GetDownloadURL(version string) string {
 
 // LoadCRDs loads CRD definitions from various sources into the global registry
 func LoadCRDs(sources []string) error {
+	registry := GetGlobalRegistry()
 	for _, source := range sources {
 		var err error
 		if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
-			err = globalCRDRegistry.LoadFromURL(source)
+			err = registry.LoadFromURL(source)
 		} else {
-			info, statErr := globalCRDRegistry.fs.Stat(source)
+			info, statErr := registry.fs.Stat(source)
 			if statErr != nil {
 				return fmt.Errorf("accessing CRD source %s: %w", source, statErr)
 			}
 			if info.IsDir() {
-				err = globalCRDRegistry.LoadFromDirectory(source)
+				err = registry.LoadFromDirectory(source)
 			} else {
-				err = globalCRDRegistry.LoadFromFile(source)
+				err = registry.LoadFromFile(source)
 			}
 		}
 		if err != nil {
@@ -0,0 +1,132 @@
+package crd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+	"gopkg.in/yaml.v3"
+)
+
+// OLM bundle annotation naming the bundle's manifests directory
+const bundleManifestsAnnotation = "operators.operatorframework.io.bundle.manifests.v1"
+
+// BundleManifestsDir returns the manifests directory of the OLM bundle at dir,
+// as named by its metadata/annotations.yaml, or "" if dir is not a bundle
+func BundleManifestsDir(filesystem fs.FileSystem, dir string) string {
+	data, err := filesystem.ReadFile(filepath.Join(dir, "metadata", "annotations.yaml"))
+	if err != nil {
+		return ""
+	}
+	var doc struct {
+		Annotations map[string]string `yaml:"annotations"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return ""
+	}
+	manifests, ok := doc.Annotations[bundleManifestsAnnotation]
+	if !ok {
+		return ""
+	}
+	// The annotation is a path relative to the bundle root, like "manifests/"
+	manifests = path.Clean("/" + manifests)
+	if manifests == "/" {
+		manifests = "/manifests"
+	}
+	return filepath.Join(dir, filepath.FromSlash(manifests[1:]))
+}
+
+// CatalogBundle is an olm.bundle entry of a file-based catalog with the CRDs
+// embedded in it
+type CatalogBundle struct {
+	Name    string
+	Package string
+	CRDs    [][]byte // each a CRD manifest, decoded from an olm.bundle.object
+}
+
+// catalogEntry is the part of a file-based catalog entry read for bundles
+type catalogEntry struct {
+	Schema     string `json:"schema" yaml:"schema"`
+	Name       string `json:"name" yaml:"name"`
+	Package    string `json:"package" yaml:"package"`
+	Properties []struct {
+		Type  string `json:"type" yaml:"type"`
+		Value struct {
+			Data string `json:"data" yaml:"data"`
+		} `json:"value" yaml:"value"`
+	} `json:"properties" yaml:"properties"`
+}
+
+// CatalogBundles returns the bundles of a file-based catalog that embed CRDs.
+// The catalog may be a YAML document stream or a stream of JSON objects, as
+// written by opm render. Returns an error if data holds no olm.bundle entries.
+func CatalogBundles(data []byte) ([]CatalogBundle, error) {
+	entries, err := decodeCatalog(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var bundles []CatalogBundle
+	found := false
+	for _, e := range entries {
+		if e.Schema != "olm.bundle" {
+			continue
+		}
+		found = true
+		b := CatalogBundle{Name: e.Name, Package: e.Package}
+		for _, p := range e.Properties {
+			if p.Type != "olm.bundle.object" || p.Value.Data == "" {
+				continue
+			}
+			obj, err := base64.StdEncoding.DecodeString(p.Value.Data)
+			if err != nil {
+				return nil, fmt.Errorf("bundle %s: decoding object: %w", e.Name, err)
+			}
+			if _, err := ExtractCRDMetadata(obj); err == nil {
+				b.CRDs = append(b.CRDs, obj)
+			}
+		}
+		if len(b.CRDs) > 0 {
+			bundles = append(bundles, b)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no olm.bundle entries found")
+	}
+	return bundles, nil
+}
+
+// decodeCatalog decodes the entries of a YAML or JSON catalog stream
+func decodeCatalog(data []byte) ([]catalogEntry, error) {
+	var entries []catalogEntry
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		for {
+			var e catalogEntry
+			if err := dec.Decode(&e); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("parsing JSON: %w", err)
+			}
+			entries = append(entries, e)
+		}
+		return entries, nil
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var e catalogEntry
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("parsing YAML: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
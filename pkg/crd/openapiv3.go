@@ -0,0 +1,164 @@
+package crd
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// openAPIV3Schema is the part of an OpenAPI v3 schema needed to find list
+// fields, as published by a cluster's /openapi/v3 endpoint
+type openAPIV3Schema struct {
+	Ref           string                     `json:"$ref"`
+	AllOf         []openAPIV3Schema          `json:"allOf"`
+	Type          string                     `json:"type"`
+	Properties    map[string]openAPIV3Schema `json:"properties"`
+	Items         *openAPIV3Schema           `json:"items"`
+	ListType      string                     `json:"x-kubernetes-list-type"`
+	ListMapKeys   []string                   `json:"x-kubernetes-list-map-keys"`
+	PatchMergeKey string                     `json:"x-kubernetes-patch-merge-key"`
+	GVK           []struct {
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		Kind    string `json:"kind"`
+	} `json:"x-kubernetes-group-version-kind"`
+}
+
+// LoadOpenAPIV3 registers the kinds of one group-version document of a
+// cluster's /openapi/v3 endpoint. Built-in kinds and installed CRDs are
+// registered alike, keyed by their list-map keys or patch merge keys.
+func (r *CRDRegistry) LoadOpenAPIV3(data []byte, source string) error {
+	var doc struct {
+		Components struct {
+			Schemas map[string]openAPIV3Schema `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parsing OpenAPI v3 document %s: %w", source, err)
+	}
+
+	schemas := doc.Components.Schemas
+	for _, name := range slices.Sorted(maps.Keys(schemas)) {
+		schema := schemas[name]
+		for _, gvk := range schema.GVK {
+			apiVersion := gvk.Version
+			if gvk.Group != "" {
+				apiVersion = gvk.Group + "/" + gvk.Version
+			}
+			var fields []CRDFieldInfo
+			allArrays := make(map[string]bool)
+			findOpenAPIV3ListFields(schemas, schema, "", apiVersion, gvk.Kind, &fields, allArrays, map[string]bool{})
+			r.addVersion(gvk.Group, gvk.Kind, gvk.Version, fields, allArrays)
+		}
+	}
+	return nil
+}
+
+// LoadOpenAPIV3Directory registers the kinds of every group-version document
+// saved in dir
+func (r *CRDRegistry) LoadOpenAPIV3Directory(dir string) error {
+	return r.fs.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return err
+		}
+		data, err := r.fs.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return r.LoadOpenAPIV3(data, path)
+	})
+}
+
+// findOpenAPIV3ListFields walks a schema like findCRDListFields, following
+// references between component schemas. visiting holds the references being
+// walked, so recursive types (e.g., JSONSchemaProps) end the walk.
+func findOpenAPIV3ListFields(schemas map[string]openAPIV3Schema, schema openAPIV3Schema, path, apiVersion, kind string, fields *[]CRDFieldInfo, allArrays map[string]bool, visiting map[string]bool) {
+	// A field's own extensions sit next to the reference to its type
+	if ref := schemaRef(schema); ref != "" {
+		if visiting[ref] {
+			return
+		}
+		visiting[ref] = true
+		defer delete(visiting, ref)
+		target := schemas[strings.TrimPrefix(ref, "#/components/schemas/")]
+		findOpenAPIV3ListFields(schemas, mergeOpenAPIV3Extensions(target, schema), path, apiVersion, kind, fields, allArrays, visiting)
+		return
+	}
+
+	if schema.Type == "array" && path != "" {
+		allArrays[path] = true
+
+		keys := schema.ListMapKeys
+		if len(keys) == 0 && schema.PatchMergeKey != "" {
+			keys = []string{schema.PatchMergeKey}
+		}
+		if len(keys) > 0 {
+			var itemType string
+			if schema.Items != nil {
+				itemType = openAPIV3TypeName(schemaRef(*schema.Items))
+			}
+			*fields = append(*fields, CRDFieldInfo{
+				Path:       path,
+				Type:       itemType,
+				ListType:   "map",
+				MapKeys:    keys,
+				APIVersion: apiVersion,
+				Kind:       kind,
+			})
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(schema.Properties)) {
+		prop := schema.Properties[name]
+		propPath := name
+		if path != "" {
+			propPath = path + "." + name
+		}
+		findOpenAPIV3ListFields(schemas, prop, propPath, apiVersion, kind, fields, allArrays, visiting)
+	}
+	if schema.Items != nil {
+		findOpenAPIV3ListFields(schemas, *schema.Items, path, apiVersion, kind, fields, allArrays, visiting)
+	}
+}
+
+// schemaRef returns the reference a schema stands for, given directly or as
+// the only member of allOf
+func schemaRef(schema openAPIV3Schema) string {
+	if schema.Ref == "" && len(schema.AllOf) == 1 {
+		return schema.AllOf[0].Ref
+	}
+	return schema.Ref
+}
+
+// openAPIV3TypeName returns the name detection gives the built-in type a
+// reference is to, as for the Go types (e.g., corev1.EnvVar), or "" for others
+func openAPIV3TypeName(ref string) string {
+	name, ok := strings.CutPrefix(ref, "#/components/schemas/io.k8s.api.")
+	if !ok {
+		return ""
+	}
+	// core.v1.EnvVar -> corev1.EnvVar
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return ""
+	}
+	return strings.ReplaceAll(name[:i], ".", "") + name[i:]
+}
+
+// mergeOpenAPIV3Extensions returns target with the list extensions of the
+// field referencing it
+func mergeOpenAPIV3Extensions(target, field openAPIV3Schema) openAPIV3Schema {
+	if field.ListType != "" {
+		target.ListType = field.ListType
+	}
+	if len(field.ListMapKeys) > 0 {
+		target.ListMapKeys = field.ListMapKeys
+	}
+	if field.PatchMergeKey != "" {
+		target.PatchMergeKey = field.PatchMergeKey
+	}
+	return target
+}
@@ -1,6 +1,9 @@
 package crd
 
 import (
+	"slices"
+	"sync"
+
 	"github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
 )
 
@@ -8,10 +11,14 @@ import (
 type FieldInfo struct {
 	Path     string
 	MergeKey string
+	Type     string // element type name, if known
 }
 
-// CRDRegistry stores CRD metadata for Custom Resource types
+// CRDRegistry stores CRD metadata for Custom Resource types. It is safe for
+// concurrent use: loads take the write lock only while storing parsed fields,
+// so queries are not blocked while large bundles are being parsed.
 type CRDRegistry struct {
+	mu sync.RWMutex
 	// Map of "apiVersion/kind" to list of convertible fields
 	fields map[string][]CRDFieldInfo
 	// Map of "group/kind" to list of available versions (e.g., ["v1", "v1alpha1"])
@@ -19,6 +26,9 @@ type CRDRegistry struct {
 	// Map of "apiVersion/kind" to set of ALL array field paths (even without map keys)
 	// Used to filter non-array fields from "potentially convertible" list
 	arrayFields map[string]map[string]bool
+	// Interned strings shared by all entries (apiVersions, kinds, paths, keys).
+	// Large CRD bundles repeat the same values thousands of times.
+	strs map[string]string
 	// FileSystem for file operations (allows mocking in tests)
 	fs fs.FileSystem
 }
@@ -29,12 +39,28 @@ func NewCRDRegistry(filesystem fs.FileSystem) *CRDRegistry {
 		fields:      make(map[string][]CRDFieldInfo),
 		versions:    make(map[string][]string),
 		arrayFields: make(map[string]map[string]bool),
+		strs:        make(map[string]string),
 		fs:          filesystem,
 	}
 }
 
+// intern returns a canonical copy of s so repeated values share one allocation.
+// Callers must hold the write lock.
+func (r *CRDRegistry) intern(s string) string {
+	if v, ok := r.strs[s]; ok {
+		return v
+	}
+	if r.strs == nil {
+		r.strs = make(map[string]string)
+	}
+	r.strs[s] = s
+	return s
+}
+
 // GetFieldInfo returns field info for a specific path in a CRD type
 func (r *CRDRegistry) GetFieldInfo(apiVersion, kind, yamlPath string) *CRDFieldInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	key := apiVersion + "/" + kind
 	fields, ok := r.fields[key]
 	if !ok {
@@ -51,6 +77,8 @@ func (r *CRDRegistry) GetFieldInfo(apiVersion, kind, yamlPath string) *CRDFieldI
 
 // HasType checks if a CRD type is registered
 func (r *CRDRegistry) HasType(apiVersion, kind string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	key := apiVersion + "/" + kind
 	_, ok := r.fields[key]
 	return ok
@@ -58,6 +86,8 @@ func (r *CRDRegistry) HasType(apiVersion, kind string) bool {
 
 // HasGroupKind checks if any version of a group/kind exists
 func (r *CRDRegistry) HasGroupKind(group, kind string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	key := group + "/" + kind
 	_, ok := r.versions[key]
 	return ok
@@ -65,6 +95,8 @@ func (r *CRDRegistry) HasGroupKind(group, kind string) bool {
 
 // IsArrayField checks if a field is an array (regardless of merge keys)
 func (r *CRDRegistry) IsArrayField(apiVersion, kind, yamlPath string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	key := apiVersion + "/" + kind
 	arrays, ok := r.arrayFields[key]
 	if !ok {
@@ -75,8 +107,10 @@ func (r *CRDRegistry) IsArrayField(apiVersion, kind, yamlPath string) bool {
 
 // GetAvailableVersions returns all loaded versions for a group/kind
 func (r *CRDRegistry) GetAvailableVersions(group, kind string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	key := group + "/" + kind
-	return r.versions[key]
+	return slices.Clone(r.versions[key])
 }
 
 // CheckVersionMismatch checks if a type exists but with a different version
@@ -93,6 +127,9 @@ func (r *CRDRegistry) CheckVersionMismatch(apiVersion, kind string) (bool, bool,
 		group = ""
 	}
 
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	// Check if we have any version of this group/kind
 	groupKindKey := group + "/" + kind
 	availableVersions, hasGroupKind := r.versions[groupKindKey]
@@ -101,7 +138,7 @@ func (r *CRDRegistry) CheckVersionMismatch(apiVersion, kind string) (bool, bool,
 	typeKey := apiVersion + "/" + kind
 	_, hasExactVersion := r.fields[typeKey]
 
-	return hasGroupKind, hasExactVersion, availableVersions
+	return hasGroupKind, hasExactVersion, slices.Clone(availableVersions)
 }
 
 // splitAPIVersion splits an apiVersion into group and version
@@ -138,17 +175,24 @@ func lastIndexOf(s string, c byte) int {
 	return -1
 }
 
-// ListTypes returns all registered apiVersion/kind combinations
+// ListTypes returns all registered apiVersion/kind combinations, sorted
 func (r *CRDRegistry) ListTypes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	var types []string
 	for k := range r.fields {
 		types = append(types, k)
 	}
+	slices.Sort(types)
 	return types
 }
 
-// ListFields returns all convertible fields for a CRD type
+// ListFields returns all convertible fields for a CRD type. Stored field
+// slices are replaced rather than appended to, so the result stays valid after
+// later loads; callers must not modify it.
 func (r *CRDRegistry) ListFields(apiVersion, kind string) []CRDFieldInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	key := apiVersion + "/" + kind
 	return r.fields[key]
 }
@@ -162,26 +206,35 @@ func (f *CRDFieldInfo) ToFieldInfo() *FieldInfo {
 	return &FieldInfo{
 		Path:     f.Path,
 		MergeKey: mergeKey,
+		Type:     f.Type,
 	}
 }
 
-// Global CRD registry instance
-var globalCRDRegistry = NewCRDRegistry(fs.OSFileSystem{})
+// Global CRD registry instance, guarded by globalMu so it can be reset while
+// other goroutines query it
+var (
+	globalMu          sync.RWMutex
+	globalCRDRegistry = NewCRDRegistry(fs.OSFileSystem{})
+)
 
 // GetGlobalRegistry returns the global CRD registry instance
 func GetGlobalRegistry() *CRDRegistry {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
 	return globalCRDRegistry
 }
 
 // ResetGlobalRegistry resets the global CRD registry to a fresh empty state
 // This is primarily for testing purposes
 func ResetGlobalRegistry() {
+	globalMu.Lock()
+	defer globalMu.Unlock()
 	globalCRDRegistry = NewCRDRegistry(fs.OSFileSystem{})
 }
 
 // IsConvertibleCRDField checks if a field in a CRD is convertible (has map keys)
 func IsConvertibleCRDField(apiVersion, kind, yamlPath string) *FieldInfo {
-	info := globalCRDRegistry.GetFieldInfo(apiVersion, kind, yamlPath)
+	info := GetGlobalRegistry().GetFieldInfo(apiVersion, kind, yamlPath)
 	if info != nil && len(info.MapKeys) > 0 {
 		return info.ToFieldInfo()
 	}
@@ -190,5 +243,5 @@ func IsConvertibleCRDField(apiVersion, kind, yamlPath string) *FieldInfo {
 
 // IsCRDArrayField checks if a field is an array (regardless of merge keys)
 func IsCRDArrayField(apiVersion, kind, yamlPath string) bool {
-	return globalCRDRegistry.IsArrayField(apiVersion, kind, yamlPath)
+	return GetGlobalRegistry().IsArrayField(apiVersion, kind, yamlPath)
 }
@@ -157,4 +157,5 @@ type CRDSourceEntry struct {
 	AllInOne       string `yaml:"all_in_one"`      // Single file with all resources
 	DefaultVersion string `yaml:"default_version"` // Default version to use
 	Note           string `yaml:"note"`            // Optional note about this source
+	SHA256         string `yaml:"sha256"`          // Optional checksum of the default version's download
 }
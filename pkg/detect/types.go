@@ -1,13 +1,68 @@
 package detect
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Key strategies for maps keyed by several fields
+const (
+	KeyStrategyNested    = "nested"    // namespaceA: {svcA: {...}}
+	KeyStrategyComposite = "composite" // namespaceA/svcA: {...}
+)
+
+// CompositeKeySeparator joins the key fields of a composite map key
+const CompositeKeySeparator = "/"
+
 // DetectedCandidate represents a field detected for conversion
 type DetectedCandidate struct {
-	ValuesPath     string // Path in values.yaml (e.g., "volumes")
-	YAMLPath       string // Path in K8s resource (e.g., "spec.template.spec.volumes")
-	MergeKey       string // The patchMergeKey field (e.g., "name", "mountPath")
-	ElementType    string // Go type name (e.g., "corev1.Volume")
-	SectionName    string // The YAML section name (e.g., "volumes")
-	ResourceKind   string // K8s resource kind (e.g., "Deployment", "StatefulSet")
-	TemplateFile   string // Template file where this was detected (e.g., "deployment.yaml")
-	ExistsInValues bool   // Whether the path exists in values.yaml (false = template-only pattern)
+	ValuesPath     string            // Path in values.yaml (e.g., "volumes")
+	YAMLPath       string            // Path in K8s resource (e.g., "spec.template.spec.volumes")
+	ListIndexes    map[string]int    // Item of each list on YAMLPath the template renders it in, keyed by the list's path
+	MergeKey       string            // The patchMergeKey field (e.g., "name", "mountPath")
+	ElementType    string            // Go type name (e.g., "corev1.Volume")
+	SectionName    string            // The YAML section name (e.g., "volumes")
+	ResourceKind   string            // K8s resource kind (e.g., "Deployment", "StatefulSet")
+	TemplateFile   string            // Template file where this was detected (e.g., "deployment.yaml")
+	TemplatePath   string            // TemplateFile relative to its template directory (e.g., "web/deployment.yaml")
+	ExistsInValues bool              // Whether the path exists in values.yaml (false = template-only pattern)
+	Set            bool              // Convert to a set keyed by each item's value (e.g., regcred: true)
+	MergeKeys      []string          // Key fields of a multi-key conversion, outermost first (MergeKey is the first)
+	KeyStrategy    string            // "nested" or "composite" when converting by MergeKeys
+	Rename         map[string]string // Item fields renamed in map entries (value: v)
+	Scalar         string            // Item field an entry holding only it is shortened to (FOO: bar)
+	Curated        string            // Curated rule set keying a list Kubernetes gives no merge key
+	Synthetic      bool              // MergeKey names map entries but isn't an item field
+	NewPath        string            // Values path the converted list moves to (renamePaths), if renamed
+	ConfigData     bool              // Rendered into ConfigMap or Secret data, detected from its default value
+	RenderedBy     []Renderer        // Every template rendering the path, ordered by template
+}
+
+// Renderer is a template rendering a candidate's values path
+type Renderer struct {
+	Template string // Template file relative to the chart root (e.g., "templates/api/deployment.yaml")
+	Kind     string // Kind of the resource the template renders (e.g., "Deployment")
+}
+
+// Shaped reports whether the candidate's map entries have a custom shape
+func (c DetectedCandidate) Shaped() bool {
+	return len(c.Rename) > 0 || c.Scalar != ""
+}
+
+// ShapeDescription describes the candidate's entry shape, e.g. "value as v, scalar value"
+func (c DetectedCandidate) ShapeDescription() string {
+	fields := make([]string, 0, len(c.Rename))
+	for field := range c.Rename {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	var parts []string
+	for _, field := range fields {
+		parts = append(parts, fmt.Sprintf("%s as %s", field, c.Rename[field]))
+	}
+	if c.Scalar != "" {
+		parts = append(parts, "scalar "+c.Scalar)
+	}
+	return strings.Join(parts, ", ")
 }
@@ -0,0 +1,36 @@
+package fs
+
+import "bytes"
+
+// bom is the UTF-8 byte-order mark some editors write at the start of a file
+var bom = []byte("\xef\xbb\xbf")
+
+// Normalize strips a byte-order mark and converts CRLF line endings to LF, so
+// line-based edits see the content the same way the YAML parser does
+func Normalize(data []byte) []byte {
+	data = bytes.TrimPrefix(data, bom)
+	return bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+}
+
+// MatchFormat returns updated with the byte-order mark, line endings, and
+// final newline state of original, so a rewritten file differs from the
+// original only where its content changed
+func MatchFormat(original, updated []byte) []byte {
+	out := Normalize(updated)
+	if len(original) > 0 {
+		if bytes.HasSuffix(original, []byte("\n")) {
+			if !bytes.HasSuffix(out, []byte("\n")) {
+				out = append(out, '\n')
+			}
+		} else {
+			out = bytes.TrimRight(out, "\n")
+		}
+	}
+	if bytes.Contains(original, []byte("\r\n")) {
+		out = bytes.ReplaceAll(out, []byte("\n"), []byte("\r\n"))
+	}
+	if bytes.HasPrefix(original, bom) {
+		out = append(append([]byte{}, bom...), out...)
+	}
+	return out
+}
@@ -0,0 +1,29 @@
+package fs
+
+import "testing"
+
+func TestMatchFormat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		original string
+		updated  string
+		want     string
+	}{
+		{"keeps final newline", "a: 1\n", "a: {}", "a: {}\n"},
+		{"keeps missing final newline", "a: 1", "a: {}\n", "a: {}"},
+		{"keeps CRLF", "a: 1\r\nb: 2\r\n", "a: {}\nb: 2\n", "a: {}\r\nb: 2\r\n"},
+		{"keeps BOM", "\xef\xbb\xbfa: 1\n", "# comment\na: {}\n", "\xef\xbb\xbf# comment\na: {}\n"},
+		{"moves a stray BOM back to the start", "\xef\xbb\xbfa: 1\n", "\xef\xbb\xbfa: {}\n", "\xef\xbb\xbfa: {}\n"},
+		{"no BOM added", "a: 1\n", "\xef\xbb\xbfa: {}\n", "a: {}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := string(MatchFormat([]byte(tt.original), []byte(tt.updated))); got != tt.want {
+				t.Errorf("MatchFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ type FileSystem interface {
 	ReadFile(path string) ([]byte, error)
 	WriteFile(path string, data []byte, perm os.FileMode) error
 	Stat(path string) (os.FileInfo, error)
+	Chmod(path string, mode os.FileMode) error
 	WalkDir(root string, fn fs.WalkDirFunc) error
 }
 
@@ -32,7 +33,22 @@ func (OSFileSystem) Stat(path string) (os.FileInfo, error) {
 	return os.Stat(path)
 }
 
+// Chmod changes the mode of a file in the OS filesystem
+func (OSFileSystem) Chmod(path string, mode os.FileMode) error {
+	return os.Chmod(path, mode)
+}
+
 // WalkDir walks a directory tree in the OS filesystem
 func (OSFileSystem) WalkDir(root string, fn fs.WalkDirFunc) error {
 	return filepath.WalkDir(root, fn)
 }
+
+// Mode returns the permission bits of the file at path, or fallback if it
+// cannot be stat'd
+func Mode(fsys FileSystem, path string, fallback os.FileMode) os.FileMode {
+	info, err := fsys.Stat(path)
+	if err != nil || info == nil {
+		return fallback
+	}
+	return info.Mode().Perm()
+}
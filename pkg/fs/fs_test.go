@@ -36,6 +36,13 @@ func (m *MockFileSystem) Stat(path string) (os.FileInfo, error) {
 	return nil, os.ErrNotExist
 }
 
+func (m *MockFileSystem) Chmod(path string, mode os.FileMode) error {
+	if _, ok := m.files[path]; ok {
+		return nil
+	}
+	return os.ErrNotExist
+}
+
 func (m *MockFileSystem) WalkDir(root string, fn fs.WalkDirFunc) error {
 	// Simplified implementation for testing
 	return nil
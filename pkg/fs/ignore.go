@@ -0,0 +1,120 @@
+package fs
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile is the file listing the chart paths helm leaves out of packages
+const IgnoreFile = ".helmignore"
+
+// junkPatterns match files no chart means to ship, ignored with or without a
+// .helmignore: patch leftovers, editor backups and swap files, and macOS
+// Finder metadata
+var junkPatterns = []string{"*.orig", "*.rej", "*~", "*.swp", ".DS_Store"}
+
+// Ignore matches the chart paths excluded by a chart's .helmignore, and junk
+type Ignore struct {
+	root  string
+	rules []ignoreRule
+}
+
+// ignoreRule is one .helmignore pattern
+type ignoreRule struct {
+	pattern  string
+	negate   bool // !pattern: include paths an earlier rule excluded
+	dirOnly  bool // pattern/: match directories only
+	anchored bool // pattern holds a /: match the path from the chart root
+}
+
+// LoadIgnore reads the .helmignore of the chart at chartRoot. A chart without
+// one ignores only junk.
+func LoadIgnore(fsys FileSystem, chartRoot string) *Ignore {
+	ig := &Ignore{root: chartRoot}
+	for _, p := range junkPatterns {
+		ig.rules = append(ig.rules, ignoreRule{pattern: p})
+	}
+	data, err := fsys.ReadFile(filepath.Join(chartRoot, IgnoreFile))
+	if err != nil {
+		return ig
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r := ignoreRule{}
+		if rest, ok := strings.CutPrefix(line, "!"); ok {
+			r.negate, line = true, rest
+		}
+		if rest, ok := strings.CutSuffix(line, "/"); ok {
+			r.dirOnly, line = true, rest
+		}
+		line = strings.TrimPrefix(line, "./")
+		if rest, ok := strings.CutPrefix(line, "/"); ok {
+			r.anchored, line = true, rest
+		}
+		if strings.Contains(line, "/") {
+			r.anchored = true
+		}
+		// A malformed pattern would never match, so drop it
+		if _, err := path.Match(line, ""); err != nil || line == "" {
+			continue
+		}
+		r.pattern = line
+		ig.rules = append(ig.rules, r)
+	}
+	return ig
+}
+
+// Ignored reports whether p, a path in the chart, is excluded: it, or a
+// directory it is in, matches the rules. The last matching rule wins, so a
+// !pattern includes paths an earlier pattern excluded.
+func (ig *Ignore) Ignored(p string, isDir bool) bool {
+	rel, err := filepath.Rel(ig.root, p)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range parts {
+		if ig.match(strings.Join(parts[:i+1], "/"), isDir || i < len(parts)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// match applies the rules to one slash-separated chart path
+func (ig *Ignore) match(rel string, isDir bool) bool {
+	ignored := false
+	for _, r := range ig.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		target := rel
+		if !r.anchored {
+			target = path.Base(rel)
+		}
+		if ok, _ := path.Match(r.pattern, target); ok {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// WalkChart walks dir, a directory in the chart at chartRoot, as WalkDir does,
+// leaving out the paths the chart's .helmignore excludes and junk
+func WalkChart(fsys FileSystem, chartRoot, dir string, fn fs.WalkDirFunc) error {
+	ig := LoadIgnore(fsys, chartRoot)
+	return fsys.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && p != dir && ig.Ignored(p, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		return fn(p, d, err)
+	})
+}
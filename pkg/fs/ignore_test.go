@@ -0,0 +1,89 @@
+package fs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIgnored(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	helmignore := `# Patterns to ignore when building packages
+*.tmp
+/ci/
+templates/tests/
+scratch/
+!keep.tmp
+`
+	if err := os.WriteFile(filepath.Join(root, IgnoreFile), []byte(helmignore), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ig := LoadIgnore(OSFileSystem{}, root)
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"templates/deployment.yaml", false, false},
+		{"templates/deployment.yaml.orig", false, true},
+		{"templates/deployment.yaml.rej", false, true},
+		{"templates/deployment.yaml~", false, true},
+		{"templates/.deployment.yaml.swp", false, true},
+		{"templates/.DS_Store", false, true},
+		{"templates/notes.tmp", false, true},
+		{"templates/keep.tmp", false, false},
+		{"ci", true, true},
+		{"ci/values.yaml", false, true},
+		{"templates/ci/values.yaml", false, false}, // /ci/ is anchored at the root
+		{"templates/tests/test-connection.yaml", false, true},
+		{"templates/scratch/draft.yaml", false, true}, // scratch/ matches at any depth
+		{"templates/scratch", false, false},           // but only directories
+	}
+	for _, tt := range tests {
+		if got := ig.Ignored(filepath.Join(root, tt.path), tt.isDir); got != tt.want {
+			t.Errorf("Ignored(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestWalkChart(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		IgnoreFile:                    "templates/tests/\n",
+		"templates/deployment.yaml":   "kind: Deployment\n",
+		"templates/service.yaml.orig": "kind: Service\n",
+		"templates/tests/test.yaml":   "kind: Pod\n",
+	} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	tdir := filepath.Join(root, "templates")
+	err := WalkChart(OSFileSystem{}, root, tdir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		got = append(got, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"templates/deployment.yaml"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("WalkChart() visited %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,135 @@
+package fs
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// NotesFile is the usage notes Helm renders after install. It's scanned for
+// references to converted paths, but never rewritten: it's documentation
+// read by people, and its list loops are best updated by hand.
+const NotesFile = "NOTES.txt"
+
+// TemplateLayout is where a chart's templates live and which files in
+// those directories are templates
+type TemplateLayout struct {
+	// Dirs are the directories holding templates, relative to the chart root.
+	// Their subdirectories are included.
+	Dirs []string
+	// Extensions are the extensions of template files, partials (.tpl) included
+	Extensions []string
+}
+
+// DefaultTemplateLayout is Helm's own: the templates directory, holding
+// YAML manifests and .tpl partials
+var DefaultTemplateLayout = TemplateLayout{
+	Dirs:       []string{"templates"},
+	Extensions: []string{".yaml", ".yml", ".tpl"},
+}
+
+var templateLayout = DefaultTemplateLayout
+
+// SetTemplateLayout sets where templates are read from and returns the
+// previous layout. Fields left empty keep the default. Extensions are
+// matched case-insensitively, with or without their leading dot.
+func SetTemplateLayout(l TemplateLayout) TemplateLayout {
+	prev := templateLayout
+	if len(l.Dirs) == 0 {
+		l.Dirs = DefaultTemplateLayout.Dirs
+	}
+	if len(l.Extensions) == 0 {
+		l.Extensions = DefaultTemplateLayout.Extensions
+	}
+	exts := make([]string, len(l.Extensions))
+	for i, e := range l.Extensions {
+		exts[i] = "." + strings.ToLower(strings.TrimPrefix(e, "."))
+	}
+	l.Extensions = exts
+	templateLayout = l
+	return prev
+}
+
+// TemplateDirs returns the chart's template directories under chartRoot
+func TemplateDirs(chartRoot string) []string {
+	dirs := make([]string, 0, len(templateLayout.Dirs))
+	seen := make(map[string]bool)
+	for _, d := range templateLayout.Dirs {
+		dir := filepath.Join(chartRoot, filepath.FromSlash(d))
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// IsTemplate reports whether path, a file in a template directory, is a
+// template to scan and rewrite. NotesFile never is.
+func IsTemplate(path string) bool {
+	if IsNotes(path) {
+		return false
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range templateLayout.Extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPartial reports whether path is a template of defines, rendering no
+// resources of its own
+func IsPartial(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".tpl")
+}
+
+// IsManifest reports whether path is a template rendering resources
+func IsManifest(path string) bool {
+	return IsTemplate(path) && !IsPartial(path)
+}
+
+// IsNotes reports whether path is the chart's NotesFile
+func IsNotes(path string) bool {
+	return filepath.Base(path) == NotesFile
+}
+
+// WalkTemplates walks the template directories of the chart at chartRoot as
+// WalkChart does. Directories the chart doesn't have are skipped.
+func WalkTemplates(fsys FileSystem, chartRoot string, fn fs.WalkDirFunc) error {
+	for _, dir := range TemplateDirs(chartRoot) {
+		if info, err := fsys.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		if err := WalkChart(fsys, chartRoot, dir, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TemplateRel returns path, a file in one of the template directories of the
+// chart at chartRoot, relative to that directory with forward slashes (e.g.,
+// "web/deployment.yaml"), or its base name if it isn't in one
+func TemplateRel(chartRoot, path string) string {
+	for _, dir := range TemplateDirs(chartRoot) {
+		rel, err := filepath.Rel(dir, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.Base(path)
+}
+
+// InTemplateDir reports whether rel, a path relative to the chart root, is
+// in one of the chart's template directories
+func InTemplateDir(rel string) bool {
+	rel = filepath.Clean(rel)
+	for _, dir := range TemplateDirs("") {
+		if strings.HasPrefix(rel, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package k8s
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configDataKey is the field lists rendered into ConfigMap and Secret data
+// are keyed by. Empty leaves them undetected, as their shape is up to the
+// application reading the config rather than a Kubernetes schema.
+var configDataKey string
+
+// configDataFields are the ConfigMap and Secret fields holding config files
+var configDataFields = map[string]bool{
+	"data":       true,
+	"stringData": true,
+}
+
+// SetConfigDataKey sets the field lists rendered into ConfigMap and Secret
+// data are keyed by, enabling their detection, and returns the previous key
+func SetConfigDataKey(key string) string {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	prev := configDataKey
+	configDataKey = key
+	return prev
+}
+
+// configDataField returns the field info of a list rendered at yamlPath into
+// the data of a ConfigMap or Secret (e.g., data.servers, inside a config file
+// written with toYaml), keyed by configDataKey. As config files have no
+// schema, value, the default the chart renders there, must be a list of
+// mappings that all hold the key. Returns nil when config data detection is
+// off, yamlPath isn't in config data, or value isn't such a list.
+func configDataField(apiVersion, kind, yamlPath string, value *yaml.Node) *FieldInfo {
+	settingsMu.RLock()
+	key := configDataKey
+	settingsMu.RUnlock()
+	if key == "" || apiVersion != "v1" || (kind != "ConfigMap" && kind != "Secret") {
+		return nil
+	}
+	field, _, _ := strings.Cut(yamlPath, ".")
+	if !configDataFields[field] || !keyedList(value, key) {
+		return nil
+	}
+	return &FieldInfo{
+		Path:       yamlPath,
+		IsSlice:    true,
+		MergeKey:   key,
+		TypeName:   kind + " data",
+		ConfigData: true,
+	}
+}
+
+// keyedList reports whether node is a non-empty list of mappings that all
+// hold key
+func keyedList(node *yaml.Node, key string) bool {
+	if node == nil || node.Kind != yaml.SequenceNode || len(node.Content) == 0 {
+		return false
+	}
+	for _, item := range node.Content {
+		if findYAMLNodeAtPath(item, []string{key}) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// valuesDocument returns the chart's parsed values.yaml, or nil if it can't
+// be read, for looking up the defaults of config data lists
+func valuesDocument(chartRoot string) *yaml.Node {
+	data, err := os.ReadFile(filepath.Join(chartRoot, "values.yaml"))
+	if err != nil {
+		return nil
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil
+	}
+	return &doc
+}
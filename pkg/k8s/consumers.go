@@ -0,0 +1,122 @@
+package k8s
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/crd"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/detect"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/parser"
+)
+
+// PathConsumer is a resource field a values path is rendered into
+type PathConsumer struct {
+	TemplateFile string // Template file rendering the path (e.g., "deployment.yaml")
+	ChartPath    string // TemplateFile relative to the chart root (e.g., "templates/api/deployment.yaml")
+	LineNumber   int    // Line of the directive rendering it
+	Kind         string // Kind of the resource (e.g., "Deployment")
+	YAMLPath     string // Field the path is rendered into
+	MergeKey     string // The field's merge key, "" for a list without one (atomic)
+}
+
+// ConsumerConflict is a values path rendered into fields that disagree on
+// conversion: one is keyed by a different merge key than another, or is an
+// atomic list without one. Converting it would break some of its consumers.
+type ConsumerConflict struct {
+	ValuesPath string
+	Consumers  []PathConsumer
+}
+
+// consumerSet collects the fields each values path is rendered into
+type consumerSet map[string][]PathConsumer
+
+// add records a consumer of a values path, once per template field
+func (s consumerSet) add(valuesPath string, c PathConsumer) {
+	for _, existing := range s[valuesPath] {
+		if existing.ChartPath == c.ChartPath && existing.YAMLPath == c.YAMLPath {
+			return
+		}
+	}
+	s[valuesPath] = append(s[valuesPath], c)
+}
+
+// conflicts returns the values paths whose consumers disagree on the merge
+// key, ordered by path
+func (s consumerSet) conflicts() []ConsumerConflict {
+	var conflicts []ConsumerConflict
+	for path, consumers := range s {
+		keys := make(map[string]bool)
+		for _, c := range consumers {
+			keys[c.MergeKey] = true
+		}
+		if len(keys) > 1 {
+			conflicts = append(conflicts, ConsumerConflict{ValuesPath: path, Consumers: consumers})
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].ValuesPath < conflicts[j].ValuesPath })
+	return conflicts
+}
+
+// setRenderers sets the templates rendering each candidate's values path from
+// its consumers, so a path rendered by several templates is listed under each
+func (s consumerSet) setRenderers(candidates []DetectedCandidate) {
+	for i := range candidates {
+		var renderers []detect.Renderer
+		seen := make(map[detect.Renderer]bool)
+		for _, c := range s[candidates[i].ValuesPath] {
+			r := detect.Renderer{Template: c.ChartPath, Kind: c.Kind}
+			if !seen[r] {
+				seen[r] = true
+				renderers = append(renderers, r)
+			}
+		}
+		sort.Slice(renderers, func(a, b int) bool {
+			if renderers[a].Template != renderers[b].Template {
+				return renderers[a].Template < renderers[b].Template
+			}
+			return renderers[a].Kind < renderers[b].Kind
+		})
+		candidates[i].RenderedBy = renderers
+	}
+}
+
+// chartRelPath returns path relative to chartRoot with forward slashes, or its
+// base name if it isn't under chartRoot
+func chartRelPath(chartRoot, path string) string {
+	rel, err := filepath.Rel(chartRoot, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Base(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// withoutConflicts drops the candidates for conflicting values paths
+func withoutConflicts(candidates []DetectedCandidate, conflicts []ConsumerConflict) []DetectedCandidate {
+	if len(conflicts) == 0 {
+		return candidates
+	}
+	conflicted := make(map[string]bool, len(conflicts))
+	for _, c := range conflicts {
+		conflicted[c.ValuesPath] = true
+	}
+	var kept []DetectedCandidate
+	for _, c := range candidates {
+		if !conflicted[c.ValuesPath] {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// atomicList reports whether the field at yamlPath in the template's resource
+// is a list without a merge key: a slice without patchMergeKey, or a CRD array
+// without list-map keys
+func atomicList(parsed *parser.ParsedTemplate, hasCRDType bool, yamlPath string) bool {
+	if parsed.GoType != nil {
+		if check, _ := CheckFieldType(parsed.GoType, yamlPath); check == FieldSliceNoKey {
+			return true
+		}
+	}
+	return hasCRDType && crd.IsCRDArrayField(parsed.APIVersion, parsed.Kind, yamlPath)
+}
@@ -0,0 +1,104 @@
+package k8s
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// CuratedRule keys a built-in list field Kubernetes merges atomically (it has
+// no patchMergeKey), for charts that opt in to keyed overrides of it
+type CuratedRule struct {
+	Packages []string // API packages defining the element type (networking, extensions)
+	Type     string   // element type name, e.g. IngressRule
+	MergeKey string
+	// Synthetic marks a key that isn't a field of the items: it only names
+	// the map entries, and the helper leaves it out of the rendered items
+	Synthetic bool
+}
+
+// CuratedRuleSets are the curated rules by the name of the set enabling them
+var CuratedRuleSets = map[string][]CuratedRule{
+	// Ingress rules by host, TLS entries by the secret holding their certificate
+	"ingress": {
+		{Packages: []string{"networking", "extensions"}, Type: "IngressRule", MergeKey: "host"},
+		{Packages: []string{"networking", "extensions"}, Type: "IngressTLS", MergeKey: "secretName"},
+	},
+	// NetworkPolicy ingress and egress rules by a name for the rule
+	"networkpolicy": {
+		{Packages: []string{"networking", "extensions"}, Type: "NetworkPolicyIngressRule", MergeKey: "name", Synthetic: true},
+		{Packages: []string{"networking", "extensions"}, Type: "NetworkPolicyEgressRule", MergeKey: "name", Synthetic: true},
+	},
+	// Role and ClusterRole rules by a name for the rule
+	"rbac": {
+		{Packages: []string{"rbac"}, Type: "PolicyRule", MergeKey: "name", Synthetic: true},
+	},
+}
+
+// CuratedRuleSetNames returns the names of the curated rule sets, sorted
+func CuratedRuleSetNames() []string {
+	names := make([]string, 0, len(CuratedRuleSets))
+	for name := range CuratedRuleSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// enabledCuratedSets are the names of the enabled sets
+var enabledCuratedSets []string
+
+// SetCuratedRuleSets enables the named curated rule sets ("all" enables
+// every one), returning the previously enabled names. Unknown names are an
+// error, leaving the enabled sets as they were.
+func SetCuratedRuleSets(names []string) ([]string, error) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	var enabled []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		sets := []string{name}
+		if name == "all" {
+			sets = CuratedRuleSetNames()
+		} else if _, ok := CuratedRuleSets[name]; !ok {
+			return enabledCuratedSets, fmt.Errorf("unknown curated rule set %q: want all or one of %s", name, strings.Join(CuratedRuleSetNames(), ", "))
+		}
+		for _, set := range sets {
+			if !seen[set] {
+				seen[set] = true
+				enabled = append(enabled, set)
+			}
+		}
+	}
+	prev := enabledCuratedSets
+	enabledCuratedSets = enabled
+	return prev, nil
+}
+
+// EnabledCuratedRuleSets returns the names of the enabled curated rule sets
+func EnabledCuratedRuleSets() []string {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return enabledCuratedSets
+}
+
+// curatedRule returns the enabled curated rule for a list's element type and
+// the set enabling it, or nil
+func curatedRule(elementType reflect.Type) (*CuratedRule, string) {
+	if elementType == nil {
+		return nil, ""
+	}
+	pkg := strings.TrimPrefix(elementType.PkgPath(), "k8s.io/api/")
+	group, _, _ := strings.Cut(pkg, "/")
+	for _, set := range EnabledCuratedRuleSets() {
+		for i, r := range CuratedRuleSets[set] {
+			if r.Type == elementType.Name() && pkg != elementType.PkgPath() && slices.Contains(r.Packages, group) {
+				return &CuratedRuleSets[set][i], set
+			}
+		}
+	}
+	return nil, ""
+}
@@ -6,9 +6,11 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/scottrigby/helm-list-to-map-plugin/pkg/crd"
 	"github.com/scottrigby/helm-list-to-map-plugin/pkg/detect"
+	filesystem "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
 	"github.com/scottrigby/helm-list-to-map-plugin/pkg/parser"
 	"gopkg.in/yaml.v3"
 )
@@ -28,6 +30,8 @@ const (
 	CategoryMissingCRD UndetectedCategory = "missing_crd"
 	// CategoryUnknownType - No type information available (can't determine if array)
 	CategoryUnknownType UndetectedCategory = "unknown_type"
+	// CategoryNotInRelease - Field doesn't exist in the target Kubernetes release's schema
+	CategoryNotInRelease UndetectedCategory = "not_in_release"
 )
 
 // UndetectedUsage represents a .Values list usage that couldn't be auto-detected
@@ -52,54 +56,58 @@ type PartialTemplate struct {
 
 // DetectionResult combines all detection outputs
 type DetectionResult struct {
-	Candidates []DetectedCandidate
-	Undetected []UndetectedUsage
-	Partials   []PartialTemplate
+	Candidates     []DetectedCandidate
+	Undetected     []UndetectedUsage
+	Partials       []PartialTemplate
+	DeprecatedAPIs []DeprecatedAPI     // resources using deprecated or removed API versions
+	ParseErrors    []*parser.FileError // templates that couldn't be read, left out of detection
+	Conflicts      []ConsumerConflict  // paths rendered into fields that disagree on conversion
 }
 
 // detectConversionCandidates scans templates for convertible fields using K8s API introspection
-// and CRD registry lookup
-func DetectConversionCandidates(chartRoot string) ([]DetectedCandidate, error) {
+// and CRD registry lookup. Templates that can't be parsed are returned with
+// their errors and left out, so the rest of the chart is still scanned. Values
+// paths rendered into fields that disagree on the merge key are returned as
+// conflicts instead of candidates.
+func DetectConversionCandidates(chartRoot string) ([]DetectedCandidate, []ConsumerConflict, []*parser.FileError, error) {
 	var candidates []DetectedCandidate
+	var parseErrors []*parser.FileError
 	seen := make(map[string]bool) // dedup by valuesPath
+	consumers := make(consumerSet)
+	values := valuesDocument(chartRoot)
 
-	templatesDir := filepath.Join(chartRoot, "templates")
-
-	err := filepath.WalkDir(templatesDir, func(path string, d os.DirEntry, err error) error {
+	err := filesystem.WalkTemplates(filesystem.OSFileSystem{}, chartRoot, func(path string, d os.DirEntry, err error) error {
 		if err != nil || d.IsDir() {
 			return err
 		}
-		if !strings.HasSuffix(path, ".yaml") && !strings.HasSuffix(path, ".yml") {
+		if !filesystem.IsManifest(path) {
 			return nil
 		}
 
 		// Parse template file
 		parsed, err := parser.ParseTemplateFile(path)
 		if err != nil {
-			return nil // Skip problematic files
+			parseErrors = append(parseErrors, parser.ReadError(path, err))
+			return nil
 		}
 
-		// Resolve Go type from apiVersion/kind (parser doesn't do this to avoid import cycle)
-		if parsed.APIVersion != "" && parsed.Kind != "" && parsed.GoType == nil {
-			parsed.GoType = ResolveKubeAPIType(parsed.APIVersion, parsed.Kind)
+		resolveTemplateType(parsed, chartRoot, path)
+		if parsed.APIVersion == "" {
+			// Templated apiVersion with no target release to choose one for
+			return nil
 		}
 
 		// Check if we can resolve this type (either built-in K8s or CRD)
 		hasCRDType := parsed.APIVersion != "" && parsed.Kind != "" &&
 			crd.GetGlobalRegistry().HasType(parsed.APIVersion, parsed.Kind)
 
-		// Skip if no K8s type resolved and no CRD type available
-		if parsed.GoType == nil && !hasCRDType {
-			return nil
-		}
-
 		// Process each directive
 		for _, directive := range parsed.Directives {
 			// Extract what .Values paths are being used
 			var valuesUsages []parser.ValuesUsage
 			if parser.HasIncludeDirective(directive.Content) {
 				visited := make(map[string]bool)
-				valuesUsages = parser.FollowIncludeChain(templatesDir, directive.Content, directive.WithContext, visited)
+				valuesUsages = parser.FollowIncludeChain(chartRoot, directive.Content, directive.WithContext, visited)
 			} else {
 				valuesUsages = parser.AnalyzeDirectiveContent(directive.Content, directive.WithContext)
 			}
@@ -115,10 +123,6 @@ func DetectConversionCandidates(chartRoot string) ([]DetectedCandidate, error) {
 					continue
 				}
 
-				if seen[usage.ValuesPath] {
-					continue
-				}
-
 				// The directive's YAMLPath tells us exactly where in the K8s structure
 				// this value is rendered (e.g., "spec.template.spec.securityContext").
 				// The values key name (e.g., "podSecurityContext") is irrelevant for
@@ -128,50 +132,126 @@ func DetectConversionCandidates(chartRoot string) ([]DetectedCandidate, error) {
 					// Rare case: directive at root level with no parent keys
 					continue
 				}
-				sectionName := GetLastPathSegment(usage.ValuesPath)
 
 				// Check if this path points to a convertible field
-				// Try built-in K8s types first, then CRD registry
-				var fieldInfo *FieldInfo
-				if parsed.GoType != nil {
+				// Try config data (if enabled) and built-in K8s types first, then CRD registry
+				fieldInfo := configDataField(parsed.APIVersion, parsed.Kind, fullYAMLPath, findYAMLNodeAtPath(values, strings.Split(usage.ValuesPath, ".")))
+				if fieldInfo == nil && fieldMissingInRelease(parsed.APIVersion, parsed.Kind, fullYAMLPath) {
+					continue
+				}
+				if fieldInfo == nil && parsed.GoType != nil {
 					fieldInfo = IsConvertibleField(parsed.GoType, fullYAMLPath)
 				}
 				if fieldInfo == nil && hasCRDType {
 					fieldInfo = convertCRDFieldInfo(crd.IsConvertibleCRDField(parsed.APIVersion, parsed.Kind, fullYAMLPath))
 				}
+				if fieldInfo == nil && parsed.GoType == nil {
+					// A pod template in a resource of unresolved type
+					fieldInfo = podSpecFallback(fullYAMLPath)
+				}
+				consumer := PathConsumer{
+					TemplateFile: filepath.Base(path),
+					ChartPath:    chartRelPath(chartRoot, path),
+					LineNumber:   directive.LineNumber,
+					Kind:         parsed.Kind,
+					YAMLPath:     fullYAMLPath,
+				}
 				if fieldInfo == nil {
+					if atomicList(parsed, hasCRDType, fullYAMLPath) {
+						consumers.add(usage.ValuesPath, consumer)
+					}
 					continue
 				}
+				consumer.MergeKey = fieldInfo.MergeKey
+				consumers.add(usage.ValuesPath, consumer)
 
-				seen[usage.ValuesPath] = true
-
-				// Build element type name
-				var elemTypeName string
-				if fieldInfo.ElementType != nil {
-					elemTypeName = FormatTypeName(fieldInfo.ElementType)
-				} else {
-					elemTypeName = "map[string]interface{}" // CRD types don't have Go types
+				if seen[usage.ValuesPath] {
+					continue
 				}
-
-				// Get relative template filename
-				templateFile := filepath.Base(path)
-
-				candidates = append(candidates, DetectedCandidate{
-					ValuesPath:   usage.ValuesPath,
-					YAMLPath:     fullYAMLPath,
-					MergeKey:     fieldInfo.MergeKey,
-					ElementType:  elemTypeName,
-					SectionName:  sectionName,
-					ResourceKind: parsed.Kind,
-					TemplateFile: templateFile,
-				})
+				seen[usage.ValuesPath] = true
+				candidates = append(candidates, newCandidate(usage.ValuesPath, fullYAMLPath, parsed.Kind, filesystem.TemplateRel(chartRoot, path), directive.ListIndexes, fieldInfo))
 			}
 		}
 
 		return nil
 	})
 
-	return candidates, err
+	// Paths whose consumers disagree are left for the user to decide
+	conflicts := consumers.conflicts()
+	candidates = withoutConflicts(candidates, conflicts)
+	consumers.setRenderers(candidates)
+	return candidates, conflicts, parseErrors, err
+}
+
+// resolveTemplateType resolves the Go type of a parsed template (the parser
+// doesn't do this to avoid an import cycle). A templated apiVersion or kind is
+// taken from the chart's kind hint for the template, if any; otherwise a
+// templated apiVersion is taken to be the one the target Kubernetes release
+// prefers for the kind, if set.
+func resolveTemplateType(parsed *parser.ParsedTemplate, chartRoot, path string) {
+	if rel, err := filepath.Rel(chartRoot, path); err == nil {
+		applyKindHint(parsed, rel)
+	}
+	if target := TargetKubeVersion(); parsed.APIVersion == "" && parsed.APIVersionTemplated && !target.IsZero() {
+		parsed.APIVersion = PreferredAPIVersion(parsed.Kind, target)
+	}
+	if parsed.APIVersion != "" && parsed.Kind != "" && parsed.GoType == nil && !ClusterSchema() {
+		parsed.GoType = ResolveKubeAPIType(parsed.APIVersion, parsed.Kind)
+	}
+}
+
+// settingsMu guards the detection settings (clusterSchema, kindHints,
+// enabledCuratedSets, targetKubeVersion, configDataKey and openAPISpec), so
+// they can be set while other goroutines detect
+var settingsMu sync.RWMutex
+
+// clusterSchema is set when the registry holds the schemas a cluster
+// publishes, which then describe built-in kinds in place of the Go types
+var clusterSchema bool
+
+// SetClusterSchema sets whether kinds are resolved only through the schemas
+// of a cluster loaded into the CRD registry, returning the previous setting
+func SetClusterSchema(on bool) bool {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	prev := clusterSchema
+	clusterSchema = on
+	return prev
+}
+
+// ClusterSchema reports whether kinds are resolved through a cluster's schemas
+func ClusterSchema() bool {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return clusterSchema
+}
+
+// newCandidate returns the candidate for a values path rendered at yamlPath
+// in a template, into a field described by fieldInfo
+func newCandidate(valuesPath, yamlPath, kind, templatePath string, listIndexes map[string]int, fieldInfo *FieldInfo) DetectedCandidate {
+	// Build element type name
+	var elemTypeName string
+	if fieldInfo.ElementType != nil {
+		elemTypeName = FormatTypeName(fieldInfo.ElementType)
+	} else if fieldInfo.TypeName != "" {
+		elemTypeName = fieldInfo.TypeName
+	} else {
+		elemTypeName = "map[string]interface{}" // CRD types don't have Go types
+	}
+	return DetectedCandidate{
+		ValuesPath:   valuesPath,
+		YAMLPath:     yamlPath,
+		ListIndexes:  listIndexes,
+		MergeKey:     fieldInfo.MergeKey,
+		ElementType:  elemTypeName,
+		SectionName:  GetLastPathSegment(valuesPath),
+		ResourceKind: kind,
+		TemplateFile: filepath.Base(templatePath),
+		TemplatePath: templatePath,
+		Curated:      fieldInfo.Curated,
+		Synthetic:    fieldInfo.Synthetic,
+		ConfigData:   fieldInfo.ConfigData,
+	}
 }
 
 // GetLastPathSegment returns the last segment of a dot-separated path
@@ -189,34 +269,46 @@ func DetectConversionCandidatesFull(chartRoot string) (*DetectionResult, error)
 	result := &DetectionResult{}
 	seen := make(map[string]bool)           // dedup candidates by valuesPath
 	seenUndetected := make(map[string]bool) // dedup undetected by valuesPath
-
-	templatesDir := filepath.Join(chartRoot, "templates")
+	consumers := make(consumerSet)
+	values := valuesDocument(chartRoot)
 
 	// First pass: scan for partial templates
-	partials, includeMap := ScanPartialTemplates(templatesDir)
+	partials, includeMap := ScanPartialTemplates(chartRoot)
 	result.Partials = partials
 
 	// Second pass: scan resource templates
-	err := filepath.WalkDir(templatesDir, func(path string, d os.DirEntry, err error) error {
+	err := filesystem.WalkTemplates(filesystem.OSFileSystem{}, chartRoot, func(path string, d os.DirEntry, err error) error {
 		if err != nil || d.IsDir() {
 			return err
 		}
-		if !strings.HasSuffix(path, ".yaml") && !strings.HasSuffix(path, ".yml") {
+		if !filesystem.IsManifest(path) {
 			return nil
 		}
 
 		// Parse template file
 		parsed, err := parser.ParseTemplateFile(path)
 		if err != nil {
-			return nil // Skip problematic files
+			result.ParseErrors = append(result.ParseErrors, parser.ReadError(path, err))
+			return nil
 		}
 
-		// Resolve Go type from apiVersion/kind (parser doesn't do this to avoid import cycle)
-		if parsed.APIVersion != "" && parsed.Kind != "" && parsed.GoType == nil {
-			parsed.GoType = ResolveKubeAPIType(parsed.APIVersion, parsed.Kind)
+		// Flag deprecated API versions the template names itself, whether or
+		// not anything in it converts
+		if parsed.APIVersion != "" {
+			if d, ok := checkDeprecatedAPI(filepath.Base(path), parsed.APIVersion, parsed.Kind); ok {
+				result.DeprecatedAPIs = append(result.DeprecatedAPIs, d)
+			}
+		}
+
+		resolveTemplateType(parsed, chartRoot, path)
+		if parsed.APIVersion == "" {
+			// Templated apiVersion with no target release to choose one for
+			return nil
 		}
 
 		templateFile := filepath.Base(path)
+		templatePath := filesystem.TemplateRel(chartRoot, path)
+		chartPath := chartRelPath(chartRoot, path)
 
 		// Check if we can resolve this type (either built-in K8s or CRD)
 		hasCRDType := parsed.APIVersion != "" && parsed.Kind != "" &&
@@ -239,7 +331,7 @@ func DetectConversionCandidatesFull(chartRoot string) (*DetectionResult, error)
 				var valuesUsages []parser.ValuesUsage
 				if parser.HasIncludeDirective(directive.Content) {
 					visited := make(map[string]bool)
-					valuesUsages = parser.FollowIncludeChain(templatesDir, directive.Content, directive.WithContext, visited)
+					valuesUsages = parser.FollowIncludeChain(chartRoot, directive.Content, directive.WithContext, visited)
 				} else {
 					valuesUsages = parser.AnalyzeDirectiveContent(directive.Content, directive.WithContext)
 				}
@@ -248,6 +340,22 @@ func DetectConversionCandidatesFull(chartRoot string) (*DetectionResult, error)
 					if !usage.IsListUse || usage.Pattern == "with" {
 						continue
 					}
+					// A pod template in a resource of unresolved type
+					if fieldInfo := podSpecFallback(directive.YAMLPath); fieldInfo != nil {
+						consumers.add(usage.ValuesPath, PathConsumer{
+							TemplateFile: templateFile,
+							ChartPath:    chartPath,
+							LineNumber:   directive.LineNumber,
+							Kind:         parsed.Kind,
+							YAMLPath:     directive.YAMLPath,
+							MergeKey:     fieldInfo.MergeKey,
+						})
+						if !seen[usage.ValuesPath] {
+							seen[usage.ValuesPath] = true
+							result.Candidates = append(result.Candidates, newCandidate(usage.ValuesPath, directive.YAMLPath, parsed.Kind, templatePath, directive.ListIndexes, fieldInfo))
+						}
+						continue
+					}
 					if seenUndetected[usage.ValuesPath] {
 						continue
 					}
@@ -255,10 +363,19 @@ func DetectConversionCandidatesFull(chartRoot string) (*DetectionResult, error)
 
 					var reason, suggestion string
 					var category UndetectedCategory
-					if parsed.APIVersion != "" && parsed.Kind != "" {
+					if parsed.APIVersion != "" && parsed.Kind != "" && ClusterSchema() {
+						reason = fmt.Sprintf("%s/%s is not served by the cluster", parsed.APIVersion, parsed.Kind)
+						suggestion = fmt.Sprintf("helm list-to-map add-rule --path='%s[]' --uniqueKey=name", usage.ValuesPath)
+						category = CategoryMissingCRD
+					} else if parsed.APIVersion != "" && parsed.Kind != "" {
 						reason = fmt.Sprintf("Custom Resource %s/%s without loaded CRD", parsed.APIVersion, parsed.Kind)
 						suggestion = fmt.Sprintf("helm list-to-map add-rule --path='%s[]' --uniqueKey=name", usage.ValuesPath)
 						category = CategoryMissingCRD
+					} else if parsed.KindTemplated {
+						rel, _ := filepath.Rel(chartRoot, path)
+						reason = "Resource kind is templated"
+						suggestion = fmt.Sprintf("declare it in .helm-list-to-map.yaml: kindHints: {%s: <apiVersion>/<Kind>}", kindHintKey(rel))
+						category = CategoryUnknownType
 					} else {
 						reason = "Unknown resource type"
 						suggestion = fmt.Sprintf("helm list-to-map add-rule --path='%s[]' --uniqueKey=name", usage.ValuesPath)
@@ -286,7 +403,7 @@ func DetectConversionCandidatesFull(chartRoot string) (*DetectionResult, error)
 			var valuesUsages []parser.ValuesUsage
 			if parser.HasIncludeDirective(directive.Content) {
 				visited := make(map[string]bool)
-				valuesUsages = parser.FollowIncludeChain(templatesDir, directive.Content, directive.WithContext, visited)
+				valuesUsages = parser.FollowIncludeChain(chartRoot, directive.Content, directive.WithContext, visited)
 			} else {
 				valuesUsages = parser.AnalyzeDirectiveContent(directive.Content, directive.WithContext)
 			}
@@ -302,10 +419,6 @@ func DetectConversionCandidatesFull(chartRoot string) (*DetectionResult, error)
 					continue
 				}
 
-				if seen[usage.ValuesPath] {
-					continue
-				}
-
 				// The directive's YAMLPath tells us exactly where in the K8s structure
 				// this value is rendered (e.g., "spec.template.spec.securityContext").
 				// The values key name (e.g., "podSecurityContext") is irrelevant for
@@ -315,13 +428,32 @@ func DetectConversionCandidatesFull(chartRoot string) (*DetectionResult, error)
 					// Rare case: directive at root level with no parent keys
 					continue
 				}
-				sectionName := GetLastPathSegment(usage.ValuesPath)
+
+				// A list written into a config file in a ConfigMap or Secret,
+				// when config data detection is on
+				fieldInfo := configDataField(parsed.APIVersion, parsed.Kind, fullYAMLPath, findYAMLNodeAtPath(values, strings.Split(usage.ValuesPath, ".")))
+
+				// The field may be newer than the release the chart targets
+				if fieldInfo == nil && fieldMissingInRelease(parsed.APIVersion, parsed.Kind, fullYAMLPath) {
+					if !seen[usage.ValuesPath] && !seenUndetected[usage.ValuesPath] {
+						seenUndetected[usage.ValuesPath] = true
+						result.Undetected = append(result.Undetected, UndetectedUsage{
+							ValuesPath:   usage.ValuesPath,
+							TemplateFile: templateFile,
+							LineNumber:   directive.LineNumber,
+							Reason:       fmt.Sprintf("Field %s does not exist in %s %s on Kubernetes %s", fullYAMLPath, parsed.APIVersion, parsed.Kind, TargetKubeVersion()),
+							APIVersion:   parsed.APIVersion,
+							Kind:         parsed.Kind,
+							Category:     CategoryNotInRelease,
+						})
+					}
+					continue
+				}
 
 				// Check if this path points to a convertible field
 				// Try built-in K8s types first, then CRD registry
-				var fieldInfo *FieldInfo
 				fieldCheck := FieldNotFound
-				if parsed.GoType != nil {
+				if fieldInfo == nil && parsed.GoType != nil {
 					fieldCheck, fieldInfo = CheckFieldType(parsed.GoType, fullYAMLPath)
 				}
 				// If it's not a slice in the K8s type, skip it entirely - it's not a list field
@@ -338,6 +470,13 @@ func DetectConversionCandidatesFull(chartRoot string) (*DetectionResult, error)
 					}
 				}
 
+				// A pod template in a Custom Resource whose CRD has no keys for it
+				if (fieldInfo == nil || fieldInfo.MergeKey == "") && parsed.GoType == nil {
+					if fallback := podSpecFallback(fullYAMLPath); fallback != nil {
+						fieldInfo = fallback
+					}
+				}
+
 				// No merge key found from K8s types or CRD registry
 				if fieldInfo == nil || fieldInfo.MergeKey == "" {
 					// Field is either:
@@ -354,8 +493,17 @@ func DetectConversionCandidatesFull(chartRoot string) (*DetectionResult, error)
 							continue
 						}
 					}
+					if fieldCheck == FieldSliceNoKey || hasCRDType {
+						consumers.add(usage.ValuesPath, PathConsumer{
+							TemplateFile: templateFile,
+							ChartPath:    chartPath,
+							LineNumber:   directive.LineNumber,
+							Kind:         parsed.Kind,
+							YAMLPath:     fullYAMLPath,
+						})
+					}
 
-					if !seenUndetected[usage.ValuesPath] {
+					if !seen[usage.ValuesPath] && !seenUndetected[usage.ValuesPath] {
 						seenUndetected[usage.ValuesPath] = true
 						var reason, suggestion string
 						var category UndetectedCategory
@@ -363,6 +511,10 @@ func DetectConversionCandidatesFull(chartRoot string) (*DetectionResult, error)
 							reason = fmt.Sprintf("Slice field %s has no patchMergeKey", fullYAMLPath)
 							suggestion = fmt.Sprintf("helm list-to-map add-rule --path='%s[]' --uniqueKey=name", usage.ValuesPath)
 							category = CategoryK8sNoKeys
+						} else if hasCRDType && ClusterSchema() {
+							reason = fmt.Sprintf("Array field %s has no list-map keys or patch merge key in the cluster's schema", fullYAMLPath)
+							suggestion = fmt.Sprintf("helm list-to-map add-rule --path='%s[]' --uniqueKey=name", usage.ValuesPath)
+							category = CategoryCRDNoKeys
 						} else if hasCRDType {
 							reason = fmt.Sprintf("Array field %s lacks x-kubernetes-list-map-keys", fullYAMLPath)
 							suggestion = fmt.Sprintf("helm list-to-map add-rule --path='%s[]' --uniqueKey=name", usage.ValuesPath)
@@ -386,31 +538,43 @@ func DetectConversionCandidatesFull(chartRoot string) (*DetectionResult, error)
 					continue
 				}
 
-				seen[usage.ValuesPath] = true
-
-				// Build element type name
-				var elemTypeName string
-				if fieldInfo.ElementType != nil {
-					elemTypeName = FormatTypeName(fieldInfo.ElementType)
-				} else {
-					elemTypeName = "map[string]interface{}" // CRD types don't have Go types
-				}
-
-				result.Candidates = append(result.Candidates, DetectedCandidate{
-					ValuesPath:   usage.ValuesPath,
+				consumers.add(usage.ValuesPath, PathConsumer{
+					TemplateFile: templateFile,
+					ChartPath:    chartPath,
+					LineNumber:   directive.LineNumber,
+					Kind:         parsed.Kind,
 					YAMLPath:     fullYAMLPath,
 					MergeKey:     fieldInfo.MergeKey,
-					ElementType:  elemTypeName,
-					SectionName:  sectionName,
-					ResourceKind: parsed.Kind,
-					TemplateFile: templateFile,
 				})
+				if seen[usage.ValuesPath] {
+					continue
+				}
+				seen[usage.ValuesPath] = true
+				result.Candidates = append(result.Candidates, newCandidate(usage.ValuesPath, fullYAMLPath, parsed.Kind, templatePath, directive.ListIndexes, fieldInfo))
 			}
 		}
 
 		return nil
 	})
 
+	// Paths whose consumers disagree are reported instead of converted
+	result.Conflicts = consumers.conflicts()
+	result.Candidates = withoutConflicts(result.Candidates, result.Conflicts)
+	consumers.setRenderers(result.Candidates)
+	if len(result.Conflicts) > 0 {
+		conflicted := make(map[string]bool, len(result.Conflicts))
+		for _, c := range result.Conflicts {
+			conflicted[c.ValuesPath] = true
+		}
+		var undetected []UndetectedUsage
+		for _, u := range result.Undetected {
+			if !conflicted[u.ValuesPath] {
+				undetected = append(undetected, u)
+			}
+		}
+		result.Undetected = undetected
+	}
+
 	// Update partials with their include sources
 	for i := range result.Partials {
 		for _, defName := range result.Partials[i].DefinedNames {
@@ -436,15 +600,15 @@ func DetectConversionCandidatesFull(chartRoot string) (*DetectionResult, error)
 }
 
 // scanPartialTemplates scans for .tpl files and extracts partial template information
-func ScanPartialTemplates(templatesDir string) ([]PartialTemplate, map[string][]string) {
+func ScanPartialTemplates(chartRoot string) ([]PartialTemplate, map[string][]string) {
 	var partials []PartialTemplate
 	includeMap := make(map[string][]string) // template name -> files that include it
 
-	_ = filepath.WalkDir(templatesDir, func(path string, d os.DirEntry, err error) error {
+	_ = filesystem.WalkTemplates(filesystem.OSFileSystem{}, chartRoot, func(path string, d os.DirEntry, err error) error {
 		if err != nil || d.IsDir() {
 			return err
 		}
-		if !strings.HasSuffix(path, ".tpl") {
+		if !filesystem.IsPartial(path) {
 			return nil
 		}
 
@@ -463,13 +627,13 @@ func ScanPartialTemplates(templatesDir string) ([]PartialTemplate, map[string][]
 		// Extract .Values usages
 		valuesUsages := extractAllValuesUsages(content)
 
-		relPath, _ := filepath.Rel(templatesDir, path)
-		if relPath == "" {
+		relPath, err := filepath.Rel(chartRoot, path)
+		if err != nil {
 			relPath = filepath.Base(path)
 		}
 
 		partials = append(partials, PartialTemplate{
-			FilePath:     "templates/" + relPath,
+			FilePath:     filepath.ToSlash(relPath),
 			DefinedNames: definedNames,
 			ValuesUsages: valuesUsages,
 		})
@@ -594,5 +758,6 @@ func convertCRDFieldInfo(crdFI *crd.FieldInfo) *FieldInfo {
 	return &FieldInfo{
 		Path:     crdFI.Path,
 		MergeKey: crdFI.MergeKey,
+		TypeName: crdFI.Type,
 	}
 }
@@ -13,6 +13,13 @@ type FieldInfo struct {
 	ElementType reflect.Type // If slice, the element type
 	IsSlice     bool
 	MergeKey    string // The patchMergeKey if this is a strategic merge patch list
+	TypeName    string // Element type name when there's no Go type (e.g., from a cluster's schema)
+	// Curated names the curated rule set MergeKey comes from, for lists
+	// Kubernetes gives no merge key; Synthetic is set when it isn't an item field
+	Curated   string
+	Synthetic bool
+	// ConfigData is set for lists rendered into ConfigMap or Secret data
+	ConfigData bool
 }
 
 // NavigateFieldSchema traverses a K8s type hierarchy following a YAML path
@@ -89,11 +96,52 @@ func NavigateFieldSchema(rootType reflect.Type, yamlPath string) (*FieldInfo, er
 		if info.MergeKey == "" {
 			info.MergeKey = GetK8sTypeMergeKey(info.ElementType)
 		}
+
+		// Then to the curated rules the chart enabled
+		if r, set := curatedRule(info.ElementType); info.MergeKey == "" && r != nil {
+			info.MergeKey, info.Synthetic, info.Curated = r.MergeKey, r.Synthetic, set
+		}
 	}
 
 	return info, nil
 }
 
+// IndexedYAMLPath returns yamlPath with the lists it passes through indexed
+// (e.g., spec.template.spec.containers[1].env), for tools that address
+// rendered manifests. Each list is indexed at its item in indexes, keyed by
+// the list's path as a template parse records them, or at its first item if
+// the template doesn't say. The path is returned as-is if the kind isn't a
+// built-in type.
+func IndexedYAMLPath(kind, yamlPath string, indexes map[string]int) string {
+	for _, apiVersion := range kindAPIVersions[kind] {
+		currentType := ResolveKubeAPIType(apiVersion, kind)
+		parts := strings.Split(yamlPath, ".")
+		indexed := make([]string, 0, len(parts))
+		for i, part := range parts {
+			if currentType.Kind() == reflect.Ptr {
+				currentType = currentType.Elem()
+			}
+			if currentType.Kind() != reflect.Struct {
+				break
+			}
+			field, found := FindFieldByJSONTag(currentType, part)
+			if !found {
+				break
+			}
+			currentType = field.Type
+			if currentType.Kind() == reflect.Slice && i < len(parts)-1 {
+				currentType = currentType.Elem()
+				part += fmt.Sprintf("[%d]", indexes[strings.Join(parts[:i+1], ".")])
+			}
+			indexed = append(indexed, part)
+		}
+		if len(indexed) == len(parts) {
+			return strings.Join(indexed, ".")
+		}
+	}
+	return yamlPath
+}
+
 // FindFieldByJSONTag finds a struct field by its json tag name
 // Also returns the patchMergeKey tag if present
 func FindFieldByJSONTag(structType reflect.Type, jsonName string) (reflect.StructField, bool) {
@@ -0,0 +1,68 @@
+package k8s
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/parser"
+)
+
+// KindHint declares the resource type of a template whose kind (or apiVersion)
+// is templated, so detection can classify it
+type KindHint struct {
+	APIVersion string // e.g., apps/v1
+	Kind       string // e.g., Deployment
+}
+
+// String returns the hint in the form it is written, e.g. apps/v1/Deployment
+func (h KindHint) String() string {
+	return h.APIVersion + "/" + h.Kind
+}
+
+// ParseKindHint parses a hint written as <apiVersion>/<Kind>, e.g.
+// apps/v1/Deployment or v1/Service
+func ParseKindHint(s string) (KindHint, error) {
+	i := strings.LastIndex(s, "/")
+	if i <= 0 || i == len(s)-1 {
+		return KindHint{}, fmt.Errorf("invalid kind hint %q: want <apiVersion>/<Kind>, e.g. apps/v1/Deployment", s)
+	}
+	return KindHint{APIVersion: s[:i], Kind: s[i+1:]}, nil
+}
+
+// kindHints maps chart-relative template paths (templates/deployment.yaml)
+// to the resource type declared for them
+var kindHints map[string]KindHint
+
+// SetKindHints sets the declared resource types of templates, keyed by
+// chart-relative path, returning the previous hints
+func SetKindHints(hints map[string]KindHint) map[string]KindHint {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	prev := kindHints
+	kindHints = hints
+	return prev
+}
+
+// applyKindHint fills in a templated apiVersion and kind from the hint for the
+// template at rel (relative to the chart root). Values written
+// explicitly in the template are kept.
+func applyKindHint(parsed *parser.ParsedTemplate, rel string) {
+	settingsMu.RLock()
+	hint, ok := kindHints[kindHintKey(rel)]
+	settingsMu.RUnlock()
+	if !ok {
+		return
+	}
+	if parsed.APIVersion == "" && parsed.APIVersionTemplated {
+		parsed.APIVersion = hint.APIVersion
+	}
+	if parsed.Kind == "" && parsed.KindTemplated {
+		parsed.Kind = hint.Kind
+	}
+}
+
+// kindHintKey returns the key of a template path given relative to the chart root
+func kindHintKey(rel string) string {
+	return path.Clean(strings.ReplaceAll(rel, "\\", "/"))
+}
@@ -0,0 +1,132 @@
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// OpenAPISpec is the Kubernetes API schema of one release, read from the
+// swagger.json the kubernetes repo publishes for it (api/openapi-spec)
+type OpenAPISpec struct {
+	definitions map[string]openAPISchema
+	kinds       map[string]string // apiVersion/kind -> definition name
+}
+
+// openAPISchema is the part of a swagger definition needed to walk fields
+type openAPISchema struct {
+	Ref        string                   `json:"$ref"`
+	Properties map[string]openAPISchema `json:"properties"`
+	Items      *openAPISchema           `json:"items"`
+	GVK        []struct {
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		Kind    string `json:"kind"`
+	} `json:"x-kubernetes-group-version-kind"`
+}
+
+// LoadOpenAPISpec reads a swagger.json file
+func LoadOpenAPISpec(path string) (*OpenAPISpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseOpenAPISpec(data)
+}
+
+// ParseOpenAPISpec parses the contents of a swagger.json file
+func ParseOpenAPISpec(data []byte) (*OpenAPISpec, error) {
+	var doc struct {
+		Definitions map[string]openAPISchema `json:"definitions"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing OpenAPI spec: %w", err)
+	}
+	if len(doc.Definitions) == 0 {
+		return nil, fmt.Errorf("parsing OpenAPI spec: no definitions found")
+	}
+
+	spec := &OpenAPISpec{definitions: doc.Definitions, kinds: make(map[string]string)}
+	for name, def := range doc.Definitions {
+		for _, gvk := range def.GVK {
+			apiVersion := gvk.Version
+			if gvk.Group != "" {
+				apiVersion = gvk.Group + "/" + gvk.Version
+			}
+			spec.kinds[apiVersion+"/"+gvk.Kind] = name
+		}
+	}
+	return spec, nil
+}
+
+// HasKind reports whether the release serves apiVersion/kind
+func (s *OpenAPISpec) HasKind(apiVersion, kind string) bool {
+	_, ok := s.kinds[apiVersion+"/"+kind]
+	return ok
+}
+
+// HasField reports whether the dot-separated yamlPath exists in the schema of
+// apiVersion/kind. known is false when the spec doesn't describe the kind, or
+// the path passes through a field with no schema to follow (e.g., a map).
+func (s *OpenAPISpec) HasField(apiVersion, kind, yamlPath string) (exists, known bool) {
+	name, ok := s.kinds[apiVersion+"/"+kind]
+	if !ok {
+		return false, false
+	}
+	schema := s.definitions[name]
+	for _, part := range strings.Split(yamlPath, ".") {
+		schema = s.resolve(schema)
+		if schema.Properties == nil {
+			// Maps and free-form objects can't be checked further
+			return false, false
+		}
+		field, ok := schema.Properties[part]
+		if !ok {
+			return false, true
+		}
+		schema = field
+	}
+	return true, true
+}
+
+// resolve follows references and array items to the schema of an object
+func (s *OpenAPISpec) resolve(schema openAPISchema) openAPISchema {
+	for i := 0; i < 32; i++ { // Bound self-referencing definitions
+		switch {
+		case schema.Ref != "":
+			schema = s.definitions[strings.TrimPrefix(schema.Ref, "#/definitions/")]
+		case schema.Items != nil:
+			schema = *schema.Items
+		default:
+			return schema
+		}
+	}
+	return schema
+}
+
+// openAPISpec is the schema of the target Kubernetes release, if loaded
+var openAPISpec *OpenAPISpec
+
+// SetOpenAPISpec sets the schema detection checks fields against (nil for
+// none), returning the previous one
+func SetOpenAPISpec(spec *OpenAPISpec) *OpenAPISpec {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	prev := openAPISpec
+	openAPISpec = spec
+	return prev
+}
+
+// fieldMissingInRelease reports whether the loaded schema of the target
+// release is known to lack yamlPath in apiVersion/kind
+func fieldMissingInRelease(apiVersion, kind, yamlPath string) bool {
+	settingsMu.RLock()
+	spec := openAPISpec
+	settingsMu.RUnlock()
+	if spec == nil {
+		return false
+	}
+	exists, known := spec.HasField(apiVersion, kind, yamlPath)
+	return known && !exists
+}
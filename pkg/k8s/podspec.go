@@ -0,0 +1,33 @@
+package k8s
+
+import "strings"
+
+// podSpecFallbackFields are the pod spec lists keyed by something other than
+// the usual name (hostAliases by ip, topologySpreadConstraints by topologyKey)
+// or often rendered alone (imagePullSecrets), that charts render into pod
+// templates of resources detection can't resolve: Custom Resources without a
+// loaded CRD, CRDs whose schema lacks list-map keys, and unknown kinds.
+var podSpecFallbackFields = map[string]bool{
+	"hostAliases":               true,
+	"topologySpreadConstraints": true,
+	"imagePullSecrets":          true,
+}
+
+// podSpecFallback resolves a field rendered at yamlPath through the Pod type,
+// when yamlPath is one of the pod spec lists above in a pod template
+// (spec.<field> or ...template.spec.<field>). It returns nil for other paths.
+// Keys come from the PodSpec's patch merge keys, as for built-in kinds.
+func podSpecFallback(yamlPath string) *FieldInfo {
+	parts := strings.Split(yamlPath, ".")
+	if len(parts) < 2 || parts[len(parts)-2] != "spec" || !podSpecFallbackFields[parts[len(parts)-1]] {
+		return nil
+	}
+	if len(parts) > 2 && parts[len(parts)-3] != "template" {
+		return nil
+	}
+	pod := ResolveKubeAPIType("v1", "Pod")
+	if pod == nil {
+		return nil
+	}
+	return IsConvertibleField(pod, "spec."+parts[len(parts)-1])
+}
@@ -0,0 +1,121 @@
+package k8s
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// mergeKeySummaries explains what the merge key of common list element types
+// identifies, keyed by element type name and then merge key. Types missing
+// here fall back to the key field's own documentation.
+var mergeKeySummaries = map[string]map[string]string{
+	"corev1.Container": {
+		"name": "each container has a unique name within the pod; entries are matched by name",
+	},
+	"corev1.EphemeralContainer": {
+		"name": "each ephemeral container has a unique name within the pod; entries are matched by name",
+	},
+	"corev1.Volume": {
+		"name": "each volume has a unique name within the pod, which volumeMounts refer to",
+	},
+	"corev1.VolumeMount": {
+		"mountPath": "the path inside the container, not the volume name: one volume mounted at two paths is two entries",
+	},
+	"corev1.VolumeDevice": {
+		"devicePath": "the device path inside the container, not the volume name",
+	},
+	"corev1.EnvVar": {
+		"name": "the environment variable name; each variable appears once per container",
+	},
+	"corev1.ContainerPort": {
+		"containerPort": "the port number, not the port name: the same number on two protocols can't be two entries",
+	},
+	"corev1.ServicePort": {
+		"port": "the port number the service exposes, not the port name or targetPort",
+	},
+	"corev1.HostAlias": {
+		"ip": "the IP address; list every hostname for an IP in the same entry",
+	},
+	"corev1.TopologySpreadConstraint": {
+		"topologyKey": "the node label spread over (e.g., topology.kubernetes.io/zone); one constraint per label",
+	},
+	"corev1.LocalObjectReference": {
+		"name": "the name of the referenced object (e.g., an image pull Secret)",
+	},
+}
+
+// elementTypes maps element type names (as FormatTypeName writes them) to the
+// Go types reachable from the built-in kinds, built once on first use
+var (
+	elementTypes     map[string]reflect.Type
+	elementTypesOnce sync.Once
+)
+
+// ElementTypeDoc returns a one-sentence description of a list element type
+// (e.g., "corev1.VolumeMount"), from the type's API documentation. Returns ""
+// for types without documentation, such as Custom Resource types.
+func ElementTypeDoc(elementType string) string {
+	return firstSentence(swaggerDoc(elementType)[""])
+}
+
+// MergeKeyDoc explains what a merge key of a list element type identifies, so
+// users know which field makes an entry unique before converting. Summaries of
+// common types come first, then the key field's API documentation. Returns ""
+// when neither is known.
+func MergeKeyDoc(elementType, mergeKey string) string {
+	if s, ok := mergeKeySummaries[elementType][mergeKey]; ok {
+		return s
+	}
+	return firstSentence(swaggerDoc(elementType)[mergeKey])
+}
+
+// swaggerDoc returns the field documentation of a named element type, with
+// the type's own description under "". Returns nil for unknown types.
+func swaggerDoc(elementType string) map[string]string {
+	elementTypesOnce.Do(func() {
+		elementTypes = make(map[string]reflect.Type)
+		for _, t := range kubeTypeRegistry {
+			indexTypes(t)
+		}
+	})
+	t, ok := elementTypes[elementType]
+	if !ok {
+		return nil
+	}
+	doc, ok := reflect.New(t).Elem().Interface().(interface{ SwaggerDoc() map[string]string })
+	if !ok {
+		return nil
+	}
+	return doc.SwaggerDoc()
+}
+
+// indexTypes adds t and the struct types of its fields to elementTypes
+func indexTypes(t reflect.Type) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t.Name() == "" {
+		return
+	}
+	name := FormatTypeName(t)
+	if _, seen := elementTypes[name]; seen {
+		return
+	}
+	elementTypes[name] = t
+	for i := 0; i < t.NumField(); i++ {
+		indexTypes(t.Field(i).Type)
+	}
+}
+
+// firstSentence returns the first sentence of an API description
+func firstSentence(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, "\n"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, ". "); i >= 0 {
+		s = s[:i+1]
+	}
+	return s
+}
@@ -12,8 +12,12 @@ import (
 // which includes ALL built-in Kubernetes types (core, apps, batch, networking, etc.)
 var kubeTypeRegistry map[string]reflect.Type
 
+// kindAPIVersions maps each built-in kind to the apiVersions that define it
+var kindAPIVersions map[string][]string
+
 func init() {
 	kubeTypeRegistry = make(map[string]reflect.Type)
+	kindAPIVersions = make(map[string][]string)
 
 	// Populate registry from the official Kubernetes scheme
 	// This automatically includes all built-in K8s types across all API versions
@@ -30,6 +34,7 @@ func init() {
 
 		key := apiVersion + "/" + gvk.Kind
 		kubeTypeRegistry[key] = typ
+		kindAPIVersions[gvk.Kind] = append(kindAPIVersions[gvk.Kind], apiVersion)
 	}
 }
 
@@ -0,0 +1,224 @@
+package k8s
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// KubeVersion is a Kubernetes minor release, e.g. 1.27
+type KubeVersion struct {
+	Major int
+	Minor int
+}
+
+// kubeVersionRe matches "1.27", "v1.27.3", and vendor suffixes like "1.27.3-gke.100"
+var kubeVersionRe = regexp.MustCompile(`^v?(\d+)\.(\d+)(?:\.\d+)?(?:[-+].*)?$`)
+
+// ParseKubeVersion parses a Kubernetes version; the patch release is ignored
+func ParseKubeVersion(s string) (KubeVersion, error) {
+	m := kubeVersionRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return KubeVersion{}, fmt.Errorf("invalid Kubernetes version %q: want MAJOR.MINOR (e.g., 1.27)", s)
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return KubeVersion{Major: major, Minor: minor}, nil
+}
+
+// IsZero reports whether no version is set
+func (v KubeVersion) IsZero() bool {
+	return v == KubeVersion{}
+}
+
+// Before reports whether v is an earlier release than o
+func (v KubeVersion) Before(o KubeVersion) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	return v.Minor < o.Minor
+}
+
+func (v KubeVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// APILifecycle is when a built-in API version of a kind was introduced,
+// deprecated, and removed. Zero versions are unknown or not planned.
+type APILifecycle struct {
+	Introduced  KubeVersion
+	Deprecated  KubeVersion
+	Removed     KubeVersion
+	Replacement string // apiVersion and kind to use instead (e.g., "batch/v1 CronJob")
+}
+
+// ServedIn reports whether the API version is served by Kubernetes release v
+func (l APILifecycle) ServedIn(v KubeVersion) bool {
+	if !l.Introduced.IsZero() && v.Before(l.Introduced) {
+		return false
+	}
+	return l.Removed.IsZero() || v.Before(l.Removed)
+}
+
+// The methods k8s.io/api generates from prerelease-lifecycle-gen tags
+type (
+	lifecycleIntroduced interface{ APILifecycleIntroduced() (int, int) }
+	lifecycleDeprecated interface{ APILifecycleDeprecated() (int, int) }
+	lifecycleRemoved    interface{ APILifecycleRemoved() (int, int) }
+	lifecycleReplaced   interface {
+		APILifecycleReplacement() schema.GroupVersionKind
+	}
+)
+
+// ResolveAPILifecycle returns the lifecycle of a built-in apiVersion/kind, as
+// recorded in k8s.io/api, or in removedAPIs for types no longer in it. It
+// returns false for types that aren't built in.
+func ResolveAPILifecycle(apiVersion, kind string) (APILifecycle, bool) {
+	typ := ResolveKubeAPIType(apiVersion, kind)
+	if typ == nil {
+		l, ok := removedAPIs[apiVersion+"/"+kind]
+		return l, ok
+	}
+	obj := reflect.New(typ).Interface()
+
+	var l APILifecycle
+	if i, ok := obj.(lifecycleIntroduced); ok {
+		l.Introduced.Major, l.Introduced.Minor = i.APILifecycleIntroduced()
+	}
+	if d, ok := obj.(lifecycleDeprecated); ok {
+		l.Deprecated.Major, l.Deprecated.Minor = d.APILifecycleDeprecated()
+	}
+	if r, ok := obj.(lifecycleRemoved); ok {
+		l.Removed.Major, l.Removed.Minor = r.APILifecycleRemoved()
+	}
+	if r, ok := obj.(lifecycleReplaced); ok {
+		if gvk := r.APILifecycleReplacement(); gvk.Kind != "" {
+			l.Replacement = gvk.GroupVersion().String() + " " + gvk.Kind
+		}
+	}
+	return l, true
+}
+
+// removedAPIs are the lifecycles of built-in API versions whose types were
+// dropped from k8s.io/api after their removal, so ResolveKubeAPIType can't find
+// them, keyed by apiVersion/kind. Charts still use them, and they are exactly
+// the ones a target release must be warned about.
+var removedAPIs = map[string]APILifecycle{
+	"batch/v2alpha1/CronJob":               {Introduced: KubeVersion{1, 5}, Deprecated: KubeVersion{1, 8}, Removed: KubeVersion{1, 21}, Replacement: "batch/v1 CronJob"},
+	"extensions/v1beta1/PodSecurityPolicy": {Introduced: KubeVersion{1, 2}, Deprecated: KubeVersion{1, 11}, Removed: KubeVersion{1, 16}, Replacement: "policy/v1beta1 PodSecurityPolicy"},
+	"policy/v1beta1/PodSecurityPolicy":     {Introduced: KubeVersion{1, 10}, Deprecated: KubeVersion{1, 21}, Removed: KubeVersion{1, 25}},
+}
+
+// DeprecatedAPI is a resource template using a built-in API version that is
+// deprecated, or removed by the target Kubernetes release
+type DeprecatedAPI struct {
+	TemplateFile string
+	APIVersion   string
+	Kind         string
+	Lifecycle    APILifecycle
+	Removed      bool // not served by the target release
+}
+
+// checkDeprecatedAPI returns the deprecation of apiVersion/kind as of the
+// target Kubernetes release, or as recorded in k8s.io/api if none is set
+func checkDeprecatedAPI(templateFile, apiVersion, kind string) (DeprecatedAPI, bool) {
+	l, ok := ResolveAPILifecycle(apiVersion, kind)
+	if !ok || l.Deprecated.IsZero() {
+		return DeprecatedAPI{}, false
+	}
+	d := DeprecatedAPI{TemplateFile: templateFile, APIVersion: apiVersion, Kind: kind, Lifecycle: l}
+	if target := TargetKubeVersion(); !target.IsZero() {
+		if target.Before(l.Deprecated) {
+			return DeprecatedAPI{}, false
+		}
+		d.Removed = !l.ServedIn(target)
+	}
+	return d, true
+}
+
+// targetKubeVersion is the Kubernetes release detection resolves types for;
+// zero means whatever client-go the plugin was built with provides
+var targetKubeVersion KubeVersion
+
+// SetKubeVersion sets the Kubernetes release detection targets, returning
+// the previous target
+func SetKubeVersion(v KubeVersion) KubeVersion {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	prev := targetKubeVersion
+	targetKubeVersion = v
+	return prev
+}
+
+// TargetKubeVersion returns the Kubernetes release detection targets
+func TargetKubeVersion() KubeVersion {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return targetKubeVersion
+}
+
+// PreferredAPIVersion returns the apiVersion a chart should use for a built-in
+// kind on Kubernetes release v: the most stable version served and not yet
+// deprecated then. It returns "" if the kind isn't built in, or is served by
+// several API groups with no clear choice.
+func PreferredAPIVersion(kind string, v KubeVersion) string {
+	var best string
+	var bestRank [4]int
+	tied := false
+	for _, apiVersion := range kindAPIVersions[kind] {
+		l, _ := ResolveAPILifecycle(apiVersion, kind)
+		if !l.ServedIn(v) {
+			continue
+		}
+		rank := versionRank(apiVersion)
+		if l.Deprecated.IsZero() || v.Before(l.Deprecated) {
+			rank[0] = 1
+		}
+		switch {
+		case best == "" || rankLess(bestRank, rank):
+			best, bestRank, tied = apiVersion, rank, false
+		case rank == bestRank:
+			tied = true
+		}
+	}
+	if tied {
+		return ""
+	}
+	return best
+}
+
+// versionRe splits an API version like v2beta1 into its parts
+var versionRe = regexp.MustCompile(`^v(\d+)(?:(alpha|beta)(\d+))?$`)
+
+// versionRank orders API versions the way Kubernetes prefers them: GA over
+// beta over alpha, then by number. The first element is left for the caller.
+func versionRank(apiVersion string) [4]int {
+	version := apiVersion[strings.LastIndex(apiVersion, "/")+1:]
+	m := versionRe.FindStringSubmatch(version)
+	if m == nil {
+		return [4]int{}
+	}
+	major, _ := strconv.Atoi(m[1])
+	n, _ := strconv.Atoi(m[3])
+	level := 3
+	switch m[2] {
+	case "beta":
+		level = 2
+	case "alpha":
+		level = 1
+	}
+	return [4]int{0, level, major, n}
+}
+
+func rankLess(a, b [4]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package k8s
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPreferredAPIVersion(t *testing.T) {
+	tests := []struct {
+		kind    string
+		version string
+		want    string
+	}{
+		{"Deployment", "1.27", "apps/v1"},
+		{"CronJob", "1.20", "batch/v1beta1"},
+		{"CronJob", "1.21", "batch/v1"},
+		{"Ingress", "1.18", "networking.k8s.io/v1beta1"},
+		{"Ingress", "1.22", "networking.k8s.io/v1"},
+		{"HorizontalPodAutoscaler", "1.27", "autoscaling/v2"},
+		{"Widget", "1.27", ""},
+	}
+	for _, tt := range tests {
+		v, err := ParseKubeVersion(tt.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := PreferredAPIVersion(tt.kind, v); got != tt.want {
+			t.Errorf("PreferredAPIVersion(%s, %s) = %q, want %q", tt.kind, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestParseKubeVersion(t *testing.T) {
+	for _, s := range []string{"1.27", "v1.27", "1.27.3", "v1.27.3-gke.100"} {
+		v, err := ParseKubeVersion(s)
+		if err != nil || v.String() != "1.27" {
+			t.Errorf("ParseKubeVersion(%q) = %v, %v; want 1.27", s, v, err)
+		}
+	}
+	for _, s := range []string{"", "1", "latest", "1.x"} {
+		if _, err := ParseKubeVersion(s); err == nil {
+			t.Errorf("ParseKubeVersion(%q) succeeded, want error", s)
+		}
+	}
+}
+
+func TestCheckDeprecatedAPI(t *testing.T) {
+	tests := []struct {
+		apiVersion  string
+		kind        string
+		target      string
+		wantFlagged bool
+		wantRemoved bool
+		wantRelease string // release that removed it
+	}{
+		{"policy/v1beta1", "PodSecurityPolicy", "", true, false, "1.25"},
+		{"policy/v1beta1", "PodSecurityPolicy", "1.24", true, false, "1.25"},
+		{"policy/v1beta1", "PodSecurityPolicy", "1.25", true, true, "1.25"},
+		{"policy/v1beta1", "PodSecurityPolicy", "1.20", false, false, ""},
+		{"extensions/v1beta1", "PodSecurityPolicy", "1.16", true, true, "1.16"},
+		{"batch/v2alpha1", "CronJob", "1.21", true, true, "1.21"},
+		{"extensions/v1beta1", "Ingress", "", true, false, "1.22"},
+		{"extensions/v1beta1", "Ingress", "1.22", true, true, "1.22"},
+		{"networking.k8s.io/v1", "Ingress", "1.22", false, false, ""},
+		{"example.com/v1", "Widget", "1.22", false, false, ""},
+	}
+	for _, tt := range tests {
+		var target KubeVersion
+		if tt.target != "" {
+			var err error
+			if target, err = ParseKubeVersion(tt.target); err != nil {
+				t.Fatal(err)
+			}
+		}
+		prev := SetKubeVersion(target)
+		d, ok := checkDeprecatedAPI("templates/x.yaml", tt.apiVersion, tt.kind)
+		SetKubeVersion(prev)
+		if ok != tt.wantFlagged {
+			t.Errorf("checkDeprecatedAPI(%s %s) on %q flagged = %v, want %v", tt.apiVersion, tt.kind, tt.target, ok, tt.wantFlagged)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if d.Removed != tt.wantRemoved {
+			t.Errorf("checkDeprecatedAPI(%s %s) on %q Removed = %v, want %v", tt.apiVersion, tt.kind, tt.target, d.Removed, tt.wantRemoved)
+		}
+		if got := d.Lifecycle.Removed.String(); got != tt.wantRelease {
+			t.Errorf("checkDeprecatedAPI(%s %s) removed in %s, want %s", tt.apiVersion, tt.kind, got, tt.wantRelease)
+		}
+	}
+}
+
+// removedAPIs only fills in types k8s.io/api no longer has; an entry it can
+// resolve would be shadowed by the generated lifecycle
+func TestRemovedAPIsNotResolvable(t *testing.T) {
+	for key := range removedAPIs {
+		i := strings.LastIndex(key, "/")
+		if typ := ResolveKubeAPIType(key[:i], key[i+1:]); typ != nil {
+			t.Errorf("removedAPIs[%q] is resolvable through k8s.io/api as %v", key, typ)
+		}
+	}
+}
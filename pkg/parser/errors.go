@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileError is an error reading or parsing a chart file, located in it where
+// known
+type FileError struct {
+	File   string // Path of the file
+	Line   int    // 1-based line, or 0 if unknown
+	Column int    // 1-based column, or 0 if unknown
+	Msg    string // What went wrong
+	Source string // Text of the offending line, if known
+}
+
+func (e *FileError) Error() string {
+	loc := e.File
+	if e.Line > 0 {
+		loc += ":" + strconv.Itoa(e.Line)
+		if e.Column > 0 {
+			loc += ":" + strconv.Itoa(e.Column)
+		}
+	}
+	return loc + ": " + e.Msg
+}
+
+// yamlLineRe matches the line yaml.v3 prefixes its messages with
+var yamlLineRe = regexp.MustCompile(`^line (\d+): `)
+
+// YAMLFileError locates an error yaml.v3 returned for file, whose content is
+// data. yaml.v3 reports lines only, so the column is where the offending line's
+// content starts. Decoding errors (e.g., duplicate keys) are located at the
+// first one, counting the rest.
+func YAMLFileError(file string, data []byte, err error) *FileError {
+	var located *FileError
+	if errors.As(err, &located) {
+		return located
+	}
+
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) && len(typeErr.Errors) > 0 {
+		msg = typeErr.Errors[0]
+		if n := len(typeErr.Errors) - 1; n > 0 {
+			msg += fmt.Sprintf(" (and %d more)", n)
+		}
+	}
+
+	fe := &FileError{File: file, Msg: msg}
+	if m := yamlLineRe.FindStringSubmatch(msg); m != nil {
+		fe.Line, _ = strconv.Atoi(m[1])
+		fe.Msg = msg[len(m[0]):]
+	}
+	lines := strings.Split(string(data), "\n")
+	if fe.Line > 0 && fe.Line <= len(lines) {
+		fe.Source = strings.TrimRight(lines[fe.Line-1], "\r")
+		fe.Column = len(fe.Source) - len(strings.TrimLeft(fe.Source, " \t")) + 1
+	}
+	return fe
+}
+
+// ReadError locates an error reading file
+func ReadError(file string, err error) *FileError {
+	var located *FileError
+	if errors.As(err, &located) {
+		return located
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	return &FileError{File: file, Msg: err.Error()}
+}
@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// IncludeCall is an include of a named template with a dict context, e.g.
+// include "app.env" (dict "env" .Values.extraEnv "ctx" $)
+type IncludeCall struct {
+	Name string            // Define name of the included template
+	Args map[string]string // Dict key -> argument as written (e.g., env -> .Values.extraEnv)
+}
+
+var (
+	// reIncludeDict matches an include whose context is a dict of simple
+	// arguments; a dict with nested calls is not followed
+	reIncludeDict = regexp.MustCompile(`include\s+"([^"]+)"\s+\(\s*dict((?:\s+"[^"]+"\s+[^\s()"]+)+)\s*\)`)
+	reDictPair    = regexp.MustCompile(`"([^"]+)"\s+([^\s()"]+)`)
+	// reNamedCall matches any include or template call of a named template
+	reNamedCall = regexp.MustCompile(`\b(?:include|template)\s+"([^"]+)"`)
+)
+
+// OpaqueCall is an include or template call of a named template whose
+// context IncludeCalls can't follow, e.g. include "app.env" $ctx
+type OpaqueCall struct {
+	Name string // Define name of the included template
+	Call string // Call as written, with its context
+}
+
+// IncludeCalls returns the include calls in content that pass a dict context
+func IncludeCalls(content string) []IncludeCall {
+	var calls []IncludeCall
+	for _, m := range reIncludeDict.FindAllStringSubmatch(stripComments(content), -1) {
+		call := IncludeCall{Name: m[1], Args: make(map[string]string)}
+		for _, pair := range reDictPair.FindAllStringSubmatch(m[2], -1) {
+			call.Args[pair[1]] = pair[2]
+		}
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+// OpaqueCalls returns the include and template calls in content that
+// IncludeCalls doesn't return: those with another context than a dict of
+// simple arguments, such as a variable, a dict with nested calls, or none
+func OpaqueCalls(content string) []OpaqueCall {
+	content = stripComments(content)
+	followed := make(map[int]bool)
+	for _, loc := range reIncludeDict.FindAllStringIndex(content, -1) {
+		followed[loc[0]] = true
+	}
+	var calls []OpaqueCall
+	for _, m := range reNamedCall.FindAllStringSubmatchIndex(content, -1) {
+		if followed[m[0]] {
+			continue
+		}
+		calls = append(calls, OpaqueCall{Name: content[m[2]:m[3]], Call: content[m[0]:callEnd(content, m[1])]})
+	}
+	return calls
+}
+
+// callEnd returns the offset in content where the context of a call whose
+// name ends at start ends: after a parenthesized argument, or a single one
+func callEnd(content string, start int) int {
+	i := start
+	for i < len(content) && (content[i] == ' ' || content[i] == '\t') {
+		i++
+	}
+	if i < len(content) && content[i] == '(' {
+		depth := 0
+		for ; i < len(content); i++ {
+			switch content[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+		}
+		return len(content)
+	}
+	end := i
+	for end < len(content) && !strings.ContainsRune(" \t\n)|}", rune(content[end])) {
+		end++
+	}
+	if end == i {
+		return start
+	}
+	return end
+}
+
+// ValuesPath returns the .Values path passed under a dict key, if the
+// argument is one (.Values.X or $.Values.X)
+func (c IncludeCall) ValuesPath(key string) (string, bool) {
+	arg := strings.TrimPrefix(c.Args[key], "$")
+	path, ok := strings.CutPrefix(arg, ".Values.")
+	return path, ok && path != ""
+}
+
+// RendersDictArg reports whether a named template's body renders the dict
+// argument key as a list with toYaml or toJson (e.g., toYaml .env)
+func RendersDictArg(body, key string) bool {
+	k := regexp.QuoteMeta(key)
+	re := regexp.MustCompile(`(?:toYaml|toJson)\s+\.` + k + `(?:[^a-zA-Z0-9_.]|$)|\.` + k + `\s*\|\s*(?:toYaml|toJson)\b`)
+	return re.MatchString(stripComments(body))
+}
@@ -0,0 +1,28 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// indexArgs matches the quoted keys index is called with after .Values, e.g.
+// ` "weird-key" "env"`
+const indexArgs = `((?:\s+"(?:[^"\\]|\\.)*")+)`
+
+// reIndexArg matches one quoted index key
+var reIndexArg = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+
+// indexPath returns the dotted .Values path of the keys matched by indexArgs.
+// Keys holding a dot can't be written as a dotted path, so they aren't one.
+func indexPath(args string) (string, bool) {
+	var parts []string
+	for _, q := range reIndexArg.FindAllString(args, -1) {
+		key, err := strconv.Unquote(q)
+		if err != nil || key == "" || strings.Contains(key, ".") {
+			return "", false
+		}
+		parts = append(parts, key)
+	}
+	return strings.Join(parts, "."), len(parts) > 0
+}
@@ -0,0 +1,122 @@
+package parser
+
+import "strings"
+
+// logicalLine is one template line with comments removed and any action that
+// spans several lines joined onto the line where it starts
+type logicalLine struct {
+	text string
+	num  int // 1-based line number in the file
+}
+
+// logicalLines removes {{/* ... */}} comments and joins actions that span
+// several lines (e.g., long include calls with dict args), so line-oriented
+// patterns see each directive whole and comments don't add YAML keys
+func logicalLines(content string) []logicalLine {
+	var out []logicalLine
+	var cur strings.Builder
+	start, line := 1, 1
+	inAction := false
+	var quote byte
+
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		if c == '\n' {
+			line++
+		}
+
+		if !inAction {
+			if c == '\n' {
+				out = append(out, logicalLine{text: cur.String(), num: start})
+				cur.Reset()
+				start = line
+				continue
+			}
+			if strings.HasPrefix(content[i:], "{{") {
+				if end := commentEnd(content, i); end > 0 {
+					line += strings.Count(content[i:end], "\n")
+					i = end - 1
+					continue
+				}
+				inAction = true
+				cur.WriteString("{{")
+				i++
+				continue
+			}
+			cur.WriteByte(c)
+			continue
+		}
+
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' && i+1 < len(content) {
+				cur.WriteByte(c)
+				i++
+				c = content[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '`':
+			quote = c
+		case c == '\n':
+			// Join the continuation line with a single space
+			cur.WriteByte(' ')
+			for i+1 < len(content) && (content[i+1] == ' ' || content[i+1] == '\t') {
+				i++
+			}
+			continue
+		case strings.HasPrefix(content[i:], "}}"):
+			inAction = false
+			cur.WriteString("}}")
+			i++
+			continue
+		}
+		cur.WriteByte(c)
+	}
+	return append(out, logicalLine{text: cur.String(), num: start})
+}
+
+// commentEnd returns the offset just past the {{/* ... */}} comment starting
+// at i, or 0 if the action at i is not a comment
+func commentEnd(content string, i int) int {
+	j := i + 2
+	if j < len(content) && content[j] == '-' {
+		j++
+	}
+	for j < len(content) && (content[j] == ' ' || content[j] == '\t' || content[j] == '\n') {
+		j++
+	}
+	if !strings.HasPrefix(content[j:], "/*") {
+		return 0
+	}
+	end := strings.Index(content[j+2:], "*/")
+	if end < 0 {
+		return 0
+	}
+	k := j + 2 + end + 2
+	for k < len(content) && (content[k] == ' ' || content[k] == '\t' || content[k] == '\n' || content[k] == '-') {
+		if strings.HasPrefix(content[k:], "}}") {
+			break
+		}
+		k++
+	}
+	if !strings.HasPrefix(content[k:], "}}") {
+		return 0
+	}
+	return k + 2
+}
+
+// stripComments removes {{/* ... */}} comments from template content
+func stripComments(content string) string {
+	var b strings.Builder
+	for i := 0; i < len(content); i++ {
+		if strings.HasPrefix(content[i:], "{{") {
+			if end := commentEnd(content, i); end > 0 {
+				i = end - 1
+				continue
+			}
+		}
+		b.WriteByte(content[i])
+	}
+	return b.String()
+}
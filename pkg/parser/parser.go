@@ -3,11 +3,15 @@ package parser
 import (
 	"bufio"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"slices"
 	"strings"
+
+	filesystem "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
 )
 
 // TemplateDirective represents a Go template directive found in a K8s manifest
@@ -16,7 +20,11 @@ type TemplateDirective struct {
 	Content     string // The template content (e.g., "{{- toYaml .Values.volumes | nindent 8 }}")
 	LineNumber  int
 	FilePath    string
-	WithContext string // If inside a "with .Values.X" block, the Values path
+	WithContext string // The .Values path dot refers to, if inside with blocks that resolve to one
+	// ListIndexes is the item of each list on YAMLPath the directive is in,
+	// keyed by the list's path (e.g., spec.template.spec.containers: 1), as
+	// written in the template
+	ListIndexes map[string]int
 }
 
 // ParsedTemplate represents a parsed Helm template file
@@ -24,8 +32,14 @@ type ParsedTemplate struct {
 	FilePath   string
 	APIVersion string
 	Kind       string
-	GoType     reflect.Type
-	Directives []TemplateDirective
+	// APIVersionTemplated is set when apiVersion is rendered by the template
+	// (e.g., chosen from .Capabilities), leaving APIVersion empty
+	APIVersionTemplated bool
+	// KindTemplated is set when kind is rendered by the template (e.g., from
+	// .Values), leaving Kind empty unless the chart config declares it
+	KindTemplated bool
+	GoType        reflect.Type
+	Directives    []TemplateDirective
 }
 
 // ConversionCandidate represents a field that can be converted to map format
@@ -43,18 +57,19 @@ type ConversionCandidate struct {
 func ParseTemplateFile(templatePath string) (*ParsedTemplate, error) {
 	content, err := os.ReadFile(templatePath)
 	if err != nil {
-		return nil, err
+		return nil, ReadError(templatePath, err)
 	}
 
 	result := &ParsedTemplate{
 		FilePath: templatePath,
 	}
 
-	lines := strings.Split(string(content), "\n")
+	// Comments and multi-line actions are resolved before the line-oriented parsing
+	lines := logicalLines(string(content))
 
 	// Extract apiVersion and kind
-	result.APIVersion, result.Kind = extractAPIVersionAndKind(lines)
-	if result.APIVersion == "" || result.Kind == "" {
+	result.APIVersion, result.Kind, result.APIVersionTemplated, result.KindTemplated = extractAPIVersionAndKind(lines)
+	if (result.Kind == "" && !result.KindTemplated) || (result.APIVersion == "" && !result.APIVersionTemplated) {
 		// Skip templates without explicit apiVersion/kind
 		return result, nil
 	}
@@ -71,13 +86,13 @@ func ParseTemplateFile(templatePath string) (*ParsedTemplate, error) {
 }
 
 // extractAPIVersionAndKind extracts apiVersion and kind from template lines
-// Only handles explicit values (not templated)
-func extractAPIVersionAndKind(lines []string) (apiVersion, kind string) {
+// Only handles explicit values; a templated apiVersion or kind is reported as such
+func extractAPIVersionAndKind(lines []logicalLine) (apiVersion, kind string, apiVersionTemplated, kindTemplated bool) {
 	reAPIVersion := regexp.MustCompile(`^apiVersion:\s*(.+)`)
 	reKind := regexp.MustCompile(`^kind:\s*(.+)`)
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
+	for _, l := range lines {
+		line := strings.TrimSpace(l.text)
 
 		if m := reAPIVersion.FindStringSubmatch(line); m != nil {
 			val := strings.TrimSpace(m[1])
@@ -86,6 +101,8 @@ func extractAPIVersionAndKind(lines []string) (apiVersion, kind string) {
 			// Skip if templated
 			if !strings.Contains(val, "{{") {
 				apiVersion = val
+			} else if apiVersion == "" {
+				apiVersionTemplated = true
 			}
 		}
 
@@ -93,9 +110,14 @@ func extractAPIVersionAndKind(lines []string) (apiVersion, kind string) {
 			val := strings.TrimSpace(m[1])
 			// Strip quotes if present
 			val = strings.Trim(val, `"'`)
-			// Skip if templated
+			// Skip if templated. Once the resource's kind is found templated,
+			// later kind: lines belong to nested objects (e.g., subjects).
 			if !strings.Contains(val, "{{") {
-				kind = val
+				if !kindTemplated {
+					kind = val
+				}
+			} else if kind == "" {
+				kindTemplated = true
 			}
 		}
 
@@ -107,33 +129,24 @@ func extractAPIVersionAndKind(lines []string) (apiVersion, kind string) {
 	return
 }
 
-// withBlockContext tracks a "with .Values.X" block
-type withBlockContext struct {
-	valuesPath string // The .Values path (e.g., "prometheusOperator.extraVolumeMounts")
-	indent     int    // Indentation level where the with started
-}
-
 // extractDirectives finds template directives and their YAML path context
-func extractDirectives(lines []string, filePath string) []TemplateDirective {
+func extractDirectives(lines []logicalLine, filePath string) []TemplateDirective {
 	var directives []TemplateDirective
 
 	// Track YAML path via indentation
 	var pathStack []pathLevel
 
-	// Track with block contexts for resolving "toYaml ." patterns
-	var withStack []withBlockContext
+	// Track the blocks open at each line and what dot refers to in them, for
+	// resolving "toYaml ." patterns
+	var scopes scopeStack
 
 	// Regex patterns
 	reYAMLKey := regexp.MustCompile(`^(\s*)([a-zA-Z_][a-zA-Z0-9_-]*):\s*(.*)`)
 	reTemplateDirective := regexp.MustCompile(`\{\{.*\}\}`)
 	reListItem := regexp.MustCompile(`^(\s*)-\s*`)
 
-	// Pattern to detect "with .Values.X"
-	reWithValues := regexp.MustCompile(`\{\{-?\s*with\s+\.Values\.([a-zA-Z0-9_.]+)\s*-?\}\}`)
-	// Pattern to detect "end" closing a block
-	reEnd := regexp.MustCompile(`\{\{-?\s*end\s*-?\}\}`)
-
-	for lineNum, line := range lines {
+	for _, l := range lines {
+		line := l.text
 		// Skip empty lines and comments
 		trimmed := strings.TrimSpace(line)
 		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
@@ -142,20 +155,9 @@ func extractDirectives(lines []string, filePath string) []TemplateDirective {
 
 		indent := len(line) - len(strings.TrimLeft(line, " \t"))
 
-		// Check for "with .Values.X" opening a new context
-		if m := reWithValues.FindStringSubmatch(line); m != nil {
-			withStack = append(withStack, withBlockContext{
-				valuesPath: m[1],
-				indent:     indent,
-			})
-		}
-
-		// Check for "end" that might close a with block
-		if reEnd.MatchString(line) && len(withStack) > 0 {
-			// Pop the most recent with block at or after this indent level
-			// Note: This is a simplification - real Go template parsing would need proper nesting
-			withStack = withStack[:len(withStack)-1]
-		}
+		// Open and close the line's blocks, noting the .Values path dot
+		// refers to where the line renders
+		withContext := scopes.scan(line).valuesPath()
 
 		// Check for YAML key
 		if m := reYAMLKey.FindStringSubmatch(line); m != nil {
@@ -174,17 +176,13 @@ func extractDirectives(lines []string, filePath string) []TemplateDirective {
 			// Check if value contains a template directive
 			if reTemplateDirective.MatchString(value) {
 				yamlPath := buildYAMLPath(pathStack)
-				// Capture current with context
-				var withContext string
-				if len(withStack) > 0 {
-					withContext = withStack[len(withStack)-1].valuesPath
-				}
 				directives = append(directives, TemplateDirective{
 					YAMLPath:    yamlPath,
 					Content:     strings.TrimSpace(value),
-					LineNumber:  lineNum + 1,
+					LineNumber:  l.num,
 					FilePath:    filePath,
 					WithContext: withContext,
+					ListIndexes: listIndexes(pathStack),
 				})
 			}
 			continue
@@ -197,6 +195,27 @@ func extractDirectives(lines []string, filePath string) []TemplateDirective {
 			for len(pathStack) > 0 && pathStack[len(pathStack)-1].indent >= listIndent {
 				pathStack = pathStack[:len(pathStack)-1]
 			}
+			if len(pathStack) > 0 {
+				pathStack[len(pathStack)-1].items++
+			}
+
+			// A key on the item's dash line (e.g., "- metadata:" in
+			// volumeClaimTemplates) opens the item's mapping at the key's
+			// column, so keys nested under it keep it in their path
+			if km := reYAMLKey.FindStringSubmatch(strings.Repeat(" ", len(m[0])) + line[len(m[0]):]); km != nil {
+				pathStack = append(pathStack, pathLevel{indent: len(m[0]), key: km[2]})
+				if reTemplateDirective.MatchString(km[3]) {
+					directives = append(directives, TemplateDirective{
+						YAMLPath:    buildYAMLPath(pathStack),
+						Content:     strings.TrimSpace(km[3]),
+						LineNumber:  l.num,
+						FilePath:    filePath,
+						WithContext: withContext,
+						ListIndexes: listIndexes(pathStack),
+					})
+				}
+				continue
+			}
 		}
 
 		// Check for standalone template directive line
@@ -212,17 +231,13 @@ func extractDirectives(lines []string, filePath string) []TemplateDirective {
 				}
 			}
 			yamlPath := buildYAMLPath(contextStack)
-			// Capture current with context
-			var withContext string
-			if len(withStack) > 0 {
-				withContext = withStack[len(withStack)-1].valuesPath
-			}
 			directives = append(directives, TemplateDirective{
 				YAMLPath:    yamlPath,
 				Content:     trimmed,
-				LineNumber:  lineNum + 1,
+				LineNumber:  l.num,
 				FilePath:    filePath,
 				WithContext: withContext,
+				ListIndexes: listIndexes(contextStack),
 			})
 		}
 	}
@@ -234,6 +249,7 @@ func extractDirectives(lines []string, filePath string) []TemplateDirective {
 type pathLevel struct {
 	indent int
 	key    string
+	items  int // list items seen under the key so far
 }
 
 // buildYAMLPath constructs a dot-separated path from the stack
@@ -245,17 +261,61 @@ func buildYAMLPath(stack []pathLevel) string {
 	return strings.Join(parts, ".")
 }
 
+// listIndexes returns the item the stack is in of each list on it, keyed by
+// the list's path, or nil if it passes through no list items
+func listIndexes(stack []pathLevel) map[string]int {
+	var indexes map[string]int
+	for i, level := range stack {
+		if level.items == 0 {
+			continue
+		}
+		if indexes == nil {
+			indexes = make(map[string]int)
+		}
+		indexes[buildYAMLPath(stack[:i+1])] = level.items - 1
+	}
+	return indexes
+}
+
 // ValuesUsage represents how .Values is used in a template
 type ValuesUsage struct {
 	ValuesPath string // e.g., "volumes" or "image.tag"
-	Pattern    string // "toYaml", "range", "range_kv", "with", "direct"
+	Pattern    string // "toYaml", "toJson", "concat", "merge", "required", "coalesce", "range", "range_kv", "with", "include_dict", "direct"
 	IsListUse  bool   // true if used as a list (toYaml, range without k/v)
 }
 
+var (
+	// reConcat matches a toYaml call on .Values lists joined with concat, in
+	// either toYaml (concat ...) or concat ... | toYaml form
+	reConcat    = regexp.MustCompile(`toYaml\s+\(\s*concat((?:\s+\$?\.Values\.[a-zA-Z0-9_.]+)+)\s*\)|concat((?:\s+\$?\.Values\.[a-zA-Z0-9_.]+)+)\s*\)?\s*\|\s*toYaml\b`)
+	reConcatArg = regexp.MustCompile(`\.Values\.([a-zA-Z0-9_.]+)`)
+	// reMergeField matches a toYaml call on a field of .Values dicts merged
+	// with merge or mergeOverwrite, in either toYaml (merge ...).env or
+	// (merge ...).env | toYaml form
+	reMergeField = regexp.MustCompile(`toYaml\s+\(\s*(?:merge|mergeOverwrite)((?:\s+\$?\.Values\.[a-zA-Z0-9_.]+)+)\s*\)\.([a-zA-Z0-9_.]+)|\(\s*(?:merge|mergeOverwrite)((?:\s+\$?\.Values\.[a-zA-Z0-9_.]+)+)\s*\)\.([a-zA-Z0-9_.]+)\s*\|\s*toYaml\b`)
+
+	// reIndexToYaml matches a toYaml call on a .Values path accessed with
+	// index, for keys that aren't identifiers: toYaml (index .Values "a-b" "env")
+	// or index .Values "a-b" "env" | toYaml
+	reIndexToYaml = regexp.MustCompile(`toYaml\s+\(\s*index\s+\$?\.Values` + indexArgs + `\s*\)|index\s+\$?\.Values` + indexArgs + `\s*\)?\s*\|\s*toYaml\b`)
+	// reIndexToJSON is reIndexToYaml for toJson
+	reIndexToJSON = regexp.MustCompile(`toJson\s+\(\s*index\s+\$?\.Values` + indexArgs + `\s*\)|index\s+\$?\.Values` + indexArgs + `\s*\)?\s*\|\s*toJson\b`)
+	// reIndexWith matches a with block on a .Values path accessed with index
+	reIndexWith = regexp.MustCompile(`with\s+\(?\s*index\s+\$?\.Values` + indexArgs)
+
+	// reRequired matches a toYaml call on a .Values list wrapped by required,
+	// in either toYaml (required "msg" ...) or required "msg" ... | toYaml form
+	reRequired = regexp.MustCompile(`toYaml\s+\(\s*required\s+"(?:[^"\\]|\\.)*"\s+\$?\.Values\.([a-zA-Z0-9_.]+)\s*\)|required\s+"(?:[^"\\]|\\.)*"\s+\$?\.Values\.([a-zA-Z0-9_.]+)\s*\)?\s*\|\s*toYaml\b`)
+	// reCoalesce matches a toYaml call on the first non-empty of .Values lists
+	// picked with coalesce, in either form
+	reCoalesce = regexp.MustCompile(`toYaml\s+\(\s*coalesce((?:\s+\$?\.Values\.[a-zA-Z0-9_.]+)+)\s*\)|coalesce((?:\s+\$?\.Values\.[a-zA-Z0-9_.]+)+)\s*\)?\s*\|\s*toYaml\b`)
+)
+
 // analyzeDirectiveContent extracts .Values usage from a template directive
 // withContext is provided when the directive is inside a "with .Values.X" block
 func AnalyzeDirectiveContent(content string, withContext string) []ValuesUsage {
 	var usages []ValuesUsage
+	content = stripComments(content)
 
 	// Pattern: toYaml .Values.X
 	reToYaml := regexp.MustCompile(`toYaml\s+\.Values\.([a-zA-Z0-9_.]+)`)
@@ -267,6 +327,82 @@ func AnalyzeDirectiveContent(content string, withContext string) []ValuesUsage {
 		})
 	}
 
+	// Pattern: toJson .Values.X or .Values.X | toJson (list rendered as JSON)
+	reToJSON := regexp.MustCompile(`toJson\s+\.Values\.([a-zA-Z0-9_.]+)|\.Values\.([a-zA-Z0-9_.]+)\s*\|\s*toJson\b`)
+	for _, m := range reToJSON.FindAllStringSubmatch(content, -1) {
+		usages = append(usages, ValuesUsage{
+			ValuesPath: m[1] + m[2],
+			Pattern:    "toJson",
+			IsListUse:  true,
+		})
+	}
+
+	// Pattern: toYaml (concat .Values.X .Values.Y) (lists composed with Sprig's
+	// concat; each path is a list rendered at the same place)
+	for _, m := range reConcat.FindAllStringSubmatch(content, -1) {
+		for _, arg := range reConcatArg.FindAllStringSubmatch(m[1]+m[2], -1) {
+			usages = append(usages, ValuesUsage{
+				ValuesPath: arg[1],
+				Pattern:    "concat",
+				IsListUse:  true,
+			})
+		}
+	}
+
+	// Pattern: toYaml (merge .Values.X .Values.Y).env (the field of dicts
+	// merged with Sprig's merge; each dict's field is a list rendered there)
+	for _, m := range reMergeField.FindAllStringSubmatch(content, -1) {
+		field := m[2] + m[4]
+		for _, arg := range reConcatArg.FindAllStringSubmatch(m[1]+m[3], -1) {
+			usages = append(usages, ValuesUsage{
+				ValuesPath: arg[1] + "." + field,
+				Pattern:    "merge",
+				IsListUse:  true,
+			})
+		}
+	}
+
+	// Pattern: toYaml (index .Values "a-b" "env") (keys that aren't identifiers)
+	for _, m := range reIndexToYaml.FindAllStringSubmatch(content, -1) {
+		if path, ok := indexPath(m[1] + m[2]); ok {
+			usages = append(usages, ValuesUsage{
+				ValuesPath: path,
+				Pattern:    "toYaml",
+				IsListUse:  true,
+			})
+		}
+	}
+	for _, m := range reIndexToJSON.FindAllStringSubmatch(content, -1) {
+		if path, ok := indexPath(m[1] + m[2]); ok {
+			usages = append(usages, ValuesUsage{
+				ValuesPath: path,
+				Pattern:    "toJson",
+				IsListUse:  true,
+			})
+		}
+	}
+
+	// Pattern: toYaml (required "msg" .Values.X) (the list must be set)
+	for _, m := range reRequired.FindAllStringSubmatch(content, -1) {
+		usages = append(usages, ValuesUsage{
+			ValuesPath: m[1] + m[2],
+			Pattern:    "required",
+			IsListUse:  true,
+		})
+	}
+
+	// Pattern: toYaml (coalesce .Values.X .Values.Y) (the first non-empty
+	// list is rendered, so each path is a list rendered at the same place)
+	for _, m := range reCoalesce.FindAllStringSubmatch(content, -1) {
+		for _, arg := range reConcatArg.FindAllStringSubmatch(m[1]+m[2], -1) {
+			usages = append(usages, ValuesUsage{
+				ValuesPath: arg[1],
+				Pattern:    "coalesce",
+				IsListUse:  true,
+			})
+		}
+	}
+
 	// Pattern: toYaml . (dot context - uses the enclosing "with" block's path)
 	// Only match if there's a withContext and the content uses just "."
 	if withContext != "" {
@@ -280,6 +416,23 @@ func AnalyzeDirectiveContent(content string, withContext string) []ValuesUsage {
 		}
 	}
 
+	// Pattern: toYaml .b (a field of the enclosing "with" block's path).
+	// .Values.X is absolute, as matched above.
+	if withContext != "" {
+		reToYamlField := regexp.MustCompile(`toYaml\s+\.([a-zA-Z_][a-zA-Z0-9_.]*)`)
+		for _, m := range reToYamlField.FindAllStringSubmatch(content, -1) {
+			field := strings.TrimRight(m[1], ".")
+			if field == "Values" || strings.HasPrefix(field, "Values.") {
+				continue
+			}
+			usages = append(usages, ValuesUsage{
+				ValuesPath: withContext + "." + field,
+				Pattern:    "toYaml_dot",
+				IsListUse:  true,
+			})
+		}
+	}
+
 	// Pattern: with .Values.X
 	reWith := regexp.MustCompile(`with\s+\.Values\.([a-zA-Z0-9_.]+)`)
 	for _, m := range reWith.FindAllStringSubmatch(content, -1) {
@@ -290,6 +443,17 @@ func AnalyzeDirectiveContent(content string, withContext string) []ValuesUsage {
 		})
 	}
 
+	// Pattern: with (index .Values "a-b" "env")
+	for _, m := range reIndexWith.FindAllStringSubmatch(content, -1) {
+		if path, ok := indexPath(m[1]); ok {
+			usages = append(usages, ValuesUsage{
+				ValuesPath: path,
+				Pattern:    "with",
+				IsListUse:  true,
+			})
+		}
+	}
+
 	// Pattern: range $k, $v := .Values.X (map pattern - already converted)
 	reRangeKV := regexp.MustCompile(`range\s+\$\w+\s*,\s*\$\w+\s*:=\s*\.Values\.([a-zA-Z0-9_.]+)`)
 	for _, m := range reRangeKV.FindAllStringSubmatch(content, -1) {
@@ -328,16 +492,17 @@ func HasIncludeDirective(content string) bool {
 	return strings.Contains(content, "include ")
 }
 
-// loadTemplateContent loads the content of a named template from _helpers.tpl or similar
-func loadTemplateContent(templatesDir, templateName string) (string, error) {
+// loadTemplateContent loads the content of a named template from _helpers.tpl
+// or similar, in the template directories of the chart at chartRoot
+func loadTemplateContent(chartRoot, templateName string) (string, error) {
 	// Search in all .tpl files
 	var content string
 
-	err := filepath.WalkDir(templatesDir, func(path string, d os.DirEntry, err error) error {
+	err := filesystem.WalkTemplates(filesystem.OSFileSystem{}, chartRoot, func(path string, d os.DirEntry, err error) error {
 		if err != nil || d.IsDir() {
 			return err
 		}
-		if !strings.HasSuffix(path, ".tpl") {
+		if !filesystem.IsPartial(path) {
 			return nil
 		}
 
@@ -403,13 +568,32 @@ func extractDefinedTemplate(fileContent, templateName string) string {
 
 // followIncludeChain recursively follows include directives to find .Values usage
 // withContext is passed through when the include is inside a "with .Values.X" block
-func FollowIncludeChain(templatesDir, content, withContext string, visited map[string]bool) []ValuesUsage {
+func FollowIncludeChain(chartRoot, content, withContext string, visited map[string]bool) []ValuesUsage {
 	var allUsages []ValuesUsage
+	content = stripComments(content)
 
 	// First check for direct .Values usage
 	usages := AnalyzeDirectiveContent(content, withContext)
 	allUsages = append(allUsages, usages...)
 
+	// Lists passed into a named template under a dict key (e.g., the partial
+	// renders toYaml .env for (dict "env" .Values.extraEnv))
+	for _, call := range IncludeCalls(content) {
+		includedContent, err := loadTemplateContent(chartRoot, call.Name)
+		if err != nil {
+			continue
+		}
+		for _, key := range slices.Sorted(maps.Keys(call.Args)) {
+			if path, ok := call.ValuesPath(key); ok && RendersDictArg(includedContent, key) {
+				allUsages = append(allUsages, ValuesUsage{
+					ValuesPath: path,
+					Pattern:    "include_dict",
+					IsListUse:  true,
+				})
+			}
+		}
+	}
+
 	// Check for includes and follow them
 	re := regexp.MustCompile(`include\s+"([^"]+)"`)
 	for _, m := range re.FindAllStringSubmatch(content, -1) {
@@ -422,13 +606,13 @@ func FollowIncludeChain(templatesDir, content, withContext string, visited map[s
 		visited[templateName] = true
 
 		// Load and analyze the included template
-		includedContent, err := loadTemplateContent(templatesDir, templateName)
+		includedContent, err := loadTemplateContent(chartRoot, templateName)
 		if err != nil {
 			continue
 		}
 
 		// Recursively follow (pass through withContext)
-		nestedUsages := FollowIncludeChain(templatesDir, includedContent, withContext, visited)
+		nestedUsages := FollowIncludeChain(chartRoot, includedContent, withContext, visited)
 		allUsages = append(allUsages, nestedUsages...)
 	}
 
@@ -0,0 +1,457 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseTemplateFileCommentsAndMultilineActions(t *testing.T) {
+	t.Parallel()
+
+	tpl := `{{/*
+kind: NotTheKind
+Example:
+  volumes:
+    {{- toYaml .Values.commentedOut | nindent 4 }}
+*/}}
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      {{- /* env comes from the shared helper */ -}}
+      containers:
+        - name: app
+          env:
+            {{- include "app.env" (dict
+                "items" .Values.env
+                "context" $) | nindent 12 }}
+      volumes:
+        {{- toYaml .Values.volumes | nindent 8 }}
+`
+	path := filepath.Join(t.TempDir(), "deployment.yaml")
+	if err := os.WriteFile(path, []byte(tpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseTemplateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Kind != "Deployment" {
+		t.Errorf("Kind = %q, want Deployment", parsed.Kind)
+	}
+
+	type found struct {
+		YAMLPath string
+		Content  string
+		Line     int
+	}
+	var got []found
+	for _, d := range parsed.Directives {
+		got = append(got, found{d.YAMLPath, d.Content, d.LineNumber})
+	}
+	want := []found{
+		{"spec.template.spec.containers.env", `{{- include "app.env" (dict "items" .Values.env "context" $) | nindent 12 }}`, 16},
+		{"spec.template.spec.volumes", `{{- toYaml .Values.volumes | nindent 8 }}`, 20},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("directives =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestParseTemplateFileListItemKeys(t *testing.T) {
+	t.Parallel()
+
+	tpl := `apiVersion: apps/v1
+kind: StatefulSet
+spec:
+  template:
+    spec:
+      containers:
+        - name: {{ .Values.name }}
+          env:
+            {{- toYaml .Values.env | nindent 12 }}
+  volumeClaimTemplates:
+    - metadata:
+        labels:
+          {{- toYaml .Values.labels | nindent 10 }}
+      spec:
+        accessModes:
+          {{- toYaml .Values.accessModes | nindent 10 }}
+`
+	path := filepath.Join(t.TempDir(), "statefulset.yaml")
+	if err := os.WriteFile(path, []byte(tpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseTemplateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range parsed.Directives {
+		got = append(got, d.YAMLPath+" "+d.Content)
+	}
+	want := []string{
+		"spec.template.spec.containers.name {{ .Values.name }}",
+		"spec.template.spec.containers.env {{- toYaml .Values.env | nindent 12 }}",
+		"spec.volumeClaimTemplates.metadata.labels {{- toYaml .Values.labels | nindent 10 }}",
+		"spec.volumeClaimTemplates.spec.accessModes {{- toYaml .Values.accessModes | nindent 10 }}",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("directives =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestParseTemplateFileListIndexes(t *testing.T) {
+	t.Parallel()
+
+	tpl := `apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      initContainers:
+        - name: init
+      containers:
+        - name: app
+          env:
+            {{- toYaml .Values.env | nindent 12 }}
+        - name: sidecar
+          env:
+            {{- toYaml .Values.sidecarEnv | nindent 12 }}
+      volumes:
+        {{- toYaml .Values.volumes | nindent 8 }}
+`
+	path := filepath.Join(t.TempDir(), "deployment.yaml")
+	if err := os.WriteFile(path, []byte(tpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseTemplateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]map[string]int)
+	for _, d := range parsed.Directives {
+		got[d.Content] = d.ListIndexes
+	}
+	want := map[string]map[string]int{
+		"{{- toYaml .Values.env | nindent 12 }}":        {"spec.template.spec.containers": 0},
+		"{{- toYaml .Values.sidecarEnv | nindent 12 }}": {"spec.template.spec.containers": 1},
+		"{{- toYaml .Values.volumes | nindent 8 }}":     nil,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("list indexes =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestParseTemplateFileWithContext(t *testing.T) {
+	t.Parallel()
+
+	tpl := `apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      {{- with .Values.pod }}
+      {{- if .enabled }}
+      securityContext:
+        {{- toYaml .securityContext | nindent 8 }}
+      {{- end }}
+      {{- with .spec }}
+      volumes:
+        {{- toYaml .volumes | nindent 8 }}
+      {{- with .extra }}
+      initContainers:
+        {{- toYaml . | nindent 8 }}
+      {{- end }}
+      {{- end }}
+      containers:
+        {{- range .containers }}
+        - name: {{ .name }}
+          env:
+            {{- toYaml .env | nindent 12 }}
+        {{- end }}
+      {{- else }}
+      tolerations:
+        {{- toYaml .Values.tolerations | nindent 8 }}
+      {{- end }}
+      {{- with $.Values.app }}{{ toYaml .affinity | nindent 6 }}{{ end }}
+      {{- with .Chart }}
+      nodeSelector:
+        {{- toYaml . | nindent 8 }}
+      {{- end }}
+      hostAliases:
+        {{- toYaml . | nindent 8 }}
+`
+	path := filepath.Join(t.TempDir(), "deployment.yaml")
+	if err := os.WriteFile(path, []byte(tpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseTemplateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[int]string)
+	for _, d := range parsed.Directives {
+		got[d.LineNumber] = d.WithContext
+	}
+	for line, want := range map[int]string{
+		6:  "",               // the with itself opens the block
+		9:  "pod",            // an if keeps dot
+		13: "pod.spec",       // nested with resolves relative to the outer one
+		16: "pod.spec.extra", // and again
+		20: "pod",            // each end closes only its own block
+		21: "",               // a range item isn't a values path
+		23: "",               // nor inside the range
+		27: "",               // else of a with restores the outer dot
+		29: "app",            // single-line with, and $.Values
+		32: "",               // dot is .Chart, not .Values
+		35: "",               // every block is closed
+	} {
+		if got[line] != want {
+			t.Errorf("line %d: WithContext = %q, want %q", line, got[line], want)
+		}
+	}
+}
+
+func TestAnalyzeDirectiveContentWithField(t *testing.T) {
+	t.Parallel()
+
+	usages := AnalyzeDirectiveContent(`{{- toYaml .volumes | nindent 8 }}`, "pod.spec")
+	want := []ValuesUsage{{ValuesPath: "pod.spec.volumes", Pattern: "toYaml_dot", IsListUse: true}}
+	if !reflect.DeepEqual(usages, want) {
+		t.Errorf("AnalyzeDirectiveContent() = %+v, want %+v", usages, want)
+	}
+	// Outside a with block, a field of dot isn't a values path
+	if usages := AnalyzeDirectiveContent(`{{- toYaml .volumes | nindent 8 }}`, ""); len(usages) != 0 {
+		t.Errorf("AnalyzeDirectiveContent() without context = %+v, want none", usages)
+	}
+}
+
+func TestAnalyzeDirectiveContentIgnoresComments(t *testing.T) {
+	t.Parallel()
+
+	content := `{{- /* toYaml .Values.old */ -}}
+{{- toYaml .Values.new | nindent 8 }}`
+	usages := AnalyzeDirectiveContent(content, "")
+	if len(usages) != 1 || usages[0].ValuesPath != "new" {
+		t.Errorf("AnalyzeDirectiveContent() = %+v, want only new", usages)
+	}
+}
+
+func TestAnalyzeDirectiveContentToJSON(t *testing.T) {
+	t.Parallel()
+
+	for _, content := range []string{
+		`{{ toJson .Values.sidecars }}`,
+		`{{ .Values.sidecars | toJson | quote }}`,
+	} {
+		usages := AnalyzeDirectiveContent(content, "")
+		want := []ValuesUsage{{ValuesPath: "sidecars", Pattern: "toJson", IsListUse: true}}
+		if !reflect.DeepEqual(usages, want) {
+			t.Errorf("AnalyzeDirectiveContent(%q) = %+v, want %+v", content, usages, want)
+		}
+	}
+}
+
+func TestAnalyzeDirectiveContentConcat(t *testing.T) {
+	t.Parallel()
+
+	for _, content := range []string{
+		`{{- toYaml (concat .Values.env .Values.extraEnv) | nindent 12 }}`,
+		`{{- concat .Values.env $.Values.extraEnv | toYaml | nindent 12 }}`,
+	} {
+		usages := AnalyzeDirectiveContent(content, "")
+		want := []ValuesUsage{
+			{ValuesPath: "env", Pattern: "concat", IsListUse: true},
+			{ValuesPath: "extraEnv", Pattern: "concat", IsListUse: true},
+		}
+		if !reflect.DeepEqual(usages, want) {
+			t.Errorf("AnalyzeDirectiveContent(%q) = %+v, want %+v", content, usages, want)
+		}
+	}
+}
+
+func TestAnalyzeDirectiveContentMerge(t *testing.T) {
+	t.Parallel()
+
+	for _, content := range []string{
+		`{{- toYaml (merge .Values.app .Values.defaults).env | nindent 12 }}`,
+		`{{- (mergeOverwrite .Values.app $.Values.defaults).env | toYaml | nindent 12 }}`,
+	} {
+		usages := AnalyzeDirectiveContent(content, "")
+		want := []ValuesUsage{
+			{ValuesPath: "app.env", Pattern: "merge", IsListUse: true},
+			{ValuesPath: "defaults.env", Pattern: "merge", IsListUse: true},
+		}
+		if !reflect.DeepEqual(usages, want) {
+			t.Errorf("AnalyzeDirectiveContent(%q) = %+v, want %+v", content, usages, want)
+		}
+	}
+}
+
+func TestAnalyzeDirectiveContentWrapped(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		content string
+		want    []ValuesUsage
+	}{
+		{
+			`{{- toYaml (required "env required" .Values.env) | nindent 12 }}`,
+			[]ValuesUsage{{ValuesPath: "env", Pattern: "required", IsListUse: true}},
+		},
+		{
+			`{{- required "env required" $.Values.app.env | toYaml | nindent 12 }}`,
+			[]ValuesUsage{{ValuesPath: "app.env", Pattern: "required", IsListUse: true}},
+		},
+		{
+			`{{- toYaml (coalesce .Values.env .Values.legacyEnv) | nindent 12 }}`,
+			[]ValuesUsage{
+				{ValuesPath: "env", Pattern: "coalesce", IsListUse: true},
+				{ValuesPath: "legacyEnv", Pattern: "coalesce", IsListUse: true},
+			},
+		},
+		{
+			`{{- coalesce .Values.env .Values.legacyEnv | toYaml | nindent 12 }}`,
+			[]ValuesUsage{
+				{ValuesPath: "env", Pattern: "coalesce", IsListUse: true},
+				{ValuesPath: "legacyEnv", Pattern: "coalesce", IsListUse: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		if usages := AnalyzeDirectiveContent(tt.content, ""); !reflect.DeepEqual(usages, tt.want) {
+			t.Errorf("AnalyzeDirectiveContent(%q) = %+v, want %+v", tt.content, usages, tt.want)
+		}
+	}
+}
+
+func TestAnalyzeDirectiveContentIndexed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		content string
+		want    []ValuesUsage
+	}{
+		{
+			`{{- toYaml (index .Values "weird-key" "env") | nindent 12 }}`,
+			[]ValuesUsage{{ValuesPath: "weird-key.env", Pattern: "toYaml", IsListUse: true}},
+		},
+		{
+			`{{- index $.Values "weird-key" "env" | toYaml | nindent 12 }}`,
+			[]ValuesUsage{{ValuesPath: "weird-key.env", Pattern: "toYaml", IsListUse: true}},
+		},
+		{
+			`{{ toJson (index .Values "side-cars") }}`,
+			[]ValuesUsage{{ValuesPath: "side-cars", Pattern: "toJson", IsListUse: true}},
+		},
+		{
+			`{{- with (index .Values "weird-key" "env") }}`,
+			[]ValuesUsage{{ValuesPath: "weird-key.env", Pattern: "with", IsListUse: true}},
+		},
+		// A key holding a dot has no dotted path
+		{`{{- toYaml (index .Values "example.com/env") | nindent 12 }}`, nil},
+	}
+	for _, tt := range tests {
+		if usages := AnalyzeDirectiveContent(tt.content, ""); !reflect.DeepEqual(usages, tt.want) {
+			t.Errorf("AnalyzeDirectiveContent(%q) = %+v, want %+v", tt.content, usages, tt.want)
+		}
+	}
+
+	// with on an indexed path sets dot for the directives inside it
+	var scopes scopeStack
+	scopes.scan(`{{- with index .Values "weird-key" }}`)
+	if got := scopes.scan(`{{- toYaml .env | nindent 8 }}`).valuesPath(); got != "weird-key" {
+		t.Errorf("WithContext = %q, want weird-key", got)
+	}
+}
+
+func TestIncludeCalls(t *testing.T) {
+	t.Parallel()
+
+	content := `{{- include "app.env" (dict "env" .Values.extraEnv "ctx" $) | nindent 12 }}
+{{- include "app.ports" (dict "ports" $.Values.ports) }}
+{{- include "app.nested" (dict "env" (default list .Values.env)) }}`
+	calls := IncludeCalls(content)
+	if len(calls) != 2 {
+		t.Fatalf("IncludeCalls() = %+v, want 2 calls", calls)
+	}
+	if path, ok := calls[0].ValuesPath("env"); calls[0].Name != "app.env" || !ok || path != "extraEnv" {
+		t.Errorf("calls[0] = %+v, env -> %q, %v", calls[0], path, ok)
+	}
+	if _, ok := calls[0].ValuesPath("ctx"); ok {
+		t.Errorf("ctx should not be a values path")
+	}
+	if path, ok := calls[1].ValuesPath("ports"); !ok || path != "ports" {
+		t.Errorf("calls[1] ports -> %q, %v", path, ok)
+	}
+}
+
+func TestOpaqueCalls(t *testing.T) {
+	t.Parallel()
+
+	content := `{{- include "app.env" (dict "env" .Values.extraEnv) | nindent 12 }}
+{{- include "app.env" (dict "env" (default list .Values.initEnv)) | nindent 12 }}
+{{- include "app.env" $ctx | nindent 12 }}
+{{- template "app.env" }}
+{{- /* include "app.env" $commented */}}`
+	want := []OpaqueCall{
+		{Name: "app.env", Call: `include "app.env" (dict "env" (default list .Values.initEnv))`},
+		{Name: "app.env", Call: `include "app.env" $ctx`},
+		{Name: "app.env", Call: `template "app.env"`},
+	}
+	if got := OpaqueCalls(content); !reflect.DeepEqual(got, want) {
+		t.Errorf("OpaqueCalls() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRendersDictArg(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{`{{- toYaml .env }}`, true},
+		{`{{- .env | toYaml | nindent 2 }}`, true},
+		{`{{ toJson .env }}`, true},
+		{`{{- toYaml .envFrom }}`, false},
+		{`{{/* toYaml .env */}}`, false},
+	}
+	for _, tt := range tests {
+		if got := RendersDictArg(tt.body, "env"); got != tt.want {
+			t.Errorf("RendersDictArg(%q) = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestYAMLFileError(t *testing.T) {
+	data := []byte("a: 1\nb:\n  c: d: e\n")
+	var doc yaml.Node
+	fe := YAMLFileError("values.yaml", data, yaml.Unmarshal(data, &doc))
+	want := &FileError{File: "values.yaml", Line: 3, Column: 3, Msg: "mapping values are not allowed in this context", Source: "  c: d: e"}
+	if !reflect.DeepEqual(fe, want) {
+		t.Errorf("YAMLFileError() = %+v, want %+v", fe, want)
+	}
+	if got := fe.Error(); got != "values.yaml:3:3: mapping values are not allowed in this context" {
+		t.Errorf("Error() = %q", got)
+	}
+
+	// Decoding errors are located at the first one
+	data = []byte("a: [1]\nb: [2]\n")
+	var typed struct{ A, B int }
+	fe = YAMLFileError("values.yaml", data, yaml.Unmarshal(data, &typed))
+	if fe.Line != 1 || fe.Column != 1 || !strings.HasSuffix(fe.Msg, "(and 1 more)") {
+		t.Errorf("YAMLFileError() = %+v, want line 1 counting the other error", fe)
+	}
+}
@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// scope is a template block open at some point in a file: an if, with, range,
+// define or block action awaiting its end
+type scope struct {
+	dot   dotRef // What dot refers to inside the block
+	outer dotRef // What dot referred to before it, restored by else
+}
+
+// dotRef is what the template's dot refers to
+type dotRef struct {
+	path  string // .Values path, "" for .Values itself
+	known bool   // Dot is .Values or a path in it, rather than an item or other data
+}
+
+// valuesPath returns the .Values path dot refers to, or "" if it isn't one
+func (d dotRef) valuesPath() string {
+	if !d.known {
+		return ""
+	}
+	return d.path
+}
+
+// scopeStack tracks the blocks open at a point in a file, and what dot
+// refers to in each, so directives inside nested with blocks are attributed
+// to the .Values path their dot resolves to
+type scopeStack []scope
+
+var (
+	// reAction matches one template action, capturing its content
+	reAction = regexp.MustCompile(`\{\{-?\s*(.*?)\s*-?\}\}`)
+	// reKeyword matches the control keyword an action starts with
+	reKeyword = regexp.MustCompile(`^(if|with|range|define|block|else|end)\b\s*(.*)$`)
+	// reDotField matches a pipeline that is a single field chain, optionally
+	// assigned to a variable: .Values.a, $.Values.a, .b.c, $v := .b, or .
+	reDotField = regexp.MustCompile(`^(?:\$\w*\s*:=\s*)?(\$?)\.([a-zA-Z0-9_.]*)$`)
+	// reDotIndex matches a pipeline indexing .Values with quoted keys:
+	// index .Values "a-b" "env", optionally in parens or assigned
+	reDotIndex = regexp.MustCompile(`^(?:\$\w*\s*:=\s*)?\(?\s*index\s+\$?\.Values` + indexArgs + `\s*\)?$`)
+)
+
+// dot returns what dot refers to at the current point
+func (s scopeStack) dot() dotRef {
+	if len(s) == 0 {
+		return dotRef{}
+	}
+	return s[len(s)-1].dot
+}
+
+// scan applies the actions on a line to the stack, returning what dot
+// referred to at the line's last action that renders something, or at the
+// start of the line if none does. Actions that only open or close blocks
+// don't render, so a single-line {{ with .Values.a }}{{ toYaml . }}{{ end }}
+// is attributed to a.
+func (s *scopeStack) scan(line string) dotRef {
+	context := s.dot()
+	for _, m := range reAction.FindAllStringSubmatch(line, -1) {
+		k := reKeyword.FindStringSubmatch(m[1])
+		if k == nil {
+			context = s.dot()
+			continue
+		}
+		switch keyword, arg := k[1], k[2]; keyword {
+		case "if":
+			*s = append(*s, scope{dot: s.dot(), outer: s.dot()})
+		case "with":
+			*s = append(*s, scope{dot: resolveDot(s.dot(), arg), outer: s.dot()})
+		case "range", "define", "block":
+			// Dot is each item in a range, and whatever was passed in a
+			// define or block, none of which are known .Values paths
+			*s = append(*s, scope{outer: s.dot()})
+		case "else":
+			if len(*s) == 0 {
+				continue
+			}
+			top := &(*s)[len(*s)-1]
+			top.dot = top.outer
+			if rest, ok := strings.CutPrefix(arg, "with "); ok {
+				top.dot = resolveDot(top.outer, strings.TrimSpace(rest))
+			}
+		case "end":
+			if len(*s) > 0 {
+				*s = (*s)[:len(*s)-1]
+			}
+		}
+	}
+	return context
+}
+
+// resolveDot returns what dot refers to inside {{ with pipeline }}, given
+// what it referred to outside. Only field chains are followed; anything else
+// (function calls, pipes, variables) leaves dot unknown, except index on
+// .Values with quoted keys.
+func resolveDot(outer dotRef, pipeline string) dotRef {
+	pipeline = strings.TrimSpace(pipeline)
+	if m := reDotIndex.FindStringSubmatch(pipeline); m != nil {
+		path, ok := indexPath(m[1])
+		return dotRef{path: path, known: ok}
+	}
+	m := reDotField.FindStringSubmatch(pipeline)
+	if m == nil {
+		return dotRef{}
+	}
+	field := strings.Trim(m[2], ".")
+	if field == "Values" {
+		return dotRef{known: true}
+	}
+	if rest, ok := strings.CutPrefix(field, "Values."); ok {
+		return dotRef{path: rest, known: true}
+	}
+	if m[1] == "$" || !outer.known {
+		// A field of the root context other than .Values, or of unknown data
+		return dotRef{}
+	}
+	if field == "" {
+		return outer
+	}
+	if outer.path == "" {
+		return dotRef{path: field, known: true}
+	}
+	return dotRef{path: outer.path + "." + field, known: true}
+}
@@ -0,0 +1,245 @@
+package template
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+)
+
+// helperPath is the chart path of the generated helper template
+const helperPath = "templates/_listmap.tpl"
+
+// reDefineName matches a define action, capturing the template name
+var reDefineName = regexp.MustCompile(`\{\{-?\s*define\s+"([^"]+)"\s*-?\}\}`)
+
+// HelperCollision is a template outside the generated helper file that defines
+// one of the helper's names, e.g. from an earlier manual migration or a fork
+type HelperCollision struct {
+	File       string // Path relative to the chart root
+	Name       string // Define name shared with the generated helper
+	Same       bool   // The definition matches the generated one
+	Dependency bool   // Defined by a dependency in charts/, not the chart itself
+}
+
+// HelperCollisions returns the defines in the chart's templates, other than
+// the generated helper file, that use the generated helper's names. Helm keeps
+// only one definition per name across a chart and its dependencies, so a
+// differing one would silently replace the helper or be replaced by it. The
+// dependencies in charts/ are scanned too, unpacked or packaged; a packaged
+// one's templates are named by their path in the archive (e.g.,
+// charts/redis-1.0.0.tgz/redis/templates/_helpers.tpl).
+func HelperCollisions(filesystem fs.FileSystem, root string, o Options) ([]HelperCollision, error) {
+	generated := o.ListMapHelper()
+	names := make(map[string]bool)
+	for _, m := range reDefineName.FindAllStringSubmatch(generated, -1) {
+		names[m[1]] = true
+	}
+
+	files, err := readTemplates(filesystem, root)
+	if err != nil {
+		return nil, err
+	}
+	deps, err := dependencyTemplates(filesystem, root)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, deps...)
+	var collisions []HelperCollision
+	for _, f := range files {
+		rel, _ := filepath.Rel(root, f.path)
+		rel = filepath.ToSlash(rel)
+		if rel == helperPath {
+			continue
+		}
+		dependency := strings.HasPrefix(rel, dependencyDir+"/")
+		content := string(f.data)
+		for _, m := range reDefineName.FindAllStringSubmatch(content, -1) {
+			if !names[m[1]] {
+				continue
+			}
+			collisions = append(collisions, HelperCollision{
+				File:       rel,
+				Name:       m[1],
+				Same:       sameDefine(content, generated, m[1]),
+				Dependency: dependency,
+			})
+		}
+	}
+	return collisions, nil
+}
+
+// dependencyDir is where a chart's dependencies live, relative to its root
+const dependencyDir = "charts"
+
+// dependencyTemplates returns the templates of the dependencies in the
+// chart's charts/ directory, and of theirs, unpacked or packaged
+func dependencyTemplates(filesystem fs.FileSystem, root string) ([]templateFile, error) {
+	dir := filepath.Join(root, dependencyDir)
+	if info, err := filesystem.Stat(dir); err != nil || !info.IsDir() {
+		return nil, nil
+	}
+	var files []templateFile
+	err := filesystem.WalkDir(dir, func(p string, d iofs.DirEntry, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+		if d.IsDir() {
+			chart, err := readTemplates(filesystem, p)
+			if err != nil {
+				return err
+			}
+			deps, err := dependencyTemplates(filesystem, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, chart...)
+			files = append(files, deps...)
+			return iofs.SkipDir
+		}
+		if filepath.Ext(p) != ".tgz" {
+			return nil
+		}
+		data, err := filesystem.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		packaged, err := packagedTemplates(p, data)
+		if err != nil {
+			return fmt.Errorf("reading dependency %s: %w", p, err)
+		}
+		files = append(files, packaged...)
+		return nil
+	})
+	return files, err
+}
+
+// rePackagedTemplate matches the path of a template in a packaged chart, in
+// the chart or in one of its unpacked dependencies
+var rePackagedTemplate = regexp.MustCompile(`^[^/]+/(?:charts/[^/]+/)*templates/`)
+
+// packagedTemplates returns the templates in a packaged chart, and in the
+// dependencies packed into it, named by their path under archive
+func packagedTemplates(archive string, data []byte) ([]templateFile, error) {
+	gzr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = gzr.Close() }()
+
+	var files []templateFile
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(header.Name)
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		nested := path.Ext(name) == ".tgz" && path.Base(path.Dir(name)) == dependencyDir
+		if !nested && !(rePackagedTemplate.MatchString(name) && fs.IsTemplate(name)) {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		p := filepath.Join(archive, filepath.FromSlash(name))
+		if !nested {
+			files = append(files, templateFile{path: p, data: content})
+			continue
+		}
+		deps, err := packagedTemplates(p, content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		files = append(files, deps...)
+	}
+}
+
+// sameDefine reports whether the define named name has the same body in a and
+// b, ignoring indentation and blank lines
+func sameDefine(a, b, name string) bool {
+	aStart, aEnd, ok := defineBody(a, name)
+	if !ok {
+		return false
+	}
+	bStart, bEnd, ok := defineBody(b, name)
+	if !ok {
+		return false
+	}
+	return normalizeDefine(a[aStart:aEnd]) == normalizeDefine(b[bStart:bEnd])
+}
+
+// normalizeDefine trims each line of a define body and drops blank lines
+func normalizeDefine(body string) string {
+	var lines []string
+	for _, line := range strings.Split(body, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CheckHelperCollisions returns an error naming the chart's templates that
+// define a helper name with different content, suggesting a chart-specific
+// helperName. Identical copies are fine.
+func CheckHelperCollisions(filesystem fs.FileSystem, root string, o Options) error {
+	collisions, err := HelperCollisions(filesystem, root, o)
+	if err != nil {
+		return err
+	}
+	var conflicts []string
+	for _, c := range collisions {
+		if !c.Same {
+			conflicts = append(conflicts, fmt.Sprintf("%q in %s", c.Name, c.File))
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return fmt.Errorf("chart already defines helper template(s) that differ from the generated ones: %s; "+
+		"set helperName in .helm-list-to-map.yaml (e.g., helperName: %s.listmap.items) to generate the helper under another name",
+		strings.Join(conflicts, ", "), filepath.Base(root))
+}
+
+// helperDefined reports whether the chart's own templates already define
+// every generated helper name identically, so the helper file isn't needed
+func helperDefined(filesystem fs.FileSystem, root string, o Options) bool {
+	collisions, err := HelperCollisions(filesystem, root, o)
+	if err != nil {
+		return false
+	}
+	same := make(map[string]bool)
+	for _, c := range collisions {
+		// A dependency's copy can't stand in for the chart's own
+		if c.Dependency {
+			continue
+		}
+		if !c.Same {
+			return false
+		}
+		same[c.Name] = true
+	}
+	for _, m := range reDefineName.FindAllStringSubmatch(o.ListMapHelper(), -1) {
+		if !same[m[1]] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package template
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// concatArgs matches the .Values lists passed to concat, e.g.
+// " .Values.env .Values.extraEnv"
+const concatArgs = `((?:\s+\$?\.Values\.[a-zA-Z0-9_.]+)+)`
+
+// reConcatValuesArg matches one concat argument, capturing its .Values path
+var reConcatValuesArg = regexp.MustCompile(`\$?\.Values\.([a-zA-Z0-9_.]+)`)
+
+// reConcatAction matches a list composed with concat and rendered with toYaml:
+// {{- toYaml (concat .Values.A .Values.B) | nindent N }}, or the piped
+// (concat .Values.A .Values.B) | toYaml form, with the same stages as
+// ReplaceListBlocksWith accepts
+var reConcatAction = regexp.MustCompile(`\{\{(-?)\s*(?:toYaml\s+\(\s*concat` + concatArgs + `\s*\)|\(?\s*concat` + concatArgs + `\s*\)?\s*\|\s*toYaml)` + pipelineStages + `\s*(-?)\}\}`)
+
+// reMergeAction matches a list read from dicts merged with merge or
+// mergeOverwrite and rendered with toYaml:
+// {{- toYaml (merge .Values.A .Values.B).env | nindent N }}, or the piped
+// (merge .Values.A .Values.B).env | toYaml form
+var reMergeAction = regexp.MustCompile(`\{\{(-?)\s*(?:toYaml\s+\(\s*(merge|mergeOverwrite)` + concatArgs + `\s*\)\.([a-zA-Z0-9_.]+)|\(\s*(merge|mergeOverwrite)` + concatArgs + `\s*\)\.([a-zA-Z0-9_.]+)\s*\|\s*toYaml)` + pipelineStages + `\s*(-?)\}\}`)
+
+// composedSource is one list merged into a composed helper call
+type composedSource struct {
+	path string
+	root string // .Values or $.Values
+}
+
+// ReplaceConcatBlocks replaces toYaml calls on lists composed with concat, or
+// read from dicts merged with merge or mergeOverwrite, with the listmap helper
+// rendering the merged maps of the composed paths. An entry under a key in
+// more than one map is replaced whole by the later map's entry, not merged
+// field by field, so an env var overridden with a valueFrom drops the default's
+// value. For concat the later map is the later argument; merge keeps its first
+// dict's fields, so there the earlier argument wins. An action is only
+// rewritten when every path in it is converted with the same merge key and
+// helper; otherwise a path still holding a list would break.
+func ReplaceConcatBlocks(tpl string, paths []PathInfo, o Options) (string, bool) {
+	converted := make(map[string]PathInfo, len(paths))
+	for _, p := range paths {
+		converted[p.DotPath] = p
+	}
+
+	changed := false
+	replace := func(match, open string, sources []composedSource, tail, close string) string {
+		stages, ok := parsePipeline(tail)
+		if !ok {
+			return match
+		}
+		var composed []PathInfo
+		var roots []string
+		for _, s := range sources {
+			p, ok := converted[s.path]
+			if !ok || (len(composed) > 0 && (p.helperArgs() != composed[0].helperArgs() || p.helper(o) != composed[0].helper(o))) {
+				return match
+			}
+			composed = append(composed, p)
+			roots = append(roots, s.root)
+		}
+
+		changed = true
+		call := mergedHelperCall(composed, roots, o)
+		return fmt.Sprintf(`{{%s %s %s}}`, open, strings.Join(append([]string{call}, stages...), " | "), close)
+	}
+
+	tpl = reConcatAction.ReplaceAllStringFunc(tpl, func(match string) string {
+		m := reConcatAction.FindStringSubmatch(match)
+		return replace(match, m[1], composedArgs(m[2]+m[3], ""), m[4], m[5])
+	})
+	tpl = reMergeAction.ReplaceAllStringFunc(tpl, func(match string) string {
+		m := reMergeAction.FindStringSubmatch(match)
+		sources := composedArgs(m[3]+m[6], m[4]+m[7])
+		if m[2]+m[5] == "merge" {
+			for i, j := 0, len(sources)-1; i < j; i, j = i+1, j-1 {
+				sources[i], sources[j] = sources[j], sources[i]
+			}
+		}
+		return replace(match, m[1], sources, m[8], m[9])
+	})
+	return tpl, changed
+}
+
+// composedArgs returns the .Values paths in args, each followed by field when
+// the list is a field of the dicts the arguments name
+func composedArgs(args, field string) []composedSource {
+	var sources []composedSource
+	for _, m := range reConcatValuesArg.FindAllStringSubmatch(args, -1) {
+		path := m[1]
+		if field != "" {
+			path += "." + field
+		}
+		sources = append(sources, composedSource{path: path, root: valuesRoot(m[0])})
+	}
+	return sources
+}
@@ -0,0 +1,181 @@
+package template
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// reWithFragment matches a with block rendering a list fragment without a
+// section key of its own: {{- with .Values.X }}{{- toYaml . | nindent N }}{{- end }}
+var reWithFragment = regexp.MustCompile(`\{\{(-?)\s*with\s+\$?\.Values\.([a-zA-Z0-9_.]+)\s*\}\}\s*\{\{(-?)\s*toYaml\s+\.` + pipelineStages + `\s*-?\}\}\s*\{\{-?\s*end\s*(-?)\}\}`)
+
+// rePlainFragment matches a list rendered with toYaml: {{- toYaml .Values.X | nindent N }}
+// or {{- .Values.X | toYaml | nindent N }}
+var rePlainFragment = regexp.MustCompile(`\{\{(-?)\s*(?:toYaml\s+\$?\.Values\.([a-zA-Z0-9_.]+)|\$?\.Values\.([a-zA-Z0-9_.]+)\s*\|\s*toYaml)` + pipelineStages + `\s*(-?)\}\}`)
+
+// listFragment is one list rendered into a field other lists are rendered
+// into too, e.g. initContainers followed by extraInitContainers
+type listFragment struct {
+	start, end  int
+	path        string
+	root        string // .Values or $.Values
+	open, close string // trim markers of the rendered span
+	stages      []string
+	with        bool
+}
+
+// findFragmentRuns returns the runs of list fragments rendered one after the
+// other, with only whitespace between them, by the same stages. Fragments are
+// nindented, so each renders the same wherever it starts.
+func findFragmentRuns(tpl string) [][]listFragment {
+	var fragments []listFragment
+	for _, m := range reWithFragment.FindAllStringSubmatchIndex(tpl, -1) {
+		stages, ok := parseFragmentStages(tpl[m[8]:m[9]])
+		if !ok || tpl[m[6]:m[7]] != "-" {
+			continue
+		}
+		fragments = append(fragments, listFragment{
+			start: m[0], end: m[1],
+			path:   tpl[m[4]:m[5]],
+			root:   valuesRoot(tpl[m[0]:m[5]]),
+			open:   tpl[m[2]:m[3]],
+			close:  tpl[m[10]:m[11]],
+			stages: stages,
+			with:   true,
+		})
+	}
+	for _, m := range rePlainFragment.FindAllStringSubmatchIndex(tpl, -1) {
+		stages, ok := parseFragmentStages(tpl[m[8]:m[9]])
+		if !ok {
+			continue
+		}
+		path, pathEnd := "", 0
+		if m[4] >= 0 {
+			path, pathEnd = tpl[m[4]:m[5]], m[5]
+		} else {
+			path, pathEnd = tpl[m[6]:m[7]], m[7]
+		}
+		fragments = append(fragments, listFragment{
+			start: m[0], end: m[1],
+			path:   path,
+			root:   valuesRoot(tpl[m[0]:pathEnd]),
+			open:   tpl[m[2]:m[3]],
+			close:  tpl[m[10]:m[11]],
+			stages: stages,
+		})
+	}
+	sort.Slice(fragments, func(i, j int) bool { return fragments[i].start < fragments[j].start })
+
+	var runs [][]listFragment
+	for _, f := range fragments {
+		if n := len(runs); n > 0 {
+			last := runs[n-1][len(runs[n-1])-1]
+			if strings.TrimSpace(tpl[last.end:f.start]) == "" && strings.Join(last.stages, "|") == strings.Join(f.stages, "|") {
+				runs[n-1] = append(runs[n-1], f)
+				continue
+			}
+		}
+		runs = append(runs, []listFragment{f})
+	}
+	return runs
+}
+
+// parseFragmentStages is parsePipeline for fragments, which must be nindented
+func parseFragmentStages(tail string) ([]string, bool) {
+	stages, ok := parsePipeline(tail)
+	if !ok {
+		return nil, false
+	}
+	for _, s := range stages {
+		if strings.HasPrefix(s, "nindent") {
+			return stages, true
+		}
+	}
+	return nil, false
+}
+
+// ReplaceFragmentBlocks replaces the list fragments rendered one after the
+// other into one field, such as initContainers from the chart's defaults then
+// extraInitContainers from users, with one helper call rendering their merged
+// maps. An item with the same key in several fragments is rendered once, from
+// the last fragment setting it, instead of twice. A run is merged only when
+// every path in it is converted with the same merge key and helper; otherwise
+// each converted with block is rewritten on its own, as is a single with block
+// appending items to a list (sidecars after the chart's own containers).
+func ReplaceFragmentBlocks(tpl string, paths []PathInfo, o Options) (string, bool) {
+	updated, rewritten := replaceFragments(tpl, paths, o)
+	return updated, len(rewritten) > 0
+}
+
+// replaceFragments is ReplaceFragmentBlocks returning the paths it rewrote
+func replaceFragments(tpl string, paths []PathInfo, o Options) (string, []string) {
+	converted := make(map[string]PathInfo, len(paths))
+	for _, p := range paths {
+		converted[p.DotPath] = p
+	}
+
+	var b strings.Builder
+	var rewritten []string
+	pos := 0
+	replace := func(start, end int, s string) {
+		b.WriteString(tpl[pos:start])
+		b.WriteString(s)
+		pos = end
+	}
+	for _, run := range findFragmentRuns(tpl) {
+		if composed, ok := composedFragments(run, converted, o); ok && len(run) > 1 {
+			first, last := run[0], run[len(run)-1]
+			var roots []string
+			for _, f := range run {
+				roots = append(roots, f.root)
+			}
+			call := mergedHelperCall(composed, roots, o)
+			replace(first.start, last.end, fmt.Sprintf(`{{%s %s %s}}`, first.open, strings.Join(append([]string{call}, first.stages...), " | "), last.close))
+			for _, p := range composed {
+				rewritten = append(rewritten, p.DotPath)
+			}
+			continue
+		}
+		// Plain toYaml fragments are left to ReplaceListBlocksWith
+		for _, f := range run {
+			p, ok := converted[f.path]
+			if !ok || !f.with {
+				continue
+			}
+			call := fmt.Sprintf(`include %q (dict "items" (index %s %s) %s)`, p.helper(o), f.root, QuotePath(p.DotPath), p.helperArgs())
+			replace(f.start, f.end, fmt.Sprintf(`{{%s %s %s}}`, f.open, strings.Join(append([]string{call}, f.stages...), " | "), f.close))
+			rewritten = append(rewritten, p.DotPath)
+		}
+	}
+	b.WriteString(tpl[pos:])
+	return b.String(), rewritten
+}
+
+// composedFragments returns the conversions of the fragments' paths, if every
+// one is converted with the same merge key and helper
+func composedFragments(run []listFragment, converted map[string]PathInfo, o Options) ([]PathInfo, bool) {
+	var composed []PathInfo
+	for _, f := range run {
+		p, ok := converted[f.path]
+		if !ok || (len(composed) > 0 && (p.helperArgs() != composed[0].helperArgs() || p.helper(o) != composed[0].helper(o))) {
+			return nil, false
+		}
+		composed = append(composed, p)
+	}
+	return composed, true
+}
+
+// mergedHelperCall returns the helper call rendering the merged maps of the
+// composed paths, as ConvertedPaths reads it back. The helper merges its
+// sources in order, so an entry of a later path replaces the whole entry of an
+// earlier one under the same key. roots holds the .Values or $.Values each
+// path was read through.
+func mergedHelperCall(composed []PathInfo, roots []string, o Options) string {
+	var sources []string
+	for i, p := range composed {
+		sources = append(sources, fmt.Sprintf("(index %s %s)", roots[i], QuotePath(p.DotPath)))
+	}
+	return fmt.Sprintf(`include %q (dict "sources" (list %s) %s)`, composed[0].helper(o), strings.Join(sources, " "), composed[0].helperArgs())
+}
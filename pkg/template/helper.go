@@ -2,40 +2,418 @@ package template
 
 import (
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/detect"
 	"github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
 )
 
-// EnsureHelpersWithReport creates helper template and returns true if created
-func EnsureHelpersWithReport(filesystem fs.FileSystem, root string) bool {
-	path := filepath.Join(root, "templates", "_listmap.tpl")
+// DefaultHelperName is the define name of the generated list-map helper
+const DefaultHelperName = "chart.listmap.items"
+
+// Options are a chart's choices for the template code convert writes: the
+// name of the generated helper and the layout of the code. The zero Options
+// writes the DefaultHelperName helper in the zero Style.
+type Options struct {
+	// HelperName is the define name of the helper (DefaultHelperName if
+	// empty), so charts can follow their own helper naming conventions
+	HelperName string
+	// Style lays out the helper and the actions around rewritten lists
+	Style Style
+}
+
+// Helper returns the define name of the helper
+func (o Options) Helper() string {
+	if o.HelperName == "" {
+		return DefaultHelperName
+	}
+	return o.HelperName
+}
+
+// OrderedHelperName returns the define name of the helper variant that renders
+// env vars in dependency order
+func (o Options) OrderedHelperName() string {
+	return o.Helper() + ".ordered"
+}
+
+// ByOrderHelperName returns the define name of the helper variant that renders
+// items sorted by their order field
+func (o Options) ByOrderHelperName() string {
+	return o.Helper() + ".byorder"
+}
+
+// JSONHelperName returns the define name of the helper variant that renders
+// items as a JSON list, for lists rendered with toJson
+func (o Options) JSONHelperName() string {
+	return o.Helper() + ".json"
+}
+
+// SetHelperName returns the define name of the helper variant that renders
+// the keys of a set (key: true) as a list, for scalar and single-field lists
+func (o Options) SetHelperName() string {
+	return o.Helper() + ".set"
+}
+
+// NestedHelperName returns the define name of the helper variant that renders
+// maps nested by several keys (namespace, then name) as a list
+func (o Options) NestedHelperName() string {
+	return o.Helper() + ".nested"
+}
+
+// CompositeHelperName returns the define name of the helper variant that
+// renders maps keyed by several fields joined with "/" (namespace/name) as a list
+func (o Options) CompositeHelperName() string {
+	return o.Helper() + ".composite"
+}
+
+// ShapedHelperName returns the define name of the helper variant that renders
+// maps whose entries a rule reshaped (renamed fields, scalar shorthands) as a list
+func (o Options) ShapedHelperName() string {
+	return o.Helper() + ".shaped"
+}
+
+// SyntheticHelperName returns the define name of the helper variant that
+// renders map entries as items without their key, for keys that only name them
+func (o Options) SyntheticHelperName() string {
+	return o.Helper() + ".synthetic"
+}
+
+// HelperVersion identifies the generated helper template. Bump it whenever
+// ListMapHelper output changes so charts with older helpers can be detected.
+const HelperVersion = 12
+
+// HelperChange is how a helper version changed what converted charts render
+type HelperChange struct {
+	Version int
+	Summary string
+}
+
+// HelperChangelog lists the change each helper version made, oldest first.
+// Add an entry whenever HelperVersion is bumped.
+var HelperChangelog = []HelperChange{
+	{1, "Records the helper version; items still render sorted by key"},
+	{2, "Adds the .ordered variant, rendering env vars after the vars they reference as $(VAR)"},
+	{3, "Adds the .byorder variant, rendering items by their order field and leaving the field out"},
+	{4, "Adds the .json variant for lists rendered with toJson"},
+	{5, "Renders nothing for null items instead of failing on them"},
+	{6, "Adds the .set variant, rendering the keys set to true as scalar or single-field items"},
+	{7, "Sorts numeric keys by value (80 before 443 before 8080) instead of alphabetically"},
+	{8, "Adds the .nested and .composite variants for maps keyed by several fields"},
+	{9, "Adds the .shaped variant for entries shortened to one field or with renamed fields"},
+	{10, "Adds the .synthetic variant, rendering entries without the key that only names them"},
+	{11, "Names the upgrade-helpers command in its header; renders the same as version 10"},
+	{12, "Takes sources, maps merged with later maps replacing the entries of earlier ones under the same key"},
+}
+
+// HelperChangesSince returns the changes made after helper version v
+func HelperChangesSince(v int) []HelperChange {
+	var changes []HelperChange
+	for _, c := range HelperChangelog {
+		if c.Version > v {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// reHelperVersion matches the version marker written at the top of the helper
+var reHelperVersion = regexp.MustCompile(`list-to-map helper version (\d+)`)
+
+// ParseHelperVersion returns the helper version recorded in a generated helper
+// template, or 0 for helpers written before versioning was introduced
+func ParseHelperVersion(content string) int {
+	m := reHelperVersion.FindStringSubmatch(content)
+	if m == nil {
+		return 0
+	}
+	v, _ := strconv.Atoi(m[1])
+	return v
+}
+
+// itemsArg is the template block each helper variant starts with. It sets
+// $items to the items argument or, when the caller passes sources (a list of
+// maps composed from several lists), to their merged entries. An entry of a
+// later map replaces the whole entry of an earlier one under the same key, so
+// an override setting valueFrom doesn't keep the value it replaces. The
+// sources are never written to.
+const itemsArg = `{{- $items := .items | default (dict) -}}
+{{- if .sources -}}
+{{- $items = dict -}}
+{{- range $source := .sources -}}
+{{- range $k, $v := $source -}}
+{{- $_ := set $items $k $v -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}`
+
+// naturalSortedKeys is the template block following itemsArg in each helper
+// variant. It sets $sorted to the keys of $items in natural order: keys made of
+// digits first, by numeric value (80 before 443 before 8080), then the rest
+// alphabetically. Numbers are compared by digit count, then digits, so keys of
+// any length sort correctly without integer conversion.
+const naturalSortedKeys = `{{- $byNatural := dict -}}
+{{- range $k := keys $items -}}
+{{- $sortKey := printf "1/%s" $k -}}
+{{- if regexMatch "^[0-9]+$" $k -}}
+{{- $digits := regexReplaceAll "^0+" $k "" -}}
+{{- $sortKey = printf "0/%04d/%s/%s" (len $digits) $digits $k -}}
+{{- end -}}
+{{- $_ := set $byNatural $sortKey $k -}}
+{{- end -}}
+{{- $sorted := list -}}
+{{- range $sortKey := keys $byNatural | sortAlpha -}}
+{{- $sorted = append $sorted (get $byNatural $sortKey) -}}
+{{- end -}}`
+
+// EnsureHelpersWithReport creates helper template and returns true if created.
+// Nothing is created when the chart's own templates already define the helper
+// identically; see CheckHelperCollisions for definitions that differ.
+func EnsureHelpersWithReport(filesystem fs.FileSystem, root string, o Options) bool {
+	path := filepath.Join(root, filepath.FromSlash(helperPath))
 	if _, err := filesystem.Stat(path); err == nil {
 		return false // Already exists
 	}
-	err := filesystem.WriteFile(path, []byte(strings.TrimSpace(ListMapHelper())+"\n"), 0644)
+	if helperDefined(filesystem, root, o) {
+		return false
+	}
+	err := filesystem.WriteFile(path, []byte(strings.TrimSpace(o.ListMapHelper())+"\n"), 0644)
 	return err == nil
 }
 
 // ListMapHelper returns a helper template that renders map items as a YAML list
 // Parameters:
 //   - items: the map of items (keyed by merge key value)
+//   - sources: instead of items, a list of maps merged into the items in order
 //   - key: the patchMergeKey field name (e.g., "name", "mountPath", "containerPort")
 //
-// Output: YAML list items without section name, suitable for use with nindent
+// Output: YAML list items without section name, suitable for use with nindent.
+// Nothing is rendered for a null, empty map, or empty list value.
 //
-// Note: This helper uses Helm-specific functions: keys, sortAlpha, get, quote, toYaml, indent
-func ListMapHelper() string {
-	return `
-{{- define "chart.listmap.items" -}}
-{{- $items := .items -}}
+// Items are rendered in natural key order: keys made of digits (ports) by
+// numeric value, so 80 comes before 1000, then other keys alphabetically.
+// Every variant below orders items this way wherever it says "in key order".
+//
+// The template also defines the OrderedHelperName variant for env vars. It
+// emits items in passes: each pass emits, in key order, the items whose
+// $(VAR) references to other items have all been emitted. Items in a reference
+// cycle are emitted last, in key order.
+//
+// The ByOrderHelperName variant emits items sorted by their integer order field
+// (items without one last), in key order among equal orders, and leaves the
+// order field out of the rendered items.
+//
+// The JSONHelperName variant renders the items, in key order, as a JSON list
+// of objects, for lists rendered with toJson.
+//
+// The SetHelperName variant renders, in key order, the keys set to a true
+// value: as "- key: value" objects when key is set, or as plain strings.
+// Keys set to false or null are left out, so overrides can remove them.
+//
+// The NestedHelperName and CompositeHelperName variants take keys, a list of
+// field names, instead of key. The nested variant renders maps nested one level
+// per key (namespace, then name), and the composite variant maps keyed by the
+// values joined with "/" (the last value may itself contain "/"). Both render
+// items in key order at every level, with each key field set from its key.
+//
+// The ShapedHelperName variant inverts a rule's entry shape before rendering
+// like the main helper: rename maps entry fields back to item fields (v:
+// value), and an entry that isn't a map is the value of the scalar field.
+//
+// The SyntheticHelperName variant renders, in key order, each map entry as an
+// item without a key field, for lists keyed by a curated rule's synthetic key
+// (NetworkPolicy and RBAC rules). An empty entry renders as {}, an item
+// matching everything; null entries are left out.
+//
+// Actions are indented by block per o.Style.
+//
+// Note: This helper uses Helm-specific functions: keys, sortAlpha, get, set, list, append,
+// regexMatch, regexReplaceAll, quote, toYaml, indent, default, dict, and for the variants also
+// hasKey, until, kindIs, regexFindAll, int, omit, merge, toJson, include, index, splitn, trim
+func (o Options) ListMapHelper() string {
+	helper := `
+{{- /* Generated by list-to-map helper version ` + strconv.Itoa(HelperVersion) + `. Refresh with 'helm list-to-map upgrade-helpers'. */ -}}
+{{- define "` + o.Helper() + `" -}}
+` + itemsArg + `
 {{- $key := .key -}}
-{{- range $keyVal := keys $items | sortAlpha }}
+` + naturalSortedKeys + `
+{{- range $keyVal := $sorted }}
 {{- $spec := get $items $keyVal }}
 - {{ $key }}: {{ $keyVal | quote }}
 {{- if $spec }}
 {{ toYaml $spec | indent 2 }}
 {{- end }}
 {{- end }}
+{{- end -}}
+
+{{- define "` + o.OrderedHelperName() + `" -}}
+` + itemsArg + `
+{{- $key := .key -}}
+` + naturalSortedKeys + `
+{{- $names := $sorted -}}
+{{- $done := dict -}}
+{{- $order := list -}}
+{{- range $pass := until (len $names) -}}
+{{- range $name := $names -}}
+{{- if not (hasKey $done $name) -}}
+{{- $ready := true -}}
+{{- $spec := get $items $name -}}
+{{- if and (kindIs "map" $spec) (kindIs "string" $spec.value) -}}
+{{- range $ref := regexFindAll "\\$\\([A-Za-z_][A-Za-z0-9_.-]*\\)" $spec.value -1 -}}
+{{- $refName := trimSuffix ")" (trimPrefix "$(" $ref) -}}
+{{- if and (hasKey $items $refName) (ne $refName $name) (not (hasKey $done $refName)) -}}
+{{- $ready = false -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+{{- if $ready -}}
+{{- $_ := set $done $name true -}}
+{{- $order = append $order $name -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+{{- range $name := $names -}}
+{{- if not (hasKey $done $name) -}}
+{{- $order = append $order $name -}}
+{{- end -}}
+{{- end -}}
+{{- range $keyVal := $order }}
+{{- $spec := get $items $keyVal }}
+- {{ $key }}: {{ $keyVal | quote }}
+{{- if $spec }}
+{{ toYaml $spec | indent 2 }}
+{{- end }}
+{{- end }}
+{{- end -}}
+
+{{- define "` + o.ByOrderHelperName() + `" -}}
+` + itemsArg + `
+{{- $key := .key -}}
+` + naturalSortedKeys + `
+{{- $bySortKey := dict -}}
+{{- range $i, $name := $sorted -}}
+{{- $spec := get $items $name -}}
+{{- $order := 999999 -}}
+{{- if and (kindIs "map" $spec) (hasKey $spec "order") -}}
+{{- $order = int $spec.order -}}
+{{- end -}}
+{{- $_ := set $bySortKey (printf "%06d/%06d" $order $i) $name -}}
+{{- end -}}
+{{- range $sortKey := keys $bySortKey | sortAlpha }}
+{{- $keyVal := get $bySortKey $sortKey }}
+{{- $spec := get $items $keyVal }}
+- {{ $key }}: {{ $keyVal | quote }}
+{{- if kindIs "map" $spec }}
+{{- $spec = omit $spec "order" }}
+{{- end }}
+{{- if $spec }}
+{{ toYaml $spec | indent 2 }}
+{{- end }}
+{{- end }}
+{{- end -}}
+
+{{- define "` + o.JSONHelperName() + `" -}}
+` + itemsArg + `
+{{- $key := .key -}}
+` + naturalSortedKeys + `
+{{- $list := list -}}
+{{- range $keyVal := $sorted -}}
+{{- $spec := get $items $keyVal -}}
+{{- $item := dict $key $keyVal -}}
+{{- if kindIs "map" $spec -}}
+{{- $item = merge $item $spec -}}
+{{- end -}}
+{{- $list = append $list $item -}}
+{{- end -}}
+{{- toJson $list -}}
+{{- end -}}
+
+{{- define "` + o.SetHelperName() + `" -}}
+` + itemsArg + `
+{{- $key := .key -}}
+` + naturalSortedKeys + `
+{{- range $keyVal := $sorted }}
+{{- if get $items $keyVal }}
+{{- if $key }}
+- {{ $key }}: {{ $keyVal | quote }}
+{{- else }}
+- {{ $keyVal | quote }}
+{{- end }}
+{{- end }}
+{{- end }}
+{{- end -}}
+
+{{- define "` + o.NestedHelperName() + `" -}}
+` + itemsArg + `
+{{- $keys := .keys -}}
+{{- $path := .path | default (list) -}}
+` + naturalSortedKeys + `
+{{- range $keyVal := $sorted }}
+{{- $spec := get $items $keyVal }}
+{{- $values := append $path $keyVal }}
+{{- if lt (len $values) (len $keys) }}
+{{- include "` + o.NestedHelperName() + `" (dict "items" $spec "keys" $keys "path" $values) }}
+{{- else }}
+{{- range $i, $k := $keys }}
+{{ if eq $i 0 }}- {{ else }}  {{ end }}{{ $k }}: {{ index $values $i | quote }}
+{{- end }}
+{{- if $spec }}
+{{ toYaml $spec | indent 2 }}
+{{- end }}
+{{- end }}
+{{- end }}
+{{- end -}}
+
+{{- define "` + o.ShapedHelperName() + `" -}}
+` + itemsArg + `
+{{- $key := .key -}}
+{{- $rename := .rename | default (dict) -}}
+{{- $scalar := .scalar -}}
+` + naturalSortedKeys + `
+{{- range $keyVal := $sorted }}
+{{- $entry := get $items $keyVal }}
+{{- $spec := dict }}
+{{- if kindIs "map" $entry }}
+{{- range $field, $v := $entry }}
+{{- $_ := set $spec (get $rename $field | default $field) $v }}
+{{- end }}
+{{- else if and $scalar (not (kindIs "invalid" $entry)) }}
+{{- $_ := set $spec $scalar $entry }}
+{{- end }}
+- {{ $key }}: {{ $keyVal | quote }}
+{{- if $spec }}
+{{ toYaml $spec | indent 2 }}
+{{- end }}
+{{- end }}
+{{- end -}}
+
+{{- define "` + o.SyntheticHelperName() + `" -}}
+` + itemsArg + `
+` + naturalSortedKeys + `
+{{- range $keyVal := $sorted }}
+{{- $spec := get $items $keyVal }}
+{{- if kindIs "map" $spec }}
+- {{ toYaml $spec | indent 2 | trim }}
+{{- end }}
+{{- end }}
+{{- end -}}
+
+{{- define "` + o.CompositeHelperName() + `" -}}
+` + itemsArg + `
+{{- $keys := .keys -}}
+` + naturalSortedKeys + `
+{{- range $keyVal := $sorted }}
+{{- $spec := get $items $keyVal }}
+{{- $values := splitn "` + detect.CompositeKeySeparator + `" (len $keys) $keyVal }}
+{{- range $i, $k := $keys }}
+{{ if eq $i 0 }}- {{ else }}  {{ end }}{{ $k }}: {{ index $values (printf "_%d" $i) | quote }}
+{{- end }}
+{{- if $spec }}
+{{ toYaml $spec | indent 2 }}
+{{- end }}
+{{- end }}
 {{- end -}}`
+	return indentActions(helper, o.Style.Indent)
 }
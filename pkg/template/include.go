@@ -0,0 +1,202 @@
+package template
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	filesystem "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/parser"
+)
+
+// dictArgRewrite is a named template whose dict argument renders the lists
+// its callers pass in, e.g. toYaml .env in a define included with
+// (dict "env" .Values.extraEnv)
+type dictArgRewrite struct {
+	Define   string   // Define name of the named template
+	Key      string   // Dict key the list is passed under
+	MergeKey string   // Merge key shared by every path passed in
+	Helper   string   // Helper variant shared by every path passed in
+	Paths    []string // Converted paths passed in, in caller order
+}
+
+// UnhandledDictArg is an include argument that keeps a named template from
+// being rewritten, though other callers pass it converted paths
+type UnhandledDictArg struct {
+	Define string // Define name of the named template
+	Key    string // Dict key the argument is passed under
+	Arg    string // Argument as written (e.g., $env or .Values.extraEnv)
+	Reason string // Why the argument can't be rendered by the rewritten template
+}
+
+// UnhandledDictArgs returns the include arguments that keep named templates
+// rendering converted paths from being rewritten, sorted by template and key
+func UnhandledDictArgs(chartPath string, paths []PathInfo) []UnhandledDictArg {
+	files, _ := readTemplates(filesystem.OSFileSystem{}, chartPath)
+	// Only whether callers agree matters, not the names they'd be rewritten with
+	_, unhandled := planDictArgRewrites(templateContents(files), paths, Options{})
+	return unhandled
+}
+
+// planDictArgRewrites returns the named templates to rewrite for the converted
+// paths. A template is only rewritten when every caller passes a converted
+// path under the key, rendered with the same merge key and helper; otherwise
+// a caller still passing a list would break. A caller whose context can't be
+// followed (e.g., include "app.env" $ctx) might pass anything, so it keeps the
+// template as it is too. The arguments keeping templates that render
+// converted paths from being rewritten are returned too.
+func planDictArgRewrites(contents []string, paths []PathInfo, o Options) ([]dictArgRewrite, []UnhandledDictArg) {
+	converted := make(map[string]PathInfo, len(paths))
+	for _, p := range paths {
+		converted[p.DotPath] = p
+	}
+
+	type site struct{ define, key string }
+	var calls = make(map[site][]parser.IncludeCall)
+	opaque := make(map[string][]string)
+	for _, content := range contents {
+		for _, call := range parser.IncludeCalls(content) {
+			for key := range call.Args {
+				s := site{call.Name, key}
+				calls[s] = append(calls[s], call)
+			}
+		}
+		for _, call := range parser.OpaqueCalls(content) {
+			opaque[call.Name] = append(opaque[call.Name], call.Call)
+		}
+	}
+
+	var plan []dictArgRewrite
+	var unhandled []UnhandledDictArg
+	for s, sc := range calls {
+		r := dictArgRewrite{Define: s.define, Key: s.key}
+		var blocking []UnhandledDictArg
+		for _, call := range sc {
+			path, isValues := call.ValuesPath(s.key)
+			p, ok := converted[path]
+			reason := ""
+			switch {
+			case !isValues:
+				reason = "not a .Values path"
+			case !ok:
+				reason = "not converted"
+			case p.KeyStrategy != "", p.shaped():
+				// Named templates are rewritten with a single merge key
+				reason = "converted with several keys or reshaped entries"
+			case len(r.Paths) == 0:
+				r.MergeKey, r.Helper = p.MergeKey, p.helper(o)
+			case p.MergeKey != r.MergeKey:
+				reason = fmt.Sprintf("converted with key %s, not %s", p.MergeKey, r.MergeKey)
+			case p.helper(o) != r.Helper:
+				reason = "rendered through another helper variant"
+			}
+			if ok {
+				r.Paths = append(r.Paths, path)
+			}
+			if reason != "" {
+				blocking = append(blocking, UnhandledDictArg{Define: s.define, Key: s.key, Arg: call.Args[s.key], Reason: reason})
+			}
+		}
+		for _, call := range opaque[s.define] {
+			blocking = append(blocking, UnhandledDictArg{Define: s.define, Key: s.key, Arg: call, Reason: "a call whose context can't be followed"})
+		}
+		switch {
+		case len(r.Paths) == 0:
+			// No converted path is passed in, so nothing is left behind
+		case len(blocking) > 0:
+			unhandled = append(unhandled, blocking...)
+		default:
+			plan = append(plan, r)
+		}
+	}
+	sort.Slice(plan, func(i, j int) bool {
+		if plan[i].Define != plan[j].Define {
+			return plan[i].Define < plan[j].Define
+		}
+		return plan[i].Key < plan[j].Key
+	})
+	sort.Slice(unhandled, func(i, j int) bool {
+		if unhandled[i].Define != unhandled[j].Define {
+			return unhandled[i].Define < unhandled[j].Define
+		}
+		if unhandled[i].Key != unhandled[j].Key {
+			return unhandled[i].Key < unhandled[j].Key
+		}
+		return unhandled[i].Arg < unhandled[j].Arg
+	})
+	// Callers passing the same argument are reported once
+	return plan, slices.Compact(unhandled)
+}
+
+// applyDictArgRewrites rewrites the planned named templates defined in content
+func applyDictArgRewrites(content string, plan []dictArgRewrite, o Options) string {
+	for _, r := range plan {
+		content = rewriteDefine(content, r.Define, func(body string) string {
+			body, _ = ReplaceDictArgBlocks(body, r.Key, r.MergeKey, r.Helper, o)
+			return body
+		})
+	}
+	return content
+}
+
+// reBlockAction matches the actions that open or close a template block
+var reBlockAction = regexp.MustCompile(`\{\{-?\s*(if|range|with|define|block|end)\b`)
+
+// rewriteDefine applies fn to the body of the define named name in content
+func rewriteDefine(content, name string, fn func(string) string) string {
+	start, end, ok := defineBody(content, name)
+	if !ok {
+		return content
+	}
+	return content[:start] + fn(content[start:end]) + content[end:]
+}
+
+// defineBody returns the offsets of the body of the define named name in
+// content, between the define action and its matching end
+func defineBody(content, name string) (start, end int, ok bool) {
+	reDefine := regexp.MustCompile(`\{\{-?\s*define\s+"` + regexp.QuoteMeta(name) + `"\s*-?\}\}`)
+	loc := reDefine.FindStringIndex(content)
+	if loc == nil {
+		return 0, 0, false
+	}
+	start = loc[1]
+	depth := 1
+	for _, m := range reBlockAction.FindAllStringSubmatchIndex(content[start:], -1) {
+		if content[start+m[2]:start+m[3]] != "end" {
+			depth++
+			continue
+		}
+		depth--
+		if depth == 0 {
+			return start, start + m[0], true
+		}
+	}
+	return 0, 0, false
+}
+
+// ReplaceDictArgBlocks replaces toYaml and toJson calls on a dict argument in
+// a named template's body (e.g., {{- toYaml .env }}) with the listmap helper.
+// The caller places the output, so no indent stage is required.
+func ReplaceDictArgBlocks(body, key, mergeKey, helper string, o Options) (string, bool) {
+	origLen := len(body)
+	k := regexp.QuoteMeta(key)
+
+	replace := func(fn, name string) {
+		re := regexp.MustCompile(`\{\{(-?)\s*(?:` + fn + `\s+\.` + k + `|\.` + k + `\s*\|\s*` + fn + `)` + optionalStages + `\s*(-?)\}\}`)
+		body = re.ReplaceAllStringFunc(body, func(match string) string {
+			submatches := re.FindStringSubmatch(match)
+			stages, _ := parsePipeline(submatches[2])
+			call := fmt.Sprintf(`include %q (dict "items" .%s "key" %q)`, name, key, mergeKey)
+			return fmt.Sprintf(`{{%s %s %s}}`, submatches[1], strings.Join(append([]string{call}, stages...), " | "), submatches[3])
+		})
+	}
+	replace("toYaml", helper)
+	if helper != o.SyntheticHelperName() {
+		// The JSON variant would render the synthetic key
+		replace("toJson", o.JSONHelperName())
+	}
+
+	return body, len(body) != origLen
+}
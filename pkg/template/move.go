@@ -0,0 +1,30 @@
+package template
+
+import (
+	"regexp"
+	"strings"
+)
+
+// reValuesIndex matches an index of .Values by quoted keys: index .Values "a" "b"
+var reValuesIndex = regexp.MustCompile(`(index\s+\$?\.Values)((?:\s+"[^"]*")+)`)
+
+// MoveValuesReferences rewrites the template's references to the values path
+// from, and to the paths under it, to the path to: .Values.from fields and
+// indexes of .Values by from's keys, as the helper calls convert writes use.
+// Returns the updated template and whether any references were rewritten.
+func MoveValuesReferences(tpl, from, to string) (string, bool) {
+	reField := regexp.MustCompile(`(\$?\.Values)\.` + regexp.QuoteMeta(from) + `\b`)
+	updated := reField.ReplaceAllString(tpl, "${1}."+to)
+
+	fromParts := strings.Split(from, ".")
+	updated = reValuesIndex.ReplaceAllStringFunc(updated, func(m string) string {
+		sub := reValuesIndex.FindStringSubmatch(m)
+		parts := unquoteParts(sub[2])
+		if len(parts) < len(fromParts) || strings.Join(parts[:len(fromParts)], ".") != from {
+			return m
+		}
+		moved := append(strings.Split(to, "."), parts[len(fromParts):]...)
+		return sub[1] + " " + QuotePath(strings.Join(moved, "."))
+	})
+	return updated, updated != tpl
+}
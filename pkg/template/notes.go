@@ -0,0 +1,46 @@
+package template
+
+import (
+	"io/fs"
+	"os"
+	"regexp"
+
+	filesystem "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+)
+
+// NotesReference is a chart NOTES.txt that uses converted paths
+type NotesReference struct {
+	Path     string   // relative to the chart root
+	DotPaths []string // the converted paths it uses, in the order of paths
+}
+
+// NotesReferences returns the chart's NOTES.txt files that use any of paths.
+// NOTES.txt is never rewritten, so what it says about them, and any loops
+// over them, need updating by hand.
+func NotesReferences(chartPath string, paths []PathInfo) []NotesReference {
+	var refs []NotesReference
+	_ = filesystem.WalkTemplates(filesystem.OSFileSystem{}, chartPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if !filesystem.IsNotes(path) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		var used []string
+		for _, p := range paths {
+			re := regexp.MustCompile(`\.Values\.` + regexp.QuoteMeta(p.DotPath) + `(?:[^a-zA-Z0-9_.]|$)`)
+			if re.Match(data) {
+				used = append(used, p.DotPath)
+			}
+		}
+		if len(used) > 0 {
+			refs = append(refs, NotesReference{Path: rel(chartPath, path), DotPaths: used})
+		}
+		return nil
+	})
+	return refs
+}
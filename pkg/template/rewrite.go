@@ -9,182 +9,468 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/detect"
 	filesystem "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
 )
 
 // RewriteTemplatesWithBackups rewrites templates and tracks backup files
-func RewriteTemplatesWithBackups(fsys filesystem.FileSystem, chartPath string, paths []PathInfo, backupExtension string, existingBackups []string) ([]string, []string, error) {
+func RewriteTemplatesWithBackups(fsys filesystem.FileSystem, chartPath string, paths []PathInfo, o Options, backupExtension string, existingBackups []string) ([]string, []string, error) {
 	var changed []string
 	backups := existingBackups
-	tdir := filepath.Join(chartPath, "templates")
-	err := fsys.WalkDir(tdir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
-			return err
+	rewrites, err := PreviewTemplateRewrites(fsys, chartPath, paths, o)
+	if err != nil {
+		return nil, backups, err
+	}
+	for _, r := range rewrites {
+		path := filepath.Join(chartPath, r.Path)
+		backupPath := path + backupExtension
+		if err := backupFile(fsys, path, backupExtension, []byte(r.Original)); err != nil {
+			return changed, backups, err
 		}
-		if !strings.HasSuffix(path, ".yaml") && !strings.HasSuffix(path, ".yml") && !strings.HasSuffix(path, ".tpl") {
-			return nil
+		backups = append(backups, backupPath)
+		if err := fsys.WriteFile(path, []byte(r.Updated), filesystem.Mode(fsys, path, 0644)); err != nil {
+			return changed, backups, err
 		}
-		data, err := fsys.ReadFile(path)
-		if err != nil {
-			return err
-		}
-		orig := string(data)
-		newContent := orig
+		changed = append(changed, r.Path)
+	}
+	return changed, backups, nil
+}
+
+// PreviewTemplateRewrites returns the template changes RewriteTemplatesWithBackups
+// would make, without writing any files
+func PreviewTemplateRewrites(fsys filesystem.FileSystem, chartPath string, paths []PathInfo, o Options) ([]TemplateRewrite, error) {
+	files, err := readTemplates(fsys, chartPath)
+	if err != nil {
+		return nil, err
+	}
+	plan, _ := planDictArgRewrites(templateContents(files), paths, o)
 
+	var rewrites []TemplateRewrite
+	for _, f := range files {
+		orig := string(f.data)
+		newContent := string(filesystem.Normalize(f.data))
+
+		// Fragments first, before their toYaml actions are rewritten one by one
+		newContent, _ = ReplaceFragmentBlocks(newContent, paths, o)
 		for _, p := range paths {
 			// Use single generic helper for all conversions
-			newContent, _ = ReplaceListBlocks(newContent, p.DotPath, p.MergeKey, p.SectionName)
+			newContent, _ = replaceListBlocks(newContent, p.DotPath, p.helperArgs(), p.helper(o), o)
+		}
+		newContent, _ = ReplaceConcatBlocks(newContent, paths, o)
+		newContent, _ = ReplaceWrappedBlocks(newContent, paths, o)
+		newContent = applyDictArgRewrites(newContent, plan, o)
+		// Renamed paths last, once the rewrites above have matched the old ones
+		for _, p := range paths {
+			if p.NewPath != "" {
+				newContent, _ = MoveValuesReferences(newContent, p.DotPath, p.NewPath)
+			}
 		}
 
+		// Keep the template's BOM, line endings, and final newline
+		newContent = string(filesystem.MatchFormat(f.data, []byte(newContent)))
 		if newContent != orig {
-			backupPath := path + backupExtension
-			if err := backupFile(fsys, path, backupExtension, data); err != nil {
-				return err
-			}
-			backups = append(backups, backupPath)
-			if err := fsys.WriteFile(path, []byte(newContent), 0644); err != nil {
-				return err
-			}
-			changed = append(changed, rel(chartPath, path))
+			rewrites = append(rewrites, TemplateRewrite{
+				Path:     rel(chartPath, f.path),
+				Original: orig,
+				Updated:  newContent,
+			})
 		}
+	}
+	return rewrites, nil
+}
+
+// templateFile is a chart template read for rewriting
+type templateFile struct {
+	path string
+	data []byte
+}
+
+// readTemplates reads the chart's template files in walk order
+func readTemplates(fsys filesystem.FileSystem, chartPath string) ([]templateFile, error) {
+	var files []templateFile
+	err := filesystem.WalkTemplates(fsys, chartPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if !filesystem.IsTemplate(path) {
+			return nil
+		}
+		data, err := fsys.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, templateFile{path: path, data: data})
 		return nil
 	})
-	return changed, backups, err
+	return files, err
+}
+
+// templateContents returns the contents of files as strings
+func templateContents(files []templateFile) []string {
+	contents := make([]string, len(files))
+	for i, f := range files {
+		contents[i] = string(f.data)
+	}
+	return contents
 }
 
 // ReplaceListBlocks replaces toYaml calls for list fields with the listmap.items helper
 // Parameters:
 //   - dotPath: the .Values path (e.g., "volumes", "deployment.env")
 //   - mergeKey: the patchMergeKey from K8s API (e.g., "name", "mountPath")
-//   - sectionName: unused, kept for compatibility
+//   - o: the helper name and style of the generated code
 //
 // Returns: (updated template content, whether any replacements were made)
-func ReplaceListBlocks(tpl, dotPath, mergeKey, _ string) (string, bool) {
+func ReplaceListBlocks(tpl, dotPath, mergeKey string, o Options) (string, bool) {
+	return ReplaceListBlocksWith(tpl, dotPath, mergeKey, o.Helper(), o)
+}
+
+// ReplaceListBlocksWith is ReplaceListBlocks rendering through the helper
+// define named helper (e.g., OrderedHelperName or ByOrderHelperName for env vars)
+func ReplaceListBlocksWith(tpl, dotPath, mergeKey, helper string, o Options) (string, bool) {
+	return replaceListBlocks(tpl, dotPath, fmt.Sprintf(`"key" %q`, mergeKey), helper, o)
+}
+
+// replaceListBlocks is ReplaceListBlocksWith passing the helper keyArgs, the
+// key arguments of its dict (see PathInfo.helperArgs)
+func replaceListBlocks(tpl, dotPath, keyArgs, helper string, o Options) (string, bool) {
 	origLen := len(tpl)
 	escapedDotPath := regexp.QuoteMeta(dotPath)
+	// The path accessed with index, as templates do for keys that aren't
+	// identifiers: index .Values "weird-key" "env"
+	indexed := indexPattern(dotPath)
 
-	// Helper call generator - just replaces toYaml with our helper, preserving the nindent
-	helperCall := func(indent int) string {
-		return fmt.Sprintf(`{{- include "chart.listmap.items" (dict "items" (index .Values %s) "key" %q) | nindent %d }}`,
-			QuotePath(dotPath), mergeKey, indent)
+	// Helper call generator - replaces toYaml with our helper, keeping the
+	// action's trim markers and the rest of its pipeline, and reading the
+	// values as root, the way the matched action did
+	helperAction := func(open, root string, stages []string, close string) string {
+		return fmt.Sprintf(`{{%s include %q (dict "items" (index %s %s) %s) | %s %s}}`,
+			open, helper, root, QuotePath(dotPath), keyArgs, strings.Join(stages, " | "), close)
+	}
+	// A call on a line of its own: trimmed and nindented, or indented by
+	// the style's choice
+	helperCall := func(indent int, root string) string {
+		if o.Style.NoTrim {
+			return helperAction("", root, []string{fmt.Sprintf("indent %d", indent)}, "")
+		}
+		return helperAction("-", root, []string{fmt.Sprintf("nindent %d", indent)}, "")
 	}
+	trim := o.Style.trim()
 
-	// Pattern 1: {{- toYaml .Values.X | nindent N }}
-	// Direct toYaml with nindent - most common pattern
-	re1 := regexp.MustCompile(`\{\{-?\s*toYaml\s+\.Values\.` + escapedDotPath + `\s*\|\s*nindent\s*(\d+)\s*\}\}`)
+	// Pattern 1: {{- toYaml .Values.X | nindent N }}, or any variant of it:
+	// indent instead of nindent, any width, stages such as trim chained
+	// before or after, the .Values.X | toYaml form, and X accessed with
+	// index. This also covers toYaml inside {{- if .Values.X }} blocks.
+	re1 := regexp.MustCompile(`\{\{(-?)\s*(?:toYaml\s+\.Values\.` + escapedDotPath + `|\.Values\.` + escapedDotPath + `\s*\|\s*toYaml|toYaml\s+\(\s*` + indexed + `\s*\)|\(?\s*` + indexed + `\s*\)?\s*\|\s*toYaml)` + pipelineStages + `\s*(-?)\}\}`)
 	tpl = re1.ReplaceAllStringFunc(tpl, func(match string) string {
 		submatches := re1.FindStringSubmatch(match)
-		if len(submatches) > 1 {
-			indent, _ := strconv.Atoi(submatches[1])
-			return helperCall(indent)
+		stages, ok := parsePipeline(submatches[2])
+		if !ok {
+			return match
 		}
-		return match
+		return helperAction(submatches[1], valuesRoot(match), stages, submatches[3])
 	})
 
-	// Pattern 2: {{ toYaml .Values.X | indent N }}
-	// toYaml with indent (no leading dash, no 'n' prefix)
-	re2 := regexp.MustCompile(`\{\{\s*toYaml\s+\.Values\.` + escapedDotPath + `\s*\|\s*indent\s*(\d+)\s*\}\}`)
-	tpl = re2.ReplaceAllStringFunc(tpl, func(match string) string {
-		submatches := re2.FindStringSubmatch(match)
-		if len(submatches) > 1 {
-			indent, _ := strconv.Atoi(submatches[1])
-			// indent doesn't add newline, but our helper expects nindent
-			// Use nindent with same value (adds leading newline which is usually desired)
-			return helperCall(indent)
+	// Pattern 1b: {{ toJson .Values.X }} or {{ .Values.X | toJson }}, with any
+	// literal stages after it (e.g., | quote), rendered by the JSON variant.
+	// The JSON variant takes a single key only and renders it in each item,
+	// so multi-key, reshaped, and synthetically keyed maps are left alone.
+	reJSON := regexp.MustCompile(`\{\{(-?)\s*(?:toJson\s+\.Values\.` + escapedDotPath + `|\.Values\.` + escapedDotPath + `\s*\|\s*toJson|toJson\s+\(\s*` + indexed + `\s*\)|\(?\s*` + indexed + `\s*\)?\s*\|\s*toJson)` + optionalStages + `\s*(-?)\}\}`)
+	tpl = reJSON.ReplaceAllStringFunc(tpl, func(match string) string {
+		if !reSingleKeyArg.MatchString(keyArgs) || helper == o.SyntheticHelperName() {
+			return match
 		}
-		return match
+		submatches := reJSON.FindStringSubmatch(match)
+		stages, _ := parsePipeline(submatches[2])
+		call := fmt.Sprintf(`include %q (dict "items" (index %s %s) %s)`, o.JSONHelperName(), valuesRoot(match), QuotePath(dotPath), keyArgs)
+		return fmt.Sprintf(`{{%s %s %s}}`, submatches[1], strings.Join(append([]string{call}, stages...), " | "), submatches[3])
 	})
 
-	// Pattern 3: {{- with .Values.X }}...{{- toYaml . | nindent N }}...{{- end }}
+	// Pattern 2: {{- with .Values.X }}...{{- toYaml . | nindent N }}...{{- end }}
 	// "with" block pattern - replace the whole block, preserving leading whitespace
-	re3 := regexp.MustCompile(`(?ms)([ \t]*)\{\{-?\s*with\s+\.Values\.` + escapedDotPath + `\s*\}\}\s*(\S+):\s*\n\s*\{\{-?\s*toYaml\s+\.\s*\|\s*nindent\s*(\d+)\s*\}\}\s*\{\{-?\s*end\s*\}\}`)
-	tpl = re3.ReplaceAllStringFunc(tpl, func(match string) string {
-		submatches := re3.FindStringSubmatch(match)
-		if len(submatches) > 3 {
-			leadingSpace := submatches[1]
-			sectionName := submatches[2]
-			indent, _ := strconv.Atoi(submatches[3])
-			// Keep the section name with proper indentation
-			return fmt.Sprintf(`%s{{- if (index .Values %s) }}
-%s%s:
-%s
-%s{{- end }}`, leadingSpace, QuotePath(dotPath), leadingSpace, sectionName, helperCall(indent), leadingSpace)
-		}
-		return match
-	})
-
-	// Pattern 4: {{- if .Values.X }}\n  section:\n...toYaml...{{- end }}
-	// Conditional block with section - replace toYaml inside
-	re4 := regexp.MustCompile(`(?ms)(\{\{-?\s*if\s+\.Values\.` + escapedDotPath + `\s*\}\}\s*\n\s*\S+:\s*\n\s*)\{\{-?\s*toYaml\s+\.Values\.` + escapedDotPath + `\s*\|\s*nindent\s*(\d+)\s*\}\}(\s*\n\{\{-?\s*end\s*\}\})`)
-	tpl = re4.ReplaceAllStringFunc(tpl, func(match string) string {
-		submatches := re4.FindStringSubmatch(match)
-		if len(submatches) > 3 {
-			prefix := submatches[1]
-			indent, _ := strconv.Atoi(submatches[2])
-			suffix := submatches[3]
-			return prefix + helperCall(indent) + suffix
+	re2 := regexp.MustCompile(`(?ms)([ \t]*)\{\{-?\s*with\s+(?:\.Values\.` + escapedDotPath + `|\(?\s*` + indexed + `\s*\)?)\s*\}\}\s*(\S+):\s*\n([ \t]*)\{\{(-?)\s*toYaml\s+\.` + pipelineStages + `\s*(-?)\}\}\s*\{\{-?\s*end\s*\}\}`)
+	tpl = re2.ReplaceAllStringFunc(tpl, func(match string) string {
+		submatches := re2.FindStringSubmatch(match)
+		stages, ok := parsePipeline(submatches[5])
+		if !ok {
+			return match
 		}
-		return match
+		leadingSpace := submatches[1]
+		sectionName := submatches[2]
+		actionSpace := o.Style.actionIndent(leadingSpace, leadingSpace)
+		// Keep the section name and the action's own indentation, which
+		// matters for indent (the line is not trimmed)
+		root := valuesRoot(match)
+		return fmt.Sprintf(`%s{{%s if (index %s %s) }}
+%s%s:
+%s%s
+%s{{%s end }}`, actionSpace, trim, root, QuotePath(dotPath), leadingSpace, sectionName, submatches[3], helperAction(submatches[4], root, stages, submatches[6]), actionSpace, trim)
 	})
 
-	// Pattern 5: {{- range .Values.X }}...{{- end }}
+	// Pattern 3: {{- range .Values.X }}...{{- end }}
 	// Range loop pattern - capture the indent from context
-	re5 := regexp.MustCompile(`(?ms)([ \t]*)(\S+):\s*\n\s*\{\{-?\s*range\s+\.Values\.` + escapedDotPath + `\s*\}\}.*?\{\{-?\s*end\s*\}\}`)
-	tpl = re5.ReplaceAllStringFunc(tpl, func(match string) string {
-		submatches := re5.FindStringSubmatch(match)
+	re3 := regexp.MustCompile(`(?ms)([ \t]*)(\S+):\s*\n\s*\{\{-?\s*range\s+\.Values\.` + escapedDotPath + `\s*\}\}.*?\{\{-?\s*end\s*\}\}`)
+	tpl = re3.ReplaceAllStringFunc(tpl, func(match string) string {
+		submatches := re3.FindStringSubmatch(match)
 		if len(submatches) > 2 {
 			leadingSpace := submatches[1]
 			sectionName := submatches[2]
 			indent := len(leadingSpace) + 2 // section indent + 2 for list items
-			return fmt.Sprintf(`{{- if (index .Values %s) }}
+			actionSpace := o.Style.actionIndent(leadingSpace, "")
+			return fmt.Sprintf(`%s{{%s if (index .Values %s) }}
 %s%s:
 %s
-{{- end }}`, QuotePath(dotPath), leadingSpace, sectionName, helperCall(indent))
+%s{{%s end }}`, actionSpace, trim, QuotePath(dotPath), leadingSpace, sectionName, helperCall(indent, ".Values"), actionSpace, trim)
 		}
 		return match
 	})
 
-	// Pattern 6: Existing old-style helper calls - update to new format
-	re6 := regexp.MustCompile(`\{\{-?\s*include\s+"chart\.\S+\.render"\s*\(dict\s+"\S+"\s*\(index\s+\.Values\s+` + regexp.QuoteMeta(QuotePath(dotPath)) + `\)\)\s*\}\}`)
-	if re6.MatchString(tpl) {
-		// Just mark as changed - these need manual review since we don't know the indent
-		tpl = re6.ReplaceAllString(tpl, helperCall(8)) // Default indent
-	}
+	// Pattern 4: Existing old-style helper calls - update to new format
+	re4 := regexp.MustCompile(`\{\{-?\s*include\s+"chart\.\S+\.render"\s*\(dict\s+"\S+"\s*\(index\s+\$?\.Values\s+` + regexp.QuoteMeta(QuotePath(dotPath)) + `\)\)\s*\}\}`)
+	// Just mark as changed - these need manual review since we don't know
+	// the indent, so the default is used
+	tpl = re4.ReplaceAllStringFunc(tpl, func(match string) string {
+		return helperCall(8, valuesRoot(match))
+	})
 
 	changed := len(tpl) != origLen
 	return tpl, changed
 }
 
+// valuesRoot returns how ref, a matched reference to values, reaches them:
+// $.Values when read through $, as inside range and with blocks where dot is
+// rebound, or else .Values. Rewrites emit the same, so they still render there.
+func valuesRoot(ref string) string {
+	if strings.Contains(ref, "$.Values") {
+		return "$.Values"
+	}
+	return ".Values"
+}
+
+// indexPattern matches index .Values called with the keys of dotPath, e.g.
+// index .Values "weird-key" "env" for weird-key.env
+func indexPattern(dotPath string) string {
+	pattern := `index\s+\$?\.Values`
+	for _, part := range strings.Split(dotPath, ".") {
+		pattern += `\s+` + regexp.QuoteMeta(strconv.Quote(part))
+	}
+	return pattern
+}
+
+// reSingleKeyArg matches helper key arguments naming only the merge key
+var reSingleKeyArg = regexp.MustCompile(`^"key" "[^"]*"$`)
+
+// pipelineStages matches the stages piped after the list value in a toYaml
+// action: functions with literal arguments, such as indent, nindent, trim or
+// trimSuffix "\n", chained in any order
+const pipelineStages = `((?:\s*\|\s*[a-zA-Z]+(?:\s+(?:\d+|"(?:[^"\\]|\\.)*"))*)+)`
+
+// optionalStages is pipelineStages allowing no stages at all
+const optionalStages = pipelineStages + `?`
+
+// reIndentStage matches a pipeline stage that indents the rendered list
+var reIndentStage = regexp.MustCompile(`^n?indent\s+\d+$`)
+
+// parsePipeline splits the stages matched by pipelineStages. The list must be
+// indented by one of them, or it cannot be placed in the surrounding YAML.
+func parsePipeline(tail string) ([]string, bool) {
+	var stages []string
+	indented := false
+	for _, stage := range strings.Split(tail, "|")[1:] {
+		stage = strings.TrimSpace(stage)
+		if reIndentStage.MatchString(stage) {
+			indented = true
+		}
+		stages = append(stages, stage)
+	}
+	return stages, indented
+}
+
 // CheckTemplatePatterns checks which paths have matching template patterns without modifying files
 // Returns a map of dotPath -> true if the path has a matching template pattern
 func CheckTemplatePatterns(chartPath string, paths []PathInfo) map[string]bool {
+	// Only whether the patterns match matters, not the names or style they'd
+	// be rewritten with
+	var o Options
 	matched := make(map[string]bool)
-	tdir := filepath.Join(chartPath, "templates")
-	_ = filepath.WalkDir(tdir, func(path string, d fs.DirEntry, err error) error {
+	files, _ := readTemplates(filesystem.OSFileSystem{}, chartPath)
+	contents := templateContents(files)
+	for _, content := range contents {
+		for _, p := range paths {
+			if matched[p.DotPath] {
+				continue // Already found a match
+			}
+			_, changed := replaceListBlocks(content, p.DotPath, p.helperArgs(), p.helper(o), o)
+			if changed {
+				matched[p.DotPath] = true
+			}
+		}
+	}
+
+	// Paths rendered as fragments of one list
+	for _, content := range contents {
+		_, rewritten := replaceFragments(content, paths, o)
+		for _, p := range rewritten {
+			matched[p] = true
+		}
+	}
+
+	// Paths composed with concat, or read from merged dicts
+	for _, content := range contents {
+		for _, m := range reConcatAction.FindAllStringSubmatch(content, -1) {
+			if _, ok := ReplaceConcatBlocks(m[0], paths, o); !ok {
+				continue
+			}
+			for _, s := range composedArgs(m[2]+m[3], "") {
+				matched[s.path] = true
+			}
+		}
+		for _, m := range reMergeAction.FindAllStringSubmatch(content, -1) {
+			if _, ok := ReplaceConcatBlocks(m[0], paths, o); !ok {
+				continue
+			}
+			for _, s := range composedArgs(m[3]+m[6], m[4]+m[7]) {
+				matched[s.path] = true
+			}
+		}
+	}
+
+	// Paths wrapped by required or coalesce
+	for _, content := range contents {
+		for _, m := range reRequiredAction.FindAllStringSubmatch(content, -1) {
+			if _, ok := ReplaceWrappedBlocks(m[0], paths, o); ok {
+				matched[m[3]+m[5]] = true
+			}
+		}
+		for _, m := range reCoalesceAction.FindAllStringSubmatch(content, -1) {
+			if _, ok := ReplaceWrappedBlocks(m[0], paths, o); !ok {
+				continue
+			}
+			for _, arg := range reConcatValuesArg.FindAllStringSubmatch(m[2]+m[3], -1) {
+				matched[arg[1]] = true
+			}
+		}
+	}
+
+	// Paths passed into named templates that render them
+	plan, _ := planDictArgRewrites(contents, paths, o)
+	for _, r := range plan {
+		for _, content := range contents {
+			if applyDictArgRewrites(content, []dictArgRewrite{r}, o) == content {
+				continue
+			}
+			for _, p := range r.Paths {
+				matched[p] = true
+			}
+		}
+	}
+	return matched
+}
+
+// reHelperCall matches the helper invocations written by ReplaceListBlocks,
+// capturing the helper name, the quoted .Values path components, and the merge
+// key or the quoted merge keys of a multi-key map
+var reHelperCall = regexp.MustCompile(`include\s+"([^"]+)"\s+\(dict\s+"items"\s+\(index\s+\$?\.Values((?:\s+"[^"]*")+)\)\s+` + helperKeyArgs + `\)`)
+
+// reMergedHelperCall matches the helper invocations written by
+// ReplaceConcatBlocks, capturing the helper name, the index calls of the
+// merged sources and the merge key or keys
+var reMergedHelperCall = regexp.MustCompile(`include\s+"([^"]+)"\s+\(dict\s+"sources"\s+\(list((?:\s+\(index\s+\$?\.Values(?:\s+"[^"]*")+\))+)\)\s+` + helperKeyArgs + `\)`)
+
+// reDeepMergedHelperCall is reMergedHelperCall for the calls written before
+// helper version 12, which deep-merged the maps with merge, latest first
+var reDeepMergedHelperCall = regexp.MustCompile(`include\s+"([^"]+)"\s+\(dict\s+"items"\s+\(merge\s+\(dict\)((?:\s+\(deepCopy\s+\(index\s+\$?\.Values(?:\s+"[^"]*")+\)\))+)\)\s+` + helperKeyArgs + `\)`)
+
+// reWrappedHelperCall matches the helper invocations written by
+// ReplaceWrappedBlocks, capturing the helper name, the index calls wrapped by
+// required or coalesce, and the merge key or keys
+var reWrappedHelperCall = regexp.MustCompile(`include\s+"([^"]+)"\s+\(dict\s+"items"\s+\((?:required\s+"(?:[^"\\]|\\.)*"|coalesce)((?:\s+\(index\s+\$?\.Values(?:\s+"[^"]*")+\))+)\)\s+` + helperKeyArgs + `\)`)
+
+// helperKeyArgs matches the key arguments of a helper call, capturing the
+// merge key, the quoted keys of a multi-key map, and the entry shape arguments
+// of a reshaped map: the scalar field, and the quoted rename dict pairs
+const helperKeyArgs = `(?:"key"\s+"([^"]+)"|"keys"\s+\(list((?:\s+"[^"]*")+)\))(?:\s+"scalar"\s+"([^"]*)")?(?:\s+"rename"\s+\(dict((?:\s+"[^"]*")*)\))?`
+
+// reMergedIndex matches one merged index call, capturing its quoted path components
+var reMergedIndex = regexp.MustCompile(`\(index\s+\$?\.Values((?:\s+"[^"]*")+)\)`)
+
+// reQuotedPart matches one quoted component of a QuotePath result
+var reQuotedPart = regexp.MustCompile(`"([^"]*)"`)
+
+// ConvertedPaths returns the paths already rendered through the list-map helper
+// in the chart's templates, i.e. the paths a previous conversion turned into maps
+func ConvertedPaths(chartPath string) []PathInfo {
+	var paths []PathInfo
+	seen := make(map[string]bool)
+	_ = filesystem.WalkTemplates(filesystem.OSFileSystem{}, chartPath, func(path string, d fs.DirEntry, err error) error {
 		if err != nil || d.IsDir() {
 			return err
 		}
-		if !strings.HasSuffix(path, ".yaml") && !strings.HasSuffix(path, ".yml") && !strings.HasSuffix(path, ".tpl") {
+		if !filesystem.IsTemplate(path) {
 			return nil
 		}
 		data, err := os.ReadFile(path)
 		if err != nil {
 			return nil
 		}
-		content := string(data)
-
-		for _, p := range paths {
-			if matched[p.DotPath] {
-				continue // Already found a match
+		add := func(helper, quoted, mergeKey, quotedKeys, scalar, quotedRename string) {
+			parts := unquoteParts(quoted)
+			dotPath := strings.Join(parts, ".")
+			if seen[dotPath] {
+				return
 			}
-			_, changed := ReplaceListBlocks(content, p.DotPath, p.MergeKey, p.SectionName)
-			if changed {
-				matched[p.DotPath] = true
+			seen[dotPath] = true
+			p := PathInfo{
+				DotPath:     dotPath,
+				MergeKey:    mergeKey,
+				SectionName: parts[len(parts)-1],
+				Ordered:     strings.HasSuffix(helper, ".ordered"),
+				OrderField:  strings.HasSuffix(helper, ".byorder"),
+				Set:         strings.HasSuffix(helper, ".set"),
+				Synthetic:   strings.HasSuffix(helper, ".synthetic"),
+			}
+			if keys := unquoteParts(quotedKeys); len(keys) > 0 {
+				p.MergeKey, p.MergeKeys = keys[0], keys
+				p.KeyStrategy = detect.KeyStrategyNested
+				if strings.HasSuffix(helper, "."+detect.KeyStrategyComposite) {
+					p.KeyStrategy = detect.KeyStrategyComposite
+				}
+			}
+			p.Scalar = scalar
+			if pairs := unquoteParts(quotedRename); len(pairs) > 0 {
+				// The call maps entry fields back to item fields
+				p.Rename = make(map[string]string, len(pairs)/2)
+				for i := 0; i+1 < len(pairs); i += 2 {
+					p.Rename[pairs[i+1]] = pairs[i]
+				}
+			}
+			paths = append(paths, p)
+		}
+		for _, m := range reHelperCall.FindAllStringSubmatch(string(data), -1) {
+			add(m[1], m[2], m[3], m[4], m[5], m[6])
+		}
+		// Paths written by ReplaceConcatBlocks and ReplaceFragmentBlocks, and
+		// by their deep-merging calls of older versions, latest first
+		for _, m := range reMergedHelperCall.FindAllStringSubmatch(string(data), -1) {
+			for _, index := range reMergedIndex.FindAllStringSubmatch(m[2], -1) {
+				add(m[1], index[1], m[3], m[4], m[5], m[6])
+			}
+		}
+		for _, m := range reDeepMergedHelperCall.FindAllStringSubmatch(string(data), -1) {
+			indexes := reMergedIndex.FindAllStringSubmatch(m[2], -1)
+			for i := len(indexes) - 1; i >= 0; i-- {
+				add(m[1], indexes[i][1], m[3], m[4], m[5], m[6])
+			}
+		}
+		// Paths written by ReplaceWrappedBlocks
+		for _, m := range reWrappedHelperCall.FindAllStringSubmatch(string(data), -1) {
+			for _, index := range reMergedIndex.FindAllStringSubmatch(m[2], -1) {
+				add(m[1], index[1], m[3], m[4], m[5], m[6])
 			}
 		}
 		return nil
 	})
-	return matched
+	return paths
 }
 
 // QuotePath converts a dotted path to quoted index format
@@ -198,13 +484,29 @@ func QuotePath(dotPath string) string {
 	return strings.Join(quoted, " ")
 }
 
+// rel returns p relative to root with forward slashes, or p itself if it
+// cannot be made relative
 func rel(root, p string) string {
 	if r, err := filepath.Rel(root, p); err == nil {
-		return r
+		return filepath.ToSlash(r)
 	}
 	return p
 }
 
 func backupFile(fsys filesystem.FileSystem, path, ext string, original []byte) error {
-	return fsys.WriteFile(path+ext, original, 0644)
+	mode := filesystem.Mode(fsys, path, 0644)
+	if err := fsys.WriteFile(path+ext, original, mode); err != nil {
+		return err
+	}
+	// An existing backup keeps its own mode, and the umask may have masked bits
+	return fsys.Chmod(path+ext, mode)
+}
+
+// unquoteParts returns the components of a QuotePath or keysArg result
+func unquoteParts(quoted string) []string {
+	var parts []string
+	for _, q := range reQuotedPart.FindAllStringSubmatch(quoted, -1) {
+		parts = append(parts, q[1])
+	}
+	return parts
 }
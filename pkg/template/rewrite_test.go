@@ -1,8 +1,24 @@
 package template
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
+	gotemplate "text/template"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/detect"
+	filesystem "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+	"gopkg.in/yaml.v3"
 )
 
 func TestReplaceListBlocks(t *testing.T) {
@@ -29,7 +45,7 @@ func TestReplaceListBlocks(t *testing.T) {
 			template: `{{ toYaml .Values.env | nindent 8 }}`,
 			dotPath:  "env",
 			mergeKey: "name",
-			want:     `{{- include "chart.listmap.items" (dict "items" (index .Values "env") "key" "name") | nindent 8 }}`,
+			want:     `{{ include "chart.listmap.items" (dict "items" (index .Values "env") "key" "name") | nindent 8 }}`,
 			changed:  true,
 		},
 		{
@@ -41,15 +57,15 @@ func TestReplaceListBlocks(t *testing.T) {
 			changed:  true,
 		},
 		{
-			name:     "pattern 2: toYaml with indent (no n prefix)",
+			name:     "pattern 1: toYaml with indent (no n prefix)",
 			template: `{{ toYaml .Values.volumes | indent 8 }}`,
 			dotPath:  "volumes",
 			mergeKey: "name",
-			want:     `{{- include "chart.listmap.items" (dict "items" (index .Values "volumes") "key" "name") | nindent 8 }}`,
+			want:     `{{ include "chart.listmap.items" (dict "items" (index .Values "volumes") "key" "name") | indent 8 }}`,
 			changed:  true,
 		},
 		{
-			name:     "pattern 5: range loop",
+			name:     "pattern 3: range loop",
 			template: "spec:\n  volumes:\n    {{- range .Values.volumes }}\n    - name: {{ .name }}\n    {{- end }}",
 			dotPath:  "volumes",
 			mergeKey: "name",
@@ -101,7 +117,7 @@ func TestReplaceListBlocks(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, changed := ReplaceListBlocks(tt.template, tt.dotPath, tt.mergeKey, "")
+			got, changed := ReplaceListBlocks(tt.template, tt.dotPath, tt.mergeKey, Options{})
 			if changed != tt.changed {
 				t.Errorf("ReplaceListBlocks() changed = %v, want %v", changed, tt.changed)
 			}
@@ -120,6 +136,65 @@ func TestReplaceListBlocks(t *testing.T) {
 	}
 }
 
+func TestReplaceListBlocksPipelineVariants(t *testing.T) {
+	t.Parallel()
+
+	const call = `include "chart.listmap.items" (dict "items" (index .Values "env") "key" "name")`
+	tests := []struct {
+		template string
+		want     string // Empty if the template must be left alone
+	}{
+		{`{{- toYaml .Values.env | nindent 12 }}`, `{{- ` + call + ` | nindent 12 }}`},
+		{`{{ toYaml .Values.env | nindent 2 }}`, `{{ ` + call + ` | nindent 2 }}`},
+		{`{{ toYaml .Values.env | indent 8 }}`, `{{ ` + call + ` | indent 8 }}`},
+		{`{{- toYaml .Values.env | indent 10 }}`, `{{- ` + call + ` | indent 10 }}`},
+		{`{{- toYaml .Values.env | nindent 6 -}}`, `{{- ` + call + ` | nindent 6 -}}`},
+		{`{{toYaml .Values.env|nindent 4}}`, `{{ ` + call + ` | nindent 4 }}`},
+		{`{{- toYaml .Values.env | trim | nindent 4 }}`, `{{- ` + call + ` | trim | nindent 4 }}`},
+		{`{{- toYaml .Values.env | nindent 4 | trimSuffix "\n" }}`, `{{- ` + call + ` | nindent 4 | trimSuffix "\n" }}`},
+		{`{{- toYaml .Values.env | trimSuffix "\n" | indent 4 }}`, `{{- ` + call + ` | trimSuffix "\n" | indent 4 }}`},
+		{`{{- .Values.env | toYaml | nindent 8 }}`, `{{- ` + call + ` | nindent 8 }}`},
+		{`{{ .Values.env | toYaml | trim | indent 6 }}`, `{{ ` + call + ` | trim | indent 6 }}`},
+		// Without an indent stage the list can't be placed in the surrounding YAML
+		{`{{ toYaml .Values.env }}`, ""},
+		{`{{ toYaml .Values.env | quote }}`, ""},
+		{`{{ toYaml .Values.envFrom | nindent 4 }}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			t.Parallel()
+
+			got, changed := ReplaceListBlocks(tt.template, "env", "name", Options{})
+			if tt.want == "" {
+				if changed || got != tt.template {
+					t.Errorf("ReplaceListBlocks() = %q, want it unchanged", got)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ReplaceListBlocks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceListBlocksWithIndent(t *testing.T) {
+	template := `{{- with .Values.env }}
+env:
+  {{ toYaml . | indent 4 }}
+{{- end }}`
+
+	got, changed := ReplaceListBlocks(template, "env", "name", Options{})
+	want := `{{- if (index .Values "env") }}
+env:
+  {{ include "chart.listmap.items" (dict "items" (index .Values "env") "key" "name") | indent 4 }}
+{{- end }}`
+	if !changed || got != want {
+		t.Errorf("ReplaceListBlocks() = %q, want %q", got, want)
+	}
+}
+
 func TestReplaceListBlocksWithContext(t *testing.T) {
 	// Test pattern 3: with block pattern
 	template := `{{- with .Values.env }}
@@ -127,7 +202,7 @@ env:
   {{- toYaml . | nindent 12 }}
 {{- end }}`
 
-	got, changed := ReplaceListBlocks(template, "env", "name", "")
+	got, changed := ReplaceListBlocks(template, "env", "name", Options{})
 	if !changed {
 		t.Error("Expected template to be changed")
 	}
@@ -136,6 +211,61 @@ env:
 	}
 }
 
+func TestReplaceListBlocksIndexed(t *testing.T) {
+	t.Parallel()
+
+	want := `{{- include "chart.listmap.items" (dict "items" (index .Values "weird-key" "env") "key" "name") | nindent 12 }}`
+	// Read through $, the rewrite reads through it too
+	wantRoot := strings.Replace(want, "index .Values", "index $.Values", 1)
+	for tpl, want := range map[string]string{
+		`{{- toYaml (index .Values "weird-key" "env") | nindent 12 }}`:   want,
+		`{{- index $.Values "weird-key" "env" | toYaml | nindent 12 }}`:  wantRoot,
+		`{{- (index .Values "weird-key" "env") | toYaml | nindent 12 }}`: want,
+		`{{- toYaml (index $.Values "weird-key" "env") | nindent 12 }}`:  wantRoot,
+	} {
+		if got, _ := ReplaceListBlocks(tpl, "weird-key.env", "name", Options{}); got != want {
+			t.Errorf("ReplaceListBlocks(%q) =\n%s\nwant\n%s", tpl, got, want)
+		}
+	}
+
+	// Another path under the same key is left alone
+	other := `{{- toYaml (index .Values "weird-key" "env" "extra") | nindent 12 }}`
+	if got, changed := ReplaceListBlocks(other, "weird-key.env", "name", Options{}); changed {
+		t.Errorf("ReplaceListBlocks(%q) = %s, want unchanged", other, got)
+	}
+
+	with := `      {{- with (index .Values "weird-key" "env") }}
+      env:
+        {{- toYaml . | nindent 8 }}
+      {{- end }}`
+	got, _ := ReplaceListBlocks(with, "weird-key.env", "name", Options{})
+	if !strings.Contains(got, `{{- if (index .Values "weird-key" "env") }}`) || !strings.Contains(got, `(dict "items" (index .Values "weird-key" "env") "key" "name")`) {
+		t.Errorf("expected the with block on an indexed path to be rewritten, got:\n%s", got)
+	}
+}
+
+// TestReplaceListBlocksIndexedInRange renders lists indexed through $ inside
+// a range, where dot is the item rather than the chart's root
+func TestReplaceListBlocksIndexedInRange(t *testing.T) {
+	t.Parallel()
+
+	values := "containers:\n  - name: app\nweird-key:\n  env:\n    FOO:\n      value: bar\n"
+	for _, block := range []string{
+		"  env:\n    {{- index $.Values \"weird-key\" \"env\" | toYaml | nindent 4 }}",
+		"  {{- with (index $.Values \"weird-key\" \"env\") }}\n  env:\n    {{- toYaml . | nindent 4 }}\n  {{- end }}",
+	} {
+		tpl := "{{- range .Values.containers }}\n- name: {{ .name }}\n" + block + "\n{{- end }}\n"
+		got, changed := ReplaceListBlocks(tpl, "weird-key.env", "name", Options{})
+		if !changed || strings.Contains(got, "index .Values") {
+			t.Errorf("ReplaceListBlocks(%q) should read the list through $:\n%s", block, got)
+			continue
+		}
+		if out := renderRewritten(t, got, values); !strings.Contains(out, "- name: \"FOO\"\n      value: bar") {
+			t.Errorf("rendered %q as:\n%s", block, out)
+		}
+	}
+}
+
 func TestReplaceListBlocksPreservesUnrelated(t *testing.T) {
 	// Template with multiple sections, only one should be modified
 	template := `spec:
@@ -147,7 +277,7 @@ func TestReplaceListBlocksPreservesUnrelated(t *testing.T) {
         {{- toYaml .Values.volumeMounts | nindent 12 }}`
 
 	// Only replace env
-	got, changed := ReplaceListBlocks(template, "env", "name", "")
+	got, changed := ReplaceListBlocks(template, "env", "name", Options{})
 	if !changed {
 		t.Error("Expected template to be changed")
 	}
@@ -164,7 +294,7 @@ func TestReplaceListBlocksPreservesUnrelated(t *testing.T) {
 }
 
 func TestListMapHelperContent(t *testing.T) {
-	helper := ListMapHelper()
+	helper := Options{}.ListMapHelper()
 
 	// Verify it's a valid Go template definition
 	if !strings.Contains(helper, "{{- define") {
@@ -190,6 +320,567 @@ func TestListMapHelperContent(t *testing.T) {
 	if !strings.Contains(helper, "toYaml $spec") {
 		t.Error("Helper should use toYaml for spec values")
 	}
+
+	// Verify it records its version and the command refreshing it
+	if got := ParseHelperVersion(helper); got != HelperVersion {
+		t.Errorf("ParseHelperVersion(Options{}.ListMapHelper()) = %d, want %d", got, HelperVersion)
+	}
+	if !strings.Contains(helper, "Refresh with 'helm list-to-map upgrade-helpers'.") {
+		t.Error("Helper header should name the upgrade-helpers command")
+	}
+}
+
+// helmFuncs implements the Helm template functions the generated helper uses
+var helmFuncs = gotemplate.FuncMap{
+	"keys": func(m map[string]interface{}) []string {
+		var keys []string
+		for k := range m {
+			keys = append(keys, k)
+		}
+		return keys
+	},
+	"sortAlpha": func(s []string) []string { sort.Strings(s); return s },
+	"get":       func(m map[string]interface{}, k string) interface{} { return m[k] },
+	"hasKey":    func(m map[string]interface{}, k string) bool { _, ok := m[k]; return ok },
+	"set":       func(m map[string]interface{}, k string, v interface{}) map[string]interface{} { m[k] = v; return m },
+	"dict": func(kv ...interface{}) map[string]interface{} {
+		m := map[string]interface{}{}
+		for i := 0; i+1 < len(kv); i += 2 {
+			m[kv[i].(string)] = kv[i+1]
+		}
+		return m
+	},
+	// merge keeps the destination's values and merges nested maps field by
+	// field, like sprig's merge
+	"merge": func(dst map[string]interface{}, srcs ...map[string]interface{}) map[string]interface{} {
+		for _, src := range srcs {
+			deepMerge(dst, src)
+		}
+		return dst
+	},
+	"toJson": func(v interface{}) string {
+		out, _ := json.Marshal(v)
+		return string(out)
+	},
+	// default treats empty values like sprig's default: nil, empty lists and maps
+	"default": func(d, v interface{}) interface{} {
+		if v == nil || reflect.ValueOf(v).Len() == 0 {
+			return d
+		}
+		return v
+	},
+	"required": func(msg string, v interface{}) (interface{}, error) {
+		if v == nil {
+			return nil, fmt.Errorf("%s", msg)
+		}
+		return v, nil
+	},
+	"coalesce": func(vs ...interface{}) interface{} {
+		for _, v := range vs {
+			if v != nil && reflect.ValueOf(v).Len() > 0 {
+				return v
+			}
+		}
+		return nil
+	},
+	"list":   func(v ...interface{}) []interface{} { return v },
+	"append": func(l []interface{}, v interface{}) []interface{} { return append(l, v) },
+	"until": func(n int) []int {
+		s := make([]int, n)
+		for i := range s {
+			s[i] = i
+		}
+		return s
+	},
+	"kindIs": func(kind string, v interface{}) bool {
+		if v == nil {
+			return kind == "invalid"
+		}
+		return reflect.TypeOf(v).Kind().String() == kind
+	},
+	"int": func(v interface{}) int { i, _ := v.(int); return i },
+	"omit": func(m map[string]interface{}, k string) map[string]interface{} {
+		out := make(map[string]interface{}, len(m))
+		for key, v := range m {
+			if key != k {
+				out[key] = v
+			}
+		}
+		return out
+	},
+	"regexFindAll": func(re, s string, n int) []string { return regexp.MustCompile(re).FindAllString(s, n) },
+	"regexMatch":   func(re, s string) bool { return regexp.MustCompile(re).MatchString(s) },
+	"regexReplaceAll": func(re, s, repl string) string {
+		return regexp.MustCompile(re).ReplaceAllString(s, repl)
+	},
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"quote":      func(s string) string { return strconv.Quote(s) },
+	"toYaml": func(v interface{}) string {
+		out, _ := yaml.Marshal(v)
+		return strings.TrimSuffix(string(out), "\n")
+	},
+	"indent": func(n int, s string) string {
+		pad := strings.Repeat(" ", n)
+		return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+	},
+	"nindent": func(n int, s string) string {
+		pad := strings.Repeat(" ", n)
+		return "\n" + pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+	},
+	"splitn": func(sep string, n int, s string) map[string]interface{} {
+		m := map[string]interface{}{}
+		for i, part := range strings.SplitN(s, sep, n) {
+			m[fmt.Sprintf("_%d", i)] = part
+		}
+		return m
+	},
+	// include is bound to the parsed template by parseHelper, as Helm does
+	"include": func(string, interface{}) (string, error) { return "", fmt.Errorf("include: template not bound") },
+}
+
+// deepMerge sets the fields of src missing from dst, merging maps set in both
+func deepMerge(dst, src map[string]interface{}) {
+	for k, v := range src {
+		d, ok := dst[k]
+		if !ok {
+			dst[k] = v
+			continue
+		}
+		dm, dok := d.(map[string]interface{})
+		sm, sok := v.(map[string]interface{})
+		if dok && sok {
+			deepMerge(dm, sm)
+		}
+	}
+}
+
+// parseHelper parses ListMapHelper with helmFuncs and include bound to it
+func parseHelper() *gotemplate.Template {
+	tpl := gotemplate.Must(gotemplate.New("helper").Funcs(helmFuncs).Parse(Options{}.ListMapHelper()))
+	return tpl.Funcs(gotemplate.FuncMap{
+		"include": func(name string, data interface{}) (string, error) {
+			var buf bytes.Buffer
+			err := tpl.ExecuteTemplate(&buf, name, data)
+			return buf.String(), err
+		},
+	})
+}
+
+// renderRewritten renders tpl, a rewritten template, with the helper bound and
+// values, given as YAML, as .Values
+func renderRewritten(t *testing.T, tpl, values string) string {
+	t.Helper()
+	var v map[string]interface{}
+	if err := yaml.Unmarshal([]byte(values), &v); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parseHelper().New("rewritten").Parse(tpl)
+	if err != nil {
+		t.Fatalf("parsing rewritten template: %v\n%s", err, tpl)
+	}
+	var buf bytes.Buffer
+	if err := parsed.Execute(&buf, map[string]interface{}{"Values": v}); err != nil {
+		t.Fatalf("rendering rewritten template: %v\n%s", err, tpl)
+	}
+	return buf.String()
+}
+
+func TestOrderedHelperRendersDependencyOrder(t *testing.T) {
+	tpl := gotemplate.Must(gotemplate.New("helper").Funcs(helmFuncs).Parse(Options{}.ListMapHelper()))
+
+	items := map[string]interface{}{
+		"API_URL":  map[string]interface{}{"value": "$(BASE_URL)/api"},
+		"BASE_URL": map[string]interface{}{"value": "https://$(HOST)"},
+		"HOST":     map[string]interface{}{"value": "example.com"},
+		"CYCLE_A":  map[string]interface{}{"value": "$(CYCLE_B)"},
+		"CYCLE_B":  map[string]interface{}{"value": "$(CYCLE_A)"},
+		"SECRET":   map[string]interface{}{"valueFrom": map[string]interface{}{"secretKeyRef": map[string]interface{}{"name": "s"}}},
+	}
+	render := func(name string) []string {
+		var buf bytes.Buffer
+		if err := tpl.ExecuteTemplate(&buf, name, map[string]interface{}{"items": items, "key": "name"}); err != nil {
+			t.Fatalf("executing %s: %v", name, err)
+		}
+		var names []string
+		for _, l := range strings.Split(buf.String(), "\n") {
+			if strings.HasPrefix(l, "- name: ") {
+				names = append(names, strings.Trim(strings.TrimPrefix(l, "- name: "), `"`))
+			}
+		}
+		return names
+	}
+
+	want := []string{"HOST", "SECRET", "BASE_URL", "API_URL", "CYCLE_A", "CYCLE_B"}
+	if got := render(Options{}.OrderedHelperName()); !reflect.DeepEqual(got, want) {
+		t.Errorf("ordered helper order = %v, want %v", got, want)
+	}
+	wantAlpha := []string{"API_URL", "BASE_URL", "CYCLE_A", "CYCLE_B", "HOST", "SECRET"}
+	if got := render(DefaultHelperName); !reflect.DeepEqual(got, wantAlpha) {
+		t.Errorf("default helper order = %v, want %v", got, wantAlpha)
+	}
+}
+
+func TestByOrderHelperRendersOrderField(t *testing.T) {
+	tpl := gotemplate.Must(gotemplate.New("helper").Funcs(helmFuncs).Parse(Options{}.ListMapHelper()))
+
+	items := map[string]interface{}{
+		"API_URL":  map[string]interface{}{"value": "$(BASE_URL)/api", "order": 20},
+		"BASE_URL": map[string]interface{}{"value": "https://example.com", "order": 10},
+		"EXTRA":    map[string]interface{}{"value": "added by an override"},
+	}
+	var buf bytes.Buffer
+	if err := tpl.ExecuteTemplate(&buf, Options{}.ByOrderHelperName(), map[string]interface{}{"items": items, "key": "name"}); err != nil {
+		t.Fatalf("executing %s: %v", Options{}.ByOrderHelperName(), err)
+	}
+	want := `
+- name: "BASE_URL"
+  value: https://example.com
+- name: "API_URL"
+  value: $(BASE_URL)/api
+- name: "EXTRA"
+  value: added by an override`
+	if buf.String() != want {
+		t.Errorf("by-order helper output =%s\nwant%s", buf.String(), want)
+	}
+}
+
+func TestSetHelperRendersTrueKeys(t *testing.T) {
+	tpl := gotemplate.Must(gotemplate.New("helper").Funcs(helmFuncs).Parse(Options{}.ListMapHelper()))
+
+	items := map[string]interface{}{"regcred": true, "other": true, "removed": false, "unset": nil}
+	render := func(key string) string {
+		var buf bytes.Buffer
+		if err := tpl.ExecuteTemplate(&buf, Options{}.SetHelperName(), map[string]interface{}{"items": items, "key": key}); err != nil {
+			t.Fatalf("executing %s: %v", Options{}.SetHelperName(), err)
+		}
+		return buf.String()
+	}
+	if got, want := render("name"), "\n- name: \"other\"\n- name: \"regcred\""; got != want {
+		t.Errorf("set helper with key = %q, want %q", got, want)
+	}
+	if got, want := render(""), "\n- \"other\"\n- \"regcred\""; got != want {
+		t.Errorf("set helper without key = %q, want %q", got, want)
+	}
+}
+
+func TestJSONHelperRendersList(t *testing.T) {
+	tpl := gotemplate.Must(gotemplate.New("helper").Funcs(helmFuncs).Parse(Options{}.ListMapHelper()))
+
+	items := map[string]interface{}{
+		"sidecar": map[string]interface{}{"image": "busybox", "name": "ignored"},
+		"app":     map[string]interface{}{"image": "nginx"},
+		"empty":   nil,
+	}
+	var buf bytes.Buffer
+	if err := tpl.ExecuteTemplate(&buf, Options{}.JSONHelperName(), map[string]interface{}{"items": items, "key": "name"}); err != nil {
+		t.Fatalf("executing %s: %v", Options{}.JSONHelperName(), err)
+	}
+	want := `[{"image":"nginx","name":"app"},{"name":"empty"},{"image":"busybox","name":"sidecar"}]`
+	if buf.String() != want {
+		t.Errorf("JSON helper output = %s, want %s", buf.String(), want)
+	}
+}
+
+func TestMultiKeyHelpersRenderKeyFields(t *testing.T) {
+	tpl := parseHelper()
+	keys := []interface{}{"namespace", "name"}
+	want := `
+- namespace: "ns-a"
+  name: "svc-a"
+  port: 80
+- namespace: "ns-a"
+  name: "svc-b"
+- namespace: "ns-b"
+  name: "svc/c"
+  port: 443`
+
+	nested := map[string]interface{}{
+		"ns-b": map[string]interface{}{"svc/c": map[string]interface{}{"port": 443}},
+		"ns-a": map[string]interface{}{
+			"svc-b": nil,
+			"svc-a": map[string]interface{}{"port": 80},
+		},
+		"ns-removed": nil,
+	}
+	var buf bytes.Buffer
+	if err := tpl.ExecuteTemplate(&buf, Options{}.NestedHelperName(), map[string]interface{}{"items": nested, "keys": keys}); err != nil {
+		t.Fatalf("executing %s: %v", Options{}.NestedHelperName(), err)
+	}
+	if buf.String() != want {
+		t.Errorf("nested helper output =%s\nwant%s", buf.String(), want)
+	}
+
+	// Only the last key may contain the separator
+	composite := map[string]interface{}{
+		"ns-b/svc/c": map[string]interface{}{"port": 443},
+		"ns-a/svc-b": nil,
+		"ns-a/svc-a": map[string]interface{}{"port": 80},
+	}
+	buf.Reset()
+	if err := tpl.ExecuteTemplate(&buf, Options{}.CompositeHelperName(), map[string]interface{}{"items": composite, "keys": keys}); err != nil {
+		t.Fatalf("executing %s: %v", Options{}.CompositeHelperName(), err)
+	}
+	if buf.String() != want {
+		t.Errorf("composite helper output =%s\nwant%s", buf.String(), want)
+	}
+}
+
+func TestReplaceListBlocksMultiKey(t *testing.T) {
+	t.Parallel()
+
+	paths := []PathInfo{{DotPath: "mesh.services", MergeKey: "namespace", MergeKeys: []string{"namespace", "name"}, KeyStrategy: detect.KeyStrategyComposite}}
+	got, _ := replaceListBlocks("  services:\n    {{- toYaml .Values.mesh.services | nindent 4 }}\n", paths[0].DotPath, paths[0].helperArgs(), paths[0].helper(Options{}), Options{})
+	want := `{{- include "chart.listmap.items.composite" (dict "items" (index .Values "mesh" "services") "keys" (list "namespace" "name")) | nindent 4 }}`
+	if !strings.Contains(got, want) {
+		t.Errorf("replaceListBlocks() = %s, want it to contain %s", got, want)
+	}
+
+	chart := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(chart, "templates"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(chart, "templates", "mesh.yaml"), []byte(got), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if converted := ConvertedPaths(chart); !reflect.DeepEqual(converted, []PathInfo{{DotPath: "mesh.services", MergeKey: "namespace", SectionName: "services", MergeKeys: []string{"namespace", "name"}, KeyStrategy: detect.KeyStrategyComposite}}) {
+		t.Errorf("ConvertedPaths() = %+v", converted)
+	}
+}
+
+func TestShapedHelperInvertsShape(t *testing.T) {
+	tpl := parseHelper()
+
+	items := map[string]interface{}{
+		"TOKEN": map[string]interface{}{"from": "secret", "optional": true},
+		"HOST":  "example.com",
+		"EMPTY": nil,
+	}
+	var buf bytes.Buffer
+	data := map[string]interface{}{"items": items, "key": "name", "scalar": "value", "rename": map[string]interface{}{"from": "valueFrom"}}
+	if err := tpl.ExecuteTemplate(&buf, Options{}.ShapedHelperName(), data); err != nil {
+		t.Fatalf("executing %s: %v", Options{}.ShapedHelperName(), err)
+	}
+	want := `
+- name: "EMPTY"
+- name: "HOST"
+  value: example.com
+- name: "TOKEN"
+  optional: true
+  valueFrom: secret`
+	if buf.String() != want {
+		t.Errorf("shaped helper output =%s\nwant%s", buf.String(), want)
+	}
+}
+
+func TestConvertedPathsShaped(t *testing.T) {
+	t.Parallel()
+
+	p := PathInfo{DotPath: "env", MergeKey: "name", SectionName: "env", Rename: map[string]string{"valueFrom": "from"}, Scalar: "value"}
+	got, _ := replaceListBlocks("env:\n  {{- toYaml .Values.env | nindent 2 }}\n", p.DotPath, p.helperArgs(), p.helper(Options{}), Options{})
+	want := `{{- include "chart.listmap.items.shaped" (dict "items" (index .Values "env") "key" "name" "scalar" "value" "rename" (dict "from" "valueFrom")) | nindent 2 }}`
+	if !strings.Contains(got, want) {
+		t.Errorf("replaceListBlocks() = %s, want it to contain %s", got, want)
+	}
+
+	chart := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(chart, "templates"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(chart, "templates", "env.yaml"), []byte(got), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if converted := ConvertedPaths(chart); !reflect.DeepEqual(converted, []PathInfo{p}) {
+		t.Errorf("ConvertedPaths() = %+v, want %+v", converted, p)
+	}
+}
+
+func TestSyntheticHelperLeavesKeyOut(t *testing.T) {
+	tpl := parseHelper()
+
+	items := map[string]interface{}{
+		"monitoring": map[string]interface{}{"ports": []interface{}{map[string]interface{}{"port": 9090}}},
+		"frontend":   map[string]interface{}{"from": []interface{}{map[string]interface{}{"podSelector": map[string]interface{}{}}}},
+		"all":        map[string]interface{}{},
+		"removed":    nil,
+	}
+	var buf bytes.Buffer
+	if err := tpl.ExecuteTemplate(&buf, Options{}.SyntheticHelperName(), map[string]interface{}{"items": items, "key": "name"}); err != nil {
+		t.Fatalf("executing %s: %v", Options{}.SyntheticHelperName(), err)
+	}
+	// helmFuncs' toYaml indents nested lists by four spaces, which indent 2 keeps
+	want := `
+- {}
+- from:
+      - podSelector: {}
+- ports:
+      - port: 9090`
+	if buf.String() != want {
+		t.Errorf("synthetic helper output =%s\nwant%s", buf.String(), want)
+	}
+}
+
+func TestConvertedPathsSynthetic(t *testing.T) {
+	t.Parallel()
+
+	p := PathInfo{DotPath: "networkPolicy.ingress", MergeKey: "name", SectionName: "ingress", Synthetic: true}
+	tpl := "  ingress:\n    {{- toYaml .Values.networkPolicy.ingress | nindent 4 }}\n  egress:\n    {{- toJson .Values.networkPolicy.ingress }}\n"
+	got, _ := replaceListBlocks(tpl, p.DotPath, p.helperArgs(), p.helper(Options{}), Options{})
+	want := `{{- include "chart.listmap.items.synthetic" (dict "items" (index .Values "networkPolicy" "ingress") "key" "name") | nindent 4 }}`
+	if !strings.Contains(got, want) {
+		t.Errorf("replaceListBlocks() = %s, want it to contain %s", got, want)
+	}
+	// The JSON variant would render the key
+	if !strings.Contains(got, "{{- toJson .Values.networkPolicy.ingress }}") {
+		t.Errorf("replaceListBlocks() should leave toJson alone for a synthetic key, got %s", got)
+	}
+
+	chart := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(chart, "templates"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(chart, "templates", "np.yaml"), []byte(got), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if converted := ConvertedPaths(chart); !reflect.DeepEqual(converted, []PathInfo{p}) {
+		t.Errorf("ConvertedPaths() = %+v, want %+v", converted, p)
+	}
+}
+
+func TestHelpersSortNumericKeysNaturally(t *testing.T) {
+	tpl := gotemplate.Must(gotemplate.New("helper").Funcs(helmFuncs).Parse(Options{}.ListMapHelper()))
+
+	items := map[string]interface{}{}
+	for _, k := range []string{"8080", "http", "80", "1000", "443", "0", "admin", "9"} {
+		items[k] = map[string]interface{}{"protocol": "TCP"}
+	}
+	want := []string{"0", "9", "80", "443", "1000", "8080", "admin", "http"}
+	for _, name := range []string{DefaultHelperName, Options{}.OrderedHelperName(), Options{}.ByOrderHelperName()} {
+		var buf bytes.Buffer
+		if err := tpl.ExecuteTemplate(&buf, name, map[string]interface{}{"items": items, "key": "containerPort"}); err != nil {
+			t.Fatalf("executing %s: %v", name, err)
+		}
+		var got []string
+		for _, l := range strings.Split(buf.String(), "\n") {
+			if strings.HasPrefix(l, "- containerPort: ") {
+				got = append(got, strings.Trim(strings.TrimPrefix(l, "- containerPort: "), `"`))
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s key order = %v, want %v", name, got, want)
+		}
+	}
+
+	var buf bytes.Buffer
+	set := map[string]interface{}{"10": true, "9": true, "100": true}
+	if err := tpl.ExecuteTemplate(&buf, Options{}.SetHelperName(), map[string]interface{}{"items": set, "key": ""}); err != nil {
+		t.Fatalf("executing %s: %v", Options{}.SetHelperName(), err)
+	}
+	if got, want := buf.String(), "\n- \"9\"\n- \"10\"\n- \"100\""; got != want {
+		t.Errorf("set helper = %q, want %q", got, want)
+	}
+}
+
+func TestHelperRoundTripsKeys(t *testing.T) {
+	tpl := gotemplate.Must(gotemplate.New("helper").Funcs(helmFuncs).Parse(Options{}.ListMapHelper()))
+
+	keys := []string{"/var/log/app", "app.kubernetes.io/name", "a: b", `say "hi"`, "#tag"}
+	items := map[string]interface{}{}
+	for _, k := range keys {
+		items[k] = map[string]interface{}{"readOnly": true}
+	}
+	var buf bytes.Buffer
+	if err := tpl.ExecuteTemplate(&buf, DefaultHelperName, map[string]interface{}{"items": items, "key": "mountPath"}); err != nil {
+		t.Fatalf("executing %s: %v", DefaultHelperName, err)
+	}
+	var got []map[string]interface{}
+	if err := yaml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("helper output does not parse: %v\n%s", err, buf.String())
+	}
+	seen := map[string]bool{}
+	for _, item := range got {
+		seen[fmt.Sprint(item["mountPath"])] = true
+	}
+	for _, k := range keys {
+		if !seen[k] {
+			t.Errorf("key %q not round-tripped, got %v", k, got)
+		}
+	}
+}
+
+func TestHelpersRenderNothingForEmptyValues(t *testing.T) {
+	tpl := gotemplate.Must(gotemplate.New("helper").Funcs(helmFuncs).Parse(Options{}.ListMapHelper()))
+
+	for _, name := range []string{DefaultHelperName, Options{}.OrderedHelperName(), Options{}.ByOrderHelperName(), Options{}.SetHelperName()} {
+		for _, items := range []interface{}{nil, map[string]interface{}{}, []interface{}{}} {
+			var buf bytes.Buffer
+			if err := tpl.ExecuteTemplate(&buf, name, map[string]interface{}{"items": items, "key": "name"}); err != nil {
+				t.Errorf("executing %s with %#v: %v", name, items, err)
+				continue
+			}
+			if buf.String() != "" {
+				t.Errorf("%s with %#v rendered %q, want nothing", name, items, buf.String())
+			}
+		}
+	}
+}
+
+func TestReplaceListBlocksToJSON(t *testing.T) {
+	t.Parallel()
+
+	const call = `include "chart.listmap.items.json" (dict "items" (index .Values "sidecars") "key" "name")`
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{`containers: {{ toJson .Values.sidecars }}`, `containers: {{ ` + call + ` }}`},
+		{`containers: {{- .Values.sidecars | toJson -}}`, `containers: {{- ` + call + ` -}}`},
+		{`config: {{ toJson .Values.sidecars | quote }}`, `config: {{ ` + call + ` | quote }}`},
+		{`config: {{ toJson .Values.sidecarsExtra }}`, `config: {{ toJson .Values.sidecarsExtra }}`},
+	}
+	for _, tt := range tests {
+		got, _ := ReplaceListBlocks(tt.template, "sidecars", "name", Options{})
+		if got != tt.want {
+			t.Errorf("ReplaceListBlocks(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestHelperChangelog(t *testing.T) {
+	t.Parallel()
+
+	// Every version has an entry, in order
+	if len(HelperChangelog) != HelperVersion {
+		t.Fatalf("HelperChangelog has %d entries, want one per version up to %d", len(HelperChangelog), HelperVersion)
+	}
+	for i, c := range HelperChangelog {
+		if c.Version != i+1 || c.Summary == "" {
+			t.Errorf("HelperChangelog[%d] = %+v, want version %d with a summary", i, c, i+1)
+		}
+	}
+	if got := HelperChangesSince(HelperVersion - 2); len(got) != 2 || got[0].Version != HelperVersion-1 {
+		t.Errorf("HelperChangesSince(%d) = %+v, want the last two changes", HelperVersion-2, got)
+	}
+	if got := HelperChangesSince(HelperVersion); len(got) != 0 {
+		t.Errorf("HelperChangesSince(HelperVersion) = %+v, want none", got)
+	}
+}
+
+func TestParseHelperVersion(t *testing.T) {
+	tests := []struct {
+		content string
+		want    int
+	}{
+		{`{{- /* Generated by list-to-map helper version 3. */ -}}`, 3},
+		{`{{- define "chart.listmap.items" -}}{{- end -}}`, 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := ParseHelperVersion(tt.content); got != tt.want {
+			t.Errorf("ParseHelperVersion(%q) = %d, want %d", tt.content, got, tt.want)
+		}
+	}
 }
 
 func TestQuotePathEdgeCases(t *testing.T) {
@@ -216,3 +907,841 @@ func TestQuotePathEdgeCases(t *testing.T) {
 }
 
 // TestDotPathJoining removed - dotPath is now internal to pkg/transform
+
+func TestReplaceDictArgBlocks(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{{- toYaml .env }}`, `{{- include "chart.listmap.items" (dict "items" .env "key" "name") }}`},
+		{`{{- .env | toYaml | nindent 2 -}}`, `{{- include "chart.listmap.items" (dict "items" .env "key" "name") | nindent 2 -}}`},
+		{`{{ toJson .env }}`, `{{ include "chart.listmap.items.json" (dict "items" .env "key" "name") }}`},
+		{`{{- toYaml .envFrom }}`, `{{- toYaml .envFrom }}`},
+	}
+	for _, tt := range tests {
+		got, _ := ReplaceDictArgBlocks(tt.body, "env", "name", DefaultHelperName, Options{})
+		if got != tt.want {
+			t.Errorf("ReplaceDictArgBlocks(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestApplyDictArgRewrites(t *testing.T) {
+	t.Parallel()
+
+	partial := `{{- define "app.env" -}}
+{{- if .env }}
+{{- toYaml .env }}
+{{- end }}
+{{- end }}
+{{- define "app.other" -}}
+{{- toYaml .env }}
+{{- end }}
+`
+	callers := []string{
+		partial,
+		`{{ include "app.env" (dict "env" .Values.env) }}`,
+		`{{ include "app.env" (dict "env" .Values.worker.env) }}`,
+		`{{ include "app.other" (dict "env" .Values.env) }}`,
+		`{{ include "app.other" (dict "env" .Values.initEnv) }}`,
+		`{{ include "app.vars" (dict "env" .Values.env) }}`,
+		`{{ include "app.vars" (dict "env" $extra) }}`,
+		`{{ include "app.vars" (dict "env" $extra) }}`,
+		`{{ include "app.ports" (dict "ports" .Values.ports) }}`,
+	}
+	paths := []PathInfo{{DotPath: "env", MergeKey: "name"}, {DotPath: "worker.env", MergeKey: "name"}}
+
+	// app.other is also passed initEnv, which stays a list, and app.vars a
+	// variable; app.ports is passed nothing converted
+	plan, unhandled := planDictArgRewrites(callers, paths, Options{})
+	if len(plan) != 1 || plan[0].Define != "app.env" || !reflect.DeepEqual(plan[0].Paths, []string{"env", "worker.env"}) {
+		t.Fatalf("planDictArgRewrites() = %+v, want app.env only", plan)
+	}
+	wantUnhandled := []UnhandledDictArg{
+		{Define: "app.other", Key: "env", Arg: ".Values.initEnv", Reason: "not converted"},
+		{Define: "app.vars", Key: "env", Arg: "$extra", Reason: "not a .Values path"},
+	}
+	if !reflect.DeepEqual(unhandled, wantUnhandled) {
+		t.Errorf("planDictArgRewrites() unhandled = %+v, want %+v", unhandled, wantUnhandled)
+	}
+
+	want := `{{- define "app.env" -}}
+{{- if .env }}
+{{- include "chart.listmap.items" (dict "items" .env "key" "name") }}
+{{- end }}
+{{- end }}
+{{- define "app.other" -}}
+{{- toYaml .env }}
+{{- end }}
+`
+	if got := applyDictArgRewrites(partial, plan, Options{}); got != want {
+		t.Errorf("applyDictArgRewrites() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPlanDictArgRewritesOpaqueCallers(t *testing.T) {
+	t.Parallel()
+
+	partial := `{{- define "app.env" -}}
+{{- toYaml .env }}
+{{- end }}
+`
+	paths := []PathInfo{{DotPath: "env", MergeKey: "name"}}
+	for _, call := range []string{
+		`include "app.env" (dict "env" (default list .Values.initEnv))`,
+		`include "app.env" $ctx`,
+		`template "app.env"`,
+	} {
+		t.Run(call, func(t *testing.T) {
+			callers := []string{partial, `{{ include "app.env" (dict "env" .Values.env) }}`, "{{ " + call + " }}"}
+			plan, unhandled := planDictArgRewrites(callers, paths, Options{})
+			if len(plan) != 0 {
+				t.Errorf("planDictArgRewrites() = %+v, want app.env left as is", plan)
+			}
+			want := []UnhandledDictArg{{Define: "app.env", Key: "env", Arg: call, Reason: "a call whose context can't be followed"}}
+			if !reflect.DeepEqual(unhandled, want) {
+				t.Errorf("planDictArgRewrites() unhandled = %+v, want %+v", unhandled, want)
+			}
+		})
+	}
+}
+
+func TestReplaceConcatBlocks(t *testing.T) {
+	t.Parallel()
+
+	paths := []PathInfo{
+		{DotPath: "env", MergeKey: "name"},
+		{DotPath: "app.extraEnv", MergeKey: "name"},
+		{DotPath: "app.env", MergeKey: "name"},
+		{DotPath: "defaults.env", MergeKey: "name"},
+		{DotPath: "volumes", MergeKey: "name"},
+	}
+	want := `{{- include "chart.listmap.items" (dict "sources" (list (index .Values "env") (index .Values "app" "extraEnv")) "key" "name") | nindent 12 }}`
+	// merge keeps its first dict's fields, so app is merged last
+	merged := `{{- include "chart.listmap.items" (dict "sources" (list (index .Values "defaults" "env") (index .Values "app" "env")) "key" "name") | nindent 12 }}`
+	tests := []struct {
+		tpl  string
+		want string
+	}{
+		{`{{- toYaml (concat .Values.env .Values.app.extraEnv) | nindent 12 }}`, want},
+		{`{{- concat .Values.env .Values.app.extraEnv | toYaml | nindent 12 }}`, want},
+		// $ is kept, so the rewrite still works inside range and with
+		{`{{- toYaml (concat $.Values.env .Values.app.extraEnv) | nindent 12 }}`, `{{- include "chart.listmap.items" (dict "sources" (list (index $.Values "env") (index .Values "app" "extraEnv")) "key" "name") | nindent 12 }}`},
+		{`{{- toYaml (merge .Values.app .Values.defaults).env | nindent 12 }}`, merged},
+		{`{{- (merge .Values.app .Values.defaults).env | toYaml | nindent 12 }}`, merged},
+		{`{{- toYaml (mergeOverwrite .Values.defaults .Values.app).env | nindent 12 }}`, merged},
+		// initEnv stays a list, so the concat must too
+		{`{{- toYaml (concat .Values.env .Values.initEnv) | nindent 12 }}`, `{{- toYaml (concat .Values.env .Values.initEnv) | nindent 12 }}`},
+		{`{{- toYaml (merge .Values.app .Values.worker).env | nindent 12 }}`, `{{- toYaml (merge .Values.app .Values.worker).env | nindent 12 }}`},
+		// The lists have different merge keys
+		{`{{- toYaml (concat .Values.env .Values.ports) | nindent 12 }}`, `{{- toYaml (concat .Values.env .Values.ports) | nindent 12 }}`},
+		// Without an indent stage the list can't be placed
+		{`{{ toYaml (concat .Values.env .Values.app.extraEnv) }}`, `{{ toYaml (concat .Values.env .Values.app.extraEnv) }}`},
+	}
+	for _, tt := range tests {
+		if got, _ := ReplaceConcatBlocks(tt.tpl, paths, Options{}); got != tt.want {
+			t.Errorf("ReplaceConcatBlocks(%q) =\n%s\nwant\n%s", tt.tpl, got, tt.want)
+		}
+	}
+}
+
+// TestReplaceConcatBlocksSameKey renders lists sharing a key: the later list's
+// entry replaces the earlier one whole, so an env var overridden with a
+// valueFrom doesn't keep the default's value, which Kubernetes would reject
+func TestReplaceConcatBlocksSameKey(t *testing.T) {
+	t.Parallel()
+
+	paths := []PathInfo{{DotPath: "env", MergeKey: "name"}, {DotPath: "extraEnv", MergeKey: "name"}}
+	values := `
+env:
+  DB_HOST:
+    value: db
+  LEVEL:
+    value: info
+extraEnv:
+  DB_HOST:
+    valueFrom:
+      secretKeyRef:
+        name: db
+        key: host
+  LEVEL:
+    value: debug
+`
+	want := map[string]interface{}{"env": []interface{}{
+		map[string]interface{}{"name": "DB_HOST", "valueFrom": map[string]interface{}{"secretKeyRef": map[string]interface{}{"name": "db", "key": "host"}}},
+		map[string]interface{}{"name": "LEVEL", "value": "debug"},
+	}}
+	for _, tpl := range []string{
+		`{{- toYaml (concat .Values.env .Values.extraEnv) | nindent 2 }}`,
+		`{{- range list 1 }}{{- toYaml (concat $.Values.env $.Values.extraEnv) | nindent 2 }}{{- end }}`,
+	} {
+		got, ok := ReplaceConcatBlocks(tpl, paths, Options{})
+		if !ok {
+			t.Fatalf("ReplaceConcatBlocks(%q) should rewrite the concat", tpl)
+		}
+		out := renderRewritten(t, "env:"+got, values)
+		var rendered map[string]interface{}
+		if err := yaml.Unmarshal([]byte(out), &rendered); err != nil {
+			t.Fatalf("rendered YAML doesn't parse: %v\n%s", err, out)
+		}
+		if !reflect.DeepEqual(rendered, want) {
+			t.Errorf("rendered:\n%s\nwant %+v", out, want)
+		}
+	}
+}
+
+func TestConvertedPathsConcat(t *testing.T) {
+	t.Parallel()
+
+	want := []PathInfo{
+		{DotPath: "env", MergeKey: "name", SectionName: "env", Ordered: true},
+		{DotPath: "extraEnv", MergeKey: "name", SectionName: "extraEnv", Ordered: true},
+	}
+	for _, tpl := range []string{
+		`{{- include "chart.listmap.items.ordered" (dict "sources" (list (index .Values "env") (index $.Values "extraEnv")) "key" "name") | nindent 12 }}`,
+		// Written before helper version 12
+		`{{- include "chart.listmap.items.ordered" (dict "items" (merge (dict) (deepCopy (index .Values "extraEnv")) (deepCopy (index .Values "env"))) "key" "name") | nindent 12 }}`,
+	} {
+		chart := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(chart, "templates"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(chart, "templates", "deployment.yaml"), []byte(tpl+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := ConvertedPaths(chart); !reflect.DeepEqual(got, want) {
+			t.Errorf("ConvertedPaths(%s) = %+v, want %+v", tpl, got, want)
+		}
+	}
+}
+
+func TestReplaceFragmentBlocks(t *testing.T) {
+	t.Parallel()
+
+	paths := []PathInfo{
+		{DotPath: "initContainers", MergeKey: "name"},
+		{DotPath: "extraInitContainers", MergeKey: "name"},
+		{DotPath: "sidecars", MergeKey: "name"},
+		{DotPath: "ports", MergeKey: "containerPort"},
+	}
+	fragments := `      initContainers:
+        {{- with .Values.initContainers }}
+        {{- toYaml . | nindent 8 }}
+        {{- end }}
+        {{- with .Values.extraInitContainers }}
+        {{- toYaml . | nindent 8 }}
+        {{- end }}`
+	merged := `      initContainers:
+        {{- include "chart.listmap.items" (dict "sources" (list (index .Values "initContainers") (index .Values "extraInitContainers")) "key" "name") | nindent 8 }}`
+	tests := []struct {
+		name string
+		tpl  string
+		want string
+	}{
+		{name: "with blocks merged", tpl: fragments, want: merged},
+		{
+			name: "toYaml actions merged",
+			tpl:  "      initContainers:\n        {{- toYaml .Values.initContainers | nindent 8 }}\n        {{- .Values.extraInitContainers | toYaml | nindent 8 }}",
+			want: merged,
+		},
+		{
+			name: "sidecars appended to the chart's container",
+			tpl:  "      containers:\n        - name: app\n        {{- with .Values.sidecars }}\n        {{- toYaml . | nindent 8 }}\n        {{- end }}",
+			want: "      containers:\n        - name: app\n        {{- include \"chart.listmap.items\" (dict \"items\" (index .Values \"sidecars\") \"key\" \"name\") | nindent 8 }}",
+		},
+		{
+			// The keys differ, so each with block renders its own items
+			name: "different merge keys",
+			tpl:  "        {{- with .Values.sidecars }}\n        {{- toYaml . | nindent 8 }}\n        {{- end }}\n        {{- with .Values.ports }}\n        {{- toYaml . | nindent 8 }}\n        {{- end }}",
+			want: "        {{- include \"chart.listmap.items\" (dict \"items\" (index .Values \"sidecars\") \"key\" \"name\") | nindent 8 }}\n        {{- include \"chart.listmap.items\" (dict \"items\" (index .Values \"ports\") \"key\" \"containerPort\") | nindent 8 }}",
+		},
+		{
+			// extraContainers stays a list and keeps its with block
+			name: "unconverted fragment",
+			tpl:  "        {{- with .Values.sidecars }}\n        {{- toYaml . | nindent 8 }}\n        {{- end }}\n        {{- with .Values.extraContainers }}\n        {{- toYaml . | nindent 8 }}\n        {{- end }}",
+			want: "        {{- include \"chart.listmap.items\" (dict \"items\" (index .Values \"sidecars\") \"key\" \"name\") | nindent 8 }}\n        {{- with .Values.extraContainers }}\n        {{- toYaml . | nindent 8 }}\n        {{- end }}",
+		},
+		{
+			// $ is kept, so the rewrite still works inside range
+			name: "with blocks read through $",
+			tpl:  "        {{- with $.Values.initContainers }}\n        {{- toYaml . | nindent 8 }}\n        {{- end }}\n        {{- toYaml .Values.extraInitContainers | nindent 8 }}",
+			want: "        {{- include \"chart.listmap.items\" (dict \"sources\" (list (index $.Values \"initContainers\") (index .Values \"extraInitContainers\")) \"key\" \"name\") | nindent 8 }}",
+		},
+		{
+			name: "single with block read through $",
+			tpl:  "        {{- with $.Values.sidecars }}\n        {{- toYaml . | nindent 8 }}\n        {{- end }}",
+			want: "        {{- include \"chart.listmap.items\" (dict \"items\" (index $.Values \"sidecars\") \"key\" \"name\") | nindent 8 }}",
+		},
+		{
+			// A single toYaml action is left to ReplaceListBlocks
+			name: "single toYaml action",
+			tpl:  "        {{- toYaml .Values.sidecars | nindent 8 }}",
+			want: "        {{- toYaml .Values.sidecars | nindent 8 }}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := ReplaceFragmentBlocks(tt.tpl, paths, Options{}); got != tt.want {
+				t.Errorf("ReplaceFragmentBlocks() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+
+	chart := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(chart, "templates"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(chart, "templates", "deployment.yaml"), []byte(fragments+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	matched := CheckTemplatePatterns(chart, paths)
+	if !matched["initContainers"] || !matched["extraInitContainers"] {
+		t.Errorf("CheckTemplatePatterns() = %v, want both fragments matched", matched)
+	}
+	if err := os.WriteFile(filepath.Join(chart, "templates", "deployment.yaml"), []byte(merged+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var converted []string
+	for _, p := range ConvertedPaths(chart) {
+		converted = append(converted, p.DotPath)
+	}
+	if strings.Join(converted, ",") != "initContainers,extraInitContainers" {
+		t.Errorf("ConvertedPaths() = %v, want both fragments", converted)
+	}
+}
+
+// TestReplaceFragmentBlocksSameKey renders fragments sharing a key inside a
+// range: the later fragment's item replaces the earlier one whole
+func TestReplaceFragmentBlocksSameKey(t *testing.T) {
+	t.Parallel()
+
+	paths := []PathInfo{{DotPath: "initContainers", MergeKey: "name"}, {DotPath: "extraInitContainers", MergeKey: "name"}}
+	tpl := `{{- range list 1 }}
+initContainers:
+  {{- with $.Values.initContainers }}
+  {{- toYaml . | nindent 2 }}
+  {{- end }}
+  {{- with $.Values.extraInitContainers }}
+  {{- toYaml . | nindent 2 }}
+  {{- end }}
+{{- end }}`
+	got, ok := ReplaceFragmentBlocks(tpl, paths, Options{})
+	if !ok {
+		t.Fatal("ReplaceFragmentBlocks() should merge the fragments")
+	}
+	out := renderRewritten(t, got, `
+initContainers:
+  migrate:
+    image: app
+    command: [migrate]
+extraInitContainers:
+  migrate:
+    image: tools
+`)
+	var rendered map[string]interface{}
+	if err := yaml.Unmarshal([]byte(out), &rendered); err != nil {
+		t.Fatalf("rendered YAML doesn't parse: %v\n%s", err, out)
+	}
+	want := map[string]interface{}{"initContainers": []interface{}{
+		map[string]interface{}{"name": "migrate", "image": "tools"},
+	}}
+	if !reflect.DeepEqual(rendered, want) {
+		t.Errorf("rendered:\n%s\nwant %+v", out, want)
+	}
+}
+
+func TestReplaceWrappedBlocks(t *testing.T) {
+	t.Parallel()
+
+	paths := []PathInfo{{DotPath: "env", MergeKey: "name"}, {DotPath: "legacyEnv", MergeKey: "name"}, {DotPath: "ports", MergeKey: "containerPort"}}
+	required := `{{- include "chart.listmap.items" (dict "items" (required "env required" (index .Values "env")) "key" "name") | nindent 12 }}`
+	coalesce := `{{- include "chart.listmap.items" (dict "items" (coalesce (index .Values "env") (index .Values "legacyEnv")) "key" "name") | nindent 12 }}`
+	tests := []struct {
+		tpl  string
+		want string
+	}{
+		{`{{- toYaml (required "env required" .Values.env) | nindent 12 }}`, required},
+		{`{{- required "env required" .Values.env | toYaml | nindent 12 }}`, required},
+		{`{{- toYaml (coalesce .Values.env .Values.legacyEnv) | nindent 12 }}`, coalesce},
+		{`{{- coalesce .Values.env .Values.legacyEnv | toYaml | nindent 12 }}`, coalesce},
+		// initEnv stays a list, so required must render it as one
+		{`{{- toYaml (required "x" .Values.initEnv) | nindent 12 }}`, `{{- toYaml (required "x" .Values.initEnv) | nindent 12 }}`},
+		// The lists have different merge keys
+		{`{{- toYaml (coalesce .Values.env .Values.ports) | nindent 12 }}`, `{{- toYaml (coalesce .Values.env .Values.ports) | nindent 12 }}`},
+		// Without an indent stage the list can't be placed
+		{`{{ toYaml (required "x" .Values.env) }}`, `{{ toYaml (required "x" .Values.env) }}`},
+	}
+	for _, tt := range tests {
+		if got, _ := ReplaceWrappedBlocks(tt.tpl, paths, Options{}); got != tt.want {
+			t.Errorf("ReplaceWrappedBlocks(%q) =\n%s\nwant\n%s", tt.tpl, got, tt.want)
+		}
+	}
+}
+
+// TestReplaceWrappedBlocksInRange renders wrapped lists read through $ inside
+// a range, where dot is the item rather than the chart's root
+func TestReplaceWrappedBlocksInRange(t *testing.T) {
+	t.Parallel()
+
+	paths := []PathInfo{{DotPath: "env", MergeKey: "name"}, {DotPath: "legacyEnv", MergeKey: "name"}}
+	values := "containers:\n  - name: app\nenv:\n  FOO:\n    value: bar\n"
+	for _, action := range []string{
+		`{{- toYaml (required "env required" $.Values.env) | nindent 4 }}`,
+		`{{- toYaml (coalesce $.Values.env $.Values.legacyEnv) | nindent 4 }}`,
+	} {
+		tpl := "{{- range .Values.containers }}\n- name: {{ .name }}\n  env:\n    " + action + "\n{{- end }}\n"
+		got, changed := ReplaceWrappedBlocks(tpl, paths, Options{})
+		if !changed {
+			t.Errorf("ReplaceWrappedBlocks(%q) left it unchanged", action)
+			continue
+		}
+		if !strings.Contains(got, "(index $.Values \"env\")") {
+			t.Errorf("ReplaceWrappedBlocks(%q) should read the list through $:\n%s", action, got)
+		}
+		if out := renderRewritten(t, got, values); !strings.Contains(out, "- name: \"FOO\"\n      value: bar") {
+			t.Errorf("rendered %q as:\n%s", action, out)
+		}
+	}
+}
+
+func TestConvertedPathsWrapped(t *testing.T) {
+	t.Parallel()
+
+	chart := t.TempDir()
+	tpl := `{{- include "chart.listmap.items" (dict "items" (required "ports required" (index .Values "ports")) "key" "containerPort") | nindent 12 }}
+{{- include "chart.listmap.items.ordered" (dict "items" (coalesce (index .Values "env") (index $.Values "legacyEnv")) "key" "name") | nindent 12 }}
+`
+	if err := os.MkdirAll(filepath.Join(chart, "templates"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(chart, "templates", "deployment.yaml"), []byte(tpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := []PathInfo{
+		{DotPath: "ports", MergeKey: "containerPort", SectionName: "ports"},
+		{DotPath: "env", MergeKey: "name", SectionName: "env", Ordered: true},
+		{DotPath: "legacyEnv", MergeKey: "name", SectionName: "legacyEnv", Ordered: true},
+	}
+	if got := ConvertedPaths(chart); !reflect.DeepEqual(got, want) {
+		t.Errorf("ConvertedPaths() = %+v, want %+v", got, want)
+	}
+}
+
+func TestHelperCollisions(t *testing.T) {
+	t.Parallel()
+
+	// The chart's copy of the main helper, reindented
+	start, end, ok := defineBody(Options{}.ListMapHelper(), DefaultHelperName)
+	if !ok {
+		t.Fatal("generated helper has no main define")
+	}
+	copied := "{{- define \"" + DefaultHelperName + "\" -}}\n" + strings.ReplaceAll(Options{}.ListMapHelper()[start:end], "\n", "\n  ") + "{{- end -}}\n"
+	custom := "{{- define \"" + Options{}.JSONHelperName() + "\" -}}\n{{- toJson .items -}}\n{{- end -}}\n"
+
+	tests := []struct {
+		name      string
+		files     map[string]string
+		want      []HelperCollision
+		wantErr   bool
+		wantWrite bool
+	}{
+		{
+			name:      "no collision",
+			files:     map[string]string{"_helpers.tpl": `{{- define "app.name" -}}app{{- end -}}` + "\n"},
+			wantWrite: true,
+		},
+		{
+			name:      "identical copy",
+			files:     map[string]string{"_helpers.tpl": copied},
+			want:      []HelperCollision{{File: "templates/_helpers.tpl", Name: DefaultHelperName, Same: true}},
+			wantWrite: true,
+		},
+		{
+			name:    "differing define",
+			files:   map[string]string{"_helpers.tpl": copied, "_json.tpl": custom},
+			want:    []HelperCollision{{File: "templates/_helpers.tpl", Name: DefaultHelperName, Same: true}, {File: "templates/_json.tpl", Name: Options{}.JSONHelperName(), Same: false}},
+			wantErr: true,
+		},
+		{
+			name:  "generated file ignored",
+			files: map[string]string{"_listmap.tpl": custom},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			chart := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(chart, "templates"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(chart, "templates", name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			fsys := filesystem.OSFileSystem{}
+			got, err := HelperCollisions(fsys, chart, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("HelperCollisions() = %+v, want %+v", got, tt.want)
+			}
+			err = CheckHelperCollisions(fsys, chart, Options{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckHelperCollisions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "helperName") {
+				t.Errorf("CheckHelperCollisions() error should suggest helperName, got: %v", err)
+			}
+			if !tt.wantErr {
+				if created := EnsureHelpersWithReport(fsys, chart, Options{}); created != tt.wantWrite {
+					t.Errorf("EnsureHelpersWithReport() = %v, want %v", created, tt.wantWrite)
+				}
+			}
+		})
+	}
+}
+
+// packChart returns a packaged chart holding files, named by their path in
+// the archive
+func packChart(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for name, data := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestHelperCollisionsDependencies(t *testing.T) {
+	t.Parallel()
+
+	helper := Options{}.ListMapHelper()
+	custom := "{{- define \"" + DefaultHelperName + "\" -}}\n{{- toYaml .items -}}\n{{- end -}}\n"
+	inner := packChart(t, map[string][]byte{
+		"inner/Chart.yaml":           []byte("name: inner\n"),
+		"inner/templates/_items.tpl": []byte(helper),
+	})
+	packed := packChart(t, map[string][]byte{
+		"packed/Chart.yaml":                   []byte("name: packed\n"),
+		"packed/templates/_helpers.tpl":       []byte(custom),
+		"packed/templates/NOTES.txt":          []byte(custom),
+		"packed/files/_helpers.tpl":           []byte(custom),
+		"packed/charts/inner-0.1.0.tgz":       inner,
+		"packed/charts/local/templates/a.tpl": []byte(helper),
+	})
+	chart := t.TempDir()
+	files := map[string][]byte{
+		"templates/deployment.yaml":              []byte("kind: Deployment\n"),
+		"charts/unpacked/Chart.yaml":             []byte("name: unpacked\n"),
+		"charts/unpacked/templates/_listmap.tpl": []byte(helper),
+		"charts/packed-1.0.0.tgz":                packed,
+	}
+	for name, data := range files {
+		path := filepath.Join(chart, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fsys := filesystem.OSFileSystem{}
+	got, err := HelperCollisions(fsys, chart, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for _, c := range got {
+		if c.Name == DefaultHelperName {
+			found = append(found, fmt.Sprintf("%s same=%v dependency=%v", c.File, c.Same, c.Dependency))
+		}
+	}
+	sort.Strings(found)
+	want := []string{
+		"charts/packed-1.0.0.tgz/packed/charts/inner-0.1.0.tgz/inner/templates/_items.tpl same=true dependency=true",
+		"charts/packed-1.0.0.tgz/packed/charts/local/templates/a.tpl same=true dependency=true",
+		"charts/packed-1.0.0.tgz/packed/templates/_helpers.tpl same=false dependency=true",
+		"charts/unpacked/templates/_listmap.tpl same=true dependency=true",
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("HelperCollisions() =\n%s\nwant\n%s", strings.Join(found, "\n"), strings.Join(want, "\n"))
+	}
+	if err := CheckHelperCollisions(fsys, chart, Options{}); err == nil || !strings.Contains(err.Error(), "packed/templates/_helpers.tpl") {
+		t.Errorf("CheckHelperCollisions() error = %v, want one naming the packaged define", err)
+	}
+
+	// A dependency's identical copy doesn't stand in for the chart's helper
+	if err := os.Remove(filepath.Join(chart, "charts", "packed-1.0.0.tgz")); err != nil {
+		t.Fatal(err)
+	}
+	if !EnsureHelpersWithReport(fsys, chart, Options{}) {
+		t.Error("EnsureHelpersWithReport() should write the helper when only a dependency defines it")
+	}
+}
+
+func TestEnsureHelpersSkipsIdenticalCopy(t *testing.T) {
+	t.Parallel()
+
+	chart := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(chart, "templates"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A chart that copied every generated define into its own helpers file
+	if err := os.WriteFile(filepath.Join(chart, "templates", "_helpers.tpl"), []byte(Options{}.ListMapHelper()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fsys := filesystem.OSFileSystem{}
+	if err := CheckHelperCollisions(fsys, chart, Options{}); err != nil {
+		t.Fatalf("CheckHelperCollisions() error = %v", err)
+	}
+	if EnsureHelpersWithReport(fsys, chart, Options{}) {
+		t.Error("EnsureHelpersWithReport() should not create a helper the chart already defines")
+	}
+	if _, err := os.Stat(filepath.Join(chart, "templates", "_listmap.tpl")); !os.IsNotExist(err) {
+		t.Error("_listmap.tpl should not be written")
+	}
+}
+
+func TestRewriteTemplatesBackupMode(t *testing.T) {
+	t.Parallel()
+
+	chart := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(chart, "templates"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(chart, "templates", "deployment.yaml")
+	tpl := "spec:\n  {{- with .Values.env }}\n  env:\n    {{- toYaml . | nindent 4 }}\n  {{- end }}\n"
+	if err := os.WriteFile(path, []byte(tpl), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// A backup left over under the same name, with a looser mode
+	if err := os.WriteFile(path+".bak", []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []PathInfo{{DotPath: "env", MergeKey: "name"}}
+	changed, _, err := RewriteTemplatesWithBackups(filesystem.OSFileSystem{}, chart, paths, Options{}, ".bak", nil)
+	if err != nil {
+		t.Fatalf("RewriteTemplatesWithBackups() error = %v", err)
+	}
+	if len(changed) != 1 {
+		t.Fatalf("changed = %v, want the deployment rewritten", changed)
+	}
+	for _, p := range []string{path, path + ".bak"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != 0600 {
+			t.Errorf("%s mode = %o, want 600", filepath.Base(p), got)
+		}
+	}
+	if backup, _ := os.ReadFile(path + ".bak"); string(backup) != tpl {
+		t.Errorf("backup = %q, want the original template", backup)
+	}
+}
+
+func TestStyledHelperRendersTheSame(t *testing.T) {
+	items := map[string]interface{}{
+		"b": map[string]interface{}{"value": "2"},
+		"a": map[string]interface{}{"value": "1"},
+	}
+	render := func(style Style) (string, string) {
+		helper := Options{Style: style}.ListMapHelper()
+		tpl := gotemplate.Must(gotemplate.New("helper").Funcs(helmFuncs).Parse(helper))
+		var buf bytes.Buffer
+		if err := tpl.ExecuteTemplate(&buf, DefaultHelperName, map[string]interface{}{"items": items, "key": "name"}); err != nil {
+			t.Fatalf("executing %s: %v", DefaultHelperName, err)
+		}
+		return helper, buf.String()
+	}
+
+	flushHelper, want := render(Style{})
+	for _, indent := range []string{"  ", "\t"} {
+		helper, got := render(Style{Indent: indent})
+		if got != want {
+			t.Errorf("helper indented by %q renders %q, want %q", indent, got, want)
+		}
+		if !strings.Contains(helper, "\n"+indent+"{{- $items := .items") || !strings.Contains(helper, "\n"+indent+indent+"{{- $spec := get $items $keyVal }}") {
+			t.Errorf("helper actions should be indented by %q per block:\n%s", indent, helper)
+		}
+		if !sameDefine(helper, flushHelper, DefaultHelperName) {
+			t.Errorf("helper indented by %q should match the flush-left define", indent)
+		}
+	}
+}
+
+func TestReplaceListBlocksStyle(t *testing.T) {
+	withBlock := `      {{- with .Values.env }}
+      env:
+        {{- toYaml . | nindent 8 }}
+      {{- end }}`
+	rangeBlock := `      ports:
+      {{- range .Values.ports }}
+        - containerPort: {{ .containerPort }}
+      {{- end }}`
+	call := func(path, key, indent string) string {
+		return fmt.Sprintf(`include "chart.listmap.items" (dict "items" (index .Values %q) "key" %q) | %s`, path, key, indent)
+	}
+
+	tests := []struct {
+		name  string
+		style Style
+		tpl   string
+		path  string
+		key   string
+		want  string
+	}{
+		{
+			name:  "with block flush",
+			style: Style{Actions: ActionsFlush},
+			tpl:   withBlock,
+			path:  "env",
+			key:   "name",
+			want:  "{{- if (index .Values \"env\") }}\n      env:\n        {{- " + call("env", "name", "nindent 8") + " }}\n{{- end }}",
+		},
+		{
+			name:  "range block aligned",
+			style: Style{Actions: ActionsAligned},
+			tpl:   rangeBlock,
+			path:  "ports",
+			key:   "containerPort",
+			want:  "      {{- if (index .Values \"ports\") }}\n      ports:\n{{- " + call("ports", "containerPort", "nindent 8") + " }}\n      {{- end }}",
+		},
+		{
+			name:  "range block untrimmed",
+			style: Style{Actions: ActionsAligned, NoTrim: true},
+			tpl:   rangeBlock,
+			path:  "ports",
+			key:   "containerPort",
+			want:  "      {{ if (index .Values \"ports\") }}\n      ports:\n{{ " + call("ports", "containerPort", "indent 8") + " }}\n      {{ end }}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := ReplaceListBlocks(tt.tpl, tt.path, tt.key, Options{Style: tt.style})
+			if !changed || got != tt.want {
+				t.Errorf("ReplaceListBlocks() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectStyle(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  Style
+	}{
+		{
+			name: "unsettled",
+			files: map[string]string{
+				"_helpers.tpl":    "{{- define \"app.name\" -}}\n{{- .Chart.Name }}\n{{- end -}}\n",
+				"deployment.yaml": "{{- if .Values.enabled }}\nkind: Deployment\n{{- end }}\n",
+			},
+			want: Style{},
+		},
+		{
+			name: "indented with tabs, actions aligned",
+			files: map[string]string{
+				"_helpers.tpl":    "{{- define \"app.name\" -}}\n\t{{- if .Values.nameOverride }}\n\t\t{{- .Values.nameOverride }}\n\t{{- end }}\n{{- end -}}\n",
+				"deployment.yaml": "spec:\n  {{- with .Values.env }}\n  env:\n    {{- toYaml . | nindent 4 }}\n  {{- end }}\n",
+			},
+			want: Style{Indent: "\t", Actions: ActionsAligned},
+		},
+		{
+			name: "indented by 4, flush untrimmed actions",
+			files: map[string]string{
+				"_helpers.tpl":    "{{- define \"app.name\" -}}\n    {{- if .Values.nameOverride }}\n        {{- .Values.nameOverride }}\n    {{- end }}\n{{- end -}}\n",
+				"deployment.yaml": "spec:\n{{ if .Values.env }}\n  env:\n{{ toYaml .Values.env | indent 4 }}\n{{ end }}\n",
+			},
+			want: Style{Indent: "    ", Actions: ActionsFlush, NoTrim: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			chart := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(chart, "templates"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(chart, "templates", name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := DetectStyle(filesystem.OSFileSystem{}, chart); got != tt.want {
+				t.Errorf("DetectStyle() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoveValuesReferences(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		tpl      string
+		from, to string
+		want     string
+	}{
+		{
+			name: "fields and paths under them",
+			tpl:  `{{- if .Values.extraEnvVars }}{{ $.Values.extraEnvVars.A.value }}{{ end }}`,
+			from: "extraEnvVars",
+			to:   "env",
+			want: `{{- if .Values.env }}{{ $.Values.env.A.value }}{{ end }}`,
+		},
+		{
+			name: "longer keys left alone",
+			tpl:  `{{ .Values.extraEnvVarsCM }} {{ .Values.app.extraEnvVars }}`,
+			from: "extraEnvVars",
+			to:   "env",
+			want: `{{ .Values.extraEnvVarsCM }} {{ .Values.app.extraEnvVars }}`,
+		},
+		{
+			name: "helper call index",
+			tpl:  `{{- include "chart.listmap.items" (dict "items" (index .Values "pod" "volumes") "key" "name") | nindent 8 }}`,
+			from: "pod.volumes",
+			to:   "volumes",
+			want: `{{- include "chart.listmap.items" (dict "items" (index .Values "volumes") "key" "name") | nindent 8 }}`,
+		},
+		{
+			name: "index under the path",
+			tpl:  `{{ index $.Values "volumes" "data" }} {{ index .Values "volumesExtra" }}`,
+			from: "volumes",
+			to:   "pod.volumes",
+			want: `{{ index $.Values "pod" "volumes" "data" }} {{ index .Values "volumesExtra" }}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, changed := MoveValuesReferences(tt.tpl, tt.from, tt.to)
+			if got != tt.want || changed != (tt.tpl != tt.want) {
+				t.Errorf("MoveValuesReferences() = %s, %v\nwant %s", got, changed, tt.want)
+			}
+		})
+	}
+}
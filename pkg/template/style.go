@@ -0,0 +1,161 @@
+package template
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+)
+
+// Placement of the if and end actions convert wraps rewritten lists in
+const (
+	ActionsAligned = "aligned" // at the indentation of the YAML they wrap
+	ActionsFlush   = "flush"   // flush left
+)
+
+// Style is the layout of the template code convert generates, so converted
+// charts read like the rest of their templates and pass the same style checks.
+// The zero Style lays code out as the plugin always has.
+type Style struct {
+	// Indent indents the actions of the generated helper once per enclosing
+	// block ("" keeps them flush left). The actions trim the whitespace
+	// before them, so this changes only how the template reads.
+	Indent string
+	// Actions places the if and end actions around rewritten lists:
+	// ActionsAligned or ActionsFlush ("" keeps each pattern's placement)
+	Actions string
+	// NoTrim writes the actions around rewritten lists without trim markers
+	// ({{ if rather than {{- if), for charts written without them
+	NoTrim bool
+}
+
+// trim returns the trim marker opening generated block actions
+func (s Style) trim() string {
+	if s.NoTrim {
+		return ""
+	}
+	return "-"
+}
+
+// actionIndent returns the indentation of a generated block action wrapping
+// YAML indented by yamlIndent, or def when the style keeps the pattern's own
+func (s Style) actionIndent(yamlIndent, def string) string {
+	switch s.Actions {
+	case ActionsAligned:
+		return yamlIndent
+	case ActionsFlush:
+		return ""
+	}
+	return def
+}
+
+// reLineAction matches a line starting with a template action, capturing its
+// indentation, trim marker, and keyword
+var reLineAction = regexp.MustCompile(`^([ \t]*)\{\{(-?)\s*(define|if|with|range|block|else|end)\b`)
+
+// indentActions indents each line of helper starting with a trimmed action
+// by its block depth. Other lines render output and are left as they are.
+func indentActions(helper, unit string) string {
+	if unit == "" {
+		return helper
+	}
+	lines := strings.Split(helper, "\n")
+	depth := 0
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "{{-") {
+			continue
+		}
+		level := depth
+		if m := reLineAction.FindStringSubmatch(line); m != nil {
+			switch m[3] {
+			case "end":
+				depth--
+				level = depth
+			case "else":
+				level = depth - 1
+			default:
+				depth++
+			}
+		}
+		if level > 0 {
+			lines[i] = strings.Repeat(unit, level) + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DetectStyle returns the style of the chart's own templates: the indentation
+// of actions nested in its helper defines, and where and with which trim
+// markers its manifests place block actions. Properties the templates don't
+// settle are left at the zero Style.
+func DetectStyle(filesystem fs.FileSystem, root string) Style {
+	files, err := readTemplates(filesystem, root)
+	if err != nil {
+		return Style{}
+	}
+	var s Style
+	var tabs bool
+	minSpaces := 0
+	var aligned, flush, trimmed, untrimmed int
+	for _, f := range files {
+		rel, _ := filepath.Rel(root, f.path)
+		if filepath.ToSlash(rel) == helperPath {
+			continue
+		}
+		lines := strings.Split(string(fs.Normalize(f.data)), "\n")
+		partial := fs.IsPartial(f.path)
+		for i, line := range lines {
+			m := reLineAction.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			if partial {
+				switch {
+				case strings.HasPrefix(m[1], "\t"):
+					tabs = true
+				case m[1] != "" && (minSpaces == 0 || len(m[1]) < minSpaces):
+					minSpaces = len(m[1])
+				}
+				continue
+			}
+			if m[2] == "-" {
+				trimmed++
+			} else {
+				untrimmed++
+			}
+			if m[1] != "" {
+				aligned++
+			} else if next := nextContentLine(lines[i+1:]); next != "" && next != strings.TrimLeft(next, " ") {
+				// Flush left above indented YAML; top-level actions settle nothing
+				flush++
+			}
+		}
+	}
+	switch {
+	case tabs:
+		s.Indent = "\t"
+	case minSpaces > 0:
+		s.Indent = strings.Repeat(" ", minSpaces)
+	}
+	switch {
+	case aligned > flush:
+		s.Actions = ActionsAligned
+	case flush > aligned:
+		s.Actions = ActionsFlush
+	}
+	s.NoTrim = untrimmed > trimmed
+	return s
+}
+
+// nextContentLine returns the first line of lines that isn't blank and doesn't
+// start with an action, or "" if there is none
+func nextContentLine(lines []string) string {
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && !strings.HasPrefix(trimmed, "{{") {
+			return line
+		}
+	}
+	return ""
+}
@@ -1,8 +1,98 @@
 package template
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/detect"
+)
+
 // PathInfo holds information about a values path to be converted
 type PathInfo struct {
 	DotPath     string
-	MergeKey    string // The patchMergeKey from K8s API (e.g., "name", "mountPath", "containerPort")
-	SectionName string // The YAML section name (e.g., "volumes", "volumeMounts", "ports")
+	MergeKey    string   // The patchMergeKey from K8s API (e.g., "name", "mountPath", "containerPort")
+	SectionName string   // The YAML section name (e.g., "volumes", "volumeMounts", "ports")
+	Ordered     bool     // Render through the dependency-ordered helper (env vars)
+	OrderField  bool     // Render sorted by each item's order field
+	Set         bool     // Render the keys set to true (scalar and single-field lists)
+	MergeKeys   []string // Key fields of a multi-key map, outermost first (KeyStrategy set)
+	KeyStrategy string   // "nested" or "composite" for maps keyed by MergeKeys
+	// Rename maps item fields to the names map entries use (value: v)
+	Rename map[string]string
+	// Scalar is the item field an entry holding only it is shortened to (FOO: bar)
+	Scalar string
+	// Synthetic renders entries without MergeKey, which only names them
+	Synthetic bool
+	// NewPath is the values path the list moves to (renamePaths), whose
+	// references replace DotPath's once the templates are rewritten
+	NewPath string
+}
+
+// shaped reports whether the path's map entries have a custom shape
+func (p PathInfo) shaped() bool {
+	return len(p.Rename) > 0 || p.Scalar != ""
+}
+
+// helper returns the define name the path is rendered through
+func (p PathInfo) helper(o Options) string {
+	switch {
+	case p.shaped():
+		return o.ShapedHelperName()
+	case p.KeyStrategy == detect.KeyStrategyNested:
+		return o.NestedHelperName()
+	case p.KeyStrategy == detect.KeyStrategyComposite:
+		return o.CompositeHelperName()
+	case p.Set:
+		return o.SetHelperName()
+	case p.Synthetic:
+		return o.SyntheticHelperName()
+	case p.OrderField:
+		return o.ByOrderHelperName()
+	case p.Ordered:
+		return o.OrderedHelperName()
+	}
+	return o.Helper()
+}
+
+// helperArgs returns the key arguments of the helper call for the path:
+// "key" "name", or "keys" (list "namespace" "name") for multi-key maps
+func (p PathInfo) helperArgs() string {
+	if p.KeyStrategy != "" {
+		return keysArg(p.MergeKeys)
+	}
+	args := fmt.Sprintf(`"key" %q`, p.MergeKey)
+	if p.Scalar != "" {
+		args += fmt.Sprintf(` "scalar" %q`, p.Scalar)
+	}
+	if len(p.Rename) > 0 {
+		// The helper maps entry fields back to item fields
+		fields := make([]string, 0, len(p.Rename))
+		for field := range p.Rename {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		var pairs []string
+		for _, field := range fields {
+			pairs = append(pairs, fmt.Sprintf("%q %q", p.Rename[field], field))
+		}
+		args += fmt.Sprintf(` "rename" (dict %s)`, strings.Join(pairs, " "))
+	}
+	return args
+}
+
+// keysArg returns the "keys" argument of a multi-key helper call
+func keysArg(keys []string) string {
+	quoted := make([]string, len(keys))
+	for i, k := range keys {
+		quoted[i] = fmt.Sprintf("%q", k)
+	}
+	return fmt.Sprintf(`"keys" (list %s)`, strings.Join(quoted, " "))
+}
+
+// TemplateRewrite holds the proposed content of a template file
+type TemplateRewrite struct {
+	Path     string // Path relative to the chart root (e.g., "templates/deployment.yaml")
+	Original string
+	Updated  string
 }
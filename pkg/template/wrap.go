@@ -0,0 +1,77 @@
+package template
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// requiredMessage matches the quoted message passed to required
+const requiredMessage = `("(?:[^"\\]|\\.)*")`
+
+// reRequiredAction matches a list wrapped by required and rendered with toYaml:
+// {{- toYaml (required "msg" .Values.A) | nindent N }}, or the piped
+// (required "msg" .Values.A) | toYaml form, with the same stages as
+// ReplaceListBlocksWith accepts
+var reRequiredAction = regexp.MustCompile(`\{\{(-?)\s*(?:toYaml\s+\(\s*required\s+` + requiredMessage + `\s+\$?\.Values\.([a-zA-Z0-9_.]+)\s*\)|\(?\s*required\s+` + requiredMessage + `\s+\$?\.Values\.([a-zA-Z0-9_.]+)\s*\)?\s*\|\s*toYaml)` + pipelineStages + `\s*(-?)\}\}`)
+
+// reCoalesceAction matches the first non-empty of lists picked with coalesce
+// and rendered with toYaml, in either form
+var reCoalesceAction = regexp.MustCompile(`\{\{(-?)\s*(?:toYaml\s+\(\s*coalesce` + concatArgs + `\s*\)|\(?\s*coalesce` + concatArgs + `\s*\)?\s*\|\s*toYaml)` + pipelineStages + `\s*(-?)\}\}`)
+
+// ReplaceWrappedBlocks replaces toYaml calls on lists wrapped by required or
+// coalesce with the listmap helper, keeping the wrapper around the converted
+// maps: required still fails the render when the map is unset, and coalesce
+// still renders the first non-empty map. A coalesce is only rewritten when
+// every path in it is converted with the same merge key and helper, as
+// ReplaceConcatBlocks requires.
+func ReplaceWrappedBlocks(tpl string, paths []PathInfo, o Options) (string, bool) {
+	converted := make(map[string]PathInfo, len(paths))
+	for _, p := range paths {
+		converted[p.DotPath] = p
+	}
+
+	changed := false
+	tpl = reRequiredAction.ReplaceAllStringFunc(tpl, func(match string) string {
+		submatches := reRequiredAction.FindStringSubmatch(match)
+		stages, ok := parsePipeline(submatches[6])
+		if !ok {
+			return match
+		}
+		p, ok := converted[submatches[3]+submatches[5]]
+		if !ok {
+			return match
+		}
+		changed = true
+		items := fmt.Sprintf("(required %s (index %s %s))", submatches[2]+submatches[4], valuesRoot(match), QuotePath(p.DotPath))
+		call := fmt.Sprintf(`include %q (dict "items" %s %s)`, p.helper(o), items, p.helperArgs())
+		return fmt.Sprintf(`{{%s %s %s}}`, submatches[1], strings.Join(append([]string{call}, stages...), " | "), submatches[7])
+	})
+
+	tpl = reCoalesceAction.ReplaceAllStringFunc(tpl, func(match string) string {
+		submatches := reCoalesceAction.FindStringSubmatch(match)
+		stages, ok := parsePipeline(submatches[4])
+		if !ok {
+			return match
+		}
+		var picked []PathInfo
+		var roots []string
+		for _, m := range reConcatValuesArg.FindAllStringSubmatch(submatches[2]+submatches[3], -1) {
+			p, ok := converted[m[1]]
+			if !ok || (len(picked) > 0 && (p.helperArgs() != picked[0].helperArgs() || p.helper(o) != picked[0].helper(o))) {
+				return match
+			}
+			picked = append(picked, p)
+			roots = append(roots, valuesRoot(m[0]))
+		}
+
+		var items []string
+		for i, p := range picked {
+			items = append(items, fmt.Sprintf("(index %s %s)", roots[i], QuotePath(p.DotPath)))
+		}
+		changed = true
+		call := fmt.Sprintf(`include %q (dict "items" (coalesce %s) %s)`, picked[0].helper(o), strings.Join(items, " "), picked[0].helperArgs())
+		return fmt.Sprintf(`{{%s %s %s}}`, submatches[1], strings.Join(append([]string{call}, stages...), " | "), submatches[5])
+	})
+	return tpl, changed
+}
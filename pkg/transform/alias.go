@@ -0,0 +1,76 @@
+package transform
+
+import (
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FindAliasedPaths returns the places an anchored list is reused through a
+// plain alias (e.g., env: *env). Converting the anchored list converts every
+// alias of it too, so an alias path must be converted along with its source or
+// not at all. An alias inside a list item has no values path (Path is empty).
+func FindAliasedPaths(node *yaml.Node) []MergedPath {
+	sources := make(map[*yaml.Node]string)
+	directLists(node, nil, sources)
+
+	var aliased []MergedPath
+	walkAliases(node, nil, true, sources, &aliased)
+	sort.Slice(aliased, func(i, j int) bool {
+		if aliased[i].Source != aliased[j].Source {
+			return aliased[i].Source < aliased[j].Source
+		}
+		return aliased[i].Path < aliased[j].Path
+	})
+	return aliased
+}
+
+// walkAliases records every alias of a directly set list. Merge keys are left
+// to FindMergedPaths. Below a list item or a dotted key, paths are not
+// addressable and aliases are recorded without one.
+func walkAliases(node *yaml.Node, path []string, addressable bool, sources map[*yaml.Node]string, aliased *[]MergedPath) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			walkAliases(child, path, addressable, sources, aliased)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			if isMergeKey(k) {
+				continue
+			}
+			p := append(path, k.Value)
+			ok := addressable && isPathSegment(k.Value)
+			if v.Kind == yaml.AliasNode {
+				recordAlias(v, p, ok, sources, aliased)
+				continue
+			}
+			walkAliases(v, p, ok, sources, aliased)
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if item.Kind == yaml.AliasNode {
+				recordAlias(item, nil, false, sources, aliased)
+				continue
+			}
+			walkAliases(item, path, false, sources, aliased)
+		}
+	}
+}
+
+// recordAlias records an alias whose anchor is a directly set list
+func recordAlias(alias *yaml.Node, path []string, addressable bool, sources map[*yaml.Node]string, aliased *[]MergedPath) {
+	if alias.Alias == nil || alias.Alias.Kind != yaml.SequenceNode {
+		return
+	}
+	source, ok := sources[alias.Alias]
+	if !ok {
+		return
+	}
+	m := MergedPath{Source: source, Alias: true}
+	if addressable {
+		m.Path = dotPath(path)
+	}
+	*aliased = append(*aliased, m)
+}
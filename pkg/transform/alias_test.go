@@ -0,0 +1,74 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestFindAliasedPaths(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		in   string
+		want []MergedPath
+	}{
+		{
+			name: "anchored list without aliases",
+			in: `env: &env
+  - name: A
+`,
+		},
+		{
+			name: "alias under another key",
+			in: `env: &env
+  - name: A
+migrations:
+  env: *env
+`,
+			want: []MergedPath{{Path: "migrations.env", Source: "env", Alias: true}},
+		},
+		{
+			name: "alias inside a list item",
+			in: `env: &env
+  - name: A
+jobs:
+  - name: backup
+    env: *env
+`,
+			want: []MergedPath{{Source: "env", Alias: true}},
+		},
+		{
+			name: "alias of a mapping is not a list",
+			in: `defaults: &defaults
+  image: nginx
+worker: *defaults
+`,
+		},
+		{
+			name: "merge keys are left to FindMergedPaths",
+			in: `defaults: &defaults
+  env:
+    - name: A
+worker:
+  <<: *defaults
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.in), &doc); err != nil {
+				t.Fatal(err)
+			}
+			if got := FindAliasedPaths(&doc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindAliasedPaths() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,16 +4,19 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+
+	filesystem "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
 )
 
 // ApplyLineEdits applies line-based edits to the original file content
-// This approach transforms array items in-place, preserving original formatting
+// This approach transforms array items in-place, preserving original formatting,
+// including a byte-order mark, CRLF line endings, and the final newline state
 func ApplyLineEdits(original []byte, edits []ArrayEdit) []byte {
 	if len(edits) == 0 {
 		return original
 	}
 
-	lines := strings.Split(string(original), "\n")
+	lines := strings.Split(string(filesystem.Normalize(original)), "\n")
 
 	// Sort edits by line number in descending order (edit from bottom to top)
 	// This way line numbers don't shift as we make edits
@@ -23,6 +26,9 @@ func ApplyLineEdits(original []byte, edits []ArrayEdit) []byte {
 		return sortedEdits[i].KeyLine > sortedEdits[j].KeyLine
 	})
 
+	// Lines from the previously applied (lower) edit onward, including the comment
+	// it inserted, must not be mistaken for commented-out examples
+	scanEnd := len(lines)
 	for _, edit := range sortedEdits {
 		keyLineIdx := edit.KeyLine - 1
 		valueEndIdx := edit.ValueEndLine - 1
@@ -37,12 +43,9 @@ func ApplyLineEdits(original []byte, edits []ArrayEdit) []byte {
 			continue
 		}
 
-		// Build the comment to insert (use key's column for proper indentation)
-		// keyColumn is 1-based in yaml.Node, so subtract 1 for 0-based string index
-		commentIndent := ""
-		if edit.KeyColumn > 1 {
-			commentIndent = strings.Repeat(" ", edit.KeyColumn-1)
-		}
+		// Build the comment to insert, indented like the key's line: a key on
+		// a list item's dash line (- env:) is commented at the dash
+		commentIndent := keyLine[:len(keyLine)-len(strings.TrimLeft(keyLine, " "))]
 		// Build JSONPath-style comment: Kind.spec.path (key: mergeKey)
 		jsonPath := edit.Candidate.YAMLPath
 		if edit.Candidate.ResourceKind != "" {
@@ -52,13 +55,31 @@ func ApplyLineEdits(original []byte, edits []ArrayEdit) []byte {
 			commentIndent,
 			jsonPath,
 			edit.Candidate.MergeKey)
+		if jsonPath == "" {
+			// No resource path is known for paths taken from a converted chart
+			comment = fmt.Sprintf("%s# (key: %s)", commentIndent, edit.Candidate.MergeKey)
+		}
+		if edit.Candidate.Set {
+			comment = fmt.Sprintf("%s# %s", commentIndent, strings.TrimSpace(jsonPath+" (set: <value>: true)"))
+		}
+		if edit.Candidate.KeyStrategy != "" {
+			comment = fmt.Sprintf("%s# %s", commentIndent, strings.TrimSpace(fmt.Sprintf("%s (keys: %s; %s)",
+				jsonPath, strings.Join(edit.Candidate.MergeKeys, ", "), edit.Candidate.KeyStrategy)))
+		}
+		if edit.Candidate.Shaped() {
+			comment = fmt.Sprintf("%s# %s", commentIndent, strings.TrimSpace(fmt.Sprintf("%s (key: %s; %s)",
+				jsonPath, edit.Candidate.MergeKey, edit.Candidate.ShapeDescription())))
+		}
+		if edit.Candidate.Synthetic {
+			comment = fmt.Sprintf("%s# %s", commentIndent, strings.TrimSpace(jsonPath+" (synthetic key: <entry name>: {...})"))
+		}
 
-		afterColon := strings.TrimSpace(keyLine[colonIdx+1:])
+		afterColon, lineComment := splitLineComment(keyLine[colonIdx+1:])
 
-		if afterColon == "[]" || afterColon == "{}" {
-			// Inline empty array/map - add comment and change [] to {}
+		if edit.ValueEndLine == edit.KeyLine && isEmptyValue(afterColon) {
+			// Inline empty array/map or null - add comment and change it to {}
 			// Also remove any commented-out array examples that follow
-			newKeyLine := keyLine[:colonIdx+1] + " {}"
+			newKeyLine := keyLine[:colonIdx+1] + " {}" + lineComment
 
 			// Find where commented-out examples end (lines starting with #, indented more than key)
 			// These are stale array-syntax examples like "# - name: foo"
@@ -67,7 +88,7 @@ func ApplyLineEdits(original []byte, edits []ArrayEdit) []byte {
 			lastCommentLine := keyLineIdx // Track the last actual comment line
 			inArrayExample := false       // Track if we're inside a commented array example block
 
-			for i := keyLineIdx + 1; i < len(lines); i++ {
+			for i := keyLineIdx + 1; i < scanEnd && !edit.KeepExamples; i++ {
 				line := lines[i]
 				trimmed := strings.TrimSpace(line)
 
@@ -119,7 +140,7 @@ func ApplyLineEdits(original []byte, edits []ArrayEdit) []byte {
 			// but preserve blank line separators before the next section
 			if lastCommentLine > keyLineIdx {
 				// Check if there's a blank line right after the last comment
-				for i := lastCommentLine + 1; i < len(lines); i++ {
+				for i := lastCommentLine + 1; i < scanEnd; i++ {
 					if strings.TrimSpace(lines[i]) == "" {
 						endOfCommentedExamples = i + 1
 					} else {
@@ -129,8 +150,7 @@ func ApplyLineEdits(original []byte, edits []ArrayEdit) []byte {
 			}
 
 			newLines := make([]string, 0, len(lines)+1)
-			newLines = append(newLines, lines[:keyLineIdx]...)
-			newLines = append(newLines, comment)
+			newLines = append(newLines, headerLines(lines, keyLineIdx, comment, edit.Candidate.MergeKey)...)
 			newLines = append(newLines, newKeyLine)
 			// Skip the commented-out examples, but add back a blank line if there was content removed
 			if endOfCommentedExamples > keyLineIdx+1 && endOfCommentedExamples < len(lines) {
@@ -153,12 +173,33 @@ func ApplyLineEdits(original []byte, edits []ArrayEdit) []byte {
 			}
 			mapEntryIndent := parentKeyIndent + 2 // Map entries should be indented under parent key
 			transformedLines := TransformArrayToMapWithIndent(arrayLines, edit.Candidate.MergeKey, mapEntryIndent)
+			if edit.OrderField != "" {
+				transformedLines = AddOrderFields(transformedLines, mapEntryIndent, edit.OrderField)
+			}
+			if edit.Candidate.Set {
+				// Set entries are single "value: true" lines; a flow list on
+				// the key line (args: [a, b]) is replaced along with the items
+				transformedLines = nil
+				for _, line := range strings.Split(edit.Replacement, "\n") {
+					transformedLines = append(transformedLines, strings.Repeat(" ", mapEntryIndent)+strings.TrimLeft(line, " "))
+				}
+				keyLine = keyLine[:colonIdx+1] + lineComment
+			}
+			if edit.Candidate.KeyStrategy != "" || edit.Candidate.Shaped() || edit.Candidate.Synthetic {
+				// Multi-key, reshaped, and synthetically keyed maps are
+				// generated whole, nested under the key line
+				transformedLines = nil
+				for _, line := range strings.Split(edit.Replacement, "\n") {
+					transformedLines = append(transformedLines, strings.Repeat(" ", mapEntryIndent)+line)
+				}
+				keyLine = keyLine[:colonIdx+1] + lineComment
+			}
 
 			// Check for commented-out examples after the array that should be removed
 			// These are comments that look like YAML structure (e.g., "#   secret:" or "# - name:")
 			endOfCommentedExamples := valueEndIdx + 1
 
-			for i := valueEndIdx + 1; i < len(lines); i++ {
+			for i := valueEndIdx + 1; i < scanEnd && !edit.KeepExamples; i++ {
 				line := lines[i]
 				trimmed := strings.TrimSpace(line)
 
@@ -194,8 +235,7 @@ func ApplyLineEdits(original []byte, edits []ArrayEdit) []byte {
 
 			// Build new content
 			newLines := make([]string, 0, len(lines))
-			newLines = append(newLines, lines[:keyLineIdx]...)
-			newLines = append(newLines, comment)
+			newLines = append(newLines, headerLines(lines, keyLineIdx, comment, edit.Candidate.MergeKey)...)
 			newLines = append(newLines, keyLine) // Keep original key line (e.g., "env:")
 			newLines = append(newLines, transformedLines...)
 			// Skip trailing commented examples, add blank line if needed
@@ -207,7 +247,17 @@ func ApplyLineEdits(original []byte, edits []ArrayEdit) []byte {
 			}
 			lines = newLines
 		}
+		scanEnd = keyLineIdx
 	}
 
-	return []byte(strings.Join(lines, "\n"))
+	return filesystem.MatchFormat(original, []byte(strings.Join(lines, "\n")))
+}
+
+// isEmptyValue reports whether an inline value is an empty list or map, or null
+func isEmptyValue(v string) bool {
+	switch v {
+	case "[]", "{}", "", "~", "null", "Null", "NULL":
+		return true
+	}
+	return false
 }
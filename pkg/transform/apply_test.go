@@ -0,0 +1,333 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"gopkg.in/yaml.v3"
+)
+
+func TestApplyLineEditsKeepsFormat(t *testing.T) {
+	t.Parallel()
+
+	candidates := map[string]k8s.DetectedCandidate{
+		"env": {ValuesPath: "env", MergeKey: "name", YAMLPath: "spec.env"},
+	}
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "BOM before the first key",
+			in:   "\xef\xbb\xbfenv:\n  - name: A\n    value: a\n",
+			want: "\xef\xbb\xbf# spec.env (key: name)\nenv:\n  A:\n    value: a\n",
+		},
+		{
+			name: "CRLF without a final newline",
+			in:   "env:\r\n  - name: A\r\n    value: a",
+			want: "# spec.env (key: name)\r\nenv:\r\n  A:\r\n    value: a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.in), &doc); err != nil {
+				t.Fatal(err)
+			}
+			var edits []ArrayEdit
+			FindArrayEdits(&doc, nil, candidates, &edits)
+			if got := string(ApplyLineEdits([]byte(tt.in), edits)); got != tt.want {
+				t.Errorf("ApplyLineEdits() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyLineEditsEmptyValues(t *testing.T) {
+	t.Parallel()
+
+	candidates := map[string]k8s.DetectedCandidate{
+		"env": {ValuesPath: "env", MergeKey: "name"},
+	}
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"env: []\nreplicas: 1\n", "# (key: name)\nenv: {}\nreplicas: 1\n"},
+		{"env:\nreplicas: 1\n", "# (key: name)\nenv: {}\nreplicas: 1\n"},
+		{"env: null\n", "# (key: name)\nenv: {}\n"},
+		{"env: ~ # none yet\n", "# (key: name)\nenv: {} # none yet\n"},
+		{"env: [] # none yet\n", "# (key: name)\nenv: {} # none yet\n"},
+		{"env:\n# - name: FOO\n#   value: bar\n\nreplicas: 1\n", "# (key: name)\nenv: {}\n\nreplicas: 1\n"},
+	}
+	for _, tt := range tests {
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(tt.in), &doc); err != nil {
+			t.Fatal(err)
+		}
+		var edits []ArrayEdit
+		FindArrayEditsWithOptions(&doc, nil, candidates, EditOptions{NullAsEmpty: true}, &edits)
+		if got := string(ApplyLineEdits([]byte(tt.in), edits)); got != tt.want {
+			t.Errorf("ApplyLineEdits(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestApplyLineEditsAdjacentEdits(t *testing.T) {
+	t.Parallel()
+
+	// Edits are applied bottom up. The comment an edit inserts above its key
+	// must not be taken for a commented-out example of the list above it.
+	candidates := map[string]k8s.DetectedCandidate{
+		"env":         {ValuesPath: "env", MergeKey: "name", YAMLPath: "spec.env"},
+		"volumes":     {ValuesPath: "volumes", MergeKey: "name", YAMLPath: "spec.volumes"},
+		"app.env":     {ValuesPath: "app.env", MergeKey: "name", YAMLPath: "spec.env"},
+		"app.volumes": {ValuesPath: "app.volumes", MergeKey: "name", YAMLPath: "spec.volumes"},
+	}
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "empty list above a list",
+			in:   "env: []\nvolumes:\n  - name: a\n",
+			want: "# spec.env (key: name)\nenv: {}\n# spec.volumes (key: name)\nvolumes:\n  a: {}\n",
+		},
+		{
+			name: "nested lists",
+			in:   "app:\n  env:\n    - name: A\n  volumes:\n    - name: a\n",
+			want: "app:\n  # spec.env (key: name)\n  env:\n    A: {}\n  # spec.volumes (key: name)\n  volumes:\n    a: {}\n",
+		},
+		{
+			name: "commented example above a list",
+			in:   "app:\n  env:\n    - name: A\n  # - name: B\n  volumes:\n    - name: a\n",
+			want: "app:\n  # spec.env (key: name)\n  env:\n    A: {}\n\n  # spec.volumes (key: name)\n  volumes:\n    a: {}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.in), &doc); err != nil {
+				t.Fatal(err)
+			}
+			var edits []ArrayEdit
+			FindArrayEdits(&doc, nil, candidates, &edits)
+			if got := string(ApplyLineEdits([]byte(tt.in), edits)); got != tt.want {
+				t.Errorf("ApplyLineEdits() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyLineEditsComment(t *testing.T) {
+	t.Parallel()
+
+	// The comment names the resource field when it's known, as it isn't for
+	// paths read back from a converted chart
+	in := "env:\n  - name: A\n    value: a\n"
+	tests := []struct {
+		yamlPath string
+		want     string
+	}{
+		{"spec.template.spec.containers.env", "# spec.template.spec.containers.env (key: name)\nenv:\n  A:\n    value: a\n"},
+		{"", "# (key: name)\nenv:\n  A:\n    value: a\n"},
+	}
+	for _, tt := range tests {
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(in), &doc); err != nil {
+			t.Fatal(err)
+		}
+		candidates := map[string]k8s.DetectedCandidate{
+			"env": {ValuesPath: "env", MergeKey: "name", YAMLPath: tt.yamlPath},
+		}
+		var edits []ArrayEdit
+		FindArrayEdits(&doc, nil, candidates, &edits)
+		if got := string(ApplyLineEdits([]byte(in), edits)); got != tt.want {
+			t.Errorf("ApplyLineEdits() with YAMLPath %q = %q, want %q", tt.yamlPath, got, tt.want)
+		}
+	}
+}
+
+func TestApplyLineEditsCommentOnDashLine(t *testing.T) {
+	t.Parallel()
+
+	// A list item's first key, as in a helmfile release's values, is
+	// commented at the item's dash
+	in := "values:\n  - env:\n      - name: A\n        value: a\n"
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(in), &doc); err != nil {
+		t.Fatal(err)
+	}
+	item := doc.Content[0].Content[1].Content[0]
+	candidates := map[string]k8s.DetectedCandidate{
+		"env": {ValuesPath: "env", MergeKey: "name", YAMLPath: "spec.template.spec.containers.env"},
+	}
+	var edits []ArrayEdit
+	FindArrayEdits(item, nil, candidates, &edits)
+	want := "values:\n  # spec.template.spec.containers.env (key: name)\n  - env:\n      A:\n        value: a\n"
+	if got := string(ApplyLineEdits([]byte(in), edits)); got != want {
+		t.Errorf("ApplyLineEdits() = %q, want %q", got, want)
+	}
+	var out yaml.Node
+	if err := yaml.Unmarshal([]byte(want), &out); err != nil {
+		t.Errorf("converted values don't parse: %v", err)
+	}
+}
+
+func TestFindArrayEditsKeepsNullOverrides(t *testing.T) {
+	t.Parallel()
+
+	candidates := map[string]k8s.DetectedCandidate{
+		"env": {ValuesPath: "env", MergeKey: "name"},
+	}
+	// In an override file null drops the chart default; {} would restore it
+	for _, in := range []string{"env:\n", "env: null\n", "env: ~ # drop the defaults\n"} {
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(in), &doc); err != nil {
+			t.Fatal(err)
+		}
+		var edits []ArrayEdit
+		FindArrayEdits(&doc, nil, candidates, &edits)
+		if len(edits) != 0 {
+			t.Errorf("FindArrayEdits(%q) = %+v, want no edits", in, edits)
+		}
+		if got := string(ApplyLineEdits([]byte(in), edits)); got != in {
+			t.Errorf("ApplyLineEdits(%q) = %q, want it unchanged", in, got)
+		}
+	}
+}
+
+func TestApplyLineEditsSet(t *testing.T) {
+	t.Parallel()
+
+	candidates := map[string]k8s.DetectedCandidate{
+		"imagePullSecrets": {ValuesPath: "imagePullSecrets", MergeKey: "name", Set: true},
+		"args":             {ValuesPath: "args", Set: true},
+		"hosts":            {ValuesPath: "hosts", Set: true},
+		"mixed":            {ValuesPath: "mixed", MergeKey: "name", Set: true},
+	}
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"imagePullSecrets:\n  - name: regcred\n  - name: other\n", "# (set: <value>: true)\nimagePullSecrets:\n  regcred: true\n  other: true\n"},
+		{"args:\n  - --verbose\n  - --verbose\n  - \"a: b\"\n", "# (set: <value>: true)\nargs:\n  \"--verbose\": true\n  \"a: b\": true\n"},
+		{"hosts: [a.example.com, b.example.com] # defaults\n", "# (set: <value>: true)\nhosts: # defaults\n  a.example.com: true\n  b.example.com: true\n"},
+		{"hosts: []\n", "# (set: <value>: true)\nhosts: {}\n"},
+		// Items with fields besides the key are not set members
+		{"mixed:\n  - name: a\n    optional: true\n", "mixed:\n  - name: a\n    optional: true\n"},
+	}
+	for _, tt := range tests {
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(tt.in), &doc); err != nil {
+			t.Fatal(err)
+		}
+		var edits []ArrayEdit
+		FindArrayEdits(&doc, nil, candidates, &edits)
+		if got := string(ApplyLineEdits([]byte(tt.in), edits)); got != tt.want {
+			t.Errorf("ApplyLineEdits(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestApplyLineEditsMultiKey(t *testing.T) {
+	t.Parallel()
+
+	keys := []string{"namespace", "name"}
+	candidates := map[string]k8s.DetectedCandidate{
+		"nested":    {ValuesPath: "nested", MergeKey: "namespace", MergeKeys: keys, KeyStrategy: "nested"},
+		"composite": {ValuesPath: "composite", MergeKey: "namespace", MergeKeys: keys, KeyStrategy: "composite"},
+	}
+	items := "  - namespace: ns-a\n    name: svc-a\n    ports: [80]\n  - name: svc-b\n    namespace: ns-a\n  - namespace: ns-b\n    name: svc/c\n    weight: 2\n"
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"nested:\n" + items, "# (keys: namespace, name; nested)\nnested:\n  ns-a:\n    svc-a:\n      ports: [80]\n    svc-b: {}\n  ns-b:\n    svc/c:\n      weight: 2\n"},
+		{"composite:\n" + items, "# (keys: namespace, name; composite)\ncomposite:\n  ns-a/svc-a:\n    ports: [80]\n  ns-a/svc-b: {}\n  ns-b/svc/c:\n    weight: 2\n"},
+		{"nested: []\n", "# (keys: namespace, name; nested)\nnested: {}\n"},
+		// Items sharing every key, or missing one, are left as a list
+		{"nested:\n  - {namespace: a, name: b}\n  - {namespace: a, name: b}\n", "nested:\n  - {namespace: a, name: b}\n  - {namespace: a, name: b}\n"},
+		{"composite:\n  - namespace: a/b\n    name: c\n", "composite:\n  - namespace: a/b\n    name: c\n"},
+	}
+	for _, tt := range tests {
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(tt.in), &doc); err != nil {
+			t.Fatal(err)
+		}
+		var edits []ArrayEdit
+		FindArrayEdits(&doc, nil, candidates, &edits)
+		if got := string(ApplyLineEdits([]byte(tt.in), edits)); got != tt.want {
+			t.Errorf("ApplyLineEdits(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestApplyLineEditsShaped(t *testing.T) {
+	t.Parallel()
+
+	candidates := map[string]k8s.DetectedCandidate{
+		"env":    {ValuesPath: "env", MergeKey: "name", Rename: map[string]string{"valueFrom": "from"}, Scalar: "value"},
+		"clash":  {ValuesPath: "clash", MergeKey: "name", Rename: map[string]string{"a": "b"}},
+		"nokeys": {ValuesPath: "nokeys", MergeKey: "name", Scalar: "value"},
+	}
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{
+			"env:\n  - name: HOST\n    value: example.com\n  - name: TOKEN\n    valueFrom:\n      secretKeyRef: {name: s, key: t}\n  - name: EMPTY\n",
+			"# (key: name; valueFrom as from, scalar value)\nenv:\n  HOST: example.com\n  TOKEN:\n    from:\n      secretKeyRef: {name: s, key: t}\n  EMPTY: {}\n",
+		},
+		// Renaming onto an existing field would lose a value
+		{"clash:\n  - name: x\n    a: 1\n    b: 2\n", "clash:\n  - name: x\n    a: 1\n    b: 2\n"},
+		{"nokeys:\n  - value: 1\n", "nokeys:\n  - value: 1\n"},
+	}
+	for _, tt := range tests {
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(tt.in), &doc); err != nil {
+			t.Fatal(err)
+		}
+		var edits []ArrayEdit
+		FindArrayEdits(&doc, nil, candidates, &edits)
+		if got := string(ApplyLineEdits([]byte(tt.in), edits)); got != tt.want {
+			t.Errorf("ApplyLineEdits(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestApplyLineEditsSynthetic(t *testing.T) {
+	t.Parallel()
+
+	candidates := map[string]k8s.DetectedCandidate{
+		"ingress": {ValuesPath: "ingress", MergeKey: "name", SectionName: "ingress", Synthetic: true},
+	}
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{
+			"ingress:\n  - from:\n      - podSelector: {}\n  - name: monitoring\n    ports:\n      - port: 9090\n  - {}\n",
+			"# (synthetic key: <entry name>: {...})\ningress:\n  ingress-1:\n    from:\n      - podSelector: {}\n  monitoring:\n    ports:\n      - port: 9090\n  ingress-3: {}\n",
+		},
+		// A name given to one item can't take another's generated name
+		{"ingress:\n  - name: ingress-2\n  - {}\n", "ingress:\n  - name: ingress-2\n  - {}\n"},
+	}
+	for _, tt := range tests {
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(tt.in), &doc); err != nil {
+			t.Fatal(err)
+		}
+		var edits []ArrayEdit
+		FindArrayEdits(&doc, nil, candidates, &edits)
+		if got := string(ApplyLineEdits([]byte(tt.in), edits)); got != tt.want {
+			t.Errorf("ApplyLineEdits(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package transform
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/detect"
+	filesystem "github.com/scottrigby/helm-list-to-map-plugin/pkg/fs"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// reCommentPrefix matches the indentation and markers of a comment line,
+	// and the space after them (e.g., "  ## ")
+	reCommentPrefix = regexp.MustCompile(`^(\s*)(#+) ?`)
+	// reKeyLine matches a mapping key line, capturing the key and the rest
+	reKeyLine = regexp.MustCompile(`^(\s*)([^\s#'"\-][^:#]*|"[^"]*"|'[^']*'):(?:\s+(.*))?$`)
+)
+
+// yamlKey is a mapping key line and its indentation
+type yamlKey struct {
+	indent int
+	name   string
+}
+
+// ConvertCommentedExamples rewrites the commented-out examples of candidate
+// lists in a values file to map syntax, so documentation kept in comments
+// doesn't show the old format once the lists are converted. An example is a
+// commented key holding a list (# env:\n#   - name: FOO), or commented list
+// items right below the key they belong to (env: {}\n# - name: FOO). Its
+// values path comes from the keys around it, commented keys included.
+// Examples that can't be converted are left as they are. Returns the
+// rewritten file and the converted values paths, in file order.
+func ConvertCommentedExamples(original []byte, candidates map[string]detect.DetectedCandidate) ([]byte, []string) {
+	lines := strings.Split(string(filesystem.Normalize(original)), "\n")
+
+	var out, converted []string
+	var stack []yamlKey
+	var emptyKey []string // path of the key above, if it has no items
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		switch {
+		case trimmed == "":
+			out = append(out, line)
+			continue
+		case !strings.HasPrefix(trimmed, "#"):
+			out = append(out, line)
+			emptyKey = nil
+			if strings.HasPrefix(trimmed, "-") {
+				stack = popKeys(stack, indent+1)
+				continue
+			}
+			if m := reKeyLine.FindStringSubmatch(line); m != nil {
+				stack = append(popKeys(stack, indent), yamlKey{indent, unquoteKey(m[2])})
+				if value, _ := splitLineComment(" " + m[3]); isEmptyValue(value) {
+					emptyKey = keyPath(stack, indent+1)
+				}
+			}
+			continue
+		}
+
+		// Gather the comment block sharing this line's indentation and markers
+		prefix := reCommentPrefix.FindStringSubmatch(line)
+		marker := prefix[1] + prefix[2]
+		end := i + 1
+		for end < len(lines) {
+			next := reCommentPrefix.FindStringSubmatch(lines[end])
+			if next == nil || next[1]+next[2] != marker {
+				break
+			}
+			end++
+		}
+		block, paths := convertExampleBlock(lines[i:end], marker, keyPath(stack, len(prefix[1])), emptyKey, candidates)
+		out = append(out, block...)
+		converted = append(converted, paths...)
+		emptyKey = nil
+		i = end - 1
+	}
+
+	if len(converted) == 0 {
+		return original, nil
+	}
+	return filesystem.MatchFormat(original, []byte(strings.Join(out, "\n"))), converted
+}
+
+// convertExampleBlock converts the examples in a block of comment lines that
+// all start with marker. parent is the values path the block is nested in, and
+// emptyKey the path of a key without items directly above the block.
+func convertExampleBlock(block []string, marker string, parent, emptyKey []string, candidates map[string]detect.DetectedCandidate) ([]string, []string) {
+	contents := make([]string, len(block))
+	for i, line := range block {
+		contents[i] = strings.TrimRight(line[len(reCommentPrefix.FindString(line)):], " ")
+	}
+
+	var out, converted []string
+	var stack []yamlKey
+	for k := 0; k < len(contents); k++ {
+		content := contents[k]
+		indent := len(content) - len(strings.TrimLeft(content, " "))
+		trimmed := strings.TrimSpace(content)
+
+		// Items commented out below their own key
+		if k == 0 && emptyKey != nil && strings.HasPrefix(trimmed, "- ") {
+			if c, ok := candidates[dotPath(emptyKey)]; ok {
+				end := exampleEnd(contents, k, indent)
+				if lines := convertExample(contents[k:end], c, indent-2); lines != nil {
+					out = append(out, commentLines(lines[1:], marker)...)
+					converted = append(converted, dotPath(emptyKey))
+					k = end - 1
+					continue
+				}
+			}
+		}
+
+		m := reKeyLine.FindStringSubmatch(content)
+		if m == nil {
+			out = append(out, block[k])
+			continue
+		}
+		stack = append(popKeys(stack, indent), yamlKey{indent, unquoteKey(m[2])})
+		if m[3] != "" || k+1 >= len(contents) {
+			out = append(out, block[k])
+			continue
+		}
+		next := contents[k+1]
+		nextIndent := len(next) - len(strings.TrimLeft(next, " "))
+		if !strings.HasPrefix(strings.TrimSpace(next), "- ") || nextIndent < indent {
+			out = append(out, block[k])
+			continue
+		}
+
+		path := dotPath(append(append([]string{}, parent...), keyPath(stack, indent+1)...))
+		c, ok := candidates[path]
+		if !ok {
+			out = append(out, block[k])
+			continue
+		}
+		end := exampleEnd(contents, k+1, nextIndent)
+		lines := convertExample(contents[k:end], c, indent)
+		if lines == nil {
+			out = append(out, block[k])
+			continue
+		}
+		out = append(out, commentLines(lines, marker)...)
+		converted = append(converted, path)
+		k = end - 1
+	}
+	return out, converted
+}
+
+// exampleEnd returns the index after the list items starting at contents[start]
+// with their dashes at itemIndent: lines indented past the dash, or further
+// items. A blank or less indented line ends the list.
+func exampleEnd(contents []string, start, itemIndent int) int {
+	end := start + 1
+	for end < len(contents) {
+		line := contents[end]
+		trimmed := strings.TrimSpace(line)
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if trimmed == "" || indent < itemIndent || (indent == itemIndent && !strings.HasPrefix(trimmed, "- ")) {
+			break
+		}
+		end++
+	}
+	return end
+}
+
+// convertExample converts a commented list example to map syntax, returning
+// its lines with the key line first, indented by keyIndent. example holds the
+// key line followed by the items, or just the items when keyIndent is that of
+// a key above the comment. Returns nil if the example can't be converted.
+func convertExample(example []string, c detect.DetectedCandidate, keyIndent int) []string {
+	items := example
+	if !strings.HasPrefix(strings.TrimSpace(example[0]), "- ") {
+		items = example[1:]
+	}
+	// Parse the example as a list under a key of its own, at the top level
+	itemIndent := len(items[0]) - len(strings.TrimLeft(items[0], " "))
+	src := []string{"example:"}
+	for _, item := range items {
+		src = append(src, "  "+strings.TrimPrefix(item, strings.Repeat(" ", itemIndent)))
+	}
+	raw := []byte(strings.Join(src, "\n") + "\n")
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil
+	}
+	c.ValuesPath = "example"
+	var edits []ArrayEdit
+	FindArrayEdits(&doc, nil, map[string]detect.DetectedCandidate{"example": c}, &edits)
+	if len(edits) == 0 {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(string(ApplyLineEdits(raw, edits)), "\n"), "\n")
+
+	// Drop the comment describing the key, which the example doesn't need
+	for len(lines) > 0 && strings.HasPrefix(lines[0], "#") {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	name := strings.TrimSpace(strings.SplitN(example[0], ":", 2)[0])
+	out := []string{shiftLine(name+":", keyIndent)}
+	for _, line := range lines[1:] {
+		out = append(out, shiftLine(line, keyIndent))
+	}
+	return out
+}
+
+// shiftLine indents line by n spaces, or unindents it by up to -n
+func shiftLine(line string, n int) string {
+	if n >= 0 {
+		return strings.Repeat(" ", n) + line
+	}
+	for ; n < 0 && strings.HasPrefix(line, " "); n++ {
+		line = line[1:]
+	}
+	return line
+}
+
+// commentLines comments out lines with marker, keeping their indentation
+func commentLines(lines []string, marker string) []string {
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			out[i] = marker
+			continue
+		}
+		out[i] = marker + " " + line
+	}
+	return out
+}
+
+// popKeys drops the keys indented at or past indent, which can't contain a
+// line at indent
+func popKeys(stack []yamlKey, indent int) []yamlKey {
+	for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+		stack = stack[:len(stack)-1]
+	}
+	return stack
+}
+
+// keyPath returns the names of the keys indented less than indent
+func keyPath(stack []yamlKey, indent int) []string {
+	var path []string
+	for _, k := range stack {
+		if k.indent < indent {
+			path = append(path, k.name)
+		}
+	}
+	return path
+}
+
+// unquoteKey strips the quotes around a mapping key
+func unquoteKey(k string) string {
+	k = strings.TrimSpace(k)
+	if len(k) >= 2 && (k[0] == '"' || k[0] == '\'') && k[len(k)-1] == k[0] {
+		return k[1 : len(k)-1]
+	}
+	return k
+}
@@ -0,0 +1,146 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+)
+
+func TestConvertCommentedExamples(t *testing.T) {
+	t.Parallel()
+
+	candidates := map[string]k8s.DetectedCandidate{
+		"extraEnvVars":          {ValuesPath: "extraEnvVars", MergeKey: "name"},
+		"app.env":               {ValuesPath: "app.env", MergeKey: "name"},
+		"app.volumes":           {ValuesPath: "app.volumes", MergeKey: "name"},
+		"worker.containerPorts": {ValuesPath: "worker.containerPorts", MergeKey: "containerPort"},
+		"imagePullSecrets":      {ValuesPath: "imagePullSecrets", MergeKey: "name", Set: true},
+	}
+	tests := []struct {
+		name  string
+		in    string
+		want  string
+		paths []string
+	}{
+		{
+			name: "commented key above the key",
+			in: `## @param extraEnvVars Extra environment variables
+## e.g:
+## extraEnvVars:
+##   - name: FOO
+##     value: "bar"
+##
+extraEnvVars: {}
+`,
+			want: `## @param extraEnvVars Extra environment variables
+## e.g:
+## extraEnvVars:
+##   FOO:
+##     value: "bar"
+##
+extraEnvVars: {}
+`,
+			paths: []string{"extraEnvVars"},
+		},
+		{
+			name: "items below their own key",
+			in: `app:
+  env: {}
+  # - name: FOO
+  #   value: bar
+  # - name: BAZ
+  #   value: qux
+  replicas: 1
+`,
+			want: `app:
+  env: {}
+  # FOO:
+  #   value: bar
+  # BAZ:
+  #   value: qux
+  replicas: 1
+`,
+			paths: []string{"app.env"},
+		},
+		{
+			name: "nested commented keys",
+			in: `app:
+  # volumes:
+  #   - name: data
+  #     emptyDir: {}
+  image: nginx
+# worker:
+#   containerPorts:
+#     - containerPort: 8080
+#       protocol: TCP
+`,
+			want: `app:
+  # volumes:
+  #   data:
+  #     emptyDir: {}
+  image: nginx
+# worker:
+#   containerPorts:
+#     8080:
+#       protocol: TCP
+`,
+			paths: []string{"app.volumes", "worker.containerPorts"},
+		},
+		{
+			name: "set",
+			in: `# imagePullSecrets:
+#   - name: regcred
+imagePullSecrets: {}
+`,
+			want: `# imagePullSecrets:
+#   regcred: true
+imagePullSecrets: {}
+`,
+			paths: []string{"imagePullSecrets"},
+		},
+		{
+			name: "examples of other paths and prose are kept",
+			in: `# tolerations:
+#   - key: foo
+# Set env: to a list of variables
+# env:
+#   - name: FOO
+#     value: bar
+`,
+			want: `# tolerations:
+#   - key: foo
+# Set env: to a list of variables
+# env:
+#   - name: FOO
+#     value: bar
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, paths := ConvertCommentedExamples([]byte(tt.in), candidates)
+			if string(got) != tt.want {
+				t.Errorf("ConvertCommentedExamples() =\n%s\nwant:\n%s", got, tt.want)
+			}
+			if !reflect.DeepEqual(paths, tt.paths) {
+				t.Errorf("paths = %v, want %v", paths, tt.paths)
+			}
+		})
+	}
+}
+
+func TestApplyLineEditsKeepExamples(t *testing.T) {
+	t.Parallel()
+
+	in := "env: []\n# - name: FOO\n#   value: bar\nreplicas: 1\n"
+	candidates := map[string]k8s.DetectedCandidate{"env": {ValuesPath: "env", MergeKey: "name"}}
+	edits := []ArrayEdit{{KeyLine: 1, ValueStartLine: 1, ValueEndLine: 1, KeyColumn: 1, Replacement: "{}", Candidate: candidates["env"], KeepExamples: true}}
+	got, _ := ConvertCommentedExamples(ApplyLineEdits([]byte(in), edits), candidates)
+	want := "# (key: name)\nenv: {}\n# FOO:\n#   value: bar\nreplicas: 1\n"
+	if string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
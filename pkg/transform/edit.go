@@ -8,8 +8,23 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-// FindArrayEdits walks the YAML tree and finds all arrays that need conversion
+// EditOptions adjusts how FindArrayEditsWithOptions converts values
+type EditOptions struct {
+	// NullAsEmpty converts a null candidate (env: or env: null) to {}. Only a
+	// chart's own values.yaml should: in an override file null drops the chart
+	// default, and {} would bring it back.
+	NullAsEmpty bool
+}
+
+// FindArrayEdits walks the YAML tree and finds all arrays that need
+// conversion. Null values are left as they are, as override files need.
 func FindArrayEdits(node *yaml.Node, path []string, candidates map[string]detect.DetectedCandidate, edits *[]ArrayEdit) {
+	FindArrayEditsWithOptions(node, path, candidates, EditOptions{}, edits)
+}
+
+// FindArrayEditsWithOptions is FindArrayEdits with options, such as those for
+// a chart's own values.yaml
+func FindArrayEditsWithOptions(node *yaml.Node, path []string, candidates map[string]detect.DetectedCandidate, opts EditOptions, edits *[]ArrayEdit) {
 	if node == nil {
 		return
 	}
@@ -17,21 +32,53 @@ func FindArrayEdits(node *yaml.Node, path []string, candidates map[string]detect
 	switch node.Kind {
 	case yaml.DocumentNode:
 		for _, child := range node.Content {
-			FindArrayEdits(child, path, candidates, edits)
+			FindArrayEditsWithOptions(child, path, candidates, opts, edits)
 		}
 
 	case yaml.MappingNode:
 		for i := 0; i < len(node.Content); i += 2 {
 			keyNode := node.Content[i]
 			valueNode := node.Content[i+1]
+			if isMergeKey(keyNode) {
+				// Merged lists belong to their source; see FindMergedPaths
+				continue
+			}
 
 			key := keyNode.Value
+			if !isPathSegment(key) {
+				continue
+			}
 			p := append(path, key)
 			dp := dotPath(p)
 
 			if candidate, isDetected := candidates[dp]; isDetected {
+				if isNull(valueNode) && opts.NullAsEmpty {
+					// env: or env: null converts like env: []
+					*edits = append(*edits, ArrayEdit{
+						KeyLine:        keyNode.Line,
+						ValueStartLine: keyNode.Line,
+						ValueEndLine:   keyNode.Line,
+						KeyColumn:      keyNode.Column,
+						Replacement:    "{}",
+						Candidate:      candidate,
+					})
+					continue
+				}
 				if valueNode.Kind == yaml.SequenceNode {
 					replacement := GenerateMapReplacement(valueNode, candidate, keyNode.Column)
+					var repeated []string
+					if candidate.Set {
+						replacement, repeated = GenerateSetReplacement(valueNode, candidate, keyNode.Column)
+					}
+					if candidate.KeyStrategy != "" {
+						replacement = GenerateKeyedReplacement(valueNode, candidate)
+					}
+					if candidate.Shaped() {
+						replacement = GenerateShapedReplacement(valueNode, candidate)
+					}
+					if candidate.Synthetic {
+						replacement = GenerateSyntheticReplacement(valueNode, candidate)
+					}
 					if replacement != "" {
 						*edits = append(*edits, ArrayEdit{
 							KeyLine:        keyNode.Line,
@@ -39,6 +86,7 @@ func FindArrayEdits(node *yaml.Node, path []string, candidates map[string]detect
 							ValueEndLine:   getMaxLine(valueNode),
 							KeyColumn:      keyNode.Column,
 							Replacement:    replacement,
+							Repeated:       repeated,
 							Candidate:      candidate,
 						})
 						continue
@@ -46,16 +94,28 @@ func FindArrayEdits(node *yaml.Node, path []string, candidates map[string]detect
 				}
 			}
 
-			FindArrayEdits(valueNode, p, candidates, edits)
+			FindArrayEditsWithOptions(valueNode, p, candidates, opts, edits)
 		}
 
 	case yaml.SequenceNode:
 		for i, item := range node.Content {
-			FindArrayEdits(item, append(path, fmt.Sprintf("[%d]", i)), candidates, edits)
+			FindArrayEditsWithOptions(item, append(path, fmt.Sprintf("[%d]", i)), candidates, opts, edits)
 		}
 	}
 }
 
+// isNull reports whether a value is null (empty, null, or ~)
+func isNull(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.Tag == "!!null"
+}
+
+// isPathSegment reports whether a values key can appear in a dot path. A key
+// containing dots (e.g., a map entry keyed "app.kubernetes.io/name") would be
+// mistaken for nested keys, and .Values.x.y references can't address it.
+func isPathSegment(key string) bool {
+	return !strings.Contains(key, ".")
+}
+
 // dotPath converts a path slice to dot notation
 func dotPath(path []string) string {
 	return strings.Join(path, ".")
@@ -19,6 +19,7 @@ func GenerateMapReplacement(seqNode *yaml.Node, candidate detect.DetectedCandida
 	}
 
 	var lines []string
+	seen := make(map[string]bool)
 	for _, item := range seqNode.Content {
 		if item.Kind != yaml.MappingNode {
 			return "" // Can't convert non-mapping items
@@ -38,9 +39,20 @@ func GenerateMapReplacement(seqNode *yaml.Node, candidate detect.DetectedCandida
 		if keyValue == "" {
 			return "" // Merge key not found
 		}
+		if seen[keyValue] {
+			// e.g., two topologySpreadConstraints on one topologyKey
+			return "" // Duplicate keys
+		}
+		seen[keyValue] = true
 
-		// Start with the key
-		lines = append(lines, fmt.Sprintf("%s%s:", indent, keyValue))
+		// Start with the key. An item holding only the key (e.g., an image
+		// pull secret's name) is an empty map: a null would remove the key
+		// when Helm merges values.
+		if len(item.Content) == 2 {
+			lines = append(lines, fmt.Sprintf("%s%s: {}", indent, mapKey(keyValue)))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s%s:", indent, mapKey(keyValue)))
 
 		// Add remaining fields
 		for j := 0; j < len(item.Content); j += 2 {
@@ -59,6 +71,237 @@ func GenerateMapReplacement(seqNode *yaml.Node, candidate detect.DetectedCandida
 	return strings.Join(lines, "\n")
 }
 
+// GenerateSetReplacement generates the set-format YAML for a list of scalars,
+// or of objects holding only the merge key: each value becomes a key set to
+// true (e.g., "- regcred" or "- name: regcred" -> "regcred: true"). A set
+// holds each value once, so it also returns the values repeated in the list,
+// for the caller to report.
+func GenerateSetReplacement(seqNode *yaml.Node, candidate detect.DetectedCandidate, baseIndent int) (string, []string) {
+	indent := strings.Repeat(" ", baseIndent)
+
+	// Handle empty sequence: [] -> {}
+	if len(seqNode.Content) == 0 {
+		return "{}", nil
+	}
+
+	var lines, repeated []string
+	seen := make(map[string]bool)
+	for _, item := range seqNode.Content {
+		var value string
+		switch {
+		case item.Kind == yaml.ScalarNode && item.Tag != "!!null":
+			value = item.Value
+		case item.Kind == yaml.MappingNode && candidate.MergeKey != "" &&
+			len(item.Content) == 2 && item.Content[0].Value == candidate.MergeKey && item.Content[1].Kind == yaml.ScalarNode:
+			value = item.Content[1].Value
+		default:
+			return "", nil // Items with other fields can't be set members
+		}
+		if value == "" {
+			return "", nil
+		}
+		if seen[value] {
+			repeated = append(repeated, value)
+			continue
+		}
+		seen[value] = true
+		lines = append(lines, fmt.Sprintf("%s%s: true", indent, mapKey(value)))
+	}
+
+	return strings.Join(lines, "\n"), repeated
+}
+
+// GenerateKeyedReplacement generates the map-format YAML for a list converted
+// by several key fields (candidate.MergeKeys), at no indentation. The nested
+// strategy keys the map one level per field (namespaceA: {svcA: {...}}); the
+// composite strategy joins the values with "/" (namespaceA/svcA: {...}), which
+// only the last value may contain. Items missing a key, or sharing all key
+// values with an earlier item, can't be converted.
+func GenerateKeyedReplacement(seqNode *yaml.Node, candidate detect.DetectedCandidate) string {
+	if len(seqNode.Content) == 0 {
+		return "{}"
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, item := range seqNode.Content {
+		if item.Kind != yaml.MappingNode {
+			return ""
+		}
+		values := make([]string, len(candidate.MergeKeys))
+		spec := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	fields:
+		for j := 0; j+1 < len(item.Content); j += 2 {
+			for k, key := range candidate.MergeKeys {
+				if item.Content[j].Value == key {
+					if item.Content[j+1].Kind != yaml.ScalarNode {
+						return ""
+					}
+					values[k] = item.Content[j+1].Value
+					continue fields
+				}
+			}
+			spec.Content = append(spec.Content, item.Content[j], item.Content[j+1])
+		}
+		if len(spec.Content) == 0 {
+			spec.Style = yaml.FlowStyle
+		}
+		for k, v := range values {
+			if v == "" || (candidate.KeyStrategy == detect.KeyStrategyComposite && k < len(values)-1 && strings.Contains(v, detect.CompositeKeySeparator)) {
+				return ""
+			}
+		}
+
+		parent := root
+		path := values
+		if candidate.KeyStrategy == detect.KeyStrategyComposite {
+			path = []string{strings.Join(values, detect.CompositeKeySeparator)}
+		}
+		for _, v := range path[:len(path)-1] {
+			child := mappingValue(parent, v)
+			if child == nil {
+				child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}, child)
+			}
+			parent = child
+		}
+		last := path[len(path)-1]
+		if mappingValue(parent, last) != nil {
+			return "" // Duplicate keys
+		}
+		parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: last}, spec)
+	}
+
+	var buf strings.Builder
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// GenerateShapedReplacement generates the map-format YAML for a list whose map
+// entries a rule reshaped, at no indentation: item fields are renamed by
+// candidate.Rename, and an entry holding only the candidate.Scalar field is
+// shortened to its value (FOO: bar). Entries that would lose information, such
+// as two fields renamed alike, can't be converted.
+func GenerateShapedReplacement(seqNode *yaml.Node, candidate detect.DetectedCandidate) string {
+	if len(seqNode.Content) == 0 {
+		return "{}"
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, item := range seqNode.Content {
+		if item.Kind != yaml.MappingNode {
+			return ""
+		}
+		var keyValue string
+		spec := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		var only *yaml.Node
+		for j := 0; j+1 < len(item.Content); j += 2 {
+			field, value := item.Content[j].Value, item.Content[j+1]
+			if field == candidate.MergeKey {
+				if value.Kind != yaml.ScalarNode {
+					return ""
+				}
+				keyValue = value.Value
+				continue
+			}
+			if field == candidate.Scalar {
+				only = value
+			}
+			if renamed, ok := candidate.Rename[field]; ok {
+				field = renamed
+			}
+			if mappingValue(spec, field) != nil {
+				return ""
+			}
+			fieldKey := *item.Content[j]
+			fieldKey.Value = field
+			spec.Content = append(spec.Content, &fieldKey, value)
+		}
+		if keyValue == "" || mappingValue(root, keyValue) != nil {
+			return ""
+		}
+
+		entry := spec
+		switch {
+		case only != nil && len(spec.Content) == 2 && only.Kind == yaml.ScalarNode && only.Tag != "!!null":
+			entry = only
+		case len(spec.Content) == 0:
+			entry.Style = yaml.FlowStyle
+		}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: keyValue}, entry)
+	}
+
+	var buf strings.Builder
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// GenerateSyntheticReplacement generates the map-format YAML for a list keyed
+// by a synthetic key, at no indentation. Items carrying the key field are
+// named by it, which is dropped; the rest are named after the section and
+// their position (ingress-1, ingress-2). Duplicate names can't be converted.
+func GenerateSyntheticReplacement(seqNode *yaml.Node, candidate detect.DetectedCandidate) string {
+	if len(seqNode.Content) == 0 {
+		return "{}"
+	}
+	section := candidate.SectionName
+	if section == "" {
+		section = "item"
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for i, item := range seqNode.Content {
+		if item.Kind != yaml.MappingNode {
+			return ""
+		}
+		name := fmt.Sprintf("%s-%d", section, i+1)
+		spec := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for j := 0; j+1 < len(item.Content); j += 2 {
+			if item.Content[j].Value == candidate.MergeKey {
+				if item.Content[j+1].Kind != yaml.ScalarNode || item.Content[j+1].Value == "" {
+					return ""
+				}
+				name = item.Content[j+1].Value
+				continue
+			}
+			spec.Content = append(spec.Content, item.Content[j], item.Content[j+1])
+		}
+		if mappingValue(root, name) != nil {
+			return "" // Duplicate names
+		}
+		if len(spec.Content) == 0 {
+			// An empty rule matches everything; {} keeps the entry when merged
+			spec.Style = yaml.FlowStyle
+		}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}, spec)
+	}
+
+	var buf strings.Builder
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// mappingValue returns the value of key in a mapping node, or nil
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
 // GenerateFieldYAML generates YAML for a single field with proper indentation
 func GenerateFieldYAML(keyNode, valueNode *yaml.Node, indent int) string {
 	indentStr := strings.Repeat(" ", indent)
@@ -100,6 +343,15 @@ func GenerateFieldYAML(keyNode, valueNode *yaml.Node, indent int) string {
 	return ""
 }
 
+// mapKey returns a merge key value as a YAML map key, quoted if it would not
+// read back as the same string (e.g., a mountPath with ": " or a leading "-")
+func mapKey(s string) string {
+	if needsQuoting(s) || strings.TrimSpace(s) != s || strings.HasPrefix(s, "-") || strings.HasPrefix(s, "?") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
+
 // needsQuoting returns true if a string value needs to be quoted
 func needsQuoting(s string) bool {
 	if s == "" {
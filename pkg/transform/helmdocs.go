@@ -0,0 +1,92 @@
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// reHelmDocsType matches a helm-docs type hint, e.g. "# -- (list) Volumes"
+	reHelmDocsType = regexp.MustCompile(`^(\s*#\s*--\s*)\((list|array)\)`)
+	// reHelmDocsListOf matches list wording in a helm-docs description
+	reHelmDocsListOf = regexp.MustCompile(`\b([Ll]ist|[Aa]rray) of\b`)
+	// reHelmDocsDefault matches an @default annotation, capturing its value
+	reHelmDocsDefault = regexp.MustCompile(`^(\s*#\s*@default\s*--\s*)(.*)$`)
+)
+
+// headerLines returns lines before keyLineIdx followed by the conversion comment.
+// If the key has a helm-docs comment block ("# -- ..."), the conversion comment
+// goes above the block so helm-docs keeps binding the block to the key, and the
+// block is rewritten to describe the map format.
+func headerLines(lines []string, keyLineIdx int, comment, mergeKey string) []string {
+	start := helmDocsStart(lines, keyLineIdx)
+	if start < 0 {
+		out := append([]string{}, lines[:keyLineIdx]...)
+		return append(out, comment)
+	}
+	out := append([]string{}, lines[:start]...)
+	out = append(out, comment)
+	return append(out, rewriteHelmDocs(lines[start:keyLineIdx], mergeKey)...)
+}
+
+// helmDocsStart returns the index of the "# --" line starting the helm-docs
+// comment block directly above keyLineIdx, or -1 if there is none
+func helmDocsStart(lines []string, keyLineIdx int) int {
+	start := -1
+	for i := keyLineIdx - 1; i >= 0; i-- {
+		trimmed := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+		if strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(trimmed, "#")), "--") {
+			start = i
+		}
+	}
+	return start
+}
+
+// rewriteHelmDocs rewrites a helm-docs comment block for a list converted to a
+// map keyed by mergeKey: list type hints and wording become map ones, list
+// @default values become their map equivalents, and the key is documented.
+func rewriteHelmDocs(block []string, mergeKey string) []string {
+	out := make([]string, 0, len(block)+1)
+	descEnd := -1 // last line of the description, before any @ annotations
+	for i, line := range block {
+		if m := reHelmDocsDefault.FindStringSubmatch(line); m != nil {
+			out = append(out, m[1]+mapDefault(m[2]))
+			continue
+		}
+		line = reHelmDocsType.ReplaceAllString(line, "${1}(object)")
+		line = reHelmDocsListOf.ReplaceAllStringFunc(line, func(s string) string {
+			if s[0] == 'L' || s[0] == 'A' {
+				return "Map of"
+			}
+			return "map of"
+		})
+		out = append(out, line)
+		if !strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "#")), "@") {
+			descEnd = i
+		}
+	}
+
+	note := fmt.Sprintf("Entries are keyed by `%s`.", mergeKey)
+	if descEnd < 0 || strings.Contains(strings.Join(block, "\n"), note) {
+		return out
+	}
+	indent := block[descEnd][:len(block[descEnd])-len(strings.TrimLeft(block[descEnd], " "))]
+	result := append([]string{}, out[:descEnd+1]...)
+	result = append(result, indent+"# "+note)
+	return append(result, out[descEnd+1:]...)
+}
+
+// mapDefault converts an @default value describing a list to the map equivalent
+func mapDefault(v string) string {
+	switch strings.TrimSpace(v) {
+	case "[]":
+		return "{}"
+	case "`[]`":
+		return "`{}`"
+	}
+	return reHelmDocsListOf.ReplaceAllString(strings.ReplaceAll(v, "empty list", "empty map"), "map of")
+}
@@ -0,0 +1,95 @@
+package transform
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/detect"
+	"gopkg.in/yaml.v3"
+)
+
+func TestApplyLineEditsHelmDocs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "description and list wording",
+			in: `# Some section header
+
+# -- (list) List of environment variables for the app
+env:
+  - name: A
+    value: x
+`,
+			want: `# Some section header
+
+# Deployment.env (key: name)
+# -- (object) Map of environment variables for the app
+# Entries are keyed by ` + "`name`" + `.
+env:
+  A:
+    value: x
+`,
+		},
+		{
+			name: "empty list default",
+			in: `# -- Extra volumes
+# @default -- ` + "`[]`" + `
+env: []
+`,
+			want: `# Deployment.env (key: name)
+# -- Extra volumes
+# Entries are keyed by ` + "`name`" + `.
+# @default -- ` + "`{}`" + `
+env: {}
+`,
+		},
+		{
+			name: "plain comment is left alone",
+			in: `# environment
+env:
+  - name: A
+    value: x
+`,
+			want: `# environment
+# Deployment.env (key: name)
+env:
+  A:
+    value: x
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.in), &doc); err != nil {
+				t.Fatal(err)
+			}
+			candidates := map[string]detect.DetectedCandidate{
+				"env": {ValuesPath: "env", YAMLPath: "env", ResourceKind: "Deployment", MergeKey: "name"},
+			}
+			var edits []ArrayEdit
+			FindArrayEdits(&doc, nil, candidates, &edits)
+			got := string(ApplyLineEdits([]byte(tt.in), edits))
+			if got != tt.want {
+				t.Errorf("ApplyLineEdits() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteHelmDocsIsIdempotent(t *testing.T) {
+	t.Parallel()
+
+	block := []string{"  # -- Volumes", "  # Entries are keyed by `name`."}
+	got := rewriteHelmDocs(block, "name")
+	if strings.Join(got, "\n") != strings.Join(block, "\n") {
+		t.Errorf("rewriteHelmDocs() = %q, want unchanged %q", got, block)
+	}
+}
@@ -2,6 +2,7 @@ package transform
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 )
 
@@ -24,8 +25,9 @@ func TransformArrayToMapWithIndent(arrayLines []string, mergeKey string, mapEntr
 	for _, line := range arrayLines {
 		trimmed := strings.TrimLeft(line, " ")
 
-		// Check if this is a new array item (starts with "- ")
-		if strings.HasPrefix(trimmed, "- ") {
+		// Check if this is a new array item (starts with "- " at the items'
+		// indent; deeper ones are nested lists, like a host alias's hostnames)
+		if strings.HasPrefix(trimmed, "- ") && (!inItem || len(line)-len(trimmed) <= len(baseIndent)) {
 			// Process previous item if any
 			if inItem && len(currentItemLines) > 0 {
 				transformed := TransformSingleItemWithIndent(currentItemLines, mergeKey, baseIndent, mapEntryIndent)
@@ -94,12 +96,7 @@ func TransformSingleItemWithIndent(itemLines []string, mergeKey, baseIndent stri
 			rest := afterDash[valueStart:]
 
 			// Handle line comments
-			if commentIdx := strings.Index(rest, " #"); commentIdx >= 0 {
-				mergeKeyValue = strings.TrimSpace(rest[:commentIdx])
-				mergeKeyLineComment = rest[commentIdx:]
-			} else {
-				mergeKeyValue = strings.TrimSpace(rest)
-			}
+			mergeKeyValue, mergeKeyLineComment = splitLineComment(rest)
 
 			// Start result with the map key
 			result = append(result, fmt.Sprintf("%s%s:%s", keyIndentStr, mergeKeyValue, mergeKeyLineComment))
@@ -135,12 +132,7 @@ func TransformSingleItemWithIndent(itemLines []string, mergeKey, baseIndent stri
 			valueStart := len(mergeKey) + 2
 			rest := trimmed[valueStart:]
 
-			if commentIdx := strings.Index(rest, " #"); commentIdx >= 0 {
-				mergeKeyValue = strings.TrimSpace(rest[:commentIdx])
-				mergeKeyLineComment = rest[commentIdx:]
-			} else {
-				mergeKeyValue = strings.TrimSpace(rest)
-			}
+			mergeKeyValue, mergeKeyLineComment = splitLineComment(rest)
 
 			// Insert the map key at the beginning
 			keyLine := fmt.Sprintf("%s%s:%s", keyIndentStr, mergeKeyValue, mergeKeyLineComment)
@@ -158,5 +150,62 @@ func TransformSingleItemWithIndent(itemLines []string, mergeKey, baseIndent stri
 		}
 	}
 
+	// An item holding only the merge key is an empty map, not null, which
+	// would remove the key when Helm merges values
+	if len(result) == 1 && mergeKeyValue != "" {
+		result[0] = fmt.Sprintf("%s%s: {}%s", keyIndentStr, mergeKeyValue, mergeKeyLineComment)
+	}
+
+	return result
+}
+
+// splitLineComment splits a scalar as written from its trailing " #" comment.
+// A # inside a quoted scalar (e.g., "/var/log/app #1") is part of the value.
+func splitLineComment(rest string) (value, comment string) {
+	var quote byte
+	for i := 0; i < len(rest); i++ {
+		c := rest[i]
+		switch {
+		case quote != 0:
+			if (c == '\\' && quote == '"') || (c == '\'' && quote == '\'' && i+1 < len(rest) && rest[i+1] == '\'') {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && strings.TrimSpace(rest[:i]) == "":
+			quote = c
+		case c == '#' && i > 0 && (rest[i-1] == ' ' || rest[i-1] == '\t'):
+			return strings.TrimSpace(rest[:i-1]), rest[i-1:]
+		}
+	}
+	return strings.TrimSpace(rest), ""
+}
+
+// reEmptyEntry matches a map entry line holding an empty flow mapping,
+// capturing the line up to the colon and any trailing comment
+var reEmptyEntry = regexp.MustCompile(`^(.*:)\s+\{\s*\}(\s+#.*)?$`)
+
+// AddOrderFields adds an order field under each map entry of transformed map
+// lines, recording the entry's original list position in steps of 10 so that
+// overrides can slot new entries in between
+// Input:  ["  foo:", "    value: bar", "  baz:"], 2, "order"
+// Output: ["  foo:", "    order: 10", "    value: bar", "  baz:", "    order: 20"]
+// An entry holding only its key (foo: {}) is expanded into a mapping first.
+func AddOrderFields(mapLines []string, mapEntryIndent int, field string) []string {
+	var result []string
+	n := 0
+	for _, line := range mapLines {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || len(line)-len(trimmed) != mapEntryIndent {
+			result = append(result, line)
+			continue
+		}
+		if m := reEmptyEntry.FindStringSubmatch(line); m != nil {
+			line = m[1] + m[2]
+		}
+		result = append(result, line)
+		n++
+		result = append(result, fmt.Sprintf("%s%s: %d", strings.Repeat(" ", mapEntryIndent+2), field, n*10))
+	}
 	return result
 }
@@ -3,6 +3,9 @@ package transform
 import (
 	"strings"
 	"testing"
+
+	"github.com/scottrigby/helm-list-to-map-plugin/pkg/k8s"
+	"gopkg.in/yaml.v3"
 )
 
 func TestTransformArrayToMap(t *testing.T) {
@@ -96,6 +99,40 @@ func TestTransformArrayToMap(t *testing.T) {
 				"    name: https",
 			},
 		},
+		{
+			name: "hostAliases with nested hostnames list",
+			arrayLines: []string{
+				"  - ip: 127.0.0.1",
+				"    hostnames:",
+				"      - foo.local",
+				"      - bar.local",
+				"  - ip: 10.1.2.3",
+				"    hostnames:",
+				"    - remote.local",
+			},
+			mergeKey: "ip",
+			want: []string{
+				"  127.0.0.1:",
+				"    hostnames:",
+				"      - foo.local",
+				"      - bar.local",
+				"  10.1.2.3:",
+				"    hostnames:",
+				"    - remote.local",
+			},
+		},
+		{
+			name: "items holding only the key",
+			arrayLines: []string{
+				"  - name: regcred # pull secret",
+				"  - name: other",
+			},
+			mergeKey: "name",
+			want: []string{
+				"  regcred: {} # pull secret",
+				"  other: {}",
+			},
+		},
 		{
 			name:       "empty array",
 			arrayLines: []string{},
@@ -271,6 +308,20 @@ func TestTransformSingleItemWithIndent(t *testing.T) {
 				"      value: deep",
 			},
 		},
+		{
+			name: "quoted merge key value with a hash",
+			itemLines: []string{
+				`  - mountPath: "/var/log/app #1" # logs`,
+				"    name: logs",
+			},
+			mergeKey:       "mountPath",
+			baseIndent:     "  ",
+			mapEntryIndent: 2,
+			want: []string{
+				`  "/var/log/app #1": # logs`,
+				"    name: logs",
+			},
+		},
 		{
 			name: "use default indent when mapEntryIndent is -1",
 			itemLines: []string{
@@ -346,6 +397,66 @@ func TestNeedsQuoting(t *testing.T) {
 	}
 }
 
+func TestSplitLineComment(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in, value, comment string
+	}{
+		{" /var/log/app", "/var/log/app", ""},
+		{" /var/log/app # logs", "/var/log/app", " # logs"},
+		{` "a #b"`, `"a #b"`, ""},
+		{` "a #b" # c`, `"a #b"`, " # c"},
+		{` 'it''s #1' # c`, `'it''s #1'`, " # c"},
+		{` "say \"hi\" #x"`, `"say \"hi\" #x"`, ""},
+		{" a#b", "a#b", ""},
+	}
+	for _, tt := range tests {
+		value, comment := splitLineComment(tt.in)
+		if value != tt.value || comment != tt.comment {
+			t.Errorf("splitLineComment(%q) = %q, %q, want %q, %q", tt.in, value, comment, tt.value, tt.comment)
+		}
+	}
+}
+
+func TestMapKeyRoundTrips(t *testing.T) {
+	t.Parallel()
+
+	for _, key := range []string{"/var/log/app", "app.kubernetes.io/name", "a: b", `say "hi"`, "- item", " padded", "#tag", "plain"} {
+		var got map[string]interface{}
+		if err := yaml.Unmarshal([]byte(mapKey(key)+": x\n"), &got); err != nil {
+			t.Errorf("mapKey(%q) = %s does not parse: %v", key, mapKey(key), err)
+			continue
+		}
+		if _, ok := got[key]; !ok {
+			t.Errorf("mapKey(%q) = %s parsed as %v", key, mapKey(key), got)
+		}
+	}
+}
+
+func TestFindArrayEditsSkipsDottedKeys(t *testing.T) {
+	t.Parallel()
+
+	in := `a.b:
+  env:
+    - name: A
+a:
+  b:
+    env:
+      - name: B
+`
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(in), &doc); err != nil {
+		t.Fatal(err)
+	}
+	candidates := map[string]k8s.DetectedCandidate{"a.b.env": {ValuesPath: "a.b.env", MergeKey: "name"}}
+	var edits []ArrayEdit
+	FindArrayEdits(&doc, nil, candidates, &edits)
+	if len(edits) != 1 || edits[0].KeyLine != 6 {
+		t.Fatalf("FindArrayEdits() = %+v, want one edit for a.b.env at line 6", edits)
+	}
+}
+
 func TestDotPath(t *testing.T) {
 	t.Parallel()
 
@@ -369,3 +480,68 @@ func TestDotPath(t *testing.T) {
 		})
 	}
 }
+
+func TestAddOrderFields(t *testing.T) {
+	t.Parallel()
+
+	lines := []string{
+		"  DB_HOST:",
+		"    value: localhost",
+		"  # comment about DB_PORT",
+		"  DB_PORT:",
+		"    valueFrom:",
+		"      secretKeyRef:",
+		"        name: db",
+		"  DEBUG: {}",
+		"  TRACE: {} # no value",
+	}
+	want := []string{
+		"  DB_HOST:",
+		"    order: 10",
+		"    value: localhost",
+		"  # comment about DB_PORT",
+		"  DB_PORT:",
+		"    order: 20",
+		"    valueFrom:",
+		"      secretKeyRef:",
+		"        name: db",
+		"  DEBUG:",
+		"    order: 30",
+		"  TRACE: # no value",
+		"    order: 40",
+	}
+	got := AddOrderFields(lines, 2, "order")
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("AddOrderFields() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	var parsed map[string]interface{}
+	if err := yaml.Unmarshal([]byte(strings.Join(got, "\n")), &parsed); err != nil {
+		t.Errorf("AddOrderFields() output isn't valid YAML: %v", err)
+	}
+}
+
+func TestFindArrayEditsSkipsDuplicateKeys(t *testing.T) {
+	t.Parallel()
+
+	// Two constraints on one topologyKey can't share a map key
+	values := `topologySpreadConstraints:
+  - maxSkew: 1
+    topologyKey: kubernetes.io/hostname
+    whenUnsatisfiable: ScheduleAnyway
+  - maxSkew: 2
+    topologyKey: kubernetes.io/hostname
+    whenUnsatisfiable: DoNotSchedule
+`
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(values), &doc); err != nil {
+		t.Fatal(err)
+	}
+	candidates := map[string]k8s.DetectedCandidate{
+		"topologySpreadConstraints": {ValuesPath: "topologySpreadConstraints", MergeKey: "topologyKey"},
+	}
+	var edits []ArrayEdit
+	FindArrayEdits(&doc, nil, candidates, &edits)
+	if len(edits) != 0 {
+		t.Errorf("FindArrayEdits() = %+v, want no edits for duplicate keys", edits)
+	}
+}
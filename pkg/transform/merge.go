@@ -0,0 +1,135 @@
+package transform
+
+import (
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// isMergeKey reports whether a mapping key is a YAML merge key (<<)
+func isMergeKey(k *yaml.Node) bool {
+	return k.Kind == yaml.ScalarNode && k.Tag == "!!merge"
+}
+
+// FindMergedPaths returns the lists in a values tree that are only reachable
+// through a merge key. The line editor cannot convert them in place, and
+// converting their source would also change every block that merges it.
+func FindMergedPaths(node *yaml.Node) []MergedPath {
+	sources := make(map[*yaml.Node]string)
+	directLists(node, nil, sources)
+
+	var merged []MergedPath
+	walkMerged(node, nil, false, sources, make(map[*yaml.Node]bool), &merged)
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Path < merged[j].Path
+	})
+	return merged
+}
+
+// directLists records the path of every list set directly under its own key
+func directLists(node *yaml.Node, path []string, sources map[*yaml.Node]string) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			directLists(child, path, sources)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if isMergeKey(node.Content[i]) || !isPathSegment(node.Content[i].Value) {
+				continue
+			}
+			p := append(path, node.Content[i].Value)
+			if v := node.Content[i+1]; v.Kind == yaml.SequenceNode {
+				sources[v] = dotPath(p)
+			}
+			directLists(node.Content[i+1], p, sources)
+		}
+	}
+}
+
+// walkMerged follows merge keys the way YAML resolves them: keys set directly
+// win, then earlier merged mappings over later ones
+func walkMerged(node *yaml.Node, path []string, viaMerge bool, sources map[*yaml.Node]string, active map[*yaml.Node]bool, merged *[]MergedPath) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node == nil || active[node] {
+		return
+	}
+	active[node] = true
+	defer delete(active, node)
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			walkMerged(child, path, viaMerge, sources, active, merged)
+		}
+	case yaml.MappingNode:
+		seen := make(map[string]bool)
+		var mergeValues []*yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			if isMergeKey(k) {
+				mergeValues = append(mergeValues, v)
+				continue
+			}
+			seen[k.Value] = true
+			if !isPathSegment(k.Value) {
+				continue
+			}
+			walkMergedValue(v, append(path, k.Value), viaMerge, sources, active, merged)
+		}
+		for _, v := range mergeValues {
+			for _, m := range mergedMappings(v) {
+				for i := 0; i+1 < len(m.Content); i += 2 {
+					k := m.Content[i]
+					if isMergeKey(k) || seen[k.Value] {
+						continue
+					}
+					seen[k.Value] = true
+					if !isPathSegment(k.Value) {
+						continue
+					}
+					walkMergedValue(m.Content[i+1], append(path, k.Value), true, sources, active, merged)
+				}
+			}
+		}
+	}
+}
+
+// walkMergedValue records a list reached through a merge key, or walks into a mapping
+func walkMergedValue(v *yaml.Node, path []string, viaMerge bool, sources map[*yaml.Node]string, active map[*yaml.Node]bool, merged *[]MergedPath) {
+	target := v
+	if target.Kind == yaml.AliasNode && target.Alias != nil {
+		target = target.Alias
+	}
+	if target.Kind == yaml.SequenceNode {
+		if viaMerge {
+			*merged = append(*merged, MergedPath{Path: dotPath(path), Source: sources[target]})
+		}
+		return
+	}
+	walkMerged(v, path, viaMerge, sources, active, merged)
+}
+
+// mergedMappings returns the mappings a merge key value merges, in order:
+// an alias, an inline mapping, or a sequence of them
+func mergedMappings(v *yaml.Node) []*yaml.Node {
+	if v.Kind == yaml.AliasNode {
+		v = v.Alias
+	}
+	if v == nil {
+		return nil
+	}
+	switch v.Kind {
+	case yaml.MappingNode:
+		return []*yaml.Node{v}
+	case yaml.SequenceNode:
+		var maps []*yaml.Node
+		for _, item := range v.Content {
+			maps = append(maps, mergedMappings(item)...)
+		}
+		return maps
+	}
+	return nil
+}
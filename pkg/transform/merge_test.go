@@ -0,0 +1,98 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestFindMergedPaths(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		in   string
+		want []MergedPath
+	}{
+		{
+			name: "no merge keys",
+			in: `env:
+  - name: A
+`,
+		},
+		{
+			name: "list merged from an anchor",
+			in: `defaults: &defaults
+  env:
+    - name: A
+worker:
+  <<: *defaults
+`,
+			want: []MergedPath{{Path: "worker.env", Source: "defaults.env"}},
+		},
+		{
+			name: "direct key overrides the merged list",
+			in: `defaults: &defaults
+  env:
+    - name: A
+worker:
+  <<: *defaults
+  env:
+    - name: B
+`,
+		},
+		{
+			name: "nested list under a merged mapping",
+			in: `defaults: &defaults
+  container:
+    env:
+      - name: A
+worker:
+  <<: *defaults
+`,
+			want: []MergedPath{{Path: "worker.container.env", Source: "defaults.container.env"}},
+		},
+		{
+			name: "earlier merge wins",
+			in: `a: &a
+  env:
+    - name: A
+b: &b
+  env:
+    - name: B
+  ports:
+    - port: 80
+worker:
+  <<: [*a, *b]
+`,
+			want: []MergedPath{
+				{Path: "worker.env", Source: "a.env"},
+				{Path: "worker.ports", Source: "b.ports"},
+			},
+		},
+		{
+			name: "inline merged mapping",
+			in: `worker:
+  <<:
+    env:
+      - name: A
+`,
+			want: []MergedPath{{Path: "worker.env"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.in), &doc); err != nil {
+				t.Fatal(err)
+			}
+			if got := FindMergedPaths(&doc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindMergedPaths() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MoveValue moves the key at the dot path from, with its value and the
+// comments directly above it, to the dot path to in values YAML, keeping the
+// formatting of the rest of the file. A key renamed within its mapping keeps
+// its place; one moved to another mapping is appended to it, adding the
+// mappings on the way to it that aren't set. to must not be set.
+func MoveValue(data []byte, from, to string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s is not set", from)
+	}
+	root := doc.Content[0]
+	fromParts, toParts := strings.Split(from, "."), strings.Split(to, ".")
+
+	fromParent := mappingAt(root, fromParts[:len(fromParts)-1])
+	var key *yaml.Node
+	if fromParent != nil {
+		key = mappingKey(fromParent, fromParts[len(fromParts)-1])
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%s is not set", from)
+	}
+
+	// The deepest mapping set on the way to to, and the keys missing under it
+	toParent, depth := root, 0
+	for ; depth < len(toParts)-1; depth++ {
+		v := mappingValue(toParent, toParts[depth])
+		if v == nil {
+			break
+		}
+		if v.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s is not a mapping", strings.Join(toParts[:depth+1], "."))
+		}
+		toParent = v
+	}
+	missing := toParts[depth : len(toParts)-1]
+	if toParent.Style&yaml.FlowStyle != 0 {
+		return nil, fmt.Errorf("%s is a flow mapping", strings.Join(toParts[:depth], "."))
+	}
+	if len(missing) == 0 && mappingKey(toParent, toParts[len(toParts)-1]) != nil {
+		return nil, fmt.Errorf("%s is already set", to)
+	}
+
+	lines := strings.Split(string(data), "\n")
+	newKey := toParts[len(toParts)-1]
+	if toParent == fromParent && len(missing) == 0 {
+		lines[key.Line-1] = renameKeyLine(lines[key.Line-1], key, newKey)
+		return []byte(strings.Join(lines, "\n")), nil
+	}
+	if fromParent.Style&yaml.FlowStyle != 0 {
+		return nil, fmt.Errorf("%s is in a flow mapping", from)
+	}
+
+	// The moved block: head comments, the key line, and the lines indented
+	// under it, below the missing mappings indented two spaces a level
+	start, end := headCommentStart(lines, key.Line-1), blockEnd(lines, key.Line-1)
+	indent := toParent.Content[0].Column - 1
+	var block []string
+	for _, m := range missing {
+		block = append(block, strings.Repeat(" ", indent)+mapKey(m)+":")
+		indent += 2
+	}
+	moved := make([]string, end-start+1)
+	copy(moved, lines[start:end+1])
+	moved[key.Line-1-start] = renameKeyLine(moved[key.Line-1-start], key, newKey)
+	block = append(block, reindentLines(moved, indent-(key.Column-1))...)
+
+	// Appended after the block of the new parent's last key, set apart by a
+	// blank line if its keys are
+	last := toParent.Content[len(toParent.Content)-2]
+	insert := blockEnd(lines, last.Line-1) + 1
+	if i := headCommentStart(lines, last.Line-1); i > 0 && strings.TrimSpace(lines[i-1]) == "" {
+		block = append([]string{""}, block...)
+	}
+	// Removed with one of the blank lines around it, if it was set apart
+	cut, resume := start, end+1
+	blankBefore := cut == 0 || strings.TrimSpace(lines[cut-1]) == ""
+	switch {
+	case blankBefore && resume < len(lines)-1 && strings.TrimSpace(lines[resume]) == "":
+		resume++
+	case blankBefore && cut > 0 && (resume == len(lines) || strings.TrimSpace(lines[resume]) == ""):
+		cut--
+	}
+	rest := append(append([]string{}, lines[:cut]...), lines[resume:]...)
+	if insert > cut {
+		insert -= resume - cut
+	}
+	out := append(append(append([]string{}, rest[:insert]...), block...), rest[insert:]...)
+	return []byte(strings.Join(out, "\n")), nil
+}
+
+// mappingAt returns the mapping at path under node, or nil if it isn't one
+func mappingAt(node *yaml.Node, path []string) *yaml.Node {
+	for _, part := range path {
+		node = mappingValue(node, part)
+		if node == nil {
+			return nil
+		}
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	return node
+}
+
+// mappingKey returns the key node of key in a mapping node, or nil
+func mappingKey(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i]
+		}
+	}
+	return nil
+}
+
+// renameKeyLine replaces the key written on line with newKey
+func renameKeyLine(line string, key *yaml.Node, newKey string) string {
+	col := key.Column - 1
+	n := len(key.Value)
+	if key.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+		quote := line[col]
+		if i := strings.IndexByte(line[col+1:], quote); i >= 0 {
+			n = i + 2
+		}
+	}
+	return line[:col] + mapKey(newKey) + line[col+n:]
+}
+
+// headCommentStart returns the index of the first comment line directly above
+// the line at idx, or idx if there are none
+func headCommentStart(lines []string, idx int) int {
+	for idx > 0 && strings.HasPrefix(strings.TrimSpace(lines[idx-1]), "#") {
+		idx--
+	}
+	return idx
+}
+
+// blockEnd returns the index of the last line of the key at idx: the last
+// non-blank line indented more deeply than it (or a list item at its
+// indentation) before the next line that isn't
+func blockEnd(lines []string, idx int) int {
+	indent := len(lines[idx]) - len(strings.TrimLeft(lines[idx], " "))
+	end := idx
+	for i := idx + 1; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" {
+			continue
+		}
+		n := len(lines[i]) - len(strings.TrimLeft(lines[i], " "))
+		if n < indent || (n == indent && !strings.HasPrefix(trimmed, "-")) {
+			break
+		}
+		end = i
+	}
+	return end
+}
+
+// reindentLines shifts non-blank lines right by n spaces, or left by up to -n
+func reindentLines(lines []string, n int) []string {
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if n >= 0 {
+			lines[i] = strings.Repeat(" ", n) + line
+			continue
+		}
+		spaces := len(line) - len(strings.TrimLeft(line, " "))
+		lines[i] = line[min(spaces, -n):]
+	}
+	return lines
+}
@@ -0,0 +1,147 @@
+package transform
+
+import (
+	"testing"
+)
+
+func TestMoveValue(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		in       string
+		from, to string
+		want     string
+		wantErr  string
+	}{
+		{
+			name: "renamed in place",
+			in: `# -- Extra env vars
+extraEnvVars:
+  A:
+    value: a # inline
+image: nginx
+`,
+			from: "extraEnvVars",
+			to:   "env",
+			want: `# -- Extra env vars
+env:
+  A:
+    value: a # inline
+image: nginx
+`,
+		},
+		{
+			name: "quoted key renamed in place",
+			in: `app:
+  "extraEnvVars": {}
+`,
+			from: "app.extraEnvVars",
+			to:   "app.env",
+			want: `app:
+  env: {}
+`,
+		},
+		{
+			name: "moved into a mapping with its comments",
+			in: `# -- Volumes
+volumes:
+- name: data
+  emptyDir: {}
+
+pod:
+  labels: {}
+`,
+			from: "volumes",
+			to:   "pod.volumes",
+			want: `pod:
+  labels: {}
+  # -- Volumes
+  volumes:
+  - name: data
+    emptyDir: {}
+`,
+		},
+		{
+			name: "moved out to the top level, set apart like its keys",
+			in: `app:
+  settings:
+    env:
+      A: {}
+    debug: false
+  image: nginx
+
+service:
+  port: 80
+`,
+			from: "app.settings.env",
+			to:   "env",
+			want: `app:
+  settings:
+    debug: false
+  image: nginx
+
+service:
+  port: 80
+
+env:
+  A: {}
+`,
+		},
+		{
+			name: "missing mappings added",
+			in: `env:
+  A: {}
+image: nginx
+`,
+			from: "env",
+			to:   "app.container.env",
+			want: `image: nginx
+app:
+  container:
+    env:
+      A: {}
+`,
+		},
+		{
+			name:    "new path already set",
+			in:      "env: {}\nimage: {}\n",
+			from:    "env",
+			to:      "image",
+			wantErr: "image is already set",
+		},
+		{
+			name:    "parent isn't a mapping",
+			in:      "env: {}\nimage: nginx\n",
+			from:    "env",
+			to:      "image.env",
+			wantErr: "image is not a mapping",
+		},
+		{
+			name:    "old path not set",
+			in:      "image: nginx\n",
+			from:    "env",
+			to:      "vars",
+			wantErr: "env is not set",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := MoveValue([]byte(tt.in), tt.from, tt.to)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("MoveValue() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MoveValue() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("MoveValue() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,10 +4,21 @@ import "github.com/scottrigby/helm-list-to-map-plugin/pkg/detect"
 
 // ArrayEdit represents a single array-to-map conversion with line info
 type ArrayEdit struct {
-	KeyLine        int    // Line number of the key (e.g., "volumes:")
-	ValueStartLine int    // Line where the array value starts
-	ValueEndLine   int    // Line where the array value ends
-	KeyColumn      int    // Column of the key (for indentation)
-	Replacement    string // The new map-format YAML
+	KeyLine        int      // Line number of the key (e.g., "volumes:")
+	ValueStartLine int      // Line where the array value starts
+	ValueEndLine   int      // Line where the array value ends
+	KeyColumn      int      // Column of the key (for indentation)
+	Replacement    string   // The new map-format YAML
+	OrderField     string   // If set, each map entry gets this field holding its list position
+	KeepExamples   bool     // Keep commented-out examples after the array, e.g. to convert them too
+	Repeated       []string // Values repeated in a list converted to a set, which holds them once
 	Candidate      detect.DetectedCandidate
 }
+
+// MergedPath is a list reached through a YAML merge key (<<) or alias rather
+// than set directly under its own key
+type MergedPath struct {
+	Path   string // Values path the list is reached at (e.g., worker.env)
+	Source string // Path of the merged list (e.g., defaults.env); empty if merged inline
+	Alias  bool   // Reached through a plain alias (*name) rather than a merge key
+}